@@ -30,6 +30,7 @@ type ABI struct {
 	Constructor Method
 	Methods     map[string]Method
 	Events      map[string]Event
+	Errors      map[string]Error
 }
 
 // JSON returns a parsed ABI interface and error if it failed.
@@ -112,12 +113,13 @@ func (abi ABI) UnpackIntoMap(v map[string]interface{}, name string, data []byte)
 // UnmarshalJSON implements json.Unmarshaler interface
 func (abi *ABI) UnmarshalJSON(data []byte) error {
 	var fields []struct {
-		Type      string
-		Name      string
-		Constant  bool
-		Anonymous bool
-		Inputs    []Argument
-		Outputs   []Argument
+		Type            string
+		Name            string
+		Constant        bool
+		StateMutability string // replaces Constant since solc 0.6
+		Anonymous       bool
+		Inputs          []Argument
+		Outputs         []Argument
 	}
 
 	if err := json.Unmarshal(data, &fields); err != nil {
@@ -126,6 +128,7 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 
 	abi.Methods = make(map[string]Method)
 	abi.Events = make(map[string]Event)
+	abi.Errors = make(map[string]Error)
 	for _, field := range fields {
 		switch field.Type {
 		case "constructor":
@@ -136,7 +139,7 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 		case "function", "":
 			abi.Methods[field.Name] = Method{
 				Name:    field.Name,
-				Const:   field.Constant,
+				Const:   field.Constant || field.StateMutability == "view" || field.StateMutability == "pure",
 				Inputs:  field.Inputs,
 				Outputs: field.Outputs,
 			}
@@ -146,6 +149,11 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 				Anonymous: field.Anonymous,
 				Inputs:    field.Inputs,
 			}
+		case "error":
+			abi.Errors[field.Name] = Error{
+				Name:   field.Name,
+				Inputs: field.Inputs,
+			}
 		}
 	}
 
@@ -120,7 +120,7 @@ func unpack(t *Type, dst interface{}, src interface{}) error {
 		srcVal = reflect.ValueOf(src)
 	)
 
-	if t.T != TupleTy && !((t.T == SliceTy || t.T == ArrayTy) && t.Elem.T == TupleTy) {
+	if !hasTuple(t) {
 		return set(dstVal, srcVal)
 	}
 
@@ -170,6 +170,19 @@ func unpack(t *Type, dst interface{}, src interface{}) error {
 	return nil
 }
 
+// hasTuple reports whether t is a tuple or a slice or array of them, at any
+// depth. Unpacking such types goes field by field, as the tuple struct created by
+// NewType is not assignable to the caller's.
+func hasTuple(t *Type) bool {
+	switch t.T {
+	case TupleTy:
+		return true
+	case SliceTy, ArrayTy:
+		return hasTuple(t.Elem)
+	}
+	return false
+}
+
 // unpackIntoMap unpacks marshalledValues into the provided map[string]interface{}
 func (arguments Arguments) unpackIntoMap(v map[string]interface{}, marshalledValues []interface{}) error {
 	// Make sure map is not nil
@@ -191,6 +204,10 @@ func (arguments Arguments) unpackAtomic(v interface{}, marshalledValues interfac
 	argument := arguments.NonIndexed()[0]
 	elem := reflect.ValueOf(v).Elem()
 
+	// A struct receives a lone tuple directly, unless it has a field for it.
+	if elem.Kind() == reflect.Struct && argument.Type.T == TupleTy && !elem.FieldByName(ToCamelCase(argument.Name)).IsValid() {
+		return unpack(&argument.Type, elem.Addr().Interface(), marshalledValues)
+	}
 	if elem.Kind() == reflect.Struct {
 		fieldmap, err := mapArgNamesToStructFields([]string{argument.Name}, elem)
 		if err != nil {
@@ -26,6 +26,7 @@ import (
 	"github.com/chislab/go-fiscobcos/common"
 	"github.com/chislab/go-fiscobcos/core/types"
 	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
 )
 
 // NewTransactor is a utility method to easily create a transaction signer from
@@ -43,21 +44,28 @@ func NewTransactor(keyin io.Reader, passphrase string) (*TransactOpts, error) {
 }
 
 // NewKeyedTransactor is a utility method to easily create a transaction signer
-// from a single private key.
+// from a single private key. Transactions are signed for the group of their
+// context or the backend's default unless the returned options' GroupId is set.
+// SM2 keys (see crypto/gm) sign for guomi chains.
 func NewKeyedTransactor(key *ecdsa.PrivateKey) *TransactOpts {
-	keyAddr := crypto.PubkeyToAddress(key.PublicKey)
+	var (
+		keyAddr common.Address
+		mode    = types.ChainModeStandard
+	)
+	if gm.IsSM2(&key.PublicKey) {
+		keyAddr = gm.PubkeyToAddress(key.PublicKey)
+		mode = types.ChainModeGM
+	} else {
+		keyAddr = crypto.PubkeyToAddress(key.PublicKey)
+	}
 	return &TransactOpts{
-		From:    keyAddr,
-		GroupId: 1,
+		From:      keyAddr,
+		ChainMode: mode,
 		Signer: func(signer types.Signer, address common.Address, tx *types.Transaction) (*types.Transaction, error) {
 			if address != keyAddr {
 				return nil, errors.New("not authorized to sign this account")
 			}
-			signature, err := crypto.Sign(signer.Hash(tx).Bytes(), key)
-			if err != nil {
-				return nil, err
-			}
-			return tx.WithSignature(signer, signature)
+			return types.SignTx(tx, signer, key)
 		},
 	}
 }
@@ -39,6 +39,14 @@ var (
 	// This error is returned by WaitDeployed if contract creation leaves an
 	// empty contract behind.
 	ErrNoCodeAfterDeploy = errors.New("no contract code after deployment")
+
+	// ErrNoBlockLimit is returned by transact operations without a block limit
+	// on a backend that doesn't implement BlockLimiter.
+	ErrNoBlockLimit = errors.New("no block limit set and backend cannot provide one")
+
+	// ErrNoReceipts is returned by TransactAndCall on a backend that doesn't
+	// implement DeployBackend, so the receipt can't be waited for.
+	ErrNoReceipts = errors.New("backend cannot retrieve transaction receipts")
 )
 
 // ContractCaller defines the methods needed to allow operating with contract on a read
@@ -46,7 +54,7 @@ var (
 type ContractCaller interface {
 	// CodeAt returns the code of the given account. This is needed to differentiate
 	// between contract internal errors and the local chain being out of sync.
-	CodeAt(ctx context.Context, groupId int, contract common.Address, blockNumber *big.Int) ([]byte, error)
+	CodeAt(ctx context.Context, groupId uint64, contract common.Address, blockNumber *big.Int) ([]byte, error)
 	// ContractCall executes an FiscoBcos contract call with the specified data as the
 	// input.
 	CallContract(ctx context.Context, call fiscobcos.CallMsg, blockNumber *big.Int) ([]byte, error)
@@ -67,27 +75,50 @@ type PendingContractCaller interface {
 // used when the user does not provide some needed values, but rather leaves it up
 // to the transactor to decide.
 type ContractTransactor interface {
-	// SendTransaction injects the transaction into the pending pool for execution.
-	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	fiscobcos.TransactionSender
+}
+
+// BlockLimiter is implemented by transactors able to compute the block limit of
+// new transactions. Transact discovers it when TransactOpts.BlockLimit is nil.
+type BlockLimiter interface {
+	// GetBlockLimit returns the block number after which a transaction sent now
+	// to the group is rejected.
+	GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error)
+}
+
+// ChainModeDetector is implemented by transactors able to tell the cryptography of
+// the chain. Transact discovers it to pick the transaction signer, overriding
+// TransactOpts.ChainMode.
+type ChainModeDetector interface {
+	// IsGM reports whether the chain signs with SM2 and hashes with SM3.
+	IsGM(ctx context.Context) (bool, error)
+}
+
+// ChainIdReader is implemented by transactors able to tell the chain id of the
+// node. Transact discovers it when TransactOpts.ChainId is nil.
+type ChainIdReader interface {
+	// ChainId returns the chain id transactions must carry.
+	ChainId(ctx context.Context) (*big.Int, error)
+}
+
+// GroupDefaulter is implemented by backends with a default group, used for
+// transactions whose options name no group, neither explicitly nor through
+// their context.
+type GroupDefaulter interface {
+	// DefaultGroup returns the group targeted by requests not naming one.
+	DefaultGroup() uint64
 }
 
 // ContractFilterer defines the methods needed to access log events using one-off
 // queries or continuous event subscriptions.
 type ContractFilterer interface {
-	// FilterLogs executes a log filter operation, blocking during execution and
-	// returning all the results in one batch.
-	// TODO(karalabe): Deprecate when the subscription one can return past data too.
-	FilterLogs(ctx context.Context, query fiscobcos.FilterQuery) ([]types.Log, error)
-
-	// SubscribeFilterLogs creates a background log filtering operation, returning
-	// a subscription immediately, which can be used to stream the found events.
-	SubscribeFilterLogs(ctx context.Context, query fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error)
+	fiscobcos.LogFilterer
 }
 
 // DeployBackend wraps the operations needed by WaitMined and WaitDeployed.
 type DeployBackend interface {
 	TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error)
-	CodeAt(ctx context.Context, groupId int, account common.Address, blockNumber *big.Int) ([]byte, error)
+	CodeAt(ctx context.Context, groupId uint64, account common.Address, blockNumber *big.Int) ([]byte, error)
 }
 
 // ContractBackend defines the methods needed to work with contracts on a read-write basis.
@@ -95,4 +126,8 @@ type ContractBackend interface {
 	ContractCaller
 	ContractTransactor
 	ContractFilterer
+
+	// TransactionReceipt returns the receipt of a mined transaction, used by
+	// DeployContract to learn the address of the deployed contract.
+	TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error)
 }
@@ -0,0 +1,150 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/event"
+)
+
+const vaultABI = `[
+	{"inputs":[],"name":"balance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[{"name":"v","type":"uint256"}],"name":"set","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+// fakeChain is a hand-written backend implementing nothing but the interfaces
+// of package fiscobcos, and CodeAt, recording the groups it is asked for. All
+// transactions are mined with receipt, if set.
+type fakeChain struct {
+	callGroup   int
+	callTo      common.Address
+	sent        []*types.Transaction
+	receipt     *types.Receipt
+	filterGroup uint64
+	watchGroup  uint64
+	logs        []types.Log
+}
+
+var (
+	_ fiscobcos.ContractCaller    = (*fakeChain)(nil)
+	_ fiscobcos.TransactionSender = (*fakeChain)(nil)
+	_ fiscobcos.LogFilterer       = (*fakeChain)(nil)
+)
+
+func (c *fakeChain) CallContract(ctx context.Context, call fiscobcos.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.callGroup, c.callTo = call.GroupId, *call.Msg.To
+	return common.LeftPadBytes([]byte{42}, 32), nil
+}
+
+func (c *fakeChain) CodeAt(ctx context.Context, groupId uint64, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (c *fakeChain) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *fakeChain) TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error) {
+	return c.receipt, nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q fiscobcos.FilterQuery) ([]types.Log, error) {
+	c.filterGroup = q.GroupId
+	return c.logs, nil
+}
+
+func (c *fakeChain) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
+	c.watchGroup = q.GroupId
+	logs := c.logs
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for _, log := range logs {
+			select {
+			case ch <- log:
+			case <-quit:
+				return nil
+			}
+		}
+		<-quit
+		return nil
+	}), nil
+}
+
+// TestBoundContractFakeBackend drives a bound contract through a hand-written
+// backend, checking each operation reaches it with the group of its options.
+func TestBoundContractFakeBackend(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(vaultABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.GenerateKey()
+	address := common.Address{0xc0}
+
+	for _, groupId := range []int{1, 3} {
+		chain := &fakeChain{logs: []types.Log{{Address: address, Topics: []common.Hash{parsed.Events["Transfer"].Id()}, BlockNumber: 7}}}
+		contract := bind.NewBoundContract(address, parsed, chain, chain, chain)
+
+		var balance *big.Int
+		if err := contract.Call(&bind.CallOpts{GroupId: groupId}, &balance, "balance"); err != nil || balance.Int64() != 42 {
+			t.Errorf("group %d: call returned %v, %v", groupId, balance, err)
+		}
+		if chain.callGroup != groupId {
+			t.Errorf("group %d: called in group %d", groupId, chain.callGroup)
+		}
+
+		opts := bind.NewKeyedTransactor(key)
+		opts.GroupId = groupId
+		if _, err := contract.Transact(opts, "set", big.NewInt(1)); err != bind.ErrNoBlockLimit {
+			t.Errorf("group %d: transacting without block limit: %v, want ErrNoBlockLimit", groupId, err)
+		}
+		opts.BlockLimit = big.NewInt(100)
+		if _, err := contract.Transact(opts, "set", big.NewInt(1)); err != nil {
+			t.Errorf("group %d: Transact error: %v", groupId, err)
+		} else if len(chain.sent) != 1 || chain.sent[0].GroupId().Int64() != int64(groupId) {
+			t.Errorf("group %d: sent %d transactions", groupId, len(chain.sent))
+		}
+
+		logs, sub, err := contract.FilterLogs(&bind.FilterOpts{GroupId: groupId}, "Transfer")
+		if err != nil {
+			t.Fatalf("group %d: FilterLogs error: %v", groupId, err)
+		}
+		if log := <-logs; log.BlockNumber != 7 || chain.filterGroup != uint64(groupId) {
+			t.Errorf("group %d: filtered log of block %d in group %d", groupId, log.BlockNumber, chain.filterGroup)
+		}
+		sub.Unsubscribe()
+
+		logs, sub, err = contract.WatchLogs(&bind.WatchOpts{GroupId: groupId}, "Transfer")
+		if err != nil {
+			t.Fatalf("group %d: WatchLogs error: %v", groupId, err)
+		}
+		if log := <-logs; log.BlockNumber != 7 || chain.watchGroup != uint64(groupId) {
+			t.Errorf("group %d: watched log of block %d in group %d", groupId, log.BlockNumber, chain.watchGroup)
+		}
+		sub.Unsubscribe()
+	}
+}
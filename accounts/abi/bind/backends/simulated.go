@@ -0,0 +1,682 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package backends implements contract backends for the bindings that don't
+// need a node.
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/state"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/core/vm"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethdb/memorydb"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+// This nil assignment ensures at compile time that SimulatedBackend implements
+// bind.ContractBackend.
+var _ bind.ContractBackend = (*SimulatedBackend)(nil)
+
+const (
+	// simulatedGasLimit is the gas of transactions and calls that don't set
+	// less, the default tx_gas_limit of FISCO BCOS.
+	simulatedGasLimit uint64 = 300000000
+
+	// blockLimitRange is how far beyond the current block the block limit of
+	// a transaction may be.
+	blockLimitRange = 1000
+
+	// blockLimitOffset is the block limit GetBlockLimit adds to the current
+	// block number.
+	blockLimitOffset = 600
+
+	// blockInterval is the time between simulated blocks, in milliseconds.
+	blockInterval = 1000
+)
+
+var errIntrinsicGas = errors.New("intrinsic gas too low")
+
+// SimulatedBackend is a contract backend executing transactions in memory, for
+// testing contracts and bindings without a node. Every transaction is executed
+// right away in a block of its own, so receipts are available as soon as
+// SendTransaction returns. Block times start at the Unix epoch and advance by a
+// second per block, which makes the whole chain, receipts included, depend on
+// the transactions only.
+//
+// Each group has its own state and chain. Transactions are signed in standard
+// mode, the precompiled system contracts of FISCO BCOS aren't available.
+type SimulatedBackend struct {
+	mu           sync.Mutex
+	groups       map[uint64]*simGroup
+	defaultGroup uint64
+	snapshots    []map[uint64]uint64 // head block number of each group per snapshot
+}
+
+// simGroup is the chain of a group.
+type simGroup struct {
+	id     uint64
+	db     state.Database
+	blocks []*simBlock
+	txs    map[common.Hash]*simBlock
+	nonces map[string]bool // random ids of the transactions on chain
+	feed   event.Feed      // logs of new blocks, as []*types.Log
+}
+
+// simBlock is a simulated block with the transaction it holds, none for the
+// genesis block.
+type simBlock struct {
+	number  uint64
+	hash    common.Hash
+	time    uint64
+	root    common.Hash // state root after the block
+	tx      *types.Transaction
+	receipt *types.Receipt
+}
+
+// NewSimulatedBackend creates a backend with empty chains for the given groups,
+// just group 1 if none are given. The first group is the one used by requests
+// not specifying any.
+func NewSimulatedBackend(groupIds ...uint64) *SimulatedBackend {
+	if len(groupIds) == 0 {
+		groupIds = []uint64{1}
+	}
+	b := &SimulatedBackend{groups: make(map[uint64]*simGroup), defaultGroup: groupIds[0]}
+	for _, id := range groupIds {
+		g := &simGroup{
+			id:     id,
+			db:     state.NewDatabase(memorydb.New()),
+			txs:    make(map[common.Hash]*simBlock),
+			nonces: make(map[string]bool),
+		}
+		statedb, _ := state.New(common.Hash{}, g.db)
+		root, _ := statedb.Commit(true)
+		genesis := &simBlock{root: root}
+		genesis.hash = g.blockHash(common.Hash{}, genesis)
+		g.blocks = []*simBlock{genesis}
+		b.groups[id] = g
+	}
+	return b
+}
+
+// Close implements the closing method of the clients, it does nothing.
+func (b *SimulatedBackend) Close() {}
+
+// Snapshot records the chains of all groups, returning an id that Rollback
+// takes to return to them.
+func (b *SimulatedBackend) Snapshot() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	heads := make(map[uint64]uint64, len(b.groups))
+	for id, g := range b.groups {
+		heads[id] = g.head().number
+	}
+	b.snapshots = append(b.snapshots, heads)
+	return len(b.snapshots) - 1
+}
+
+// Rollback discards all blocks added since the snapshot with the given id was
+// taken, in all groups. The snapshot and the ones taken after it are dropped,
+// earlier snapshots can still be rolled back to. Logs already delivered to
+// subscriptions aren't retracted.
+func (b *SimulatedBackend) Rollback(id int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id < 0 || id >= len(b.snapshots) {
+		return fmt.Errorf("unknown snapshot %d", id)
+	}
+	for groupId, head := range b.snapshots[id] {
+		g := b.groups[groupId]
+		for _, block := range g.blocks[head+1:] {
+			delete(g.txs, block.tx.Hash())
+			delete(g.nonces, block.tx.RandomId().String())
+		}
+		g.blocks = g.blocks[:head+1]
+	}
+	b.snapshots = b.snapshots[:id]
+	return nil
+}
+
+// DefaultGroup returns the group used by requests not specifying any, the first
+// group of NewSimulatedBackend.
+func (b *SimulatedBackend) DefaultGroup() uint64 {
+	return b.defaultGroup
+}
+
+// group returns the chain of a group, of the group carried by ctx if groupId is
+// zero, or the default group.
+func (b *SimulatedBackend) group(ctx context.Context, groupId uint64) (*simGroup, error) {
+	if groupId == 0 {
+		var ok bool
+		if groupId, ok = fiscobcos.GroupFromContext(ctx); !ok {
+			groupId = b.defaultGroup
+		}
+	}
+	g, ok := b.groups[groupId]
+	if !ok {
+		return nil, nodeError(-40001, ethclient.ErrGroupNotExist)
+	}
+	return g, nil
+}
+
+// nodeError returns the error a node reports with the given code.
+func nodeError(code int, err error) error {
+	return &ethclient.Error{Code: code, Message: err.Error(), Err: err}
+}
+
+// BlockNumber returns the number of the latest block of the group.
+func (b *SimulatedBackend) BlockNumber(ctx context.Context, groupId uint64) (*big.Int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, err := b.group(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(g.head().number), nil
+}
+
+// GetBlockLimit returns the block limit for a transaction sent now to the group.
+func (b *SimulatedBackend) GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error) {
+	number, err := b.BlockNumber(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	return number.Add(number, big.NewInt(blockLimitOffset)), nil
+}
+
+// IsGM reports that the simulated chains use standard cryptography.
+func (b *SimulatedBackend) IsGM(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// Code returns the code of the contract at the hex address contraddress in the
+// latest block, hex encoded.
+func (b *SimulatedBackend) Code(ctx context.Context, groupId uint64, contraddress string) (string, error) {
+	addr, err := hexutil.Decode(contraddress)
+	if err != nil || len(addr) != common.AddressLength {
+		return "", nodeError(-32602, ethclient.ErrInvalidParams)
+	}
+	code, err := b.CodeAt(ctx, groupId, common.BytesToAddress(addr), nil)
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(code), nil
+}
+
+// CodeAt returns the code of the given account at the given block, the latest
+// one if blockNumber is nil.
+func (b *SimulatedBackend) CodeAt(ctx context.Context, groupId uint64, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, err := b.group(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := g.stateAt(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(contract), nil
+}
+
+// PendingCodeAt returns the code of the given account in the latest block of the
+// default group, there being no pending state.
+func (b *SimulatedBackend) PendingCodeAt(ctx context.Context, contract common.Address) ([]byte, error) {
+	return b.CodeAt(ctx, 0, contract, nil)
+}
+
+// CallContract executes a message call at the given block, the latest one if
+// blockNumber is nil, without changing the state. Failed calls are reported
+// like ethclient.Client does, as *ethclient.RevertError or *ethclient.Error.
+func (b *SimulatedBackend) CallContract(ctx context.Context, call fiscobcos.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	result, err := b.CallContractDetailed(ctx, call, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	switch result.Status {
+	case types.StatusSuccess:
+		return result.Output, nil
+	case types.StatusRevertInstruction:
+		reason, _ := result.RevertReason()
+		return nil, &ethclient.RevertError{Reason: reason, Output: result.Output}
+	default:
+		return nil, &ethclient.Error{Code: result.Status, Message: types.StatusMessage(result.Status)}
+	}
+}
+
+// CallContractDetailed is like CallContract, but returns the result of the call
+// including its execution status rather than failing if the execution failed.
+func (b *SimulatedBackend) CallContractDetailed(ctx context.Context, call fiscobcos.CallMsg, blockNumber *big.Int) (*types.CallResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, err := b.group(ctx, uint64(call.GroupId))
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := g.stateAt(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	parent := g.head()
+	if blockNumber != nil {
+		parent = g.blocks[blockNumber.Uint64()]
+	}
+	msg := call.Msg
+	output, _, _, err := g.execute(statedb, parent, msg.From, msg.To, msg.Data, msg.Gas, msg.Value)
+	return &types.CallResult{
+		CurrentBlockNumber: parent.number,
+		Status:             statusOf(err),
+		Output:             output,
+	}, nil
+}
+
+// PendingCallContract executes a message call in the latest block of the
+// default group, there being no pending state.
+func (b *SimulatedBackend) PendingCallContract(ctx context.Context, call fiscobcos.CallMsg) ([]byte, error) {
+	return b.CallContract(ctx, call, nil)
+}
+
+// SendTransaction executes a signed transaction in a new block. The transaction
+// is sent to the group carried by ctx, or to its own group. Transactions are
+// rejected with the errors of a node if they are already on chain, reuse the
+// random id of another one or are out of their block limit; execution failures
+// are reported by the status of their receipt.
+func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	logs, g, err := b.sendTransaction(ctx, tx)
+	b.mu.Unlock()
+
+	if err == nil && len(logs) > 0 {
+		g.feed.Send(logs)
+	}
+	return err
+}
+
+func (b *SimulatedBackend) sendTransaction(ctx context.Context, tx *types.Transaction) ([]*types.Log, *simGroup, error) {
+	groupId := tx.GroupId().Uint64()
+	if ctxGroup, ok := fiscobcos.GroupFromContext(ctx); ok {
+		if ctxGroup != groupId {
+			return nil, nil, nodeError(10003, ethclient.ErrInvalidGroupId)
+		}
+	}
+	g, err := b.group(ctx, groupId)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := types.Sender(types.NewChainSigner(types.ChainModeStandard), tx)
+	if err != nil {
+		return nil, nil, nodeError(types.StatusInvalidSignature, ethclient.ErrInvalidSignature)
+	}
+	if _, ok := g.txs[tx.Hash()]; ok {
+		return nil, nil, nodeError(10001, ethclient.ErrTxAlreadyInChain)
+	}
+	if g.nonces[tx.RandomId().String()] {
+		return nil, nil, nodeError(types.StatusNonceCheckFail, ethclient.ErrNonceCheckFail)
+	}
+	parent := g.head()
+	if limit := tx.BlockLimit(); limit.Cmp(new(big.Int).SetUint64(parent.number)) <= 0 ||
+		limit.Cmp(new(big.Int).SetUint64(parent.number+blockLimitRange)) > 0 {
+		return nil, nil, nodeError(types.StatusBlockLimitCheckFail, ethclient.ErrBlockLimitCheckFail)
+	}
+
+	statedb, err := state.New(parent.root, g.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+	output, contract, gasUsed, err := g.execute(statedb, parent, from, tx.To(), tx.Data(), tx.Gas(), tx.Value())
+	root, commitErr := statedb.Commit(true)
+	if commitErr != nil {
+		return nil, nil, commitErr
+	}
+
+	block := &simBlock{number: parent.number + 1, time: parent.time + blockInterval, root: root, tx: tx}
+	block.hash = g.blockHash(parent.hash, block)
+	logs := statedb.GetLogs(tx.Hash())
+	for _, log := range logs {
+		log.BlockHash = block.hash
+	}
+	block.receipt = &types.Receipt{
+		BlockHash:   block.hash,
+		BlockNumber: block.number,
+		From:        from,
+		GasUsed:     gasUsed,
+		Input:       tx.Data(),
+		Logs:        logs,
+		Bloom:       types.BytesToBloom(types.LogsBloom(logs).Bytes()),
+		Output:      output,
+		Root:        root,
+		Status:      hexutil.EncodeUint64(uint64(statusOf(err))),
+		To:          tx.To(),
+		TxHash:      tx.Hash(),
+	}
+	if tx.To() == nil && err == nil {
+		block.receipt.ContractAddress = &contract
+	}
+	if block.receipt.Logs == nil {
+		block.receipt.Logs = []*types.Log{}
+	}
+	g.blocks = append(g.blocks, block)
+	g.txs[tx.Hash()] = block
+	g.nonces[tx.RandomId().String()] = true
+	return logs, g, nil
+}
+
+// TransactionReceipt returns the receipt of a transaction, fiscobcos.NotFound if
+// it isn't on chain.
+func (b *SimulatedBackend) TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, err := b.group(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	block, ok := g.txs[txHash]
+	if !ok {
+		return nil, fiscobcos.NotFound
+	}
+	return block.receipt, nil
+}
+
+// FilterLogs returns the logs matching the query in its group, or if it has
+// none, the group carried by ctx or the default group.
+func (b *SimulatedBackend) FilterLogs(ctx context.Context, q fiscobcos.FilterQuery) ([]types.Log, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, err := b.group(ctx, q.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	if q.BlockHash != nil {
+		for _, block := range g.blocks {
+			if block.hash == *q.BlockHash {
+				return filterLogs(block, q), nil
+			}
+		}
+		return nil, nodeError(-40003, ethclient.ErrBlockHashNotExist)
+	}
+	from, to := g.blockRange(q.FromBlock, q.ToBlock, 0)
+	logs := []types.Log{}
+	for n := from; n <= to && n < uint64(len(g.blocks)); n++ {
+		logs = append(logs, filterLogs(g.blocks[n], q)...)
+	}
+	return logs, nil
+}
+
+// SubscribeFilterLogs streams the logs matching the query in its group, or the
+// group carried by ctx, or the default group. Logs of the blocks from FromBlock on are
+// delivered first, if it is set, and the subscription ends after the logs of
+// ToBlock, if it is set to a block number rather than a tag.
+func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
+	b.mu.Lock()
+	g, err := b.group(ctx, q.GroupId)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	var (
+		pushes = make(chan []*types.Log, 16)
+		sub    = g.feed.Subscribe(pushes)
+		past   []types.Log
+		head   = g.head().number
+	)
+	if q.FromBlock != nil {
+		from, to := g.blockRange(q.FromBlock, q.ToBlock, head)
+		for n := from; n <= to && n <= head; n++ {
+			past = append(past, filterLogs(g.blocks[n], q)...)
+		}
+	}
+	b.mu.Unlock()
+
+	last := ^uint64(0)
+	if q.ToBlock != nil && q.ToBlock.Sign() >= 0 {
+		last = q.ToBlock.Uint64()
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for _, log := range past {
+			select {
+			case ch <- log:
+			case <-quit:
+				return nil
+			}
+		}
+		if head >= last {
+			return nil
+		}
+		for {
+			select {
+			case logs := <-pushes:
+				number := logs[0].BlockNumber
+				if number <= head {
+					// Delivered with the past logs already.
+					continue
+				}
+				for _, log := range logs {
+					if !logMatches(log, q) {
+						continue
+					}
+					select {
+					case ch <- *log:
+					case <-quit:
+						return nil
+					}
+				}
+				if number >= last {
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// head returns the latest block of the group.
+func (g *simGroup) head() *simBlock {
+	return g.blocks[len(g.blocks)-1]
+}
+
+// blockHash returns the hash identifying block, derived from its contents and
+// its parent.
+func (g *simGroup) blockHash(parent common.Hash, block *simBlock) common.Hash {
+	var txHash common.Hash
+	if block.tx != nil {
+		txHash = block.tx.Hash()
+	}
+	enc, _ := rlp.EncodeToBytes([]interface{}{g.id, parent, block.number, block.time, block.root, txHash})
+	return crypto.Keccak256Hash(enc)
+}
+
+// stateAt opens the state after the given block, the latest one if number is nil.
+func (g *simGroup) stateAt(number *big.Int) (*state.StateDB, error) {
+	block := g.head()
+	if number != nil {
+		if !number.IsUint64() || number.Uint64() >= uint64(len(g.blocks)) {
+			return nil, nodeError(-40004, ethclient.ErrBlockNumberNotExist)
+		}
+		block = g.blocks[number.Uint64()]
+	}
+	return state.New(block.root, g.db)
+}
+
+// blockRange resolves the block range of a filter query, nil bounds meaning the
+// latest block, or def for from, and block tags the latest block.
+func (g *simGroup) blockRange(from, to *big.Int, def uint64) (uint64, uint64) {
+	head := g.head().number
+	start, end := def, head
+	if from != nil {
+		start = blockOrHead(from, head)
+	}
+	if to != nil && blockOrHead(to, head) < head {
+		end = to.Uint64()
+	}
+	return start, end
+}
+
+// blockOrHead returns the block number n, or head for the negative block tags
+// such as rpc.LatestBlockNumber.
+func blockOrHead(n *big.Int, head uint64) uint64 {
+	if n.Sign() < 0 {
+		return head
+	}
+	return n.Uint64()
+}
+
+// execute runs a message in the block following parent, returning the output,
+// the address of the deployed contract and the gas used. The error of a failed
+// execution tells its status, see statusOf.
+func (g *simGroup) execute(statedb *state.StateDB, parent *simBlock, from common.Address, to *common.Address, data []byte, gas uint64, value *big.Int) ([]byte, common.Address, uint64, error) {
+	if gas == 0 || gas > simulatedGasLimit {
+		gas = simulatedGasLimit
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	intrinsic := vm.IntrinsicGas(data, to == nil)
+	if gas < intrinsic {
+		return nil, common.Address{}, gas, errIntrinsicGas
+	}
+	evm := vm.NewEVM(vm.Context{
+		Origin:      from,
+		GasLimit:    simulatedGasLimit,
+		BlockNumber: new(big.Int).SetUint64(parent.number + 1),
+		Time:        new(big.Int).SetUint64(parent.time + blockInterval),
+		GetHash: func(n uint64) common.Hash {
+			if n < uint64(len(g.blocks)) {
+				return g.blocks[n].hash
+			}
+			return common.Hash{}
+		},
+	}, statedb)
+
+	var (
+		output   []byte
+		contract common.Address
+		left     uint64
+		err      error
+	)
+	if to == nil {
+		output, contract, left, err = evm.Create(from, data, gas-intrinsic, value)
+	} else {
+		output, left, err = evm.Call(from, *to, data, gas-intrinsic, value)
+	}
+	used := gas - left
+	refund := statedb.GetRefund()
+	if refund > used/2 {
+		refund = used / 2
+	}
+	return output, contract, used - refund, err
+}
+
+// statusOf returns the receipt status of an execution ending with err.
+func statusOf(err error) int {
+	switch err {
+	case nil:
+		return types.StatusSuccess
+	case vm.ErrExecutionReverted:
+		return types.StatusRevertInstruction
+	case vm.ErrOutOfGas, vm.ErrCodeStoreOutOfGas:
+		return types.StatusOutOfGas
+	case vm.ErrInvalidJump:
+		return types.StatusBadJumpDestination
+	case vm.ErrStackUnderflow:
+		return types.StatusStackUnderflow
+	case vm.ErrStackOverflow, vm.ErrDepth:
+		return types.StatusOutOfStack
+	case vm.ErrInsufficientBalance:
+		return types.StatusNotEnoughCash
+	case vm.ErrContractAddressCollision:
+		return types.StatusAddressAlreadyUsed
+	case vm.ErrGasUintOverflow:
+		return types.StatusGasOverflow
+	case vm.ErrSystemContract:
+		return types.StatusPrecompiledError
+	case errIntrinsicGas:
+		return types.StatusOutOfGasIntrinsic
+	}
+	if _, ok := err.(*vm.ErrInvalidOpCode); ok {
+		return types.StatusBadInstruction
+	}
+	return types.StatusUnknown
+}
+
+// filterLogs returns the logs of block matching the addresses and topics of q.
+func filterLogs(block *simBlock, q fiscobcos.FilterQuery) []types.Log {
+	var logs []types.Log
+	if block.receipt == nil {
+		return logs
+	}
+	for _, log := range block.receipt.Logs {
+		if logMatches(log, q) {
+			logs = append(logs, *log)
+		}
+	}
+	return logs
+}
+
+// logMatches reports whether log matches the addresses and topics of q.
+func logMatches(log *types.Log, q fiscobcos.FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		var found bool
+		for _, addr := range q.Addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range q.Topics {
+		match := len(sub) == 0
+		for _, topic := range sub {
+			if log.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind/backends"
+	"github.com/chislab/go-fiscobcos/core/vm"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/ethclient"
+)
+
+const storeABI = `[
+	{"constant":false,"inputs":[{"name":"v","type":"uint256"}],"name":"set","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"constant":true,"inputs":[],"name":"get","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":false,"name":"v","type":"uint256"}],"name":"Set","type":"event"}
+]`
+
+// storeCode returns the deployment code of a contract implementing storeABI: set
+// stores its argument in slot 0 and logs it with the Set event, get returns it.
+func storeCode(parsed abi.ABI) []byte {
+	var code []byte
+	// Dispatch on the selector, the first 4 bytes of the input.
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 0xe0, byte(vm.SHR))
+	code = append(code, byte(vm.DUP1), byte(vm.PUSH4))
+	code = append(code, parsed.Methods["get"].Id()...)
+	code = append(code, byte(vm.EQ), byte(vm.PUSH1), 0)
+	getJump := len(code) - 1
+	code = append(code, byte(vm.JUMPI), byte(vm.PUSH4))
+	code = append(code, parsed.Methods["set"].Id()...)
+	code = append(code, byte(vm.EQ), byte(vm.PUSH1), 0)
+	setJump := len(code) - 1
+	code = append(code, byte(vm.JUMPI), byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.REVERT))
+	// get
+	code[getJump] = byte(len(code))
+	code = append(code, byte(vm.JUMPDEST))
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 0, byte(vm.MSTORE))
+	code = append(code, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN))
+	// set
+	code[setJump] = byte(len(code))
+	code = append(code, byte(vm.JUMPDEST))
+	code = append(code, byte(vm.PUSH1), 4, byte(vm.CALLDATALOAD), byte(vm.DUP1), byte(vm.PUSH1), 0, byte(vm.SSTORE))
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH32))
+	code = append(code, parsed.Events["Set"].Id().Bytes()...)
+	code = append(code, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.LOG1), byte(vm.STOP))
+
+	// The constructor returns the code above.
+	deploy := []byte{byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 12, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 0, byte(vm.RETURN)}
+	return append(deploy, code...)
+}
+
+// deployStore deploys the store contract to the given group of backend.
+func deployStore(t *testing.T, backend *backends.SimulatedBackend, opts *bind.TransactOpts, groupId int) *bind.BoundContract {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(storeABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.GroupId = groupId
+	_, _, contract, err := bind.DeployContract(opts, parsed, storeCode(parsed), backend)
+	if err != nil {
+		t.Fatalf("can't deploy the contract: %v", err)
+	}
+	return contract
+}
+
+func newTransactor(t *testing.T) *bind.TransactOpts {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := bind.NewKeyedTransactor(key)
+	opts.GasLimit = 3000000
+	return opts
+}
+
+// stored returns the value of the store contract.
+func stored(t *testing.T, contract *bind.BoundContract, groupId int) *big.Int {
+	t.Helper()
+	var value *big.Int
+	if err := contract.Call(&bind.CallOpts{GroupId: groupId}, &value, "get"); err != nil {
+		t.Fatalf("get error: %v", err)
+	}
+	return value
+}
+
+func TestSimulatedBindingsRoundTrip(t *testing.T) {
+	backend := backends.NewSimulatedBackend()
+	defer backend.Close()
+	opts := newTransactor(t)
+	contract := deployStore(t, backend, opts, 0)
+
+	if value := stored(t, contract, 0); value.Sign() != 0 {
+		t.Fatalf("new contract holds %v, want 0", value)
+	}
+	_, receipt, err := contract.TransactAndCall(opts, "set", big.NewInt(42))
+	if err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if !receipt.Succeeded() {
+		t.Fatalf("set failed: %s", receipt.StatusMessage())
+	}
+	if value := stored(t, contract, 0); value.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("contract holds %v after set, want 42", value)
+	}
+
+	events, err := contract.ParseReceiptEvents(receipt)
+	if err != nil {
+		t.Fatalf("can't parse the receipt events: %v", err)
+	}
+	if len(events) != 1 || events[0].Name != "Set" {
+		t.Fatalf("got events %+v, want one Set", events)
+	}
+	var event struct{ V *big.Int }
+	if err := contract.UnpackLog(&event, "Set", *receipt.Logs[0]); err != nil {
+		t.Fatalf("can't unpack the Set event: %v", err)
+	}
+	if event.V.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("Set event carries %v, want 42", event.V)
+	}
+	if receipt.Logs[0].BlockNumber != receipt.BlockNumber || receipt.Logs[0].TxHash != receipt.TxHash {
+		t.Errorf("log not placed in its transaction: %+v", receipt.Logs[0])
+	}
+}
+
+func TestSimulatedSnapshotRollback(t *testing.T) {
+	backend := backends.NewSimulatedBackend(1, 2)
+	defer backend.Close()
+	ctx := context.Background()
+	opts := newTransactor(t)
+	contracts := map[int]*bind.BoundContract{1: deployStore(t, backend, opts, 1), 2: deployStore(t, backend, opts, 2)}
+
+	set := func(groupId int, v int64) {
+		opts.GroupId = groupId
+		if _, err := contracts[groupId].Transact(opts, "set", big.NewInt(v)); err != nil {
+			t.Fatalf("set error: %v", err)
+		}
+	}
+	set(1, 1)
+	set(2, 10)
+	heads := make(map[uint64]*big.Int)
+	for _, groupId := range []uint64{1, 2} {
+		heads[groupId], _ = backend.BlockNumber(ctx, groupId)
+	}
+
+	id := backend.Snapshot()
+	set(1, 2)
+	opts.GroupId = 2
+	tx, err := contracts[2].Transact(opts, "set", big.NewInt(20))
+	if err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if stored(t, contracts[1], 1).Int64() != 2 || stored(t, contracts[2], 2).Int64() != 20 {
+		t.Fatal("groups don't hold the values set after the snapshot")
+	}
+
+	if err := backend.Rollback(id); err != nil {
+		t.Fatalf("Rollback error: %v", err)
+	}
+	if v := stored(t, contracts[1], 1); v.Int64() != 1 {
+		t.Errorf("group 1 holds %v after the rollback, want 1", v)
+	}
+	if v := stored(t, contracts[2], 2); v.Int64() != 10 {
+		t.Errorf("group 2 holds %v after the rollback, want 10", v)
+	}
+	for groupId, want := range heads {
+		if head, _ := backend.BlockNumber(ctx, groupId); head.Cmp(want) != 0 {
+			t.Errorf("group %d at block %v after the rollback, want %v", groupId, head, want)
+		}
+	}
+	if _, err := backend.TransactionReceipt(ctx, 2, tx.Hash()); err != fiscobcos.NotFound {
+		t.Errorf("receipt of a rolled back transaction: got error %v, want NotFound", err)
+	}
+	if err := backend.Rollback(id); err == nil {
+		t.Error("rolled back to a dropped snapshot")
+	}
+
+	// The rolled back transaction can be sent again.
+	if err := backend.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("can't resend the rolled back transaction: %v", err)
+	}
+	if v := stored(t, contracts[2], 2); v.Int64() != 20 {
+		t.Errorf("group 2 holds %v after the resent transaction, want 20", v)
+	}
+}
+
+func TestSimulatedFilterLogsBlockTags(t *testing.T) {
+	backend := backends.NewSimulatedBackend()
+	defer backend.Close()
+	opts := newTransactor(t)
+	contract := deployStore(t, backend, opts, 0)
+	for _, v := range []int64{1, 2} {
+		if _, err := contract.Transact(opts, "set", big.NewInt(v)); err != nil {
+			t.Fatalf("set error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		from, to *big.Int
+		want     int
+	}{
+		{from: big.NewInt(0), want: 2},
+		{from: big.NewInt(ethclient.LatestBlock), want: 1},
+		{from: big.NewInt(0), to: big.NewInt(ethclient.PendingBlock), want: 2},
+		{from: big.NewInt(ethclient.LatestBlock), to: big.NewInt(ethclient.LatestBlock), want: 1},
+	}
+	for _, test := range tests {
+		logs, err := backend.FilterLogs(context.Background(), fiscobcos.FilterQuery{FromBlock: test.from, ToBlock: test.to})
+		if err != nil {
+			t.Fatalf("FilterLogs(%v, %v) error: %v", test.from, test.to, err)
+		}
+		if len(logs) != test.want {
+			t.Errorf("FilterLogs(%v, %v): got %d logs, want %d", test.from, test.to, len(logs), test.want)
+		}
+	}
+}
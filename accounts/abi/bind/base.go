@@ -18,19 +18,15 @@ package bind
 
 import (
 	"context"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"github.com/chislab/go-fiscobcos"
 	"github.com/chislab/go-fiscobcos/accounts/abi"
 	"github.com/chislab/go-fiscobcos/common"
-	"github.com/chislab/go-fiscobcos/common/hexutil"
 	"github.com/chislab/go-fiscobcos/core/types"
-	"github.com/chislab/go-fiscobcos/crypto"
 	"github.com/chislab/go-fiscobcos/event"
-	"github.com/chislab/go-fiscobcos/rlp"
-	"github.com/pborman/uuid"
 	"math/big"
+	"strings"
 )
 
 // SignerFn is a signer function callback when a contract requires a method to
@@ -43,23 +39,27 @@ type CallOpts struct {
 	From        common.Address  // Optional the sender address, otherwise the first account is used
 	BlockNumber *big.Int        // Optional the block number on which the call should be performed
 	Context     context.Context // Network context to support cancellation and timeouts (nil = no timeout)
-	GroupId     int
+	GroupId     int             // Group to call the contract in (0 = client default)
 }
 
 // TransactOpts is the collection of authorization data required to create a
 // valid FiscoBcos transaction.
 type TransactOpts struct {
 	From       common.Address // FiscoBcos account to send the transaction from
-	RandomId   *big.Int       // RandomId to use for the transaction execution (nil = use pending state)
-	BlockLimit *big.Int       // RandomId to use for the transaction execution (nil = use pending state)
+	RandomId   *big.Int       // RandomId to use for the transaction execution (nil = random)
+	BlockLimit *big.Int       // Block number after which the transaction is rejected (nil = from the backend)
 	Signer     SignerFn       // Method to use for signing the transaction (mandatory)
 
 	Value    *big.Int // Funds to transfer along along the transaction (nil = 0 = no funds)
 	GasPrice *big.Int // Gas price to use for the transaction execution (nil = gas price oracle)
 	GasLimit uint64   // Gas limit to set for the transaction execution (0 = estimate)
 
+	ChainId   *big.Int        // Chain the transaction is valid on (nil = from the backend)
+	ExtraData []byte          // Application data attached to the transaction (nil = none)
+	ChainMode types.ChainMode // Cryptography of the chain, unless the backend detects it
+
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
-	GroupId int
+	GroupId int             // Group to send the transaction to (0 = from the context or the backend)
 }
 
 // FilterOpts is the collection of options to fine tune filtering for events
@@ -69,6 +69,7 @@ type FilterOpts struct {
 	End   *uint64 // End of the range (nil = latest)
 
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
+	GroupId int             // Group to filter the logs in (0 = client default)
 }
 
 // WatchOpts is the collection of options to fine tune subscribing for events
@@ -76,6 +77,7 @@ type FilterOpts struct {
 type WatchOpts struct {
 	Start   *uint64         // Start of the queried range (nil = latest)
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
+	GroupId int             // Group to watch the logs in (0 = client default)
 }
 
 // BoundContract is the base wrapper object that reflects a contract on the
@@ -87,6 +89,8 @@ type BoundContract struct {
 	caller     ContractCaller     // Read interface to interact with the blockchain
 	transactor ContractTransactor // Write interface to interact with the blockchain
 	filterer   ContractFilterer   // Event filtering to interact with the blockchain
+
+	name *nameBinding // CNS name the address is resolved from, nil if bound by address
 }
 
 // NewBoundContract creates a low level contract interface through which calls
@@ -97,37 +101,78 @@ func NewBoundContract(address common.Address, abi abi.ABI, caller ContractCaller
 		abi:        abi,
 		caller:     caller,
 		transactor: transactor,
+		filterer:   filterer,
 	}
 }
 
 // DeployContract deploys a contract onto the FiscoBcos blockchain and binds the
-// deployment address with a Go wrapper.
+// deployment address with a Go wrapper. It waits for the deployment to be mined
+// and takes the contract address from its receipt.
 func DeployContract(opts *TransactOpts, abi abi.ABI, bytecode []byte, backend ContractBackend, params ...interface{}) (common.Address, *types.Transaction, *BoundContract, error) {
-	// Otherwise try to deploy the contract
-	c := NewBoundContract(common.Address{}, abi, backend, backend, nil)
+	tx, receipt, c, err := deploy(opts, abi, bytecode, backend, params...)
+	if err != nil {
+		return common.Address{}, tx, nil, err
+	}
+	return *receipt.ContractAddress, tx, c, nil
+}
 
-	input, err := abi.Pack("", params...)
+// DeployContractRaw deploys a contract given its ABI in JSON and its bytecode,
+// encoding params as the arguments of its constructor. It waits for the
+// deployment to be mined and returns the receipt along with the contract
+// address taken from it. Bytecode referencing libraries must be linked first,
+// see LinkBytecode.
+//
+// The receipt is also returned if the deployment failed, with the error telling
+// why.
+func DeployContractRaw(opts *TransactOpts, abiJSON string, bytecode []byte, backend ContractBackend, params ...interface{}) (common.Address, *types.Transaction, *types.Receipt, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
 	if err != nil {
 		return common.Address{}, nil, nil, err
 	}
-	opts.RandomId = nil
-	for opts.RandomId == nil {
-		b, _ := rlp.EncodeToBytes(uuid.NewUUID())
-		nonce, _ := hexutil.DecodeBig(fmt.Sprintf("0x%x", md5.Sum(b[:10])))
-		opts.RandomId = nonce
-	}
-	payLoad := append(bytecode, input...)
-	rawTx := types.NewContractCreation(opts.RandomId.Uint64(), opts.BlockLimit.Uint64(), opts.Value,
-		opts.GasLimit, opts.GasPrice, payLoad, big.NewInt(1), big.NewInt(int64(opts.GroupId)), nil)
-	signedTx, err := opts.Signer(types.HomesteadSigner{}, opts.From, rawTx)
-	backend.SendTransaction(ensureContext(opts.Context), signedTx)
-	return crypto.CreateAddress(opts.From, signedTx.RandomId()), signedTx, c, nil
+	tx, receipt, _, err := deploy(opts, parsed, bytecode, backend, params...)
+	if err != nil {
+		return common.Address{}, tx, receipt, err
+	}
+	return *receipt.ContractAddress, tx, receipt, nil
+}
+
+// deploy sends the deployment of a contract and waits for its receipt. The
+// contract is bound once the receipt shows it succeeded.
+func deploy(opts *TransactOpts, abi abi.ABI, bytecode []byte, backend ContractBackend, params ...interface{}) (*types.Transaction, *types.Receipt, *BoundContract, error) {
+	if len(bytecode) == 0 {
+		return nil, nil, nil, errors.New("no contract bytecode to deploy")
+	}
+	c := NewBoundContract(common.Address{}, abi, backend, backend, backend)
+
+	input, err := abi.Pack("", params...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tx, err := c.transact(opts, nil, append(bytecode[:len(bytecode):len(bytecode)], input...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	receipt, err := WaitMined(ensureContext(opts.Context), tx.GroupId().Uint64(), backend, tx)
+	if err != nil {
+		return tx, nil, nil, err
+	}
+	if !receipt.Succeeded() {
+		if reason, err := receipt.RevertReason(); err == nil {
+			return tx, receipt, nil, fmt.Errorf("contract deployment failed: %s: %s", receipt.StatusMessage(), reason)
+		}
+		return tx, receipt, nil, fmt.Errorf("contract deployment failed: %s", receipt.StatusMessage())
+	}
+	if receipt.ContractAddress == nil {
+		return tx, receipt, nil, errors.New("contract deployment receipt lacks the contract address")
+	}
+	c.address = *receipt.ContractAddress
+	return tx, receipt, c, nil
 }
 
 // Call invokes the (constant) contract method with params as input values and
 // sets the output to result. The result type might be a single field for simple
 // returns, a slice of interfaces for anonymous returns and a struct for named
-// returns.
+// returns. A revert with a custom error of the ABI is reported as *ContractError.
 func (c *BoundContract) Call(opts *CallOpts, result interface{}, method string, params ...interface{}) error {
 	// Don't crash on a lazy user
 	if opts == nil {
@@ -138,9 +183,13 @@ func (c *BoundContract) Call(opts *CallOpts, result interface{}, method string,
 	if err != nil {
 		return err
 	}
+	ctx := ensureContext(opts.Context)
+	address, err := c.addressIn(ctx, opts.GroupId)
+	if err != nil {
+		return err
+	}
 	var (
-		msg    = fiscobcos.CallMsg{GroupId: opts.GroupId, Msg: fiscobcos.CallEthMsg{From: opts.From, To: &c.address, Data: input}}
-		ctx    = ensureContext(opts.Context)
+		msg    = fiscobcos.CallMsg{GroupId: opts.GroupId, Msg: fiscobcos.CallEthMsg{From: opts.From, To: &address, Data: input}}
 		code   []byte
 		output []byte
 	)
@@ -152,7 +201,7 @@ func (c *BoundContract) Call(opts *CallOpts, result interface{}, method string,
 		output, err = pb.PendingCallContract(ctx, msg)
 		if err == nil && len(output) == 0 {
 			// Make sure we have a contract to operate on, and bail out otherwise.
-			if code, err = pb.PendingCodeAt(ctx, c.address); err != nil {
+			if code, err = pb.PendingCodeAt(ctx, address); err != nil {
 				return err
 			} else if len(code) == 0 {
 				return ErrNoCode
@@ -162,7 +211,7 @@ func (c *BoundContract) Call(opts *CallOpts, result interface{}, method string,
 		output, err = c.caller.CallContract(ctx, msg, opts.BlockNumber)
 		if err == nil && len(output) == 0 {
 			// Make sure we have a contract to operate on, and bail out otherwise.
-			if code, err = c.caller.CodeAt(ctx, opts.GroupId, c.address, opts.BlockNumber); err != nil {
+			if code, err = c.caller.CodeAt(ctx, uint64(opts.GroupId), address, opts.BlockNumber); err != nil {
 				return err
 			} else if len(code) == 0 {
 				return ErrNoCode
@@ -170,7 +219,7 @@ func (c *BoundContract) Call(opts *CallOpts, result interface{}, method string,
 		}
 	}
 	if err != nil {
-		return err
+		return c.contractError(err)
 	}
 	return c.abi.Unpack(result, method, output)
 }
@@ -182,13 +231,55 @@ func (c *BoundContract) Transact(opts *TransactOpts, method string, params ...in
 	if err != nil {
 		return nil, err
 	}
-	return c.transact(opts, &c.address, input)
+	address, err := c.addressIn(opts.Context, opts.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	return c.transact(opts, &address, input)
+}
+
+// TransactAndCall invokes the (paid) contract method like Transact, waits for the
+// transaction to be mined and unpacks the values the method returned from the
+// output of the receipt. Methods without outputs return an empty slice.
+//
+// If the transaction failed the receipt is returned along with a
+// *TransactionError, or a *ContractError if the contract reverted with a custom
+// error of its ABI.
+func (c *BoundContract) TransactAndCall(opts *TransactOpts, method string, params ...interface{}) ([]interface{}, *types.Receipt, error) {
+	backend, ok := c.transactor.(DeployBackend)
+	if !ok {
+		return nil, nil, ErrNoReceipts
+	}
+	tx, err := c.Transact(opts, method, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+	receipt, err := WaitMined(ensureContext(opts.Context), tx.GroupId().Uint64(), backend, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := receiptError(receipt); err != nil {
+		return nil, receipt, c.contractError(err)
+	}
+	outputs := c.abi.Methods[method].Outputs
+	if len(outputs) == 0 {
+		return []interface{}{}, receipt, nil
+	}
+	values, err := outputs.UnpackValues(receipt.Output)
+	if err != nil {
+		return nil, receipt, err
+	}
+	return values, receipt, nil
 }
 
 // Transfer initiates a plain transaction to move funds to the contract, calling
 // its default method if one is available.
 func (c *BoundContract) Transfer(opts *TransactOpts) (*types.Transaction, error) {
-	return c.transact(opts, &c.address, nil)
+	address, err := c.addressIn(opts.Context, opts.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	return c.transact(opts, &address, nil)
 }
 
 // transact executes an actual transaction invocation, first deriving any missing
@@ -201,29 +292,55 @@ func (c *BoundContract) transact(opts *TransactOpts, contract *common.Address, i
 	if value == nil {
 		value = new(big.Int)
 	}
-	if opts.BlockLimit == nil {
-		return nil, errors.New("Block limit shoud be preseted.")
+	chainId := opts.ChainId
+	if chainId == nil {
+		chainId = big.NewInt(1)
+		if reader, ok := c.transactor.(ChainIdReader); ok {
+			if chainId, err = reader.ChainId(ensureContext(opts.Context)); err != nil {
+				return nil, err
+			}
+		}
 	}
-	opts.RandomId = nil
-	for opts.RandomId == nil {
-		b, _ := rlp.EncodeToBytes(uuid.NewUUID())
-		nonce, _ := hexutil.DecodeBig(fmt.Sprintf("0x%x", md5.Sum(b[:10])))
-		opts.RandomId = nonce
+	groupId := groupOf(opts.Context, opts.GroupId, c.transactor)
+	blockLimit := opts.BlockLimit
+	if blockLimit == nil {
+		limiter, ok := c.transactor.(BlockLimiter)
+		if !ok {
+			return nil, ErrNoBlockLimit
+		}
+		if blockLimit, err = limiter.GetBlockLimit(ensureContext(opts.Context), groupId); err != nil {
+			return nil, err
+		}
 	}
 	// Figure out the gas allowance and gas price values
 	gasPrice := opts.GasPrice
 	gasLimit := opts.GasLimit
 	// Create the transaction, sign it and schedule it for execution
 	var rawTx *types.Transaction
-	rawTx = types.NewTransaction(opts.RandomId.Uint64(), opts.BlockLimit.Uint64(), c.address, value, gasLimit, gasPrice, input, big.NewInt(1), big.NewInt(1), nil)
+	if contract == nil {
+		rawTx = types.NewContractCreation(opts.RandomId, value, gasLimit, gasPrice, input, blockLimit, chainId, new(big.Int).SetUint64(groupId), opts.ExtraData)
+	} else {
+		rawTx = types.NewTransaction(opts.RandomId, *contract, value, gasLimit, gasPrice, input, blockLimit, chainId, new(big.Int).SetUint64(groupId), opts.ExtraData)
+	}
 	if opts.Signer == nil {
 		return nil, errors.New("no signer to authorize the transaction with")
 	}
-	signedTx, err := opts.Signer(types.HomesteadSigner{}, opts.From, rawTx)
+	mode := opts.ChainMode
+	if detector, ok := c.transactor.(ChainModeDetector); ok {
+		isGM, err := detector.IsGM(ensureContext(opts.Context))
+		if err != nil {
+			return nil, err
+		}
+		mode = types.ChainModeStandard
+		if isGM {
+			mode = types.ChainModeGM
+		}
+	}
+	signedTx, err := opts.Signer(types.NewChainSigner(mode), opts.From, rawTx)
 	if err != nil {
 		return nil, err
 	}
-	if err := c.transactor.SendTransaction(ensureContext(opts.Context), signedTx); err != nil {
+	if err := c.transactor.SendTransaction(fiscobcos.ContextWithGroup(ensureContext(opts.Context), groupId), signedTx); err != nil {
 		return nil, err
 	}
 	return signedTx, nil
@@ -243,50 +360,69 @@ func (c *BoundContract) WatchLogs(opts *WatchOpts, name string, query ...[]inter
 	if err != nil {
 		return nil, nil, err
 	}
+	address, err := c.addressIn(opts.Context, opts.GroupId)
+	if err != nil {
+		return nil, nil, err
+	}
 	// Start the background filtering
 	logs := make(chan types.Log, 128)
 
 	config := fiscobcos.FilterQuery{
-		Addresses: []common.Address{c.address},
+		GroupId:   uint64(opts.GroupId),
+		Addresses: []common.Address{address},
 		Topics:    topics,
 	}
 	if opts.Start != nil {
 		config.FromBlock = new(big.Int).SetUint64(*opts.Start)
 	}
-
-	return logs, nil, nil
+	sub, err := c.filterer.SubscribeFilterLogs(groupContext(opts.Context, opts.GroupId), config, logs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logs, sub, nil
 }
 
 // UnpackLog unpacks a retrieved log into the provided output structure.
 func (c *BoundContract) UnpackLog(out interface{}, event string, log types.Log) error {
-	if len(log.Data) > 0 {
-		if err := c.abi.Unpack(out, event, log.Data); err != nil {
-			return err
-		}
-	}
-	var indexed abi.Arguments
-	for _, arg := range c.abi.Events[event].Inputs {
-		if arg.Indexed {
-			indexed = append(indexed, arg)
-		}
-	}
-	return parseTopics(out, indexed, log.Topics[1:])
+	return UnpackLog(c.abi, out, event, log)
 }
 
 // UnpackLogIntoMap unpacks a retrieved log into the provided map.
 func (c *BoundContract) UnpackLogIntoMap(out map[string]interface{}, event string, log types.Log) error {
-	if len(log.Data) > 0 {
-		if err := c.abi.UnpackIntoMap(out, event, log.Data); err != nil {
-			return err
-		}
+	return UnpackLogIntoMap(c.abi, out, event, log)
+}
+
+// ParseReceiptEvents decodes the logs of a receipt emitted by events of the
+// contract's ABI.
+func (c *BoundContract) ParseReceiptEvents(receipt *types.Receipt) ([]DecodedEvent, error) {
+	return ParseReceiptEvents(c.abi, receipt)
+}
+
+// groupOf resolves the group a transaction is sent to as the clients do: the
+// explicit groupId, then the group carried by ctx, then the default group of the
+// backend, see GroupDefaulter. Backends without default send to group 1.
+func groupOf(ctx context.Context, groupId int, backend interface{}) uint64 {
+	if groupId != 0 {
+		return uint64(groupId)
+	}
+	if groupId, ok := fiscobcos.GroupFromContext(ensureContext(ctx)); ok {
+		return groupId
 	}
-	var indexed abi.Arguments
-	for _, arg := range c.abi.Events[event].Inputs {
-		if arg.Indexed {
-			indexed = append(indexed, arg)
+	if defaulter, ok := backend.(GroupDefaulter); ok {
+		if groupId := defaulter.DefaultGroup(); groupId != 0 {
+			return groupId
 		}
 	}
-	return parseTopicsIntoMap(out, indexed, log.Topics[1:])
+	return 1
+}
+
+// groupContext ensures a non-nil context, carrying the group if one is set.
+func groupContext(ctx context.Context, groupId int) context.Context {
+	ctx = ensureContext(ctx)
+	if groupId != 0 {
+		ctx = fiscobcos.ContextWithGroup(ctx, uint64(groupId))
+	}
+	return ctx
 }
 
 // ensureContext is a helper method to ensure a context is not nil, even if the
@@ -310,11 +446,16 @@ func (c *BoundContract) FilterLogs(opts *FilterOpts, name string, query ...[]int
 	if err != nil {
 		return nil, nil, err
 	}
+	address, err := c.addressIn(opts.Context, opts.GroupId)
+	if err != nil {
+		return nil, nil, err
+	}
 	// Start the background filtering
 	logs := make(chan types.Log, 128)
 
 	config := fiscobcos.FilterQuery{
-		Addresses: []common.Address{c.address},
+		GroupId:   uint64(opts.GroupId),
+		Addresses: []common.Address{address},
 		Topics:    topics,
 		FromBlock: new(big.Int).SetUint64(opts.Start),
 	}
@@ -324,7 +465,7 @@ func (c *BoundContract) FilterLogs(opts *FilterOpts, name string, query ...[]int
 	/* TODO(karalabe): Replace the rest of the method below with this when supported
 	sub, err := c.filterer.SubscribeFilterLogs(ensureContext(opts.Context), config, logs)
 	*/
-	buff, err := c.filterer.FilterLogs(ensureContext(opts.Context), config)
+	buff, err := c.filterer.FilterLogs(groupContext(opts.Context, opts.GroupId), config)
 	if err != nil {
 		return nil, nil, err
 	}
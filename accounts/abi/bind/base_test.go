@@ -0,0 +1,401 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+const setterABI = `[{"constant":false,"inputs":[{"name":"v","type":"uint256"}],"name":"set","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"}]`
+
+// sentTransaction returns the group the transaction was sent to and the
+// transaction itself.
+func sentTransaction(t *testing.T, call ethclienttest.Call) (uint64, *types.Transaction) {
+	t.Helper()
+	var (
+		groupId uint64
+		raw     string
+	)
+	if err := json.Unmarshal(call.Params[0], &groupId); err != nil {
+		t.Fatalf("transaction sent with group %s: %v", call.Params[0], err)
+	}
+	if err := json.Unmarshal(call.Params[1], &raw); err != nil {
+		t.Fatalf("transaction sent as %s: %v", call.Params[1], err)
+	}
+	tx, err := types.DecodeRawTx(raw)
+	if err != nil {
+		t.Fatalf("can't decode the transaction sent: %v", err)
+	}
+	return groupId, tx
+}
+
+func TestTransactGroupAndChainId(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getClientVersion", &types.ClientVersion{Version: "2.7.0", ChainId: "7"})
+	node.Respond("getBlockNumber", "0x10")
+	node.Respond("sendRawTransaction", common.Hash{}.Hex())
+
+	parsed, err := abi.JSON(strings.NewReader(setterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.GenerateKey()
+
+	tests := []struct {
+		explicit   int    // TransactOpts.GroupId
+		context    uint64 // group carried by TransactOpts.Context, 0 for none
+		defaultGrp uint64 // default group of the client, 0 to keep the initial one
+		chainId    *big.Int
+		wantGroup  uint64
+		wantChain  int64
+	}{
+		{wantGroup: 1, wantChain: 7},
+		{defaultGrp: 5, wantGroup: 5, wantChain: 7},
+		{context: 2, defaultGrp: 5, wantGroup: 2, wantChain: 7},
+		{explicit: 3, context: 2, defaultGrp: 5, wantGroup: 3, wantChain: 7},
+		{chainId: big.NewInt(9), wantGroup: 1, wantChain: 9},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			client := node.Client()
+			client.SetDefaultGroup(test.defaultGrp)
+			contract := bind.NewBoundContract(common.Address{1}, parsed, client, client, client)
+			opts := bind.NewKeyedTransactor(key)
+			opts.GroupId = test.explicit
+			opts.ChainId = test.chainId
+			opts.GasLimit = 30000000
+			opts.Context = context.Background()
+			if test.context != 0 {
+				opts.Context = fiscobcos.ContextWithGroup(opts.Context, test.context)
+			}
+			node.Reset()
+
+			tx, err := contract.Transact(opts, "set", big.NewInt(1))
+			if err != nil {
+				t.Fatalf("Transact error: %v", err)
+			}
+			calls := node.CallsTo("sendRawTransaction")
+			if len(calls) != 1 {
+				t.Fatalf("sent %d transactions, want 1", len(calls))
+			}
+			groupId, sent := sentTransaction(t, calls[0])
+			if groupId != test.wantGroup {
+				t.Errorf("sent to group %d, want %d", groupId, test.wantGroup)
+			}
+			if sent.GroupId().Uint64() != test.wantGroup || tx.GroupId().Uint64() != test.wantGroup {
+				t.Errorf("signed for group %v, want %d", sent.GroupId(), test.wantGroup)
+			}
+			if sent.ChainId().Int64() != test.wantChain {
+				t.Errorf("signed for chain %v, want %d", sent.ChainId(), test.wantChain)
+			}
+			if calls := node.CallsTo("getBlockNumber"); len(calls) > 0 {
+				var groupId uint64
+				json.Unmarshal(calls[0].Params[0], &groupId)
+				if groupId != test.wantGroup {
+					t.Errorf("block limit read from group %d, want %d", groupId, test.wantGroup)
+				}
+			}
+		})
+	}
+}
+
+// TestTransactRandomId checks that transactions get a fresh random id unless
+// TransactOpts sets one.
+func TestTransactRandomId(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getClientVersion", &types.ClientVersion{Version: "2.7.0", ChainId: "1"})
+	node.Respond("getBlockNumber", "0x10")
+	node.Respond("sendRawTransaction", common.Hash{}.Hex())
+
+	parsed, err := abi.JSON(strings.NewReader(setterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.GenerateKey()
+	client := node.Client()
+	contract := bind.NewBoundContract(common.Address{1}, parsed, client, client, client)
+	opts := bind.NewKeyedTransactor(key)
+	opts.GasLimit = 30000000
+
+	tests := []struct {
+		randomId *big.Int
+		want     *big.Int // nil for a random one
+	}{
+		{randomId: nil},
+		{randomId: nil},
+		{randomId: big.NewInt(42), want: big.NewInt(42)},
+		{randomId: nil},
+	}
+	seen := make(map[string]bool)
+	for i, test := range tests {
+		opts.RandomId = test.randomId
+		if _, err := contract.Transact(opts, "set", big.NewInt(1)); err != nil {
+			t.Fatalf("transaction %d: Transact error: %v", i, err)
+		}
+		if opts.RandomId != test.randomId {
+			t.Errorf("transaction %d: TransactOpts.RandomId changed to %v", i, opts.RandomId)
+		}
+		calls := node.CallsTo("sendRawTransaction")
+		_, sent := sentTransaction(t, calls[len(calls)-1])
+		nonce := sent.RandomId()
+		if test.want != nil {
+			if nonce.Cmp(test.want) != 0 {
+				t.Errorf("transaction %d: random id %v, want %v", i, nonce, test.want)
+			}
+			continue
+		}
+		if seen[nonce.String()] || nonce.BitLen() < 128 {
+			t.Errorf("transaction %d: random id %x reused or not random", i, nonce)
+		}
+		seen[nonce.String()] = true
+	}
+}
+
+// TestTransactChainMode checks that transactions are signed for the chain mode
+// the client detects, whatever TransactOpts.ChainMode says.
+func TestTransactChainMode(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(setterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := crypto.GenerateKey()
+	gmKey, _ := gm.GenerateKey(rand.Reader)
+	tests := []struct {
+		version string
+		key     *ecdsa.PrivateKey
+		mode    types.ChainMode // TransactOpts.ChainMode
+		err     error
+	}{
+		{version: "2.7.0", key: key, mode: types.ChainModeStandard},
+		{version: "2.7.0", key: key, mode: types.ChainModeGM},
+		{version: "2.7.0 gm", key: gmKey, mode: types.ChainModeGM},
+		{version: "2.7.0 gm", key: gmKey, mode: types.ChainModeStandard},
+		{version: "2.7.0", key: gmKey, mode: types.ChainModeGM, err: types.ErrSignerKeyMismatch},
+		{version: "2.7.0 gm", key: key, mode: types.ChainModeStandard, err: types.ErrSignerKeyMismatch},
+	}
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		node.Respond("getClientVersion", &types.ClientVersion{Version: test.version, ChainId: "1"})
+		node.Respond("getBlockNumber", "0x10")
+		node.Respond("sendRawTransaction", common.Hash{}.Hex())
+		client := node.Client()
+		contract := bind.NewBoundContract(common.Address{1}, parsed, client, client, client)
+		opts := bind.NewKeyedTransactor(test.key)
+		opts.GasLimit = 30000000
+		opts.ChainMode = test.mode
+
+		_, err := contract.Transact(opts, "set", big.NewInt(1))
+		calls := node.CallsTo("sendRawTransaction")
+		node.Close()
+		if err != test.err {
+			t.Errorf("version %q, %v opts: got error %v, want %v", test.version, test.mode, err, test.err)
+			continue
+		}
+		if test.err != nil {
+			if len(calls) != 0 {
+				t.Errorf("version %q, %v opts: transaction sent despite error", test.version, test.mode)
+			}
+			continue
+		}
+		_, sent := sentTransaction(t, calls[0])
+		mode := types.ChainModeStandard
+		if strings.HasSuffix(test.version, "gm") {
+			mode = types.ChainModeGM
+		}
+		if from, err := types.Sender(types.NewChainSigner(mode), sent); err != nil || from != opts.From {
+			t.Errorf("version %q, %v opts: sender %x, %v, want %x", test.version, test.mode, from, err, opts.From)
+		}
+	}
+}
+
+const balanceABI = `[
+	{"inputs":[],"name":"balance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}
+]`
+
+func TestCallRevert(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	parsed, err := abi.JSON(strings.NewReader(balanceABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := node.Client()
+	contract := bind.NewBoundContract(common.Address{1}, parsed, client, client, client)
+	word := func(n int64) string { return common.Bytes2Hex(common.LeftPadBytes(big.NewInt(n).Bytes(), 32)) }
+	reverted := func(output string) map[string]string {
+		return map[string]string{"currentBlockNumber": "0x3", "output": output, "status": "0x16"}
+	}
+
+	// A custom error of the ABI is decoded with its arguments.
+	node.Respond("call", reverted("0xcf479181"+word(100)+word(250)))
+	var balance *big.Int
+	err = contract.Call(&bind.CallOpts{GroupId: 1}, &balance, "balance")
+	cerr, ok := err.(*bind.ContractError)
+	if !ok {
+		t.Fatalf("custom error: got %T %v, want *bind.ContractError", err, err)
+	}
+	if cerr.Name != "InsufficientBalance" || len(cerr.Args) != 2 || cerr.Args[0].(*big.Int).Int64() != 100 || cerr.Args[1].(*big.Int).Int64() != 250 {
+		t.Errorf("custom error: %v", cerr)
+	}
+	if _, ok := cerr.Err.(*ethclient.RevertError); !ok {
+		t.Errorf("custom error wraps %T, want *ethclient.RevertError", cerr.Err)
+	}
+
+	// A reason passed to require is reported by the backend's error.
+	node.Respond("call", reverted("0x08c379a0"+word(0x20)+word(20)+"696e73756666696369656e742062616c616e6365000000000000000000000000"))
+	err = contract.Call(&bind.CallOpts{GroupId: 1}, &balance, "balance")
+	rerr, ok := err.(*ethclient.RevertError)
+	if !ok || rerr.Reason != "insufficient balance" {
+		t.Errorf("revert reason: got %T %v", err, err)
+	}
+}
+
+const mintABI = `[
+	{"inputs":[{"name":"v","type":"uint256"}],"name":"mint","outputs":[{"name":"supply","type":"uint256"},{"name":"ok","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"v","type":"uint256"}],"name":"set","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}
+]`
+
+func TestTransactAndCall(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(mintABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	word := func(n int64) []byte { return common.LeftPadBytes(big.NewInt(n).Bytes(), 32) }
+	key, _ := crypto.GenerateKey()
+
+	tests := []struct {
+		name    string
+		method  string
+		receipt *types.Receipt
+		values  []interface{}
+		status  int    // of the *TransactionError, 0 if none is expected
+		reason  string // of the *TransactionError
+		custom  string // name of the *ContractError wrapping it
+		frozen  bool   // whether the error matches types.ErrContractFrozen
+	}{
+		{
+			name:    "outputs",
+			method:  "mint",
+			receipt: &types.Receipt{Status: "0x0", Output: append(word(1000), word(1)...)},
+			values:  []interface{}{big.NewInt(1000), true},
+		},
+		{
+			name:    "no outputs",
+			method:  "set",
+			receipt: &types.Receipt{Status: "0x0"},
+			values:  []interface{}{},
+		},
+		{
+			name:    "revert reason",
+			method:  "mint",
+			receipt: &types.Receipt{Status: "0x16", Output: common.FromHex(revertOutput("cap exceeded"))},
+			status:  types.StatusRevertInstruction,
+			reason:  "cap exceeded",
+		},
+		{
+			name:    "custom error",
+			method:  "mint",
+			receipt: &types.Receipt{Status: "0x16", Output: append(common.FromHex("0xcf479181"), append(word(5), word(9)...)...)},
+			status:  types.StatusRevertInstruction,
+			custom:  "InsufficientBalance",
+		},
+		{
+			name:    "frozen",
+			method:  "set",
+			receipt: &types.Receipt{Status: "0x1e"},
+			status:  types.StatusContractFrozen,
+			frozen:  true,
+		},
+	}
+	for _, test := range tests {
+		chain := &fakeChain{receipt: test.receipt}
+		contract := bind.NewBoundContract(common.Address{0xc0}, parsed, chain, chain, chain)
+		opts := bind.NewKeyedTransactor(key)
+		opts.GroupId, opts.BlockLimit = 2, big.NewInt(100)
+
+		values, receipt, err := contract.TransactAndCall(opts, test.method, big.NewInt(1))
+		if len(chain.sent) != 1 {
+			t.Errorf("%s: sent %d transactions", test.name, len(chain.sent))
+		}
+		if receipt != test.receipt {
+			t.Errorf("%s: got receipt %v, want the mined one", test.name, receipt)
+		}
+		if test.status == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			} else if fmt.Sprint(values) != fmt.Sprint(test.values) || len(values) != len(test.values) || values == nil {
+				t.Errorf("%s: got values %v, want %v", test.name, values, test.values)
+			}
+			continue
+		}
+		if values != nil {
+			t.Errorf("%s: got values %v along with the error", test.name, values)
+		}
+		if test.custom != "" {
+			cerr, ok := err.(*bind.ContractError)
+			if !ok || cerr.Name != test.custom {
+				t.Errorf("%s: got error %T %v, want *ContractError %s", test.name, err, err, test.custom)
+				continue
+			}
+			err = cerr.Err
+		}
+		terr, ok := err.(*bind.TransactionError)
+		if !ok {
+			t.Errorf("%s: got error %T %v, want *TransactionError", test.name, err, err)
+			continue
+		}
+		if terr.Status != test.status || terr.Reason != test.reason {
+			t.Errorf("%s: got status %#x, reason %q, want %#x, %q", test.name, terr.Status, terr.Reason, test.status, test.reason)
+		}
+		if serr, ok := terr.Unwrap().(*types.StatusError); !ok || serr.Is(types.ErrContractFrozen) != test.frozen {
+			t.Errorf("%s: unwraps to %v, matching ErrContractFrozen = %v", test.name, terr.Unwrap(), !test.frozen)
+		}
+	}
+
+	// A transactor which can't fetch receipts isn't sent the transaction.
+	chain := new(fakeChain)
+	contract := bind.NewBoundContract(common.Address{0xc0}, parsed, chain, struct{ bind.ContractTransactor }{chain}, chain)
+	opts := bind.NewKeyedTransactor(key)
+	opts.BlockLimit = big.NewInt(100)
+	if _, _, err := contract.TransactAndCall(opts, "set", big.NewInt(1)); err != bind.ErrNoReceipts {
+		t.Errorf("transactor without receipts: got error %v, want ErrNoReceipts", err)
+	}
+	if len(chain.sent) != 0 {
+		t.Errorf("transactor without receipts: sent %d transactions", len(chain.sent))
+	}
+}
@@ -135,11 +135,12 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 	buffer := new(bytes.Buffer)
 
 	funcs := map[string]interface{}{
-		"bindtype":      bindType[lang],
-		"bindtopictype": bindTopicType[lang],
-		"namedtype":     namedType[lang],
-		"capitalise":    capitalise,
-		"decapitalise":  decapitalise,
+		"bindtype":       bindType[lang],
+		"bindtopictype":  bindTopicType[lang],
+		"bindfiltertype": bindFilterType[lang],
+		"namedtype":      namedType[lang],
+		"capitalise":     capitalise,
+		"decapitalise":   decapitalise,
 	}
 	tmpl := template.Must(template.New("").Funcs(funcs).Parse(tmplSource[lang]))
 	if err := tmpl.Execute(buffer, data); err != nil {
@@ -199,12 +200,26 @@ func arrayBindingGo(inner string, arraySizes []string) string {
 // bindTypeGo converts a Solidity type to a Go one. Since there is no clear mapping
 // from all Solidity types to Go ones (e.g. uint17), those that cannot be exactly
 // mapped will use an upscaled type (e.g. *big.Int).
+//
+// Tuples, and arrays of them, are bound to the anonymous struct types the abi
+// package decodes them into.
 func bindTypeGo(kind abi.Type) string {
+	if hasTuple(kind) {
+		return kind.Type.String()
+	}
 	stringKind := kind.String()
 	innerLen, innerMapping := bindUnnestedTypeGo(stringKind)
 	return arrayBindingGo(wrapArray(stringKind, innerLen, innerMapping))
 }
 
+// hasTuple reports whether kind is a tuple or a (nested) array or slice of them.
+func hasTuple(kind abi.Type) bool {
+	for kind.T == abi.SliceTy || kind.T == abi.ArrayTy {
+		kind = *kind.Elem
+	}
+	return kind.T == abi.TupleTy
+}
+
 // The inner function of bindTypeGo, this finds the inner type of stringKind.
 // (Or just the type itself if it is not an array or slice)
 // The length of the matched part is returned, with the translated type.
@@ -319,12 +334,28 @@ var bindTopicType = map[Lang]func(kind abi.Type) string{
 // funcionality as for simple types, but dynamic types get converted to hashes.
 func bindTopicTypeGo(kind abi.Type) string {
 	bound := bindTypeGo(kind)
-	if bound == "string" || bound == "[]byte" {
+	if bound == "string" || bound == "[]byte" || kind.T == abi.TupleTy {
 		bound = "common.Hash"
 	}
 	return bound
 }
 
+// bindFilterType is a set of type binders that convert the Solidity types of
+// indexed event arguments to the types their filter rules are given in.
+var bindFilterType = map[Lang]func(kind abi.Type) string{
+	LangGo:   bindFilterTypeGo,
+	LangJava: bindTypeJava,
+}
+
+// bindFilterTypeGo converts an indexed Solidity type to a Go filter rule type. Only
+// the hash of a tuple makes it to the topics, so tuples are filtered on by hash.
+func bindFilterTypeGo(kind abi.Type) string {
+	if kind.T == abi.TupleTy {
+		return "common.Hash"
+	}
+	return bindTypeGo(kind)
+}
+
 // bindTypeGo converts a Solidity topic type to a Java one. It is almost the same
 // funcionality as for simple types, but dynamic types get converted to hashes.
 func bindTopicTypeJava(kind abi.Type) string {
@@ -0,0 +1,90 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the generated bindings")
+
+// tokenABI is the interface of an ERC20 token.
+const tokenABI = `[
+	{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"constant":false,"inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"constant":false,"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transferFrom","outputs":[{"name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"name","type":"string"},{"name":"supply","type":"uint256"}],"payable":false,"stateMutability":"nonpayable","type":"constructor"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"spender","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Approval","type":"event"}
+]`
+
+// tokenBin stands in for the bytecode of the token, only the generated Deploy
+// method depends on it.
+const tokenBin = "0x608060405234801561001057600080fd5b5060405161001d90610023565b50"
+
+// TestBindGolden checks the Go bindings generated for an ERC20 token against
+// testdata/token.go.golden and that they compile against this library. Run
+// with -update to rewrite the golden file after changing the template.
+func TestBindGolden(t *testing.T) {
+	code, err := bind.Bind([]string{"Token"}, []string{tokenABI}, []string{tokenBin}, "token", bind.LangGo)
+	if err != nil {
+		t.Fatalf("Bind error: %v", err)
+	}
+	golden := filepath.Join("testdata", "token.go.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != string(want) {
+		t.Errorf("generated bindings differ from %s, run the test with -update if the change is intended", golden)
+	}
+
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found, not compiling the bindings")
+	}
+	dir, err := ioutil.TempDir("", "bind-golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token.go"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(gocmd, "build", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated bindings don't compile: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// DefaultResolveTTL is how long contracts bound by CNS name keep using a resolved
+// address before resolving the name again.
+const DefaultResolveTTL = time.Minute
+
+// ErrNotRegistered is returned if no contract is registered in the CNS under a
+// name and version. It's the same error as cns.ErrNotFound.
+var ErrNotRegistered = errors.New("contract not registered")
+
+// NotRegisteredError is returned by contracts bound by CNS name if no contract is
+// registered under the name. It matches ErrNotRegistered.
+type NotRegisteredError struct {
+	Name    string
+	Version string // empty for the latest version
+}
+
+func (e *NotRegisteredError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("contract %s not registered", e.Name)
+	}
+	return fmt.Sprintf("contract %s version %s not registered", e.Name, e.Version)
+}
+
+// Unwrap returns ErrNotRegistered.
+func (e *NotRegisteredError) Unwrap() error { return ErrNotRegistered }
+
+// Is reports whether target is ErrNotRegistered.
+func (e *NotRegisteredError) Is(target error) bool { return target == ErrNotRegistered }
+
+// NameResolver resolves the names contracts are registered under in the CNS to
+// their addresses. *cns.Service implements it.
+type NameResolver interface {
+	// Resolve returns the address of the contract named by ref, which is either
+	// "name:version" or just "name" for the latest registered version. It fails
+	// with ErrNotRegistered if there is none.
+	Resolve(ctx context.Context, opts *CallOpts, ref string) (common.Address, error)
+}
+
+// NewBoundContractFromCNS binds the contract registered in the CNS under name and
+// version, or the latest version of it if version is empty. The address is
+// resolved once per group and resolved again once DefaultResolveTTL passed, so
+// the binding follows newly registered versions. It fails with
+// *NotRegisteredError if the contract isn't registered in the default group.
+func NewBoundContractFromCNS(name, version string, abi abi.ABI, backend ContractBackend, cns NameResolver) (*BoundContract, error) {
+	c := NewBoundContract(common.Address{}, abi, backend, backend, backend)
+	c.name = &nameBinding{
+		name:     name,
+		version:  version,
+		resolver: cns,
+		ttl:      DefaultResolveTTL,
+		resolved: make(map[int]resolvedAddress),
+	}
+	if _, err := c.name.address(context.Background(), 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetResolveTTL sets how long a contract bound by CNS name keeps using a resolved
+// address. A zero ttl resolves the name only once, or on Refresh. It has no
+// effect on contracts bound by address.
+func (c *BoundContract) SetResolveTTL(ttl time.Duration) {
+	if c.name == nil {
+		return
+	}
+	c.name.lock.Lock()
+	defer c.name.lock.Unlock()
+	c.name.ttl = ttl
+}
+
+// Refresh resolves the name of a contract bound by CNS name again, in every group
+// it was used in. It's a no-op for contracts bound by address.
+func (c *BoundContract) Refresh(ctx context.Context) error {
+	if c.name == nil {
+		return nil
+	}
+	c.name.lock.Lock()
+	groups := make([]int, 0, len(c.name.resolved))
+	for groupId := range c.name.resolved {
+		groups = append(groups, groupId)
+	}
+	c.name.resolved = make(map[int]resolvedAddress)
+	c.name.lock.Unlock()
+
+	for _, groupId := range groups {
+		if _, err := c.name.address(ctx, groupId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addressIn returns the address of the contract in a group, resolving its name if
+// it's bound by one.
+func (c *BoundContract) addressIn(ctx context.Context, groupId int) (common.Address, error) {
+	if c.name == nil {
+		return c.address, nil
+	}
+	return c.name.address(ctx, groupId)
+}
+
+// nameBinding tracks the addresses the CNS name of a contract resolved to.
+type nameBinding struct {
+	name     string
+	version  string
+	resolver NameResolver
+
+	lock     sync.Mutex
+	ttl      time.Duration
+	resolved map[int]resolvedAddress // by group
+}
+
+type resolvedAddress struct {
+	address common.Address
+	at      time.Time
+}
+
+// address returns the address the name resolves to in a group, resolving it if
+// it wasn't yet or the last resolution expired.
+func (b *nameBinding) address(ctx context.Context, groupId int) (common.Address, error) {
+	b.lock.Lock()
+	resolved, ok := b.resolved[groupId]
+	ttl := b.ttl
+	b.lock.Unlock()
+	if ok && (ttl == 0 || time.Since(resolved.at) < ttl) {
+		return resolved.address, nil
+	}
+
+	ref := b.name
+	if b.version != "" {
+		ref += ":" + b.version
+	}
+	address, err := b.resolver.Resolve(ensureContext(ctx), &CallOpts{Context: ctx, GroupId: groupId}, ref)
+	if err == ErrNotRegistered {
+		return common.Address{}, &NotRegisteredError{Name: b.name, Version: b.version}
+	} else if err != nil {
+		return common.Address{}, err
+	}
+	b.lock.Lock()
+	b.resolved[groupId] = resolvedAddress{address: address, at: time.Now()}
+	b.lock.Unlock()
+	return address, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// fakeCNS resolves the names registered in it, per group.
+type fakeCNS struct {
+	mu       sync.Mutex
+	names    map[int]map[string]common.Address // group to reference to address
+	resolved int                               // number of resolutions
+	err      error
+}
+
+func (c *fakeCNS) Resolve(ctx context.Context, opts *bind.CallOpts, ref string) (common.Address, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groupId := opts.GroupId
+	if groupId == 0 {
+		groupId = 1
+	}
+	c.resolved++
+	if c.err != nil {
+		return common.Address{}, c.err
+	}
+	addr, ok := c.names[groupId][ref]
+	if !ok {
+		return common.Address{}, bind.ErrNotRegistered
+	}
+	return addr, nil
+}
+
+func (c *fakeCNS) register(groupId int, ref string, addr common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names == nil {
+		c.names = make(map[int]map[string]common.Address)
+	}
+	if c.names[groupId] == nil {
+		c.names[groupId] = make(map[string]common.Address)
+	}
+	c.names[groupId][ref] = addr
+}
+
+func (c *fakeCNS) resolutions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resolved
+}
+
+func TestNewBoundContractFromCNSErrors(t *testing.T) {
+	parsed := abiJSON(t, vaultABI)
+	failure := errors.New("node unreachable")
+	tests := []struct {
+		version string
+		err     error // of the resolver
+		msg     string
+	}{
+		{version: "", msg: "contract Vault not registered"},
+		{version: "2.0", msg: "contract Vault version 2.0 not registered"},
+		{version: "1.0", err: failure, msg: failure.Error()},
+	}
+	for _, test := range tests {
+		cns := &fakeCNS{err: test.err}
+		cns.register(1, "Vault:3.0", common.Address{3})
+		_, err := bind.NewBoundContractFromCNS("Vault", test.version, parsed, &fakeChain{}, cns)
+		if err == nil || err.Error() != test.msg {
+			t.Errorf("version %q: got error %v, want %q", test.version, err, test.msg)
+			continue
+		}
+		e, ok := err.(*bind.NotRegisteredError)
+		if registered := test.err == nil; ok != registered || (ok && (!e.Is(bind.ErrNotRegistered) || e.Name != "Vault" || e.Version != test.version)) {
+			t.Errorf("version %q: got error %#v", test.version, err)
+		}
+	}
+}
+
+// TestBoundContractFromCNS checks the address calls are sent to as the name is
+// registered again, in several groups.
+func TestBoundContractFromCNS(t *testing.T) {
+	parsed := abiJSON(t, vaultABI)
+	for _, version := range []string{"", "1.0"} {
+		ref := "Vault"
+		if version != "" {
+			ref += ":" + version
+		}
+		cns := new(fakeCNS)
+		cns.register(1, ref, common.Address{1})
+		cns.register(2, ref, common.Address{2})
+		chain := new(fakeChain)
+		contract, err := bind.NewBoundContractFromCNS("Vault", version, parsed, chain, cns)
+		if err != nil {
+			t.Fatalf("%q: bind error: %v", ref, err)
+		}
+		call := func(groupId int, want common.Address, resolutions int) {
+			t.Helper()
+			var balance *big.Int
+			if err := contract.Call(&bind.CallOpts{GroupId: groupId}, &balance, "balance"); err != nil {
+				t.Fatalf("%q: group %d: call error: %v", ref, groupId, err)
+			}
+			if chain.callTo != want {
+				t.Errorf("%q: group %d: called %s, want %s", ref, groupId, chain.callTo.Hex(), want.Hex())
+			}
+			if n := cns.resolutions(); n != resolutions {
+				t.Errorf("%q: group %d: resolved %d times, want %d", ref, groupId, n, resolutions)
+			}
+		}
+		// Resolved when bound, for the default group, and once per group.
+		call(0, common.Address{1}, 1)
+		call(2, common.Address{2}, 2)
+		call(2, common.Address{2}, 2)
+
+		// A new registration is picked up on Refresh, in every group.
+		cns.register(1, ref, common.Address{0x11})
+		cns.register(2, ref, common.Address{0x12})
+		call(0, common.Address{1}, 2)
+		if err := contract.Refresh(context.Background()); err != nil {
+			t.Fatalf("%q: Refresh error: %v", ref, err)
+		}
+		call(0, common.Address{0x11}, 4)
+		call(2, common.Address{0x12}, 4)
+
+		// And once the resolved address expired.
+		contract.SetResolveTTL(20 * time.Millisecond)
+		cns.register(2, ref, common.Address{0x22})
+		time.Sleep(50 * time.Millisecond)
+		call(2, common.Address{0x22}, 5)
+		call(2, common.Address{0x22}, 5)
+
+		// Without expiry, only on Refresh.
+		contract.SetResolveTTL(0)
+		cns.register(2, ref, common.Address{0x32})
+		time.Sleep(50 * time.Millisecond)
+		call(2, common.Address{0x22}, 5)
+
+		// A name no longer registered fails the calls after a refresh.
+		cns.mu.Lock()
+		delete(cns.names[2], ref)
+		cns.mu.Unlock()
+		err = contract.Refresh(context.Background())
+		if e, ok := err.(*bind.NotRegisteredError); !ok || e.Name != "Vault" || e.Version != version {
+			t.Errorf("%q: refreshing an unregistered name: %v", ref, err)
+		}
+		var balance *big.Int
+		if err := contract.Call(&bind.CallOpts{GroupId: 2}, &balance, "balance"); err == nil {
+			t.Errorf("%q: called an unregistered contract", ref)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// ContractError is returned by Call if the contract reverted with a custom error
+// declared in its ABI. It wraps the error of the backend, so it still matches
+// the revert errors of the backend, e.g. ethclient.ErrExecutionReverted.
+type ContractError struct {
+	Name string        // name of the custom error
+	Args []interface{} // arguments of the custom error
+	Err  error         // error the backend reported the revert with
+}
+
+func (e *ContractError) Error() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = fmt.Sprintf("%v", arg)
+	}
+	return fmt.Sprintf("%v: %s(%s)", e.Err, e.Name, strings.Join(args, ", "))
+}
+
+// Unwrap returns the error of the backend.
+func (e *ContractError) Unwrap() error { return e.Err }
+
+// revertDataError is implemented by the errors backends report reverted calls
+// with, e.g. *ethclient.RevertError.
+type revertDataError interface {
+	error
+	RevertData() []byte
+}
+
+// contractError turns the revert error of a call into a *ContractError if the
+// contract reverted with one of the custom errors of its ABI. Other errors are
+// returned as they are.
+func (c *BoundContract) contractError(err error) error {
+	reverted, ok := err.(revertDataError)
+	if !ok {
+		return err
+	}
+	name, args, uerr := c.abi.UnpackCustomError(reverted.RevertData())
+	if uerr != nil {
+		return err
+	}
+	return &ContractError{Name: name, Args: args, Err: err}
+}
+
+// TransactionError is returned by TransactAndCall if the transaction failed. It
+// wraps the execution status of the receipt as *types.StatusError, so it matches
+// errors like types.ErrContractFrozen.
+type TransactionError struct {
+	Status int    // execution status of the receipt
+	Reason string // reason passed to revert or require, empty if none was given
+	Output []byte // output of the transaction, the revert data if it reverted
+}
+
+func (e *TransactionError) Error() string {
+	msg := "transaction failed: " + types.StatusMessage(e.Status)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// RevertData returns the output of the transaction, which carries the custom
+// error of the contract if it reverted with one.
+func (e *TransactionError) RevertData() []byte { return e.Output }
+
+// Unwrap returns the execution status as *types.StatusError.
+func (e *TransactionError) Unwrap() error { return &types.StatusError{Status: e.Status} }
+
+// receiptError returns a *TransactionError if the receipt reports a failed
+// transaction, nil if it succeeded.
+func receiptError(receipt *types.Receipt) error {
+	status, err := receipt.StatusCode()
+	if err != nil {
+		return receipt.Err()
+	}
+	if status == types.StatusSuccess {
+		return nil
+	}
+	reason, _ := receipt.RevertReason()
+	return &TransactionError{Status: status, Reason: reason, Output: receipt.Output}
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// DecodedEvent is a receipt log matched against a contract ABI. Indexed dynamic
+// arguments (strings, bytes, arrays) are returned as the Keccak256 hash stored
+// in their topic, since the original value cannot be recovered.
+//
+// A raw event is a log delivered without decoding because it matches no event
+// of the ABI. Only its Log is set.
+type DecodedEvent struct {
+	Name  string                 // Name of the event in the ABI
+	Event abi.Event              // ABI definition of the event
+	Log   *types.Log             // Log the event was decoded from
+	Args  map[string]interface{} // Indexed and non-indexed arguments by name
+	Raw   bool                   // Whether the log is a raw event
+}
+
+// UnpackLog unpacks a log emitted by the named event of the ABI into the
+// provided output structure.
+func UnpackLog(contractABI abi.ABI, out interface{}, event string, log types.Log) error {
+	indexed, err := eventTopics(contractABI, event, log)
+	if err != nil {
+		return err
+	}
+	if len(log.Data) > 0 {
+		if err := contractABI.Unpack(out, event, log.Data); err != nil {
+			return err
+		}
+	}
+	return parseTopics(out, indexed, log.Topics[len(log.Topics)-len(indexed):])
+}
+
+// UnpackLogIntoMap unpacks a log emitted by the named event of the ABI into the
+// provided map.
+func UnpackLogIntoMap(contractABI abi.ABI, out map[string]interface{}, event string, log types.Log) error {
+	indexed, err := eventTopics(contractABI, event, log)
+	if err != nil {
+		return err
+	}
+	if len(log.Data) > 0 {
+		if err := contractABI.UnpackIntoMap(out, event, log.Data); err != nil {
+			return err
+		}
+	}
+	return parseTopicsIntoMap(out, indexed, log.Topics[len(log.Topics)-len(indexed):])
+}
+
+// ParseReceiptEvents decodes the logs of a receipt whose first topic matches
+// the signature of an event in the ABI. Logs of other events, including those
+// emitted by other contracts during the same transaction, are skipped.
+func ParseReceiptEvents(contractABI abi.ABI, receipt *types.Receipt) ([]DecodedEvent, error) {
+	if receipt == nil {
+		return nil, errors.New("bind: nil receipt")
+	}
+	events := make(map[common.Hash]abi.Event)
+	for _, event := range contractABI.Events {
+		if !event.Anonymous {
+			events[event.Id()] = event
+		}
+	}
+	var decoded []DecodedEvent
+	for _, log := range receipt.Logs {
+		if log == nil || len(log.Topics) == 0 {
+			continue
+		}
+		event, ok := events[log.Topics[0]]
+		if !ok {
+			continue
+		}
+		args := make(map[string]interface{})
+		if err := UnpackLogIntoMap(contractABI, args, event.Name, *log); err != nil {
+			return nil, fmt.Errorf("bind: failed to decode event %s of log %d: %v", event.Name, log.Index, err)
+		}
+		decoded = append(decoded, DecodedEvent{Name: event.Name, Event: event, Log: log, Args: args})
+	}
+	return decoded, nil
+}
+
+// eventTopics looks up the named event and checks that the log carries its
+// signature and one topic per indexed argument, returning those arguments.
+func eventTopics(contractABI abi.ABI, name string, log types.Log) (abi.Arguments, error) {
+	event, ok := contractABI.Events[name]
+	if !ok {
+		return nil, fmt.Errorf("bind: no event named %q in ABI", name)
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	want := len(indexed)
+	if !event.Anonymous {
+		want++
+		if len(log.Topics) > 0 && log.Topics[0] != event.Id() {
+			return nil, fmt.Errorf("bind: log signature %x does not match event %s", log.Topics[0], name)
+		}
+	}
+	if len(log.Topics) != want {
+		return nil, fmt.Errorf("bind: event %s expects %d topics, log has %d", name, want, len(log.Topics))
+	}
+	return indexed, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+const transferABI = `[
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Tagged","inputs":[{"name":"tag","type":"string","indexed":true},{"name":"note","type":"string","indexed":false}]},
+	{"type":"event","name":"Ping","inputs":[],"anonymous":true}
+]`
+
+func TestParseReceiptEvents(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(transferABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		token    = common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1")
+		from, to = common.Address{0xf0}, common.Address{0x70}
+		transfer = parsed.Events["Transfer"].Id()
+		tagged   = parsed.Events["Tagged"].Id()
+	)
+	value, _ := abi.Arguments{parsed.Events["Transfer"].Inputs[2]}.Pack(big.NewInt(1000))
+	note, _ := abi.Arguments{parsed.Events["Tagged"].Inputs[1]}.Pack("a note")
+	receipt := &types.Receipt{Logs: []*types.Log{
+		{Address: token, Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: value, Index: 0},
+		// An event of another contract, and an anonymous one.
+		{Address: common.Address{0xc0}, Topics: []common.Hash{{0xee}}, Data: value, Index: 1},
+		{Address: token, Data: []byte{}, Index: 2},
+		nil,
+		{Address: token, Topics: []common.Hash{tagged, crypto.Keccak256Hash([]byte("tag"))}, Data: note, Index: 4},
+	}}
+	events, err := bind.ParseReceiptEvents(parsed, receipt)
+	if err != nil {
+		t.Fatalf("ParseReceiptEvents error: %v", err)
+	}
+	want := []bind.DecodedEvent{
+		{
+			Name:  "Transfer",
+			Event: parsed.Events["Transfer"],
+			Log:   receipt.Logs[0],
+			Args:  map[string]interface{}{"from": from, "to": to, "value": big.NewInt(1000)},
+		},
+		{
+			Name:  "Tagged",
+			Event: parsed.Events["Tagged"],
+			Log:   receipt.Logs[4],
+			Args:  map[string]interface{}{"tag": crypto.Keccak256Hash([]byte("tag")), "note": "a note"},
+		},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("decoded events:\n%+v\nwant\n%+v", events, want)
+	}
+
+	// A log of a known event which doesn't decode fails the receipt.
+	receipt.Logs = append(receipt.Logs, &types.Log{Address: token, Topics: []common.Hash{transfer, from.Hash()}, Data: value, Index: 5})
+	if _, err := bind.ParseReceiptEvents(parsed, receipt); err == nil || !strings.Contains(err.Error(), "log 5") {
+		t.Errorf("malformed log: got error %v", err)
+	}
+	if _, err := bind.ParseReceiptEvents(parsed, nil); err == nil {
+		t.Error("nil receipt accepted")
+	}
+}
+
+func TestUnpackLog(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(transferABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		from, to = common.Address{0xf0}, common.Address{0x70}
+		transfer = parsed.Events["Transfer"].Id()
+	)
+	value, _ := abi.Arguments{parsed.Events["Transfer"].Inputs[2]}.Pack(big.NewInt(1000))
+	tests := []struct {
+		name  string
+		event string
+		log   types.Log
+		err   string
+	}{
+		{name: "valid", event: "Transfer", log: types.Log{Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: value}},
+		{name: "unknown event", event: "Approval", log: types.Log{Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: value}, err: `no event named "Approval"`},
+		{name: "other signature", event: "Transfer", log: types.Log{Topics: []common.Hash{{0xee}, from.Hash(), to.Hash()}, Data: value}, err: "does not match event Transfer"},
+		{name: "missing topic", event: "Transfer", log: types.Log{Topics: []common.Hash{transfer, from.Hash()}, Data: value}, err: "expects 3 topics, log has 2"},
+		{name: "extra topic", event: "Ping", log: types.Log{Topics: []common.Hash{{1}}}, err: "expects 0 topics, log has 1"},
+		{name: "anonymous", event: "Ping", log: types.Log{}},
+	}
+	for _, test := range tests {
+		var out struct {
+			From  common.Address
+			To    common.Address
+			Value *big.Int
+		}
+		err := bind.UnpackLog(parsed, &out, test.event, test.log)
+		args := make(map[string]interface{})
+		mapErr := bind.UnpackLogIntoMap(parsed, args, test.event, test.log)
+		if test.err != "" {
+			for _, err := range []error{err, mapErr} {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+				}
+			}
+			continue
+		}
+		if err != nil || mapErr != nil {
+			t.Errorf("%s: got errors %v and %v", test.name, err, mapErr)
+			continue
+		}
+		if test.event == "Transfer" {
+			if out.From != from || out.To != to || out.Value.Cmp(big.NewInt(1000)) != 0 {
+				t.Errorf("%s: unpacked %+v", test.name, out)
+			}
+			if args["from"] != from || args["to"] != to || args["value"].(*big.Int).Cmp(big.NewInt(1000)) != 0 {
+				t.Errorf("%s: unpacked %v", test.name, args)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+// placeholderRE matches the library placeholders solc leaves in bytecode: the
+// __$<hash>$__ form of solc 0.5 and later, and the __<name>___ form of earlier
+// versions. Both take the 40 hex digits of an address.
+var placeholderRE = regexp.MustCompile(`__\$[0-9a-fA-F]{34}\$__|__[^_$][^$]{35}__`)
+
+// LinkBytecode links the hex encoded bytecode emitted by solc to the libraries it
+// uses, replacing the placeholders for them with their addresses, and decodes it.
+//
+// Libraries are keyed by their fully qualified name, e.g. "contracts/Math.sol:Math".
+// The bare library name, e.g. "Math", only links the placeholders of solc 0.4.
+// Linking fails if a placeholder is left without library.
+func LinkBytecode(bytecode string, libraries map[string]common.Address) ([]byte, error) {
+	var (
+		hashed = make(map[string]common.Address) // by name hash, for solc 0.5 and later
+		named  = make(map[string]common.Address) // by name, for solc 0.4
+	)
+	for name, addr := range libraries {
+		hashed[hex.EncodeToString(crypto.Keccak256([]byte(name)))[:34]] = addr
+		if len(name) > 36 {
+			name = name[:36] // placeholders only have room for 36 characters
+		}
+		named[name] = addr
+	}
+	var unlinked string
+	linked := placeholderRE.ReplaceAllStringFunc(strings.TrimPrefix(strings.TrimSpace(bytecode), "0x"), func(placeholder string) string {
+		var (
+			addr common.Address
+			ok   bool
+		)
+		if strings.HasPrefix(placeholder, "__$") {
+			addr, ok = hashed[strings.ToLower(placeholder[3:37])]
+		} else {
+			name := strings.TrimRight(placeholder[2:], "_")
+			if addr, ok = named[name]; !ok {
+				addr, ok = named[name[strings.LastIndex(name, ":")+1:]]
+			}
+		}
+		if !ok {
+			unlinked = placeholder
+			return placeholder
+		}
+		return hex.EncodeToString(addr[:])
+	})
+	if unlinked != "" {
+		return nil, fmt.Errorf("no library given for placeholder %s", unlinked)
+	}
+	code, err := hex.DecodeString(linked)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %v", err)
+	}
+	return code, nil
+}
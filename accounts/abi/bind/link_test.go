@@ -0,0 +1,241 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// hashedPlaceholder returns the placeholder of a library emitted by solc 0.5
+// and later.
+func hashedPlaceholder(name string) string {
+	return "__$" + hex.EncodeToString(crypto.Keccak256([]byte(name)))[:34] + "$__"
+}
+
+// namedPlaceholder returns the placeholder of a library emitted by solc 0.4.
+func namedPlaceholder(name string) string {
+	if len(name) > 36 {
+		name = name[:36]
+	}
+	return "__" + name + strings.Repeat("_", 38-len(name))
+}
+
+func TestLinkBytecode(t *testing.T) {
+	var (
+		math    = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		strs    = common.HexToAddress("0x2222222222222222222222222222222222222222")
+		mathHex = hex.EncodeToString(math[:])
+		strsHex = hex.EncodeToString(strs[:])
+		long    = "contracts/very/deep/path/to/Libraries.sol:Strings"
+	)
+	tests := []struct {
+		name      string
+		bytecode  string
+		libraries map[string]common.Address
+		want      string // hex, empty for an error
+	}{
+		{
+			name:     "no placeholders",
+			bytecode: "0x6080604052",
+			want:     "6080604052",
+		},
+		{
+			name:      "hashed",
+			bytecode:  "73" + hashedPlaceholder("contracts/Math.sol:Math") + "6080",
+			libraries: map[string]common.Address{"contracts/Math.sol:Math": math},
+			want:      "73" + mathHex + "6080",
+		},
+		{
+			name:      "hashed repeatedly, two libraries",
+			bytecode:  " 0x73" + hashedPlaceholder("a.sol:Math") + "73" + hashedPlaceholder(long) + "73" + hashedPlaceholder("a.sol:Math") + "\n",
+			libraries: map[string]common.Address{"a.sol:Math": math, long: strs},
+			want:      "73" + mathHex + "73" + strsHex + "73" + mathHex,
+		},
+		{
+			name:      "hashed by bare name",
+			bytecode:  "73" + hashedPlaceholder("contracts/Math.sol:Math"),
+			libraries: map[string]common.Address{"Math": math},
+		},
+		{
+			name:      "named",
+			bytecode:  "73" + namedPlaceholder("Math.sol:Math") + "00",
+			libraries: map[string]common.Address{"Math.sol:Math": math},
+			want:      "73" + mathHex + "00",
+		},
+		{
+			name:      "named by bare name",
+			bytecode:  "73" + namedPlaceholder("Math.sol:Math"),
+			libraries: map[string]common.Address{"Math": math},
+			want:      "73" + mathHex,
+		},
+		{
+			name:      "named, truncated",
+			bytecode:  "73" + namedPlaceholder(long),
+			libraries: map[string]common.Address{long: strs},
+			want:      "73" + strsHex,
+		},
+		{
+			name:      "missing library",
+			bytecode:  "73" + hashedPlaceholder("a.sol:Math") + "73" + hashedPlaceholder("a.sol:Other"),
+			libraries: map[string]common.Address{"a.sol:Math": math},
+		},
+		{
+			name:     "invalid hex",
+			bytecode: "0x60806",
+		},
+	}
+	for _, test := range tests {
+		code, err := bind.LinkBytecode(test.bytecode, test.libraries)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: linked to %x, want error", test.name, code)
+			}
+			continue
+		}
+		if err != nil || hex.EncodeToString(code) != test.want {
+			t.Errorf("%s: linked to %x, %v, want %s", test.name, code, err, test.want)
+		}
+	}
+}
+
+const constructorABI = `[{"inputs":[{"name":"owner","type":"address"},{"name":"supply","type":"uint256"}],"stateMutability":"nonpayable","type":"constructor"}]`
+
+// revertOutput encodes a revert reason as Error(string).
+func revertOutput(reason string) string {
+	str, _ := abi.NewType("string", nil)
+	enc, _ := abi.Arguments{{Type: str}}.Pack(reason)
+	return hexutil.Encode(append(common.FromHex("0x08c379a0"), enc...))
+}
+
+func TestDeployContractRaw(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getClientVersion", &types.ClientVersion{Version: "2.7.0", ChainId: "1"})
+	node.Respond("getBlockNumber", "0x10")
+	node.Respond("sendRawTransaction", common.Hash{}.Hex())
+	client := node.Client()
+	key, _ := crypto.GenerateKey()
+
+	var (
+		bytecode = common.FromHex("0x6080604052")
+		owner    = common.Address{0x0e}
+		deployed = common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1")
+	)
+	tests := []struct {
+		name     string
+		bytecode []byte
+		params   []interface{}
+		receipt  map[string]interface{} // nil if nothing should be sent
+		err      string
+	}{
+		{
+			name:     "deployed",
+			bytecode: bytecode,
+			params:   []interface{}{owner, big.NewInt(1000)},
+			receipt:  map[string]interface{}{"status": "0x0", "contractAddress": deployed},
+		},
+		{
+			name:     "reverted",
+			bytecode: bytecode,
+			params:   []interface{}{owner, big.NewInt(1000)},
+			receipt:  map[string]interface{}{"status": "0x16", "output": revertOutput("supply too low")},
+			err:      "contract deployment failed: RevertInstruction: supply too low",
+		},
+		{
+			name:     "out of gas",
+			bytecode: bytecode,
+			params:   []interface{}{owner, big.NewInt(1000)},
+			receipt:  map[string]interface{}{"status": "0xc"},
+			err:      "contract deployment failed: OutOfGas",
+		},
+		{
+			name:     "no contract address",
+			bytecode: bytecode,
+			params:   []interface{}{owner, big.NewInt(1000)},
+			receipt:  map[string]interface{}{"status": "0x0", "contractAddress": common.Address{}},
+			err:      "contract deployment receipt lacks the contract address",
+		},
+		{name: "no bytecode", params: []interface{}{owner, big.NewInt(1000)}, err: "no contract bytecode to deploy"},
+		{name: "missing argument", bytecode: bytecode, params: []interface{}{owner}, err: "argument count mismatch"},
+	}
+	for _, test := range tests {
+		node.Reset()
+		if test.receipt != nil {
+			node.Respond("getTransactionReceipt", test.receipt)
+		}
+		opts := bind.NewKeyedTransactor(key)
+		opts.GasLimit = 30000000
+		opts.Context = context.Background()
+
+		addr, tx, receipt, err := bind.DeployContractRaw(opts, constructorABI, test.bytecode, client, test.params...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			if addr != (common.Address{}) {
+				t.Errorf("%s: got address %s along with the error", test.name, addr.Hex())
+			}
+		} else if err != nil || addr != deployed {
+			t.Errorf("%s: deployed at %s, %v, want %s", test.name, addr.Hex(), err, deployed.Hex())
+		}
+		sent := node.CallsTo("sendRawTransaction")
+		if test.receipt == nil {
+			if len(sent) != 0 || tx != nil || receipt != nil {
+				t.Errorf("%s: sent %d transactions", test.name, len(sent))
+			}
+			continue
+		}
+		if len(sent) != 1 || tx == nil || receipt == nil {
+			t.Errorf("%s: sent %d transactions, returned %v and receipt %v", test.name, len(sent), tx, receipt)
+			continue
+		}
+		// The input is the bytecode followed by the constructor arguments.
+		_, raw := sentTransaction(t, sent[0])
+		args, _ := abiJSON(t, constructorABI).Pack("", test.params...)
+		if raw.To() != nil || !bytes.Equal(raw.Data(), append(append([]byte{}, test.bytecode...), args...)) {
+			t.Errorf("%s: sent deployment to %v with input %x", test.name, raw.To(), raw.Data())
+		}
+		if raw.Hash() != tx.Hash() {
+			t.Errorf("%s: returned transaction %s, sent %s", test.name, tx.Hash().Hex(), raw.Hash().Hex())
+		}
+	}
+	if _, _, _, err := bind.DeployContractRaw(bind.NewKeyedTransactor(key), "[{", bytecode, client); err == nil {
+		t.Error("deployed with an invalid ABI")
+	}
+}
+
+func abiJSON(t *testing.T, s string) abi.ABI {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
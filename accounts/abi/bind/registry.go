@@ -0,0 +1,51 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// ContractRegistry looks up contracts recorded by name off chain, for chains
+// without CNS. *registry.Store implements it.
+type ContractRegistry interface {
+	// Lookup returns the group, address and ABI of the contract registered under
+	// name. It fails with ErrNotRegistered if there is none.
+	Lookup(name string) (groupId int, address common.Address, abiJSON string, err error)
+}
+
+// NewBoundContractFromRegistry binds the contract registered under name in a
+// ContractRegistry, using the ABI recorded with it. The group the contract was
+// deployed to is returned too, calls and transactions must set it as GroupId.
+// It fails with *NotRegisteredError if the name isn't registered.
+func NewBoundContractFromRegistry(name string, backend ContractBackend, registry ContractRegistry) (*BoundContract, int, error) {
+	groupId, address, abiJSON, err := registry.Lookup(name)
+	if err == ErrNotRegistered {
+		return nil, 0, &NotRegisteredError{Name: name}
+	} else if err != nil {
+		return nil, 0, err
+	}
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid ABI of contract %s: %v", name, err)
+	}
+	return NewBoundContract(address, parsed, backend, backend, backend), groupId, nil
+}
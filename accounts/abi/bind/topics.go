@@ -219,8 +219,8 @@ func parseTopicsIntoMap(out map[string]interface{}, fields abi.Arguments, topics
 			out[arg.Name] = topics[0]
 		case abi.FixedBytesTy:
 			out[arg.Name] = topics[0][:]
-		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy:
-			// Array types (including strings and bytes) have their keccak256 hashes stored in the topic- not a hash
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+			// Array and tuple types (including strings and bytes) have their keccak256 hashes stored in the topic- not a hash
 			// whose bytes can be decoded to the actual value- so the best we can do is retrieve that hash
 			out[arg.Name] = topics[0]
 		case abi.FunctionTy:
@@ -230,7 +230,7 @@ func parseTopicsIntoMap(out map[string]interface{}, fields abi.Arguments, topics
 			var tmp [24]byte
 			copy(tmp[:], topics[0][8:32])
 			out[arg.Name] = tmp
-		default: // Not handling tuples
+		default:
 			return fmt.Errorf("unsupported indexed type: %v", arg.Type)
 		}
 
@@ -24,10 +24,12 @@ import (
 	"github.com/chislab/go-fiscobcos/common"
 	"github.com/chislab/go-fiscobcos/core/types"
 	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc"
 )
 
 // WaitMined waits for tx to be mined on the blockchain.
-// It stops waiting when the context is canceled.
+// It stops waiting when the context is canceled or the backend's client is
+// closed, in which case rpc.ErrClientQuit is returned.
 func WaitMined(ctx context.Context, groupId uint64, b DeployBackend, tx *types.Transaction) (*types.Receipt, error) {
 	queryTicker := time.NewTicker(time.Second)
 	defer queryTicker.Stop()
@@ -38,6 +40,9 @@ func WaitMined(ctx context.Context, groupId uint64, b DeployBackend, tx *types.T
 		if receipt != nil {
 			return receipt, nil
 		}
+		if err == rpc.ErrClientQuit {
+			return nil, err
+		}
 		if err != nil {
 			logger.Trace("Receipt retrieval failed", "err", err)
 		} else {
@@ -62,15 +67,15 @@ func WaitDeployed(ctx context.Context, groupId uint64, b DeployBackend, tx *type
 	if err != nil {
 		return common.Address{}, err
 	}
-	if receipt.ContractAddress == (common.Address{}) {
+	if receipt.ContractAddress == nil {
 		return common.Address{}, fmt.Errorf("zero address")
 	}
 	// Check that code has indeed been deployed at the address.
 	// This matters on pre-Homestead chains: OOG in the constructor
 	// could leave an empty account behind.
-	code, err := b.CodeAt(ctx, int(groupId), receipt.ContractAddress, nil)
+	code, err := b.CodeAt(ctx, groupId, *receipt.ContractAddress, nil)
 	if err == nil && len(code) == 0 {
 		err = ErrNoCodeAfterDeploy
 	}
-	return receipt.ContractAddress, err
+	return *receipt.ContractAddress, err
 }
@@ -0,0 +1,105 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// TestWaitMinedReconnect drops the channel connection while WaitMined polls for
+// a receipt, checking that the wait carries on over the new connection and that
+// the block number subscription is reported to the node again.
+func TestWaitMinedReconnect(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x1")
+
+	tx := types.NewTransaction(big.NewInt(1), common.Address{1}, new(big.Int), 30000000, new(big.Int), nil, big.NewInt(600), big.NewInt(1), big.NewInt(1), nil)
+	var (
+		mu    sync.Mutex
+		polls int
+	)
+	node.Handle("getTransactionReceipt", func([]json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		polls++
+		poll := polls
+		mu.Unlock()
+		switch poll {
+		case 1:
+			return nil, nil
+		case 2:
+			// The node goes away while answering.
+			node.DropChannels()
+			return nil, nil
+		}
+		return &types.Receipt{TxHash: tx.Hash(), BlockNumber: 2, Status: "0x0", Logs: []*types.Log{}}, nil
+	})
+
+	client := node.ChannelClient()
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func() {
+		select {
+		case reconnected <- struct{}{}:
+		default:
+		}
+	})
+	sub, err := client.SubscribeBlockNumber(1, make(chan uint64, 1))
+	if err != nil {
+		t.Fatalf("SubscribeBlockNumber error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	receipt, err := bind.WaitMined(ctx, 1, client, tx)
+	if err != nil {
+		t.Fatalf("WaitMined error: %v", err)
+	}
+	if receipt.TxHash != tx.Hash() {
+		t.Errorf("got receipt of %x, want %x", receipt.TxHash, tx.Hash())
+	}
+	mu.Lock()
+	if polls != 3 {
+		t.Errorf("receipt polled %d times, want 3", polls)
+	}
+	mu.Unlock()
+	select {
+	case <-reconnected:
+	default:
+		t.Error("OnReconnect hook didn't run")
+	}
+	var reports int
+	for _, f := range node.Frames() {
+		if f.Type == rpc.TYPE_TOPIC_REPORT && string(f.Payload) == `["_block_notify_1"]` {
+			reports++
+		}
+	}
+	if reports != 2 {
+		t.Errorf("block number topic reported %d times, want once per connection", reports)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+var (
+	// revertSelector is the selector of Error(string), used by solidity to encode
+	// the reasons passed to revert and require.
+	revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+	// panicSelector is the selector of Panic(uint256), used by solidity since 0.8
+	// to encode failed assertions and runtime errors.
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+	errNoRevertReason    = errors.New("abi: no revert reason in output")
+	errInvalidRevertData = errors.New("abi: invalid revert reason encoding")
+)
+
+// panicReasons describes the codes solidity panics with.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesSlice",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// UnpackRevert decodes the output of a reverted execution into a readable reason.
+// It covers the reasons passed to revert and require, encoded as Error(string),
+// and the runtime errors of solidity 0.8, encoded as Panic(uint256). Custom
+// errors are decoded by ABI.UnpackCustomError.
+func UnpackRevert(data []byte) (string, error) {
+	if len(data) < 4 {
+		return "", errNoRevertReason
+	}
+	switch {
+	case bytes.Equal(data[:4], revertSelector):
+		typ, _ := NewType("string", nil)
+		reason, err := toGoType(0, typ, data[4:])
+		if err != nil {
+			return "", errInvalidRevertData
+		}
+		return reason.(string), nil
+	case bytes.Equal(data[:4], panicSelector):
+		if len(data) != 4+32 {
+			return "", errInvalidRevertData
+		}
+		code := new(big.Int).SetBytes(data[4:])
+		if reason, ok := panicReasons[code.Uint64()]; code.IsUint64() && ok {
+			return fmt.Sprintf("%s (panic code %#x)", reason, code), nil
+		}
+		return fmt.Sprintf("unknown panic code %#x", code), nil
+	}
+	return "", errNoRevertReason
+}
+
+// Error is a custom error declared by a contract. Reverting with it returns its
+// selector followed by its ABI encoded arguments.
+type Error struct {
+	Name   string
+	Inputs Arguments
+}
+
+// Sig returns the string signature of the error, e.g.
+// "InsufficientBalance(uint256,uint256)".
+func (e Error) Sig() string {
+	types := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		types[i] = input.Type.String()
+	}
+	return fmt.Sprintf("%v(%v)", e.Name, strings.Join(types, ","))
+}
+
+func (e Error) String() string {
+	inputs := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		inputs[i] = fmt.Sprintf("%v %v", input.Type, input.Name)
+	}
+	return fmt.Sprintf("error %v(%v)", e.Name, strings.Join(inputs, ", "))
+}
+
+// Id returns the selector of the error, the first 4 bytes of the hash of its
+// signature.
+func (e Error) Id() []byte {
+	return crypto.Keccak256([]byte(e.Sig()))[:4]
+}
+
+// UnpackCustomError matches the selector of the output of a reverted execution
+// against the errors declared in the ABI, returning the name of the error and
+// its decoded arguments.
+func (abi ABI) UnpackCustomError(data []byte) (name string, args []interface{}, err error) {
+	if len(data) < 4 {
+		return "", nil, errNoRevertReason
+	}
+	for _, e := range abi.Errors {
+		if !bytes.Equal(e.Id(), data[:4]) {
+			continue
+		}
+		args, err := e.Inputs.UnpackValues(data[4:])
+		if err != nil {
+			return "", nil, err
+		}
+		return e.Name, args, nil
+	}
+	return "", nil, fmt.Errorf("abi: no error with id: %#x", data[:4])
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+func word(n uint64) string {
+	return common.Bytes2Hex(common.LeftPadBytes(new(big.Int).SetUint64(n).Bytes(), 32))
+}
+
+var unpackRevertTests = []struct {
+	data   string
+	reason string
+	err    error
+}{
+	// Error(string)
+	{"0x08c379a0" + word(0x20) + word(20) + "696e73756666696369656e742062616c616e6365000000000000000000000000", "insufficient balance", nil},
+	{"0x08c379a0" + word(0x20) + word(0), "", nil},
+	{"0x08c379a0", "", errInvalidRevertData},
+	{"0x08c379a0" + word(0x40) + word(1), "", errInvalidRevertData},
+	{"0x08c379a0" + word(0x20) + word(0x100) + "6162000000000000000000000000000000000000000000000000000000000000", "", errInvalidRevertData},
+	// Panic(uint256)
+	{"0x4e487b71" + word(0x01), "assert(false) (panic code 0x1)", nil},
+	{"0x4e487b71" + word(0x11), "arithmetic underflow or overflow (panic code 0x11)", nil},
+	{"0x4e487b71" + word(0x99), "unknown panic code 0x99", nil},
+	{"0x4e487b71" + word(0x32) + word(0), "", errInvalidRevertData},
+	{"0x4e487b71", "", errInvalidRevertData},
+	// No reason
+	{"", "", errNoRevertReason},
+	{"0x08c379", "", errNoRevertReason},
+	{"0x12345678" + word(0x20), "", errNoRevertReason},
+}
+
+func TestUnpackRevert(t *testing.T) {
+	for i, test := range unpackRevertTests {
+		reason, err := UnpackRevert(common.FromHex(test.data))
+		if err != test.err || reason != test.reason {
+			t.Errorf("test %d: got %q, %v, want %q, %v", i, reason, err, test.reason, test.err)
+		}
+	}
+}
+
+const customErrorABI = `[
+	{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+	{"type":"error","name":"Unauthorized","inputs":[]}
+]`
+
+func TestUnpackCustomError(t *testing.T) {
+	parsed, err := JSON(bytes.NewReader([]byte(customErrorABI)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insufficient := parsed.Errors["InsufficientBalance"]
+	if sig := insufficient.Sig(); sig != "InsufficientBalance(uint256,uint256)" {
+		t.Errorf("signature %s", sig)
+	}
+	if id := common.Bytes2Hex(insufficient.Id()); id != "cf479181" {
+		t.Errorf("id %s, want cf479181", id)
+	}
+
+	name, args, err := parsed.UnpackCustomError(common.FromHex("0xcf479181" + word(100) + word(250)))
+	if err != nil || name != "InsufficientBalance" || !reflect.DeepEqual(args, []interface{}{big.NewInt(100), big.NewInt(250)}) {
+		t.Errorf("got %s%v, %v", name, args, err)
+	}
+	name, args, err = parsed.UnpackCustomError(parsed.Errors["Unauthorized"].Id())
+	if err != nil || name != "Unauthorized" || len(args) != 0 {
+		t.Errorf("got %s%v, %v", name, args, err)
+	}
+	// Reverts with a reason or an undeclared error don't match.
+	if _, _, err := parsed.UnpackCustomError(common.FromHex("0x08c379a0" + word(0x20) + word(0))); err == nil {
+		t.Error("Error(string) matched a custom error")
+	}
+	if _, _, err := parsed.UnpackCustomError(common.FromHex("0xcf47")); err != errNoRevertReason {
+		t.Errorf("short data: %v", err)
+	}
+	if _, _, err := parsed.UnpackCustomError(common.FromHex("0xcf479181" + word(100))); err == nil {
+		t.Error("truncated arguments decoded")
+	}
+}
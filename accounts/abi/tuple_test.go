@@ -0,0 +1,406 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// tupleABI declares methods taking and returning the same arguments, so that
+// their encodings can be packed as inputs and unpacked as outputs. f and g are
+// the examples of the ABI specification, tuple its example of tuple encoding.
+const tupleABI = `[
+	{"type":"function","name":"f","inputs":[{"name":"a","type":"uint256"},{"name":"b","type":"uint32[]"},{"name":"c","type":"bytes10"},{"name":"d","type":"bytes"}],
+	 "outputs":[{"name":"a","type":"uint256"},{"name":"b","type":"uint32[]"},{"name":"c","type":"bytes10"},{"name":"d","type":"bytes"}]},
+	{"type":"function","name":"g","inputs":[{"name":"a","type":"uint256[][]"},{"name":"b","type":"string[]"}],
+	 "outputs":[{"name":"a","type":"uint256[][]"},{"name":"b","type":"string[]"}]},
+	{"type":"function","name":"tuple","inputs":[
+		{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"uint256[]"},{"name":"c","type":"tuple[]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]}]},
+		{"name":"t","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]},
+		{"name":"a","type":"uint256"}],
+	 "outputs":[
+		{"name":"s","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"uint256[]"},{"name":"c","type":"tuple[]","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]}]},
+		{"name":"t","type":"tuple","components":[{"name":"x","type":"uint256"},{"name":"y","type":"uint256"}]},
+		{"name":"a","type":"uint256"}]},
+	{"type":"function","name":"pairs","inputs":[{"name":"pairs","type":"tuple[2]","components":[{"name":"x","type":"uint256"},{"name":"ok","type":"bool"}]},{"name":"tail","type":"uint256"}],
+	 "outputs":[{"name":"pairs","type":"tuple[2]","components":[{"name":"x","type":"uint256"},{"name":"ok","type":"bool"}]},{"name":"tail","type":"uint256"}]},
+	{"type":"function","name":"record","inputs":[{"name":"r","type":"tuple","components":[
+		{"name":"name","type":"string"},
+		{"name":"meta","type":"tuple","components":[{"name":"data","type":"bytes"},{"name":"tags","type":"string[]"}]},
+		{"name":"groups","type":"tuple[][]","components":[{"name":"id","type":"uint64"},{"name":"owner","type":"address"}]}]}],
+	 "outputs":[{"name":"r","type":"tuple","components":[
+		{"name":"name","type":"string"},
+		{"name":"meta","type":"tuple","components":[{"name":"data","type":"bytes"},{"name":"tags","type":"string[]"}]},
+		{"name":"groups","type":"tuple[][]","components":[{"name":"id","type":"uint64"},{"name":"owner","type":"address"}]}]}]}
+]`
+
+type point struct {
+	X *big.Int
+	Y *big.Int
+}
+
+type specStruct struct {
+	A *big.Int
+	B []*big.Int
+	C []point
+}
+
+type pair struct {
+	Value *big.Int `abi:"x"`
+	Ok    bool
+}
+
+type member struct {
+	Id    uint64
+	Owner common.Address
+}
+
+type record struct {
+	Name string
+	Meta struct {
+		Data []byte
+		Tags []string
+	}
+	Groups [][]member
+}
+
+var (
+	testAddr1 = common.HexToAddress("0x2c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e")
+	testAddr2 = common.HexToAddress("0x0b1d7f9cbd6f7a8e4e5a9f1d0c3e6b2a4d8f9e10")
+)
+
+func bigs(ns ...int64) []*big.Int {
+	out := make([]*big.Int, len(ns))
+	for i, n := range ns {
+		out[i] = big.NewInt(n)
+	}
+	return out
+}
+
+func testRecord() *record {
+	r := new(record)
+	r.Name = "fisco"
+	r.Meta.Data = common.FromHex("0xdeadbeef")
+	r.Meta.Tags = []string{"a", "bc"}
+	r.Groups = [][]member{{{1, testAddr1}}, {}, {{2, testAddr2}, {3, testAddr1}}}
+	return r
+}
+
+// tupleTests are packed with the methods of tupleABI, then unpacked into a
+// value of the type of out, which must equal out. The encodings were computed
+// independently of this package.
+var tupleTests = []struct {
+	method string
+	args   []interface{}
+	out    interface{}
+	enc    string
+}{
+	{
+		method: "f",
+		args:   []interface{}{big.NewInt(0x123), []uint32{0x456, 0x789}, [10]byte{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0'}, []byte("Hello, world!")},
+		out: &struct {
+			A *big.Int
+			B []uint32
+			C [10]byte
+			D []byte
+		}{big.NewInt(0x123), []uint32{0x456, 0x789}, [10]byte{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0'}, []byte("Hello, world!")},
+		enc: "0x8be65246" +
+			"0000000000000000000000000000000000000000000000000000000000000123" +
+			"0000000000000000000000000000000000000000000000000000000000000080" +
+			"3132333435363738393000000000000000000000000000000000000000000000" +
+			"00000000000000000000000000000000000000000000000000000000000000e0" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000456" +
+			"0000000000000000000000000000000000000000000000000000000000000789" +
+			"000000000000000000000000000000000000000000000000000000000000000d" +
+			"48656c6c6f2c20776f726c642100000000000000000000000000000000000000",
+	},
+	{
+		method: "g",
+		args:   []interface{}{[][]*big.Int{bigs(1, 2), bigs(3)}, []string{"one", "two", "three"}},
+		out: &struct {
+			A [][]*big.Int
+			B []string
+		}{[][]*big.Int{bigs(1, 2), bigs(3)}, []string{"one", "two", "three"}},
+		enc: "0x2289b18c" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"0000000000000000000000000000000000000000000000000000000000000140" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"00000000000000000000000000000000000000000000000000000000000000a0" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000000000000000000000000000000000000000000060" +
+			"00000000000000000000000000000000000000000000000000000000000000a0" +
+			"00000000000000000000000000000000000000000000000000000000000000e0" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"6f6e650000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"74776f0000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000005" +
+			"7468726565000000000000000000000000000000000000000000000000000000",
+	},
+	{
+		method: "tuple",
+		args: []interface{}{
+			specStruct{big.NewInt(1), bigs(2, 3), []point{{big.NewInt(4), big.NewInt(5)}, {big.NewInt(6), big.NewInt(7)}}},
+			point{big.NewInt(8), big.NewInt(9)},
+			big.NewInt(10),
+		},
+		out: &struct {
+			S specStruct
+			T point
+			A *big.Int
+		}{
+			specStruct{big.NewInt(1), bigs(2, 3), []point{{big.NewInt(4), big.NewInt(5)}, {big.NewInt(6), big.NewInt(7)}}},
+			point{big.NewInt(8), big.NewInt(9)},
+			big.NewInt(10),
+		},
+		enc: "0xfde6bc13" +
+			"0000000000000000000000000000000000000000000000000000000000000080" +
+			"0000000000000000000000000000000000000000000000000000000000000008" +
+			"0000000000000000000000000000000000000000000000000000000000000009" +
+			"000000000000000000000000000000000000000000000000000000000000000a" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000060" +
+			"00000000000000000000000000000000000000000000000000000000000000c0" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000004" +
+			"0000000000000000000000000000000000000000000000000000000000000005" +
+			"0000000000000000000000000000000000000000000000000000000000000006" +
+			"0000000000000000000000000000000000000000000000000000000000000007",
+	},
+	{
+		// Static tuples are encoded in place, so the array takes four words.
+		method: "pairs",
+		args:   []interface{}{[2]pair{{big.NewInt(1), true}, {big.NewInt(2), false}}, big.NewInt(3)},
+		out: &struct {
+			Pairs [2]pair
+			Tail  *big.Int
+		}{[2]pair{{big.NewInt(1), true}, {big.NewInt(2), false}}, big.NewInt(3)},
+		enc: "0x1ca601ad" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000003",
+	},
+	{
+		method: "record",
+		args:   []interface{}{testRecord()},
+		out:    testRecord(),
+		enc: "0xac8232cd" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000060" +
+			"00000000000000000000000000000000000000000000000000000000000000a0" +
+			"0000000000000000000000000000000000000000000000000000000000000200" +
+			"0000000000000000000000000000000000000000000000000000000000000005" +
+			"666973636f000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"0000000000000000000000000000000000000000000000000000000000000080" +
+			"0000000000000000000000000000000000000000000000000000000000000004" +
+			"deadbeef00000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"0000000000000000000000000000000000000000000000000000000000000080" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"6100000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"6263000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000000000000000000000000000000000000000000060" +
+			"00000000000000000000000000000000000000000000000000000000000000c0" +
+			"00000000000000000000000000000000000000000000000000000000000000e0" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000002c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000b1d7f9cbd6f7a8e4e5a9f1d0c3e6b2a4d8f9e10" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000002c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e",
+	},
+}
+
+func TestTupleRoundTrip(t *testing.T) {
+	parsed, err := JSON(bytes.NewReader([]byte(tupleABI)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tupleTests {
+		packed, err := parsed.Pack(test.method, test.args...)
+		if err != nil {
+			t.Errorf("%s: pack: %v", test.method, err)
+			continue
+		}
+		if want := common.FromHex(test.enc); !bytes.Equal(packed, want) {
+			t.Errorf("%s: packed\n%x\nwant\n%x", test.method, packed, want)
+			continue
+		}
+		out := reflect.New(reflect.TypeOf(test.out).Elem())
+		if err := parsed.Unpack(out.Interface(), test.method, packed[4:]); err != nil {
+			t.Errorf("%s: unpack: %v", test.method, err)
+			continue
+		}
+		if !reflect.DeepEqual(out.Interface(), test.out) {
+			t.Errorf("%s: unpacked %+v, want %+v", test.method, out.Elem().Interface(), reflect.ValueOf(test.out).Elem().Interface())
+		}
+	}
+}
+
+// Registry in testdata/registry_solc06.abi is the ABI of the following contract,
+// in the format of solc 0.6 with ABIEncoderV2:
+//
+//	struct Entry { string key; address owner; uint256[] values; }
+//	struct Page { Entry[] entries; uint256 total; }
+//	event Registered(address indexed owner, Entry entry);
+//	function get(string calldata key) external view returns (Entry memory);
+//	function list(uint256 offset, uint256 limit) external view returns (Page memory page);
+//	function put(Entry calldata entry) external;
+type entry struct {
+	Key    string
+	Owner  common.Address
+	Values []*big.Int
+}
+
+const (
+	registryGetOutput = "" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000002c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"616c696365000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000003"
+	registryListOutput = "" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000007" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000160" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000002c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"616c696365000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000b1d7f9cbd6f7a8e4e5a9f1d0c3e6b2a4d8f9e10" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"626f620000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000"
+	registryRegisteredData = "" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000b1d7f9cbd6f7a8e4e5a9f1d0c3e6b2a4d8f9e10" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"626f620000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000"
+	registryPutInput = "0xcaeab551" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000002c8a9f1b1ed3b2b4d1a1b7f5b6a1e4d2f27a1c3e" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"616c696365000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000003"
+)
+
+func TestTupleSolc06(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "registry_solc06.abi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := JSON(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Methods["get"].Const || !parsed.Methods["list"].Const || parsed.Methods["put"].Const {
+		t.Errorf("view methods not constant: %+v", parsed.Methods)
+	}
+	if sig := parsed.Methods["put"].Sig(); sig != "put((string,address,uint256[]))" {
+		t.Errorf("put signature %s", sig)
+	}
+	if id := parsed.Events["Registered"].Id().Hex(); id != "0xf34b29bd7d497100601a2cc0957fa174a6c97563b727596b91d258e9cbb07726" {
+		t.Errorf("Registered id %s", id)
+	}
+
+	alice := entry{"alice", testAddr1, bigs(1, 2, 3)}
+	bob := entry{"bob", testAddr2, []*big.Int{}}
+
+	var got entry
+	if err := parsed.Unpack(&got, "get", common.FromHex(registryGetOutput)); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !reflect.DeepEqual(got, alice) {
+		t.Errorf("get: %+v, want %+v", got, alice)
+	}
+
+	var page struct {
+		Entries []entry
+		Total   *big.Int
+	}
+	if err := parsed.Unpack(&page, "list", common.FromHex(registryListOutput)); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.Entries) != 2 || !reflect.DeepEqual(page.Entries[0], alice) || !reflect.DeepEqual(page.Entries[1], bob) || page.Total.Int64() != 7 {
+		t.Errorf("list: %+v", page)
+	}
+
+	var event struct{ Entry entry }
+	if err := parsed.Unpack(&event, "Registered", common.FromHex(registryRegisteredData)); err != nil {
+		t.Fatalf("Registered: %v", err)
+	}
+	if !reflect.DeepEqual(event.Entry, bob) {
+		t.Errorf("Registered: %+v, want %+v", event.Entry, bob)
+	}
+
+	packed, err := parsed.Pack("put", alice)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if want := common.FromHex(registryPutInput); !bytes.Equal(packed, want) {
+		t.Errorf("put: packed\n%x\nwant\n%x", packed, want)
+	}
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/chislab/go-fiscobcos/common"
 	"github.com/chislab/go-fiscobcos/core/types"
 	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
 	"github.com/chislab/go-fiscobcos/event"
 )
 
@@ -269,7 +270,8 @@ func (ks *KeyStore) SignHash(a accounts.Account, hash []byte) ([]byte, error) {
 	return crypto.Sign(hash, unlockedKey.PrivateKey)
 }
 
-// SignTx signs the given transaction with the requested account.
+// SignTx signs the given transaction with the requested account. The chain id
+// is signed as part of the transaction, chainID is ignored.
 func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
 	// Look up the key to sign with and abort if it cannot be found
 	ks.mu.RLock()
@@ -279,11 +281,7 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *b
 	if !found {
 		return nil, ErrLocked
 	}
-	// Depending on the presence of the chain ID, sign with EIP155 or homestead
-	if chainID != nil {
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), unlockedKey.PrivateKey)
-	}
-	return types.SignTx(tx, types.HomesteadSigner{}, unlockedKey.PrivateKey)
+	return types.SignTx(tx, txSigner(unlockedKey.PrivateKey), unlockedKey.PrivateKey)
 }
 
 // SignHashWithPassphrase signs hash if the private key matching the given address
@@ -299,7 +297,8 @@ func (ks *KeyStore) SignHashWithPassphrase(a accounts.Account, passphrase string
 }
 
 // SignTxWithPassphrase signs the transaction if the private key matching the
-// given address can be decrypted with the given passphrase.
+// given address can be decrypted with the given passphrase. Like SignTx, it
+// ignores chainID.
 func (ks *KeyStore) SignTxWithPassphrase(a accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
 	_, key, err := ks.getDecryptedKey(a, passphrase)
 	if err != nil {
@@ -307,11 +306,17 @@ func (ks *KeyStore) SignTxWithPassphrase(a accounts.Account, passphrase string,
 	}
 	defer zeroKey(key.PrivateKey)
 
-	// Depending on the presence of the chain ID, sign with EIP155 or homestead
-	if chainID != nil {
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key.PrivateKey)
+	return types.SignTx(tx, txSigner(key.PrivateKey), key.PrivateKey)
+}
+
+// txSigner returns the signer of the transactions signed with key. Nodes verify
+// the FISCO BCOS signature layout, or the guomi one for SM2 keys, never EIP155:
+// the chain id is a field of the transaction.
+func txSigner(key *ecdsa.PrivateKey) types.Signer {
+	if gm.IsSM2(&key.PublicKey) {
+		return types.NewChainSigner(types.ChainModeGM)
 	}
-	return types.SignTx(tx, types.HomesteadSigner{}, key.PrivateKey)
+	return types.NewChainSigner(types.ChainModeStandard)
 }
 
 // Unlock unlocks the given account indefinitely.
@@ -0,0 +1,66 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+// TestSignTxSigner checks that the keystore signs with the FISCO BCOS signer
+// whether or not a chain id is given.
+func TestSignTxSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ks := NewKeyStore(dir, LightScryptN, LightScryptP)
+
+	key, _ := crypto.GenerateKey()
+	account, err := ks.ImportECDSA(key, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(account, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTransaction(big.NewInt(1), common.Address{1}, new(big.Int), 30000000, new(big.Int), nil, big.NewInt(600), big.NewInt(1), big.NewInt(1), nil)
+
+	for _, chainID := range []*big.Int{nil, big.NewInt(1), big.NewInt(7)} {
+		signed, err := ks.SignTx(account, tx, chainID)
+		if err != nil {
+			t.Fatalf("SignTx(chain %v) error: %v", chainID, err)
+		}
+		if from, err := types.Sender(types.FiscoSigner{}, signed); err != nil || from != account.Address {
+			t.Errorf("SignTx(chain %v): recovered %x (%v), want %x", chainID, from, err, account.Address)
+		}
+		signed, err = ks.SignTxWithPassphrase(account, "pass", tx, chainID)
+		if err != nil {
+			t.Fatalf("SignTxWithPassphrase(chain %v) error: %v", chainID, err)
+		}
+		if from, err := types.Sender(types.FiscoSigner{}, signed); err != nil || from != account.Address {
+			t.Errorf("SignTxWithPassphrase(chain %v): recovered %x (%v), want %x", chainID, from, err, account.Address)
+		}
+	}
+}
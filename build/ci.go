@@ -302,6 +302,7 @@ func goToolArch(arch string, cc string, subcmd string, args ...string) *exec.Cmd
 
 func doTest(cmdline []string) {
 	coverage := flag.Bool("coverage", false, "Whether to record code coverage")
+	race := flag.Bool("race", false, "Whether to run the tests with the race detector")
 	flag.CommandLine.Parse(cmdline)
 	env := build.Env()
 
@@ -319,6 +320,9 @@ func doTest(cmdline []string) {
 	if *coverage {
 		gotest.Args = append(gotest.Args, "-covermode=atomic", "-cover")
 	}
+	if *race {
+		gotest.Args = append(gotest.Args, "-race")
+	}
 
 	gotest.Args = append(gotest.Args, packages...)
 	build.MustRun(gotest)
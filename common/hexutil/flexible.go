@@ -0,0 +1,193 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package hexutil
+
+import (
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Errors of the flexible decoders, which also report ErrEmptyString,
+// ErrEmptyNumber, ErrSyntax, ErrUint64Range and ErrBig256Range.
+var (
+	ErrNumberSyntax   = &decError{"invalid decimal number"}
+	ErrNegativeNumber = &decError{"negative number"}
+)
+
+var (
+	flexibleBigT    = reflect.TypeOf((*FlexibleBig)(nil))
+	flexibleUint64T = reflect.TypeOf(FlexibleUint64(0))
+)
+
+// DecodeFlexibleUint64 decodes a quantity encoded as hex string with 0x prefix,
+// as in Ethereum, or as decimal string, as FISCO BCOS nodes report some numbers.
+// Unlike DecodeUint64 it accepts hex numbers with leading zero digits.
+func DecodeFlexibleUint64(input string) (uint64, error) {
+	digits, base, err := checkFlexibleNumber(input)
+	if err != nil {
+		return 0, err
+	}
+	dec, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, mapFlexibleError(err, base)
+	}
+	return dec, nil
+}
+
+// DecodeFlexibleBig decodes a quantity of up to 256 bits encoded as hex string
+// with 0x prefix or as decimal string, see DecodeFlexibleUint64.
+func DecodeFlexibleBig(input string) (*big.Int, error) {
+	digits, base, err := checkFlexibleNumber(input)
+	if err != nil {
+		return nil, err
+	}
+	dec, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		if base == 16 {
+			return nil, ErrSyntax
+		}
+		return nil, ErrNumberSyntax
+	}
+	if dec.BitLen() > 256 {
+		return nil, ErrBig256Range
+	}
+	return dec, nil
+}
+
+// checkFlexibleNumber returns the digits of a hex or decimal number and their
+// base.
+func checkFlexibleNumber(input string) (digits string, base int, err error) {
+	input = strings.TrimSpace(input)
+	if len(input) == 0 {
+		return "", 0, ErrEmptyString
+	}
+	if input[0] == '-' {
+		return "", 0, ErrNegativeNumber
+	}
+	digits, base = input, 10
+	if has0xPrefix(input) {
+		digits, base = input[2:], 16
+	}
+	switch {
+	case len(digits) == 0:
+		return "", 0, ErrEmptyNumber
+	case digits[0] == '+' || digits[0] == '-':
+		// Signs are accepted by the parsers, but not part of the encodings.
+		if base == 16 {
+			return "", 0, ErrSyntax
+		}
+		return "", 0, ErrNumberSyntax
+	}
+	return digits, base, nil
+}
+
+func mapFlexibleError(err error, base int) error {
+	if err, ok := err.(*strconv.NumError); ok && err.Err == strconv.ErrRange {
+		return ErrUint64Range
+	}
+	if base == 16 {
+		return ErrSyntax
+	}
+	return ErrNumberSyntax
+}
+
+// FlexibleUint64 unmarshals a quantity sent as hex string with 0x prefix, as
+// decimal string or as JSON number, see DecodeFlexibleUint64. It marshals as hex
+// string like Uint64.
+type FlexibleUint64 uint64
+
+// MarshalText implements encoding.TextMarshaler.
+func (b FlexibleUint64) MarshalText() ([]byte, error) {
+	return Uint64(b).MarshalText()
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *FlexibleUint64) UnmarshalJSON(input []byte) error {
+	text, ok := flexibleText(input)
+	if !ok {
+		return nil
+	}
+	return wrapTypeError(b.UnmarshalText(text), flexibleUint64T)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *FlexibleUint64) UnmarshalText(input []byte) error {
+	dec, err := DecodeFlexibleUint64(string(input))
+	if err != nil {
+		return err
+	}
+	*b = FlexibleUint64(dec)
+	return nil
+}
+
+// String returns the hex encoding of b.
+func (b FlexibleUint64) String() string {
+	return EncodeUint64(uint64(b))
+}
+
+// FlexibleBig unmarshals a quantity of up to 256 bits sent as hex string with 0x
+// prefix, as decimal string or as JSON number, see DecodeFlexibleBig. It
+// marshals as hex string like Big.
+type FlexibleBig big.Int
+
+// MarshalText implements encoding.TextMarshaler.
+func (b FlexibleBig) MarshalText() ([]byte, error) {
+	return []byte(EncodeBig((*big.Int)(&b))), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *FlexibleBig) UnmarshalJSON(input []byte) error {
+	text, ok := flexibleText(input)
+	if !ok {
+		return nil
+	}
+	return wrapTypeError(b.UnmarshalText(text), flexibleBigT)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *FlexibleBig) UnmarshalText(input []byte) error {
+	dec, err := DecodeFlexibleBig(string(input))
+	if err != nil {
+		return err
+	}
+	*b = FlexibleBig(*dec)
+	return nil
+}
+
+// ToInt converts b to a big.Int.
+func (b *FlexibleBig) ToInt() *big.Int {
+	return (*big.Int)(b)
+}
+
+// String returns the hex encoding of b.
+func (b *FlexibleBig) String() string {
+	return EncodeBig(b.ToInt())
+}
+
+// flexibleText returns the text of a JSON string or number. It reports false
+// for null, which leaves the value unchanged.
+func flexibleText(input []byte) ([]byte, bool) {
+	if isString(input) {
+		return input[1 : len(input)-1], true
+	}
+	if string(input) == "null" {
+		return nil, false
+	}
+	return input, true
+}
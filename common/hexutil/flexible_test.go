@@ -0,0 +1,171 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package hexutil
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func mustBig(s string) *big.Int {
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		panic("invalid big integer " + s)
+	}
+	return b
+}
+
+var decodeFlexibleUint64Tests = []struct {
+	input   string
+	want    uint64
+	wantErr error
+}{
+	// hex
+	{input: "0x0", want: 0},
+	{input: "0x12", want: 0x12},
+	{input: "0X12", want: 0x12},
+	{input: "0x0012", want: 0x12},
+	{input: "0xffffffffffffffff", want: 0xffffffffffffffff},
+	{input: "0x10000000000000000", wantErr: ErrUint64Range},
+	{input: "0x", wantErr: ErrEmptyNumber},
+	{input: "0xg1", wantErr: ErrSyntax},
+	{input: "0x-1", wantErr: ErrSyntax},
+	// decimal
+	{input: "0", want: 0},
+	{input: "120", want: 120},
+	{input: "007", want: 7},
+	{input: " 120 ", want: 120},
+	{input: "18446744073709551615", want: 18446744073709551615},
+	{input: "18446744073709551616", wantErr: ErrUint64Range},
+	{input: "12a", wantErr: ErrNumberSyntax},
+	{input: "1.5", wantErr: ErrNumberSyntax},
+	{input: "+1", wantErr: ErrNumberSyntax},
+	// negative and empty
+	{input: "-1", wantErr: ErrNegativeNumber},
+	{input: "-0x1", wantErr: ErrNegativeNumber},
+	{input: "", wantErr: ErrEmptyString},
+	{input: "  ", wantErr: ErrEmptyString},
+}
+
+func TestDecodeFlexibleUint64(t *testing.T) {
+	for _, test := range decodeFlexibleUint64Tests {
+		dec, err := DecodeFlexibleUint64(test.input)
+		if err != test.wantErr || dec != test.want {
+			t.Errorf("input %q: got %d, %v, want %d, %v", test.input, dec, err, test.want, test.wantErr)
+		}
+	}
+}
+
+var decodeFlexibleBigTests = []struct {
+	input   string
+	want    *big.Int
+	wantErr error
+}{
+	{input: "0x0", want: big.NewInt(0)},
+	{input: "0x10000000000000000", want: mustBig("0x10000000000000000")},
+	{input: "0x" + "ff00000000000000000000000000000000000000000000000000000000000000", want: mustBig("0xff00000000000000000000000000000000000000000000000000000000000000")},
+	{input: "0x1" + "0000000000000000000000000000000000000000000000000000000000000000", wantErr: ErrBig256Range},
+	{input: "0x", wantErr: ErrEmptyNumber},
+	{input: "0xx", wantErr: ErrSyntax},
+	{input: "120", want: big.NewInt(120)},
+	{input: "18446744073709551616", want: mustBig("18446744073709551616")},
+	{input: "115792089237316195423570985008687907853269984665640564039457584007913129639935", want: mustBig("0x" + "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+	{input: "115792089237316195423570985008687907853269984665640564039457584007913129639936", wantErr: ErrBig256Range},
+	{input: "1e3", wantErr: ErrNumberSyntax},
+	{input: "-5", wantErr: ErrNegativeNumber},
+	{input: "", wantErr: ErrEmptyString},
+}
+
+func TestDecodeFlexibleBig(t *testing.T) {
+	for _, test := range decodeFlexibleBigTests {
+		dec, err := DecodeFlexibleBig(test.input)
+		if err != test.wantErr {
+			t.Errorf("input %q: got error %v, want %v", test.input, err, test.wantErr)
+			continue
+		}
+		if test.want != nil && (dec == nil || dec.Cmp(test.want) != 0) {
+			t.Errorf("input %q: got %v, want %v", test.input, dec, test.want)
+		}
+	}
+}
+
+var unmarshalFlexibleUint64Tests = []struct {
+	input   string
+	want    uint64
+	wantErr bool
+}{
+	{input: `"0x78"`, want: 120},
+	{input: `"120"`, want: 120},
+	{input: `120`, want: 120},
+	{input: `null`, want: 7}, // left unchanged
+	{input: `"-1"`, wantErr: true},
+	{input: `-1`, wantErr: true},
+	{input: `"18446744073709551616"`, wantErr: true},
+	{input: `1.5`, wantErr: true},
+	{input: `true`, wantErr: true},
+}
+
+func TestUnmarshalFlexibleUint64(t *testing.T) {
+	for _, test := range unmarshalFlexibleUint64Tests {
+		v := FlexibleUint64(7)
+		err := json.Unmarshal([]byte(test.input), &v)
+		if (err != nil) != test.wantErr || !test.wantErr && uint64(v) != test.want {
+			t.Errorf("input %s: got %d, %v, want %d, error %t", test.input, v, err, test.want, test.wantErr)
+		}
+		if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+			t.Errorf("input %s: error %T, want *json.UnmarshalTypeError", test.input, err)
+		}
+	}
+}
+
+var unmarshalFlexibleBigTests = []struct {
+	input   string
+	want    *big.Int
+	wantErr bool
+}{
+	{input: `"0x78"`, want: big.NewInt(120)},
+	{input: `"18446744073709551616"`, want: mustBig("18446744073709551616")},
+	{input: `18446744073709551616`, want: mustBig("18446744073709551616")},
+	{input: `null`, want: big.NewInt(7)}, // left unchanged
+	{input: `"-1"`, wantErr: true},
+	{input: `"0x1` + "0000000000000000000000000000000000000000000000000000000000000000" + `"`, wantErr: true},
+	{input: `1.5`, wantErr: true},
+}
+
+func TestUnmarshalFlexibleBig(t *testing.T) {
+	for _, test := range unmarshalFlexibleBigTests {
+		v := (*FlexibleBig)(big.NewInt(7))
+		err := json.Unmarshal([]byte(test.input), v)
+		if (err != nil) != test.wantErr || !test.wantErr && v.ToInt().Cmp(test.want) != 0 {
+			t.Errorf("input %s: got %v, %v, want %v, error %t", test.input, v, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestMarshalFlexible(t *testing.T) {
+	out, err := json.Marshal(struct {
+		U FlexibleUint64
+		B *FlexibleBig
+	}{120, (*FlexibleBig)(big.NewInt(120))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"U":"0x78","B":"0x78"}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package registry keeps an address book of deployed contracts in a JSON file,
+// for chains without CNS. Contracts are recorded under logical names and can be
+// exported in the format of CNS records to move them on chain later.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/cns"
+)
+
+// ErrNotRegistered is returned if no contract is registered under a name. It's
+// the same error as bind.ErrNotRegistered.
+var ErrNotRegistered = bind.ErrNotRegistered
+
+// ErrConflict is returned if a name is registered already for a contract at
+// another address or in another group.
+var ErrConflict = errors.New("contract name registered already")
+
+// ConflictError is returned by Register if the name of the contract is taken
+// by another one. It matches ErrConflict.
+type ConflictError struct {
+	Name     string
+	Existing Entry // the contract registered under the name
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("contract %s registered already at %s in group %d", e.Name, e.Existing.Address.Hex(), e.Existing.GroupId)
+}
+
+// Unwrap returns ErrConflict.
+func (e *ConflictError) Unwrap() error { return ErrConflict }
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool { return target == ErrConflict }
+
+// Entry is a contract recorded in the registry.
+type Entry struct {
+	Name    string         `json:"name"`
+	GroupId int            `json:"groupId"`
+	Address common.Address `json:"address"`
+	ABI     string         `json:"abi"`
+	TxHash  common.Hash    `json:"txHash"` // hash of the deploying transaction
+}
+
+// Store is a registry kept in a JSON file. It's safe for concurrent use, but
+// not by several processes sharing the file.
+type Store struct {
+	path string
+
+	lock    sync.RWMutex
+	entries map[string]Entry // by name
+}
+
+// The store resolves contracts bound with bind.NewBoundContractFromRegistry.
+var _ bind.ContractRegistry = (*Store)(nil)
+
+// Load opens the registry kept in the file at path. A missing file is an empty
+// registry, it's created by the first Save.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]Entry)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid contract registry %s: %v", path, err)
+	}
+	for _, entry := range entries {
+		if err := validName(entry.Name); err != nil {
+			return nil, fmt.Errorf("invalid contract registry %s: %v", path, err)
+		}
+		if _, ok := s.entries[entry.Name]; ok {
+			return nil, fmt.Errorf("invalid contract registry %s: contract %s listed twice", path, entry.Name)
+		}
+		s.entries[entry.Name] = entry
+	}
+	return s, nil
+}
+
+// Save writes the registry to its file. Contracts are listed by name, so the
+// file only changes with its contents. The file is replaced atomically, it's
+// never left half written.
+func (s *Store) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Register records a contract under its name. Registering a contract again
+// updates its ABI and transaction hash. It fails with *ConflictError if the name
+// is taken by a contract at another address or in another group. Changes are
+// kept in memory until Save.
+func (s *Store) Register(entry Entry) error {
+	if err := validName(entry.Name); err != nil {
+		return err
+	}
+	if entry.Address == (common.Address{}) {
+		return fmt.Errorf("contract %s has no address", entry.Name)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if existing, ok := s.entries[entry.Name]; ok {
+		if existing.Address != entry.Address || existing.GroupId != entry.GroupId {
+			return &ConflictError{Name: entry.Name, Existing: existing}
+		}
+	}
+	s.entries[entry.Name] = entry
+	return nil
+}
+
+// Resolve returns the contract registered under name. It fails with
+// ErrNotRegistered if there is none.
+func (s *Store) Resolve(name string) (Entry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entry, ok := s.entries[name]
+	if !ok {
+		return Entry{}, ErrNotRegistered
+	}
+	return entry, nil
+}
+
+// Lookup returns the group, address and ABI of the contract registered under
+// name, see bind.ContractRegistry.
+func (s *Store) Lookup(name string) (int, common.Address, string, error) {
+	entry, err := s.Resolve(name)
+	if err != nil {
+		return 0, common.Address{}, "", err
+	}
+	return entry.GroupId, entry.Address, entry.ABI, nil
+}
+
+// Entries returns all registered contracts, ordered by name.
+func (s *Store) Entries() []Entry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sorted()
+}
+
+// cnsRecord is a contract in the format the CNS contract and the console
+// report registrations in.
+type cnsRecord struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Address string `json:"address"`
+	ABI     string `json:"abi"`
+}
+
+// ExportCNS returns the contracts of a group as CNS records under version, a
+// JSON array as reported by the console's queryCNS. The records decode into
+// cns.Info, so each can be registered on chain with cns.Service.Register.
+func (s *Store) ExportCNS(groupId int, version string) ([]byte, error) {
+	if version == "" {
+		return nil, errors.New("contract version must not be empty")
+	}
+	if len(version) > cns.MaxVersionLength {
+		return nil, precompiled.ErrVersionTooLong
+	}
+	if strings.Contains(version, ":") {
+		return nil, errors.New("contract version must not contain ':'")
+	}
+	records := []cnsRecord{}
+	for _, entry := range s.Entries() {
+		if entry.GroupId != groupId {
+			continue
+		}
+		records = append(records, cnsRecord{
+			Name:    entry.Name,
+			Version: version,
+			Address: entry.Address.Hex(),
+			ABI:     entry.ABI,
+		})
+	}
+	return json.MarshalIndent(records, "", "  ")
+}
+
+// sorted returns the entries ordered by name. The lock must be held.
+func (s *Store) sorted() []Entry {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// validName checks a contract name can be registered in CNS too.
+func validName(name string) error {
+	if name == "" {
+		return errors.New("contract name must not be empty")
+	}
+	// CNS separates the name and version by a colon.
+	if strings.Contains(name, ":") {
+		return errors.New("contract name must not contain ':'")
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package registry_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind/backends"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/contracts/registry"
+	"github.com/chislab/go-fiscobcos/core/vm"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/cns"
+)
+
+const answerABI = `[{"constant":true,"inputs":[],"name":"get","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// answerCode is the deployment code of a contract answering every call with 42.
+var answerCode = func() []byte {
+	code := []byte{byte(vm.PUSH1), 42, byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN)}
+	deploy := []byte{byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 12, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 0, byte(vm.RETURN)}
+	return append(deploy, code...)
+}()
+
+func tempPath(t *testing.T) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "registry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "contracts.json"), func() { os.RemoveAll(dir) }
+}
+
+// TestRegistryBinding registers a contract deployed to a simulated chain, saves
+// and reloads the registry, and calls the contract bound from it.
+func TestRegistryBinding(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	backend := backends.NewSimulatedBackend(1, 2)
+	defer backend.Close()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := bind.NewKeyedTransactor(key)
+	opts.GroupId = 2
+	parsed, err := abi.JSON(strings.NewReader(answerABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, tx, _, err := bind.DeployContract(opts, parsed, answerCode, backend)
+	if err != nil {
+		t.Fatalf("can't deploy the contract: %v", err)
+	}
+
+	store, err := registry.Load(path)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	entry := registry.Entry{Name: "Answer", GroupId: 2, Address: address, ABI: answerABI, TxHash: tx.Hash()}
+	if err := store.Register(entry); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if store, err = registry.Load(path); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if got, err := store.Resolve("Answer"); err != nil || got != entry {
+		t.Fatalf("Resolve: got %+v, error %v, want %+v", got, err, entry)
+	}
+
+	contract, groupId, err := bind.NewBoundContractFromRegistry("Answer", backend, store)
+	if err != nil {
+		t.Fatalf("NewBoundContractFromRegistry error: %v", err)
+	}
+	if groupId != 2 {
+		t.Errorf("got group %d, want 2", groupId)
+	}
+	var value *big.Int
+	if err := contract.Call(&bind.CallOpts{GroupId: groupId}, &value, "get"); err != nil {
+		t.Fatalf("get error: %v", err)
+	}
+	if value.Int64() != 42 {
+		t.Errorf("contract answered %v, want 42", value)
+	}
+
+	_, _, err = bind.NewBoundContractFromRegistry("Question", backend, store)
+	if nerr, ok := err.(*bind.NotRegisteredError); !ok || nerr.Name != "Question" {
+		t.Errorf("binding an unregistered contract: got error %v, want *bind.NotRegisteredError", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	store, err := registry.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := registry.Entry{Name: "Token", GroupId: 1, Address: common.Address{1}, ABI: "[]"}
+	if err := store.Register(first); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		entry    registry.Entry
+		conflict bool   // whether it fails with *ConflictError
+		err      string // other error, if any
+	}{
+		{"same contract, new ABI", registry.Entry{Name: "Token", GroupId: 1, Address: common.Address{1}, ABI: `[{"type":"fallback"}]`}, false, ""},
+		{"other address", registry.Entry{Name: "Token", GroupId: 1, Address: common.Address{2}}, true, ""},
+		{"other group", registry.Entry{Name: "Token", GroupId: 2, Address: common.Address{1}}, true, ""},
+		{"other name", registry.Entry{Name: "Token2", GroupId: 2, Address: common.Address{1}}, false, ""},
+		{"empty name", registry.Entry{Address: common.Address{1}}, false, "must not be empty"},
+		{"colon in name", registry.Entry{Name: "Token:1", Address: common.Address{1}}, false, "must not contain ':'"},
+		{"no address", registry.Entry{Name: "Empty"}, false, "has no address"},
+	}
+	for _, test := range tests {
+		err := store.Register(test.entry)
+		switch {
+		case test.conflict:
+			cerr, ok := err.(*registry.ConflictError)
+			if !ok {
+				t.Errorf("%s: got error %v, want *ConflictError", test.name, err)
+				continue
+			}
+			if cerr.Name != "Token" || cerr.Existing.Address != first.Address || !cerr.Is(registry.ErrConflict) {
+				t.Errorf("%s: got conflict %+v", test.name, cerr)
+			}
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%s: Register error: %v", test.name, err)
+		}
+	}
+
+	var names []string
+	for _, entry := range store.Entries() {
+		names = append(names, entry.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Token", "Token2"}) {
+		t.Errorf("got entries %v, want [Token Token2]", names)
+	}
+	if entry, _ := store.Resolve("Token"); entry.ABI != `[{"type":"fallback"}]` {
+		t.Errorf("registering again kept ABI %s", entry.ABI)
+	}
+	if _, err := store.Resolve("Empty"); err != registry.ErrNotRegistered {
+		t.Errorf("resolving a rejected contract: got error %v, want ErrNotRegistered", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	tests := []struct {
+		name string
+		file string
+		want string // part of the error
+	}{
+		{"not json", `{"name":`, "invalid contract registry"},
+		{"not a list", `{"name":"Token"}`, "invalid contract registry"},
+		{"empty name", `[{"name":"","address":"0x0100000000000000000000000000000000000000"}]`, "must not be empty"},
+		{"colon in name", `[{"name":"a:b","address":"0x0100000000000000000000000000000000000000"}]`, "must not contain ':'"},
+		{"listed twice", `[{"name":"Token"},{"name":"Token"}]`, "listed twice"},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(test.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := registry.Load(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestExportCNS(t *testing.T) {
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	store, err := registry.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []registry.Entry{
+		{Name: "Vault", GroupId: 1, Address: common.Address{2}, ABI: "[]"},
+		{Name: "Token", GroupId: 1, Address: common.Address{1}, ABI: answerABI},
+		{Name: "Other", GroupId: 2, Address: common.Address{3}, ABI: "[]"},
+	} {
+		if err := store.Register(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := store.ExportCNS(1, "1.0")
+	if err != nil {
+		t.Fatalf("ExportCNS error: %v", err)
+	}
+	var records []cns.Info
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("records don't decode into cns.Info: %v", err)
+	}
+	want := []cns.Info{
+		{Name: "Token", Version: "1.0", Address: common.Address{1}, ABI: answerABI},
+		{Name: "Vault", Version: "1.0", Address: common.Address{2}, ABI: "[]"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got records %+v, want %+v", records, want)
+	}
+	if data, err := store.ExportCNS(3, "1.0"); err != nil || string(data) != "[]" {
+		t.Errorf("exporting an empty group: got %s, error %v, want []", data, err)
+	}
+
+	for _, test := range []struct {
+		version string
+		want    string
+	}{
+		{"", "must not be empty"},
+		{"1:0", "must not contain ':'"},
+		{strings.Repeat("1", cns.MaxVersionLength+1), precompiled.ErrVersionTooLong.Error()},
+	} {
+		if _, err := store.ExportCNS(1, test.version); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("version %q: got error %v, want %q", test.version, err, test.want)
+		}
+	}
+}
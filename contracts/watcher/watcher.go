@@ -0,0 +1,402 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package watcher delivers the contract events matching a filter query to a
+// handler for as long as it runs. It resubscribes after failures and
+// reconnects, skips the logs the node replays, and resumes from a checkpoint
+// the caller can persist.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+const (
+	// defaultQueueSize is the number of logs waiting for the handler unless
+	// changed with WithQueue.
+	defaultQueueSize = 256
+
+	// retryDelay and maxRetryDelay bound the wait between failed attempts to
+	// resubscribe.
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+var errStarted = errors.New("watcher already started")
+
+// Backend is the client a watcher subscribes through, *ethclient.Client
+// implements it. If the backend also has an OnReconnect method like
+// ethclient.Client, the watcher resubscribes from its checkpoint after every
+// reconnect.
+type Backend interface {
+	SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error)
+}
+
+type reconnectNotifier interface {
+	OnReconnect(fn func()) (cancel func())
+}
+
+// Policy tells what a watcher does with new logs while its queue is full
+// because the handler falls behind.
+type Policy int
+
+const (
+	// Block stops receiving logs until the handler catches up. Meanwhile the
+	// node's pushes back up in the client.
+	Block Policy = iota
+	// Drop discards new logs, counting them in Dropped. The checkpoint moves
+	// past them, they aren't delivered after a restart either.
+	Drop
+)
+
+// Checkpoint is the position of the last log delivered to the handler. Logs
+// are delivered in order of block number, transaction index and log index.
+type Checkpoint struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	TxIndex     uint   `json:"txIndex"`
+	LogIndex    uint   `json:"logIndex"`
+}
+
+func position(log *types.Log) Checkpoint {
+	return Checkpoint{BlockNumber: log.BlockNumber, TxIndex: log.TxIndex, LogIndex: log.Index}
+}
+
+// IsZero reports whether c is the checkpoint of a watcher which hasn't
+// delivered a log yet.
+func (c Checkpoint) IsZero() bool { return c == Checkpoint{} }
+
+// before reports whether c precedes the position of log, i.e. whether log is
+// yet to be delivered.
+func (c Checkpoint) before(log *types.Log) bool {
+	switch {
+	case c.BlockNumber != log.BlockNumber:
+		return c.BlockNumber < log.BlockNumber
+	case c.TxIndex != log.TxIndex:
+		return c.TxIndex < log.TxIndex
+	}
+	return c.LogIndex < log.Index
+}
+
+// Option configures a watcher.
+type Option func(*Watcher)
+
+// WithQueue sets the number of logs held for a slow handler and what happens
+// to further logs, see Policy. The default is a queue of 256 logs with Block.
+func WithQueue(size int, policy Policy) Option {
+	return func(w *Watcher) {
+		if size > 0 {
+			w.queueSize = size
+		}
+		w.policy = policy
+	}
+}
+
+// Watcher delivers the logs matching a filter query to a handler, in order and
+// once each, see New.
+type Watcher struct {
+	backend   Backend
+	groupId   uint64
+	query     fiscobcos.FilterQuery
+	handler   func(types.Log)
+	queueSize int
+	policy    Policy
+
+	mu         sync.Mutex
+	checkpoint Checkpoint // last log handled
+	queued     Checkpoint // last log queued for the handler
+	dropped    uint64
+	started    bool
+
+	resubscribe chan struct{}
+	queue       chan types.Log
+	quit        chan struct{}
+	stopOnce    sync.Once
+	done        chan struct{}
+}
+
+// New creates a watcher of the logs matching q in a group, which calls handler
+// for each of them once started. The handler is called from a single goroutine
+// and the watcher's checkpoint moves past a log when the handler returns.
+//
+// The watcher subscribes through the client, see SubscribeFilterLogs. If the
+// subscription fails or the client reconnects, it subscribes again from the
+// block of the checkpoint, and logs up to the checkpoint are not delivered
+// again. Logs emitted while no subscription is established are recovered
+// like this only if the checkpoint or q sets the block to start from.
+func New(client Backend, groupId uint64, q fiscobcos.FilterQuery, handler func(types.Log), opts ...Option) *Watcher {
+	w := &Watcher{
+		backend:     client,
+		groupId:     groupId,
+		query:       q,
+		handler:     handler,
+		queueSize:   defaultQueueSize,
+		resubscribe: make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Checkpoint returns the position of the last log the handler returned from.
+// It's meant to be persisted and passed to SetCheckpoint after a restart.
+func (w *Watcher) Checkpoint() Checkpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpoint
+}
+
+// SetCheckpoint sets the position after which logs are delivered. If the
+// watcher runs already, it subscribes again from there.
+func (w *Watcher) SetCheckpoint(c Checkpoint) {
+	w.mu.Lock()
+	w.checkpoint, w.queued = c, c
+	started := w.started
+	w.mu.Unlock()
+
+	if started {
+		w.requestResubscribe()
+	}
+}
+
+// Dropped returns the number of logs discarded because the queue was full, see
+// Drop.
+func (w *Watcher) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Start subscribes and starts delivering logs. Failing to subscribe the first
+// time is returned, later failures are retried until the watcher is stopped.
+// The watcher stops when ctx is cancelled, when Stop is called, or after the
+// last log if q sets the block to end at. Closing the client stops it too.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	if w.started {
+		w.mu.Unlock()
+		return errStarted
+	}
+	w.started = true
+	w.mu.Unlock()
+
+	logs := make(chan types.Log)
+	sub, err := w.subscribe(ctx, logs)
+	if err != nil {
+		w.mu.Lock()
+		w.started = false
+		w.mu.Unlock()
+		return err
+	}
+	stopNotify := func() {}
+	if notifier, ok := w.backend.(reconnectNotifier); ok {
+		stopNotify = notifier.OnReconnect(w.requestResubscribe)
+	}
+	w.queue = make(chan types.Log, w.queueSize)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer stopNotify()
+		w.receive(ctx, sub, logs)
+	}()
+	go func() {
+		defer wg.Done()
+		w.dispatch(ctx)
+	}()
+	go func() {
+		wg.Wait()
+		close(w.done)
+	}()
+	return nil
+}
+
+// Stop stops the watcher and waits for it to unsubscribe and the handler to
+// return. Logs still queued are not delivered.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.quit) })
+
+	w.mu.Lock()
+	started := w.started
+	w.mu.Unlock()
+	if started {
+		<-w.done
+	}
+}
+
+// Done returns a channel which is closed once a started watcher has stopped
+// and the handler returned.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *Watcher) requestResubscribe() {
+	select {
+	case w.resubscribe <- struct{}{}:
+	default:
+	}
+}
+
+// subscribe subscribes to the logs of the query from the block of the
+// checkpoint on.
+func (w *Watcher) subscribe(ctx context.Context, logs chan<- types.Log) (fiscobcos.Subscription, error) {
+	q := w.query
+	if w.groupId != 0 {
+		q.GroupId = w.groupId
+	}
+	if cp := w.Checkpoint(); !cp.IsZero() {
+		from := new(big.Int).SetUint64(cp.BlockNumber)
+		if q.FromBlock == nil || q.FromBlock.Cmp(from) < 0 {
+			q.FromBlock = from
+		}
+	}
+	return w.backend.SubscribeFilterLogs(ctx, q, logs)
+}
+
+// receive queues the logs of the subscription for the handler, subscribing
+// again whenever it fails or a resubscription is requested.
+func (w *Watcher) receive(ctx context.Context, sub fiscobcos.Subscription, logs chan types.Log) {
+	defer close(w.queue)
+
+	attempt := 0
+	for {
+		for sub == nil {
+			var err error
+			if sub, err = w.subscribe(ctx, logs); err == nil {
+				attempt = 0
+				break
+			}
+			if !w.wait(ctx, attempt, err) {
+				return
+			}
+			attempt++
+		}
+		select {
+		case log := <-logs:
+			if !w.enqueue(ctx, log) {
+				sub.Unsubscribe()
+				return
+			}
+		case err, ok := <-sub.Err():
+			sub.Unsubscribe()
+			if !ok {
+				// All logs up to the end of the query were delivered.
+				return
+			}
+			log.Warn("Event log subscription failed, resubscribing", "group", w.groupId, "err", err)
+			sub = nil
+		case <-w.resubscribe:
+			sub.Unsubscribe()
+			sub = nil
+		case <-ctx.Done():
+			sub.Unsubscribe()
+			return
+		case <-w.quit:
+			sub.Unsubscribe()
+			return
+		}
+	}
+}
+
+// wait waits before the attempt'th (zero based) retry to subscribe after err.
+// It returns false if the watcher was stopped meanwhile.
+func (w *Watcher) wait(ctx context.Context, attempt int, err error) bool {
+	delay, _ := errclass.Backoff(ctx, attempt, retryDelay, maxRetryDelay)
+	log.Warn("Failed to resubscribe to event logs, retrying", "group", w.groupId, "attempt", attempt+1, "delay", delay, "err", err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-w.quit:
+		return false
+	}
+}
+
+// enqueue queues a log for the handler unless it was queued before, following
+// the policy if the queue is full. It returns false if the watcher was stopped
+// while blocked.
+func (w *Watcher) enqueue(ctx context.Context, log types.Log) bool {
+	w.mu.Lock()
+	if !w.queued.before(&log) {
+		// Replayed after resubscribing.
+		w.mu.Unlock()
+		return true
+	}
+	w.queued = position(&log)
+	w.mu.Unlock()
+
+	if w.policy == Drop {
+		select {
+		case w.queue <- log:
+		default:
+			w.mu.Lock()
+			w.dropped++
+			w.mu.Unlock()
+		}
+		return true
+	}
+	select {
+	case w.queue <- log:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-w.quit:
+		return false
+	}
+}
+
+// dispatch calls the handler for the queued logs, advancing the checkpoint.
+func (w *Watcher) dispatch(ctx context.Context) {
+	for log := range w.queue {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.quit:
+			return
+		default:
+		}
+		w.mu.Lock()
+		due := w.checkpoint.before(&log)
+		w.mu.Unlock()
+		if !due {
+			// Queued before the checkpoint was moved past it.
+			continue
+		}
+		w.handler(log)
+
+		w.mu.Lock()
+		if w.checkpoint.before(&log) {
+			w.checkpoint = position(&log)
+		}
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package watcher_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind/backends"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/contracts/watcher"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/core/vm"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/event"
+)
+
+var errTest = errors.New("connection reset")
+
+const emitterABI = `[
+	{"constant":false,"inputs":[{"name":"v","type":"uint256"}],"name":"emit","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":false,"name":"v","type":"uint256"}],"name":"Emitted","type":"event"}
+]`
+
+// emitterCode returns the deployment code of a contract logging the argument
+// of every call with the Emitted event.
+func emitterCode(parsed abi.ABI) []byte {
+	code := []byte{byte(vm.PUSH1), 4, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH32)}
+	code = append(code, parsed.Events["Emitted"].Id().Bytes()...)
+	code = append(code, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.LOG1), byte(vm.STOP))
+	deploy := []byte{byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 12, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), byte(len(code)), byte(vm.PUSH1), 0, byte(vm.RETURN)}
+	return append(deploy, code...)
+}
+
+// reconnectingBackend is a simulated backend whose reconnects the test
+// triggers.
+type reconnectingBackend struct {
+	*backends.SimulatedBackend
+
+	mu    sync.Mutex
+	hooks []func()
+}
+
+func (b *reconnectingBackend) OnReconnect(fn func()) (cancel func()) {
+	b.mu.Lock()
+	b.hooks = append(b.hooks, fn)
+	b.mu.Unlock()
+	return func() {}
+}
+
+func (b *reconnectingBackend) reconnect() {
+	b.mu.Lock()
+	hooks := b.hooks
+	b.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// recorder collects the values of the Emitted events handled by a watcher.
+type recorder struct {
+	mu     sync.Mutex
+	values []int64
+}
+
+func (r *recorder) handle(log types.Log) {
+	r.mu.Lock()
+	r.values = append(r.values, new(big.Int).SetBytes(log.Data).Int64())
+	r.mu.Unlock()
+}
+
+// wait waits until n values were handled and returns them.
+func (r *recorder) wait(t *testing.T, n int) []int64 {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		r.mu.Lock()
+		values := append([]int64(nil), r.values...)
+		r.mu.Unlock()
+		if len(values) >= n || time.Now().After(deadline) {
+			return values
+		}
+	}
+}
+
+// TestWatcherSimulated watches the events of a contract on a simulated chain
+// across a reconnect, then restarts from the checkpoint.
+func TestWatcherSimulated(t *testing.T) {
+	backend := &reconnectingBackend{SimulatedBackend: backends.NewSimulatedBackend()}
+	defer backend.Close()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := bind.NewKeyedTransactor(key)
+	parsed, err := abi.JSON(strings.NewReader(emitterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _, contract, err := bind.DeployContract(opts, parsed, emitterCode(parsed), backend)
+	if err != nil {
+		t.Fatalf("can't deploy the contract: %v", err)
+	}
+	emit := func(values ...int64) {
+		for _, v := range values {
+			if _, err := contract.Transact(opts, "emit", big.NewInt(v)); err != nil {
+				t.Fatalf("emit error: %v", err)
+			}
+		}
+	}
+
+	q := fiscobcos.FilterQuery{FromBlock: big.NewInt(1), Addresses: []common.Address{address}}
+	rec := new(recorder)
+	w := watcher.New(backend, 1, q, rec.handle)
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	emit(1, 2, 3)
+	rec.wait(t, 3)
+	// Resubscribing replays the logs of the checkpoint's block.
+	backend.reconnect()
+	emit(4, 5)
+	if got := rec.wait(t, 5); !reflect.DeepEqual(got, []int64{1, 2, 3, 4, 5}) {
+		t.Fatalf("handled %v, want [1 2 3 4 5]", got)
+	}
+	w.Stop()
+	// The deploying transaction is in block 1, the emits in blocks 2 to 6.
+	if cp := w.Checkpoint(); cp != (watcher.Checkpoint{BlockNumber: 6}) {
+		t.Errorf("got checkpoint %+v, want block 6", cp)
+	}
+
+	// A watcher restarted from the checkpoint of the third log delivers the
+	// logs after it, up to the last block of its query.
+	q.ToBlock = big.NewInt(6)
+	rec = new(recorder)
+	w = watcher.New(backend, 1, q, rec.handle)
+	w.SetCheckpoint(watcher.Checkpoint{BlockNumber: 4})
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	select {
+	case <-w.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("watcher didn't stop after the last block of its query")
+	}
+	if got := rec.wait(t, 0); !reflect.DeepEqual(got, []int64{4, 5}) {
+		t.Errorf("restarted watcher handled %v, want [4 5]", got)
+	}
+	if err := w.Start(context.Background()); err == nil {
+		t.Error("started a watcher twice")
+	}
+}
+
+// fakeBackend hands out subscriptions whose logs and failures the test feeds.
+type fakeBackend struct {
+	subs chan *fakeSub
+}
+
+type fakeSub struct {
+	query fiscobcos.FilterQuery
+	logs  chan types.Log
+	fail  chan error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{subs: make(chan *fakeSub, 10)}
+}
+
+func (b *fakeBackend) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
+	s := &fakeSub{query: q, logs: make(chan types.Log), fail: make(chan error, 1)}
+	b.subs <- s
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for {
+			select {
+			case log := <-s.logs:
+				select {
+				case ch <- log:
+				case <-quit:
+					return nil
+				}
+			case err := <-s.fail:
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+func (b *fakeBackend) next(t *testing.T) *fakeSub {
+	t.Helper()
+	select {
+	case s := <-b.subs:
+		return s
+	case <-time.After(10 * time.Second):
+		t.Fatal("watcher didn't subscribe")
+		return nil
+	}
+}
+
+// testLog returns a log of the given block whose data is the value v.
+func testLog(block uint64, index uint, v int64) types.Log {
+	return types.Log{BlockNumber: block, Index: index, Data: common.LeftPadBytes(big.NewInt(v).Bytes(), 32)}
+}
+
+// TestWatcherResubscribe fails a subscription, checking that the watcher
+// subscribes again from the checkpoint's block and skips the replayed logs.
+func TestWatcherResubscribe(t *testing.T) {
+	backend := newFakeBackend()
+	rec := new(recorder)
+	w := watcher.New(backend, 3, fiscobcos.FilterQuery{}, rec.handle)
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer w.Stop()
+
+	sub := backend.next(t)
+	if sub.query.GroupId != 3 || sub.query.FromBlock != nil {
+		t.Errorf("first subscription: group %d from %v, want group 3 from the head", sub.query.GroupId, sub.query.FromBlock)
+	}
+	sub.logs <- testLog(5, 0, 1)
+	sub.logs <- testLog(5, 1, 2)
+	rec.wait(t, 2)
+	sub.fail <- errTest
+
+	sub = backend.next(t)
+	if sub.query.FromBlock == nil || sub.query.FromBlock.Uint64() != 5 {
+		t.Errorf("resubscribed from block %v, want 5", sub.query.FromBlock)
+	}
+	sub.logs <- testLog(5, 0, 1)
+	sub.logs <- testLog(5, 1, 2)
+	sub.logs <- testLog(6, 0, 3)
+	if got := rec.wait(t, 3); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("handled %v, want [1 2 3]", got)
+	}
+}
+
+// TestWatcherDrop fills the queue of a watcher with the Drop policy while its
+// handler is blocked.
+func TestWatcherDrop(t *testing.T) {
+	backend := newFakeBackend()
+	rec := new(recorder)
+	entered, release := make(chan struct{}, 5), make(chan struct{})
+	w := watcher.New(backend, 1, fiscobcos.FilterQuery{}, func(log types.Log) {
+		entered <- struct{}{}
+		<-release
+		rec.handle(log)
+	}, watcher.WithQueue(1, watcher.Drop))
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer w.Stop()
+
+	sub := backend.next(t)
+	sub.logs <- testLog(1, 0, 1)
+	<-entered
+	// The second log waits in the queue, the others don't fit.
+	for v := int64(2); v <= 5; v++ {
+		sub.logs <- testLog(uint64(v), 0, v)
+	}
+	for deadline := time.Now().Add(10 * time.Second); w.Dropped() < 3; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dropped %d logs, want 3", w.Dropped())
+		}
+	}
+	close(release)
+	if got := rec.wait(t, 2); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("handled %v, want [1 2]", got)
+	}
+	if n := w.Dropped(); n != 3 {
+		t.Errorf("dropped %d logs, want 3", n)
+	}
+}
@@ -18,18 +18,13 @@
 package types
 
 import (
-	"github.com/chislab/go-fiscobcos/common"
-	"github.com/chislab/go-fiscobcos/rlp"
-	"golang.org/x/crypto/sha3"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 )
 
-func rlpHash(x interface{}) (h common.Hash) {
-	hw := sha3.NewLegacyKeccak256()
-	rlp.Encode(hw, x)
-	hw.Sum(h[:0])
-	return h
-}
-
 type ClientVersion struct {
 	BuildTime        string `json:"Build Time"`
 	BuildType        string `json:"Build Type"`
@@ -40,42 +35,128 @@ type ClientVersion struct {
 	SupportedVersion string `json:"Supported Version"`
 }
 
-type SyncStatus struct {
-	BlockNumber        int    `json:"blockNumber"`
-	GenesisHash        string `json:"genesisHash"`
-	IsSyncing          bool   `json:"isSyncing"`
-	KnownHighestNumber int    `json:"knownHighestNumber"`
-	KnownLatestHash    string `json:"knownLatestHash"`
-	LatestHash         string `json:"latestHash"`
-	NodeID             string `json:"nodeId"`
-	Peers              []Peer `json:"peers"`
-	ProtocolID         int    `json:"protocolId"`
-	TxPoolSize         string `json:"txPoolSize"`
+// IsGM reports whether the node is a guomi build, whose version carries a "gm"
+// suffix (e.g. "2.0.0 gm").
+func (v *ClientVersion) IsGM() bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSpace(v.Version)), "gm")
+}
+
+// ChainMode returns the cryptography of the node's chain.
+func (v *ClientVersion) ChainMode() ChainMode {
+	if v.IsGM() {
+		return ChainModeGM
+	}
+	return ChainModeStandard
+}
+
+// ParseChainId returns the chain id of the node, reported in decimal or hex. It
+// is nil if the node reports none or an invalid one.
+func (v *ClientVersion) ParseChainId() *big.Int {
+	return parseChainId(v.ChainId)
+}
+
+// AtLeast reports whether the node supports the features of version, like
+// "2.2.0", comparing the supported version of the node or, if it doesn't report
+// one, its release version.
+func (v *ClientVersion) AtLeast(version string) bool {
+	supported := v.SupportedVersion
+	if supported == "" {
+		supported = v.Version
+	}
+	have, want := parseVersion(supported), parseVersion(version)
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i]
+		}
+	}
+	return true
 }
 
-type Peer struct {
-	BlockNumber int         `json:"blockNumber"`
-	GenesisHash common.Hash `json:"genesisHash"`
-	LatestHash  common.Hash `json:"latestHash"`
-	NodeID      string      `json:"nodeId"`
+// SupportedSemver parses the supported version of the node or, if it doesn't
+// report one, its release version into its major, minor and patch numbers. A
+// suffix after the patch number, like " gm" or "-rc1", is ignored. Versions of
+// custom builds which don't follow this format are an error.
+func (v *ClientVersion) SupportedSemver() (major, minor, patch int, err error) {
+	version := strings.TrimSpace(v.SupportedVersion)
+	if version == "" {
+		version = strings.TrimSpace(v.Version)
+	}
+	core := version
+	if i := strings.IndexAny(core, " -+"); i >= 0 {
+		core = core[:i]
+	}
+	fields := strings.Split(core, ".")
+	if len(fields) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid node version %q", version)
+	}
+	var numbers [3]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid node version %q", version)
+		}
+		numbers[i] = n
+	}
+	return numbers[0], numbers[1], numbers[2], nil
+}
+
+// parseVersion returns the major, minor and patch numbers of a version like
+// "2.4.0" or "2.0.0 gm", treating missing numbers as zero.
+func parseVersion(version string) [3]int {
+	var numbers [3]int
+	fields := strings.SplitN(strings.TrimSpace(version), ".", 3)
+	for i, field := range fields {
+		n := 0
+		for _, c := range field {
+			if c < '0' || c > '9' {
+				break
+			}
+			n = n*10 + int(c-'0')
+		}
+		numbers[i] = n
+	}
+	return numbers
 }
 
 type Block struct {
-	DbHash       string        `json:"dbHash"`
-	ExtraData    []interface{} `json:"extraData"`
-	GasLimit     string        `json:"gasLimit"`
-	GasUsed      string        `json:"gasUsed"`
-	Hash         string        `json:"hash"`
-	LogsBloom    string        `json:"logsBloom"`
-	Number       string        `json:"number"`
-	ParentHash   string        `json:"parentHash"`
-	ReceiptsRoot string        `json:"receiptsRoot"`
-	Sealer       string        `json:"sealer"`
-	SealerList   []string      `json:"sealerList"`
-	StateRoot    string        `json:"stateRoot"`
-	Timestamp    string        `json:"timestamp"`
-	Transactions [] BlockTx `json:"transactions"`
-	TransactionsRoot string `json:"transactionsRoot"`
+	DbHash           string        `json:"dbHash"`
+	ExtraData        []interface{} `json:"extraData"`
+	GasLimit         string        `json:"gasLimit"`
+	GasUsed          string        `json:"gasUsed"`
+	Hash             string        `json:"hash"`
+	LogsBloom        string        `json:"logsBloom"`
+	Number           string        `json:"number"`
+	ParentHash       string        `json:"parentHash"`
+	ReceiptsRoot     string        `json:"receiptsRoot"`
+	Sealer           string        `json:"sealer"`
+	SealerList       []string      `json:"sealerList"`
+	StateRoot        string        `json:"stateRoot"`
+	Timestamp        string        `json:"timestamp"`
+	Transactions     []BlockTx     `json:"transactions"`
+	TransactionsRoot string        `json:"transactionsRoot"`
+
+	// Raw is the response the block was decoded from, kept by clients
+	// created with ethclient.WithRawResponses for fields of newer nodes.
+	Raw json.RawMessage `json:"-"`
+}
+
+// BlockHeader is a block without its transactions, as retrieved by HeaderByNumber
+// and delivered by block subscriptions.
+type BlockHeader struct {
+	DbHash           string        `json:"dbHash"`
+	ExtraData        []interface{} `json:"extraData"`
+	GasLimit         string        `json:"gasLimit"`
+	GasUsed          string        `json:"gasUsed"`
+	Hash             string        `json:"hash"`
+	LogsBloom        string        `json:"logsBloom"`
+	Number           string        `json:"number"`
+	ParentHash       string        `json:"parentHash"`
+	ReceiptsRoot     string        `json:"receiptsRoot"`
+	Sealer           string        `json:"sealer"`
+	SealerList       []string      `json:"sealerList"`
+	StateRoot        string        `json:"stateRoot"`
+	Timestamp        string        `json:"timestamp"`
+	TransactionsRoot string        `json:"transactionsRoot"`
 }
 
 type BlockTx struct {
@@ -109,21 +190,7 @@ type TransactionByHash struct {
 	To               string `json:"to"`
 	TransactionIndex string `json:"transactionIndex"`
 	Value            string `json:"value"`
-}
-
-type PeerStatus struct {
-	IPAndPort string        `json:"IPAndPort"`
-	Topic     []interface{} `json:"Topic"`
-	NodeID    string        `json:"nodeId"`
-}
 
-type PendingTx struct {
-	From     common.Hash `json:"from"`
-	Gas      string      `json:"gas"`
-	GasPrice string      `json:"gasPrice"`
-	Hash     common.Hash `json:"hash"`
-	Input    string      `json:"input"`
-	Nonce    string      `json:"nonce"`
-	To       common.Hash `json:"to"`
-	Value    string      `json:"value"`
+	// Raw is the response the transaction was decoded from, see Block.Raw.
+	Raw json.RawMessage `json:"-"`
 }
@@ -0,0 +1,212 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// headerRLP is the encoding of a block header the node hashes: the header
+// fields in the node's order, without the signatures, which sign the hash.
+type headerRLP struct {
+	ParentHash       common.Hash
+	StateRoot        common.Hash
+	TransactionsRoot common.Hash
+	ReceiptsRoot     common.Hash
+	DbHash           common.Hash
+	LogsBloom        Bloom
+	Number           uint64
+	GasLimit         *big.Int
+	GasUsed          *big.Int
+	Timestamp        uint64
+	ExtraData        [][]byte
+	Sealer           *big.Int
+	SealerList       [][]byte // 64 byte node ids
+}
+
+// Header returns the block without its transactions.
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		DbHash:           b.DbHash,
+		ExtraData:        b.ExtraData,
+		GasLimit:         b.GasLimit,
+		GasUsed:          b.GasUsed,
+		Hash:             b.Hash,
+		LogsBloom:        b.LogsBloom,
+		Number:           b.Number,
+		ParentHash:       b.ParentHash,
+		ReceiptsRoot:     b.ReceiptsRoot,
+		Sealer:           b.Sealer,
+		SealerList:       b.SealerList,
+		StateRoot:        b.StateRoot,
+		Timestamp:        b.Timestamp,
+		TransactionsRoot: b.TransactionsRoot,
+	}
+}
+
+// Bloom parses the logs bloom of the block, see BlockHeader.Bloom.
+func (b *Block) Bloom() (Bloom, error) {
+	return parseBloom(b.LogsBloom)
+}
+
+// Bloom parses the logs bloom of the block, which tells the addresses and
+// topics its logs may contain.
+func (h *BlockHeader) Bloom() (Bloom, error) {
+	return parseBloom(h.LogsBloom)
+}
+
+func parseBloom(s string) (Bloom, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != BloomByteLength {
+		return Bloom{}, fmt.Errorf("invalid block logsBloom %q", s)
+	}
+	return BytesToBloom(b), nil
+}
+
+// ComputeHash recomputes the hash of the block from its header, see
+// BlockHeader.ComputeHash.
+func (b *Block) ComputeHash(mode ChainMode) (common.Hash, error) {
+	return b.Header().ComputeHash(mode)
+}
+
+// VerifyHash checks that the hash reported for the block matches its header.
+func (b *Block) VerifyHash(mode ChainMode) error {
+	return b.Header().VerifyHash(mode)
+}
+
+// ComputeHash recomputes the hash of the block from its header fields the way
+// the node does, hashing their RLP encoding with Keccak256 or, on guomi
+// chains, SM3. The transactions are covered through the transactions root.
+func (h *BlockHeader) ComputeHash(mode ChainMode) (common.Hash, error) {
+	enc, err := h.encoding()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if mode == ChainModeGM {
+		return sm3RlpHash(enc), nil
+	}
+	return rlpHash(enc), nil
+}
+
+// VerifyHash checks that the hash reported for the block matches its header.
+func (h *BlockHeader) VerifyHash(mode ChainMode) error {
+	want, err := h.ComputeHash(mode)
+	if err != nil {
+		return err
+	}
+	if have := common.HexToHash(h.Hash); have != want {
+		return fmt.Errorf("block hash mismatch: have %s, want %s", have.Hex(), want.Hex())
+	}
+	return nil
+}
+
+// encoding converts the JSON fields of the header into their RLP encoding.
+func (h *BlockHeader) encoding() (*headerRLP, error) {
+	var (
+		enc headerRLP
+		err error
+	)
+	hashes := []struct {
+		name string
+		val  string
+		dst  *common.Hash
+	}{
+		{"parentHash", h.ParentHash, &enc.ParentHash},
+		{"stateRoot", h.StateRoot, &enc.StateRoot},
+		{"transactionsRoot", h.TransactionsRoot, &enc.TransactionsRoot},
+		{"receiptsRoot", h.ReceiptsRoot, &enc.ReceiptsRoot},
+		{"dbHash", h.DbHash, &enc.DbHash},
+	}
+	for _, field := range hashes {
+		if *field.dst, err = decodeHash(field.name, field.val); err != nil {
+			return nil, err
+		}
+	}
+	if enc.LogsBloom, err = h.Bloom(); err != nil {
+		return nil, err
+	}
+	if enc.Number, err = decodeHeaderUint("number", h.Number); err != nil {
+		return nil, err
+	}
+	if enc.Timestamp, err = decodeHeaderUint("timestamp", h.Timestamp); err != nil {
+		return nil, err
+	}
+	if enc.GasLimit, err = decodeHeaderBig("gasLimit", h.GasLimit); err != nil {
+		return nil, err
+	}
+	if enc.GasUsed, err = decodeHeaderBig("gasUsed", h.GasUsed); err != nil {
+		return nil, err
+	}
+	if enc.Sealer, err = decodeHeaderBig("sealer", h.Sealer); err != nil {
+		return nil, err
+	}
+	enc.ExtraData = make([][]byte, len(h.ExtraData))
+	for i, data := range h.ExtraData {
+		s, ok := data.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid block extraData %d: %v", i, data)
+		}
+		if enc.ExtraData[i], err = hexutil.Decode(s); err != nil {
+			return nil, fmt.Errorf("invalid block extraData %d: %v", i, err)
+		}
+	}
+	enc.SealerList = make([][]byte, len(h.SealerList))
+	for i, sealer := range h.SealerList {
+		// Node ids are reported without 0x prefix.
+		id, err := hexutil.Decode("0x" + trimHexPrefix(sealer))
+		if err != nil || len(id) != 64 {
+			return nil, fmt.Errorf("invalid block sealer %q", sealer)
+		}
+		enc.SealerList[i] = id
+	}
+	return &enc, nil
+}
+
+func decodeHash(field, s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid block %s %q", field, s)
+	}
+	return common.BytesToHash(b), nil
+}
+
+func decodeHeaderUint(field, s string) (uint64, error) {
+	n, err := hexutil.DecodeFlexibleUint64(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block %s %q: %v", field, s, err)
+	}
+	return n, nil
+}
+
+func decodeHeaderBig(field, s string) (*big.Int, error) {
+	n, err := hexutil.DecodeFlexibleBig(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block %s %q: %v", field, s, err)
+	}
+	return n, nil
+}
+
+func trimHexPrefix(s string) string {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
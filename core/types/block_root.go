@@ -0,0 +1,175 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+// ErrRootMismatch is matched by the errors of VerifyTxRoot and
+// VerifyReceiptsRoot if a root doesn't match the block's content.
+var ErrRootMismatch = errors.New("root mismatch")
+
+// rootFanout is the number of hashes combined per level of the roots.
+const rootFanout = 16
+
+// RootMismatchError tells which root of a block didn't match.
+type RootMismatchError struct {
+	Root string      // "transactions" or "receipts"
+	Have common.Hash // root in the block header
+	Want common.Hash // root computed from the block's content
+}
+
+func (e *RootMismatchError) Error() string {
+	return fmt.Sprintf("%s root mismatch: have %s, want %s", e.Root, e.Have.Hex(), e.Want.Hex())
+}
+
+// Is reports whether target is ErrRootMismatch.
+func (e *RootMismatchError) Is(target error) bool { return target == ErrRootMismatch }
+
+// receiptHashRLP is the encoding of a receipt hashed by the node.
+type receiptHashRLP struct {
+	Root            common.Hash
+	GasUsed         uint64
+	ContractAddress common.Address
+	Bloom           Bloom
+	Status          uint64
+	Output          []byte
+	Logs            []*Log
+}
+
+// ComputeTxRoot computes the transactions root of the block from the hashes of
+// its transactions, as reported by the node.
+func (b *Block) ComputeTxRoot(mode ChainMode) (common.Hash, error) {
+	hashes := make([]common.Hash, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		h, err := decodeHash("transaction hash", tx.Hash)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		hashes[i] = h
+	}
+	return merkleRoot(hashes, mode), nil
+}
+
+// VerifyTxRoot checks the transactions root of the block against its
+// transactions, which must have been retrieved in full. The transaction hashes
+// are taken as reported; recomputing them needs the signed transactions.
+//
+// Roots are computed as by nodes since 2.2.0, which hash a tree of the
+// transaction hashes prefixed with their RLP encoded index, combining 16 per
+// level, with Keccak256 or, on guomi chains, SM3. Older nodes built a Patricia
+// trie of the signed transactions, which can't be checked from the block.
+func (b *Block) VerifyTxRoot(mode ChainMode) error {
+	want, err := b.ComputeTxRoot(mode)
+	if err != nil {
+		return err
+	}
+	return checkRoot("transactions", b.TransactionsRoot, want)
+}
+
+// VerifyReceiptsRoot checks the receipts root of the block against the
+// receipts of its transactions, in order, see VerifyTxRoot.
+func (b *Block) VerifyReceiptsRoot(receipts []*Receipt, mode ChainMode) error {
+	hashes := make([]common.Hash, len(receipts))
+	for i, receipt := range receipts {
+		h, err := receipt.hashFor(mode)
+		if err != nil {
+			return fmt.Errorf("receipt %d: %v", i, err)
+		}
+		hashes[i] = h
+	}
+	return checkRoot("receipts", b.ReceiptsRoot, merkleRoot(hashes, mode))
+}
+
+// hashFor returns the hash of the receipt the node builds the receipts root
+// from.
+func (r *Receipt) hashFor(mode ChainMode) (common.Hash, error) {
+	status, err := r.StatusCode()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	enc := &receiptHashRLP{
+		Root:    r.Root,
+		GasUsed: r.GasUsed,
+		Bloom:   r.Bloom,
+		Status:  uint64(status),
+		Output:  r.Output,
+		Logs:    r.Logs,
+	}
+	if r.ContractAddress != nil {
+		enc.ContractAddress = *r.ContractAddress
+	}
+	if enc.Logs == nil {
+		enc.Logs = []*Log{}
+	}
+	if mode == ChainModeGM {
+		return sm3RlpHash(enc), nil
+	}
+	return rlpHash(enc), nil
+}
+
+func checkRoot(name, have string, want common.Hash) error {
+	root, err := decodeHash(name+"Root", have)
+	if err != nil {
+		return err
+	}
+	if root != want {
+		return &RootMismatchError{Root: name, Have: root, Want: want}
+	}
+	return nil
+}
+
+// merkleRoot computes a root the way the node does: the hashes, prefixed with
+// their RLP encoded index, are concatenated and hashed in groups of 16, level
+// by level, until one is left, which is hashed once more.
+func merkleRoot(hashes []common.Hash, mode ChainMode) common.Hash {
+	h := newHasher(mode)
+	defer h.release()
+	sum := func(data ...[]byte) common.Hash {
+		h.state.Reset()
+		for _, d := range data {
+			h.state.Write(d)
+		}
+		return h.hash()
+	}
+	if len(hashes) == 0 {
+		return sum()
+	}
+	level := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		index, _ := rlp.EncodeToBytes(uint(i))
+		level[i] = append(index, h[:]...)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, (len(level)+rootFanout-1)/rootFanout)
+		for i := range next {
+			end := (i + 1) * rootFanout
+			if end > len(level) {
+				end = len(level)
+			}
+			node := sum(level[i*rootFanout : end]...)
+			next[i] = node[:]
+		}
+		level = next
+	}
+	return sum(level[0])
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"hash"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestClientVersionChainMode(t *testing.T) {
+	tests := []struct {
+		version string
+		want    ChainMode
+	}{
+		{"2.7.0", ChainModeStandard},
+		{"2.7.0 gm", ChainModeGM},
+		{"2.0.0-rc1 gm", ChainModeGM},
+		{"2.4.0 GM ", ChainModeGM},
+		{"2.4.0-gm", ChainModeGM},
+		{"2.4.0 gmx", ChainModeStandard},
+		{"gm 2.4.0", ChainModeStandard},
+		{"", ChainModeStandard},
+	}
+	for _, test := range tests {
+		v := &ClientVersion{Version: test.version}
+		if mode := v.ChainMode(); mode != test.want {
+			t.Errorf("version %q: chain mode %v, want %v", test.version, mode, test.want)
+		}
+		if v.IsGM() != (test.want == ChainModeGM) {
+			t.Errorf("version %q: IsGM %v", test.version, v.IsGM())
+		}
+	}
+}
+
+func TestClientVersionSupportedSemver(t *testing.T) {
+	tests := []struct {
+		version   string
+		supported string
+		want      [3]int
+		err       bool
+	}{
+		{version: "2.7.2", supported: "2.7.2", want: [3]int{2, 7, 2}},
+		{version: "2.7.2 gm", supported: "2.4.0", want: [3]int{2, 4, 0}},
+		{version: "2.0.0-rc1 gm", want: [3]int{2, 0, 0}},
+		{version: "2.6.0+build7", want: [3]int{2, 6, 0}},
+		{version: " 2.10.11 ", want: [3]int{2, 10, 11}},
+		{version: "2.7.0", supported: "custom", err: true},
+		{version: "2.7", err: true},
+		{version: "2.7.x", err: true},
+		{version: "v2.7.0", err: true},
+		{version: "", err: true},
+	}
+	for _, test := range tests {
+		v := &ClientVersion{Version: test.version, SupportedVersion: test.supported}
+		major, minor, patch, err := v.SupportedSemver()
+		if test.err {
+			if err == nil {
+				t.Errorf("%q/%q: got %d.%d.%d, want error", test.version, test.supported, major, minor, patch)
+			}
+			continue
+		}
+		if err != nil || [3]int{major, minor, patch} != test.want {
+			t.Errorf("%q/%q: got %d.%d.%d, %v, want %v", test.version, test.supported, major, minor, patch, err, test.want)
+		}
+	}
+}
+
+// modeHash hashes data with Keccak256 or, on guomi chains, SM3.
+func modeHash(mode ChainMode, data ...[]byte) common.Hash {
+	var h hash.Hash
+	if mode == ChainModeGM {
+		h = gm.NewSM3()
+	} else {
+		h = sha3.NewLegacyKeccak256()
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// hashTestBlock returns a block of two transactions and two sealers, in the form
+// the node reports it, with its hash and roots left out.
+func hashTestBlock() *Block {
+	var bloom Bloom
+	bloom.Add(big.NewInt(0x7a))
+	return &Block{
+		DbHash:       "0x3ff05006e4e3cdc5d645197bf1056267b0076a04ee7e457e2171c2aef815bc11",
+		ExtraData:    []interface{}{"0x0102"},
+		GasLimit:     "0x0",
+		GasUsed:      "0xf698",
+		LogsBloom:    hexutil.Encode(bloom[:]),
+		Number:       "0x2",
+		ParentHash:   "0x13de55b8370e9f5423c0fc7043bb120a777bb0f0d04ac4eb880ee0f8649f1c05",
+		ReceiptsRoot: "0xf2827b701b861269037b899456267673b8e58dff4b1778a60ad2a11c5ed027f3",
+		Sealer:       "0x1",
+		SealerList:   []string{strings.Repeat("d2", 64), strings.Repeat("74", 64)},
+		StateRoot:    "0x0000000000000000000000000000000000000000000000000000000000000000",
+		Timestamp:    "0x16d1a8b4d6c",
+		Transactions: []BlockTx{
+			{Hash: "0x3fe0bce2716957ce4322dbca8537717187249980c0938f2cb3f01acac4a7ab5a"},
+			{Hash: "0x8e3d2d6ba3d2f30eb1bd2a4a1f5ae4e4a5ef4b4e02c1c7c1b1e0b8e3a7a4c2d1"},
+		},
+	}
+}
+
+// TestBlockHash checks the hashes and transaction roots of blocks against ones
+// computed here from the node's encoding of the header fields.
+func TestBlockHash(t *testing.T) {
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		block := hashTestBlock()
+
+		// The transaction hashes, prefixed with their index, hashed as one
+		// group, and the group hashed once more.
+		index0, _ := rlp.EncodeToBytes(uint(0))
+		index1, _ := rlp.EncodeToBytes(uint(1))
+		tx0, tx1 := common.HexToHash(block.Transactions[0].Hash), common.HexToHash(block.Transactions[1].Hash)
+		group := modeHash(mode, append(index0, tx0[:]...), append(index1, tx1[:]...))
+		txRoot := modeHash(mode, group[:])
+		block.TransactionsRoot = txRoot.Hex()
+		if err := block.VerifyTxRoot(mode); err != nil {
+			t.Errorf("%v: %v", mode, err)
+		}
+
+		bloom, _ := hexutil.Decode(block.LogsBloom)
+		enc, err := rlp.EncodeToBytes([]interface{}{
+			common.HexToHash(block.ParentHash),
+			common.HexToHash(block.StateRoot),
+			txRoot,
+			common.HexToHash(block.ReceiptsRoot),
+			common.HexToHash(block.DbHash),
+			bloom,
+			uint64(2),             // number
+			uint64(0),             // gas limit
+			uint64(0xf698),        // gas used
+			uint64(0x16d1a8b4d6c), // timestamp
+			[][]byte{{1, 2}},      // extra data
+			uint64(1),             // sealer
+			[][]byte{common.FromHex(block.SealerList[0]), common.FromHex(block.SealerList[1])},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Hash = modeHash(mode, enc).Hex()
+		if err := block.VerifyHash(mode); err != nil {
+			t.Errorf("%v: %v", mode, err)
+		}
+		header := block.Header()
+		if err := header.VerifyHash(mode); err != nil {
+			t.Errorf("%v: header: %v", mode, err)
+		}
+		// Decimal numbers, as some versions report, hash the same.
+		header.Number, header.Timestamp = "2", "1568108399980"
+		if err := header.VerifyHash(mode); err != nil {
+			t.Errorf("%v: decimal header: %v", mode, err)
+		}
+
+		// Any change of the header must change its hash, and the other chain
+		// mode hashes differently.
+		header.Timestamp = "0x16d1a8b4d6d"
+		if err := header.VerifyHash(mode); err == nil {
+			t.Errorf("%v: hash verified with changed timestamp", mode)
+		}
+		other := ChainModeGM
+		if mode == ChainModeGM {
+			other = ChainModeStandard
+		}
+		if err := block.VerifyHash(other); err == nil {
+			t.Errorf("%v: hash verified as %v", mode, other)
+		}
+		// Transactions out of order don't make the root.
+		block.Transactions[0], block.Transactions[1] = block.Transactions[1], block.Transactions[0]
+		if err := block.VerifyTxRoot(mode); err == nil || !strings.Contains(err.Error(), "transactions root mismatch") {
+			t.Errorf("%v: swapped transactions: %v", mode, err)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/chislab/go-fiscobcos/common/hexutil"
 	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
 )
 
 type bytesBacked interface {
@@ -72,15 +73,22 @@ func (b Bloom) Bytes() []byte {
 	return b[:]
 }
 
-func (b Bloom) Test(test *big.Int) bool {
-	return BloomLookup(b, test)
+// Test reports whether d, a log address or topic, may have been added to the
+// filter. False positives are possible, false negatives are not.
+func (b Bloom) Test(d []byte) bool {
+	return BloomLookup(b, rawBytes(d))
 }
 
-func (b Bloom) TestBytes(test []byte) bool {
-	return b.Test(new(big.Int).SetBytes(test))
-
+// TestBytes is Test.
+func (b Bloom) TestBytes(d []byte) bool {
+	return b.Test(d)
 }
 
+// rawBytes makes a byte slice bytesBacked, keeping leading zeros.
+type rawBytes []byte
+
+func (b rawBytes) Bytes() []byte { return b }
+
 // MarshalText encodes b as a hex string with 0x prefix.
 func (b Bloom) MarshalText() ([]byte, error) {
 	return hexutil.Bytes(b[:]).MarshalText()
@@ -91,21 +99,37 @@ func (b *Bloom) UnmarshalText(input []byte) error {
 	return hexutil.UnmarshalFixedText("Bloom", input, b[:])
 }
 
+// CreateBloom returns the logs bloom of the receipts of a standard chain. See
+// CreateBloomFor for guomi chains.
 func CreateBloom(receipts Receipts) Bloom {
+	return CreateBloomFor(receipts, ChainModeStandard)
+}
+
+// CreateBloomFor returns the logs bloom of the receipts of a chain with the
+// given cryptography, hashing the log addresses and topics with SM3 on guomi
+// chains and Keccak256 otherwise.
+func CreateBloomFor(receipts Receipts, mode ChainMode) Bloom {
 	bin := new(big.Int)
 	for _, receipt := range receipts {
-		bin.Or(bin, LogsBloom(receipt.Logs))
+		bin.Or(bin, LogsBloomFor(receipt.Logs, mode))
 	}
 
 	return BytesToBloom(bin.Bytes())
 }
 
+// LogsBloom returns the bloom bits of the logs of a standard chain.
 func LogsBloom(logs []*Log) *big.Int {
+	return LogsBloomFor(logs, ChainModeStandard)
+}
+
+// LogsBloomFor returns the bloom bits of the logs of a chain with the given
+// cryptography, see CreateBloomFor.
+func LogsBloomFor(logs []*Log, mode ChainMode) *big.Int {
 	bin := new(big.Int)
 	for _, log := range logs {
-		bin.Or(bin, bloom9(log.Address.Bytes()))
+		bin.Or(bin, bloom9For(log.Address.Bytes(), mode))
 		for _, b := range log.Topics {
-			bin.Or(bin, bloom9(b[:]))
+			bin.Or(bin, bloom9For(b[:], mode))
 		}
 	}
 
@@ -113,7 +137,17 @@ func LogsBloom(logs []*Log) *big.Int {
 }
 
 func bloom9(b []byte) *big.Int {
-	b = crypto.Keccak256(b)
+	return bloom9For(b, ChainModeStandard)
+}
+
+// bloom9For returns the 3 bloom bits of b, taken from the hash of b on a chain
+// with the given cryptography.
+func bloom9For(b []byte, mode ChainMode) *big.Int {
+	if mode == ChainModeGM {
+		b = gm.SM3(b)
+	} else {
+		b = crypto.Keccak256(b)
+	}
 
 	r := new(big.Int)
 
@@ -128,9 +162,17 @@ func bloom9(b []byte) *big.Int {
 
 var Bloom9 = bloom9
 
+// BloomLookup reports whether topic may have been added to the bloom of a
+// standard chain. See BloomLookupFor for guomi chains.
 func BloomLookup(bin Bloom, topic bytesBacked) bool {
+	return BloomLookupFor(bin, topic, ChainModeStandard)
+}
+
+// BloomLookupFor reports whether topic may have been added to the bloom of a
+// chain with the given cryptography.
+func BloomLookupFor(bin Bloom, topic bytesBacked, mode ChainMode) bool {
 	bloom := bin.Big()
-	cmp := bloom9(topic.Bytes())
+	cmp := bloom9For(topic.Bytes(), mode)
 
 	return bloom.And(bloom, cmp).Cmp(cmp) == 0
 }
@@ -0,0 +1,46 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+func TestBloomFor(t *testing.T) {
+	addr := common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1")
+	topic := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	receipts := Receipts{{Logs: []*Log{{Address: addr, Topics: []common.Hash{topic}}}}}
+
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		bloom := CreateBloomFor(receipts, mode)
+		if !BloomLookupFor(bloom, addr, mode) || !BloomLookupFor(bloom, topic, mode) {
+			t.Errorf("%v: logged address and topic not in the bloom", mode)
+		}
+		other := ChainModeGM
+		if mode == ChainModeGM {
+			other = ChainModeStandard
+		}
+		if BloomLookupFor(bloom, addr, other) && BloomLookupFor(bloom, topic, other) {
+			t.Errorf("%v: bloom matches when checked with the %v hash", mode, other)
+		}
+	}
+	if CreateBloom(receipts) != CreateBloomFor(receipts, ChainModeStandard) {
+		t.Error("CreateBloom doesn't build a standard bloom")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// CallResult is the result of a message call executed by a node without
+// sending a transaction.
+type CallResult struct {
+	CurrentBlockNumber uint64 // latest block of the node when executing the call
+	Status             int    // execution status, see the Status constants
+	Output             []byte // return data, or the revert data if reverted
+}
+
+// UnmarshalJSON decodes the result of the call method. Very old nodes answer
+// with the output only, which is taken as a successful execution at an unknown
+// block.
+func (r *CallResult) UnmarshalJSON(input []byte) error {
+	var output hexutil.Bytes
+	if err := json.Unmarshal(input, &output); err == nil {
+		*r = CallResult{Status: StatusSuccess, Output: output}
+		return nil
+	}
+	var dec struct {
+		CurrentBlockNumber hexutil.FlexibleUint64 `json:"currentBlockNumber"`
+		Status             hexutil.FlexibleUint64 `json:"status"`
+		Output             hexutil.Bytes          `json:"output"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*r = CallResult{CurrentBlockNumber: uint64(dec.CurrentBlockNumber), Status: int(dec.Status), Output: dec.Output}
+	return nil
+}
+
+// Succeeded reports whether the call executed successfully.
+func (r *CallResult) Succeeded() bool {
+	return r.Status == StatusSuccess
+}
+
+// Err returns nil if the call executed successfully and its status as
+// *StatusError otherwise.
+func (r *CallResult) Err() error {
+	if r.Status != StatusSuccess {
+		return &StatusError{Status: r.Status}
+	}
+	return nil
+}
+
+// RevertReason decodes the reason a reverted call passed to revert or require, or
+// the solidity panic it failed with.
+func (r *CallResult) RevertReason() (string, error) {
+	if r.Status != StatusRevertInstruction {
+		return "", errNotReverted
+	}
+	return UnpackRevertReason(r.Output)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConsensusStatus is the state of the PBFT consensus engine of a node, as
+// returned by getConsensusStatus.
+type ConsensusStatus struct {
+	AccountType            int    `json:"accountType"`
+	AllowFutureBlocks      bool   `json:"allowFutureBlocks"`
+	CfgErr                 bool   `json:"cfgErr"`
+	ConnectedNodes         int    `json:"connectedNodes"`
+	ConsensusedBlockNumber int64  `json:"consensusedBlockNumber"`
+	CurrentView            int64  `json:"currentView"`
+	GroupId                int    `json:"groupId"`
+	HighestBlockHash       string `json:"highestblockHash"`
+	HighestBlockNumber     int64  `json:"highestblockNumber"`
+	LeaderFailed           bool   `json:"leaderFailed"`
+	MaxFaultyLeader        int    `json:"max_faulty_leader"`
+	NodeId                 string `json:"nodeId"`
+	NodeNum                int    `json:"nodeNum"`
+	NodeIndex              int    `json:"node_index"`
+	OmitEmptyBlock         bool   `json:"omitEmptyBlock"`
+	ProtocolId             int    `json:"protocolId"`
+	ToView                 int64  `json:"toView"`
+
+	Sealers         []ConsensusNode `json:"sealers"`         // sealer list, from the sealer.<index> keys
+	PrepareCache    ConsensusCache  `json:"prepareCache"`    // from the prepareCache_* keys
+	RawPrepareCache ConsensusCache  `json:"rawPrepareCache"` // from the rawPrepareCache_* keys
+	Views           []NodeView      `json:"views"`           // views of the connected nodes
+}
+
+// ConsensusNode is a sealer taking part in consensus.
+type ConsensusNode struct {
+	Index  int    `json:"index"`
+	NodeId string `json:"nodeId"`
+}
+
+// ConsensusCache describes a cached PBFT prepare request.
+type ConsensusCache struct {
+	BlockHash string `json:"blockHash"`
+	Height    int64  `json:"height"`
+	Index     int64  `json:"idx"`
+	View      int64  `json:"view"`
+}
+
+// NodeView is the PBFT view a node reported.
+type NodeView struct {
+	NodeId string `json:"nodeId"`
+	View   int64  `json:"view"`
+}
+
+var errInvalidConsensusStatus = errors.New("invalid consensus status")
+
+// UnmarshalJSON decodes both the array form returned by 2.x nodes, the status
+// object followed by the cache objects and the list of node views, and the
+// plain status object form.
+func (s *ConsensusStatus) UnmarshalJSON(input []byte) error {
+	input = []byte(strings.TrimSpace(string(input)))
+	if len(input) == 0 {
+		return errInvalidConsensusStatus
+	}
+	*s = ConsensusStatus{}
+	if input[0] == '{' {
+		return s.decodeObject(input)
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(input, &elems); err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		elem = json.RawMessage(strings.TrimSpace(string(elem)))
+		switch {
+		case len(elem) > 0 && elem[0] == '{':
+			if err := s.decodeObject(elem); err != nil {
+				return err
+			}
+		case len(elem) > 0 && elem[0] == '[':
+			var views []NodeView
+			if err := json.Unmarshal(elem, &views); err != nil {
+				return err
+			}
+			s.Views = append(s.Views, views...)
+		default:
+			return errInvalidConsensusStatus
+		}
+	}
+	return nil
+}
+
+// decodeObject decodes a status object into s, keeping the fields it doesn't
+// carry. It gathers the sealer and cache entries, which nodes flatten into
+// numbered and prefixed keys.
+func (s *ConsensusStatus) decodeObject(input []byte) error {
+	type status ConsensusStatus
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return err
+	}
+	views := s.Views
+	s.Views = nil
+	if err := json.Unmarshal(input, (*status)(s)); err != nil {
+		return err
+	}
+	s.Views = append(views, s.Views...)
+	for key, value := range fields {
+		switch {
+		case strings.HasPrefix(key, "sealer."):
+			index, err := strconv.Atoi(strings.TrimPrefix(key, "sealer."))
+			if err != nil {
+				continue
+			}
+			node := ConsensusNode{Index: index}
+			if err := json.Unmarshal(value, &node.NodeId); err != nil {
+				return err
+			}
+			s.Sealers = append(s.Sealers, node)
+		case strings.HasPrefix(key, "prepareCache_"):
+			if err := s.PrepareCache.set(strings.TrimPrefix(key, "prepareCache_"), value); err != nil {
+				return err
+			}
+		case strings.HasPrefix(key, "rawPrepareCache_"):
+			if err := s.RawPrepareCache.set(strings.TrimPrefix(key, "rawPrepareCache_"), value); err != nil {
+				return err
+			}
+		}
+	}
+	sort.Slice(s.Sealers, func(i, j int) bool { return s.Sealers[i].Index < s.Sealers[j].Index })
+	return nil
+}
+
+// set decodes a cache field. Nodes report the index and view as decimal
+// strings and the height as number.
+func (c *ConsensusCache) set(field string, value json.RawMessage) error {
+	switch field {
+	case "blockHash":
+		return json.Unmarshal(value, &c.BlockHash)
+	case "height":
+		return decodeCacheInt(value, &c.Height)
+	case "idx":
+		return decodeCacheInt(value, &c.Index)
+	case "view":
+		return decodeCacheInt(value, &c.View)
+	}
+	return nil
+}
+
+func decodeCacheInt(value json.RawMessage, dst *int64) error {
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		text = string(value)
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid consensus cache number %s", value)
+	}
+	*dst = n
+	return nil
+}
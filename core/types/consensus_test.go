@@ -0,0 +1,116 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	testNodeA = strings.Repeat("a", 128)
+	testNodeB = strings.Repeat("b", 128)
+	testNodeC = strings.Repeat("c", 128)
+)
+
+// consensusStatus, prepareCache and rawPrepareCache are the objects 2.x nodes
+// return the status in, with the sealers and cache entries flattened into keys.
+var (
+	consensusStatus = `{
+		"accountType": 1, "allowFutureBlocks": true, "cfgErr": false, "connectedNodes": 2,
+		"consensusedBlockNumber": 38207, "currentView": 54477, "groupId": 1,
+		"highestblockHash": "0x19a16e8833e671aa11431de589c866a6442ca6c8548ba40a44f50889cd785069",
+		"highestblockNumber": 38206, "leaderFailed": false, "max_faulty_leader": 0,
+		"nodeId": "` + testNodeA + `", "nodeNum": 3, "node_index": 0, "omitEmptyBlock": true,
+		"protocolId": 65544, "toView": 54478,
+		"sealer.2": "` + testNodeC + `", "sealer.0": "` + testNodeA + `", "sealer.1": "` + testNodeB + `"`
+	prepareCache = `
+		"prepareCache_blockHash": "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"prepareCache_height": -1, "prepareCache_idx": "65535", "prepareCache_view": "54477"`
+	rawPrepareCache = `
+		"rawPrepareCache_blockHash": "0x1f7c1c8f2f8d85e8e6e3eb1ae3c8c3a9cfe6ff2e0c1e4d0c3d1a6f1e5e0d9c8b",
+		"rawPrepareCache_height": 38207, "rawPrepareCache_idx": "1", "rawPrepareCache_view": "54477"`
+	consensusViews = `[{"nodeId": "` + testNodeB + `", "view": 54476}, {"nodeId": "` + testNodeC + `", "view": 54477}]`
+)
+
+func TestConsensusStatusForms(t *testing.T) {
+	want := &ConsensusStatus{
+		AccountType:            1,
+		AllowFutureBlocks:      true,
+		ConnectedNodes:         2,
+		ConsensusedBlockNumber: 38207,
+		CurrentView:            54477,
+		GroupId:                1,
+		HighestBlockHash:       "0x19a16e8833e671aa11431de589c866a6442ca6c8548ba40a44f50889cd785069",
+		HighestBlockNumber:     38206,
+		NodeId:                 testNodeA,
+		NodeNum:                3,
+		OmitEmptyBlock:         true,
+		ProtocolId:             65544,
+		ToView:                 54478,
+		Sealers:                []ConsensusNode{{0, testNodeA}, {1, testNodeB}, {2, testNodeC}},
+		PrepareCache: ConsensusCache{
+			BlockHash: "0x0000000000000000000000000000000000000000000000000000000000000000",
+			Height:    -1,
+			Index:     65535,
+			View:      54477,
+		},
+		RawPrepareCache: ConsensusCache{
+			BlockHash: "0x1f7c1c8f2f8d85e8e6e3eb1ae3c8c3a9cfe6ff2e0c1e4d0c3d1a6f1e5e0d9c8b",
+			Height:    38207,
+			Index:     1,
+			View:      54477,
+		},
+		Views: []NodeView{{testNodeB, 54476}, {testNodeC, 54477}},
+	}
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"array", "[" + consensusStatus + "}, {" + prepareCache + "}, {" + rawPrepareCache + "}, " + consensusViews + "]"},
+		{"array with caches in the status", "[" + consensusStatus + "," + prepareCache + "," + rawPrepareCache + "}, " + consensusViews + "]"},
+		{"array with views first", "[" + consensusViews + ", {" + rawPrepareCache + "}, " + consensusStatus + "," + prepareCache + "}]"},
+		{"object", consensusStatus + "," + prepareCache + "," + rawPrepareCache + `, "views": ` + consensusViews + "}"},
+	}
+	for _, test := range tests {
+		var status ConsensusStatus
+		if err := json.Unmarshal([]byte(test.input), &status); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(&status, want) {
+			t.Errorf("%s: got %+v\nwant %+v", test.name, status, want)
+		}
+	}
+}
+
+func TestConsensusStatusInvalid(t *testing.T) {
+	for _, input := range []string{
+		`5`,
+		`[5]`,
+		`["status"]`,
+		`{"prepareCache_view": "x"}`,
+		`[{"currentView": "54477"}]`,
+	} {
+		var status ConsensusStatus
+		if err := json.Unmarshal([]byte(input), &status); err == nil {
+			t.Errorf("%s: decoded as %+v", input, status)
+		}
+	}
+}
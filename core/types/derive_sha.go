@@ -17,8 +17,6 @@
 package types
 
 import (
-	"bytes"
-
 	"github.com/chislab/go-fiscobcos/common"
 	"github.com/chislab/go-fiscobcos/rlp"
 	"github.com/chislab/go-fiscobcos/trie"
@@ -30,12 +28,12 @@ type DerivableList interface {
 }
 
 func DeriveSha(list DerivableList) common.Hash {
-	keybuf := new(bytes.Buffer)
+	keybuf := rlp.NewEncoderBuffer()
+	defer keybuf.Release()
 	trie := new(trie.Trie)
 	for i := 0; i < list.Len(); i++ {
-		keybuf.Reset()
-		rlp.Encode(keybuf, uint(i))
-		trie.Update(keybuf.Bytes(), list.GetRlp(i))
+		key, _ := keybuf.Encode(uint(i))
+		trie.Update(key, list.GetRlp(i))
 	}
 	return trie.Hash()
 }
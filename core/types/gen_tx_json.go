@@ -16,25 +16,33 @@ var _ = (*txdataMarshaling)(nil)
 // MarshalJSON marshals as JSON.
 func (t txdata) MarshalJSON() ([]byte, error) {
 	type txdata struct {
-		RandomId  hexutil.Uint64  `json:"randomid"    gencodec:"required"`
-		Price     *hexutil.Big    `json:"gasPrice" gencodec:"required"`
-		GasLimit  hexutil.Uint64  `json:"gas"      gencodec:"required"`
-		Recipient *common.Address `json:"to"       rlp:"nil"`
-		Amount    *hexutil.Big    `json:"value"    gencodec:"required"`
-		Payload   hexutil.Bytes   `json:"input"    gencodec:"required"`
-		V         *hexutil.Big    `json:"v" gencodec:"required"`
-		R         *hexutil.Big    `json:"r" gencodec:"required"`
-		S         *hexutil.Big    `json:"s" gencodec:"required"`
-		Hash      *common.Hash    `json:"hash" rlp:"-"`
+		RandomId   *hexutil.Big    `json:"randomid"    gencodec:"required"`
+		Price      *hexutil.Big    `json:"gasPrice" gencodec:"required"`
+		GasLimit   hexutil.Uint64  `json:"gas"      gencodec:"required"`
+		BlockLimit *hexutil.Big    `json:"blockLimit"      gencodec:"required"`
+		Recipient  *common.Address `json:"to"       rlp:"nil"`
+		Amount     *hexutil.Big    `json:"value"    gencodec:"required"`
+		Payload    hexutil.Bytes   `json:"input"    gencodec:"required"`
+		ChainId    *hexutil.Big    `json:"chainId"`
+		GroupId    *hexutil.Big    `json:"groupId"`
+		ExtraData  hexutil.Bytes   `json:"extraData"`
+		V          *txV            `json:"v" gencodec:"required"`
+		R          *hexutil.Big    `json:"r" gencodec:"required"`
+		S          *hexutil.Big    `json:"s" gencodec:"required"`
+		Hash       *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var enc txdata
-	enc.RandomId = hexutil.Uint64(t.RandomId)
+	enc.RandomId = (*hexutil.Big)(t.RandomId)
 	enc.Price = (*hexutil.Big)(t.Price)
 	enc.GasLimit = hexutil.Uint64(t.GasLimit)
+	enc.BlockLimit = (*hexutil.Big)(t.BlockLimit)
 	enc.Recipient = t.Recipient
 	enc.Amount = (*hexutil.Big)(t.Amount)
 	enc.Payload = t.Payload
-	enc.V = (*hexutil.Big)(t.V)
+	enc.ChainId = (*hexutil.Big)(t.ChainId)
+	enc.GroupId = (*hexutil.Big)(t.GroupId)
+	enc.ExtraData = t.ExtraData
+	enc.V = (*txV)(t.V)
 	enc.R = (*hexutil.Big)(t.R)
 	enc.S = (*hexutil.Big)(t.S)
 	enc.Hash = t.Hash
@@ -44,25 +52,29 @@ func (t txdata) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON unmarshals from JSON.
 func (t *txdata) UnmarshalJSON(input []byte) error {
 	type txdata struct {
-		RandomId  *hexutil.Uint64 `json:"randomid"    gencodec:"required"`
-		Price     *hexutil.Big    `json:"gasPrice" gencodec:"required"`
-		GasLimit  *hexutil.Uint64 `json:"gas"      gencodec:"required"`
-		Recipient *common.Address `json:"to"       rlp:"nil"`
-		Amount    *hexutil.Big    `json:"value"    gencodec:"required"`
-		Payload   *hexutil.Bytes  `json:"input"    gencodec:"required"`
-		V         *hexutil.Big    `json:"v" gencodec:"required"`
-		R         *hexutil.Big    `json:"r" gencodec:"required"`
-		S         *hexutil.Big    `json:"s" gencodec:"required"`
-		Hash      *common.Hash    `json:"hash" rlp:"-"`
+		RandomId   *hexutil.Big    `json:"randomid"    gencodec:"required"`
+		Price      *hexutil.Big    `json:"gasPrice" gencodec:"required"`
+		GasLimit   *hexutil.Uint64 `json:"gas"      gencodec:"required"`
+		BlockLimit *hexutil.Big    `json:"blockLimit"      gencodec:"required"`
+		Recipient  *common.Address `json:"to"       rlp:"nil"`
+		Amount     *hexutil.Big    `json:"value"    gencodec:"required"`
+		Payload    *hexutil.Bytes  `json:"input"    gencodec:"required"`
+		ChainId    *hexutil.Big    `json:"chainId"`
+		GroupId    *hexutil.Big    `json:"groupId"`
+		ExtraData  *hexutil.Bytes  `json:"extraData"`
+		V          *txV            `json:"v" gencodec:"required"`
+		R          *hexutil.Big    `json:"r" gencodec:"required"`
+		S          *hexutil.Big    `json:"s" gencodec:"required"`
+		Hash       *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var dec txdata
 	if err := json.Unmarshal(input, &dec); err != nil {
 		return err
 	}
 	if dec.RandomId == nil {
-		return errors.New("missing required field 'nonce' for txdata")
+		return errors.New("missing required field 'randomid' for txdata")
 	}
-	t.RandomId = uint64(*dec.RandomId)
+	t.RandomId = (*big.Int)(dec.RandomId)
 	if dec.Price == nil {
 		return errors.New("missing required field 'gasPrice' for txdata")
 	}
@@ -71,6 +83,10 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 'gas' for txdata")
 	}
 	t.GasLimit = uint64(*dec.GasLimit)
+	if dec.BlockLimit == nil {
+		return errors.New("missing required field 'blockLimit' for txdata")
+	}
+	t.BlockLimit = (*big.Int)(dec.BlockLimit)
 	if dec.Recipient != nil {
 		t.Recipient = dec.Recipient
 	}
@@ -82,6 +98,15 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 'input' for txdata")
 	}
 	t.Payload = *dec.Payload
+	if dec.ChainId != nil {
+		t.ChainId = (*big.Int)(dec.ChainId)
+	}
+	if dec.GroupId != nil {
+		t.GroupId = (*big.Int)(dec.GroupId)
+	}
+	if dec.ExtraData != nil {
+		t.ExtraData = *dec.ExtraData
+	}
 	if dec.V == nil {
 		return errors.New("missing required field 'v' for txdata")
 	}
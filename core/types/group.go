@@ -0,0 +1,51 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// GroupParams configures a group created with generateGroup.
+type GroupParams struct {
+	Timestamp         uint64   `json:"timestamp,string"` // genesis timestamp in milliseconds
+	Sealers           []string `json:"sealers"`          // node ids of the initial sealers
+	EnableFreeStorage bool     `json:"enable_free_storage"`
+}
+
+// Group statuses reported by queryGroupStatus.
+const (
+	GroupStatusInexistent = "INEXISTENT"
+	GroupStatusStopping   = "STOPPING"
+	GroupStatusRunning    = "RUNNING"
+	GroupStatusStopped    = "STOPPED"
+	GroupStatusDeleted    = "DELETED"
+
+	// GroupStatusUnknown is reported for the groups of nodes before 2.2,
+	// which have no queryGroupStatus.
+	GroupStatusUnknown = "unknown"
+)
+
+// GroupInfo describes a group of the node.
+type GroupInfo struct {
+	ID          uint64 `json:"id"`
+	Status      string `json:"status"`      // one of the GroupStatus constants
+	GenesisHash string `json:"genesisHash"` // empty unless the group is running
+}
+
+// GroupOpResult is the result of a group management operation.
+type GroupOpResult struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status,omitempty"` // only set by queryGroupStatus
+}
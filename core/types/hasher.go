@@ -0,0 +1,89 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"hash"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// keccakState is the Keccak256 hasher, which can read out the hash without
+// copying its state as Sum does.
+type keccakState interface {
+	hash.Hash
+	Read([]byte) (int, error)
+}
+
+// hasher is a pooled hash state, together with the hash it is read out into:
+// a local would escape to the heap.
+type hasher struct {
+	state hash.Hash
+	pool  *sync.Pool
+	sum   common.Hash
+}
+
+var (
+	keccakPool = sync.Pool{New: func() interface{} { return &hasher{state: sha3.NewLegacyKeccak256()} }}
+	sm3Pool    = sync.Pool{New: func() interface{} { return &hasher{state: gm.NewSM3()} }}
+)
+
+// newHasher takes a reset hasher for mode from its pool. Hand it back with
+// release once its hash has been read.
+func newHasher(mode ChainMode) *hasher {
+	pool := &keccakPool
+	if mode == ChainModeGM {
+		pool = &sm3Pool
+	}
+	h := pool.Get().(*hasher)
+	h.pool = pool
+	h.state.Reset()
+	return h
+}
+
+func (h *hasher) release() { h.pool.Put(h) }
+
+// hash returns the hash of everything written so far.
+func (h *hasher) hash() common.Hash {
+	if s, ok := h.state.(keccakState); ok {
+		s.Read(h.sum[:])
+	} else {
+		h.state.Sum(h.sum[:0])
+	}
+	return h.sum
+}
+
+// rlpHashFor hashes the RLP encoding of x with the hash function of mode.
+func rlpHashFor(x interface{}, mode ChainMode) common.Hash {
+	h := newHasher(mode)
+	defer h.release()
+	rlp.Encode(h.state, x)
+	return h.hash()
+}
+
+func rlpHash(x interface{}) common.Hash {
+	return rlpHashFor(x, ChainModeStandard)
+}
+
+// sm3RlpHash is rlpHash for guomi chains, which hash with SM3.
+func sm3RlpHash(x interface{}) common.Hash {
+	return rlpHashFor(x, ChainModeGM)
+}
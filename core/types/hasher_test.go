@@ -0,0 +1,213 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/rand"
+	"fmt"
+	"hash"
+	"math/big"
+	mrand "math/rand"
+	"sync"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// The hashers as they were before they were pooled, allocating a state for
+// every hash. They check the pooled ones and are the baseline of the
+// benchmarks.
+
+// unpooledRlpHash is rlpHash as it was before its hasher was pooled.
+func unpooledRlpHash(x interface{}) (h common.Hash) {
+	hw := sha3.NewLegacyKeccak256()
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
+
+// unpooledSm3RlpHash is sm3RlpHash as it was before its hasher was pooled.
+func unpooledSm3RlpHash(x interface{}) (h common.Hash) {
+	hw := gm.NewSM3()
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
+
+// unpooledMerkleRoot is merkleRoot as it was before its hasher was pooled.
+func unpooledMerkleRoot(hashes []common.Hash, mode ChainMode) common.Hash {
+	newHasher := func() hash.Hash { return sha3.NewLegacyKeccak256() }
+	if mode == ChainModeGM {
+		newHasher = gm.NewSM3
+	}
+	sum := func(data ...[]byte) []byte {
+		h := newHasher()
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	if len(hashes) == 0 {
+		return common.BytesToHash(sum())
+	}
+	level := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		index, _ := rlp.EncodeToBytes(uint(i))
+		level[i] = append(index, h[:]...)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, (len(level)+rootFanout-1)/rootFanout)
+		for i := range next {
+			end := (i + 1) * rootFanout
+			if end > len(level) {
+				end = len(level)
+			}
+			next[i] = sum(level[i*rootFanout : end]...)
+		}
+		level = next
+	}
+	return common.BytesToHash(sum(level[0]))
+}
+
+// benchHashes returns n transaction hashes for the merkle root benchmarks.
+func benchHashes(n int) []common.Hash {
+	hashes := make([]common.Hash, n)
+	for i := range hashes {
+		hashes[i] = common.BigToHash(big.NewInt(int64(i + 1)))
+	}
+	return hashes
+}
+
+// benchHeader returns the RLP form of a header with four sealers, the shape
+// of the headers of a typical four node group.
+func benchHeader() *headerRLP {
+	h := &headerRLP{
+		ParentHash:       common.HexToHash("0x5f2dbd7ed8b8b3c6b5a3d2e0f1a9c8b7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1"),
+		StateRoot:        common.HexToHash("0x1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f809"),
+		TransactionsRoot: common.HexToHash("0x9f8e7d6c5b4a39281706f5e4d3c2b1a09f8e7d6c5b4a39281706f5e4d3c2b1a0"),
+		ReceiptsRoot:     common.HexToHash("0x0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"),
+		DbHash:           common.HexToHash("0xa1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"),
+		Number:           1234567,
+		GasLimit:         big.NewInt(0),
+		GasUsed:          big.NewInt(2100000),
+		Timestamp:        1571200000000,
+		ExtraData:        [][]byte{},
+		Sealer:           big.NewInt(2),
+	}
+	for i := 0; i < 4; i++ {
+		id := make([]byte, 64)
+		id[0] = byte(i + 1)
+		h.SealerList = append(h.SealerList, id)
+	}
+	return h
+}
+
+// TestHasherConcurrent hashes transactions from 64 goroutines with the pooled
+// hashers, for the race detector, checking the hashes against the unpooled
+// ones.
+func TestHasherConcurrent(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	gmKey, _ := gm.GenerateKey(rand.Reader)
+	rnd := mrand.New(mrand.NewSource(1))
+	var (
+		txs  []*Transaction
+		want []common.Hash
+	)
+	for i := 0; i < 64; i++ {
+		if i%2 == 0 {
+			tx := randTransaction(t, rnd, ChainModeStandard, key)
+			txs, want = append(txs, tx), append(want, unpooledRlpHash(tx))
+		} else {
+			tx := randTransaction(t, rnd, ChainModeGM, gmKey)
+			txs, want = append(txs, tx), append(want, unpooledSm3RlpHash(tx))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				k := (g + i) % len(txs)
+				mode := ChainModeStandard
+				if k%2 == 1 {
+					mode = ChainModeGM
+				}
+				if h := rlpHashFor(txs[k], mode); h != want[k] {
+					t.Errorf("goroutine %d: tx %d hashed to %x, want %x", g, k, h, want[k])
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestMerkleRootPooled checks the roots computed with the pooled hashers
+// against the unpooled ones, for trees of one to three levels.
+func TestMerkleRootPooled(t *testing.T) {
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		for _, n := range []int{0, 1, 2, 16, 17, 256, 257} {
+			hashes := benchHashes(n)
+			if have, want := merkleRoot(hashes, mode), unpooledMerkleRoot(hashes, mode); have != want {
+				t.Errorf("mode %v, %d hashes: root %x, want %x", mode, n, have, want)
+			}
+		}
+	}
+}
+
+func benchmarkHash(b *testing.B, hash func(interface{}) common.Hash) {
+	h := benchHeader()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash(h)
+	}
+}
+
+func BenchmarkRlpHash(b *testing.B) {
+	b.Run("unpooled", func(b *testing.B) { benchmarkHash(b, unpooledRlpHash) })
+	b.Run("pooled", func(b *testing.B) { benchmarkHash(b, rlpHash) })
+}
+
+func BenchmarkSm3RlpHash(b *testing.B) {
+	b.Run("unpooled", func(b *testing.B) { benchmarkHash(b, unpooledSm3RlpHash) })
+	b.Run("pooled", func(b *testing.B) { benchmarkHash(b, sm3RlpHash) })
+}
+
+// BenchmarkMerkleRoot computes the roots of blocks of 1000 transactions.
+func BenchmarkMerkleRoot(b *testing.B) {
+	hashes := benchHashes(1000)
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		for _, root := range []struct {
+			name string
+			fn   func([]common.Hash, ChainMode) common.Hash
+		}{{"unpooled", unpooledMerkleRoot}, {"pooled", merkleRoot}} {
+			b.Run(fmt.Sprintf("%v/%s", mode, root.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					root.fn(hashes, mode)
+				}
+			})
+		}
+	}
+}
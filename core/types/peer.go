@@ -0,0 +1,63 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "encoding/json"
+
+// PeerStatus is a node connected to the node answering getPeers.
+type PeerStatus struct {
+	Agency    string   `json:"Agency"`    // agency of the node certificate
+	Node      string   `json:"Node"`      // node name of the node certificate
+	NodeID    string   `json:"NodeID"`    // node id
+	IPAndPort string   `json:"IPAndPort"` // endpoint of the connection
+	Topics    []string `json:"Topic"`     // AMOP topics subscribed by the node's clients
+}
+
+// UnmarshalJSON decodes a getPeers entry. Topics are strings or, on some
+// releases, objects naming the topic.
+func (p *PeerStatus) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Agency    string            `json:"Agency"`
+		Node      string            `json:"Node"`
+		NodeID    string            `json:"NodeID"`
+		IPAndPort string            `json:"IPAndPort"`
+		Topic     []json.RawMessage `json:"Topic"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*p = PeerStatus{
+		Agency:    dec.Agency,
+		Node:      dec.Node,
+		NodeID:    dec.NodeID,
+		IPAndPort: dec.IPAndPort,
+	}
+	for _, raw := range dec.Topic {
+		var topic string
+		if err := json.Unmarshal(raw, &topic); err != nil {
+			var obj struct {
+				Topic string `json:"topic"`
+			}
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				return err
+			}
+			topic = obj.Topic
+		}
+		p.Topics = append(p.Topics, topic)
+	}
+	return nil
+}
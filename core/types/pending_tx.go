@@ -0,0 +1,128 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// PendingTx is a transaction waiting in the transaction pool of a node.
+type PendingTx struct {
+	From     common.Address
+	Gas      uint64
+	GasPrice *big.Int
+	Hash     common.Hash
+	Input    []byte
+	Nonce    *big.Int        // random nonce chosen by the sender
+	To       *common.Address // called contract, nil for deployments
+	Value    *big.Int
+}
+
+// pendingTxJSON is the encoding of pending transactions by the node. Numbers
+// are hex strings, the called contract of deployments is left empty or sent as
+// the zero address.
+type pendingTxJSON struct {
+	From     common.Address `json:"from"`
+	Gas      string         `json:"gas"`
+	GasPrice string         `json:"gasPrice"`
+	Hash     common.Hash    `json:"hash"`
+	Input    hexutil.Bytes  `json:"input"`
+	Nonce    string         `json:"nonce"`
+	To       string         `json:"to"`
+	Value    string         `json:"value"`
+}
+
+// MarshalJSON encodes the transaction the way the node does.
+func (tx *PendingTx) MarshalJSON() ([]byte, error) {
+	enc := pendingTxJSON{
+		From:     tx.From,
+		Gas:      hexutil.EncodeUint64(tx.Gas),
+		GasPrice: encodePendingBig(tx.GasPrice),
+		Hash:     tx.Hash,
+		Input:    tx.Input,
+		Nonce:    encodePendingBig(tx.Nonce),
+		Value:    encodePendingBig(tx.Value),
+	}
+	if tx.To != nil {
+		enc.To = tx.To.Hex()
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON decodes a pending transaction as returned by the node. Numbers
+// left out stay nil or zero.
+func (tx *PendingTx) UnmarshalJSON(input []byte) error {
+	var dec pendingTxJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	dst := PendingTx{From: dec.From, Hash: dec.Hash, Input: dec.Input}
+	gas, err := decodePendingBig("gas", dec.Gas)
+	if err != nil {
+		return err
+	}
+	if gas != nil {
+		if !gas.IsUint64() {
+			return fmt.Errorf("invalid pending transaction gas %q", dec.Gas)
+		}
+		dst.Gas = gas.Uint64()
+	}
+	if dst.GasPrice, err = decodePendingBig("gasPrice", dec.GasPrice); err != nil {
+		return err
+	}
+	if dst.Nonce, err = decodePendingBig("nonce", dec.Nonce); err != nil {
+		return err
+	}
+	if dst.Value, err = decodePendingBig("value", dec.Value); err != nil {
+		return err
+	}
+	if dec.To != "" {
+		b, err := hexutil.Decode(dec.To)
+		if err != nil || len(b) != common.AddressLength {
+			return fmt.Errorf("invalid pending transaction to %q", dec.To)
+		}
+		dst.To = nonZeroAddress(common.BytesToAddress(b))
+	}
+	*tx = dst
+	return nil
+}
+
+// decodePendingBig decodes a number of a pending transaction, nil if left out.
+// Nodes send hex numbers, with leading zeros for random nonces; decimal ones are
+// accepted as well.
+func decodePendingBig(field, s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, err := hexutil.DecodeFlexibleBig(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pending transaction %s %q", field, s)
+	}
+	return n, nil
+}
+
+func encodePendingBig(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return hexutil.EncodeBig(n)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+func TestPendingTxJSON(t *testing.T) {
+	const (
+		from = "0x148947262ec5e21739fe3a931c29e8b84ee34a0f"
+		to   = "0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1"
+		hash = "0x4d2f8e0f8e0e6c6b7a4e3b2f1c0d9e8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e"
+	)
+	pending := func(fields string) string {
+		return `{"from":"` + from + `","hash":"` + hash + `"` + fields + `}`
+	}
+	tests := []struct {
+		name     string
+		json     string
+		gas      uint64
+		gasPrice string // decimal, empty for nil
+		nonce    string
+		value    string
+		to       string // empty for a deployment
+		input    string
+		err      string
+	}{
+		{
+			name:     "call",
+			json:     pending(`,"gas":"0x11e1a300","gasPrice":"0x11e1a300","nonce":"0x1be2f8a0d3","value":"0x0","to":"` + to + `","input":"0xa9059cbb"`),
+			gas:      300000000,
+			gasPrice: "300000000",
+			nonce:    "119772061907",
+			value:    "0",
+			to:       to,
+			input:    "0xa9059cbb",
+		},
+		{
+			name:  "random nonce with leading zeros",
+			json:  pending(`,"nonce":"0x0000000000000000000000000000000000000000000000000000000000bc614e","to":"` + to + `"`),
+			nonce: "12345678",
+			to:    to,
+		},
+		{
+			name:  "decimal numbers",
+			json:  pending(`,"gas":"21000","value":"1000000000000000000000"`),
+			gas:   21000,
+			value: "1000000000000000000000",
+		},
+		{name: "deployment without to", json: pending(`,"to":"","input":"0x6080"`), input: "0x6080"},
+		{name: "deployment to zero", json: pending(`,"to":"0x0000000000000000000000000000000000000000"`)},
+		{name: "fields left out", json: pending("")},
+		{name: "invalid nonce", json: pending(`,"nonce":"0xzz"`), err: "invalid pending transaction nonce"},
+		{name: "gas overflow", json: pending(`,"gas":"0x10000000000000000"`), err: "invalid pending transaction gas"},
+		{name: "short to", json: pending(`,"to":"0x6849"`), err: "invalid pending transaction to"},
+	}
+	for _, test := range tests {
+		var tx PendingTx
+		err := json.Unmarshal([]byte(test.json), &tx)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if tx.From != common.HexToAddress(from) || tx.Hash != common.HexToHash(hash) || tx.Gas != test.gas {
+			t.Errorf("%s: got from %s, hash %s, gas %d", test.name, tx.From.Hex(), tx.Hash.Hex(), tx.Gas)
+		}
+		for _, n := range []struct {
+			field string
+			have  *big.Int
+			want  string
+		}{{"gasPrice", tx.GasPrice, test.gasPrice}, {"nonce", tx.Nonce, test.nonce}, {"value", tx.Value, test.value}} {
+			if (n.have == nil) != (n.want == "") || (n.have != nil && n.have.String() != n.want) {
+				t.Errorf("%s: got %s %v, want %q", test.name, n.field, n.have, n.want)
+			}
+		}
+		if (tx.To == nil) != (test.to == "") || (tx.To != nil && *tx.To != common.HexToAddress(test.to)) {
+			t.Errorf("%s: got to %v, want %q", test.name, tx.To, test.to)
+		}
+		if common.ToHex(tx.Input) != common.ToHex(common.FromHex(test.input)) {
+			t.Errorf("%s: got input %x, want %s", test.name, tx.Input, test.input)
+		}
+
+		// The transaction survives encoding.
+		enc, err := json.Marshal(&tx)
+		if err != nil {
+			t.Errorf("%s: encoding: %v", test.name, err)
+			continue
+		}
+		var dec PendingTx
+		if err := json.Unmarshal(enc, &dec); err != nil {
+			t.Errorf("%s: decoding %s: %v", test.name, enc, err)
+			continue
+		}
+		if reenc, _ := json.Marshal(&dec); string(reenc) != string(enc) {
+			t.Errorf("%s: encoding changed after decoding:\n%s\n%s", test.name, enc, reenc)
+		}
+	}
+}
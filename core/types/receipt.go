@@ -18,21 +18,20 @@ package types
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/chislab/go-fiscobcos/common/hexutil"
 	"io"
 	"math/big"
 	"unsafe"
 
 	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
 	"github.com/chislab/go-fiscobcos/crypto"
 	"github.com/chislab/go-fiscobcos/params"
 	"github.com/chislab/go-fiscobcos/rlp"
 )
 
-//go:generate gencodec -type Receipt -field-override receiptMarshaling -out gen_receipt_json.go
-
 var (
 	receiptStatusFailedRLP     = []byte{}
 	receiptStatusSuccessfulRLP = []byte{0x01}
@@ -40,34 +39,196 @@ var (
 
 const (
 	// ReceiptStatusFailed is the status code of a transaction if execution failed.
-	ReceiptStatusFailed = string(1)
+	ReceiptStatusFailed = "0x1"
 
 	// ReceiptStatusSuccessful is the status code of a transaction if execution succeeded.
-	ReceiptStatusSuccessful = string(0)
+	ReceiptStatusSuccessful = "0x0"
 )
 
 // Receipt represents the results of a transaction.
 type Receipt struct {
+	BlockHash       common.Hash
+	BlockNumber     uint64
+	ContractAddress *common.Address // deployed contract, nil if the transaction isn't a deployment
+	From            common.Address
+	GasUsed         uint64
+	Input           []byte
+	Logs            []*Log
+	Bloom           Bloom
+	Output          []byte
+	Root            common.Hash     // state root after the transaction, zero if not reported
+	Status          string          // execution status as hex number, see StatusCode
+	To              *common.Address // called contract, nil for deployments
+	TxHash          common.Hash
+	TxIndex         uint
+
+	// Raw is the response the receipt was decoded from, see Block.Raw. It
+	// isn't encoded, neither in JSON nor for storage.
+	Raw json.RawMessage
+}
+
+// receiptJSON is the encoding of receipts by the node. Numbers are hex strings
+// and missing addresses are sent as the zero address.
+type receiptJSON struct {
 	BlockHash       common.Hash    `json:"blockHash"`
 	BlockNumber     string         `json:"blockNumber"`
-	ContractAddress common.Address `json:"contractAddress"`
-	From            string         `json:"from"`
+	ContractAddress string         `json:"contractAddress"`
+	From            common.Address `json:"from"`
 	GasUsed         string         `json:"gasUsed"`
-	Input           string         `json:"input"`
+	Input           hexutil.Bytes  `json:"input"`
 	Logs            []*Log         `json:"logs"`
 	Bloom           Bloom          `json:"logsBloom"`
-	Output          string         `json:"output"`
+	Output          hexutil.Bytes  `json:"output"`
+	Root            string         `json:"root"`
+	StateRoot       string         `json:"stateRoot,omitempty"` // spelling of some 2.x nodes
 	Status          string         `json:"status"`
 	To              string         `json:"to"`
 	TxHash          common.Hash    `json:"transactionHash"`
 	TxIndex         string         `json:"transactionIndex"`
 }
 
-// receiptRLP is the consensus encoding of a receipt.
-type receiptRLP struct {
-	PostStateOrStatus []byte
-	Bloom             Bloom
-	Logs              []*Log
+// MarshalJSON encodes the receipt the way the node does, so that it decodes
+// to the same receipt.
+func (r *Receipt) MarshalJSON() ([]byte, error) {
+	enc := receiptJSON{
+		BlockHash:       r.BlockHash,
+		BlockNumber:     hexutil.EncodeUint64(r.BlockNumber),
+		ContractAddress: optionalAddress(r.ContractAddress),
+		From:            r.From,
+		GasUsed:         hexutil.EncodeUint64(r.GasUsed),
+		Input:           r.Input,
+		Logs:            r.Logs,
+		Bloom:           r.Bloom,
+		Output:          r.Output,
+		Root:            r.Root.Hex(),
+		Status:          r.Status,
+		To:              optionalAddress(r.To),
+		TxHash:          r.TxHash,
+		TxIndex:         hexutil.EncodeUint64(uint64(r.TxIndex)),
+	}
+	if enc.Logs == nil {
+		enc.Logs = []*Log{}
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON decodes a receipt as returned by the node and fills the derived
+// fields of its logs, which the node leaves out, from the enclosing receipt.
+// Log indexes are positions within the receipt. Fields left out, as by the
+// batch receipt retrieval, stay zero.
+func (r *Receipt) UnmarshalJSON(input []byte) error {
+	var dec receiptJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	blockNumber, err := optionalUint64("blockNumber", dec.BlockNumber)
+	if err != nil {
+		return err
+	}
+	gasUsed, err := optionalUint64("gasUsed", dec.GasUsed)
+	if err != nil {
+		return err
+	}
+	txIndex, err := optionalUint64("transactionIndex", dec.TxIndex)
+	if err != nil {
+		return err
+	}
+	contractAddress, err := parseOptionalAddress("contractAddress", dec.ContractAddress)
+	if err != nil {
+		return err
+	}
+	to, err := parseOptionalAddress("to", dec.To)
+	if err != nil {
+		return err
+	}
+	root := dec.Root
+	if root == "" {
+		root = dec.StateRoot
+	}
+	var rootHash common.Hash
+	if root != "" {
+		b, err := hexutil.Decode(root)
+		if err != nil || len(b) > common.HashLength {
+			return fmt.Errorf("invalid receipt root %q", root)
+		}
+		rootHash = common.BytesToHash(b)
+	}
+	*r = Receipt{
+		BlockHash:       dec.BlockHash,
+		BlockNumber:     blockNumber,
+		ContractAddress: contractAddress,
+		From:            dec.From,
+		GasUsed:         gasUsed,
+		Input:           dec.Input,
+		Logs:            dec.Logs,
+		Bloom:           dec.Bloom,
+		Output:          dec.Output,
+		Root:            rootHash,
+		Status:          dec.Status,
+		To:              to,
+		TxHash:          dec.TxHash,
+		TxIndex:         uint(txIndex),
+	}
+	return r.deriveLogFields()
+}
+
+// deriveLogFields copies the block and transaction location of the receipt into
+// its logs.
+func (r *Receipt) deriveLogFields() error {
+	for i, log := range r.Logs {
+		if log == nil {
+			return fmt.Errorf("missing log %d in receipt", i)
+		}
+		log.BlockNumber = r.BlockNumber
+		log.BlockHash = r.BlockHash
+		log.TxHash = r.TxHash
+		log.TxIndex = r.TxIndex
+		log.Index = uint(i)
+	}
+	return nil
+}
+
+// optionalUint64 decodes a number field of a receipt, hex or decimal, zero if
+// left out.
+func optionalUint64(field, s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := hexutil.DecodeFlexibleUint64(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid receipt %s: %v", field, err)
+	}
+	return n, nil
+}
+
+// parseOptionalAddress decodes an address field of a receipt, nil if left out
+// or zero.
+func parseOptionalAddress(field, s string) (*common.Address, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.AddressLength {
+		return nil, fmt.Errorf("invalid receipt %s %q", field, s)
+	}
+	return nonZeroAddress(common.BytesToAddress(b)), nil
+}
+
+// nonZeroAddress returns a pointer to addr, nil if it is zero.
+func nonZeroAddress(addr common.Address) *common.Address {
+	if addr == (common.Address{}) {
+		return nil
+	}
+	return &addr
+}
+
+// optionalAddress encodes an address field of a receipt, the zero address if
+// there is none.
+func optionalAddress(addr *common.Address) string {
+	if addr == nil {
+		return common.Address{}.Hex()
+	}
+	return addr.Hex()
 }
 
 // storedReceiptRLP is the storage encoding of a receipt.
@@ -82,7 +243,7 @@ type v4StoredReceiptRLP struct {
 	TxHash            common.Hash
 	ContractAddress   common.Address
 	Logs              []*LogForStorage
-	GasUsed           string
+	GasUsed           uint64
 }
 
 // v3StoredReceiptRLP is the original storage encoding of a receipt including some unnecessary fields.
@@ -92,7 +253,7 @@ type v3StoredReceiptRLP struct {
 	TxHash            common.Hash
 	ContractAddress   common.Address
 	Logs              []*LogForStorage
-	GasUsed           string
+	GasUsed           uint64
 }
 
 // NewReceipt creates a barebone transaction receipt, copying the init fields.
@@ -106,26 +267,6 @@ func NewReceipt(root []byte, failed bool, cumulativeGasUsed string) *Receipt {
 	return r
 }
 
-// EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
-// into an RLP stream. If no post state is present, byzantium fork is assumed.
-func (r *Receipt) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &receiptRLP{r.statusEncoding(), r.Bloom, r.Logs})
-}
-
-// DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
-// from an RLP stream.
-func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
-	var dec receiptRLP
-	if err := s.Decode(&dec); err != nil {
-		return err
-	}
-	if err := r.setStatus(dec.PostStateOrStatus); err != nil {
-		return err
-	}
-	r.Bloom, r.Logs = dec.Bloom, dec.Logs
-	return nil
-}
-
 func (r *Receipt) setStatus(postStateOrStatus []byte) error {
 	switch {
 	case bytes.Equal(postStateOrStatus, receiptStatusSuccessfulRLP):
@@ -138,13 +279,6 @@ func (r *Receipt) setStatus(postStateOrStatus []byte) error {
 	return nil
 }
 
-func (r *Receipt) statusEncoding() []byte {
-	if r.Status == ReceiptStatusFailed {
-		return receiptStatusFailedRLP
-	}
-	return receiptStatusSuccessfulRLP
-}
-
 // Size returns the approximate memory used by all internal contents. It is used
 // to approximate and limit the memory consumption of various caches.
 func (r *Receipt) Size() common.StorageSize {
@@ -157,21 +291,15 @@ func (r *Receipt) Size() common.StorageSize {
 	return size
 }
 
-// ReceiptForStorage is a wrapper around a Receipt that flattens and parses the
-// entire content of a receipt, as opposed to only the consensus fields originally.
+// ReceiptForStorage is a wrapper around a Receipt that reads, besides the
+// storage encoding of receipts, the earlier storage encodings of go-ethereum,
+// which hold only part of a receipt.
 type ReceiptForStorage Receipt
 
-// EncodeRLP implements rlp.Encoder, and flattens all content fields of a receipt
-// into an RLP stream.
+// EncodeRLP implements rlp.Encoder, writing the storage encoding of the
+// receipt, see Receipt.EncodeRLP.
 func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
-	enc := &storedReceiptRLP{
-		PostStateOrStatus: (*Receipt)(r).statusEncoding(),
-		Logs:              make([]*LogForStorage, len(r.Logs)),
-	}
-	for i, log := range r.Logs {
-		enc.Logs[i] = (*LogForStorage)(log)
-	}
-	return rlp.Encode(w, enc)
+	return (*Receipt)(r).EncodeRLP(w)
 }
 
 // DecodeRLP implements rlp.Decoder, and loads both consensus and implementation
@@ -182,8 +310,10 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 	if err != nil {
 		return err
 	}
-	// Try decoding from the newest format for future proofness, then the older one
-	// for old nodes that just upgraded. V4 was an intermediate unreleased format so
+	if err := rlp.DecodeBytes(blob, (*Receipt)(r)); err == nil {
+		return nil
+	}
+	// Fall back to the go-ethereum formats, the newest one first. V4 was an intermediate unreleased format so
 	// we do need to decode it, but it's not common (try last).
 	if err := decodeStoredReceiptRLP(r, blob); err == nil {
 		return nil
@@ -220,7 +350,7 @@ func decodeV4StoredReceiptRLP(r *ReceiptForStorage, blob []byte) error {
 		return err
 	}
 	r.TxHash = stored.TxHash
-	r.ContractAddress = stored.ContractAddress
+	r.ContractAddress = nonZeroAddress(stored.ContractAddress)
 	r.GasUsed = stored.GasUsed
 	r.Logs = make([]*Log, len(stored.Logs))
 	for i, log := range stored.Logs {
@@ -241,7 +371,7 @@ func decodeV3StoredReceiptRLP(r *ReceiptForStorage, blob []byte) error {
 	}
 	r.Bloom = stored.Bloom
 	r.TxHash = stored.TxHash
-	r.ContractAddress = stored.ContractAddress
+	r.ContractAddress = nonZeroAddress(stored.ContractAddress)
 	r.GasUsed = stored.GasUsed
 	r.Logs = make([]*Log, len(stored.Logs))
 	for i, log := range stored.Logs {
@@ -280,14 +410,15 @@ func (r Receipts) DeriveFields(config *params.ChainConfig, hash common.Hash, num
 
 		// block location fields
 		r[i].BlockHash = hash
-		r[i].BlockNumber = hexutil.EncodeUint64(number)
-		r[i].TxIndex = string(i)
+		r[i].BlockNumber = number
+		r[i].TxIndex = uint(i)
 
 		// The contract address can be derived from the transaction itself
 		if txs[i].To() == nil {
 			// Deriving the signer is expensive, only do if it's actually needed
 			from, _ := Sender(signer, txs[i])
-			r[i].ContractAddress = crypto.CreateAddress(from, txs[i].RandomId())
+			addr := createAddress(from, txs[i].RandomId())
+			r[i].ContractAddress = &addr
 		}
 		// The derived log fields can simply be set from the block and transaction
 		for j := 0; j < len(r[i].Logs); j++ {
@@ -301,3 +432,10 @@ func (r Receipts) DeriveFields(config *params.ChainConfig, hash common.Hash, num
 	}
 	return nil
 }
+
+// createAddress derives the address of a contract deployed by from with the
+// given transaction random id.
+func createAddress(from common.Address, randomId *big.Int) common.Address {
+	data, _ := rlp.EncodeToBytes([]interface{}{from, randomId})
+	return common.BytesToAddress(crypto.Keccak256(data)[12:])
+}
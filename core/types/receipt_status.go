@@ -0,0 +1,203 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// Execution status codes of FISCO BCOS transaction receipts.
+const (
+	StatusSuccess                    = 0x0
+	StatusUnknown                    = 0x1
+	StatusBadRLP                     = 0x2
+	StatusInvalidFormat              = 0x3
+	StatusOutOfGasIntrinsic          = 0x4
+	StatusInvalidSignature           = 0x5
+	StatusInvalidNonce               = 0x6
+	StatusNotEnoughCash              = 0x7
+	StatusOutOfGasBase               = 0x8
+	StatusBlockGasLimitReached       = 0x9
+	StatusBadInstruction             = 0xa
+	StatusBadJumpDestination         = 0xb
+	StatusOutOfGas                   = 0xc
+	StatusOutOfStack                 = 0xd
+	StatusStackUnderflow             = 0xe
+	StatusNonceCheckFail             = 0xf
+	StatusBlockLimitCheckFail        = 0x10
+	StatusFilterCheckFail            = 0x11
+	StatusNoDeployPermission         = 0x12
+	StatusNoCallPermission           = 0x13
+	StatusNoTxPermission             = 0x14
+	StatusPrecompiledError           = 0x15
+	StatusRevertInstruction          = 0x16
+	StatusInvalidZeroSignatureFormat = 0x17
+	StatusAddressAlreadyUsed         = 0x18
+	StatusPermissionDenied           = 0x19
+	StatusCallAddressError           = 0x1a
+	StatusGasOverflow                = 0x1b
+	StatusTxPoolIsFull               = 0x1c
+	StatusTransactionRefused         = 0x1d
+	StatusContractFrozen             = 0x1e
+	StatusAccountFrozen              = 0x1f
+	StatusAlreadyKnown               = 10000
+	StatusAlreadyInChain             = 10001
+	StatusInvalidChainId             = 10002
+	StatusInvalidGroupId             = 10003
+	StatusRequestNotBelongToTheGroup = 10004
+	StatusMalformedTx                = 10005
+	StatusOverGroupMemoryLimit       = 10006
+)
+
+// statusMessages describes the execution status codes.
+var statusMessages = map[int]string{
+	StatusSuccess:                    "Success",
+	StatusUnknown:                    "Unknown",
+	StatusBadRLP:                     "BadRLP",
+	StatusInvalidFormat:              "InvalidFormat",
+	StatusOutOfGasIntrinsic:          "OutOfGasIntrinsic",
+	StatusInvalidSignature:           "InvalidSignature",
+	StatusInvalidNonce:               "InvalidNonce",
+	StatusNotEnoughCash:              "NotEnoughCash",
+	StatusOutOfGasBase:               "OutOfGasBase",
+	StatusBlockGasLimitReached:       "BlockGasLimitReached",
+	StatusBadInstruction:             "BadInstruction",
+	StatusBadJumpDestination:         "BadJumpDestination",
+	StatusOutOfGas:                   "OutOfGas",
+	StatusOutOfStack:                 "OutOfStack",
+	StatusStackUnderflow:             "StackUnderflow",
+	StatusNonceCheckFail:             "NonceCheckFail",
+	StatusBlockLimitCheckFail:        "BlockLimitCheckFail",
+	StatusFilterCheckFail:            "FilterCheckFail",
+	StatusNoDeployPermission:         "NoDeployPermission",
+	StatusNoCallPermission:           "NoCallPermission",
+	StatusNoTxPermission:             "NoTxPermission",
+	StatusPrecompiledError:           "PrecompiledError",
+	StatusRevertInstruction:          "RevertInstruction",
+	StatusInvalidZeroSignatureFormat: "InvalidZeroSignatureFormat",
+	StatusAddressAlreadyUsed:         "AddressAlreadyUsed",
+	StatusPermissionDenied:           "PermissionDenied",
+	StatusCallAddressError:           "CallAddressError",
+	StatusGasOverflow:                "GasOverflow",
+	StatusTxPoolIsFull:               "TxPoolIsFull",
+	StatusTransactionRefused:         "TransactionRefused",
+	StatusContractFrozen:             "ContractFrozen",
+	StatusAccountFrozen:              "AccountFrozen",
+	StatusAlreadyKnown:               "AlreadyKnown",
+	StatusAlreadyInChain:             "AlreadyInChain",
+	StatusInvalidChainId:             "InvalidChainId",
+	StatusInvalidGroupId:             "InvalidGroupId",
+	StatusRequestNotBelongToTheGroup: "RequestNotBelongToTheGroup",
+	StatusMalformedTx:                "MalformedTx",
+	StatusOverGroupMemoryLimit:       "OverGroupMemoryLimit",
+}
+
+// StatusMessage returns the name of an execution status code.
+func StatusMessage(code int) string {
+	if msg, ok := statusMessages[code]; ok {
+		return msg
+	}
+	return fmt.Sprintf("UnknownStatus(%#x)", code)
+}
+
+// Errors of the execution statuses rejecting frozen contracts and accounts. The
+// errors of failed receipts and calls match them, see StatusError.
+var (
+	ErrContractFrozen = errors.New("contract is frozen")
+	ErrAccountFrozen  = errors.New("account is frozen")
+)
+
+// statusErrors maps execution status codes to the errors above.
+var statusErrors = map[int]error{
+	StatusContractFrozen: ErrContractFrozen,
+	StatusAccountFrozen:  ErrAccountFrozen,
+}
+
+// StatusError is the failed execution status of a transaction or call.
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("execution failed: %s", StatusMessage(e.Status))
+}
+
+// Is reports whether target is the error variable matching the status.
+func (e *StatusError) Is(target error) bool {
+	err, ok := statusErrors[e.Status]
+	return ok && err == target
+}
+
+var errNotReverted = errors.New("execution was not reverted")
+
+// StatusCode decodes the execution status of the transaction.
+func (r *Receipt) StatusCode() (int, error) {
+	code, err := hexutil.DecodeFlexibleUint64(r.Status)
+	if err != nil {
+		return 0, err
+	}
+	return int(code), nil
+}
+
+// Succeeded reports whether the transaction executed successfully.
+func (r *Receipt) Succeeded() bool {
+	code, err := r.StatusCode()
+	return err == nil && code == StatusSuccess
+}
+
+// Err returns nil if the transaction executed successfully and its status as
+// *StatusError otherwise.
+func (r *Receipt) Err() error {
+	code, err := r.StatusCode()
+	if err != nil {
+		return fmt.Errorf("invalid receipt status %q", r.Status)
+	}
+	if code != StatusSuccess {
+		return &StatusError{Status: code}
+	}
+	return nil
+}
+
+// StatusMessage describes the execution status of the transaction.
+func (r *Receipt) StatusMessage() string {
+	code, err := r.StatusCode()
+	if err != nil {
+		return fmt.Sprintf("InvalidStatus(%q)", r.Status)
+	}
+	return StatusMessage(code)
+}
+
+// RevertReason decodes the reason a reverted transaction passed to revert or
+// require, or the solidity panic it failed with, from its output.
+func (r *Receipt) RevertReason() (string, error) {
+	if code, err := r.StatusCode(); err != nil {
+		return "", err
+	} else if code != StatusRevertInstruction {
+		return "", errNotReverted
+	}
+	return UnpackRevertReason(r.Output)
+}
+
+// UnpackRevertReason decodes the revert reason in the output of a reverted
+// execution, see abi.UnpackRevert.
+func UnpackRevertReason(output []byte) (string, error) {
+	return abi.UnpackRevert(output)
+}
@@ -0,0 +1,386 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+func TestReceiptStatus(t *testing.T) {
+	tests := []struct {
+		status    string
+		code      int
+		message   string
+		succeeded bool
+		is        error // the error matched by Err, if any
+	}{
+		{status: "0x0", code: StatusSuccess, message: "Success", succeeded: true},
+		{status: "0", code: StatusSuccess, message: "Success", succeeded: true},
+		{status: "0x16", code: StatusRevertInstruction, message: "RevertInstruction"},
+		{status: "22", code: StatusRevertInstruction, message: "RevertInstruction"},
+		{status: "0x1a", code: StatusCallAddressError, message: "CallAddressError"},
+		{status: "0x1e", code: StatusContractFrozen, message: "ContractFrozen", is: ErrContractFrozen},
+		{status: "0x1f", code: StatusAccountFrozen, message: "AccountFrozen", is: ErrAccountFrozen},
+		{status: "0x2710", code: StatusAlreadyKnown, message: "AlreadyKnown"},
+		{status: "0x99", code: 0x99, message: "UnknownStatus(0x99)"},
+		{status: "", code: -1, message: `InvalidStatus("")`},
+		{status: "0xzz", code: -1, message: `InvalidStatus("0xzz")`},
+	}
+	for _, test := range tests {
+		r := &Receipt{Status: test.status}
+		code, err := r.StatusCode()
+		if test.code < 0 {
+			if err == nil {
+				t.Errorf("status %q: StatusCode succeeded", test.status)
+			}
+		} else if err != nil || code != test.code {
+			t.Errorf("status %q: StatusCode %#x, %v, want %#x", test.status, code, err, test.code)
+		}
+		if msg := r.StatusMessage(); msg != test.message {
+			t.Errorf("status %q: StatusMessage %q, want %q", test.status, msg, test.message)
+		}
+		if r.Succeeded() != test.succeeded {
+			t.Errorf("status %q: Succeeded %v, want %v", test.status, !test.succeeded, test.succeeded)
+		}
+		err = r.Err()
+		switch {
+		case test.succeeded:
+			if err != nil {
+				t.Errorf("status %q: Err %v, want nil", test.status, err)
+			}
+		case test.code < 0:
+			if _, ok := err.(*StatusError); ok || err == nil {
+				t.Errorf("status %q: Err %v, want an invalid status error", test.status, err)
+			}
+		default:
+			e, ok := err.(*StatusError)
+			if !ok || e.Status != test.code {
+				t.Errorf("status %q: Err %#v, want status %#x", test.status, err, test.code)
+				continue
+			}
+			if want := "execution failed: " + test.message; e.Error() != want {
+				t.Errorf("status %q: error %q, want %q", test.status, e.Error(), want)
+			}
+			for _, target := range []error{ErrContractFrozen, ErrAccountFrozen} {
+				if e.Is(target) != (target == test.is) {
+					t.Errorf("status %q: matches %v = %v", test.status, target, !(target == test.is))
+				}
+			}
+		}
+	}
+}
+
+func TestReceiptRevertReason(t *testing.T) {
+	reason := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000"
+	tests := []struct {
+		status string
+		output string
+		reason string
+		fails  bool
+	}{
+		{status: "0x16", output: reason, reason: "insufficient balance"},
+		{status: "0x16", output: "0x4e487b71" + "0000000000000000000000000000000000000000000000000000000000000001", reason: "assert(false) (panic code 0x1)"},
+		{status: "0x16", output: "0x", fails: true},
+		{status: "0x16", output: "0x08c379a0", fails: true},
+		{status: "0x0", output: reason, fails: true},
+		{status: "0xc", output: reason, fails: true},
+		{status: "bad", output: reason, fails: true},
+	}
+	for _, test := range tests {
+		r := &Receipt{Status: test.status, Output: common.FromHex(test.output)}
+		have, err := r.RevertReason()
+		if test.fails {
+			if err == nil {
+				t.Errorf("status %s output %s: got reason %q, want error", test.status, test.output, have)
+			}
+			continue
+		}
+		if err != nil || have != test.reason {
+			t.Errorf("status %s output %s: got %q, %v, want %q", test.status, test.output, have, err, test.reason)
+		}
+	}
+	if _, err := (&Receipt{Status: "0x0"}).RevertReason(); err != errNotReverted {
+		t.Errorf("successful receipt: got error %v, want errNotReverted", err)
+	}
+}
+
+func TestReceiptLogFields(t *testing.T) {
+	const (
+		blockHash = "0x9f6a1e2b6f1e4c1e8b0d6e0c5d6f4b7a2e3c1d0f9a8b7c6d5e4f3a2b1c0d9e8f"
+		txHash    = "0x4d2f8e0f8e0e6c6b7a4e3b2f1c0d9e8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e"
+		log       = `{"address":"0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1","topics":[],"data":"0x"}`
+	)
+	receipt := func(number, index, logs string) string {
+		return `{"blockHash":"` + blockHash + `",` + number + index + `"transactionHash":"` + txHash + `","status":"0x0","logs":` + logs + `}`
+	}
+	tests := []struct {
+		name   string
+		json   string
+		number uint64
+		index  uint
+		logs   int
+		err    string
+	}{
+		{
+			name:   "three logs",
+			json:   receipt(`"blockNumber":"0x1d",`, `"transactionIndex":"0x2",`, "["+log+","+log+","+log+"]"),
+			number: 0x1d, index: 2, logs: 3,
+		},
+		{
+			name:   "decimal numbers",
+			json:   receipt(`"blockNumber":"29",`, `"transactionIndex":"2",`, "["+log+"]"),
+			number: 29, index: 2, logs: 1,
+		},
+		{
+			// The batch receipt retrieval leaves out the location.
+			name: "no location",
+			json: receipt("", "", "["+log+","+log+"]"),
+			logs: 2,
+		},
+		{
+			name:   "no logs",
+			json:   receipt(`"blockNumber":"0x1d",`, `"transactionIndex":"0x0",`, "[]"),
+			number: 0x1d,
+		},
+		{
+			name: "missing log",
+			json: receipt(`"blockNumber":"0x1d",`, `"transactionIndex":"0x0",`, "["+log+",null]"),
+			err:  "missing log 1",
+		},
+		{
+			name: "invalid block number",
+			json: receipt(`"blockNumber":"0xzz",`, `"transactionIndex":"0x0",`, "["+log+"]"),
+			err:  "invalid receipt blockNumber",
+		},
+	}
+	for _, test := range tests {
+		var r Receipt
+		err := json.Unmarshal([]byte(test.json), &r)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if r.BlockNumber != test.number || r.TxIndex != test.index || len(r.Logs) != test.logs {
+			t.Errorf("%s: got block %d, index %d, %d logs", test.name, r.BlockNumber, r.TxIndex, len(r.Logs))
+			continue
+		}
+		for i, l := range r.Logs {
+			if l.BlockNumber != test.number || l.TxIndex != test.index || l.Index != uint(i) ||
+				l.BlockHash != common.HexToHash(blockHash) || l.TxHash != common.HexToHash(txHash) {
+				t.Errorf("%s: log %d at block %d %x, tx %x index %d, log index %d", test.name, i, l.BlockNumber, l.BlockHash, l.TxHash, l.TxIndex, l.Index)
+			}
+		}
+	}
+}
+
+// TestReceiptJSON checks the typed fields decoded from the receipts of the node
+// and that encoding them gives receipts decoding to the same fields.
+func TestReceiptJSON(t *testing.T) {
+	const (
+		zero     = `"0x0000000000000000000000000000000000000000"`
+		contract = `"0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1"`
+		root     = "0x8a1f0e7d6c5b4a39281706f5e4d3c2b1a09f8e7d6c5b4a3928170615e4d3c2b1"
+	)
+	addr := common.HexToAddress(contract[1 : len(contract)-1])
+	tests := []struct {
+		name     string
+		json     string
+		gas      uint64
+		number   uint64
+		index    uint
+		contract *common.Address
+		to       *common.Address
+		input    string
+		output   string
+		root     string
+		err      string
+	}{
+		{
+			name:     "deployment",
+			json:     `{"blockNumber":"0x2","gasUsed":"0x4f2a","transactionIndex":"0x1","contractAddress":` + contract + `,"to":` + zero + `,"input":"0x6080","output":"0x","root":"` + root + `","status":"0x0"}`,
+			gas:      0x4f2a,
+			number:   2,
+			index:    1,
+			contract: &addr,
+			input:    "0x6080",
+			output:   "0x",
+			root:     root,
+		},
+		{
+			name:   "call",
+			json:   `{"blockNumber":"0x3","gasUsed":"0x5208","transactionIndex":"0x0","contractAddress":` + zero + `,"to":` + contract + `,"input":"0xa9059cbb","output":"0x0000000000000000000000000000000000000000000000000000000000000001","status":"0x0"}`,
+			gas:    0x5208,
+			number: 3,
+			to:     &addr,
+			input:  "0xa9059cbb",
+			output: "0x0000000000000000000000000000000000000000000000000000000000000001",
+		},
+		{
+			name:   "stateRoot spelling and decimal numbers",
+			json:   `{"blockNumber":"12","gasUsed":"21000","transactionIndex":"3","to":` + contract + `,"stateRoot":"` + root + `","status":"0x0"}`,
+			gas:    21000,
+			number: 12,
+			index:  3,
+			to:     &addr,
+			root:   root,
+		},
+		{
+			name: "fields left out",
+			json: `{"status":"0x0"}`,
+		},
+		{
+			name: "invalid gas",
+			json: `{"gasUsed":"0xg","status":"0x0"}`,
+			err:  "invalid receipt gasUsed",
+		},
+		{
+			name: "short contract address",
+			json: `{"contractAddress":"0x1234","status":"0x0"}`,
+			err:  "invalid receipt contractAddress",
+		},
+		{
+			name: "invalid to",
+			json: `{"to":"6849f21d1e455e9f0712b1e99fa4fcd23758e8f1","status":"0x0"}`,
+			err:  "invalid receipt to",
+		},
+		{
+			name: "long root",
+			json: `{"root":"` + root + `00","status":"0x0"}`,
+			err:  "invalid receipt root",
+		},
+	}
+	for _, test := range tests {
+		var r Receipt
+		err := json.Unmarshal([]byte(test.json), &r)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if r.GasUsed != test.gas || r.BlockNumber != test.number || r.TxIndex != test.index {
+			t.Errorf("%s: got gas %d, block %d, index %d", test.name, r.GasUsed, r.BlockNumber, r.TxIndex)
+		}
+		if !equalAddress(r.ContractAddress, test.contract) || !equalAddress(r.To, test.to) {
+			t.Errorf("%s: got contract address %v, to %v", test.name, r.ContractAddress, r.To)
+		}
+		if !bytes.Equal(r.Input, common.FromHex(test.input)) || !bytes.Equal(r.Output, common.FromHex(test.output)) {
+			t.Errorf("%s: got input %x, output %x", test.name, r.Input, r.Output)
+		}
+		if r.Root != common.HexToHash(test.root) {
+			t.Errorf("%s: got root %x", test.name, r.Root)
+		}
+
+		// The encoding is the node's: hex numbers, zero addresses for missing
+		// ones. It decodes to the same receipt.
+		enc, err := json.Marshal(&r)
+		if err != nil {
+			t.Errorf("%s: encoding: %v", test.name, err)
+			continue
+		}
+		var fields map[string]interface{}
+		json.Unmarshal(enc, &fields)
+		if fields["blockNumber"] != hexutil.EncodeUint64(r.BlockNumber) || fields["gasUsed"] != hexutil.EncodeUint64(r.GasUsed) {
+			t.Errorf("%s: encoded as %s", test.name, enc)
+		}
+		if r.To == nil && fields["to"] != zero[1:len(zero)-1] {
+			t.Errorf("%s: missing to encoded as %v", test.name, fields["to"])
+		}
+		var dec Receipt
+		if err := json.Unmarshal(enc, &dec); err != nil {
+			t.Errorf("%s: decoding %s: %v", test.name, enc, err)
+			continue
+		}
+		if reenc, _ := json.Marshal(&dec); !bytes.Equal(reenc, enc) {
+			t.Errorf("%s: encoding changed after decoding:\n%s\n%s", test.name, enc, reenc)
+		}
+	}
+}
+
+func equalAddress(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// TestReceiptsRoot checks the receipts roots of blocks against ones computed
+// here from the node's encoding of the receipts.
+func TestReceiptsRoot(t *testing.T) {
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		receipts := testReceipts(2, mode)
+		level := make([][]byte, len(receipts))
+		for i, r := range receipts {
+			var contract common.Address
+			if r.ContractAddress != nil {
+				contract = *r.ContractAddress
+			}
+			status, _ := hexutil.DecodeUint64(r.Status)
+			logs := []interface{}{}
+			for _, log := range r.Logs {
+				logs = append(logs, []interface{}{log.Address, log.Topics, log.Data})
+			}
+			enc, err := rlp.EncodeToBytes([]interface{}{r.Root, r.GasUsed, contract, r.Bloom[:], status, r.Output, logs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := modeHash(mode, enc)
+			index, _ := rlp.EncodeToBytes(uint(i))
+			level[i] = append(index, h[:]...)
+		}
+		group := modeHash(mode, level...)
+		block := &Block{Number: "0x2", ReceiptsRoot: modeHash(mode, group[:]).Hex()}
+		if err := block.VerifyReceiptsRoot(receipts, mode); err != nil {
+			t.Errorf("%v: %v", mode, err)
+		}
+
+		// Receipts out of order, or changed, don't make the root.
+		receipts[0], receipts[1] = receipts[1], receipts[0]
+		err := block.VerifyReceiptsRoot(receipts, mode)
+		if err == nil || !strings.Contains(err.Error(), "receipts root mismatch") {
+			t.Errorf("%v: swapped receipts: %v", mode, err)
+		}
+		receipts[0], receipts[1] = receipts[1], receipts[0]
+		receipts[1].Logs[0].Data = []byte{0x2b}
+		if err := block.VerifyReceiptsRoot(receipts, mode); err == nil {
+			t.Errorf("%v: root verified with changed log data", mode)
+		}
+		if err := block.VerifyReceiptsRoot(receipts[:1], mode); err == nil {
+			t.Errorf("%v: root verified with a missing receipt", mode)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+// storageVersion is the version of the storage encoding written for blocks,
+// block transactions and receipts. Fields are added in a new version, with
+// payload types of its own, and decoding keeps reading the older versions.
+const storageVersion = 1
+
+// ErrStorageVersion is matched by the error of decoding a block, block
+// transaction or receipt stored by a newer version of the package.
+var ErrStorageVersion = errors.New("unsupported storage version")
+
+// StorageVersionError tells the version of a stored value which can't be
+// decoded.
+type StorageVersionError struct {
+	Type    string // "block", "block transaction" or "receipt"
+	Version uint
+}
+
+func (e *StorageVersionError) Error() string {
+	return fmt.Sprintf("unsupported %s storage version %d", e.Type, e.Version)
+}
+
+// Is reports whether target is ErrStorageVersion.
+func (e *StorageVersionError) Is(target error) bool { return target == ErrStorageVersion }
+
+// The storage encoding of a value is a list of the version of the encoding
+// and the payload of that version.
+
+func encodeStorage(w io.Writer, payload interface{}) error {
+	return rlp.Encode(w, []interface{}{uint(storageVersion), payload})
+}
+
+// decodeStorage reads a stored value of type typ into payload. Once there are
+// several versions, payload has to depend on the version read.
+func decodeStorage(s *rlp.Stream, typ string, payload interface{}) error {
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	version, err := s.Uint()
+	if err != nil {
+		return err
+	}
+	if version == 0 || version > storageVersion {
+		return &StorageVersionError{Type: typ, Version: uint(version)}
+	}
+	if err := s.Decode(payload); err != nil {
+		return err
+	}
+	return s.ListEnd()
+}
+
+// The string fields of blocks and transactions are stored as bytes if they
+// have the form the node sends, lower case hex, and read back in that form.
+// Any other string is stored as a list holding it, so that every block reads
+// back as it was written.
+
+// storedData is a hex string of even length with 0x prefix, as hashes and
+// addresses are sent.
+type storedData string
+
+// storedQuantity is a hex number with 0x prefix and no leading zeros.
+type storedQuantity string
+
+// storedNodeID is a hex string of even length without prefix, as node ids
+// are sent.
+type storedNodeID string
+
+func (d *storedData) EncodeRLP(w io.Writer) error {
+	b, err := hexutil.Decode(string(*d))
+	return encodeStoredString(w, string(*d), b, err == nil && formatData(b) == string(*d))
+}
+
+func (d *storedData) DecodeRLP(s *rlp.Stream) error {
+	str, err := decodeStoredString(s, formatData)
+	*d = storedData(str)
+	return err
+}
+
+func (q *storedQuantity) EncodeRLP(w io.Writer) error {
+	b, ok := quantityBytes(string(*q))
+	return encodeStoredString(w, string(*q), b, ok)
+}
+
+func (q *storedQuantity) DecodeRLP(s *rlp.Stream) error {
+	str, err := decodeStoredString(s, formatQuantity)
+	*q = storedQuantity(str)
+	return err
+}
+
+func (id *storedNodeID) EncodeRLP(w io.Writer) error {
+	b, err := hex.DecodeString(string(*id))
+	return encodeStoredString(w, string(*id), b, err == nil && formatHex(b, false, false) == string(*id))
+}
+
+func (id *storedNodeID) DecodeRLP(s *rlp.Stream) error {
+	str, err := decodeStoredString(s, func(b []byte) string { return formatHex(b, false, false) })
+	*id = storedNodeID(str)
+	return err
+}
+
+// quantityBytes returns the big endian bytes of a hex number, if it has no
+// leading zeros.
+func quantityBytes(s string) ([]byte, bool) {
+	if len(s) < 3 || s[:2] != "0x" || (s[2] == '0' && len(s) > 3) {
+		return nil, false
+	}
+	digits := s[2:]
+	if digits == "0" {
+		return nil, true
+	}
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	return b, err == nil && formatQuantity(b) == s
+}
+
+func formatData(b []byte) string { return formatHex(b, true, false) }
+
+func formatQuantity(b []byte) string {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	if len(b) == 0 {
+		return "0x0"
+	}
+	return formatHex(b, true, true)
+}
+
+// formatHex formats b as lower case hex, with 0x prefix if prefixed and, for
+// quantities, without a leading zero digit.
+func formatHex(b []byte, prefixed, quantity bool) string {
+	enc := make([]byte, 2+2*len(b))
+	hex.Encode(enc[2:], b)
+	switch {
+	case quantity && enc[2] == '0':
+		copy(enc[1:], "0x")
+		return string(enc[1:])
+	case prefixed:
+		copy(enc, "0x")
+		return string(enc)
+	}
+	return string(enc[2:])
+}
+
+// encodeStoredString writes b, the bytes of str, if str reads back from them,
+// and str itself otherwise.
+func encodeStoredString(w io.Writer, str string, b []byte, readsBack bool) error {
+	if readsBack {
+		return rlp.Encode(w, b)
+	}
+	return rlp.Encode(w, []string{str})
+}
+
+func decodeStoredString(s *rlp.Stream, format func([]byte) string) (string, error) {
+	kind, _, err := s.Kind()
+	if err != nil {
+		return "", err
+	}
+	if kind != rlp.List {
+		b, err := s.Bytes()
+		if err != nil {
+			return "", err
+		}
+		return format(b), nil
+	}
+	var str [1]string
+	if err := s.Decode(&str); err != nil {
+		return "", err
+	}
+	return str[0], nil
+}
+
+// storedBlockV1 is the payload of version 1 of the storage encoding of a
+// block.
+type storedBlockV1 struct {
+	DbHash           storedData
+	ExtraData        []storedData
+	GasLimit         storedQuantity
+	GasUsed          storedQuantity
+	Hash             storedData
+	LogsBloom        storedData
+	Number           storedQuantity
+	ParentHash       storedData
+	ReceiptsRoot     storedData
+	Sealer           storedQuantity
+	SealerList       []storedNodeID
+	StateRoot        storedData
+	Timestamp        storedQuantity
+	Transactions     []BlockTx
+	TransactionsRoot storedData
+}
+
+// storedBlockTxV1 is the payload of version 1 of the storage encoding of a
+// block transaction.
+type storedBlockTxV1 struct {
+	BlockHash        storedData
+	BlockNumber      storedQuantity
+	From             storedData
+	Gas              storedQuantity
+	GasPrice         storedQuantity
+	Hash             storedData
+	Input            storedData
+	Nonce            storedQuantity
+	To               storedData
+	TransactionIndex storedQuantity
+	Value            storedQuantity
+}
+
+// storedReceiptV1 is the payload of version 1 of the storage encoding of a
+// receipt.
+type storedReceiptV1 struct {
+	BlockHash       common.Hash
+	BlockNumber     uint64
+	ContractAddress *common.Address `rlp:"nil"`
+	From            common.Address
+	GasUsed         uint64
+	Input           []byte
+	Logs            []*storedLogV1
+	Bloom           []byte // empty if it is the bloom of the logs
+	Output          []byte
+	Root            common.Hash
+	Status          storedQuantity
+	To              *common.Address `rlp:"nil"`
+	TxHash          common.Hash
+	TxIndex         uint
+}
+
+// storedLogV1 is a log of a receipt, stored with all its fields.
+type storedLogV1 struct {
+	Address     common.Address
+	Topics      []common.Hash
+	Data        []byte
+	BlockNumber uint64
+	TxHash      common.Hash
+	TxIndex     uint
+	BlockHash   common.Hash
+	Index       uint
+	Removed     bool
+}
+
+// EncodeRLP implements rlp.Encoder, writing the storage encoding of the block,
+// which holds every field of it. Extra data other than hex strings can't be
+// encoded.
+func (b *Block) EncodeRLP(w io.Writer) error {
+	enc := &storedBlockV1{
+		DbHash:           storedData(b.DbHash),
+		ExtraData:        make([]storedData, len(b.ExtraData)),
+		GasLimit:         storedQuantity(b.GasLimit),
+		GasUsed:          storedQuantity(b.GasUsed),
+		Hash:             storedData(b.Hash),
+		LogsBloom:        storedData(b.LogsBloom),
+		Number:           storedQuantity(b.Number),
+		ParentHash:       storedData(b.ParentHash),
+		ReceiptsRoot:     storedData(b.ReceiptsRoot),
+		Sealer:           storedQuantity(b.Sealer),
+		SealerList:       make([]storedNodeID, len(b.SealerList)),
+		StateRoot:        storedData(b.StateRoot),
+		Timestamp:        storedQuantity(b.Timestamp),
+		Transactions:     b.Transactions,
+		TransactionsRoot: storedData(b.TransactionsRoot),
+	}
+	for i, data := range b.ExtraData {
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("invalid block extraData %d: %v", i, data)
+		}
+		enc.ExtraData[i] = storedData(s)
+	}
+	for i, sealer := range b.SealerList {
+		enc.SealerList[i] = storedNodeID(sealer)
+	}
+	return encodeStorage(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder, reading a block stored by EncodeRLP.
+func (b *Block) DecodeRLP(s *rlp.Stream) error {
+	var dec storedBlockV1
+	if err := decodeStorage(s, "block", &dec); err != nil {
+		return err
+	}
+	*b = Block{
+		DbHash:           string(dec.DbHash),
+		ExtraData:        make([]interface{}, len(dec.ExtraData)),
+		GasLimit:         string(dec.GasLimit),
+		GasUsed:          string(dec.GasUsed),
+		Hash:             string(dec.Hash),
+		LogsBloom:        string(dec.LogsBloom),
+		Number:           string(dec.Number),
+		ParentHash:       string(dec.ParentHash),
+		ReceiptsRoot:     string(dec.ReceiptsRoot),
+		Sealer:           string(dec.Sealer),
+		SealerList:       make([]string, len(dec.SealerList)),
+		StateRoot:        string(dec.StateRoot),
+		Timestamp:        string(dec.Timestamp),
+		Transactions:     make([]BlockTx, len(dec.Transactions)),
+		TransactionsRoot: string(dec.TransactionsRoot),
+	}
+	for i, data := range dec.ExtraData {
+		b.ExtraData[i] = string(data)
+	}
+	for i, sealer := range dec.SealerList {
+		b.SealerList[i] = string(sealer)
+	}
+	copy(b.Transactions, dec.Transactions)
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, writing the storage encoding of the
+// transaction, which holds every field of it.
+func (tx *BlockTx) EncodeRLP(w io.Writer) error {
+	return encodeStorage(w, &storedBlockTxV1{
+		BlockHash:        storedData(tx.BlockHash),
+		BlockNumber:      storedQuantity(tx.BlockNumber),
+		From:             storedData(tx.From),
+		Gas:              storedQuantity(tx.Gas),
+		GasPrice:         storedQuantity(tx.GasPrice),
+		Hash:             storedData(tx.Hash),
+		Input:            storedData(tx.Input),
+		Nonce:            storedQuantity(tx.Nonce),
+		To:               storedData(tx.To),
+		TransactionIndex: storedQuantity(tx.TransactionIndex),
+		Value:            storedQuantity(tx.Value),
+	})
+}
+
+// DecodeRLP implements rlp.Decoder, reading a transaction stored by EncodeRLP.
+func (tx *BlockTx) DecodeRLP(s *rlp.Stream) error {
+	var dec storedBlockTxV1
+	if err := decodeStorage(s, "block transaction", &dec); err != nil {
+		return err
+	}
+	*tx = BlockTx{
+		BlockHash:        string(dec.BlockHash),
+		BlockNumber:      string(dec.BlockNumber),
+		From:             string(dec.From),
+		Gas:              string(dec.Gas),
+		GasPrice:         string(dec.GasPrice),
+		Hash:             string(dec.Hash),
+		Input:            string(dec.Input),
+		Nonce:            string(dec.Nonce),
+		To:               string(dec.To),
+		TransactionIndex: string(dec.TransactionIndex),
+		Value:            string(dec.Value),
+	}
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, writing the storage encoding of the
+// receipt, which holds every field of it, including those of its logs.
+func (r *Receipt) EncodeRLP(w io.Writer) error {
+	enc := &storedReceiptV1{
+		BlockHash:       r.BlockHash,
+		BlockNumber:     r.BlockNumber,
+		ContractAddress: r.ContractAddress,
+		From:            r.From,
+		GasUsed:         r.GasUsed,
+		Input:           r.Input,
+		Logs:            make([]*storedLogV1, len(r.Logs)),
+		Output:          r.Output,
+		Root:            r.Root,
+		Status:          storedQuantity(r.Status),
+		To:              r.To,
+		TxHash:          r.TxHash,
+		TxIndex:         r.TxIndex,
+	}
+	if r.Bloom != CreateBloom(Receipts{r}) {
+		enc.Bloom = r.Bloom.Bytes()
+	}
+	for i, log := range r.Logs {
+		enc.Logs[i] = &storedLogV1{
+			Address:     log.Address,
+			Topics:      log.Topics,
+			Data:        log.Data,
+			BlockNumber: log.BlockNumber,
+			TxHash:      log.TxHash,
+			TxIndex:     log.TxIndex,
+			BlockHash:   log.BlockHash,
+			Index:       log.Index,
+			Removed:     log.Removed,
+		}
+	}
+	return encodeStorage(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder, reading a receipt stored by EncodeRLP.
+func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
+	var dec storedReceiptV1
+	if err := decodeStorage(s, "receipt", &dec); err != nil {
+		return err
+	}
+	*r = Receipt{
+		BlockHash:       dec.BlockHash,
+		BlockNumber:     dec.BlockNumber,
+		ContractAddress: dec.ContractAddress,
+		From:            dec.From,
+		GasUsed:         dec.GasUsed,
+		Input:           dec.Input,
+		Logs:            make([]*Log, len(dec.Logs)),
+		Output:          dec.Output,
+		Root:            dec.Root,
+		Status:          string(dec.Status),
+		To:              dec.To,
+		TxHash:          dec.TxHash,
+		TxIndex:         dec.TxIndex,
+	}
+	for i, log := range dec.Logs {
+		r.Logs[i] = &Log{
+			Address:     log.Address,
+			Topics:      log.Topics,
+			Data:        log.Data,
+			BlockNumber: log.BlockNumber,
+			TxHash:      log.TxHash,
+			TxIndex:     log.TxIndex,
+			BlockHash:   log.BlockHash,
+			Index:       log.Index,
+			Removed:     log.Removed,
+		}
+	}
+	switch len(dec.Bloom) {
+	case 0:
+		r.Bloom = CreateBloom(Receipts{r})
+	case BloomByteLength:
+		r.Bloom = BytesToBloom(dec.Bloom)
+	default:
+		return fmt.Errorf("invalid receipt bloom length %d", len(dec.Bloom))
+	}
+	return nil
+}
+
+// WriteBlock writes the storage encoding of b to w, see Block.EncodeRLP.
+func WriteBlock(w io.Writer, b *Block) error {
+	return rlp.Encode(w, b)
+}
+
+// ReadBlock reads a block written by WriteBlock from r. Blocks written one after
+// another read back in turn from an io.ByteReader such as a bufio.Reader;
+// other readers get buffered, which may consume input past the block.
+func ReadBlock(r io.Reader) (*Block, error) {
+	b := new(Block)
+	if err := rlp.Decode(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+// testReceipts returns the receipts of the transactions of block number, one
+// deploying a contract, one calling it and logging.
+func testReceipts(number uint64, mode ChainMode) []*Receipt {
+	contract := common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1")
+	blockHash := common.BigToHash(new(big.Int).SetUint64(number + 0xb10c))
+	receipts := []*Receipt{
+		{
+			ContractAddress: &contract,
+			GasUsed:         250000,
+			Input:           []byte{0x60, 0x80, 0x60, 0x40},
+			Logs:            []*Log{},
+			Output:          []byte{},
+			Status:          "0x0",
+		},
+		{
+			GasUsed: 30000,
+			Input:   []byte{0x60, 0xfe, 0x47, 0xb1, 0, 0, 0, 0x2a},
+			Logs: []*Log{
+				{Address: contract, Topics: []common.Hash{{1}, {2}}, Data: []byte{0x2a}},
+				{Address: contract, Topics: []common.Hash{}, Data: []byte{}},
+			},
+			Output: []byte{0x01},
+			Status: "0x16",
+			To:     &contract,
+		},
+	}
+	var logIndex uint
+	for i, r := range receipts {
+		r.BlockHash = blockHash
+		r.BlockNumber = number
+		r.From = common.Address{0xf0}
+		r.Root = common.Hash{byte(i + 1), 0x5e}
+		r.TxHash = common.BigToHash(new(big.Int).SetUint64(number<<8 + uint64(i)))
+		r.TxIndex = uint(i)
+		for _, log := range r.Logs {
+			log.BlockNumber, log.BlockHash, log.TxHash, log.TxIndex, log.Index = number, blockHash, r.TxHash, r.TxIndex, logIndex
+			logIndex++
+		}
+		r.Bloom = CreateBloomFor(Receipts{r}, mode)
+	}
+	return receipts
+}
+
+// testBlock returns a block whose hash and roots match its content and
+// receipts, as the node sends it.
+func testBlock(t *testing.T, number uint64, mode ChainMode) (*Block, []*Receipt) {
+	t.Helper()
+	receipts := testReceipts(number, mode)
+	b := &Block{
+		DbHash:     common.Hash{0xdb}.Hex(),
+		ExtraData:  []interface{}{"0x", "0x0102"},
+		GasLimit:   "0x0",
+		GasUsed:    hexutil.EncodeUint64(280000),
+		LogsBloom:  hexutil.Encode(CreateBloomFor(Receipts(receipts), mode).Bytes()),
+		Number:     hexutil.EncodeUint64(number),
+		ParentHash: common.BigToHash(new(big.Int).SetUint64(number + 0xb10b)).Hex(),
+		Sealer:     "0x1",
+		StateRoot:  receipts[len(receipts)-1].Root.Hex(),
+		Timestamp:  hexutil.EncodeUint64(1571200000000 + number*1000),
+	}
+	for i := 0; i < 4; i++ {
+		b.SealerList = append(b.SealerList, strings.Repeat(fmt.Sprintf("%02x", i+1), 64))
+	}
+	hashes := make([]common.Hash, len(receipts))
+	for i, r := range receipts {
+		b.Transactions = append(b.Transactions, BlockTx{
+			BlockHash:        r.BlockHash.Hex(),
+			BlockNumber:      b.Number,
+			From:             r.From.Hex(),
+			Gas:              "0x1c9c380",
+			GasPrice:         "0x1c9c380",
+			Hash:             r.TxHash.Hex(),
+			Input:            hexutil.Encode(r.Input),
+			Nonce:            "0x3a4c1f5d0e8b7a6",
+			TransactionIndex: hexutil.EncodeUint64(uint64(i)),
+			Value:            "0x0",
+		})
+		h, err := r.hashFor(mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[i] = h
+	}
+	// The lower case forms of the node.
+	b.Transactions[1].To = strings.ToLower(receipts[1].To.Hex())
+	b.Transactions[0].From = strings.ToLower(b.Transactions[0].From)
+	b.Transactions[1].From = strings.ToLower(b.Transactions[1].From)
+
+	txRoot, err := b.ComputeTxRoot(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.TransactionsRoot = txRoot.Hex()
+	b.ReceiptsRoot = merkleRoot(hashes, mode).Hex()
+	hash, err := b.ComputeHash(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Hash = hash.Hex()
+	for i := range b.Transactions {
+		b.Transactions[i].BlockHash = b.Hash
+	}
+	return b, receipts
+}
+
+func TestBlockStorageRoundTrip(t *testing.T) {
+	for _, mode := range []ChainMode{ChainModeStandard, ChainModeGM} {
+		var (
+			buf      bytes.Buffer
+			blocks   []*Block
+			receipts [][]*Receipt
+		)
+		for number := uint64(1); number <= 3; number++ {
+			b, r := testBlock(t, number, mode)
+			if err := WriteBlock(&buf, b); err != nil {
+				t.Fatalf("%v: WriteBlock error: %v", mode, err)
+			}
+			enc, err := rlp.EncodeToBytes(r)
+			if err != nil {
+				t.Fatalf("%v: can't encode receipts: %v", mode, err)
+			}
+			buf.Write(enc)
+			blocks, receipts = append(blocks, b), append(receipts, r)
+		}
+
+		stream := bufio.NewReader(&buf)
+		for i, want := range blocks {
+			have, err := ReadBlock(stream)
+			if err != nil {
+				t.Fatalf("%v: block %d: ReadBlock error: %v", mode, i, err)
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Fatalf("%v: block %d changed in round trip\nhave %+v\nwant %+v", mode, i, have, want)
+			}
+			var haveReceipts []*Receipt
+			if err := rlp.Decode(stream, &haveReceipts); err != nil {
+				t.Fatalf("%v: block %d: can't decode receipts: %v", mode, i, err)
+			}
+			if !reflect.DeepEqual(haveReceipts, receipts[i]) {
+				t.Fatalf("%v: receipts of block %d changed in round trip", mode, i)
+			}
+
+			// The decoded block and receipts hash as the originals did.
+			if err := have.VerifyHash(mode); err != nil {
+				t.Errorf("%v: block %d: %v", mode, i, err)
+			}
+			if err := have.VerifyTxRoot(mode); err != nil {
+				t.Errorf("%v: block %d: %v", mode, i, err)
+			}
+			if err := have.VerifyReceiptsRoot(haveReceipts, mode); err != nil {
+				t.Errorf("%v: block %d: %v", mode, i, err)
+			}
+		}
+		if _, err := ReadBlock(stream); err == nil {
+			t.Errorf("%v: read a block past the last one", mode)
+		}
+	}
+}
+
+// TestBlockStorageVerbatim checks that strings not in the node's form read back
+// as they were written.
+func TestBlockStorageVerbatim(t *testing.T) {
+	b, _ := testBlock(t, 7, ChainModeStandard)
+	b.Hash = strings.ToUpper(b.Hash)
+	b.Number = "7"
+	b.GasUsed = "0x00"
+	b.SealerList[0] = "0x" + b.SealerList[0]
+	b.ExtraData = append(b.ExtraData, "0xABC", "")
+	b.Transactions[0].Input = "0x"
+	b.Transactions[0].To = ""
+	b.Transactions[1].Value = "-1"
+
+	var buf bytes.Buffer
+	if err := WriteBlock(&buf, b); err != nil {
+		t.Fatalf("WriteBlock error: %v", err)
+	}
+	have, err := ReadBlock(&buf)
+	if err != nil {
+		t.Fatalf("ReadBlock error: %v", err)
+	}
+	if !reflect.DeepEqual(have, b) {
+		t.Fatalf("block changed in round trip\nhave %+v\nwant %+v", have, b)
+	}
+}
+
+// TestReceiptStorageBloom checks that the bloom of a receipt is only stored if
+// it isn't the standard bloom of its logs, as on guomi chains, and reads back
+// either way.
+func TestReceiptStorageBloom(t *testing.T) {
+	r := testReceipts(1, ChainModeStandard)[1]
+	computed, err := rlp.EncodeToBytes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm := testReceipts(1, ChainModeGM)[1]
+	stored, err := rlp.EncodeToBytes(gm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored)-len(computed) < BloomByteLength {
+		t.Errorf("standard receipt stored in %d bytes, guomi receipt in %d, want its bloom stored", len(computed), len(stored))
+	}
+	for _, want := range []*Receipt{r, gm} {
+		enc, _ := rlp.EncodeToBytes(want)
+		var have Receipt
+		if err := rlp.DecodeBytes(enc, &have); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if have.Bloom != want.Bloom {
+			t.Errorf("bloom changed in round trip")
+		}
+	}
+}
+
+// TestStorageV1 decodes the version 1 encodings of testBlock and its receipts
+// stored in testdata, which every later version must keep reading to the same
+// values.
+func TestStorageV1(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "storage_v1.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) != 2 {
+		t.Fatalf("got %d encodings in testdata, want a block and its receipts", len(lines))
+	}
+	wantBlock, wantReceipts := testBlock(t, 1, ChainModeStandard)
+
+	var (
+		block    Block
+		receipts []*Receipt
+	)
+	if err := rlp.DecodeBytes(common.FromHex(lines[0]), &block); err != nil {
+		t.Fatalf("can't decode the version 1 block: %v", err)
+	}
+	if err := rlp.DecodeBytes(common.FromHex(lines[1]), &receipts); err != nil {
+		t.Fatalf("can't decode the version 1 receipts: %v", err)
+	}
+	if !reflect.DeepEqual(&block, wantBlock) {
+		t.Errorf("version 1 block decoded to\n%+v\nwant %+v", &block, wantBlock)
+	}
+	if !reflect.DeepEqual(receipts, wantReceipts) {
+		t.Errorf("version 1 receipts decoded to other values")
+	}
+	if err := block.VerifyHash(ChainModeStandard); err != nil {
+		t.Error(err)
+	}
+	if err := block.VerifyReceiptsRoot(receipts, ChainModeStandard); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStorageVersionError(t *testing.T) {
+	b, receipts := testBlock(t, 1, ChainModeStandard)
+	blockEnc, _ := rlp.EncodeToBytes(b)
+	receiptEnc, _ := rlp.EncodeToBytes(receipts[0])
+	txEnc, _ := rlp.EncodeToBytes(&b.Transactions[0])
+
+	// withVersion replaces the version of a stored value.
+	withVersion := func(enc []byte, version uint) []byte {
+		var stored []rlp.RawValue
+		if err := rlp.DecodeBytes(enc, &stored); err != nil {
+			t.Fatal(err)
+		}
+		v, _ := rlp.EncodeToBytes(version)
+		out, _ := rlp.EncodeToBytes([]rlp.RawValue{v, stored[1]})
+		return out
+	}
+	tests := []struct {
+		typ string
+		enc []byte
+		val interface{}
+	}{
+		{"block", blockEnc, new(Block)},
+		{"block transaction", txEnc, new(BlockTx)},
+		{"receipt", receiptEnc, new(Receipt)},
+	}
+	for _, test := range tests {
+		for _, version := range []uint{0, storageVersion + 1} {
+			err := rlp.DecodeBytes(withVersion(test.enc, version), test.val)
+			verr, ok := err.(*StorageVersionError)
+			if !ok || !verr.Is(ErrStorageVersion) {
+				t.Errorf("%s version %d: got error %v, want ErrStorageVersion", test.typ, version, err)
+				continue
+			}
+			if verr.Type != test.typ || verr.Version != version {
+				t.Errorf("%s version %d: got error %v", test.typ, version, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// SyncStatus is the block synchronization state of a node, as returned by
+// getSyncStatus.
+type SyncStatus struct {
+	BlockNumber        int64  `json:"blockNumber"`
+	GenesisHash        string `json:"genesisHash"`
+	IsSyncing          bool   `json:"isSyncing"`
+	KnownHighestNumber int64  `json:"knownHighestNumber"`
+	KnownLatestHash    string `json:"knownLatestHash"`
+	LatestHash         string `json:"latestHash"`
+	NodeID             string `json:"nodeId"`
+	Peers              []Peer `json:"peers"`
+	ProtocolID         int    `json:"protocolId"`
+	TxPoolSize         int    `json:"txPoolSize"`
+
+	// Raw is the response the status was decoded from, see Block.Raw.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Peer is the synchronization state of a peer of the node.
+type Peer struct {
+	BlockNumber int64       `json:"blockNumber"`
+	GenesisHash common.Hash `json:"genesisHash"`
+	LatestHash  common.Hash `json:"latestHash"`
+	NodeID      string      `json:"nodeId"`
+}
+
+// HighestNumber returns the highest block number known to the node, either
+// from its own view or reported by one of its peers.
+func (s *SyncStatus) HighestNumber() int64 {
+	highest := s.KnownHighestNumber
+	if s.BlockNumber > highest {
+		highest = s.BlockNumber
+	}
+	for _, peer := range s.Peers {
+		if peer.BlockNumber > highest {
+			highest = peer.BlockNumber
+		}
+	}
+	return highest
+}
+
+// UnmarshalJSON decodes the status, accepting its numbers as JSON numbers or as
+// strings, decimal or hex, which node versions use interchangeably.
+func (s *SyncStatus) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		BlockNumber        hexutil.FlexibleUint64 `json:"blockNumber"`
+		GenesisHash        string                 `json:"genesisHash"`
+		IsSyncing          bool                   `json:"isSyncing"`
+		KnownHighestNumber hexutil.FlexibleUint64 `json:"knownHighestNumber"`
+		KnownLatestHash    string                 `json:"knownLatestHash"`
+		LatestHash         string                 `json:"latestHash"`
+		NodeID             string                 `json:"nodeId"`
+		Peers              []Peer                 `json:"peers"`
+		ProtocolID         hexutil.FlexibleUint64 `json:"protocolId"`
+		TxPoolSize         hexutil.FlexibleUint64 `json:"txPoolSize"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*s = SyncStatus{
+		BlockNumber:        int64(dec.BlockNumber),
+		GenesisHash:        dec.GenesisHash,
+		IsSyncing:          dec.IsSyncing,
+		KnownHighestNumber: int64(dec.KnownHighestNumber),
+		KnownLatestHash:    dec.KnownLatestHash,
+		LatestHash:         dec.LatestHash,
+		NodeID:             dec.NodeID,
+		Peers:              dec.Peers,
+		ProtocolID:         int(dec.ProtocolID),
+		TxPoolSize:         int(dec.TxPoolSize),
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the peer state, see SyncStatus.UnmarshalJSON.
+func (p *Peer) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		BlockNumber hexutil.FlexibleUint64 `json:"blockNumber"`
+		GenesisHash common.Hash            `json:"genesisHash"`
+		LatestHash  common.Hash            `json:"latestHash"`
+		NodeID      string                 `json:"nodeId"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*p = Peer{
+		BlockNumber: int64(dec.BlockNumber),
+		GenesisHash: dec.GenesisHash,
+		LatestHash:  dec.LatestHash,
+		NodeID:      dec.NodeID,
+	}
+	return nil
+}
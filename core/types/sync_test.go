@@ -0,0 +1,82 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSyncStatusJSON(t *testing.T) {
+	tests := []struct {
+		json     string
+		number   int64
+		highest  int64
+		txPool   int
+		protocol int
+		peers    []int64
+		max      int64 // HighestNumber
+		err      bool
+	}{
+		{
+			json:   `{"blockNumber":12,"knownHighestNumber":15,"txPoolSize":"3","protocolId":65545,"peers":[{"blockNumber":14}]}`,
+			number: 12, highest: 15, txPool: 3, protocol: 65545, peers: []int64{14}, max: 15,
+		},
+		{
+			json:   `{"blockNumber":"0xc","knownHighestNumber":"0xf","txPoolSize":"0x3","protocolId":"65545","peers":[{"blockNumber":"0x14"},{"blockNumber":"9"}]}`,
+			number: 12, highest: 15, txPool: 3, protocol: 65545, peers: []int64{20, 9}, max: 20,
+		},
+		{
+			// The node is ahead of what it learned from its peers.
+			json:   `{"blockNumber":"30","knownHighestNumber":"28","txPoolSize":0,"peers":[]}`,
+			number: 30, highest: 28, peers: []int64{}, max: 30,
+		},
+		{json: `{}`},
+		{json: `{"blockNumber":"0xzz"}`, err: true},
+		{json: `{"txPoolSize":-1}`, err: true},
+		{json: `{"peers":[{"blockNumber":true}]}`, err: true},
+	}
+	for _, test := range tests {
+		var s SyncStatus
+		err := json.Unmarshal([]byte(test.json), &s)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: decoding succeeded", test.json)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.json, err)
+			continue
+		}
+		if s.BlockNumber != test.number || s.KnownHighestNumber != test.highest || s.TxPoolSize != test.txPool || s.ProtocolID != test.protocol {
+			t.Errorf("%s: got block %d, highest %d, pool %d, protocol %d", test.json, s.BlockNumber, s.KnownHighestNumber, s.TxPoolSize, s.ProtocolID)
+		}
+		if len(s.Peers) != len(test.peers) {
+			t.Errorf("%s: got %d peers, want %d", test.json, len(s.Peers), len(test.peers))
+		} else {
+			for i, peer := range s.Peers {
+				if peer.BlockNumber != test.peers[i] {
+					t.Errorf("%s: peer %d at block %d, want %d", test.json, i, peer.BlockNumber, test.peers[i])
+				}
+			}
+		}
+		if max := s.HighestNumber(); max != test.max {
+			t.Errorf("%s: highest number %d, want %d", test.json, max, test.max)
+		}
+	}
+}
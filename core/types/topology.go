@@ -0,0 +1,70 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// NodeRole is the role of a node in a group.
+type NodeRole string
+
+const (
+	NodeRoleSealer   NodeRole = "sealer"
+	NodeRoleObserver NodeRole = "observer"
+	NodeRoleNone     NodeRole = "none"    // connected, but not a member of the group
+	NodeRoleUnknown  NodeRole = "unknown" // the sealer or observer list is unavailable
+)
+
+// GroupTopology is a snapshot of the nodes of a group as seen by one node,
+// assembled from the sealer, observer, group peer and node id lists and from the
+// consensus and sync status. Data whose call failed is left unknown, and the
+// failure is recorded in Errors.
+type GroupTopology struct {
+	GroupId uint64         `json:"groupId"`
+	NodeId  string         `json:"nodeId"` // the node answering, empty if unknown
+	Leader  string         `json:"leader"` // the PBFT leader, empty if unknown
+	Nodes   []TopologyNode `json:"nodes"`
+
+	// Errors holds the failures of the underlying calls, keyed by RPC method.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// TopologyNode is a node of a GroupTopology. Connected and BlockNumber are nil
+// when unknown.
+type TopologyNode struct {
+	NodeId      string   `json:"nodeId"`
+	Role        NodeRole `json:"role"`
+	Connected   *bool    `json:"connected"`   // connected to the answering node, or the node itself
+	BlockNumber *int64   `json:"blockNumber"` // from the sync status
+}
+
+// Node returns the node with the given id, or nil if it is not in the snapshot.
+func (t *GroupTopology) Node(nodeId string) *TopologyNode {
+	for i := range t.Nodes {
+		if t.Nodes[i].NodeId == nodeId {
+			return &t.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// LeaderIndex returns the index of the PBFT leader in the sealer list of the
+// consensus status, computed like the node does from the view and the highest
+// block number. It returns false if the leader is unknown.
+func (s *ConsensusStatus) LeaderIndex() (int, bool) {
+	if s.CfgErr || s.LeaderFailed || s.NodeNum <= 0 {
+		return 0, false
+	}
+	return int((s.CurrentView + s.HighestBlockNumber) % int64(s.NodeNum)), true
+}
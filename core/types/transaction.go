@@ -18,13 +18,18 @@ package types
 
 import (
 	"container/heap"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
+	"strings"
 	"sync/atomic"
 
 	"github.com/chislab/go-fiscobcos/common"
 	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/common/math"
 	"github.com/chislab/go-fiscobcos/crypto"
 	"github.com/chislab/go-fiscobcos/rlp"
 )
@@ -33,10 +38,24 @@ import (
 
 var (
 	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
+
+	errTxFieldCount = errors.New("invalid transaction field count")
+	errInvalidV     = errors.New("invalid transaction v value")
+	errTxHash       = errors.New("transaction hash does not match its content")
 )
 
+// Transaction is a FISCO BCOS 2.x transaction. Its signed RLP form has 13 fields:
+// the 10 signed fields (randomid, gasPrice, gas, blockLimit, to, value, data,
+// chainId, groupId, extraData) followed by v, r and s. Transactions of nodes
+// predating 2.0 lack chainId, groupId and extraData; they are decoded too, and
+// re-encoded in their original form so that their hash is preserved.
+//
+// Transactions of guomi chains are signed with SM2 (see SM2Signer) and carry the
+// 64 byte public key of the sender in place of v. They are hashed with SM3.
 type Transaction struct {
-	data txdata
+	data   txdata
+	legacy bool // decoded from the pre-2.0 encoding
+	gm     bool // signed with SM2, v holding the sender's public key
 	// caches
 	hash atomic.Value
 	size atomic.Value
@@ -44,18 +63,18 @@ type Transaction struct {
 }
 
 type txdata struct {
-	RandomId   uint64          `json:"randomid"    gencodec:"required"`
+	RandomId   *big.Int        `json:"randomid"    gencodec:"required"`
 	Price      *big.Int        `json:"gasPrice" gencodec:"required"`
 	GasLimit   uint64          `json:"gas"      gencodec:"required"`
-	BlockLimit uint64          `json:"blockLimit"      gencodec:"required"`
+	BlockLimit *big.Int        `json:"blockLimit"      gencodec:"required"`
 	Recipient  *common.Address `json:"to"       rlp:"nil"` // nil means contract creation
 	Amount     *big.Int        `json:"value"    gencodec:"required"`
 	Payload    []byte          `json:"input"    gencodec:"required"`
 
-	// for fisco bcos 2.0
-	ChainId   *big.Int `json:"chainId"    gencodec:"required"`
-	GroupId   *big.Int `json:"groupId"    gencodec:"required"`
-	ExtraData []byte   `json:"extraData"    gencodec:"required"`
+	// for fisco bcos 2.0, nil in transactions of older nodes
+	ChainId   *big.Int `json:"chainId"`
+	GroupId   *big.Int `json:"groupId"`
+	ExtraData []byte   `json:"extraData"`
 
 	// Signature values
 	V *big.Int `json:"v" gencodec:"required"`
@@ -66,11 +85,40 @@ type txdata struct {
 	Hash *common.Hash `json:"hash" rlp:"-"`
 }
 
+// signedTxdata is the RLP encoding of txdata, decoding v as a string since guomi
+// transactions store a 64 byte public key in it, which may have leading zeros.
+type signedTxdata struct {
+	RandomId   *big.Int
+	Price      *big.Int
+	GasLimit   uint64
+	BlockLimit *big.Int
+	Recipient  *common.Address `rlp:"nil"`
+	Amount     *big.Int
+	Payload    []byte
+	ChainId    *big.Int
+	GroupId    *big.Int
+	ExtraData  []byte
+	V          []byte
+	R, S       *big.Int
+}
+
+// legacyTxdata is the transaction encoding of nodes predating FISCO BCOS 2.0.
+type legacyTxdata struct {
+	RandomId   *big.Int
+	Price      *big.Int
+	GasLimit   uint64
+	BlockLimit *big.Int
+	Recipient  *common.Address `rlp:"nil"`
+	Amount     *big.Int
+	Payload    []byte
+	V, R, S    *big.Int
+}
+
 type txdataMarshaling struct {
-	RandomId   hexutil.Uint64
+	RandomId   *hexutil.Big
 	Price      *hexutil.Big
 	GasLimit   hexutil.Uint64
-	BlockLimit hexutil.Uint64
+	BlockLimit *hexutil.Big
 	Amount     *hexutil.Big
 	Payload    hexutil.Bytes
 
@@ -79,60 +127,112 @@ type txdataMarshaling struct {
 	GroupId   *hexutil.Big
 	ExtraData hexutil.Bytes
 
-	V *hexutil.Big
+	V *txV
 	R *hexutil.Big
 	S *hexutil.Big
 }
 
-func NewTransaction(nonce, blockLimit uint64, to common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, chainId *big.Int, groupId *big.Int, extraData []byte) *Transaction {
-	return newTransaction(nonce, blockLimit, &to, amount, gasLimit, gasPrice, data, chainId, groupId, extraData)
+// txV is the JSON form of v. Guomi transactions carry a 64 byte public key in
+// it, which exceeds the 256 bits hexutil.Big accepts.
+type txV big.Int
+
+// MarshalText implements encoding.TextMarshaler.
+func (v *txV) MarshalText() ([]byte, error) {
+	return (*hexutil.Big)(v).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *txV) UnmarshalText(input []byte) error {
+	if len(input) <= 2+64 {
+		return (*hexutil.Big)(v).UnmarshalText(input)
+	}
+	if len(input) > 2+128 || input[0] != '0' || (input[1] != 'x' && input[1] != 'X') || input[2] == '0' {
+		return errInvalidV
+	}
+	if _, ok := (*big.Int)(v).SetString(string(input[2:]), 16); !ok {
+		return hexutil.ErrSyntax
+	}
+	return nil
+}
+
+// maxRandomNonce bounds the random nonces, which nodes require to be below 2^250.
+var maxRandomNonce = new(big.Int).Lsh(big.NewInt(1), 250)
+
+// NewRandomNonce returns a random transaction nonce. FISCO BCOS dedupes
+// transactions by this random id rather than by an account sequence number, so
+// every transaction needs a fresh one.
+func NewRandomNonce() *big.Int {
+	nonce, err := rand.Int(rand.Reader, maxRandomNonce)
+	if err != nil {
+		panic("types: failed to read random nonce: " + err.Error())
+	}
+	return nonce
+}
+
+// NewTransaction creates an unsigned transaction calling the contract at to. A
+// nil nonce is replaced by NewRandomNonce.
+func NewTransaction(nonce *big.Int, to common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, blockLimit, chainId, groupId *big.Int, extraData []byte) *Transaction {
+	return newTransaction(nonce, &to, amount, gasLimit, gasPrice, data, blockLimit, chainId, groupId, extraData)
 }
 
-func NewContractCreation(nonce, blockLimit uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, chainId *big.Int, groupId *big.Int, extraData []byte) *Transaction {
-	return newTransaction(nonce, blockLimit, nil, amount, gasLimit, gasPrice, data, chainId, groupId, extraData)
+// NewContractCreation creates an unsigned transaction deploying a contract. A nil
+// nonce is replaced by NewRandomNonce.
+func NewContractCreation(nonce *big.Int, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, blockLimit, chainId, groupId *big.Int, extraData []byte) *Transaction {
+	return newTransaction(nonce, nil, amount, gasLimit, gasPrice, data, blockLimit, chainId, groupId, extraData)
 }
 
-func newTransaction(nonce, blockLimit uint64, to *common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, chainId *big.Int, groupId *big.Int, extraData []byte) *Transaction {
+func newTransaction(nonce *big.Int, to *common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, blockLimit, chainId, groupId *big.Int, extraData []byte) *Transaction {
 	if len(data) > 0 {
 		data = common.CopyBytes(data)
 	}
+	if len(extraData) > 0 {
+		extraData = common.CopyBytes(extraData)
+	}
 	d := txdata{
-		RandomId:   nonce,
+		RandomId:   new(big.Int),
 		Recipient:  to,
 		Payload:    data,
-		Amount:     amount,
+		Amount:     new(big.Int),
 		GasLimit:   gasLimit,
-		BlockLimit: blockLimit,
-		Price:      gasPrice,
+		BlockLimit: new(big.Int),
+		Price:      new(big.Int),
 
-		ChainId:   chainId,
-		GroupId:   groupId,
+		ChainId:   new(big.Int),
+		GroupId:   new(big.Int),
 		ExtraData: extraData,
 
 		V: new(big.Int),
 		R: new(big.Int),
 		S: new(big.Int),
 	}
+	if nonce == nil {
+		nonce = NewRandomNonce()
+	}
+	d.RandomId.Set(nonce)
 	if amount != nil {
 		d.Amount.Set(amount)
 	}
 	if gasPrice != nil {
 		d.Price.Set(gasPrice)
 	}
+	if blockLimit != nil {
+		d.BlockLimit.Set(blockLimit)
+	}
 	if chainId != nil {
 		d.ChainId.Set(chainId)
 	}
-
 	if groupId != nil {
 		d.GroupId.Set(groupId)
 	}
-
 	return &Transaction{data: d}
 }
 
-// ChainId returns which chain id this transaction was signed for (if at all)
+// ChainId returns the chain the transaction is valid on.
 func (tx *Transaction) ChainId() *big.Int {
-	return deriveChainId(tx.data.V)
+	if tx.data.ChainId == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(tx.data.ChainId)
 }
 
 // Protected returns whether the transaction is protected from replay protection.
@@ -151,21 +251,126 @@ func isProtectedV(V *big.Int) bool {
 
 // EncodeRLP implements rlp.Encoder
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	if tx.legacy {
+		return rlp.Encode(w, &legacyTxdata{
+			RandomId:   tx.data.RandomId,
+			Price:      tx.data.Price,
+			GasLimit:   tx.data.GasLimit,
+			BlockLimit: tx.data.BlockLimit,
+			Recipient:  tx.data.Recipient,
+			Amount:     tx.data.Amount,
+			Payload:    tx.data.Payload,
+			V:          tx.data.V,
+			R:          tx.data.R,
+			S:          tx.data.S,
+		})
+	}
+	if tx.gm {
+		return rlp.Encode(w, &signedTxdata{
+			RandomId:   tx.data.RandomId,
+			Price:      tx.data.Price,
+			GasLimit:   tx.data.GasLimit,
+			BlockLimit: tx.data.BlockLimit,
+			Recipient:  tx.data.Recipient,
+			Amount:     tx.data.Amount,
+			Payload:    tx.data.Payload,
+			ChainId:    tx.data.ChainId,
+			GroupId:    tx.data.GroupId,
+			ExtraData:  tx.data.ExtraData,
+			V:          math.PaddedBigBytes(tx.data.V, 64),
+			R:          tx.data.R,
+			S:          tx.data.S,
+		})
+	}
 	return rlp.Encode(w, &tx.data)
 }
 
-// DecodeRLP implements rlp.Decoder
+// DecodeRLP implements rlp.Decoder, accepting both the 13 field FISCO BCOS 2.x
+// encoding and the 10 field encoding of earlier nodes.
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	blob, err := s.Raw()
+	if err != nil {
+		return err
 	}
+	content, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return err
+	}
+	fields, err := rlp.CountValues(content)
+	if err != nil {
+		return err
+	}
+	switch fields {
+	case 13:
+		var dec signedTxdata
+		if err := rlp.DecodeBytes(blob, &dec); err != nil {
+			return err
+		}
+		// A 64 byte v is the public key of a guomi transaction, anything else
+		// must be a canonical integer.
+		gm := len(dec.V) == 64
+		if !gm && (len(dec.V) > 32 || (len(dec.V) > 0 && dec.V[0] == 0)) {
+			return errInvalidV
+		}
+		tx.data = txdata{
+			RandomId:   dec.RandomId,
+			Price:      dec.Price,
+			GasLimit:   dec.GasLimit,
+			BlockLimit: dec.BlockLimit,
+			Recipient:  dec.Recipient,
+			Amount:     dec.Amount,
+			Payload:    dec.Payload,
+			ChainId:    dec.ChainId,
+			GroupId:    dec.GroupId,
+			ExtraData:  dec.ExtraData,
+			V:          new(big.Int).SetBytes(dec.V),
+			R:          dec.R,
+			S:          dec.S,
+		}
+		tx.legacy, tx.gm = false, gm
+	case 10:
+		var dec legacyTxdata
+		if err := rlp.DecodeBytes(blob, &dec); err != nil {
+			return err
+		}
+		tx.data = txdata{
+			RandomId:   dec.RandomId,
+			Price:      dec.Price,
+			GasLimit:   dec.GasLimit,
+			BlockLimit: dec.BlockLimit,
+			Recipient:  dec.Recipient,
+			Amount:     dec.Amount,
+			Payload:    dec.Payload,
+			V:          dec.V,
+			R:          dec.R,
+			S:          dec.S,
+		}
+		tx.legacy = true
+	default:
+		return errTxFieldCount
+	}
+	tx.size.Store(common.StorageSize(len(blob)))
+	return nil
+}
 
-	return err
+// DecodeRawTx decodes a hex encoded signed transaction, as sent by
+// sendRawTransaction, in either the 2.x or the pre-2.0 form. The 0x prefix is
+// optional.
+func DecodeRawTx(hexStr string) (*Transaction, error) {
+	hexStr = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(hexStr), "0x"), "0X")
+	raw, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw transaction: %v", err)
+	}
+	tx := new(Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return nil, fmt.Errorf("invalid raw transaction: %v", err)
+	}
+	return tx, nil
 }
 
-// MarshalJSON encodes the web3 RPC transaction format.
+// MarshalJSON encodes the web3 RPC transaction format. Transactions of nodes
+// predating 2.0 have a null chainId and groupId.
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	hash := tx.Hash()
 	data := tx.data
@@ -173,13 +378,23 @@ func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	return data.MarshalJSON()
 }
 
-// UnmarshalJSON decodes the web3 RPC transaction format.
+// UnmarshalJSON decodes the web3 RPC transaction format. A transaction without
+// chainId and groupId is taken to be of a node predating 2.0. If the input
+// carries a hash, it must match the hash of the decoded transaction.
 func (tx *Transaction) UnmarshalJSON(input []byte) error {
 	var dec txdata
 	if err := dec.UnmarshalJSON(input); err != nil {
 		return err
 	}
-
+	hash := dec.Hash
+	dec.Hash = nil
+	legacy := dec.ChainId == nil && dec.GroupId == nil
+
+	// A v wider than a signature value is the public key of a guomi transaction.
+	if dec.V.BitLen() > 256 {
+		*tx = Transaction{data: dec, legacy: legacy, gm: true}
+		return tx.checkHash(hash)
+	}
 	withSignature := dec.V.Sign() != 0 || dec.R.Sign() != 0 || dec.S.Sign() != 0
 	if withSignature {
 		var V byte
@@ -194,7 +409,15 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 		}
 	}
 
-	*tx = Transaction{data: dec}
+	*tx = Transaction{data: dec, legacy: legacy}
+	return tx.checkHash(hash)
+}
+
+// checkHash verifies a hash decoded along with the transaction.
+func (tx *Transaction) checkHash(hash *common.Hash) error {
+	if hash != nil && *hash != tx.Hash() {
+		return errTxHash
+	}
 	return nil
 }
 
@@ -202,9 +425,23 @@ func (tx *Transaction) Data() []byte       { return common.CopyBytes(tx.data.Pay
 func (tx *Transaction) Gas() uint64        { return tx.data.GasLimit }
 func (tx *Transaction) GasPrice() *big.Int { return new(big.Int).Set(tx.data.Price) }
 func (tx *Transaction) Value() *big.Int    { return new(big.Int).Set(tx.data.Amount) }
-func (tx *Transaction) RandomId() uint64   { return tx.data.RandomId }
+func (tx *Transaction) RandomId() *big.Int { return new(big.Int).Set(tx.data.RandomId) }
 func (tx *Transaction) CheckNonce() bool   { return true }
 
+// BlockLimit returns the block number after which the transaction is rejected.
+func (tx *Transaction) BlockLimit() *big.Int { return new(big.Int).Set(tx.data.BlockLimit) }
+
+// GroupId returns the group the transaction is sent to.
+func (tx *Transaction) GroupId() *big.Int {
+	if tx.data.GroupId == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(tx.data.GroupId)
+}
+
+// ExtraData returns the application data attached to the transaction.
+func (tx *Transaction) ExtraData() []byte { return common.CopyBytes(tx.data.ExtraData) }
+
 // To returns the recipient address of the transaction.
 // It returns nil if the transaction is a contract creation.
 func (tx *Transaction) To() *common.Address {
@@ -221,7 +458,12 @@ func (tx *Transaction) Hash() common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-	v := rlpHash(tx)
+	var v common.Hash
+	if tx.gm {
+		v = sm3RlpHash(tx)
+	} else {
+		v = rlpHash(tx)
+	}
 	tx.hash.Store(v)
 	return v
 }
@@ -233,7 +475,7 @@ func (tx *Transaction) Hash() common.Hash {
 // XXX Rename message to something less arbitrary?
 func (tx *Transaction) AsMessage(s Signer) (Message, error) {
 	msg := Message{
-		nonce:      tx.data.RandomId,
+		nonce:      tx.data.RandomId.Uint64(),
 		gasLimit:   tx.data.GasLimit,
 		gasPrice:   new(big.Int).Set(tx.data.Price),
 		to:         tx.data.Recipient,
@@ -254,11 +496,28 @@ func (tx *Transaction) WithSignature(signer Signer, sig []byte) (*Transaction, e
 	if err != nil {
 		return nil, err
 	}
-	cpy := &Transaction{data: tx.data}
+	cpy := &Transaction{data: tx.data, legacy: tx.legacy}
+	_, cpy.gm = signer.(SM2Signer)
 	cpy.data.R, cpy.data.S, cpy.data.V = r, s, v
 	return cpy, nil
 }
 
+// Renew returns an unsigned copy of tx with another nonce and block limit, for
+// sending the transaction again after its block limit passed. A nil nonce is
+// replaced by NewRandomNonce. The copy needs to be signed again, its hash
+// differs from the one of tx.
+func (tx *Transaction) Renew(nonce, blockLimit *big.Int) *Transaction {
+	d := tx.data
+	if nonce == nil {
+		nonce = NewRandomNonce()
+	}
+	d.RandomId = new(big.Int).Set(nonce)
+	d.BlockLimit = new(big.Int).Set(blockLimit)
+	d.V, d.R, d.S = new(big.Int), new(big.Int), new(big.Int)
+	d.Hash = nil
+	return &Transaction{data: d, legacy: tx.legacy}
+}
+
 // Cost returns amount + gasprice * gaslimit.
 func (tx *Transaction) Cost() *big.Int {
 	total := new(big.Int).Mul(tx.data.Price, new(big.Int).SetUint64(tx.data.GasLimit))
@@ -309,7 +568,7 @@ func TxDifference(a, b Transactions) Transactions {
 type TxByNonce Transactions
 
 func (s TxByNonce) Len() int           { return len(s) }
-func (s TxByNonce) Less(i, j int) bool { return s[i].data.RandomId < s[j].data.RandomId }
+func (s TxByNonce) Less(i, j int) bool { return s[i].data.RandomId.Cmp(s[j].data.RandomId) < 0 }
 func (s TxByNonce) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // TxByPrice implements both the sort and the heap interface, making it useful
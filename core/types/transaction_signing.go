@@ -23,12 +23,18 @@ import (
 	"math/big"
 
 	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
 	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
 	"github.com/chislab/go-fiscobcos/params"
 )
 
 var (
 	ErrInvalidChainId = errors.New("invalid chain id for signer")
+
+	// ErrSignerKeyMismatch is returned by SignTx for an SM2 key with a standard
+	// signer, or a secp256k1 key with SM2Signer.
+	ErrSignerKeyMismatch = errors.New("private key curve doesn't match signer")
 )
 
 // sigCache is used to cache the derived sender and contains
@@ -52,10 +58,48 @@ func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) Signer {
 	return signer
 }
 
-// SignTx signs the transaction using the given signer and private key
+// ChainMode selects the cryptography of a chain.
+type ChainMode int
+
+const (
+	// ChainModeStandard chains sign with secp256k1 and hash with Keccak256.
+	ChainModeStandard ChainMode = iota
+	// ChainModeGM (guomi) chains sign with SM2 and hash with SM3.
+	ChainModeGM
+)
+
+func (m ChainMode) String() string {
+	if m == ChainModeGM {
+		return "gm"
+	}
+	return "standard"
+}
+
+// NewChainSigner returns the transaction signer of chains of the given mode.
+func NewChainSigner(mode ChainMode) Signer {
+	if mode == ChainModeGM {
+		return SM2Signer{}
+	}
+	return FiscoSigner{}
+}
+
+// SignTx signs the transaction using the given signer and private key. SM2Signer
+// requires an SM2 key (see crypto/gm), other signers a secp256k1 key.
 func SignTx(tx *Transaction, s Signer, prv *ecdsa.PrivateKey) (*Transaction, error) {
 	h := s.Hash(tx)
-	sig, err := crypto.Sign(h[:], prv)
+	var (
+		sig []byte
+		err error
+	)
+	_, sm2 := s.(SM2Signer)
+	if sm2 != gm.IsSM2(&prv.PublicKey) {
+		return nil, ErrSignerKeyMismatch
+	}
+	if sm2 {
+		sig, err = gm.SignHash(h[:], prv)
+	} else {
+		sig, err = crypto.Sign(h[:], prv)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +172,7 @@ func (s EIP155Signer) Sender(tx *Transaction) (common.Address, error) {
 	if !tx.Protected() {
 		return HomesteadSigner{}.Sender(tx)
 	}
-	if tx.ChainId().Cmp(s.chainId) != 0 {
+	if deriveChainId(tx.data.V).Cmp(s.chainId) != 0 {
 		return common.Address{}, ErrInvalidChainId
 	}
 	V := new(big.Int).Sub(tx.data.V, s.chainIdMul)
@@ -164,6 +208,91 @@ func (s EIP155Signer) Hash(tx *Transaction) common.Hash {
 	})
 }
 
+// FiscoSigner implements Signer for FISCO BCOS 2.x transactions. The signed hash
+// covers the 10 unsigned fields (randomid, gasPrice, gas, blockLimit, to, value,
+// data, chainId, groupId, extraData) and v is the recovery id plus 27, as the
+// node expects; replay protection comes from the chainId and groupId fields
+// rather than from v.
+type FiscoSigner struct{}
+
+func (s FiscoSigner) Equal(s2 Signer) bool {
+	_, ok := s2.(FiscoSigner)
+	return ok
+}
+
+func (s FiscoSigner) Sender(tx *Transaction) (common.Address, error) {
+	return recoverPlain(s.Hash(tx), tx.data.R, tx.data.S, tx.data.V, true)
+}
+
+// SignatureValues returns signature values. This signature
+// needs to be in the [R || S || V] format where V is 0 or 1.
+func (s FiscoSigner) SignatureValues(tx *Transaction, sig []byte) (r, sv, v *big.Int, err error) {
+	if len(sig) != 65 {
+		return nil, nil, nil, fmt.Errorf("wrong size for signature: got %d, want 65", len(sig))
+	}
+	r = new(big.Int).SetBytes(sig[:32])
+	sv = new(big.Int).SetBytes(sig[32:64])
+	v = new(big.Int).SetBytes([]byte{sig[64] + 27})
+	return r, sv, v, nil
+}
+
+// Hash returns the hash to be signed by the sender.
+// It does not uniquely identify the transaction.
+func (s FiscoSigner) Hash(tx *Transaction) common.Hash {
+	return FrontierSigner{}.Hash(tx)
+}
+
+// SM2Signer implements Signer for transactions of guomi chains. The signed hash is
+// the SM3 hash of the 10 unsigned transaction fields, and signatures are in the
+// form produced by gm.SignHash: r, s and the signer's 64 byte public key, which
+// is stored in v as SM2 signatures don't allow recovering it.
+type SM2Signer struct{}
+
+func (s SM2Signer) Equal(s2 Signer) bool {
+	_, ok := s2.(SM2Signer)
+	return ok
+}
+
+func (s SM2Signer) Sender(tx *Transaction) (common.Address, error) {
+	pub, err := gm.UnmarshalPubkey(math.PaddedBigBytes(tx.data.V, 64))
+	if err != nil {
+		return common.Address{}, ErrInvalidSig
+	}
+	if !gm.Verify(pub, s.Hash(tx).Bytes(), tx.data.R, tx.data.S) {
+		return common.Address{}, ErrInvalidSig
+	}
+	return gm.PubkeyToAddress(*pub), nil
+}
+
+// SignatureValues returns signature values. This signature needs to be in the
+// [R || S || public key] format produced by gm.SignHash.
+func (s SM2Signer) SignatureValues(tx *Transaction, sig []byte) (r, sv, v *big.Int, err error) {
+	if len(sig) != gm.SignatureLength {
+		return nil, nil, nil, fmt.Errorf("wrong size for sm2 signature: got %d, want %d", len(sig), gm.SignatureLength)
+	}
+	r = new(big.Int).SetBytes(sig[:32])
+	sv = new(big.Int).SetBytes(sig[32:64])
+	v = new(big.Int).SetBytes(sig[64:])
+	return r, sv, v, nil
+}
+
+// Hash returns the hash to be signed by the sender.
+// It does not uniquely identify the transaction.
+func (s SM2Signer) Hash(tx *Transaction) common.Hash {
+	return sm3RlpHash([]interface{}{
+		tx.data.RandomId,
+		tx.data.Price,
+		tx.data.GasLimit,
+		tx.data.BlockLimit,
+		tx.data.Recipient,
+		tx.data.Amount,
+		tx.data.Payload,
+		tx.data.ChainId,
+		tx.data.GroupId,
+		tx.data.ExtraData,
+	})
+}
+
 // HomesteadTransaction implements TransactionInterface using the
 // homestead rules.
 type HomesteadSigner struct{ FrontierSigner }
@@ -0,0 +1,110 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+// vectorTx is the transaction of the signing vector: set(10) called on a
+// contract of group 1, chain 1.
+func vectorTx() *Transaction {
+	return NewTransaction(big.NewInt(100), common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1"), big.NewInt(0), 30000000, big.NewInt(30000000),
+		hexutil.MustDecode("0x60fe47b1000000000000000000000000000000000000000000000000000000000000000a"),
+		big.NewInt(600), big.NewInt(1), big.NewInt(1), nil)
+}
+
+func TestFiscoSignerVector(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	var (
+		wantHash = common.HexToHash("0xec1ac424001ebe00c0c52335ebdebfed8ddd9d8e2571cadbbf694aa9fc8e1a7a")
+		wantRaw  = hexutil.MustDecode("0xf88f648401c9c3808401c9c380820258946849f21d1e455e9f0712b1e99fa4fcd23758e8f180a460fe47b1000000000000000000000000000000000000000000000000000000000000000a0101801ca0a6c83f3e106a26a1dfd66bc1796f7ac44b2578768537e739f1308ac02e4e9224a07c5c8b7a97c046d880befc8f99a17d658f8cdf9944d4a4520584a7b92ad51cfd")
+	)
+	tx := vectorTx()
+	if hash := (FiscoSigner{}).Hash(tx); hash != wantHash {
+		t.Errorf("signing hash %x, want %x", hash, wantHash)
+	}
+	signed, err := SignTx(tx, FiscoSigner{}, key)
+	if err != nil {
+		t.Fatalf("SignTx error: %v", err)
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		t.Fatalf("encoding error: %v", err)
+	}
+	if string(raw) != string(wantRaw) {
+		t.Errorf("signed transaction mismatch\ngot  %x\nwant %x", raw, wantRaw)
+	}
+
+	// The vector's sender is recovered from the raw transaction alone.
+	var dec Transaction
+	if err := rlp.DecodeBytes(wantRaw, &dec); err != nil {
+		t.Fatalf("decoding error: %v", err)
+	}
+	from, err := Sender(FiscoSigner{}, &dec)
+	if err != nil {
+		t.Fatalf("Sender error: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); from != want {
+		t.Errorf("recovered sender %x, want %x", from, want)
+	}
+	if v, _, _ := dec.RawSignatureValues(); v.Uint64() != 27 && v.Uint64() != 28 {
+		t.Errorf("v = %v, want 27 or 28", v)
+	}
+}
+
+func TestSM2SignerRoundTrip(t *testing.T) {
+	key, err := gm.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := SignTx(vectorTx(), NewChainSigner(ChainModeGM), key)
+	if err != nil {
+		t.Fatalf("SignTx error: %v", err)
+	}
+	raw, _ := rlp.EncodeToBytes(signed)
+	var dec Transaction
+	if err := rlp.DecodeBytes(raw, &dec); err != nil {
+		t.Fatalf("decoding error: %v", err)
+	}
+	from, err := Sender(NewChainSigner(ChainModeGM), &dec)
+	if err != nil {
+		t.Fatalf("Sender error: %v", err)
+	}
+	if want := gm.PubkeyToAddress(key.PublicKey); from != want {
+		t.Errorf("recovered sender %x, want %x", from, want)
+	}
+}
+
+func TestSignTxKeyMismatch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	gmKey, _ := gm.GenerateKey(rand.Reader)
+	if _, err := SignTx(vectorTx(), NewChainSigner(ChainModeGM), key); err != ErrSignerKeyMismatch {
+		t.Errorf("SM2 signer with a secp256k1 key: got error %v, want ErrSignerKeyMismatch", err)
+	}
+	if _, err := SignTx(vectorTx(), NewChainSigner(ChainModeStandard), gmKey); err != ErrSignerKeyMismatch {
+		t.Errorf("FISCO signer with an SM2 key: got error %v, want ErrSignerKeyMismatch", err)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/rlp"
+)
+
+func randBig(rnd *mrand.Rand, maxBytes int) *big.Int {
+	b := make([]byte, rnd.Intn(maxBytes+1))
+	rnd.Read(b)
+	return new(big.Int).SetBytes(b)
+}
+
+func randBytes(rnd *mrand.Rand, sizes ...int) []byte {
+	b := make([]byte, sizes[rnd.Intn(len(sizes))])
+	rnd.Read(b)
+	return b
+}
+
+// randTransaction returns a random transaction signed for mode.
+func randTransaction(t testing.TB, rnd *mrand.Rand, mode ChainMode, key *ecdsa.PrivateKey) *Transaction {
+	var tx *Transaction
+	data := randBytes(rnd, 0, 1, 4, 68, 200, 5000)
+	extra := randBytes(rnd, 0, 1, 32)
+	if rnd.Intn(4) == 0 {
+		tx = NewContractCreation(randBig(rnd, 32), randBig(rnd, 8), rnd.Uint64(), randBig(rnd, 8), data, randBig(rnd, 8), randBig(rnd, 2), randBig(rnd, 2), extra)
+	} else {
+		var to common.Address
+		rnd.Read(to[:])
+		tx = NewTransaction(randBig(rnd, 32), to, randBig(rnd, 8), rnd.Uint64(), randBig(rnd, 8), data, randBig(rnd, 8), randBig(rnd, 2), randBig(rnd, 2), extra)
+	}
+	signed, err := SignTx(tx, NewChainSigner(mode), key)
+	if err != nil {
+		t.Fatalf("can't sign transaction: %v", err)
+	}
+	return signed
+}
+
+// TestTransactionEncodingDifferential checks that EncodeToBytes and the pooled
+// EncoderBuffer encode transactions exactly as encoding to a writer does, and
+// that the pooled hashers hash them as the unpooled ones did.
+func TestTransactionEncodingDifferential(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	gmKey, _ := gm.GenerateKey(rand.Reader)
+	rnd := mrand.New(mrand.NewSource(1))
+	buf := rlp.NewEncoderBuffer()
+	defer buf.Release()
+
+	for i := 0; i < 2000; i++ {
+		mode, k, oldHash := ChainModeStandard, key, unpooledRlpHash
+		if i%2 == 1 {
+			mode, k, oldHash = ChainModeGM, gmKey, unpooledSm3RlpHash
+		}
+		tx := randTransaction(t, rnd, mode, k)
+
+		want := new(bytes.Buffer)
+		if err := rlp.Encode(want, tx); err != nil {
+			t.Fatalf("tx %d: Encode error: %v", i, err)
+		}
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatalf("tx %d: EncodeToBytes error: %v", i, err)
+		}
+		if !bytes.Equal(enc, want.Bytes()) {
+			t.Fatalf("tx %d: EncodeToBytes mismatch\ngot  %x\nwant %x", i, enc, want.Bytes())
+		}
+		enc, err = buf.Encode(tx)
+		if err != nil {
+			t.Fatalf("tx %d: EncoderBuffer error: %v", i, err)
+		}
+		if !bytes.Equal(enc, want.Bytes()) {
+			t.Fatalf("tx %d: EncoderBuffer mismatch\ngot  %x\nwant %x", i, enc, want.Bytes())
+		}
+		if have, want := tx.Hash(), oldHash(tx); have != want {
+			t.Fatalf("tx %d (%v): hash mismatch: have %x, want %x", i, mode, have, want)
+		}
+
+		var dec Transaction
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatalf("tx %d: decode error: %v", i, err)
+		}
+		if dec.Hash() != tx.Hash() {
+			t.Fatalf("tx %d: hash changed in round trip", i)
+		}
+	}
+}
+
+// fieldCount returns the number of fields of an encoded transaction.
+func fieldCount(t *testing.T, enc []byte) int {
+	t.Helper()
+	content, _, err := rlp.SplitList(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := rlp.CountValues(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTransactionEncoding(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	to := common.Address{0xc0}
+	nonce := new(big.Int).Lsh(big.NewInt(1), 200) // beyond uint64
+	tx := NewTransaction(nonce, to, big.NewInt(0), 30000000, big.NewInt(1), []byte{0x2a}, big.NewInt(600), big.NewInt(7), big.NewInt(3), []byte("extra"))
+	if tx.RandomId().Cmp(nonce) != 0 || tx.BlockLimit().Int64() != 600 || tx.ChainId().Int64() != 7 ||
+		tx.GroupId().Int64() != 3 || string(tx.ExtraData()) != "extra" || *tx.To() != to {
+		t.Fatalf("transaction fields: nonce %v, block limit %v, chain %v, group %v, extra %q, to %v",
+			tx.RandomId(), tx.BlockLimit(), tx.ChainId(), tx.GroupId(), tx.ExtraData(), tx.To())
+	}
+	if NewContractCreation(nil, nil, 0, nil, nil, nil, nil, nil, nil).RandomId().Sign() == 0 {
+		t.Error("nil nonce not replaced by a random one")
+	}
+	signed, err := SignTx(tx, NewChainSigner(ChainModeStandard), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fieldCount(t, enc); n != 13 {
+		t.Errorf("signed transaction encoded with %d fields, want 13", n)
+	}
+	var dec Transaction
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if dec.Hash() != signed.Hash() || dec.RandomId().Cmp(nonce) != 0 || dec.GroupId().Int64() != 3 || string(dec.ExtraData()) != "extra" {
+		t.Errorf("decoded transaction differs: %x, want %x", dec.Hash(), signed.Hash())
+	}
+
+	// Transactions of pre-2.0 nodes keep their encoding, and hash.
+	_, r, s := signed.RawSignatureValues()
+	legacy, _ := rlp.EncodeToBytes(&legacyTxdata{
+		RandomId:   nonce,
+		Price:      big.NewInt(1),
+		GasLimit:   30000000,
+		BlockLimit: big.NewInt(600),
+		Recipient:  &to,
+		Amount:     new(big.Int),
+		Payload:    []byte{0x2a},
+		V:          big.NewInt(27),
+		R:          r,
+		S:          s,
+	})
+	var old Transaction
+	if err := rlp.DecodeBytes(legacy, &old); err != nil {
+		t.Fatalf("decode error of a legacy transaction: %v", err)
+	}
+	if reenc, _ := rlp.EncodeToBytes(&old); !bytes.Equal(reenc, legacy) {
+		t.Errorf("legacy transaction re-encoded as %x, want %x", reenc, legacy)
+	}
+	if old.Hash() != crypto.Keccak256Hash(legacy) {
+		t.Errorf("legacy transaction hash %x, want %x", old.Hash(), crypto.Keccak256Hash(legacy))
+	}
+	if old.ChainId().Sign() != 0 || old.GroupId().Sign() != 0 || old.ExtraData() != nil || old.BlockLimit().Int64() != 600 {
+		t.Errorf("legacy transaction fields: chain %v, group %v, extra %x", old.ChainId(), old.GroupId(), old.ExtraData())
+	}
+
+	// fields returns the fields of a 2.x transaction with the given v.
+	fields := func(v interface{}) []interface{} {
+		return []interface{}{uint(1), uint(1), uint(30000000), uint(600), to, uint(0), []byte{}, uint(7), uint(3), []byte{}, v, uint(1), uint(1)}
+	}
+	tests := []struct {
+		name string
+		enc  []interface{}
+		err  error
+	}{
+		{"9 fields", fields(uint(27))[:9], errTxFieldCount},
+		{"11 fields", fields(uint(27))[:11], errTxFieldCount},
+		{"14 fields", append(fields(uint(27)), uint(1)), errTxFieldCount},
+		{"padded v", fields([]byte{0, 27}), errInvalidV},
+		{"33 byte v", fields(bytes.Repeat([]byte{1}, 33)), errInvalidV},
+		{"13 fields", fields(uint(27)), nil},
+		{"guomi v", fields(bytes.Repeat([]byte{1}, 64)), nil},
+	}
+	for _, test := range tests {
+		enc, err := rlp.EncodeToBytes(test.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rlp.DecodeBytes(enc, new(Transaction)); err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestNewRandomNonce(t *testing.T) {
+	var (
+		seen = make(map[string]bool)
+		high int // nonces above 2^240
+	)
+	for i := 0; i < 1000; i++ {
+		nonce := NewRandomNonce()
+		if nonce.Sign() < 0 || nonce.Cmp(maxRandomNonce) >= 0 {
+			t.Fatalf("nonce %x out of range", nonce)
+		}
+		if seen[nonce.String()] {
+			t.Fatalf("nonce %x drawn twice", nonce)
+		}
+		seen[nonce.String()] = true
+		if nonce.BitLen() > 240 {
+			high++
+		}
+		if tx := NewTransaction(nil, common.Address{}, nil, 0, nil, nil, nil, nil, nil, nil); seen[tx.RandomId().String()] {
+			t.Fatalf("transaction nonce %x drawn twice", tx.RandomId())
+		}
+	}
+	// About one in a thousand nonces is below 2^240.
+	if high < 990 {
+		t.Errorf("%d of 1000 nonces above 2^240, want the random ids to span 250 bits", high)
+	}
+}
+
+// TestTransactionRawAndJSON checks that signed transactions of both chain modes
+// and of pre-2.0 nodes decode from their raw form, hash as the node does, and
+// survive a JSON round trip.
+func TestTransactionRawAndJSON(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	gmKey, err := gm.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(tx *Transaction, mode ChainMode, key *ecdsa.PrivateKey) []byte {
+		signed, err := SignTx(tx, NewChainSigner(mode), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := rlp.EncodeToBytes(signed)
+		return raw
+	}
+	to := common.Address{0xc0}
+	call := NewTransaction(big.NewInt(9), to, big.NewInt(0), 30000000, big.NewInt(1), []byte{0x2a}, big.NewInt(600), big.NewInt(1), big.NewInt(2), []byte("audit"))
+	deploy := NewContractCreation(nil, nil, 30000000, nil, []byte{0x60, 0x80}, big.NewInt(600), big.NewInt(1), big.NewInt(1), nil)
+	legacy, _ := rlp.EncodeToBytes(&legacyTxdata{
+		RandomId:   big.NewInt(5),
+		Price:      big.NewInt(1),
+		GasLimit:   30000000,
+		BlockLimit: big.NewInt(600),
+		Recipient:  &to,
+		Amount:     new(big.Int),
+		Payload:    []byte{},
+		V:          big.NewInt(27),
+		R:          big.NewInt(1),
+		S:          big.NewInt(1),
+	})
+	tests := []struct {
+		name   string
+		raw    []byte
+		mode   ChainMode
+		sender common.Address // zero if not checked
+	}{
+		{"standard call", sign(call, ChainModeStandard, key), ChainModeStandard, crypto.PubkeyToAddress(key.PublicKey)},
+		{"standard deployment", sign(deploy, ChainModeStandard, key), ChainModeStandard, crypto.PubkeyToAddress(key.PublicKey)},
+		{"guomi call", sign(call, ChainModeGM, gmKey), ChainModeGM, gm.PubkeyToAddress(gmKey.PublicKey)},
+		{"guomi deployment", sign(deploy, ChainModeGM, gmKey), ChainModeGM, gm.PubkeyToAddress(gmKey.PublicKey)},
+		{"pre-2.0", legacy, ChainModeStandard, common.Address{}},
+	}
+	for _, test := range tests {
+		want := crypto.Keccak256Hash(test.raw)
+		if test.mode == ChainModeGM {
+			want = common.BytesToHash(gm.SM3(test.raw))
+		}
+		enc := common.Bytes2Hex(test.raw)
+		for _, s := range []string{"0x" + enc, enc, " 0X" + enc + "\n"} {
+			tx, err := DecodeRawTx(s)
+			if err != nil {
+				t.Errorf("%s: DecodeRawTx error: %v", test.name, err)
+				continue
+			}
+			if tx.Hash() != want {
+				t.Errorf("%s: hash %x, want %x", test.name, tx.Hash(), want)
+			}
+		}
+		tx, _ := DecodeRawTx(enc)
+
+		js, err := tx.MarshalJSON()
+		if err != nil {
+			t.Errorf("%s: encoding to JSON: %v", test.name, err)
+			continue
+		}
+		var dec Transaction
+		if err := dec.UnmarshalJSON(js); err != nil {
+			t.Errorf("%s: decoding %s: %v", test.name, js, err)
+			continue
+		}
+		if reenc, _ := rlp.EncodeToBytes(&dec); dec.Hash() != want || !bytes.Equal(reenc, test.raw) {
+			t.Errorf("%s: JSON round trip changed the transaction to %x", test.name, reenc)
+		}
+		if test.sender != (common.Address{}) {
+			if from, err := Sender(NewChainSigner(test.mode), &dec); err != nil || from != test.sender {
+				t.Errorf("%s: sender after JSON round trip %x, %v, want %x", test.name, from, err, test.sender)
+			}
+		}
+		// A hash not matching the content is rejected.
+		tampered := bytes.Replace(js, []byte(want.Hex()[2:]), []byte(common.Hash{1}.Hex()[2:]), 1)
+		if bytes.Equal(tampered, js) {
+			t.Fatalf("%s: hash missing from %s", test.name, js)
+		}
+		if err := new(Transaction).UnmarshalJSON(tampered); err != errTxHash {
+			t.Errorf("%s: decoding a tampered hash: %v, want errTxHash", test.name, err)
+		}
+	}
+	for _, s := range []string{"", "0x", "0xzz", "0x" + common.Bytes2Hex(legacy)[1:], "0xc0", "0x" + common.Bytes2Hex(legacy) + "00"} {
+		if tx, err := DecodeRawTx(s); err == nil {
+			t.Errorf("%q: decoded %x", s, tx.Hash())
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// DefaultGasPrice is the gas price FISCO BCOS nodes expect transactions to carry.
+// Nodes don't charge for gas, but the SDKs of FISCO BCOS all send this price.
+var DefaultGasPrice = big.NewInt(30000000)
+
+// TxBackend is the client a TxBuilder fills in transactions from.
+// *ethclient.Client implements it.
+type TxBackend interface {
+	// GetBlockLimit returns the block number after which a transaction sent now
+	// to the group is rejected.
+	GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error)
+	// ClientVersion returns the version of the node, carrying its chain id.
+	ClientVersion(ctx context.Context) (*ClientVersion, error)
+}
+
+// TxBuildError is returned by TxBuilder.Build if a field of the transaction is
+// invalid.
+type TxBuildError struct {
+	Field  string // name of the invalid field, e.g. "gasLimit"
+	Reason string
+}
+
+func (e *TxBuildError) Error() string {
+	return fmt.Sprintf("invalid transaction %s: %s", e.Field, e.Reason)
+}
+
+// TxBuilder builds unsigned transactions, filling in the fields FISCO BCOS
+// requires from defaults and from the node:
+//
+//	tx, err := types.NewTxBuilder(1).To(addr).Data(input).GasLimit(30000000).Build(ctx, client)
+//
+// The nonce is random, the block limit follows the chain height cached by the
+// client, the chain id is the one of the node and the gas price DefaultGasPrice.
+// Setters override them. Without a recipient the transaction deploys the
+// contract in its data.
+type TxBuilder struct {
+	groupId    uint64
+	to         *common.Address
+	data       []byte
+	value      *big.Int
+	gasLimit   uint64
+	gasPrice   *big.Int
+	nonce      *big.Int
+	blockLimit *big.Int
+	chainId    *big.Int
+	extraData  []byte
+}
+
+// NewTxBuilder starts building a transaction sent to a group.
+func NewTxBuilder(groupId uint64) *TxBuilder {
+	return &TxBuilder{groupId: groupId}
+}
+
+// To sets the contract the transaction calls.
+func (b *TxBuilder) To(to common.Address) *TxBuilder {
+	b.to = &to
+	return b
+}
+
+// Data sets the input of the transaction, or the code to deploy if it has no
+// recipient.
+func (b *TxBuilder) Data(data []byte) *TxBuilder {
+	b.data = common.CopyBytes(data)
+	return b
+}
+
+// Value sets the funds transferred along the transaction.
+func (b *TxBuilder) Value(value *big.Int) *TxBuilder {
+	b.value = value
+	return b
+}
+
+// GasLimit sets the gas the transaction may use. It's required.
+func (b *TxBuilder) GasLimit(gas uint64) *TxBuilder {
+	b.gasLimit = gas
+	return b
+}
+
+// GasPrice overrides DefaultGasPrice.
+func (b *TxBuilder) GasPrice(price *big.Int) *TxBuilder {
+	b.gasPrice = price
+	return b
+}
+
+// Nonce overrides the random nonce, e.g. to resend a transaction.
+func (b *TxBuilder) Nonce(nonce *big.Int) *TxBuilder {
+	b.nonce = nonce
+	return b
+}
+
+// BlockLimit overrides the block limit obtained from the client.
+func (b *TxBuilder) BlockLimit(limit *big.Int) *TxBuilder {
+	b.blockLimit = limit
+	return b
+}
+
+// ChainId overrides the chain id of the node.
+func (b *TxBuilder) ChainId(chainId *big.Int) *TxBuilder {
+	b.chainId = chainId
+	return b
+}
+
+// ExtraData sets the application data attached to the transaction.
+func (b *TxBuilder) ExtraData(data []byte) *TxBuilder {
+	b.extraData = common.CopyBytes(data)
+	return b
+}
+
+// Build validates the transaction and fills in its missing fields, asking the
+// client for the block limit and chain id unless they were set. It returns the
+// transaction ready to be signed, or a *TxBuildError naming the invalid field.
+func (b *TxBuilder) Build(ctx context.Context, client TxBackend) (*Transaction, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	blockLimit := b.blockLimit
+	if blockLimit == nil {
+		limit, err := client.GetBlockLimit(ctx, b.groupId)
+		if err != nil {
+			return nil, err
+		}
+		blockLimit = limit
+	}
+	chainId := b.chainId
+	if chainId == nil {
+		version, err := client.ClientVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if chainId = version.ParseChainId(); chainId == nil {
+			return nil, &TxBuildError{Field: "chainId", Reason: fmt.Sprintf("node reports invalid chain id %q", version.ChainId)}
+		}
+	}
+	gasPrice := b.gasPrice
+	if gasPrice == nil {
+		gasPrice = DefaultGasPrice
+	}
+	return newTransaction(b.nonce, b.to, b.value, b.gasLimit, gasPrice, b.data, blockLimit, chainId, new(big.Int).SetUint64(b.groupId), b.extraData), nil
+}
+
+// validate checks the fields set on the builder.
+func (b *TxBuilder) validate() error {
+	switch {
+	case b.groupId == 0:
+		return &TxBuildError{Field: "groupId", Reason: "groups are numbered from 1"}
+	case b.to == nil && len(b.data) == 0:
+		return &TxBuildError{Field: "data", Reason: "no recipient and no contract code to deploy"}
+	case b.gasLimit == 0:
+		return &TxBuildError{Field: "gasLimit", Reason: "zero gas"}
+	case b.value != nil && b.value.Sign() < 0:
+		return &TxBuildError{Field: "value", Reason: "negative value"}
+	case b.gasPrice != nil && b.gasPrice.Sign() < 0:
+		return &TxBuildError{Field: "gasPrice", Reason: "negative gas price"}
+	case b.nonce != nil && (b.nonce.Sign() < 0 || b.nonce.Cmp(maxRandomNonce) >= 0):
+		return &TxBuildError{Field: "nonce", Reason: "out of range [0, 2^250)"}
+	case b.blockLimit != nil && b.blockLimit.Sign() <= 0:
+		return &TxBuildError{Field: "blockLimit", Reason: "not a block number"}
+	case b.chainId != nil && b.chainId.Sign() < 0:
+		return &TxBuildError{Field: "chainId", Reason: "negative chain id"}
+	}
+	return nil
+}
+
+// parseChainId parses the chain id reported by a node, in decimal or hex.
+func parseChainId(s string) *big.Int {
+	chainId, err := hexutil.DecodeFlexibleBig(s)
+	if err != nil {
+		return nil
+	}
+	return chainId
+}
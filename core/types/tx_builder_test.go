@@ -0,0 +1,148 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// testTxBackend serves a fixed block limit and chain id, counting the requests.
+type testTxBackend struct {
+	chainId     string
+	err         error
+	limitCalls  int
+	versionCall int
+}
+
+func (b *testTxBackend) GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error) {
+	b.limitCalls++
+	if b.err != nil {
+		return nil, b.err
+	}
+	return big.NewInt(int64(500 + groupId)), nil
+}
+
+func (b *testTxBackend) ClientVersion(ctx context.Context) (*ClientVersion, error) {
+	b.versionCall++
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &ClientVersion{Version: "2.7.0", ChainId: b.chainId}, nil
+}
+
+func TestTxBuilder(t *testing.T) {
+	to := common.Address{0x70}
+	tests := []struct {
+		name  string
+		build *TxBuilder
+		field string // of the *TxBuildError, empty for success
+	}{
+		{name: "call", build: NewTxBuilder(1).To(to).Data([]byte{1, 2}).GasLimit(30000000)},
+		{name: "deployment", build: NewTxBuilder(2).Data([]byte{0x60, 0x80}).GasLimit(30000000)},
+		{name: "transfer", build: NewTxBuilder(1).To(to).Value(big.NewInt(5)).GasLimit(21000)},
+		{
+			name:  "overrides",
+			build: NewTxBuilder(3).To(to).GasLimit(1).GasPrice(big.NewInt(0)).Nonce(big.NewInt(9)).BlockLimit(big.NewInt(77)).ChainId(big.NewInt(0)).ExtraData([]byte("x")),
+		},
+		{name: "no group", build: NewTxBuilder(0).To(to).GasLimit(1), field: "groupId"},
+		{name: "nothing to deploy", build: NewTxBuilder(1).GasLimit(1), field: "data"},
+		{name: "zero gas", build: NewTxBuilder(1).To(to), field: "gasLimit"},
+		{name: "negative value", build: NewTxBuilder(1).To(to).GasLimit(1).Value(big.NewInt(-1)), field: "value"},
+		{name: "negative gas price", build: NewTxBuilder(1).To(to).GasLimit(1).GasPrice(big.NewInt(-1)), field: "gasPrice"},
+		{name: "negative nonce", build: NewTxBuilder(1).To(to).GasLimit(1).Nonce(big.NewInt(-1)), field: "nonce"},
+		{name: "nonce too large", build: NewTxBuilder(1).To(to).GasLimit(1).Nonce(new(big.Int).Lsh(big.NewInt(1), 250)), field: "nonce"},
+		{name: "zero block limit", build: NewTxBuilder(1).To(to).GasLimit(1).BlockLimit(new(big.Int)), field: "blockLimit"},
+		{name: "negative chain id", build: NewTxBuilder(1).To(to).GasLimit(1).ChainId(big.NewInt(-1)), field: "chainId"},
+	}
+	for _, test := range tests {
+		backend := &testTxBackend{chainId: "0x10"}
+		b := test.build
+		tx, err := b.Build(context.Background(), backend)
+		if test.field != "" {
+			e, ok := err.(*TxBuildError)
+			if !ok || e.Field != test.field {
+				t.Errorf("%s: got error %v, want one for %s", test.name, err, test.field)
+			}
+			if tx != nil || backend.limitCalls+backend.versionCall != 0 {
+				t.Errorf("%s: built a transaction or asked the backend", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Build error: %v", test.name, err)
+			continue
+		}
+		// Unset fields are filled in, set ones are kept.
+		want := struct {
+			blockLimit, chainId, gasPrice, value int64
+			calls                                int
+		}{int64(500 + b.groupId), 16, DefaultGasPrice.Int64(), 0, 2}
+		if b.blockLimit != nil {
+			want.blockLimit, want.chainId, want.gasPrice, want.calls = b.blockLimit.Int64(), b.chainId.Int64(), b.gasPrice.Int64(), 0
+		}
+		if b.value != nil {
+			want.value = b.value.Int64()
+		}
+		if tx.BlockLimit().Int64() != want.blockLimit || tx.ChainId().Int64() != want.chainId || tx.GasPrice().Int64() != want.gasPrice || tx.Value().Int64() != want.value {
+			t.Errorf("%s: got block limit %v, chain id %v, gas price %v, value %v", test.name, tx.BlockLimit(), tx.ChainId(), tx.GasPrice(), tx.Value())
+		}
+		if backend.limitCalls+backend.versionCall != want.calls {
+			t.Errorf("%s: asked the backend %d times, want %d", test.name, backend.limitCalls+backend.versionCall, want.calls)
+		}
+		if tx.GroupId().Uint64() != b.groupId || tx.Gas() != b.gasLimit || !bytes.Equal(tx.Data(), b.data) || !bytes.Equal(tx.ExtraData(), b.extraData) {
+			t.Errorf("%s: got group %v, gas %d, data %x, extra data %x", test.name, tx.GroupId(), tx.Gas(), tx.Data(), tx.ExtraData())
+		}
+		if (tx.To() == nil) != (b.to == nil) || (tx.To() != nil && *tx.To() != to) {
+			t.Errorf("%s: got recipient %v", test.name, tx.To())
+		}
+		if b.nonce != nil && tx.RandomId().Cmp(b.nonce) != 0 || tx.RandomId().Sign() < 0 || tx.RandomId().Cmp(maxRandomNonce) >= 0 {
+			t.Errorf("%s: got nonce %v", test.name, tx.RandomId())
+		}
+	}
+}
+
+func TestTxBuilderBackend(t *testing.T) {
+	failure := errors.New("node down")
+	if _, err := NewTxBuilder(1).To(common.Address{1}).GasLimit(1).Build(context.Background(), &testTxBackend{err: failure}); err != failure {
+		t.Errorf("failing backend: got error %v", err)
+	}
+	for _, chainId := range []string{"", "abc", "0xzz"} {
+		_, err := NewTxBuilder(1).To(common.Address{1}).GasLimit(1).Build(context.Background(), &testTxBackend{chainId: chainId})
+		if e, ok := err.(*TxBuildError); !ok || e.Field != "chainId" {
+			t.Errorf("chain id %q: got error %v", chainId, err)
+		}
+	}
+	for chainId, want := range map[string]int64{"1": 1, "0x10": 16, "20000": 20000} {
+		tx, err := NewTxBuilder(1).To(common.Address{1}).GasLimit(1).Build(context.Background(), &testTxBackend{chainId: chainId})
+		if err != nil || tx.ChainId().Int64() != want {
+			t.Errorf("chain id %q: got %v, %v, want %d", chainId, tx.ChainId(), err, want)
+		}
+	}
+	// Two builds get distinct random nonces.
+	b := NewTxBuilder(1).To(common.Address{1}).GasLimit(1)
+	tx1, _ := b.Build(context.Background(), &testTxBackend{chainId: "1"})
+	tx2, _ := b.Build(context.Background(), &testTxBackend{chainId: "1"})
+	if tx1.RandomId().Cmp(tx2.RandomId()) == 0 {
+		t.Errorf("two builds share the nonce %v", tx1.RandomId())
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// TxPoolStatus describes the transaction pool of a group on a node, along with
+// the system configs bounding how fast it drains.
+type TxPoolStatus struct {
+	Pending      uint64 // transactions waiting in the pool
+	TxCountLimit uint64 // transactions sealed per block, tx_count_limit
+	TxGasLimit   uint64 // gas a transaction may use, tx_gas_limit
+}
+
+// BlocksToDrain returns how many blocks it takes at least to seal the pending
+// transactions, 0 if the pool is empty or the limit unknown.
+func (s *TxPoolStatus) BlocksToDrain() uint64 {
+	if s.Pending == 0 || s.TxCountLimit == 0 {
+		return 0
+	}
+	return (s.Pending + s.TxCountLimit - 1) / s.TxCountLimit
+}
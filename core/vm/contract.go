@@ -0,0 +1,76 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+// Contract is code running in the context of an account, with the gas left to
+// it.
+type Contract struct {
+	Caller  common.Address
+	Address common.Address // account whose storage and balance the code acts on
+	Value   *big.Int
+	Code    []byte
+	Input   []byte
+	Gas     uint64
+
+	jumpdests []bool // lazily computed valid jump destinations
+}
+
+func newContract(caller, address common.Address, value *big.Int, code, input []byte, gas uint64) *Contract {
+	return &Contract{Caller: caller, Address: address, Value: value, Code: code, Input: input, Gas: gas}
+}
+
+// useGas deducts gas, reporting whether enough was left.
+func (c *Contract) useGas(gas uint64) bool {
+	if c.Gas < gas {
+		return false
+	}
+	c.Gas -= gas
+	return true
+}
+
+// opAt returns the opcode at pc, STOP past the end of the code.
+func (c *Contract) opAt(pc uint64) OpCode {
+	if pc < uint64(len(c.Code)) {
+		return OpCode(c.Code[pc])
+	}
+	return STOP
+}
+
+// validJump reports whether dest is a JUMPDEST instruction, not push data.
+func (c *Contract) validJump(dest *big.Int) bool {
+	if !dest.IsUint64() || dest.Uint64() >= uint64(len(c.Code)) {
+		return false
+	}
+	if c.jumpdests == nil {
+		c.jumpdests = make([]bool, len(c.Code))
+		for pc := 0; pc < len(c.Code); pc++ {
+			op := OpCode(c.Code[pc])
+			if op == JUMPDEST {
+				c.jumpdests[pc] = true
+			} else if op.IsPush() {
+				pc += int(op - PUSH1 + 1)
+			}
+		}
+	}
+	return c.jumpdests[dest.Uint64()]
+}
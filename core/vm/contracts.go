@@ -0,0 +1,321 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/bn256"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// precompiledContract is a contract implemented natively rather than in
+// bytecode.
+type precompiledContract interface {
+	requiredGas(input []byte) uint64
+	run(input []byte) ([]byte, error)
+}
+
+// precompiledContracts are the precompiled contracts of the Byzantium fork.
+var precompiledContracts = map[common.Address]precompiledContract{
+	common.BytesToAddress([]byte{1}): ecrecover{},
+	common.BytesToAddress([]byte{2}): sha256hash{},
+	common.BytesToAddress([]byte{3}): ripemd160hash{},
+	common.BytesToAddress([]byte{4}): dataCopy{},
+	common.BytesToAddress([]byte{5}): bigModExp{},
+	common.BytesToAddress([]byte{6}): bn256Add{},
+	common.BytesToAddress([]byte{7}): bn256ScalarMul{},
+	common.BytesToAddress([]byte{8}): bn256Pairing{},
+}
+
+// isSystemContract reports whether addr is in the range of the precompiled
+// system contracts of FISCO BCOS, which aren't emulated.
+func isSystemContract(addr common.Address) bool {
+	for _, b := range addr[:common.AddressLength-2] {
+		if b != 0 {
+			return false
+		}
+	}
+	return addr[common.AddressLength-2] == 0x10
+}
+
+// runPrecompiled runs p, returning the gas left.
+func runPrecompiled(p precompiledContract, input []byte, gas uint64) ([]byte, uint64, error) {
+	cost := p.requiredGas(input)
+	if gas < cost {
+		return nil, 0, ErrOutOfGas
+	}
+	ret, err := p.run(input)
+	return ret, gas - cost, err
+}
+
+var errBadPoint = errors.New("invalid bn256 point")
+
+type ecrecover struct{}
+
+func (ecrecover) requiredGas(input []byte) uint64 { return 3000 }
+
+func (ecrecover) run(input []byte) ([]byte, error) {
+	input = common.RightPadBytes(input, 128)
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	v := input[63] - 27
+	// Invalid signatures yield an empty result rather than an error.
+	if !allZero(input[32:63]) || !crypto.ValidateSignatureValues(v, r, s, false) {
+		return nil, nil
+	}
+	sig := make([]byte, 65)
+	copy(sig, input[64:128])
+	sig[64] = v
+	pub, err := crypto.Ecrecover(input[:32], sig)
+	if err != nil {
+		return nil, nil
+	}
+	return common.LeftPadBytes(crypto.Keccak256(pub[1:])[12:], 32), nil
+}
+
+type sha256hash struct{}
+
+func (sha256hash) requiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*12 + 60
+}
+
+func (sha256hash) run(input []byte) ([]byte, error) {
+	h := sha256.Sum256(input)
+	return h[:], nil
+}
+
+type ripemd160hash struct{}
+
+func (ripemd160hash) requiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*120 + 600
+}
+
+func (ripemd160hash) run(input []byte) ([]byte, error) {
+	h := ripemd160.New()
+	h.Write(input)
+	return common.LeftPadBytes(h.Sum(nil), 32), nil
+}
+
+type dataCopy struct{}
+
+func (dataCopy) requiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*3 + 15
+}
+
+func (dataCopy) run(input []byte) ([]byte, error) {
+	return common.CopyBytes(input), nil
+}
+
+// bigModExp implements EIP-198.
+type bigModExp struct{}
+
+var (
+	big1      = big.NewInt(1)
+	big4      = big.NewInt(4)
+	big8      = big.NewInt(8)
+	big16     = big.NewInt(16)
+	big32     = big.NewInt(32)
+	big64     = big.NewInt(64)
+	big96     = big.NewInt(96)
+	big480    = big.NewInt(480)
+	big1024   = big.NewInt(1024)
+	big3072   = big.NewInt(3072)
+	big199680 = big.NewInt(199680)
+)
+
+// getData returns size bytes of data from start, padded with zeros.
+func getData(data []byte, start, size uint64) []byte {
+	length := uint64(len(data))
+	if start > length {
+		start = length
+	}
+	end := start + size
+	if end > length || end < start {
+		end = length
+	}
+	return common.RightPadBytes(data[start:end], int(size))
+}
+
+func (bigModExp) requiredGas(input []byte) uint64 {
+	var (
+		baseLen = new(big.Int).SetBytes(getData(input, 0, 32))
+		expLen  = new(big.Int).SetBytes(getData(input, 32, 32))
+		modLen  = new(big.Int).SetBytes(getData(input, 64, 32))
+	)
+	if len(input) > 96 {
+		input = input[96:]
+	} else {
+		input = input[:0]
+	}
+	// The leading 32 bytes of the exponent determine its adjusted length.
+	var expHead *big.Int
+	if big.NewInt(int64(len(input))).Cmp(baseLen) <= 0 {
+		expHead = new(big.Int)
+	} else if expLen.Cmp(big32) > 0 {
+		expHead = new(big.Int).SetBytes(getData(input, baseLen.Uint64(), 32))
+	} else {
+		expHead = new(big.Int).SetBytes(getData(input, baseLen.Uint64(), expLen.Uint64()))
+	}
+	var msb int
+	if bitlen := expHead.BitLen(); bitlen > 0 {
+		msb = bitlen - 1
+	}
+	adjExpLen := new(big.Int)
+	if expLen.Cmp(big32) > 0 {
+		adjExpLen.Sub(expLen, big32)
+		adjExpLen.Mul(big8, adjExpLen)
+	}
+	adjExpLen.Add(adjExpLen, big.NewInt(int64(msb)))
+
+	gas := new(big.Int).Set(math.BigMax(modLen, baseLen))
+	switch {
+	case gas.Cmp(big64) <= 0:
+		gas.Mul(gas, gas)
+	case gas.Cmp(big1024) <= 0:
+		gas = new(big.Int).Add(
+			new(big.Int).Div(new(big.Int).Mul(gas, gas), big4),
+			new(big.Int).Sub(new(big.Int).Mul(big96, gas), big3072),
+		)
+	default:
+		gas = new(big.Int).Add(
+			new(big.Int).Div(new(big.Int).Mul(gas, gas), big16),
+			new(big.Int).Sub(new(big.Int).Mul(big480, gas), big199680),
+		)
+	}
+	gas.Mul(gas, math.BigMax(adjExpLen, big1))
+	gas.Div(gas, big.NewInt(20))
+	if !gas.IsUint64() {
+		return ^uint64(0)
+	}
+	return gas.Uint64()
+}
+
+func (bigModExp) run(input []byte) ([]byte, error) {
+	var (
+		baseLen = new(big.Int).SetBytes(getData(input, 0, 32)).Uint64()
+		expLen  = new(big.Int).SetBytes(getData(input, 32, 32)).Uint64()
+		modLen  = new(big.Int).SetBytes(getData(input, 64, 32)).Uint64()
+	)
+	if len(input) > 96 {
+		input = input[96:]
+	} else {
+		input = input[:0]
+	}
+	if baseLen == 0 && modLen == 0 {
+		return []byte{}, nil
+	}
+	var (
+		base = new(big.Int).SetBytes(getData(input, 0, baseLen))
+		exp  = new(big.Int).SetBytes(getData(input, baseLen, expLen))
+		mod  = new(big.Int).SetBytes(getData(input, baseLen+expLen, modLen))
+	)
+	if mod.BitLen() == 0 {
+		return common.LeftPadBytes([]byte{}, int(modLen)), nil
+	}
+	return common.LeftPadBytes(base.Exp(base, exp, mod).Bytes(), int(modLen)), nil
+}
+
+func newCurvePoint(blob []byte) (*bn256.G1, error) {
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, errBadPoint
+	}
+	return p, nil
+}
+
+func newTwistPoint(blob []byte) (*bn256.G2, error) {
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(blob); err != nil {
+		return nil, errBadPoint
+	}
+	return p, nil
+}
+
+type bn256Add struct{}
+
+func (bn256Add) requiredGas(input []byte) uint64 { return 500 }
+
+func (bn256Add) run(input []byte) ([]byte, error) {
+	x, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	y, err := newCurvePoint(getData(input, 64, 64))
+	if err != nil {
+		return nil, err
+	}
+	return new(bn256.G1).Add(x, y).Marshal(), nil
+}
+
+type bn256ScalarMul struct{}
+
+func (bn256ScalarMul) requiredGas(input []byte) uint64 { return 40000 }
+
+func (bn256ScalarMul) run(input []byte) ([]byte, error) {
+	p, err := newCurvePoint(getData(input, 0, 64))
+	if err != nil {
+		return nil, err
+	}
+	return new(bn256.G1).ScalarMult(p, new(big.Int).SetBytes(getData(input, 64, 32))).Marshal(), nil
+}
+
+type bn256Pairing struct{}
+
+func (bn256Pairing) requiredGas(input []byte) uint64 {
+	return 100000 + uint64(len(input)/192)*80000
+}
+
+func (bn256Pairing) run(input []byte) ([]byte, error) {
+	if len(input)%192 != 0 {
+		return nil, errBadPoint
+	}
+	var (
+		cs []*bn256.G1
+		ts []*bn256.G2
+	)
+	for i := 0; i < len(input); i += 192 {
+		c, err := newCurvePoint(input[i : i+64])
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTwistPoint(input[i+64 : i+192])
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+		ts = append(ts, t)
+	}
+	if bn256.PairingCheck(cs, ts) {
+		return common.LeftPadBytes([]byte{1}, 32), nil
+	}
+	return make([]byte, 32), nil
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
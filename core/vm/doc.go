@@ -0,0 +1,24 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package vm implements the FISCO BCOS virtual machine, an interpreter of EVM
+// bytecode at the Constantinople level.
+//
+// It executes contract code against a StateDB, which is all the simulated backend
+// of the bindings needs. The precompiled system contracts of FISCO BCOS, such as
+// the table and permission services at 0x1000 and up, are not emulated; calls to
+// them fail with ErrSystemContract.
+package vm
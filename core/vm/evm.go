@@ -0,0 +1,220 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// Context is the block and transaction environment contracts are executed in.
+type Context struct {
+	Origin      common.Address // sender of the transaction
+	GasPrice    *big.Int
+	Coinbase    common.Address
+	GasLimit    uint64
+	BlockNumber *big.Int
+	Time        *big.Int // block timestamp in milliseconds, as on FISCO BCOS
+
+	// GetHash returns the hash of the block with the given number, which is at
+	// most 256 blocks before the current one.
+	GetHash func(uint64) common.Hash
+}
+
+// EVM executes contracts against a state. It isn't safe for concurrent use and
+// is meant to run a single transaction or call.
+type EVM struct {
+	Context
+	StateDB StateDB
+
+	depth    int
+	readOnly bool // set while running a static call
+}
+
+// NewEVM returns an EVM executing in ctx on statedb.
+func NewEVM(ctx Context, statedb StateDB) *EVM {
+	if ctx.GasPrice == nil {
+		ctx.GasPrice = new(big.Int)
+	}
+	if ctx.BlockNumber == nil {
+		ctx.BlockNumber = new(big.Int)
+	}
+	if ctx.Time == nil {
+		ctx.Time = new(big.Int)
+	}
+	if ctx.GetHash == nil {
+		ctx.GetHash = func(uint64) common.Hash { return common.Hash{} }
+	}
+	return &EVM{Context: ctx, StateDB: statedb}
+}
+
+// canTransfer reports whether addr holds at least amount.
+func (evm *EVM) canTransfer(addr common.Address, amount *big.Int) bool {
+	return amount.Sign() == 0 || evm.StateDB.GetBalance(addr).Cmp(amount) >= 0
+}
+
+func (evm *EVM) transfer(from, to common.Address, amount *big.Int) {
+	if amount.Sign() != 0 {
+		evm.StateDB.SubBalance(from, amount)
+		evm.StateDB.AddBalance(to, amount)
+	}
+}
+
+// Call executes the contract at addr with input, transferring value from caller.
+// It returns the output, the gas left and the error that ended the execution, if
+// any. State changes are undone on errors.
+func (evm *EVM) Call(caller, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if evm.depth > callDepthLimit {
+		return nil, gas, ErrDepth
+	}
+	if !evm.canTransfer(caller, value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	if isSystemContract(addr) {
+		return nil, gas, ErrSystemContract
+	}
+	snapshot := evm.StateDB.Snapshot()
+	p, isPrecompile := precompiledContracts[addr]
+	if !evm.StateDB.Exist(addr) {
+		if !isPrecompile && value.Sign() == 0 {
+			// Calling a missing account does nothing and doesn't create it.
+			return nil, gas, nil
+		}
+		evm.StateDB.CreateAccount(addr)
+	}
+	evm.transfer(caller, addr, value)
+	return evm.execute(snapshot, p, newContract(caller, addr, value, evm.StateDB.GetCode(addr), input, gas))
+}
+
+// CallCode executes the code at addr in the context of caller, like the
+// deprecated CALLCODE instruction.
+func (evm *EVM) CallCode(caller, addr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	if evm.depth > callDepthLimit {
+		return nil, gas, ErrDepth
+	}
+	if !evm.canTransfer(caller, value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	if isSystemContract(addr) {
+		return nil, gas, ErrSystemContract
+	}
+	snapshot := evm.StateDB.Snapshot()
+	return evm.execute(snapshot, precompiledContracts[addr], newContract(caller, caller, value, evm.StateDB.GetCode(addr), input, gas))
+}
+
+// DelegateCall executes the code at addr in the context of parent, keeping its
+// caller and value.
+func (evm *EVM) DelegateCall(parent *Contract, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if evm.depth > callDepthLimit {
+		return nil, gas, ErrDepth
+	}
+	if isSystemContract(addr) {
+		return nil, gas, ErrSystemContract
+	}
+	snapshot := evm.StateDB.Snapshot()
+	return evm.execute(snapshot, precompiledContracts[addr], newContract(parent.Caller, parent.Address, parent.Value, evm.StateDB.GetCode(addr), input, gas))
+}
+
+// StaticCall executes the contract at addr, failing any state modification.
+func (evm *EVM) StaticCall(caller, addr common.Address, input []byte, gas uint64) (ret []byte, leftOverGas uint64, err error) {
+	if evm.depth > callDepthLimit {
+		return nil, gas, ErrDepth
+	}
+	if isSystemContract(addr) {
+		return nil, gas, ErrSystemContract
+	}
+	if !evm.readOnly {
+		evm.readOnly = true
+		defer func() { evm.readOnly = false }()
+	}
+	snapshot := evm.StateDB.Snapshot()
+	return evm.execute(snapshot, precompiledContracts[addr], newContract(caller, addr, new(big.Int), evm.StateDB.GetCode(addr), input, gas))
+}
+
+// execute runs the precompiled contract p, if not nil, or the code of contract,
+// reverting to snapshot on errors.
+func (evm *EVM) execute(snapshot int, p precompiledContract, contract *Contract) (ret []byte, leftOverGas uint64, err error) {
+	if p != nil {
+		ret, contract.Gas, err = runPrecompiled(p, contract.Input, contract.Gas)
+	} else if len(contract.Code) > 0 {
+		ret, err = evm.run(contract)
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			contract.Gas = 0
+		}
+	}
+	return ret, contract.Gas, err
+}
+
+// Create deploys a contract running code, at the address derived from caller and
+// its nonce, as the CREATE instruction and deployment transactions do.
+func (evm *EVM) Create(caller common.Address, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	contractAddr = crypto.CreateAddress(caller, evm.StateDB.GetNonce(caller))
+	return evm.create(caller, code, gas, value, contractAddr)
+}
+
+// Create2 deploys a contract running code at the address derived from caller,
+// salt and the hash of code, as the CREATE2 instruction does.
+func (evm *EVM) Create2(caller common.Address, code []byte, gas uint64, value *big.Int, salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	contractAddr = crypto.CreateAddress2(caller, common.BigToHash(salt), crypto.Keccak256(code))
+	return evm.create(caller, code, gas, value, contractAddr)
+}
+
+func (evm *EVM) create(caller common.Address, code []byte, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
+	if evm.depth > callDepthLimit {
+		return nil, common.Address{}, gas, ErrDepth
+	}
+	if !evm.canTransfer(caller, value) {
+		return nil, common.Address{}, gas, ErrInsufficientBalance
+	}
+	evm.StateDB.SetNonce(caller, evm.StateDB.GetNonce(caller)+1)
+
+	codeHash := evm.StateDB.GetCodeHash(address)
+	if evm.StateDB.GetNonce(address) != 0 || (codeHash != (common.Hash{}) && codeHash != emptyCodeHash) {
+		return nil, common.Address{}, 0, ErrContractAddressCollision
+	}
+	snapshot := evm.StateDB.Snapshot()
+	evm.StateDB.CreateAccount(address)
+	evm.StateDB.SetNonce(address, 1)
+	evm.transfer(caller, address, value)
+
+	contract := newContract(caller, address, value, code, nil, gas)
+	ret, err := evm.run(contract)
+	if err == nil && len(ret) > MaxCodeSize {
+		err = ErrMaxCodeSizeExceeded
+	}
+	if err == nil {
+		if contract.useGas(uint64(len(ret)) * createDataGas) {
+			evm.StateDB.SetCode(address, ret)
+		} else {
+			err = ErrCodeStoreOutOfGas
+		}
+	}
+	if err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			contract.Gas = 0
+		}
+	}
+	return ret, address, contract.Gas, err
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "math/big"
+
+// Gas costs of the Constantinople schedule beyond the constant costs of the
+// operations.
+const (
+	TxGas                 uint64 = 21000 // intrinsic gas of calls
+	TxGasContractCreation uint64 = 53000 // intrinsic gas of deployments
+	TxDataZeroGas         uint64 = 4     // per zero byte of transaction data
+	TxDataNonZeroGas      uint64 = 68    // per non-zero byte of transaction data
+
+	MaxCodeSize = 0x40000 // FISCO BCOS raised the EIP-170 limit to 256 KiB
+
+	callDepthLimit = 1024
+
+	memoryGas         uint64 = 3
+	quadCoeffDiv      uint64 = 512
+	copyGas           uint64 = 3
+	sha3WordGas       uint64 = 6
+	expByteGas        uint64 = 50
+	logDataGas        uint64 = 8
+	createDataGas     uint64 = 200
+	callValueTransfer uint64 = 9000
+	callNewAccount    uint64 = 25000
+	callStipend       uint64 = 2300
+	sstoreSetGas      uint64 = 20000
+	sstoreResetGas    uint64 = 5000
+	sstoreRefundGas   uint64 = 15000
+	suicideRefundGas  uint64 = 24000
+)
+
+// IntrinsicGas returns the gas charged for a transaction before executing it.
+func IntrinsicGas(data []byte, contractCreation bool) uint64 {
+	gas := TxGas
+	if contractCreation {
+		gas = TxGasContractCreation
+	}
+	var nz uint64
+	for _, b := range data {
+		if b != 0 {
+			nz++
+		}
+	}
+	z := uint64(len(data)) - nz
+	return gas + nz*TxDataNonZeroGas + z*TxDataZeroGas
+}
+
+// toWords rounds size up to words of 32 bytes.
+func toWords(size uint64) uint64 {
+	if size > ^uint64(0)-31 {
+		return ^uint64(0)/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// memoryCost returns the total cost of words of memory.
+func memoryCost(words uint64) uint64 {
+	return words*memoryGas + words*words/quadCoeffDiv
+}
+
+// wordGas returns perWord gas for every word of size bytes, failing on overflow.
+func wordGas(size, perWord uint64) (uint64, error) {
+	words := toWords(size)
+	if perWord != 0 && words > ^uint64(0)/perWord {
+		return 0, ErrGasUintOverflow
+	}
+	return words * perWord, nil
+}
+
+// callGas returns the gas passed to a call: the requested amount, capped to all
+// but one 64th of the gas available (EIP-150).
+func callGas(available uint64, requested *big.Int) uint64 {
+	max := available - available/64
+	if !requested.IsUint64() || requested.Uint64() > max {
+		return max
+	}
+	return requested.Uint64()
+}
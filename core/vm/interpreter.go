@@ -0,0 +1,590 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+)
+
+var tt256 = math.BigPow(2, 256)
+
+// maxMemoryWords bounds memory so that its cost can't overflow.
+const maxMemoryWords = 0x1FFFFFFFE0
+
+// frame is the state of a running contract.
+type frame struct {
+	evm        *EVM
+	contract   *Contract
+	mem        *memory
+	stack      *stack
+	returnData []byte // output of the last call made by the contract
+}
+
+// run executes the code of contract until it stops, returning its output.
+func (evm *EVM) run(contract *Contract) ([]byte, error) {
+	evm.depth++
+	defer func() { evm.depth-- }()
+
+	f := &frame{evm: evm, contract: contract, mem: new(memory), stack: newStack()}
+	for pc := uint64(0); ; pc++ {
+		op := contract.opAt(pc)
+		info := &operations[op]
+		if !info.valid {
+			return nil, &ErrInvalidOpCode{Op: op}
+		}
+		if f.stack.len() < info.pops {
+			return nil, ErrStackUnderflow
+		}
+		if f.stack.len()-info.pops+info.pushes > stackLimit {
+			return nil, ErrStackOverflow
+		}
+		if evm.readOnly && (info.writes || op == CALL && f.stack.peek(2).Sign() != 0) {
+			return nil, ErrWriteProtection
+		}
+		if !contract.useGas(info.gas) {
+			return nil, ErrOutOfGas
+		}
+		ret, next, done, err := f.step(op, pc)
+		if err != nil || done {
+			return ret, err
+		}
+		pc = next
+	}
+}
+
+// step executes op at pc, returning the pc of the last byte it consumed and
+// whether the execution is over.
+func (f *frame) step(op OpCode, pc uint64) (ret []byte, next uint64, done bool, err error) {
+	var (
+		evm = f.evm
+		c   = f.contract
+		st  = f.stack
+	)
+	switch {
+	case op.IsPush():
+		n := uint64(op - PUSH1 + 1)
+		st.push(new(big.Int).SetBytes(getData(c.Code, pc+1, n)))
+		return nil, pc + n, false, nil
+	case op >= DUP1 && op <= DUP16:
+		st.dup(int(op - DUP1 + 1))
+		return nil, pc, false, nil
+	case op >= SWAP1 && op <= SWAP16:
+		st.swap(int(op - SWAP1 + 1))
+		return nil, pc, false, nil
+	case op >= LOG0 && op <= LOG4:
+		offset, size := st.pop(), st.pop()
+		topics := make([]common.Hash, op-LOG0)
+		for i := range topics {
+			topics[i] = common.BigToHash(st.pop())
+		}
+		if err := f.useMemory(logDataGas, offset, size); err != nil {
+			return nil, 0, false, err
+		}
+		evm.StateDB.AddLog(&types.Log{
+			Address:     c.Address,
+			Topics:      topics,
+			Data:        f.mem.get(offset.Uint64(), size.Uint64()),
+			BlockNumber: evm.BlockNumber.Uint64(),
+		})
+		return nil, pc, false, nil
+	}
+
+	switch op {
+	case STOP:
+		return nil, pc, true, nil
+
+	case ADD:
+		x, y := st.pop(), st.pop()
+		st.push(math.U256(new(big.Int).Add(x, y)))
+	case MUL:
+		x, y := st.pop(), st.pop()
+		st.push(math.U256(new(big.Int).Mul(x, y)))
+	case SUB:
+		x, y := st.pop(), st.pop()
+		st.push(math.U256(new(big.Int).Sub(x, y)))
+	case DIV:
+		x, y := st.pop(), st.pop()
+		if y.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(new(big.Int).Div(x, y))
+		}
+	case SDIV:
+		x, y := math.S256(st.pop()), math.S256(st.pop())
+		if y.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(math.U256(new(big.Int).Quo(x, y)))
+		}
+	case MOD:
+		x, y := st.pop(), st.pop()
+		if y.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(new(big.Int).Mod(x, y))
+		}
+	case SMOD:
+		x, y := math.S256(st.pop()), math.S256(st.pop())
+		if y.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(math.U256(new(big.Int).Rem(x, y)))
+		}
+	case ADDMOD:
+		x, y, z := st.pop(), st.pop(), st.pop()
+		if z.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			sum := new(big.Int).Add(x, y)
+			st.push(sum.Mod(sum, z))
+		}
+	case MULMOD:
+		x, y, z := st.pop(), st.pop(), st.pop()
+		if z.Sign() == 0 {
+			st.push(new(big.Int))
+		} else {
+			prod := new(big.Int).Mul(x, y)
+			st.push(prod.Mod(prod, z))
+		}
+	case EXP:
+		base, exponent := st.pop(), st.pop()
+		if !c.useGas(uint64((exponent.BitLen()+7)/8) * expByteGas) {
+			return nil, 0, false, ErrOutOfGas
+		}
+		st.push(new(big.Int).Exp(base, exponent, tt256))
+	case SIGNEXTEND:
+		back, num := st.pop(), st.pop()
+		if back.Cmp(big.NewInt(31)) < 0 {
+			bit := uint(back.Uint64()*8 + 7)
+			mask := new(big.Int).Lsh(big1, bit)
+			mask.Sub(mask, big1)
+			if num.Bit(int(bit)) > 0 {
+				st.push(math.U256(new(big.Int).Or(num, new(big.Int).Not(mask))))
+			} else {
+				st.push(new(big.Int).And(num, mask))
+			}
+		} else {
+			st.push(num)
+		}
+
+	case LT:
+		x, y := st.pop(), st.pop()
+		st.push(boolToBig(x.Cmp(y) < 0))
+	case GT:
+		x, y := st.pop(), st.pop()
+		st.push(boolToBig(x.Cmp(y) > 0))
+	case SLT:
+		x, y := math.S256(st.pop()), math.S256(st.pop())
+		st.push(boolToBig(x.Cmp(y) < 0))
+	case SGT:
+		x, y := math.S256(st.pop()), math.S256(st.pop())
+		st.push(boolToBig(x.Cmp(y) > 0))
+	case EQ:
+		x, y := st.pop(), st.pop()
+		st.push(boolToBig(x.Cmp(y) == 0))
+	case ISZERO:
+		st.push(boolToBig(st.pop().Sign() == 0))
+	case AND:
+		x, y := st.pop(), st.pop()
+		st.push(new(big.Int).And(x, y))
+	case OR:
+		x, y := st.pop(), st.pop()
+		st.push(new(big.Int).Or(x, y))
+	case XOR:
+		x, y := st.pop(), st.pop()
+		st.push(new(big.Int).Xor(x, y))
+	case NOT:
+		st.push(math.U256(new(big.Int).Not(st.pop())))
+	case BYTE:
+		th, val := st.pop(), st.pop()
+		if th.Cmp(big32) < 0 {
+			st.push(big.NewInt(int64(math.Byte(val, 32, int(th.Int64())))))
+		} else {
+			st.push(new(big.Int))
+		}
+	case SHL:
+		shift, value := st.pop(), st.pop()
+		if shift.Cmp(big.NewInt(256)) >= 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(math.U256(new(big.Int).Lsh(value, uint(shift.Uint64()))))
+		}
+	case SHR:
+		shift, value := st.pop(), st.pop()
+		if shift.Cmp(big.NewInt(256)) >= 0 {
+			st.push(new(big.Int))
+		} else {
+			st.push(new(big.Int).Rsh(value, uint(shift.Uint64())))
+		}
+	case SAR:
+		shift := st.pop()
+		value := math.S256(st.pop())
+		if shift.Cmp(big.NewInt(256)) >= 0 {
+			if value.Sign() < 0 {
+				st.push(math.U256(big.NewInt(-1)))
+			} else {
+				st.push(new(big.Int))
+			}
+		} else {
+			st.push(math.U256(new(big.Int).Rsh(value, uint(shift.Uint64()))))
+		}
+
+	case SHA3:
+		offset, size := st.pop(), st.pop()
+		if err := f.useMemory(sha3WordGas, offset, size); err != nil {
+			return nil, 0, false, err
+		}
+		st.push(new(big.Int).SetBytes(crypto.Keccak256(f.mem.get(offset.Uint64(), size.Uint64()))))
+
+	case ADDRESS:
+		st.push(addressToBig(c.Address))
+	case BALANCE:
+		st.push(new(big.Int).Set(evm.StateDB.GetBalance(common.BigToAddress(st.pop()))))
+	case ORIGIN:
+		st.push(addressToBig(evm.Origin))
+	case CALLER:
+		st.push(addressToBig(c.Caller))
+	case CALLVALUE:
+		st.push(new(big.Int).Set(c.Value))
+	case CALLDATALOAD:
+		offset := st.pop()
+		if !offset.IsUint64() {
+			st.push(new(big.Int))
+		} else {
+			st.push(new(big.Int).SetBytes(getData(c.Input, offset.Uint64(), 32)))
+		}
+	case CALLDATASIZE:
+		st.push(big.NewInt(int64(len(c.Input))))
+	case CALLDATACOPY:
+		if err := f.copyToMemory(c.Input); err != nil {
+			return nil, 0, false, err
+		}
+	case CODESIZE:
+		st.push(big.NewInt(int64(len(c.Code))))
+	case CODECOPY:
+		if err := f.copyToMemory(c.Code); err != nil {
+			return nil, 0, false, err
+		}
+	case GASPRICE:
+		st.push(new(big.Int).Set(evm.GasPrice))
+	case EXTCODESIZE:
+		st.push(big.NewInt(int64(evm.StateDB.GetCodeSize(common.BigToAddress(st.pop())))))
+	case EXTCODECOPY:
+		code := evm.StateDB.GetCode(common.BigToAddress(st.pop()))
+		if err := f.copyToMemory(code); err != nil {
+			return nil, 0, false, err
+		}
+	case RETURNDATASIZE:
+		st.push(big.NewInt(int64(len(f.returnData))))
+	case RETURNDATACOPY:
+		dataOffset, size := st.peek(1), st.peek(2)
+		end := new(big.Int).Add(dataOffset, size)
+		if !end.IsUint64() || end.Uint64() > uint64(len(f.returnData)) {
+			return nil, 0, false, ErrReturnDataOutOfBounds
+		}
+		if err := f.copyToMemory(f.returnData); err != nil {
+			return nil, 0, false, err
+		}
+	case EXTCODEHASH:
+		addr := common.BigToAddress(st.pop())
+		if evm.StateDB.Empty(addr) {
+			st.push(new(big.Int))
+		} else {
+			st.push(evm.StateDB.GetCodeHash(addr).Big())
+		}
+
+	case BLOCKHASH:
+		num := st.pop()
+		current := evm.BlockNumber
+		lower := new(big.Int).Sub(current, big.NewInt(256))
+		if num.Cmp(current) < 0 && num.Cmp(lower) >= 0 {
+			st.push(evm.GetHash(num.Uint64()).Big())
+		} else {
+			st.push(new(big.Int))
+		}
+	case COINBASE:
+		st.push(addressToBig(evm.Coinbase))
+	case TIMESTAMP:
+		st.push(new(big.Int).Set(evm.Time))
+	case NUMBER:
+		st.push(new(big.Int).Set(evm.BlockNumber))
+	case DIFFICULTY:
+		st.push(new(big.Int))
+	case GASLIMIT:
+		st.push(new(big.Int).SetUint64(evm.GasLimit))
+
+	case POP:
+		st.pop()
+	case MLOAD:
+		offset := st.pop()
+		if err := f.useMemory(0, offset, big32); err != nil {
+			return nil, 0, false, err
+		}
+		st.push(new(big.Int).SetBytes(f.mem.get(offset.Uint64(), 32)))
+	case MSTORE:
+		offset, val := st.pop(), st.pop()
+		if err := f.useMemory(0, offset, big32); err != nil {
+			return nil, 0, false, err
+		}
+		f.mem.set(offset.Uint64(), 32, math.PaddedBigBytes(val, 32))
+	case MSTORE8:
+		offset, val := st.pop(), st.pop()
+		if err := f.useMemory(0, offset, big1); err != nil {
+			return nil, 0, false, err
+		}
+		f.mem.set(offset.Uint64(), 1, []byte{byte(val.Uint64())})
+	case SLOAD:
+		key := common.BigToHash(st.pop())
+		st.push(evm.StateDB.GetState(c.Address, key).Big())
+	case SSTORE:
+		key, val := common.BigToHash(st.pop()), common.BigToHash(st.pop())
+		current := evm.StateDB.GetState(c.Address, key)
+		gas := sstoreResetGas
+		switch {
+		case current == (common.Hash{}) && val != (common.Hash{}):
+			gas = sstoreSetGas
+		case current != (common.Hash{}) && val == (common.Hash{}):
+			evm.StateDB.AddRefund(sstoreRefundGas)
+		}
+		if !c.useGas(gas) {
+			return nil, 0, false, ErrOutOfGas
+		}
+		evm.StateDB.SetState(c.Address, key, val)
+	case JUMP:
+		dest := st.pop()
+		if !c.validJump(dest) {
+			return nil, 0, false, ErrInvalidJump
+		}
+		// The loop moves past the instruction, so land just before it.
+		return nil, dest.Uint64() - 1, false, nil
+	case JUMPI:
+		dest, cond := st.pop(), st.pop()
+		if cond.Sign() != 0 {
+			if !c.validJump(dest) {
+				return nil, 0, false, ErrInvalidJump
+			}
+			return nil, dest.Uint64() - 1, false, nil
+		}
+	case PC:
+		st.push(new(big.Int).SetUint64(pc))
+	case MSIZE:
+		st.push(new(big.Int).SetUint64(f.mem.len()))
+	case GAS:
+		st.push(new(big.Int).SetUint64(c.Gas))
+	case JUMPDEST:
+
+	case CREATE, CREATE2:
+		value, offset, size := st.pop(), st.pop(), st.pop()
+		var salt *big.Int
+		hashGas := uint64(0)
+		if op == CREATE2 {
+			salt, hashGas = st.pop(), sha3WordGas
+		}
+		if err := f.useMemory(hashGas, offset, size); err != nil {
+			return nil, 0, false, err
+		}
+		code := f.mem.get(offset.Uint64(), size.Uint64())
+		gas := c.Gas - c.Gas/64
+		c.useGas(gas)
+
+		var (
+			res  []byte
+			addr common.Address
+			left uint64
+		)
+		if op == CREATE {
+			res, addr, left, err = evm.Create(c.Address, code, gas, value)
+		} else {
+			res, addr, left, err = evm.Create2(c.Address, code, gas, value, salt)
+		}
+		if err != nil {
+			st.push(new(big.Int))
+		} else {
+			st.push(addressToBig(addr))
+		}
+		c.Gas += left
+		if err == ErrExecutionReverted {
+			f.returnData = res
+		} else {
+			f.returnData = nil
+		}
+		return nil, pc, false, nil
+
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		return f.call(op, pc)
+
+	case RETURN, REVERT:
+		offset, size := st.pop(), st.pop()
+		if err := f.useMemory(0, offset, size); err != nil {
+			return nil, 0, false, err
+		}
+		ret = f.mem.get(offset.Uint64(), size.Uint64())
+		if op == REVERT {
+			return ret, pc, true, ErrExecutionReverted
+		}
+		return ret, pc, true, nil
+
+	case SELFDESTRUCT:
+		beneficiary := common.BigToAddress(st.pop())
+		balance := evm.StateDB.GetBalance(c.Address)
+		if balance.Sign() > 0 && evm.StateDB.Empty(beneficiary) && !c.useGas(callNewAccount) {
+			return nil, 0, false, ErrOutOfGas
+		}
+		if !evm.StateDB.HasSuicided(c.Address) {
+			evm.StateDB.AddRefund(suicideRefundGas)
+		}
+		evm.StateDB.AddBalance(beneficiary, balance)
+		evm.StateDB.Suicide(c.Address)
+		return nil, pc, true, nil
+	}
+	return nil, pc, false, nil
+}
+
+// call executes one of the call instructions.
+func (f *frame) call(op OpCode, pc uint64) ([]byte, uint64, bool, error) {
+	var (
+		evm   = f.evm
+		c     = f.contract
+		st    = f.stack
+		value = new(big.Int)
+	)
+	requested, addr := st.pop(), common.BigToAddress(st.pop())
+	if op == CALL || op == CALLCODE {
+		value = st.pop()
+	}
+	inOffset, inSize, retOffset, retSize := st.pop(), st.pop(), st.pop(), st.pop()
+
+	if err := f.useMemory(0, inOffset, inSize); err != nil {
+		return nil, 0, false, err
+	}
+	if err := f.useMemory(0, retOffset, retSize); err != nil {
+		return nil, 0, false, err
+	}
+	var extra uint64
+	if value.Sign() != 0 {
+		extra += callValueTransfer
+		if op == CALL && evm.StateDB.Empty(addr) {
+			extra += callNewAccount
+		}
+	}
+	if !c.useGas(extra) {
+		return nil, 0, false, ErrOutOfGas
+	}
+	gas := callGas(c.Gas, requested)
+	c.useGas(gas)
+	if value.Sign() != 0 {
+		gas += callStipend
+	}
+
+	input := f.mem.get(inOffset.Uint64(), inSize.Uint64())
+	var (
+		ret  []byte
+		left uint64
+		err  error
+	)
+	switch op {
+	case CALL:
+		ret, left, err = evm.Call(c.Address, addr, input, gas, value)
+	case CALLCODE:
+		ret, left, err = evm.CallCode(c.Address, addr, input, gas, value)
+	case DELEGATECALL:
+		ret, left, err = evm.DelegateCall(c, addr, input, gas)
+	case STATICCALL:
+		ret, left, err = evm.StaticCall(c.Address, addr, input, gas)
+	}
+	if err != nil {
+		st.push(new(big.Int))
+	} else {
+		st.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		size := retSize.Uint64()
+		if uint64(len(ret)) < size {
+			size = uint64(len(ret))
+		}
+		f.mem.set(retOffset.Uint64(), size, ret)
+	}
+	c.Gas += left
+	f.returnData = ret
+	return nil, pc, false, nil
+}
+
+// copyToMemory pops a memory offset, a data offset and a size and copies the
+// data to memory, padded with zeros, as the *COPY instructions do.
+func (f *frame) copyToMemory(data []byte) error {
+	memOffset, dataOffset, size := f.stack.pop(), f.stack.pop(), f.stack.pop()
+	if err := f.useMemory(copyGas, memOffset, size); err != nil {
+		return err
+	}
+	if size.Sign() == 0 {
+		return nil
+	}
+	start := uint64(len(data))
+	if dataOffset.IsUint64() && dataOffset.Uint64() < start {
+		start = dataOffset.Uint64()
+	}
+	f.mem.set(memOffset.Uint64(), size.Uint64(), getData(data, start, size.Uint64()))
+	return nil
+}
+
+// useMemory charges the gas for accessing size bytes of memory at offset, plus
+// perWord gas for every word accessed, and grows the memory to hold them.
+// Offset and size are only guaranteed to fit in uint64 on success.
+func (f *frame) useMemory(perWord uint64, offset, size *big.Int) error {
+	if size.Sign() == 0 {
+		return nil
+	}
+	if !offset.IsUint64() || !size.IsUint64() {
+		return ErrGasUintOverflow
+	}
+	end := offset.Uint64() + size.Uint64()
+	if end < offset.Uint64() {
+		return ErrGasUintOverflow
+	}
+	words := toWords(end)
+	if words > maxMemoryWords {
+		return ErrGasUintOverflow
+	}
+	gas, err := wordGas(size.Uint64(), perWord)
+	if err != nil {
+		return err
+	}
+	if have := toWords(f.mem.len()); words > have {
+		gas += memoryCost(words) - memoryCost(have)
+	}
+	if !f.contract.useGas(gas) {
+		return ErrOutOfGas
+	}
+	f.mem.resize(words * 32)
+	return nil
+}
+
+func boolToBig(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
+
+func addressToBig(addr common.Address) *big.Int {
+	return new(big.Int).SetBytes(addr.Bytes())
+}
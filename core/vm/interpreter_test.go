@@ -0,0 +1,276 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/core/state"
+	"github.com/chislab/go-fiscobcos/ethdb/memorydb"
+)
+
+var (
+	testCaller = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testTarget = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	testCallee = common.HexToAddress("0x3000000000000000000000000000000000000003")
+
+	minInt256 = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+	maxInt256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+)
+
+// push returns the code pushing v, as a 256 bit two's complement word.
+func push(v *big.Int) []byte {
+	return append([]byte{byte(PUSH32)}, math.PaddedBigBytes(math.U256(new(big.Int).Set(v)), 32)...)
+}
+
+// returnTop is the code returning the word on top of the stack.
+var returnTop = []byte{byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)}
+
+// newTestEVM returns an EVM on an empty state holding the given contracts.
+func newTestEVM(t *testing.T, code map[common.Address][]byte) (*EVM, *state.StateDB) {
+	t.Helper()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, c := range code {
+		statedb.CreateAccount(addr)
+		statedb.SetCode(addr, c)
+	}
+	return NewEVM(Context{GasLimit: 10000000}, statedb), statedb
+}
+
+// run executes code as the contract at testTarget.
+func run(t *testing.T, code []byte) ([]byte, uint64, error) {
+	t.Helper()
+	evm, _ := newTestEVM(t, map[common.Address][]byte{testTarget: code})
+	return evm.Call(testCaller, testTarget, nil, 1000000, new(big.Int))
+}
+
+func TestSignedArithmetic(t *testing.T) {
+	tests := []struct {
+		op         OpCode
+		x, y, want *big.Int // x is the top of the stack
+	}{
+		{SDIV, big.NewInt(-1), big.NewInt(1), big.NewInt(-1)},
+		{SDIV, big.NewInt(-7), big.NewInt(2), big.NewInt(-3)},
+		{SDIV, big.NewInt(7), big.NewInt(-2), big.NewInt(-3)},
+		{SDIV, big.NewInt(7), big.NewInt(0), big.NewInt(0)},
+		{SDIV, minInt256, big.NewInt(-1), minInt256},
+		{SDIV, minInt256, minInt256, big.NewInt(1)},
+		{SDIV, maxInt256, minInt256, big.NewInt(0)},
+		{SMOD, big.NewInt(-7), big.NewInt(2), big.NewInt(-1)},
+		{SMOD, big.NewInt(7), big.NewInt(-2), big.NewInt(1)},
+		{SMOD, big.NewInt(-7), big.NewInt(0), big.NewInt(0)},
+		{SMOD, minInt256, big.NewInt(-1), big.NewInt(0)},
+		{SMOD, minInt256, big.NewInt(3), big.NewInt(-2)},
+		{SIGNEXTEND, big.NewInt(0), big.NewInt(0xff), big.NewInt(-1)},
+		{SIGNEXTEND, big.NewInt(0), big.NewInt(0x7f), big.NewInt(0x7f)},
+		{SIGNEXTEND, big.NewInt(0), big.NewInt(0x1ff), big.NewInt(-1)},
+		{SIGNEXTEND, big.NewInt(1), big.NewInt(0x8000), big.NewInt(-0x8000)},
+		{SIGNEXTEND, big.NewInt(30), minInt256, big.NewInt(0)},
+		{SIGNEXTEND, big.NewInt(31), minInt256, minInt256},
+		{SIGNEXTEND, big.NewInt(32), big.NewInt(0xff), big.NewInt(0xff)},
+		{SIGNEXTEND, big.NewInt(-1), big.NewInt(0x80), big.NewInt(0x80)},
+		{SAR, big.NewInt(0), big.NewInt(-16), big.NewInt(-16)},
+		{SAR, big.NewInt(2), big.NewInt(-16), big.NewInt(-4)},
+		{SAR, big.NewInt(2), big.NewInt(-15), big.NewInt(-4)},
+		{SAR, big.NewInt(255), minInt256, big.NewInt(-1)},
+		{SAR, big.NewInt(256), minInt256, big.NewInt(-1)},
+		{SAR, big.NewInt(256), maxInt256, big.NewInt(0)},
+		{SAR, big.NewInt(254), maxInt256, big.NewInt(1)},
+		{SAR, big.NewInt(-1), big.NewInt(-1), big.NewInt(-1)},
+		{BYTE, big.NewInt(0), minInt256, big.NewInt(0x80)},
+		{BYTE, big.NewInt(31), big.NewInt(0x1234), big.NewInt(0x34)},
+		{BYTE, big.NewInt(30), big.NewInt(0x1234), big.NewInt(0x12)},
+		{BYTE, big.NewInt(32), big.NewInt(-1), big.NewInt(0)},
+		{BYTE, big.NewInt(-1), big.NewInt(-1), big.NewInt(0)},
+	}
+	for _, test := range tests {
+		code := append(append(push(test.y), push(test.x)...), byte(test.op))
+		ret, _, err := run(t, append(code, returnTop...))
+		if err != nil {
+			t.Errorf("%v %v %v: error %v", test.op, test.x, test.y, err)
+			continue
+		}
+		want := math.PaddedBigBytes(math.U256(new(big.Int).Set(test.want)), 32)
+		if !bytes.Equal(ret, want) {
+			t.Errorf("%v %v %v: got %x, want %x", test.op, test.x, test.y, ret, want)
+		}
+	}
+}
+
+func TestJumpDest(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		err  error
+	}{
+		{
+			name: "jumpdest",
+			code: []byte{byte(PUSH1), 4, byte(JUMP), byte(INVALID), byte(JUMPDEST), byte(STOP)},
+		},
+		{
+			name: "push data",
+			code: []byte{byte(PUSH1), 4, byte(JUMP), byte(PUSH1), byte(JUMPDEST), byte(STOP)},
+			err:  ErrInvalidJump,
+		},
+		{
+			name: "push32 data",
+			code: append([]byte{byte(PUSH1), 35, byte(JUMP)}, push(big.NewInt(int64(JUMPDEST)))...),
+			err:  ErrInvalidJump,
+		},
+		{
+			name: "conditional into push data",
+			code: []byte{byte(PUSH1), 1, byte(PUSH1), 7, byte(JUMPI), byte(STOP), byte(PUSH1), byte(JUMPDEST), byte(STOP)},
+			err:  ErrInvalidJump,
+		},
+		{
+			name: "beyond code",
+			code: []byte{byte(PUSH1), 100, byte(JUMP), byte(JUMPDEST)},
+			err:  ErrInvalidJump,
+		},
+	}
+	for _, test := range tests {
+		_, gas, err := run(t, test.code)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if test.err != nil && gas != 0 {
+			t.Errorf("%s: %d gas left after the failed jump, want all consumed", test.name, gas)
+		}
+	}
+}
+
+func TestStaticCallWriteProtection(t *testing.T) {
+	store := []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)}
+	logs := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(LOG0), byte(STOP)}
+	send := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 1, byte(PUSH1), 0xff, byte(GAS), byte(CALL), byte(STOP)}
+	read := []byte{byte(PUSH1), 0, byte(SLOAD), byte(STOP)}
+
+	for name, code := range map[string][]byte{"sstore": store, "log": logs, "call with value": send} {
+		evm, statedb := newTestEVM(t, map[common.Address][]byte{testCallee: code})
+		statedb.AddBalance(testCallee, big.NewInt(1))
+		if _, _, err := evm.StaticCall(testCaller, testCallee, nil, 100000); err != ErrWriteProtection {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrWriteProtection)
+		}
+		if statedb.GetState(testCallee, common.Hash{}) != (common.Hash{}) {
+			t.Errorf("%s: storage written in a static call", name)
+		}
+	}
+	evm, _ := newTestEVM(t, map[common.Address][]byte{testCallee: read})
+	if _, _, err := evm.StaticCall(testCaller, testCallee, nil, 100000); err != nil {
+		t.Errorf("reading in a static call: %v", err)
+	}
+
+	// A STATICCALL instruction reports the failure, and its protection lasts
+	// through nested calls, which fail without failing their caller.
+	staticCall := func(to common.Address) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+		code = append(code, to.Bytes()...)
+		return append(append(code, byte(GAS), byte(STATICCALL)), returnTop...)
+	}
+	call := func(to common.Address) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+		code = append(code, to.Bytes()...)
+		return append(append(code, byte(GAS), byte(CALL)), returnTop...)
+	}
+	nested := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	static := common.HexToAddress("0x5000000000000000000000000000000000000005")
+	evm, statedb := newTestEVM(t, map[common.Address][]byte{
+		testTarget: staticCall(testCallee),
+		static:     staticCall(nested),
+		nested:     call(testCallee),
+		testCallee: store,
+	})
+	ret, _, err := evm.Call(testCaller, testTarget, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("STATICCALL error: %v", err)
+	}
+	if new(big.Int).SetBytes(ret).Sign() != 0 {
+		t.Errorf("STATICCALL of a write succeeded")
+	}
+	ret, _, err = evm.Call(testCaller, static, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("STATICCALL error: %v", err)
+	}
+	if new(big.Int).SetBytes(ret).Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("STATICCALL failed with the failing CALL it made")
+	}
+	if statedb.GetState(testCallee, common.Hash{}) != (common.Hash{}) {
+		t.Errorf("storage written under a STATICCALL")
+	}
+	if _, _, err := evm.Call(testCaller, nested, nil, 1000000, new(big.Int)); err != nil {
+		t.Fatalf("CALL error: %v", err)
+	}
+	if statedb.GetState(testCallee, common.Hash{}) != common.BigToHash(big.NewInt(1)) {
+		t.Errorf("write protection outlived the STATICCALL")
+	}
+}
+
+func TestRevertData(t *testing.T) {
+	// Stores 1 in slot 0, then reverts with the 2 bytes 0xbeef.
+	revert := []byte{
+		byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE),
+		byte(PUSH2), 0xbe, 0xef, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 2, byte(PUSH1), 30, byte(REVERT),
+	}
+	evm, statedb := newTestEVM(t, map[common.Address][]byte{testCallee: revert})
+	ret, gas, err := evm.Call(testCaller, testCallee, nil, 100000, new(big.Int))
+	if err != ErrExecutionReverted {
+		t.Fatalf("got error %v, want %v", err, ErrExecutionReverted)
+	}
+	if !bytes.Equal(ret, []byte{0xbe, 0xef}) {
+		t.Errorf("got revert data %x, want beef", ret)
+	}
+	if gas == 0 {
+		t.Error("revert consumed all gas")
+	}
+	if statedb.GetState(testCallee, common.Hash{}) != (common.Hash{}) {
+		t.Error("storage write not reverted")
+	}
+
+	// The caller of a reverting contract gets the revert data from
+	// RETURNDATACOPY, and the call fails without reverting the caller.
+	caller := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	caller = append(caller, testCallee.Bytes()...)
+	caller = append(caller,
+		byte(GAS), byte(CALL), byte(PUSH1), 0, byte(SSTORE),
+		byte(RETURNDATASIZE), byte(PUSH1), 0, byte(PUSH1), 0, byte(RETURNDATACOPY),
+		byte(RETURNDATASIZE), byte(PUSH1), 0, byte(RETURN),
+	)
+	statedb.CreateAccount(testTarget)
+	statedb.SetCode(testTarget, caller)
+	statedb.SetState(testTarget, common.Hash{}, common.BigToHash(big.NewInt(7)))
+	ret, _, err = evm.Call(testCaller, testTarget, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("caller error: %v", err)
+	}
+	if !bytes.Equal(ret, []byte{0xbe, 0xef}) {
+		t.Errorf("caller got return data %x, want beef", ret)
+	}
+	if statedb.GetState(testTarget, common.Hash{}) != (common.Hash{}) {
+		t.Error("caller didn't see the call fail")
+	}
+	if statedb.GetState(testCallee, common.Hash{}) != (common.Hash{}) {
+		t.Error("storage write of the reverted call kept")
+	}
+}
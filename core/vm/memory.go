@@ -0,0 +1,54 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+// memory is the byte addressable, zero initialized memory of a running contract.
+// It only grows, in words of 32 bytes.
+type memory struct {
+	store []byte
+}
+
+func (m *memory) len() uint64 { return uint64(len(m.store)) }
+
+// resize grows the memory to size bytes, which is a multiple of 32.
+func (m *memory) resize(size uint64) {
+	if uint64(len(m.store)) < size {
+		m.store = append(m.store, make([]byte, size-uint64(len(m.store)))...)
+	}
+}
+
+// set copies value into memory at offset, filling up with zeros to size bytes.
+// The memory must have been resized to hold them.
+func (m *memory) set(offset, size uint64, value []byte) {
+	if size == 0 {
+		return
+	}
+	n := copy(m.store[offset:offset+size], value)
+	for i := offset + uint64(n); i < offset+size; i++ {
+		m.store[i] = 0
+	}
+}
+
+// get returns a copy of size bytes at offset.
+func (m *memory) get(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	cpy := make([]byte, size)
+	copy(cpy, m.store[offset:offset+size])
+	return cpy
+}
@@ -0,0 +1,335 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "fmt"
+
+// OpCode is an EVM instruction.
+type OpCode byte
+
+// The opcodes of the Constantinople instruction set.
+const (
+	STOP           OpCode = 0x0
+	ADD            OpCode = 0x1
+	MUL            OpCode = 0x2
+	SUB            OpCode = 0x3
+	DIV            OpCode = 0x4
+	SDIV           OpCode = 0x5
+	MOD            OpCode = 0x6
+	SMOD           OpCode = 0x7
+	ADDMOD         OpCode = 0x8
+	MULMOD         OpCode = 0x9
+	EXP            OpCode = 0xa
+	SIGNEXTEND     OpCode = 0xb
+	LT             OpCode = 0x10
+	GT             OpCode = 0x11
+	SLT            OpCode = 0x12
+	SGT            OpCode = 0x13
+	EQ             OpCode = 0x14
+	ISZERO         OpCode = 0x15
+	AND            OpCode = 0x16
+	OR             OpCode = 0x17
+	XOR            OpCode = 0x18
+	NOT            OpCode = 0x19
+	BYTE           OpCode = 0x1a
+	SHL            OpCode = 0x1b
+	SHR            OpCode = 0x1c
+	SAR            OpCode = 0x1d
+	SHA3           OpCode = 0x20
+	ADDRESS        OpCode = 0x30
+	BALANCE        OpCode = 0x31
+	ORIGIN         OpCode = 0x32
+	CALLER         OpCode = 0x33
+	CALLVALUE      OpCode = 0x34
+	CALLDATALOAD   OpCode = 0x35
+	CALLDATASIZE   OpCode = 0x36
+	CALLDATACOPY   OpCode = 0x37
+	CODESIZE       OpCode = 0x38
+	CODECOPY       OpCode = 0x39
+	GASPRICE       OpCode = 0x3a
+	EXTCODESIZE    OpCode = 0x3b
+	EXTCODECOPY    OpCode = 0x3c
+	RETURNDATASIZE OpCode = 0x3d
+	RETURNDATACOPY OpCode = 0x3e
+	EXTCODEHASH    OpCode = 0x3f
+	BLOCKHASH      OpCode = 0x40
+	COINBASE       OpCode = 0x41
+	TIMESTAMP      OpCode = 0x42
+	NUMBER         OpCode = 0x43
+	DIFFICULTY     OpCode = 0x44
+	GASLIMIT       OpCode = 0x45
+	POP            OpCode = 0x50
+	MLOAD          OpCode = 0x51
+	MSTORE         OpCode = 0x52
+	MSTORE8        OpCode = 0x53
+	SLOAD          OpCode = 0x54
+	SSTORE         OpCode = 0x55
+	JUMP           OpCode = 0x56
+	JUMPI          OpCode = 0x57
+	PC             OpCode = 0x58
+	MSIZE          OpCode = 0x59
+	GAS            OpCode = 0x5a
+	JUMPDEST       OpCode = 0x5b
+	PUSH1          OpCode = 0x60
+	PUSH2          OpCode = 0x61
+	PUSH3          OpCode = 0x62
+	PUSH4          OpCode = 0x63
+	PUSH5          OpCode = 0x64
+	PUSH6          OpCode = 0x65
+	PUSH7          OpCode = 0x66
+	PUSH8          OpCode = 0x67
+	PUSH9          OpCode = 0x68
+	PUSH10         OpCode = 0x69
+	PUSH11         OpCode = 0x6a
+	PUSH12         OpCode = 0x6b
+	PUSH13         OpCode = 0x6c
+	PUSH14         OpCode = 0x6d
+	PUSH15         OpCode = 0x6e
+	PUSH16         OpCode = 0x6f
+	PUSH17         OpCode = 0x70
+	PUSH18         OpCode = 0x71
+	PUSH19         OpCode = 0x72
+	PUSH20         OpCode = 0x73
+	PUSH21         OpCode = 0x74
+	PUSH22         OpCode = 0x75
+	PUSH23         OpCode = 0x76
+	PUSH24         OpCode = 0x77
+	PUSH25         OpCode = 0x78
+	PUSH26         OpCode = 0x79
+	PUSH27         OpCode = 0x7a
+	PUSH28         OpCode = 0x7b
+	PUSH29         OpCode = 0x7c
+	PUSH30         OpCode = 0x7d
+	PUSH31         OpCode = 0x7e
+	PUSH32         OpCode = 0x7f
+	DUP1           OpCode = 0x80
+	DUP2           OpCode = 0x81
+	DUP3           OpCode = 0x82
+	DUP4           OpCode = 0x83
+	DUP5           OpCode = 0x84
+	DUP6           OpCode = 0x85
+	DUP7           OpCode = 0x86
+	DUP8           OpCode = 0x87
+	DUP9           OpCode = 0x88
+	DUP10          OpCode = 0x89
+	DUP11          OpCode = 0x8a
+	DUP12          OpCode = 0x8b
+	DUP13          OpCode = 0x8c
+	DUP14          OpCode = 0x8d
+	DUP15          OpCode = 0x8e
+	DUP16          OpCode = 0x8f
+	SWAP1          OpCode = 0x90
+	SWAP2          OpCode = 0x91
+	SWAP3          OpCode = 0x92
+	SWAP4          OpCode = 0x93
+	SWAP5          OpCode = 0x94
+	SWAP6          OpCode = 0x95
+	SWAP7          OpCode = 0x96
+	SWAP8          OpCode = 0x97
+	SWAP9          OpCode = 0x98
+	SWAP10         OpCode = 0x99
+	SWAP11         OpCode = 0x9a
+	SWAP12         OpCode = 0x9b
+	SWAP13         OpCode = 0x9c
+	SWAP14         OpCode = 0x9d
+	SWAP15         OpCode = 0x9e
+	SWAP16         OpCode = 0x9f
+	LOG0           OpCode = 0xa0
+	LOG1           OpCode = 0xa1
+	LOG2           OpCode = 0xa2
+	LOG3           OpCode = 0xa3
+	LOG4           OpCode = 0xa4
+	CREATE         OpCode = 0xf0
+	CALL           OpCode = 0xf1
+	CALLCODE       OpCode = 0xf2
+	RETURN         OpCode = 0xf3
+	DELEGATECALL   OpCode = 0xf4
+	CREATE2        OpCode = 0xf5
+	STATICCALL     OpCode = 0xfa
+	REVERT         OpCode = 0xfd
+	SELFDESTRUCT   OpCode = 0xff
+
+	// INVALID is the designated invalid instruction.
+	INVALID OpCode = 0xfe
+)
+
+// operation describes the stack effect and static gas cost of an opcode.
+type operation struct {
+	valid  bool
+	pops   int    // items taken from the stack
+	pushes int    // items put on the stack
+	gas    uint64 // constant gas, charged before execution
+	writes bool   // modifies state, forbidden in static calls
+	name   string
+}
+
+var operations = [256]operation{
+	STOP:           {valid: true, pops: 0, pushes: 0, gas: 0, name: "STOP"},
+	ADD:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "ADD"},
+	MUL:            {valid: true, pops: 2, pushes: 1, gas: 5, name: "MUL"},
+	SUB:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SUB"},
+	DIV:            {valid: true, pops: 2, pushes: 1, gas: 5, name: "DIV"},
+	SDIV:           {valid: true, pops: 2, pushes: 1, gas: 5, name: "SDIV"},
+	MOD:            {valid: true, pops: 2, pushes: 1, gas: 5, name: "MOD"},
+	SMOD:           {valid: true, pops: 2, pushes: 1, gas: 5, name: "SMOD"},
+	ADDMOD:         {valid: true, pops: 3, pushes: 1, gas: 8, name: "ADDMOD"},
+	MULMOD:         {valid: true, pops: 3, pushes: 1, gas: 8, name: "MULMOD"},
+	EXP:            {valid: true, pops: 2, pushes: 1, gas: 10, name: "EXP"},
+	SIGNEXTEND:     {valid: true, pops: 2, pushes: 1, gas: 5, name: "SIGNEXTEND"},
+	LT:             {valid: true, pops: 2, pushes: 1, gas: 3, name: "LT"},
+	GT:             {valid: true, pops: 2, pushes: 1, gas: 3, name: "GT"},
+	SLT:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SLT"},
+	SGT:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SGT"},
+	EQ:             {valid: true, pops: 2, pushes: 1, gas: 3, name: "EQ"},
+	ISZERO:         {valid: true, pops: 1, pushes: 1, gas: 3, name: "ISZERO"},
+	AND:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "AND"},
+	OR:             {valid: true, pops: 2, pushes: 1, gas: 3, name: "OR"},
+	XOR:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "XOR"},
+	NOT:            {valid: true, pops: 1, pushes: 1, gas: 3, name: "NOT"},
+	BYTE:           {valid: true, pops: 2, pushes: 1, gas: 3, name: "BYTE"},
+	SHL:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SHL"},
+	SHR:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SHR"},
+	SAR:            {valid: true, pops: 2, pushes: 1, gas: 3, name: "SAR"},
+	SHA3:           {valid: true, pops: 2, pushes: 1, gas: 30, name: "SHA3"},
+	ADDRESS:        {valid: true, pops: 0, pushes: 1, gas: 2, name: "ADDRESS"},
+	BALANCE:        {valid: true, pops: 1, pushes: 1, gas: 400, name: "BALANCE"},
+	ORIGIN:         {valid: true, pops: 0, pushes: 1, gas: 2, name: "ORIGIN"},
+	CALLER:         {valid: true, pops: 0, pushes: 1, gas: 2, name: "CALLER"},
+	CALLVALUE:      {valid: true, pops: 0, pushes: 1, gas: 2, name: "CALLVALUE"},
+	CALLDATALOAD:   {valid: true, pops: 1, pushes: 1, gas: 3, name: "CALLDATALOAD"},
+	CALLDATASIZE:   {valid: true, pops: 0, pushes: 1, gas: 2, name: "CALLDATASIZE"},
+	CALLDATACOPY:   {valid: true, pops: 3, pushes: 0, gas: 3, name: "CALLDATACOPY"},
+	CODESIZE:       {valid: true, pops: 0, pushes: 1, gas: 2, name: "CODESIZE"},
+	CODECOPY:       {valid: true, pops: 3, pushes: 0, gas: 3, name: "CODECOPY"},
+	GASPRICE:       {valid: true, pops: 0, pushes: 1, gas: 2, name: "GASPRICE"},
+	EXTCODESIZE:    {valid: true, pops: 1, pushes: 1, gas: 700, name: "EXTCODESIZE"},
+	EXTCODECOPY:    {valid: true, pops: 4, pushes: 0, gas: 700, name: "EXTCODECOPY"},
+	RETURNDATASIZE: {valid: true, pops: 0, pushes: 1, gas: 2, name: "RETURNDATASIZE"},
+	RETURNDATACOPY: {valid: true, pops: 3, pushes: 0, gas: 3, name: "RETURNDATACOPY"},
+	EXTCODEHASH:    {valid: true, pops: 1, pushes: 1, gas: 400, name: "EXTCODEHASH"},
+	BLOCKHASH:      {valid: true, pops: 1, pushes: 1, gas: 20, name: "BLOCKHASH"},
+	COINBASE:       {valid: true, pops: 0, pushes: 1, gas: 2, name: "COINBASE"},
+	TIMESTAMP:      {valid: true, pops: 0, pushes: 1, gas: 2, name: "TIMESTAMP"},
+	NUMBER:         {valid: true, pops: 0, pushes: 1, gas: 2, name: "NUMBER"},
+	DIFFICULTY:     {valid: true, pops: 0, pushes: 1, gas: 2, name: "DIFFICULTY"},
+	GASLIMIT:       {valid: true, pops: 0, pushes: 1, gas: 2, name: "GASLIMIT"},
+	POP:            {valid: true, pops: 1, pushes: 0, gas: 2, name: "POP"},
+	MLOAD:          {valid: true, pops: 1, pushes: 1, gas: 3, name: "MLOAD"},
+	MSTORE:         {valid: true, pops: 2, pushes: 0, gas: 3, name: "MSTORE"},
+	MSTORE8:        {valid: true, pops: 2, pushes: 0, gas: 3, name: "MSTORE8"},
+	SLOAD:          {valid: true, pops: 1, pushes: 1, gas: 200, name: "SLOAD"},
+	SSTORE:         {valid: true, pops: 2, pushes: 0, gas: 0, writes: true, name: "SSTORE"},
+	JUMP:           {valid: true, pops: 1, pushes: 0, gas: 8, name: "JUMP"},
+	JUMPI:          {valid: true, pops: 2, pushes: 0, gas: 10, name: "JUMPI"},
+	PC:             {valid: true, pops: 0, pushes: 1, gas: 2, name: "PC"},
+	MSIZE:          {valid: true, pops: 0, pushes: 1, gas: 2, name: "MSIZE"},
+	GAS:            {valid: true, pops: 0, pushes: 1, gas: 2, name: "GAS"},
+	JUMPDEST:       {valid: true, pops: 0, pushes: 0, gas: 1, name: "JUMPDEST"},
+	PUSH1:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH1"},
+	PUSH2:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH2"},
+	PUSH3:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH3"},
+	PUSH4:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH4"},
+	PUSH5:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH5"},
+	PUSH6:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH6"},
+	PUSH7:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH7"},
+	PUSH8:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH8"},
+	PUSH9:          {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH9"},
+	PUSH10:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH10"},
+	PUSH11:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH11"},
+	PUSH12:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH12"},
+	PUSH13:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH13"},
+	PUSH14:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH14"},
+	PUSH15:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH15"},
+	PUSH16:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH16"},
+	PUSH17:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH17"},
+	PUSH18:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH18"},
+	PUSH19:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH19"},
+	PUSH20:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH20"},
+	PUSH21:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH21"},
+	PUSH22:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH22"},
+	PUSH23:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH23"},
+	PUSH24:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH24"},
+	PUSH25:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH25"},
+	PUSH26:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH26"},
+	PUSH27:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH27"},
+	PUSH28:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH28"},
+	PUSH29:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH29"},
+	PUSH30:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH30"},
+	PUSH31:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH31"},
+	PUSH32:         {valid: true, pops: 0, pushes: 1, gas: 3, name: "PUSH32"},
+	DUP1:           {valid: true, pops: 1, pushes: 2, gas: 3, name: "DUP1"},
+	DUP2:           {valid: true, pops: 2, pushes: 3, gas: 3, name: "DUP2"},
+	DUP3:           {valid: true, pops: 3, pushes: 4, gas: 3, name: "DUP3"},
+	DUP4:           {valid: true, pops: 4, pushes: 5, gas: 3, name: "DUP4"},
+	DUP5:           {valid: true, pops: 5, pushes: 6, gas: 3, name: "DUP5"},
+	DUP6:           {valid: true, pops: 6, pushes: 7, gas: 3, name: "DUP6"},
+	DUP7:           {valid: true, pops: 7, pushes: 8, gas: 3, name: "DUP7"},
+	DUP8:           {valid: true, pops: 8, pushes: 9, gas: 3, name: "DUP8"},
+	DUP9:           {valid: true, pops: 9, pushes: 10, gas: 3, name: "DUP9"},
+	DUP10:          {valid: true, pops: 10, pushes: 11, gas: 3, name: "DUP10"},
+	DUP11:          {valid: true, pops: 11, pushes: 12, gas: 3, name: "DUP11"},
+	DUP12:          {valid: true, pops: 12, pushes: 13, gas: 3, name: "DUP12"},
+	DUP13:          {valid: true, pops: 13, pushes: 14, gas: 3, name: "DUP13"},
+	DUP14:          {valid: true, pops: 14, pushes: 15, gas: 3, name: "DUP14"},
+	DUP15:          {valid: true, pops: 15, pushes: 16, gas: 3, name: "DUP15"},
+	DUP16:          {valid: true, pops: 16, pushes: 17, gas: 3, name: "DUP16"},
+	SWAP1:          {valid: true, pops: 2, pushes: 2, gas: 3, name: "SWAP1"},
+	SWAP2:          {valid: true, pops: 3, pushes: 3, gas: 3, name: "SWAP2"},
+	SWAP3:          {valid: true, pops: 4, pushes: 4, gas: 3, name: "SWAP3"},
+	SWAP4:          {valid: true, pops: 5, pushes: 5, gas: 3, name: "SWAP4"},
+	SWAP5:          {valid: true, pops: 6, pushes: 6, gas: 3, name: "SWAP5"},
+	SWAP6:          {valid: true, pops: 7, pushes: 7, gas: 3, name: "SWAP6"},
+	SWAP7:          {valid: true, pops: 8, pushes: 8, gas: 3, name: "SWAP7"},
+	SWAP8:          {valid: true, pops: 9, pushes: 9, gas: 3, name: "SWAP8"},
+	SWAP9:          {valid: true, pops: 10, pushes: 10, gas: 3, name: "SWAP9"},
+	SWAP10:         {valid: true, pops: 11, pushes: 11, gas: 3, name: "SWAP10"},
+	SWAP11:         {valid: true, pops: 12, pushes: 12, gas: 3, name: "SWAP11"},
+	SWAP12:         {valid: true, pops: 13, pushes: 13, gas: 3, name: "SWAP12"},
+	SWAP13:         {valid: true, pops: 14, pushes: 14, gas: 3, name: "SWAP13"},
+	SWAP14:         {valid: true, pops: 15, pushes: 15, gas: 3, name: "SWAP14"},
+	SWAP15:         {valid: true, pops: 16, pushes: 16, gas: 3, name: "SWAP15"},
+	SWAP16:         {valid: true, pops: 17, pushes: 17, gas: 3, name: "SWAP16"},
+	LOG0:           {valid: true, pops: 2, pushes: 0, gas: 375, writes: true, name: "LOG0"},
+	LOG1:           {valid: true, pops: 3, pushes: 0, gas: 750, writes: true, name: "LOG1"},
+	LOG2:           {valid: true, pops: 4, pushes: 0, gas: 1125, writes: true, name: "LOG2"},
+	LOG3:           {valid: true, pops: 5, pushes: 0, gas: 1500, writes: true, name: "LOG3"},
+	LOG4:           {valid: true, pops: 6, pushes: 0, gas: 1875, writes: true, name: "LOG4"},
+	CREATE:         {valid: true, pops: 3, pushes: 1, gas: 32000, writes: true, name: "CREATE"},
+	CALL:           {valid: true, pops: 7, pushes: 1, gas: 700, name: "CALL"},
+	CALLCODE:       {valid: true, pops: 7, pushes: 1, gas: 700, name: "CALLCODE"},
+	RETURN:         {valid: true, pops: 2, pushes: 0, gas: 0, name: "RETURN"},
+	DELEGATECALL:   {valid: true, pops: 6, pushes: 1, gas: 700, name: "DELEGATECALL"},
+	CREATE2:        {valid: true, pops: 4, pushes: 1, gas: 32000, writes: true, name: "CREATE2"},
+	STATICCALL:     {valid: true, pops: 6, pushes: 1, gas: 700, name: "STATICCALL"},
+	REVERT:         {valid: true, pops: 2, pushes: 0, gas: 0, name: "REVERT"},
+	SELFDESTRUCT:   {valid: true, pops: 1, pushes: 0, gas: 5000, writes: true, name: "SELFDESTRUCT"},
+}
+
+func (op OpCode) String() string {
+	if operations[op].valid {
+		return operations[op].name
+	}
+	if op == INVALID {
+		return "INVALID"
+	}
+	return fmt.Sprintf("opcode 0x%x not defined", int(op))
+}
+
+// IsPush reports whether op is one of the PUSH instructions.
+func (op OpCode) IsPush() bool {
+	return op >= PUSH1 && op <= PUSH32
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "math/big"
+
+// stackLimit is the maximum number of items on the stack.
+const stackLimit = 1024
+
+// stack is the operand stack of a running contract. Items are 256 bit unsigned
+// values and may be shared, so operations never modify them in place.
+type stack struct {
+	data []*big.Int
+}
+
+func newStack() *stack {
+	return &stack{data: make([]*big.Int, 0, 16)}
+}
+
+func (st *stack) len() int { return len(st.data) }
+
+func (st *stack) push(v *big.Int) { st.data = append(st.data, v) }
+
+func (st *stack) pop() *big.Int {
+	v := st.data[len(st.data)-1]
+	st.data = st.data[:len(st.data)-1]
+	return v
+}
+
+// peek returns the n-th item from the top, 0 being the top.
+func (st *stack) peek(n int) *big.Int { return st.data[len(st.data)-1-n] }
+
+func (st *stack) dup(n int) { st.push(st.data[len(st.data)-n]) }
+
+func (st *stack) swap(n int) {
+	top := len(st.data) - 1
+	st.data[top], st.data[top-n] = st.data[top-n], st.data[top]
+}
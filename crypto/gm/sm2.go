@@ -0,0 +1,252 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package gm implements the Chinese national standard (guomi) cryptography used by
+// FISCO BCOS guomi chains: the SM2 elliptic curve signature scheme and the SM3 hash
+// function.
+//
+// Unlike secp256k1 signatures, SM2 signatures don't allow recovering the public
+// key, so guomi transactions carry the full public key of the sender next to the
+// r and s signature values.
+package gm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+)
+
+// DefaultUID is the signer identity FISCO BCOS and its SDKs sign with.
+var DefaultUID = []byte("1234567812345678")
+
+// SignatureLength is the length of a signature as carried by guomi transactions:
+// r, s and the 64 byte public key of the signer.
+const SignatureLength = 32 + 32 + 64
+
+var (
+	errInvalidPrivateKey = errors.New("gm: invalid sm2 private key")
+	errInvalidPublicKey  = errors.New("gm: invalid sm2 public key")
+	errInvalidSignature  = errors.New("gm: invalid signature length")
+)
+
+var (
+	initOnce sync.Once
+	sm2P256  *elliptic.CurveParams
+	one      = big.NewInt(1)
+)
+
+func initP256Sm2() {
+	sm2P256 = &elliptic.CurveParams{Name: "SM2-P-256"}
+	sm2P256.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+	sm2P256.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+	sm2P256.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+	sm2P256.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+	sm2P256.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+	sm2P256.BitSize = 256
+}
+
+// P256Sm2 returns the sm2p256v1 curve. Its a parameter is p - 3, which the generic
+// curve arithmetic of crypto/elliptic assumes.
+func P256Sm2() elliptic.Curve {
+	initOnce.Do(initP256Sm2)
+	return sm2P256
+}
+
+// GenerateKey generates a new SM2 private key.
+func GenerateKey(random io.Reader) (*ecdsa.PrivateKey, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	curve := P256Sm2()
+	// The private key must be in [1, n-2] for 1+d to be invertible.
+	max := new(big.Int).Sub(curve.Params().N, big.NewInt(2))
+	d, err := rand.Int(random, max)
+	if err != nil {
+		return nil, err
+	}
+	d.Add(d, one)
+	return ToSM2(math.PaddedBigBytes(d, 32))
+}
+
+// ToSM2 creates an SM2 private key from its 32 byte scalar.
+func ToSM2(d []byte) (*ecdsa.PrivateKey, error) {
+	curve := P256Sm2()
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	priv.Curve = curve
+	max := new(big.Int).Sub(curve.Params().N, one)
+	if len(d) != 32 || priv.D.Sign() <= 0 || priv.D.Cmp(max) >= 0 {
+		return nil, errInvalidPrivateKey
+	}
+	priv.X, priv.Y = curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// IsSM2 reports whether the key is on the SM2 curve.
+func IsSM2(pub *ecdsa.PublicKey) bool {
+	return pub != nil && pub.Curve == P256Sm2()
+}
+
+// MarshalPubkey encodes the public key as the 64 byte concatenation of its
+// coordinates, the form carried by guomi transactions.
+func MarshalPubkey(pub *ecdsa.PublicKey) []byte {
+	return append(math.PaddedBigBytes(pub.X, 32), math.PaddedBigBytes(pub.Y, 32)...)
+}
+
+// UnmarshalPubkey decodes a 64 byte public key as carried by guomi transactions.
+func UnmarshalPubkey(b []byte) (*ecdsa.PublicKey, error) {
+	if len(b) != 64 {
+		return nil, errInvalidPublicKey
+	}
+	curve := P256Sm2()
+	pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(b[:32]), Y: new(big.Int).SetBytes(b[32:])}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errInvalidPublicKey
+	}
+	return pub, nil
+}
+
+// PubkeyToAddress returns the account address of an SM2 public key, the last 20
+// bytes of the SM3 hash of its coordinates.
+func PubkeyToAddress(pub ecdsa.PublicKey) common.Address {
+	return common.BytesToAddress(SM3(MarshalPubkey(&pub))[12:])
+}
+
+// za computes the signer identity hash Z = SM3(ENTL || ID || a || b || Gx || Gy || x || y).
+func za(pub *ecdsa.PublicKey, uid []byte) []byte {
+	params := P256Sm2().Params()
+	a := new(big.Int).Sub(params.P, big.NewInt(3))
+	entl := len(uid) * 8
+	return SM3(
+		[]byte{byte(entl >> 8), byte(entl)}, uid,
+		math.PaddedBigBytes(a, 32), math.PaddedBigBytes(params.B, 32),
+		math.PaddedBigBytes(params.Gx, 32), math.PaddedBigBytes(params.Gy, 32),
+		math.PaddedBigBytes(pub.X, 32), math.PaddedBigBytes(pub.Y, 32),
+	)
+}
+
+// Sign signs msg with the private key under DefaultUID, hashing it together with
+// the signer identity as SM2 requires.
+func Sign(priv *ecdsa.PrivateKey, msg []byte) (r, s *big.Int, err error) {
+	return SignWithUID(rand.Reader, priv, msg, DefaultUID)
+}
+
+// SignWithUID signs msg with the private key under the given signer identity.
+func SignWithUID(random io.Reader, priv *ecdsa.PrivateKey, msg, uid []byte) (r, s *big.Int, err error) {
+	if !IsSM2(&priv.PublicKey) {
+		return nil, nil, errInvalidPrivateKey
+	}
+	curve := P256Sm2()
+	n := curve.Params().N
+	e := new(big.Int).SetBytes(SM3(za(&priv.PublicKey, uid), msg))
+
+	// (1 + d)^-1
+	dInv := new(big.Int).Add(priv.D, one)
+	dInv.ModInverse(dInv, n)
+
+	for {
+		k, err := rand.Int(random, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		if k.Sign() == 0 {
+			continue
+		}
+		x1, _ := curve.ScalarBaseMult(math.PaddedBigBytes(k, 32))
+		r = new(big.Int).Add(e, x1)
+		r.Mod(r, n)
+		if r.Sign() == 0 || new(big.Int).Add(r, k).Cmp(n) == 0 {
+			continue
+		}
+		// s = (1 + d)^-1 * (k - r * d) mod n
+		s = new(big.Int).Mul(r, priv.D)
+		s.Sub(k, s)
+		s.Mul(s, dInv)
+		s.Mod(s, n)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// Verify reports whether r, s is a valid signature of msg by the public key under
+// DefaultUID.
+func Verify(pub *ecdsa.PublicKey, msg []byte, r, s *big.Int) bool {
+	return VerifyWithUID(pub, msg, DefaultUID, r, s)
+}
+
+// VerifyWithUID reports whether r, s is a valid signature of msg by the public key
+// under the given signer identity.
+func VerifyWithUID(pub *ecdsa.PublicKey, msg, uid []byte, r, s *big.Int) bool {
+	if !IsSM2(pub) {
+		return false
+	}
+	curve := P256Sm2()
+	n := curve.Params().N
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return false
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return false
+	}
+	e := new(big.Int).SetBytes(SM3(za(pub, uid), msg))
+
+	x1, y1 := curve.ScalarBaseMult(math.PaddedBigBytes(s, 32))
+	x2, y2 := curve.ScalarMult(pub.X, pub.Y, math.PaddedBigBytes(t, 32))
+	x, _ := curve.Add(x1, y1, x2, y2)
+
+	x.Add(x, e)
+	x.Mod(x, n)
+	return x.Cmp(r) == 0
+}
+
+// SignHash signs a 32 byte hash and returns the signature in the form carried by
+// guomi transactions: r || s || public key.
+func SignHash(hash []byte, priv *ecdsa.PrivateKey) ([]byte, error) {
+	r, s, err := Sign(priv, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 0, SignatureLength)
+	sig = append(sig, math.PaddedBigBytes(r, 32)...)
+	sig = append(sig, math.PaddedBigBytes(s, 32)...)
+	return append(sig, MarshalPubkey(&priv.PublicKey)...), nil
+}
+
+// VerifyHash checks a signature in the form produced by SignHash, returning the
+// public key of the signer if it is valid.
+func VerifyHash(hash, sig []byte) (*ecdsa.PublicKey, error) {
+	if len(sig) != SignatureLength {
+		return nil, errInvalidSignature
+	}
+	pub, err := UnmarshalPubkey(sig[64:])
+	if err != nil {
+		return nil, err
+	}
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])
+	if !Verify(pub, hash, r, s) {
+		return nil, errors.New("gm: signature verification failed")
+	}
+	return pub, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package gm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+)
+
+func mustBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid number %q", s)
+	}
+	return n
+}
+
+func mustKey(t *testing.T, d string) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ToSM2(common.FromHex(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestSM2Standard checks the signature example of GB/T 32918.2-2016 on the
+// recommended curve: the public key, the signer identity hash and the signature.
+func TestSM2Standard(t *testing.T) {
+	key := mustKey(t, "3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8")
+	if want := mustBig(t, "09F9DF311E5421A150DD7D161E4BC5C672179FAD1833FC076BB08FF356F35020"); key.X.Cmp(want) != 0 {
+		t.Errorf("public key x = %x, want %x", key.X, want)
+	}
+	if want := mustBig(t, "CCEA490CE26775A52DC6EA718CC1AA600AED05FBF35E084A6632F6072DA9AD13"); key.Y.Cmp(want) != 0 {
+		t.Errorf("public key y = %x, want %x", key.Y, want)
+	}
+	want := "b2e14c5c79c6df5b85f4fe7ed8db7a262b9da7e07ccb0ea9f4747b8ccda8a4f3"
+	if got := hex.EncodeToString(za(&key.PublicKey, DefaultUID)); got != want {
+		t.Errorf("za = %s, want %s", got, want)
+	}
+	msg := []byte("message digest")
+	r := mustBig(t, "F5A03B0648D2C4630EEAC513E1BB81A15944DA3827D5B74143AC7EACEEE720B3")
+	s := mustBig(t, "B1B6AA29DF212FD8763182BC0D421CA1BB9038FD1F7F42D4840B69C485BBC1AA")
+	if !Verify(&key.PublicKey, msg, r, s) {
+		t.Error("standard signature rejected")
+	}
+	if VerifyWithUID(&key.PublicKey, msg, []byte("8765432187654321"), r, s) {
+		t.Error("signature accepted under another identity")
+	}
+	if Verify(&key.PublicKey, []byte("message digesT"), r, s) {
+		t.Error("signature accepted for another message")
+	}
+}
+
+// TestSM2External verifies a signature made by another implementation, OpenSSL 3
+// (pkeyutl -sign -rawin -digest sm3 -pkeyopt distid:1234567812345678).
+func TestSM2External(t *testing.T) {
+	key := mustKey(t, "32ccbc7fcff78ffae0749478fa9d5eeecc3858606bddfcd3051446cf15fa2d66")
+	pub := common.FromHex("07165f9a71e1ee71fe7b5f093e895b4cc41ac9ba0721006839e628364b81cc05514042bea00ca686c24dbc5a5a6ef37185e0b024cde024705bf71241a966ff05")
+	if got := MarshalPubkey(&key.PublicKey); !bytes.Equal(got, pub) {
+		t.Fatalf("public key = %x, want %x", got, pub)
+	}
+	r := mustBig(t, "95EF544E38487F014E2B33B64C7CE52F980729DA2D2CF6E0EEEF15339658EB4F")
+	s := mustBig(t, "F5430AB7A1BA8C24A01B5E9A9F4F3F86C5651CFD3D17AF0872AA97A958796604")
+	if !Verify(&key.PublicKey, []byte("fisco bcos"), r, s) {
+		t.Error("external signature rejected")
+	}
+}
+
+func TestSM2SignHash(t *testing.T) {
+	key, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := SM3([]byte("fisco bcos"))
+	sig, err := SignHash(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != SignatureLength {
+		t.Fatalf("signature length %d, want %d", len(sig), SignatureLength)
+	}
+	pub, err := VerifyHash(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PubkeyToAddress(*pub) != PubkeyToAddress(key.PublicKey) {
+		t.Errorf("signer %x, want %x", PubkeyToAddress(*pub), PubkeyToAddress(key.PublicKey))
+	}
+
+	sig[0] ^= 1
+	if _, err := VerifyHash(hash, sig); err == nil {
+		t.Error("tampered signature accepted")
+	}
+	if _, err := VerifyHash(hash, sig[:64]); err != errInvalidSignature {
+		t.Errorf("short signature: got %v, want %v", err, errInvalidSignature)
+	}
+}
+
+func TestToSM2Invalid(t *testing.T) {
+	n := math.PaddedBigBytes(P256Sm2().Params().N, 32)
+	for _, d := range [][]byte{make([]byte, 32), n, make([]byte, 31)} {
+		if _, err := ToSM2(d); err != errInvalidPrivateKey {
+			t.Errorf("ToSM2(%x): got %v, want %v", d, err, errInvalidPrivateKey)
+		}
+	}
+}
+
+func TestUnmarshalPubkeyOffCurve(t *testing.T) {
+	key := mustKey(t, "3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8")
+	pub := MarshalPubkey(&key.PublicKey)
+	pub[63] ^= 1
+	if _, err := UnmarshalPubkey(pub); err != errInvalidPublicKey {
+		t.Errorf("got %v, want %v", err, errInvalidPublicKey)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package gm
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+
+	"github.com/chislab/go-fiscobcos/common"
+)
+
+const (
+	// SM3Size is the size of an SM3 digest in bytes.
+	SM3Size = 32
+
+	// SM3BlockSize is the block size of SM3 in bytes.
+	SM3BlockSize = 64
+)
+
+var sm3IV = [8]uint32{
+	0x7380166f, 0x4914b2b9, 0x172442d7, 0xda8a0600,
+	0xa96f30bc, 0x163138aa, 0xe38dee4d, 0xb0fb0e4e,
+}
+
+// sm3 implements hash.Hash for the SM3 hash function (GB/T 32905-2016).
+type sm3 struct {
+	h   [8]uint32
+	buf [SM3BlockSize]byte
+	n   int    // bytes buffered
+	len uint64 // bytes written
+}
+
+// NewSM3 returns a new hash.Hash computing the SM3 digest.
+func NewSM3() hash.Hash {
+	d := new(sm3)
+	d.Reset()
+	return d
+}
+
+// SM3 calculates and returns the SM3 hash of the input data.
+func SM3(data ...[]byte) []byte {
+	d := NewSM3()
+	for _, b := range data {
+		d.Write(b)
+	}
+	return d.Sum(nil)
+}
+
+// SM3Hash calculates and returns the SM3 hash of the input data, converting it
+// to an internal Hash data structure.
+func SM3Hash(data ...[]byte) (h common.Hash) {
+	d := NewSM3()
+	for _, b := range data {
+		d.Write(b)
+	}
+	d.Sum(h[:0])
+	return h
+}
+
+func (d *sm3) Size() int      { return SM3Size }
+func (d *sm3) BlockSize() int { return SM3BlockSize }
+
+func (d *sm3) Reset() {
+	d.h = sm3IV
+	d.n = 0
+	d.len = 0
+}
+
+func (d *sm3) Write(p []byte) (int, error) {
+	written := len(p)
+	d.len += uint64(written)
+	if d.n > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n < SM3BlockSize {
+			return written, nil
+		}
+		d.block(d.buf[:])
+		d.n = 0
+	}
+	for len(p) >= SM3BlockSize {
+		d.block(p[:SM3BlockSize])
+		p = p[SM3BlockSize:]
+	}
+	d.n = copy(d.buf[:], p)
+	return written, nil
+}
+
+func (d *sm3) Sum(in []byte) []byte {
+	// Work on a copy so that the caller can keep writing.
+	c := *d
+
+	var pad [SM3BlockSize + 8]byte
+	pad[0] = 0x80
+	padLen := SM3BlockSize - int((c.len+8)%SM3BlockSize)
+	if padLen == 0 {
+		padLen = SM3BlockSize
+	}
+	binary.BigEndian.PutUint64(pad[padLen:], c.len*8)
+	c.Write(pad[:padLen+8])
+
+	var digest [SM3Size]byte
+	for i, v := range c.h {
+		binary.BigEndian.PutUint32(digest[i*4:], v)
+	}
+	return append(in, digest[:]...)
+}
+
+func p0(x uint32) uint32 { return x ^ bits.RotateLeft32(x, 9) ^ bits.RotateLeft32(x, 17) }
+func p1(x uint32) uint32 { return x ^ bits.RotateLeft32(x, 15) ^ bits.RotateLeft32(x, 23) }
+
+// block runs the compression function over a single 64 byte block.
+func (d *sm3) block(p []byte) {
+	var w [68]uint32
+	for i := 0; i < 16; i++ {
+		w[i] = binary.BigEndian.Uint32(p[i*4:])
+	}
+	for j := 16; j < 68; j++ {
+		w[j] = p1(w[j-16]^w[j-9]^bits.RotateLeft32(w[j-3], 15)) ^ bits.RotateLeft32(w[j-13], 7) ^ w[j-6]
+	}
+	a, b, c, dd, e, f, g, h := d.h[0], d.h[1], d.h[2], d.h[3], d.h[4], d.h[5], d.h[6], d.h[7]
+	for j := 0; j < 64; j++ {
+		var t, ff, gg uint32
+		if j < 16 {
+			t = 0x79cc4519
+			ff = a ^ b ^ c
+			gg = e ^ f ^ g
+		} else {
+			t = 0x7a879d8a
+			ff = (a & b) | (a & c) | (b & c)
+			gg = (e & f) | (^e & g)
+		}
+		a12 := bits.RotateLeft32(a, 12)
+		ss1 := bits.RotateLeft32(a12+e+bits.RotateLeft32(t, j%32), 7)
+		ss2 := ss1 ^ a12
+		tt1 := ff + dd + ss2 + (w[j] ^ w[j+4])
+		tt2 := gg + h + ss1 + w[j]
+		dd = c
+		c = bits.RotateLeft32(b, 9)
+		b = a
+		a = tt1
+		h = g
+		g = bits.RotateLeft32(f, 19)
+		f = e
+		e = p0(tt2)
+	}
+	d.h[0] ^= a
+	d.h[1] ^= b
+	d.h[2] ^= c
+	d.h[3] ^= dd
+	d.h[4] ^= e
+	d.h[5] ^= f
+	d.h[6] ^= g
+	d.h[7] ^= h
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package gm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Example vectors of GB/T 32905-2016 Appendix A.
+var sm3Tests = []struct {
+	in, out string
+}{
+	{"abc", "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+	{strings.Repeat("abcd", 16), "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+}
+
+func TestSM3(t *testing.T) {
+	for _, test := range sm3Tests {
+		if got := hex.EncodeToString(SM3([]byte(test.in))); got != test.out {
+			t.Errorf("SM3(%q) = %s, want %s", test.in, got, test.out)
+		}
+		if got := SM3Hash([]byte(test.in)).Hex(); got != "0x"+test.out {
+			t.Errorf("SM3Hash(%q) = %s, want 0x%s", test.in, got, test.out)
+		}
+	}
+}
+
+// TestSM3Incremental feeds the input in pieces of every size, across block
+// boundaries, and checks Reset restores the initial state.
+func TestSM3Incremental(t *testing.T) {
+	in := bytes.Repeat([]byte("abcd"), 40)
+	want := SM3(in)
+	d := NewSM3()
+	for size := 1; size <= len(in); size++ {
+		d.Reset()
+		for i := 0; i < len(in); i += size {
+			end := i + size
+			if end > len(in) {
+				end = len(in)
+			}
+			d.Write(in[i:end])
+		}
+		if got := d.Sum(nil); !bytes.Equal(got, want) {
+			t.Fatalf("chunks of %d: got %x, want %x", size, got, want)
+		}
+	}
+	// Sum must not change the state.
+	d.Reset()
+	d.Write([]byte("ab"))
+	d.Sum(nil)
+	d.Write([]byte("c"))
+	if got := hex.EncodeToString(d.Sum(nil)); got != sm3Tests[0].out {
+		t.Errorf("Write after Sum: got %s, want %s", got, sm3Tests[0].out)
+	}
+}
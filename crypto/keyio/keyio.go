@@ -0,0 +1,223 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package keyio loads and saves account keys in the formats distributed by FISCO
+// BCOS tooling: PEM encoded PKCS#8 (or SEC 1) private keys, as written by the
+// console's get_account.sh, password protected PKCS#12 files, as written by
+// get_account.sh -p, and encrypted keystore JSON files.
+package keyio
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/accounts/keystore"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// ErrUnsupportedCurve is returned for keys on a curve other than secp256k1
+	// and the sm2 curve of guomi chains. Keystore files only hold secp256k1 keys.
+	ErrUnsupportedCurve = errors.New("keyio: unsupported curve")
+
+	// ErrInvalidPEM is returned for files holding no PEM encoded private key.
+	ErrInvalidPEM = errors.New("keyio: no PEM private key found")
+
+	// ErrDecrypt is returned when a keystore or PKCS#12 file cannot be decrypted
+	// with the given password.
+	ErrDecrypt = keystore.ErrDecrypt
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	oidSM2            = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+)
+
+// pkcs8 is the PKCS#8 PrivateKeyInfo structure.
+type pkcs8 struct {
+	Version    int
+	Algorithm  algorithmIdentifier
+	PrivateKey []byte
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.ObjectIdentifier `asn1:"optional"`
+}
+
+// ecPrivateKey is the SEC 1 ECPrivateKey structure.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// LoadECDSAPem loads a PEM encoded private key, either PKCS#8 ("PRIVATE KEY") or
+// SEC 1 ("EC PRIVATE KEY").
+func LoadECDSAPem(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseECDSAPem(data)
+}
+
+// ParseECDSAPem parses the first PEM encoded private key in data.
+func ParseECDSAPem(data []byte) (*ecdsa.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, ErrInvalidPEM
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			return parsePKCS8(block.Bytes)
+		case "EC PRIVATE KEY":
+			return parseECPrivateKey(nil, block.Bytes)
+		}
+	}
+}
+
+// SaveECDSAPem writes the key to path as a PEM encoded PKCS#8 private key.
+func SaveECDSAPem(path string, key *ecdsa.PrivateKey) error {
+	data, err := MarshalECDSAPem(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// MarshalECDSAPem encodes the key as a PEM encoded PKCS#8 private key.
+func MarshalECDSAPem(key *ecdsa.PrivateKey) ([]byte, error) {
+	oid, err := curveOID(key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	sec1, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: math.PaddedBigBytes(key.D, 32),
+		PublicKey:  asn1.BitString{Bytes: elliptic.Marshal(key.Curve, key.X, key.Y), BitLength: 65 * 8},
+	})
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(pkcs8{
+		Algorithm:  algorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: oid},
+		PrivateKey: sec1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// LoadKeystore decrypts the key of an encrypted keystore JSON file. It fails with
+// ErrDecrypt if the password is wrong.
+func LoadKeystore(path, password string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, password)
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey, nil
+}
+
+// SaveKeystore encrypts the key with password and writes it to path as keystore
+// JSON, using the standard scrypt parameters.
+func SaveKeystore(path string, key *ecdsa.PrivateKey, password string) error {
+	if key.Curve != crypto.S256() {
+		return ErrUnsupportedCurve
+	}
+	data, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, password, keystore.StandardScryptN, keystore.StandardScryptP)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func parsePKCS8(der []byte) (*ecdsa.PrivateKey, error) {
+	var info pkcs8
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("keyio: invalid PKCS#8 key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("keyio: unsupported key algorithm %v", info.Algorithm.Algorithm)
+	}
+	return parseECPrivateKey(info.Algorithm.Parameters, info.PrivateKey)
+}
+
+// parseECPrivateKey parses a SEC 1 private key. The curve is taken from the key
+// if the enclosing structure doesn't name it.
+func parseECPrivateKey(oid asn1.ObjectIdentifier, der []byte) (*ecdsa.PrivateKey, error) {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, fmt.Errorf("keyio: invalid EC private key: %v", err)
+	}
+	if len(oid) == 0 {
+		oid = key.NamedCurveOID
+	}
+	curve, err := oidCurve(oid)
+	if err != nil {
+		return nil, err
+	}
+	d := new(big.Int).SetBytes(key.PrivateKey)
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("keyio: invalid private key value")
+	}
+	priv := &ecdsa.PrivateKey{D: d}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(math.PaddedBigBytes(d, 32))
+	return priv, nil
+}
+
+func oidCurve(oid asn1.ObjectIdentifier) (elliptic.Curve, error) {
+	switch {
+	case oid.Equal(oidSecp256k1):
+		return crypto.S256(), nil
+	case oid.Equal(oidSM2):
+		return gm.P256Sm2(), nil
+	}
+	return nil, ErrUnsupportedCurve
+}
+
+func curveOID(curve elliptic.Curve) (asn1.ObjectIdentifier, error) {
+	switch curve {
+	case crypto.S256():
+		return oidSecp256k1, nil
+	case gm.P256Sm2():
+		return oidSM2, nil
+	}
+	return nil, ErrUnsupportedCurve
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package keyio_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/keystore"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/crypto/keyio"
+	"github.com/pborman/uuid"
+)
+
+// The password testdata/gen.sh protects the PKCS#12 files with.
+const p12Password = "123456"
+
+// testKeys reads the private keys listed by testdata/gen.sh.
+func testKeys(t *testing.T) map[string]string {
+	f, err := os.Open(filepath.Join("testdata", "keys.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			keys[fields[0]] = fields[1]
+		}
+	}
+	return keys
+}
+
+func checkKey(t *testing.T, file string, key *ecdsa.PrivateKey, wantD string, sm2 bool) {
+	t.Helper()
+	if got := hex.EncodeToString(math.PaddedBigBytes(key.D, 32)); got != wantD {
+		t.Errorf("%s: private key %s, want %s", file, got, wantD)
+	}
+	if gm.IsSM2(&key.PublicKey) != sm2 {
+		t.Errorf("%s: sm2 key %v, want %v", file, gm.IsSM2(&key.PublicKey), sm2)
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		t.Errorf("%s: public key not on the curve", file)
+	}
+}
+
+func TestLoadECDSAPem(t *testing.T) {
+	keys := testKeys(t)
+	tests := []struct {
+		file, key string
+		sm2       bool
+	}{
+		{"account.pem", "account", false},
+		{"account_sec1.pem", "account_sec1", false},
+		{"gm_account.pem", "gm_account", true},
+	}
+	for _, test := range tests {
+		key, err := keyio.LoadECDSAPem(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		checkKey(t, test.file, key, keys[test.key], test.sm2)
+	}
+}
+
+func TestLoadP12(t *testing.T) {
+	keys := testKeys(t)
+	tests := []struct {
+		file, key string
+		sm2       bool
+	}{
+		{"account.p12", "account", false},
+		{"account_legacy.p12", "account", false},
+		{"gm_account.p12", "gm_account", true},
+	}
+	for _, test := range tests {
+		path := filepath.Join("testdata", test.file)
+		key, err := keyio.LoadP12(path, p12Password)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		checkKey(t, test.file, key, keys[test.key], test.sm2)
+
+		if _, err := keyio.LoadP12(path, "654321"); err != keyio.ErrDecrypt {
+			t.Errorf("%s: wrong password: got %v, want ErrDecrypt", test.file, err)
+		}
+	}
+}
+
+func TestUnsupportedCurve(t *testing.T) {
+	if _, err := keyio.LoadECDSAPem(filepath.Join("testdata", "p256.pem")); err != keyio.ErrUnsupportedCurve {
+		t.Errorf("pem: got %v, want ErrUnsupportedCurve", err)
+	}
+	if _, err := keyio.LoadP12(filepath.Join("testdata", "p256.p12"), p12Password); err != keyio.ErrUnsupportedCurve {
+		t.Errorf("p12: got %v, want ErrUnsupportedCurve", err)
+	}
+	key, err := gm.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyio.SaveKeystore(filepath.Join(os.TempDir(), "unused"), key, "pass"); err != keyio.ErrUnsupportedCurve {
+		t.Errorf("sm2 keystore: got %v, want ErrUnsupportedCurve", err)
+	}
+}
+
+func TestParseECDSAPemInvalid(t *testing.T) {
+	for _, data := range []string{"", "not a key", "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"} {
+		if _, err := keyio.ParseECDSAPem([]byte(data)); err != keyio.ErrInvalidPEM {
+			t.Errorf("%q: got %v, want ErrInvalidPEM", data, err)
+		}
+	}
+}
+
+func TestPemRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyio-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	k1, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2, err := gm.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []*ecdsa.PrivateKey{k1, sm2} {
+		path := filepath.Join(dir, "key.pem")
+		if err := keyio.SaveECDSAPem(path, key); err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		loaded, err := keyio.LoadECDSAPem(path)
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		if loaded.Curve != key.Curve || loaded.D.Cmp(key.D) != 0 || loaded.X.Cmp(key.X) != 0 {
+			t.Errorf("key %d: loaded key differs", i)
+		}
+	}
+}
+
+// TestLoadKeystore reads a keystore file encrypted with light scrypt parameters,
+// SaveKeystore's standard ones being too slow for a unit test.
+func TestLoadKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyio-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, "pass", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := keyio.LoadKeystore(path, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.D.Cmp(key.D) != 0 {
+		t.Error("loaded key differs")
+	}
+	if _, err := keyio.LoadKeystore(path, "wrong"); err != keyio.ErrDecrypt {
+		t.Errorf("wrong password: got %v, want ErrDecrypt", err)
+	}
+}
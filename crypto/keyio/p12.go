@@ -0,0 +1,358 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package keyio
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/big"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidPBEWithSHAAnd3DES        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBES2                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1             = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256           = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidSHA1                     = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidAES128CBC                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pbeAlgorithm
+	Digest    []byte
+}
+
+type pbeAlgorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pbeAlgorithm
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	Id         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"`
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pbeAlgorithm
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pbeAlgorithm
+	EncryptionScheme  pbeAlgorithm
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int          `asn1:"optional"`
+	PRF        pbeAlgorithm `asn1:"optional"`
+}
+
+// LoadP12 loads the private key of a PKCS#12 file, as written by the console's
+// get_account.sh -p. It fails with ErrDecrypt if the password is wrong.
+func LoadP12(path, password string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseP12(data, password)
+}
+
+// ParseP12 parses the first private key of a PKCS#12 file. Both the PBES2 AES
+// encryption of OpenSSL 3 and the triple DES encryption of earlier versions are
+// supported.
+func ParseP12(data []byte, password string) (*ecdsa.PrivateKey, error) {
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("keyio: trailing data after PKCS#12 file")
+	}
+	if pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, errors.New("keyio: unsupported PKCS#12 file")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+	}
+	bmpPassword := bmpString(password)
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) != 0 {
+		if err := verifyMac(&pfx.MacData, authSafe, bmpPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+	}
+	for _, ci := range contents {
+		var safeContents []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &safeContents); err != nil {
+				return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var ed encryptedData
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+				return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+			}
+			info := ed.EncryptedContentInfo
+			plain, err := pbeDecrypt(&info.ContentEncryptionAlgorithm, info.EncryptedContent, password, bmpPassword)
+			if err != nil {
+				return nil, err
+			}
+			safeContents = plain
+		default:
+			continue
+		}
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(safeContents, &bags); err != nil {
+			return nil, fmt.Errorf("keyio: invalid PKCS#12 file: %v", err)
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.Id.Equal(oidKeyBag):
+				return parsePKCS8(bag.Value.Bytes)
+			case bag.Id.Equal(oidPKCS8ShroudedKeyBag):
+				var info encryptedPrivateKeyInfo
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &info); err != nil {
+					return nil, fmt.Errorf("keyio: invalid PKCS#12 key: %v", err)
+				}
+				der, err := pbeDecrypt(&info.Algorithm, info.EncryptedData, password, bmpPassword)
+				if err != nil {
+					return nil, err
+				}
+				return parsePKCS8(der)
+			}
+		}
+	}
+	return nil, errors.New("keyio: no private key in PKCS#12 file")
+}
+
+// verifyMac checks the integrity of the file, which is what rejects a wrong
+// password before anything is decrypted.
+func verifyMac(md *macData, content, password []byte) error {
+	var h func() hash.Hash
+	switch alg := md.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		h = sha1.New
+	case alg.Equal(oidSHA256):
+		h = sha256.New
+	default:
+		return fmt.Errorf("keyio: unsupported PKCS#12 MAC algorithm %v", alg)
+	}
+	key := pkcs12KDF(h, password, md.MacSalt, md.Iterations, 3, h().Size())
+	mac := hmac.New(h, key)
+	mac.Write(content)
+	if !hmac.Equal(mac.Sum(nil), md.Mac.Digest) {
+		return ErrDecrypt
+	}
+	return nil
+}
+
+// pbeDecrypt decrypts data encrypted with a password based scheme. PBES2 derives
+// its key from the password bytes, the PKCS#12 scheme from their BMPString form.
+func pbeDecrypt(alg *pbeAlgorithm, data []byte, password string, bmpPassword []byte) ([]byte, error) {
+	var (
+		block cipher.Block
+		iv    []byte
+		err   error
+	)
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3DES):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("keyio: invalid PKCS#12 encryption parameters: %v", err)
+		}
+		key := pkcs12KDF(sha1.New, bmpPassword, params.Salt, params.Iterations, 1, 24)
+		iv = pkcs12KDF(sha1.New, bmpPassword, params.Salt, params.Iterations, 2, 8)
+		block, err = des.NewTripleDESCipher(key)
+	case alg.Algorithm.Equal(oidPBES2):
+		block, iv, err = pbes2Cipher(alg, []byte(password))
+	default:
+		return nil, fmt.Errorf("keyio: unsupported PKCS#12 encryption %v", alg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("keyio: invalid PKCS#12 encrypted data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// A wrong password shows up as bad padding if the file has no MAC.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrDecrypt
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+func pbes2Cipher(alg *pbeAlgorithm, password []byte) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, fmt.Errorf("keyio: invalid PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("keyio: unsupported PBES2 key derivation %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("keyio: invalid PBKDF2 parameters: %v", err)
+	}
+	h := sha1.New
+	switch prf := kdf.PRF.Algorithm; {
+	case len(prf) == 0 || prf.Equal(oidHMACWithSHA1):
+	case prf.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	default:
+		return nil, nil, fmt.Errorf("keyio: unsupported PBKDF2 function %v", prf)
+	}
+	var keyLen int
+	switch enc := params.EncryptionScheme.Algorithm; {
+	case enc.Equal(oidAES128CBC):
+		keyLen = 16
+	case enc.Equal(oidAES192CBC):
+		keyLen = 24
+	case enc.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, nil, fmt.Errorf("keyio: unsupported PBES2 encryption %v", enc)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("keyio: invalid PBES2 parameters: %v", err)
+	}
+	block, err := aes.NewCipher(pbkdf2.Key(password, kdf.Salt, kdf.Iterations, keyLen, h))
+	return block, iv, err
+}
+
+// pkcs12KDF derives key material from a BMPString password as specified in
+// RFC 7292, appendix B.2. The id selects key (1), IV (2) or MAC key (3) material.
+func pkcs12KDF(h func() hash.Hash, password, salt []byte, iterations int, id byte, size int) []byte {
+	v := h().BlockSize()
+	D := bytes.Repeat([]byte{id}, v)
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		n := v * ((len(b) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	I := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		d := h()
+		d.Write(D)
+		d.Write(I)
+		A := d.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			d.Reset()
+			d.Write(A)
+			A = d.Sum(A[:0])
+		}
+		out = append(out, A...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v) for every v byte block of I.
+		B := new(big.Int).SetBytes(fill(A)[:v])
+		B.Add(B, big.NewInt(1))
+		mod := new(big.Int).Lsh(big.NewInt(1), uint(8*v))
+		for j := 0; j < len(I); j += v {
+			Ij := new(big.Int).SetBytes(I[j : j+v])
+			Ij.Add(Ij, B)
+			Ij.Mod(Ij, mod)
+			b := Ij.Bytes()
+			copy(I[j:j+v], make([]byte, v-len(b)))
+			copy(I[j+v-len(b):j+v], b)
+		}
+	}
+	return out[:size]
+}
+
+// bmpString encodes the password as a null terminated big endian UTF-16 string.
+func bmpString(s string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0)
+}
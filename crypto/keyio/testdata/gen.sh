@@ -0,0 +1,38 @@
+#!/bin/bash
+# Generates the account keys of the tests the way the console's
+# get_account.sh and get_gm_account.sh export them: a PKCS#8 PEM key and,
+# with -p, a PKCS#12 file protected by the password 123456.
+#
+#   account.pem, account.p12     secp256k1 account (OpenSSL 3 defaults)
+#   account_legacy.p12           the same key exported like OpenSSL 1.1 does
+#   account_sec1.pem             secp256k1 key as written by ecparam -genkey
+#   gm_account.pem, gm_account.p12  sm2 account of a guomi chain
+#   p256.pem, p256.p12           a key on a curve FISCO BCOS doesn't use
+#
+# keys.txt lists the private key of every file for the tests to check.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+export_p12() {
+    openssl pkcs12 -export -name key -nocerts -inkey "$1.pem" -out "$1.p12" -passout pass:123456 "${@:2}" 2>/dev/null
+}
+
+openssl ecparam -out "$tmp/secp256k1.param" -name secp256k1
+openssl genpkey -paramfile "$tmp/secp256k1.param" -out account.pem
+export_p12 account
+openssl pkcs12 -export -name key -nocerts -inkey account.pem -out account_legacy.p12 -passout pass:123456 \
+    -keypbe PBE-SHA1-3DES -certpbe PBE-SHA1-3DES -macalg sha1 2>/dev/null
+openssl ecparam -name secp256k1 -genkey -out account_sec1.pem
+
+openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:SM2 -out gm_account.pem
+export_p12 gm_account
+
+openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out p256.pem
+export_p12 p256
+
+for f in account account_sec1 gm_account p256; do
+    d=$(openssl pkey -in "$f.pem" -text -noout | awk '/priv:/{p=1;next} /pub:/{p=0} p' | tr -d ' :\n')
+    echo "$f $(printf '%64s' "$d" | tr ' ' 0)"
+done > keys.txt
@@ -0,0 +1,159 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+const (
+	// defaultReceiptTimeout bounds the wait of SendTransactionAsync for a receipt.
+	defaultReceiptTimeout = 10 * time.Minute
+
+	// receiptPollInterval is how often receipts are polled for if the node can't
+	// push them.
+	receiptPollInterval = time.Second
+)
+
+// ErrReceiptTimeout is passed to the callback of SendTransactionAsync if no
+// receipt arrived within the receipt timeout. The transaction may still be
+// committed later.
+var ErrReceiptTimeout = errors.New("timeout waiting for transaction receipt")
+
+// SetReceiptTimeout changes how long SendTransactionAsync waits for a receipt.
+// A timeout of 0 restores the default of 10 minutes.
+func (ec *Client) SetReceiptTimeout(timeout time.Duration) {
+	if timeout == 0 {
+		timeout = defaultReceiptTimeout
+	}
+	atomic.StoreInt64(&ec.receiptTimeout, int64(timeout))
+}
+
+// SendTransactionAsync sends a transaction to the group and calls callback with
+// its receipt once it is committed. A transaction signed for a group is sent to
+// that group, groupId must be 0 or the same group. Over the channel protocol the node pushes the
+// receipt (TYPE_TX_COMMITTED), on other transports it is polled for.
+//
+// callback is called exactly once, on a goroutine of its own: with the receipt,
+// or with the error which ended sending or waiting. Those include ErrReceiptTimeout,
+// rpc.ErrConnectionLost and ErrClientClosed, after which the transaction may still
+// be committed, as well as the error of ctx, which bounds both sending and waiting.
+func (ec *Client) SendTransactionAsync(ctx context.Context, groupId uint64, tx *types.Transaction, callback func(*types.Receipt, error)) {
+	groupId, err := ec.txGroup(ctx, "sendRawTransaction", groupId, tx)
+	go func() {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+		callback(ec.sendAndWaitReceipt(ctx, groupId, tx))
+	}()
+}
+
+func (ec *Client) sendAndWaitReceipt(parent context.Context, groupId uint64, tx *types.Transaction) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(parent, time.Duration(atomic.LoadInt64(&ec.receiptTimeout)))
+	defer cancel()
+
+	receipt, err := ec.sendAwaitReceipt(ctx, groupId, tx)
+	if err != nil && err == ctx.Err() && parent.Err() == nil {
+		err = ErrReceiptTimeout
+	}
+	return receipt, err
+}
+
+func (ec *Client) sendAwaitReceipt(ctx context.Context, groupId uint64, tx *types.Transaction) (*types.Receipt, error) {
+	data, err := encodeTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.validateArgs("sendRawTransaction", []interface{}{groupId}); err != nil {
+		return nil, err
+	}
+	wait, err := ec.c.CallAwaitPush(ctx, nil, "sendRawTransaction", groupId, data)
+	if err == rpc.ErrNotificationsUnsupported {
+		if err := ec.call(ctx, nil, "sendRawTransaction", groupId, data); err != nil {
+			return nil, err
+		}
+		return ec.pollReceipt(ctx, groupId, tx.Hash())
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	body, err := wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	receipt, raw, err := decodeReceiptPush(body)
+	if err == nil && ec.rawResponses {
+		receipt.Raw = raw
+	}
+	return receipt, err
+}
+
+// pollReceipt polls for the receipt of a transaction until it is available, ctx
+// is done or the client is closed. Failed polls are repeated.
+func (ec *Client) pollReceipt(ctx context.Context, groupId uint64, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if receipt, err := ec.TransactionReceipt(ctx, groupId, hash); err == nil && receipt != nil {
+			return receipt, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ec.closeCtx.Done():
+			return nil, ErrClientClosed
+		}
+	}
+}
+
+// decodeReceiptPush decodes the receipt pushed by the node, which is either the
+// receipt itself or wrapped into a JSON-RPC response. raw is the receipt's part
+// of the body.
+func decodeReceiptPush(body []byte) (receipt *types.Receipt, raw json.RawMessage, err error) {
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, err
+	}
+	if resp.Error != nil {
+		return nil, nil, &Error{Code: resp.Error.Code, Message: resp.Error.Message, Err: codeErrors[resp.Error.Code]}
+	}
+	if len(resp.Result) > 0 {
+		body = resp.Result
+	}
+	receipt = new(types.Receipt)
+	if err := json.Unmarshal(body, receipt); err != nil {
+		return nil, nil, err
+	}
+	return receipt, body, nil
+}
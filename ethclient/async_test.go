@@ -0,0 +1,62 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestSendTransactionAsyncTimeout waits for receipts which never come while the
+// receipt timeout changes, checking that every wait ends with ErrReceiptTimeout.
+func TestSendTransactionAsyncTimeout(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("sendRawTransaction", common.Hash{}.Hex())
+	client := node.Client()
+	client.SetReceiptTimeout(50 * time.Millisecond)
+
+	const sends = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, sends)
+	for i := 0; i < sends; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client.SetReceiptTimeout(time.Duration(50+i) * time.Millisecond)
+		}(i)
+		client.SendTransactionAsync(context.Background(), 0, newGroupTx(1), func(_ *types.Receipt, err error) { errs <- err })
+	}
+	wg.Wait()
+	for i := 0; i < sends; i++ {
+		select {
+		case err := <-errs:
+			if err != ethclient.ErrReceiptTimeout {
+				t.Errorf("got error %v, want ErrReceiptTimeout", err)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("receipt wait didn't time out")
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// BatchError is returned by the typed batch methods if some, but not necessarily
+// all, elements of a batch failed. It holds one entry per requested element, nil
+// for the elements which were retrieved successfully.
+type BatchError []error
+
+func (e BatchError) Error() string {
+	var failed int
+	var first error
+	for _, err := range e {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d batch elements failed, first error: %v", failed, len(e), first)
+}
+
+// Batch sends all given requests as a single batch and waits for the server to
+// return a response for all of them. It only returns I/O errors, request specific
+// errors are reported through the Error field of the corresponding element.
+// Elements with malformed arguments aren't sent, their Error is a
+// *ValidationError.
+func (ec *Client) Batch(ctx context.Context, elems []rpc.BatchElem) error {
+	if ec.closed() {
+		return ErrClientClosed
+	}
+	ctx, cancel := ec.withRequestTimeout(ctx)
+	defer cancel()
+
+	valid := ec.validateBatch(elems)
+	if len(valid) == 0 {
+		return nil
+	}
+	send := elems
+	if len(valid) < len(elems) {
+		send = make([]rpc.BatchElem, len(valid))
+		for j, i := range valid {
+			send[j] = elems[i]
+		}
+	}
+	var err error
+	if ec.pool != nil {
+		err = ec.pool.batch(ctx, send)
+	} else {
+		err = ec.c.BatchCallContext(ctx, send)
+	}
+	if len(send) < len(elems) {
+		for j, i := range valid {
+			elems[i] = send[j]
+		}
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return ec.closedErr(err)
+}
+
+// BatchBlockByNumber retrieves the blocks with the given numbers in a single round
+// trip. The returned slice is aligned with numbers. Blocks which could not be
+// retrieved are left nil and their failure (fiscobcos.NotFound for missing blocks)
+// is reported in the accompanying BatchError.
+func (ec *Client) BatchBlockByNumber(ctx context.Context, groupId uint64, numbers []*big.Int) ([]*types.Block, error) {
+	group := ec.group(ctx, groupId)
+
+	raws := make([]json.RawMessage, len(numbers))
+	elems := make([]rpc.BatchElem, len(numbers))
+	for i, number := range numbers {
+		arg, err := blockNumberArg("getBlockByNumber", number)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = rpc.BatchElem{
+			Method: "getBlockByNumber",
+			Args:   []interface{}{group, arg, true},
+			Result: &raws[i],
+		}
+	}
+	if err := ec.Batch(ctx, elems); err != nil {
+		return nil, err
+	}
+	var (
+		blocks = make([]*types.Block, len(numbers))
+		errs   = make(BatchError, len(numbers))
+		failed bool
+	)
+	for i, elem := range elems {
+		errs[i] = decodeBatchResult(elem, raws[i], &blocks[i])
+		if errs[i] != nil {
+			blocks[i], failed = nil, true
+		} else if ec.rawResponses {
+			retainRaw(&blocks[i], raws[i])
+		}
+	}
+	if failed {
+		return blocks, errs
+	}
+	return blocks, nil
+}
+
+// decodeBatchResult unmarshals the raw result of a batch element into result,
+// mapping empty responses to fiscobcos.NotFound.
+func decodeBatchResult(elem rpc.BatchElem, raw json.RawMessage, result interface{}) error {
+	switch {
+	case elem.Error == rpc.ErrNoResult:
+		return fiscobcos.NotFound
+	case elem.Error != nil:
+		return wrapError(elem.Error)
+	case isEmptyResult(raw):
+		return fiscobcos.NotFound
+	}
+	return json.Unmarshal(raw, result)
+}
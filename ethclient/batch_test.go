@@ -0,0 +1,151 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// TestBatchBlockByNumber checks that the blocks of a batch are aligned with the
+// requested numbers, and that the failures of single blocks are reported per
+// element.
+func TestBatchBlockByNumber(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	// Block 2 doesn't exist and block 3 fails.
+	node.Handle("getBlockByNumber", func(params []json.RawMessage) (interface{}, error) {
+		var number string
+		if err := json.Unmarshal(params[1], &number); err != nil {
+			return nil, err
+		}
+		switch number {
+		case "0x2":
+			return nil, nil
+		case "0x3":
+			return nil, &ethclienttest.Error{Code: -40004, Message: "BlockNumber does not exist"}
+		}
+		return map[string]interface{}{"number": number, "transactions": []interface{}{}}, nil
+	})
+	tests := []struct {
+		numbers []int64
+		want    []error // per block, nil for the retrieved ones
+	}{
+		{numbers: []int64{1, 4}, want: nil},
+		{numbers: []int64{4, 1, 5}, want: nil},
+		{numbers: []int64{1, 2, 3, 4}, want: []error{nil, fiscobcos.NotFound, ethclient.ErrBlockNumberNotExist, nil}},
+		{numbers: []int64{2}, want: []error{fiscobcos.NotFound}},
+		{numbers: []int64{}, want: nil},
+	}
+	for _, test := range tests {
+		numbers := make([]*big.Int, len(test.numbers))
+		for i, n := range test.numbers {
+			numbers[i] = big.NewInt(n)
+		}
+		blocks, err := client.BatchBlockByNumber(context.Background(), 1, numbers)
+		if len(blocks) != len(numbers) {
+			t.Errorf("%v: got %d blocks, want %d", test.numbers, len(blocks), len(numbers))
+			continue
+		}
+		var errs ethclient.BatchError
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%v: unexpected error %v", test.numbers, err)
+				continue
+			}
+		} else if errs, _ = err.(ethclient.BatchError); len(errs) != len(numbers) {
+			t.Errorf("%v: got error %v, want a BatchError of %d elements", test.numbers, err, len(numbers))
+			continue
+		}
+		for i, block := range blocks {
+			var want error
+			if test.want != nil {
+				want = test.want[i]
+			}
+			var have error
+			if errs != nil {
+				have = errs[i]
+				if e, ok := have.(*ethclient.Error); ok {
+					have = e.Err
+				}
+			}
+			if have != want {
+				t.Errorf("%v: block %d error %v, want %v", test.numbers, numbers[i], have, want)
+			}
+			switch {
+			case want != nil && block != nil:
+				t.Errorf("%v: got block %d despite error", test.numbers, numbers[i])
+			case want == nil && (block == nil || block.Number != "0x"+numbers[i].Text(16)):
+				t.Errorf("%v: got block %+v at %d", test.numbers, block, numbers[i])
+			}
+		}
+	}
+	if _, err := client.BatchBlockByNumber(context.Background(), 1, []*big.Int{big.NewInt(-3)}); err == nil {
+		t.Error("BatchBlockByNumber accepted an invalid block number")
+	}
+}
+
+// TestBatchValidation checks that the malformed elements of a batch fail with a
+// *ValidationError without being sent, and that the others are.
+func TestBatchValidation(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	node.Respond("getBlockNumber", "0x10")
+	node.RespondError("getPbftView", -32601, "method not found")
+
+	var numbers [3]string
+	elems := []rpc.BatchElem{
+		{Method: "getBlockNumber", Args: []interface{}{uint64(1)}, Result: &numbers[0]},
+		{Method: "getBlockNumber", Args: []interface{}{uint64(0)}, Result: &numbers[1]},
+		{Method: "getTransactionByHash", Args: []interface{}{uint64(1), "0x12"}},
+		{Method: "getPbftView", Args: []interface{}{uint64(1)}},
+		{Method: "getBlockNumber", Args: []interface{}{uint64(2)}, Result: &numbers[2]},
+	}
+	if err := client.Batch(context.Background(), elems); err != nil {
+		t.Fatalf("Batch error: %v", err)
+	}
+	for _, i := range []int{1, 2} {
+		if _, ok := elems[i].Error.(*ethclient.ValidationError); !ok {
+			t.Errorf("element %d: got error %v, want a *ValidationError", i, elems[i].Error)
+		}
+	}
+	if elems[0].Error != nil || elems[4].Error != nil || numbers != [3]string{"0x10", "", "0x10"} {
+		t.Errorf("valid elements: errors %v and %v, results %q", elems[0].Error, elems[4].Error, numbers)
+	}
+	if elems[3].Error == nil {
+		t.Error("the error of an element wasn't reported")
+	}
+	if calls := node.Calls(); len(calls) != 3 {
+		t.Errorf("node received %d requests, want the 3 valid ones", len(calls))
+	}
+
+	// A batch of invalid elements only isn't sent at all.
+	node.Reset()
+	if err := client.Batch(context.Background(), elems[1:3]); err != nil || len(node.Calls()) != 0 {
+		t.Errorf("invalid batch: error %v, %d requests sent", err, len(node.Calls()))
+	}
+}
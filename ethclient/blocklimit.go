@@ -0,0 +1,201 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBlockLimitOffset is the number of blocks a transaction stays valid for,
+	// the node's default as well.
+	defaultBlockLimitOffset = 600
+
+	// blockHeightTTL is how long a fetched chain height is reused for.
+	blockHeightTTL = time.Second
+
+	// pushedHeightTTL is how long block notifications are trusted to keep the
+	// height current after the last one. The node only seals blocks carrying
+	// transactions, so a quiet group falls back to fetching its height, but a
+	// connection lost without notice can't keep a stale height alive.
+	pushedHeightTTL = 30 * time.Second
+)
+
+// chainHeight caches the chain height of a group. Refreshes are serialized by
+// fetch, so concurrent callers wait for a single request, while mu only guards
+// the cached values so that block notifications never wait on a request.
+type chainHeight struct {
+	fetch  sync.Mutex
+	listen sync.Once
+
+	mu      sync.Mutex
+	number  uint64
+	updated time.Time
+	pushed  time.Time // last block notification, see pushing
+	tracked bool      // whether the head tracker keeps the height current
+	cancel  func()    // stops the block notifications
+
+	listenErr error // failure to register for block notifications
+}
+
+// SetBlockLimitOffset changes the number of blocks past the current height that
+// GetBlockLimit allows transactions to be packed in. A value of 0 restores the
+// default of 600.
+func (ec *Client) SetBlockLimitOffset(offset uint64) {
+	if offset == 0 {
+		offset = defaultBlockLimitOffset
+	}
+	ec.heightMu.Lock()
+	ec.blockLimitOffset = offset
+	ec.heightMu.Unlock()
+}
+
+// GetBlockLimit returns the block limit for a transaction sent now to the group:
+// the current block number plus the block limit offset. The chain height is cached
+// per group for a short time, and kept current by block notifications if the
+// client is connected through the channel protocol, so sending many transactions
+// does not cost a BlockNumber request each.
+func (ec *Client) GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error) {
+	groupId = ec.group(ctx, groupId)
+	height := ec.chainHeight(groupId)
+
+	ec.heightMu.Lock()
+	offset := ec.blockLimitOffset
+	ec.heightMu.Unlock()
+
+	if number, ok := height.current(); ok {
+		return new(big.Int).SetUint64(number + offset), nil
+	}
+	height.fetch.Lock()
+	defer height.fetch.Unlock()
+
+	// Another caller may have refreshed the height while we waited.
+	if number, ok := height.current(); ok {
+		return new(big.Int).SetUint64(number + offset), nil
+	}
+	number, err := ec.BlockNumber(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	ec.observeHeight(groupId, height, number.Uint64(), false)
+	current, _ := height.latest()
+	return new(big.Int).SetUint64(current + offset), nil
+}
+
+// chainHeight returns the cached chain height of a group, registering for its
+// block notifications the first time. Notifications are best effort, falling
+// back to polling, the failure to register is kept in listenErr.
+func (ec *Client) chainHeight(groupId uint64) *chainHeight {
+	ec.heightMu.Lock()
+	if ec.heights == nil {
+		ec.heights = make(map[uint64]*chainHeight)
+	}
+	height := ec.heights[groupId]
+	if height == nil {
+		height = new(chainHeight)
+		ec.heights[groupId] = height
+	}
+	ec.heightMu.Unlock()
+
+	height.listen.Do(func() {
+		cancel, err := ec.c.ListenBlockNumber(groupId, func(number uint64) {
+			ec.observeHeight(groupId, height, number, true)
+		})
+		height.mu.Lock()
+		height.cancel, height.listenErr = cancel, err
+		height.mu.Unlock()
+	})
+	return height
+}
+
+// current returns the cached height, if it is still fresh. Heights kept
+// current by the head tracker or by recent block notifications stay fresh.
+func (h *chainHeight) current() (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if h.updated.IsZero() || (!h.pushing(now) && !h.tracked && now.Sub(h.updated) > blockHeightTTL) {
+		return 0, false
+	}
+	return h.number, true
+}
+
+// pushing reports whether block notifications keep the height current, that is
+// whether one arrived within pushedHeightTTL. h.mu must be held.
+func (h *chainHeight) pushing(now time.Time) bool {
+	return !h.pushed.IsZero() && now.Sub(h.pushed) <= pushedHeightTTL
+}
+
+// latest returns the cached height regardless of its age. ok is false while no
+// height is known.
+func (h *chainHeight) latest() (number uint64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.number, !h.updated.IsZero()
+}
+
+// update records the chain height, which never moves backwards. It reports
+// whether the height advanced.
+func (h *chainHeight) update(number uint64, pushed bool) bool {
+	advanced := number > h.number || h.updated.IsZero()
+	if number > h.number {
+		h.number = number
+	}
+	h.updated = time.Now()
+	if pushed {
+		h.pushed = h.updated
+	}
+	return advanced
+}
+
+// observeHeight records a block number of a group, either announced by the
+// node (pushed) or fetched, and tells the head tracker if the height advanced.
+func (ec *Client) observeHeight(groupId uint64, h *chainHeight, number uint64, pushed bool) bool {
+	h.mu.Lock()
+	advanced := h.update(number, pushed)
+	number = h.number
+	h.mu.Unlock()
+
+	if advanced {
+		if t := ec.headTracker(); t != nil {
+			t.changed(groupId, number)
+		}
+	}
+	return advanced
+}
+
+// stopHeights stops the block notifications of the cached chain heights.
+func (ec *Client) stopHeights() {
+	ec.heightMu.Lock()
+	defer ec.heightMu.Unlock()
+
+	for _, height := range ec.heights {
+		height.mu.Lock()
+		cancel := height.cancel
+		height.cancel = nil
+		height.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+		}
+	}
+	ec.heights = nil
+}
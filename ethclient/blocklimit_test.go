@@ -0,0 +1,101 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestGetBlockLimitConcurrent sends the block limit requests of 1000 concurrent
+// transactions, which must share a handful of BlockNumber requests.
+func TestGetBlockLimitConcurrent(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	client := node.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit, err := client.GetBlockLimit(context.Background(), 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if limit.Uint64() != 0x10+600 {
+				t.Errorf("got block limit %v, want %d", limit, 0x10+600)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(node.CallsTo("getBlockNumber")); n > 5 {
+		t.Errorf("requested the block number %d times", n)
+	}
+}
+
+// TestGetBlockLimitPushedExpires checks that a height kept current by block
+// notifications is fetched again once the notifications stop.
+func TestGetBlockLimitPushedExpires(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	client := node.ChannelClient()
+
+	limit := func() uint64 {
+		t.Helper()
+		limit, err := client.GetBlockLimit(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("GetBlockLimit error: %v", err)
+		}
+		return limit.Uint64() - 600
+	}
+	if number := limit(); number != 0x10 {
+		t.Fatalf("got height %d, want %d", number, 0x10)
+	}
+	node.PushBlockNumber(1, 0x20)
+	for deadline := time.Now().Add(5 * time.Second); limit() != 0x20; {
+		if time.Now().After(deadline) {
+			t.Fatal("pushed block number not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Pushed heights stay current past the TTL of fetched ones.
+	node.Reset()
+	node.Respond("getBlockNumber", "0x30")
+	ethclient.AgeHeight(client, 1, 5*time.Second)
+	if number := limit(); number != 0x20 {
+		t.Errorf("got height %d after 5s, want the pushed %d", number, 0x20)
+	}
+	if n := len(node.CallsTo("getBlockNumber")); n != 0 {
+		t.Errorf("requested the block number %d times while notified", n)
+	}
+
+	// Without notifications for long, the height is fetched again.
+	ethclient.AgeHeight(client, 1, time.Minute)
+	if number := limit(); number != 0x30 {
+		t.Errorf("got height %d after a minute, want the fetched %d", number, 0x30)
+	}
+}
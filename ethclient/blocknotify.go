@@ -0,0 +1,133 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// DialChannel connects to the channel port of a node, see rpc.DialChannel, and
+// registers for the block number notifications (TYPE_TX_BLOCKNUM) of the given
+// groups right away, so that LatestBlockNumber and GetBlockLimit never need to
+// poll the node for them.
+func DialChannel(endpoint string, caCert, sdkCert, sdkKey string, groupIds ...uint64) (*Client, error) {
+	c, err := rpc.DialChannel(endpoint, caCert, sdkCert, sdkKey)
+	if err != nil {
+		return nil, err
+	}
+	ec := NewClient(c)
+	for _, groupId := range groupIds {
+		height := ec.chainHeight(ec.group(context.Background(), groupId))
+		height.mu.Lock()
+		err := height.listenErr
+		height.mu.Unlock()
+		if err != nil {
+			ec.Close()
+			return nil, err
+		}
+	}
+	return ec, nil
+}
+
+// LatestBlockNumber returns the latest block number of a group known to the
+// client without asking the node. Over the channel protocol it is kept current
+// by the block notifications of the node, otherwise it's the height fetched by
+// the last GetBlockLimit. ok is false while no number is known yet.
+func (ec *Client) LatestBlockNumber(groupId uint64) (number uint64, ok bool) {
+	return ec.chainHeight(ec.group(context.Background(), groupId)).latest()
+}
+
+// SubscribeBlockNumber subscribes to the numbers of the blocks committed in a
+// group, as pushed by the node. Numbers only ever increase: repeated notifications
+// are dropped, and a consumer falling behind only receives the latest number.
+// The subscription is re-registered if the client reconnects and ends, closing
+// its error channel, when the client is closed.
+//
+// Subscriptions need the channel transport, ErrSubscriptionUnsupported is returned
+// on other transports unless the group is tracked by TrackHeads, whose polling
+// then serves the subscription.
+func (ec *Client) SubscribeBlockNumber(groupId uint64, ch chan<- uint64) (fiscobcos.Subscription, error) {
+	groupId = ec.group(context.Background(), groupId)
+
+	// Keep the cached height current for as long as the client lives.
+	ec.chainHeight(groupId)
+
+	var (
+		mu     sync.Mutex
+		latest uint64
+		wake   = make(chan struct{}, 1)
+	)
+	notify := func(number uint64) {
+		mu.Lock()
+		if number > latest {
+			latest = number
+		}
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	cancel, err := ec.c.ListenBlockNumber(groupId, notify)
+	if err == rpc.ErrNotificationsUnsupported {
+		t := ec.headTracker()
+		if t == nil || !t.tracks(groupId) {
+			return nil, ErrSubscriptionUnsupported
+		}
+		cancel = t.listen(groupId, func(ev HeadEvent) { notify(ev.Number) })
+	} else if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(unsub <-chan struct{}) error {
+		defer cancel()
+
+		current := func() uint64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return latest
+		}
+		var last uint64
+		for {
+			select {
+			case <-wake:
+			case <-unsub:
+				return nil
+			case <-ec.closeCtx.Done():
+				return nil
+			}
+			// Deliver the latest number, even if it changes while the
+			// consumer is busy.
+			for number := current(); number > last; {
+				select {
+				case ch <- number:
+					last = number
+				case <-wake:
+					number = current()
+				case <-unsub:
+					return nil
+				case <-ec.closeCtx.Done():
+					return nil
+				}
+			}
+		}
+	}), nil
+}
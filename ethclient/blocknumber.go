@@ -0,0 +1,86 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// decimalBlockNumberMethods lists the methods taking the block number as a
+// decimal string. All other methods take a hex quantity.
+var decimalBlockNumberMethods = map[string]bool{
+	"getBatchReceiptsByBlockNumberAndRange": true,
+}
+
+// Tags passed as block number to the methods taking a *big.Int, as
+// big.NewInt(LatestBlock) or rpc.LatestBlockNumber.Big().
+const (
+	EarliestBlock = int64(rpc.EarliestBlockNumber) // the genesis block, block 0
+	LatestBlock   = int64(rpc.LatestBlockNumber)   // the latest block, like nil
+	PendingBlock  = int64(rpc.PendingBlockNumber)  // the latest block, FISCO BCOS having no pending state
+)
+
+// isLatestBlock reports whether number requests the latest block: nil, or the
+// rpc.LatestBlockNumber or rpc.PendingBlockNumber tag, FISCO BCOS having no
+// pending state.
+func isLatestBlock(number *big.Int) bool {
+	if number == nil {
+		return true
+	}
+	if !number.IsInt64() {
+		return false
+	}
+	bn := rpc.BlockNumber(number.Int64())
+	return bn == rpc.LatestBlockNumber || bn == rpc.PendingBlockNumber
+}
+
+// blockNumberArg encodes a block number argument of method. The latest block,
+// see isLatestBlock, is requested as "latest", other block numbers as the
+// method expects them. Negative numbers other than the tags, and numbers
+// beyond 64 bits, fail with a *ValidationError.
+func blockNumberArg(method string, number *big.Int) (string, error) {
+	if isLatestBlock(number) {
+		return "latest", nil
+	}
+	if err := checkBlockNumber(method, number); err != nil {
+		return "", err
+	}
+	return blockNumberArgUint64(method, number.Uint64()), nil
+}
+
+// checkBlockNumber checks that number is a block number rather than a tag.
+func checkBlockNumber(method string, number *big.Int) error {
+	switch {
+	case number.Sign() < 0:
+		return &ValidationError{Method: method, Param: "block number", Value: number, Reason: "negative and not a tag"}
+	case !number.IsUint64():
+		return &ValidationError{Method: method, Param: "block number", Value: number, Reason: "exceeds 64 bits"}
+	}
+	return nil
+}
+
+// blockNumberArgUint64 encodes a block number argument of method.
+func blockNumberArgUint64(method string, number uint64) string {
+	if decimalBlockNumberMethods[method] {
+		return strconv.FormatUint(number, 10)
+	}
+	return hexutil.EncodeUint64(number)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// TestBlockNumberArgs checks how each method taking a block number sends it:
+// the tags, and numbers as hex or decimal depending on the method.
+func TestBlockNumberArgs(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getClientVersion", &types.ClientVersion{Version: "3.0.0", SupportedVersion: "3.0.0"})
+	node.Respond("getBlockNumber", "0x64")
+	node.Respond("getBlockByNumber", map[string]interface{}{"number": "0x64", "transactions": []interface{}{}})
+	node.Respond("getBatchReceiptsByBlockNumberAndRange", map[string]interface{}{"transactionReceipts": []interface{}{}})
+	node.Respond("call", map[string]string{"currentBlockNumber": "0x64", "status": "0x0", "output": "0x01"})
+	client := node.Client()
+	ctx := context.Background()
+
+	methods := []struct {
+		name   string // of the method sent
+		param  int    // index of the block number among the params
+		call   func(number *big.Int) error
+		hex    bool // whether numbers are sent as hex quantities
+		latest string
+	}{
+		{"getBlockByNumber", 1, func(n *big.Int) error { _, err := client.BlockByNumber(ctx, 1, n); return err }, true, `"latest"`},
+		{"getBlockByNumber", 1, func(n *big.Int) error { _, err := client.HeaderByNumber(ctx, 1, n); return err }, true, `"latest"`},
+		{"getBlockByNumber", 1, func(n *big.Int) error { _, err := client.BatchBlockByNumber(ctx, 1, []*big.Int{n}); return err }, true, `"latest"`},
+		{"getBatchReceiptsByBlockNumberAndRange", 1, func(n *big.Int) error { _, err := client.BlockReceipts(ctx, 1, n); return err }, false, `"100"`},
+		{"call", 2, func(n *big.Int) error {
+			_, err := client.CallContract(ctx, fiscobcos.CallMsg{Msg: fiscobcos.CallEthMsg{To: &common.Address{1}}}, n)
+			return err
+		}, true, ""},
+	}
+	tests := []struct {
+		number  *big.Int
+		hex     string // argument sent to the methods taking hex quantities
+		decimal string // argument sent to the other ones
+		invalid bool
+	}{
+		{number: nil, hex: "latest"},
+		{number: rpc.LatestBlockNumber.Big(), hex: "latest"},
+		{number: rpc.PendingBlockNumber.Big(), hex: "latest"},
+		{number: rpc.EarliestBlockNumber.Big(), hex: `"0x0"`, decimal: `"0"`},
+		{number: big.NewInt(ethclient.EarliestBlock), hex: `"0x0"`, decimal: `"0"`},
+		{number: big.NewInt(100), hex: `"0x64"`, decimal: `"100"`},
+		{number: big.NewInt(-5), invalid: true},
+		{number: new(big.Int).Lsh(big.NewInt(1), 64), invalid: true},
+	}
+	for _, method := range methods {
+		for _, test := range tests {
+			node.Reset()
+			err := method.call(test.number)
+			if test.invalid {
+				if e, ok := err.(*ethclient.ValidationError); !ok || e.Param != "block number" {
+					t.Errorf("%s(%v): got error %v, want a *ValidationError", method.name, test.number, err)
+				}
+				if calls := node.CallsTo(method.name); len(calls) != 0 {
+					t.Errorf("%s(%v): sent an invalid block number", method.name, test.number)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s(%v): %v", method.name, test.number, err)
+				continue
+			}
+			calls := node.CallsTo(method.name)
+			if len(calls) != 1 {
+				t.Errorf("%s(%v): sent %d times", method.name, test.number, len(calls))
+				continue
+			}
+			want := test.decimal
+			switch {
+			case test.hex == "latest":
+				want = method.latest
+			case method.hex:
+				want = test.hex
+			}
+			var have string
+			if params := calls[0].Params; method.param < len(params) {
+				have = string(params[method.param])
+			}
+			if have != want {
+				t.Errorf("%s(%v): sent block number %s, want %s", method.name, test.number, have, want)
+			}
+		}
+	}
+
+	// Block hashes are requested by hex quantity.
+	node.Reset()
+	node.Respond("getBlockHashByNumber", common.Hash{1}.Hex())
+	if _, err := client.BlockHashByNumber(ctx, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if calls := node.CallsTo("getBlockHashByNumber"); len(calls) != 1 || string(calls[0].Params[1]) != `"0x64"` {
+		t.Errorf("getBlockHashByNumber sent as %+v", calls)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+const (
+	// defaultBlockWindow is the number of blocks BlockRange and FollowBlocks
+	// fetch in one batch unless changed with SetBlockWindow.
+	defaultBlockWindow = 16
+
+	// followPollInterval is how often FollowBlocks polls the block number on
+	// transports without block number notifications.
+	followPollInterval = time.Second
+
+	// followMaxBackoff caps the wait of FollowBlocks between attempts while the
+	// node keeps failing, e.g. during a restart.
+	followMaxBackoff = 30 * time.Second
+)
+
+var errNegativeBlock = errors.New("negative block number")
+
+// SetBlockWindow sets the number of blocks BlockRange and FollowBlocks fetch in
+// one batch. Values below one reset it to the default.
+func (ec *Client) SetBlockWindow(n int) {
+	if n < 1 {
+		n = defaultBlockWindow
+	}
+	atomic.StoreInt32(&ec.blockWindow, int32(n))
+}
+
+// blockWindowSize returns the number of blocks to fetch in one batch.
+func (ec *Client) blockWindowSize() uint64 {
+	if n := atomic.LoadInt32(&ec.blockWindow); n > 0 {
+		return uint64(n)
+	}
+	return defaultBlockWindow
+}
+
+// BlockIterator walks a range of blocks in order, see BlockRange. It is used in
+// the style of sql.Rows:
+//
+//	it, err := client.BlockRange(ctx, groupId, from, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		block := it.Block()
+//		...
+//	}
+//	return it.Err()
+type BlockIterator struct {
+	ec      *Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	groupId uint64
+
+	next, to uint64         // next block to fetch and last block of the range
+	ended    bool           // whether all blocks of the range were fetched
+	buf      []*types.Block // fetched blocks not yet returned
+	block    *types.Block
+	err      error
+}
+
+// BlockRange returns an iterator over the blocks from and to, inclusive, of a
+// group. from defaults to the genesis block and to to the latest block. The
+// blocks are fetched in batches as the iterator advances, retrying transient
+// failures.
+func (ec *Client) BlockRange(ctx context.Context, groupId uint64, from, to *big.Int) (*BlockIterator, error) {
+	groupId = ec.group(ctx, groupId)
+
+	first, err := blockArg(from)
+	if err != nil {
+		return nil, err
+	}
+	var last uint64
+	if to != nil {
+		if last, err = blockArg(to); err != nil {
+			return nil, err
+		}
+	} else {
+		head, err := ec.BlockNumber(ctx, groupId)
+		if err != nil {
+			return nil, err
+		}
+		last = head.Uint64()
+	}
+	if first > last {
+		return nil, errInvalidRange
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &BlockIterator{ec: ec, ctx: ctx, cancel: cancel, groupId: groupId, next: first, to: last}, nil
+}
+
+// Next advances the iterator to the next block, fetching the next batch if
+// needed. It returns false at the end of the range, on failure and after Close.
+func (it *BlockIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.buf) == 0 {
+		if it.ended {
+			it.block = nil
+			return false
+		}
+		count := it.ec.blockWindowSize()
+		if remaining := it.to - it.next + 1; remaining != 0 && remaining < count {
+			count = remaining
+		}
+		blocks, err := it.ec.fetchBlocks(it.ctx, it.groupId, it.next, count)
+		if err != nil {
+			it.block, it.err = nil, err
+			return false
+		}
+		// Only the leading blocks may have been fetched, the next batch
+		// starts after them.
+		fetched := uint64(len(blocks))
+		if it.next+fetched-1 == it.to {
+			it.ended = true
+		}
+		it.next += fetched
+		it.buf = blocks
+	}
+	it.block, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Block returns the current block, nil before the first and after the last call
+// to Next.
+func (it *BlockIterator) Block() *types.Block {
+	return it.block
+}
+
+// Err returns the error which ended the iteration, nil if it ended at the end of
+// the range.
+func (it *BlockIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration, aborting a batch being fetched. It may be called
+// repeatedly and always returns nil.
+func (it *BlockIterator) Close() error {
+	it.cancel()
+	it.buf, it.block, it.ended = nil, nil, true
+	return nil
+}
+
+// FollowBlocks delivers the blocks of a group to ch in order, starting at from,
+// or at the latest block if from is nil, and keeps following the chain as new
+// blocks are committed. It runs until the subscription is unsubscribed, the
+// client is closed or ctx is done, in which case the error of ctx is reported by
+// the subscription.
+//
+// Over the channel transport the node's block number notifications tell when to
+// fetch the next blocks. Otherwise the head tracker does if it tracks the group,
+// see TrackHeads, and the block number is polled every second if it doesn't.
+// Transient failures, like the node restarting, are retried with backoff; other
+// failures end the subscription.
+func (ec *Client) FollowBlocks(ctx context.Context, groupId uint64, from *big.Int, ch chan<- *types.Block) (fiscobcos.Subscription, error) {
+	groupId = ec.group(ctx, groupId)
+
+	head, err := ec.BlockNumber(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	next := head.Uint64()
+	if from != nil {
+		if next, err = blockArg(from); err != nil {
+			return nil, err
+		}
+	}
+	// Prefer pushed block numbers, fall back to polling.
+	var (
+		numbers = make(chan uint64, 1)
+		pushed  fiscobcos.Subscription
+		poll    *time.Ticker
+	)
+	pushed, err = ec.SubscribeBlockNumber(groupId, numbers)
+	switch {
+	case err == ErrSubscriptionUnsupported:
+		numbers, poll = nil, time.NewTicker(followPollInterval)
+	case err != nil:
+		return nil, err
+	}
+	return event.NewSubscription(func(unsub <-chan struct{}) (err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if pushed != nil {
+			defer pushed.Unsubscribe()
+		} else {
+			defer poll.Stop()
+		}
+		defer func() {
+			if ec.closed() {
+				// Closing the client ends the subscription like unsubscribing.
+				err = nil
+			}
+		}()
+		go func() {
+			select {
+			case <-unsub:
+				cancel()
+			case <-ec.closeCtx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		latest, attempt := head.Uint64(), 0
+		for {
+			// Catch up with the latest known block.
+			var fetchErr error
+			for next <= latest {
+				count := ec.blockWindowSize()
+				if remaining := latest - next + 1; remaining < count {
+					count = remaining
+				}
+				var blocks []*types.Block
+				if blocks, fetchErr = ec.fetchBlocks(ctx, groupId, next, count); fetchErr != nil {
+					break
+				}
+				for _, block := range blocks {
+					select {
+					case ch <- block:
+					case <-unsub:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				next += uint64(len(blocks))
+				attempt = 0
+			}
+			if fetchErr != nil {
+				// Retry after a while.
+				if err := ec.followBackoff(ctx, unsub, attempt, fetchErr); err != nil {
+					return err
+				}
+				attempt++
+				continue
+			}
+			// Wait for the next block.
+			var pollErr error
+			select {
+			case number := <-numbers:
+				if number > latest {
+					latest = number
+				}
+			case <-tick(poll):
+				number, err := ec.BlockNumber(ctx, groupId)
+				if err != nil {
+					pollErr = err
+				} else if number.Uint64() > latest {
+					latest = number.Uint64()
+				}
+			case err := <-subErr(pushed):
+				// The notifications only end when the client is closed.
+				return err
+			case <-unsub:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if pollErr != nil {
+				if err := ec.followBackoff(ctx, unsub, attempt, pollErr); err != nil {
+					return err
+				}
+				attempt++
+			}
+		}
+	}), nil
+}
+
+// followBackoff waits before FollowBlocks retries after its attempt'th (zero
+// based) consecutive failure with err. It returns err if the failure isn't
+// transient, nil once the wait is over or the subscription was unsubscribed.
+// Missing blocks count as transient, a node may announce a block before serving
+// it.
+func (ec *Client) followBackoff(ctx context.Context, unsub <-chan struct{}, attempt int, err error) error {
+	select {
+	case <-unsub:
+		return nil
+	default:
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if cause := batchCause(err); cause != fiscobcos.NotFound && !errclass.IsRetryable(cause) {
+		return err
+	}
+	delay, _ := errclass.Backoff(ctx, attempt, followPollInterval, followMaxBackoff)
+	log.Warn("Following blocks failed, retrying", "attempt", attempt+1, "delay", delay, "err", err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-unsub:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchBlocks retrieves count blocks starting at from in one batch, repeating
+// the batch as the retry policy of the client, or DefaultRetryPolicy, allows.
+// If only some blocks could be fetched, the leading ones are returned.
+func (ec *Client) fetchBlocks(ctx context.Context, groupId, from, count uint64) ([]*types.Block, error) {
+	numbers := make([]*big.Int, count)
+	for i := range numbers {
+		numbers[i] = new(big.Int).SetUint64(from + uint64(i))
+	}
+	policy := ec.retry
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	for attempt := 0; ; attempt++ {
+		blocks, err := ec.BatchBlockByNumber(ctx, groupId, numbers)
+		if err == nil {
+			return blocks, nil
+		}
+		if n := leadingBlocks(blocks); n > 0 {
+			return blocks[:n], nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		delay, ok := policy.Retry("getBlockByNumber", attempt, batchCause(err))
+		if !ok {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// leadingBlocks returns the number of blocks fetched before the first missing.
+func leadingBlocks(blocks []*types.Block) int {
+	for i, block := range blocks {
+		if block == nil {
+			return i
+		}
+	}
+	return len(blocks)
+}
+
+// batchCause returns the first failure of a BatchError, err itself otherwise.
+func batchCause(err error) error {
+	if errs, ok := err.(BatchError); ok {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// blockArg converts a block number argument.
+func blockArg(number *big.Int) (uint64, error) {
+	if number == nil {
+		return 0, nil
+	}
+	if number.Sign() < 0 {
+		return 0, errNegativeBlock
+	}
+	return number.Uint64(), nil
+}
+
+// tick returns the channel of ticker, nil if there is none.
+func tick(ticker *time.Ticker) <-chan time.Time {
+	if ticker == nil {
+		return nil
+	}
+	return ticker.C
+}
+
+// subErr returns the error channel of sub, nil if there is none.
+func subErr(sub fiscobcos.Subscription) <-chan error {
+	if sub == nil {
+		return nil
+	}
+	return sub.Err()
+}
@@ -0,0 +1,271 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// growingChain serves the blocks of group 1 up to its head, which may move,
+// failing the fetches of some blocks a number of times first.
+type growingChain struct {
+	mu    sync.Mutex
+	head  uint64
+	fails map[uint64]int // block number to failures left
+}
+
+func serveGrowingChain(node *ethclienttest.FakeNode, head uint64) *growingChain {
+	c := &growingChain{head: head, fails: make(map[uint64]int)}
+	node.Handle("getBlockNumber", func([]json.RawMessage) (interface{}, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return hexutil.EncodeUint64(c.head), nil
+	})
+	node.Handle("getBlockByNumber", func(params []json.RawMessage) (interface{}, error) {
+		var arg string
+		if err := json.Unmarshal(params[1], &arg); err != nil {
+			return nil, err
+		}
+		number, err := hexutil.DecodeUint64(arg)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.fails[number] > 0 {
+			c.fails[number]--
+			return nil, &ethclienttest.Error{Code: -40011, Message: "over QPS limit"}
+		}
+		if number > c.head {
+			return nil, nil
+		}
+		return map[string]interface{}{"number": arg, "transactions": []interface{}{}}, nil
+	})
+	return c
+}
+
+func (c *growingChain) setHead(head uint64) {
+	c.mu.Lock()
+	c.head = head
+	c.mu.Unlock()
+}
+
+func (c *growingChain) fail(number uint64, times int) {
+	c.mu.Lock()
+	c.fails[number] = times
+	c.mu.Unlock()
+}
+
+// bigArg converts a block number argument of a test, -1 standing for nil.
+func bigArg(n int64) *big.Int {
+	if n == -1 {
+		return nil
+	}
+	return big.NewInt(n)
+}
+
+// TestBlockRange checks the blocks returned by BlockRange iterators, and that
+// each block is fetched once.
+func TestBlockRange(t *testing.T) {
+	tests := []struct {
+		window   int
+		head     uint64
+		from, to int64 // -1 for nil
+		first    uint64
+		last     uint64 // of the blocks returned, if any
+		err      bool   // of BlockRange
+		iterErr  bool   // of the iteration
+		fails    int    // failed fetches of block 5 before it is served
+	}{
+		{head: 5, from: -1, to: -1, first: 0, last: 5},
+		{window: 3, head: 20, from: 2, to: 9, first: 2, last: 9},
+		{window: 4, head: 20, from: 3, to: 3, first: 3, last: 3},
+		{window: 1, head: 20, from: 18, to: -1, first: 18, last: 20},
+		{window: 2, head: 8, from: 1, to: 8, first: 1, last: 8, fails: 2},
+		{head: 10, from: 4, to: 12, first: 4, last: 10, iterErr: true},
+		{window: 2, head: 8, from: 1, to: 8, first: 1, last: 4, fails: 10, iterErr: true},
+		{head: 20, from: 5, to: 4, err: true},
+		{head: 20, from: -3, to: 4, err: true},
+		{head: 20, from: 0, to: -3, err: true},
+	}
+	for i, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		chain := serveGrowingChain(node, test.head)
+		chain.fail(5, test.fails)
+		client := node.Client()
+		client.SetBlockWindow(test.window)
+
+		it, err := client.BlockRange(context.Background(), 1, bigArg(test.from), bigArg(test.to))
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d: BlockRange succeeded", i)
+			}
+			node.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: BlockRange error: %v", i, err)
+		}
+		want := test.first
+		for it.Next() {
+			if block := it.Block(); block.Number != hexutil.EncodeUint64(want) {
+				t.Errorf("test %d: got block %s, want %d", i, block.Number, want)
+			}
+			want++
+		}
+		if want != test.last+1 {
+			t.Errorf("test %d: iteration ended before block %d, want %d", i, want, test.last+1)
+		}
+		if (it.Err() != nil) != test.iterErr {
+			t.Errorf("test %d: iteration error %v", i, it.Err())
+		}
+		if it.Block() != nil || it.Next() {
+			t.Errorf("test %d: iterator not exhausted", i)
+		}
+		it.Close()
+		if !test.iterErr && test.fails == 0 {
+			fetched := uint64(len(node.CallsTo("getBlockByNumber")) - test.fails)
+			if fetched != test.last-test.first+1 {
+				t.Errorf("test %d: fetched %d blocks, want %d", i, fetched, test.last-test.first+1)
+			}
+		}
+		node.Close()
+	}
+}
+
+// TestBlockRangeClose checks that closing an iterator ends the iteration.
+func TestBlockRangeClose(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	serveGrowingChain(node, 100)
+	client := node.Client()
+	client.SetBlockWindow(4)
+
+	it, err := client.BlockRange(context.Background(), 1, big.NewInt(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || !it.Next() {
+		t.Fatalf("iteration ended: %v", it.Err())
+	}
+	it.Close()
+	if it.Next() || it.Block() != nil || it.Err() != nil {
+		t.Errorf("after Close: got block %v, error %v", it.Block(), it.Err())
+	}
+	if n := len(node.CallsTo("getBlockByNumber")); n != 4 {
+		t.Errorf("fetched %d blocks, want 4", n)
+	}
+}
+
+// receiveBlocks reads the blocks first to last from ch.
+func receiveBlocks(t *testing.T, ch <-chan *types.Block, sub interface{ Err() <-chan error }, first, last uint64) {
+	t.Helper()
+	for n := first; n <= last; n++ {
+		select {
+		case block := <-ch:
+			if block.Number != hexutil.EncodeUint64(n) {
+				t.Fatalf("got block %s, want %d", block.Number, n)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription ended before block %d: %v", n, err)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("block %d not delivered", n)
+		}
+	}
+}
+
+// TestFollowBlocks follows a growing chain over both transports, the channel
+// one notifying the new blocks and the HTTP one polling for them.
+func TestFollowBlocks(t *testing.T) {
+	for _, channel := range []bool{true, false} {
+		node := ethclienttest.NewFakeNode(t)
+		chain := serveGrowingChain(node, 3)
+		client := node.Client()
+		if channel {
+			client = node.ChannelClient()
+		}
+		client.SetBlockWindow(2)
+
+		blocks := make(chan *types.Block)
+		sub, err := client.FollowBlocks(context.Background(), 1, big.NewInt(1), blocks)
+		if err != nil {
+			t.Fatalf("channel %v: FollowBlocks error: %v", channel, err)
+		}
+		receiveBlocks(t, blocks, sub, 1, 3)
+
+		// Block 5 fails transiently, it's delivered once available.
+		chain.fail(5, 2)
+		chain.setHead(6)
+		if channel {
+			node.PushBlockNumber(1, 6)
+		}
+		receiveBlocks(t, blocks, sub, 4, 6)
+
+		sub.Unsubscribe()
+		if err := <-sub.Err(); err != nil {
+			t.Errorf("channel %v: subscription ended with %v", channel, err)
+		}
+		if channel && len(node.CallsTo("getBlockNumber")) != 1 {
+			t.Errorf("polled the block number over the channel transport")
+		}
+		node.Close()
+	}
+}
+
+// TestFollowBlocksLatest checks that following starts at the latest block if
+// no block is given, and that a failing node ends the subscription unless the
+// failure is transient.
+func TestFollowBlocksLatest(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	serveGrowingChain(node, 7)
+	client := node.ChannelClient()
+
+	blocks := make(chan *types.Block)
+	sub, err := client.FollowBlocks(context.Background(), 1, nil, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveBlocks(t, blocks, sub, 7, 7)
+
+	node.RespondError("getBlockByNumber", -40009, "don't send requests to this group")
+	node.PushBlockNumber(1, 8)
+	select {
+	case err := <-sub.Err():
+		if e, ok := err.(ethclient.BatchError); !ok || len(e) != 1 {
+			t.Errorf("subscription ended with %v, want a BatchError", err)
+		}
+	case block := <-blocks:
+		t.Errorf("got block %s from a failing node", block.Number)
+	case <-time.After(10 * time.Second):
+		t.Error("subscription didn't end")
+	}
+
+	if _, err := client.FollowBlocks(context.Background(), 1, big.NewInt(-1), blocks); err == nil {
+		t.Error("FollowBlocks accepted a negative block")
+	}
+}
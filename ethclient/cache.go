@@ -0,0 +1,122 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/chislab/go-fiscobcos/rpc"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// cacheable maps the methods whose responses are cached to the check whether a
+// response is final. Only data looked up by hash or address qualifies: blocks
+// are final once committed under PBFT, and so are the transactions and receipts
+// in them and the code of deployed contracts. Lookups by number or of the
+// latest state are never cached.
+var cacheable = map[string]func(raw json.RawMessage) bool{
+	"getBlockByHash":        found,
+	"getTransactionReceipt": found,
+	"getTransactionByHash":  committed,
+	"getCode":               deployed,
+}
+
+// cacheKey identifies a cached response. The arguments include the group.
+type cacheKey struct {
+	method string
+	args   string
+}
+
+// SetCacheSize enables the cache of immutable chain data holding up to size
+// responses, evicting the least recently used ones, or disables it if size is
+// zero or less. It may be called while the client is in use; the responses
+// cached so far are dropped.
+//
+// The cache keeps the responses of BlockByHash, TransactionByHash,
+// TransactionReceipt and Code (including CodeAt and HasCode), keyed by group
+// and argument. Missing data, like the receipt of a pending transaction or the
+// code of an address without contract, isn't cached. Hits are decoded from the
+// cached response, so callers get their own copy they may modify.
+func (ec *Client) SetCacheSize(size int) {
+	var cache *lru.Cache
+	if size > 0 {
+		cache, _ = lru.New(size)
+	}
+	ec.cache.Store(cache)
+}
+
+// responseCache returns the cache of immutable chain data, nil if disabled.
+func (ec *Client) responseCache() *lru.Cache {
+	cache, _ := ec.cache.Load().(*lru.Cache)
+	return cache
+}
+
+// cachedCall performs a JSON-RPC call whose response is cached if final says
+// it is.
+func (ec *Client) cachedCall(ctx context.Context, cache *lru.Cache, final func(json.RawMessage) bool, result interface{}, method string, args ...interface{}) error {
+	enc, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	key := cacheKey{method: method, args: string(enc)}
+
+	var raw json.RawMessage
+	if cached, ok := cache.Get(key); ok {
+		raw = cached.(json.RawMessage)
+	} else {
+		if err := ec.callNode(ctx, &raw, method, args...); err != nil {
+			return err
+		}
+		if final(raw) {
+			cache.Add(key, raw)
+		}
+	}
+	if len(raw) == 0 {
+		return rpc.ErrNoResult
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// found reports whether a response carries data.
+func found(raw json.RawMessage) bool {
+	return !isEmptyResult(raw)
+}
+
+// committed reports whether a transaction response is of a transaction in a
+// block.
+func committed(raw json.RawMessage) bool {
+	var tx struct {
+		BlockHash *string `json:"blockHash"`
+	}
+	if !found(raw) || json.Unmarshal(raw, &tx) != nil {
+		return false
+	}
+	return tx.BlockHash != nil && *tx.BlockHash != ""
+}
+
+// deployed reports whether a code response is of a contract.
+func deployed(raw json.RawMessage) bool {
+	var code string
+	if !found(raw) || json.Unmarshal(raw, &code) != nil {
+		return false
+	}
+	return code != "" && code != "0x"
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+func cacheClient(t *testing.T, node *ethclienttest.FakeNode, size int) *ethclient.Client {
+	client, err := ethclient.DialWithOptions(node.URL(), ethclient.WithCache(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := cacheClient(t, node, 2)
+	defer client.Close()
+
+	// Blocks by hash are fetched once, and hits are copies callers may modify.
+	node.RespondRaw("getBlockByHash", testBlock)
+	var want types.Block
+	if err := json.Unmarshal([]byte(testBlock), &want); err != nil {
+		t.Fatal(err)
+	}
+	hash := common.HexToHash(want.Hash)
+	for i := 0; i < 3; i++ {
+		block, err := client.BlockByHash(ctx, 1, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(block, &want) {
+			t.Fatalf("lookup %d: got %+v, want %+v", i, block, want)
+		}
+		block.Transactions[0].Hash = "modified"
+		block.SealerList[0] = "modified"
+		block.ExtraData = append(block.ExtraData, "modified")
+	}
+	if calls := len(node.CallsTo("getBlockByHash")); calls != 1 {
+		t.Errorf("block fetched %d times, want 1", calls)
+	}
+	// Groups are cached apart.
+	if _, err := client.BlockByHash(ctx, 2, hash); err != nil {
+		t.Fatal(err)
+	}
+	if calls := len(node.CallsTo("getBlockByHash")); calls != 2 {
+		t.Errorf("block of another group fetched %d times, want 2", calls)
+	}
+
+	// Missing data is fetched again.
+	receiptHash := common.HexToHash("0x01")
+	node.RespondRaw("getTransactionReceipt", "null")
+	for i := 0; i < 2; i++ {
+		if _, err := client.TransactionReceipt(ctx, 1, receiptHash); err != fiscobcos.NotFound {
+			t.Fatalf("missing receipt: %v, want NotFound", err)
+		}
+	}
+	node.RespondRaw("getTransactionReceipt", testReceipt)
+	for i := 0; i < 2; i++ {
+		if _, err := client.TransactionReceipt(ctx, 1, receiptHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := len(node.CallsTo("getTransactionReceipt")); calls != 3 {
+		t.Errorf("receipt fetched %d times, want 3", calls)
+	}
+
+	// Pending transactions and addresses without code aren't final.
+	var pending map[string]interface{}
+	if err := json.Unmarshal([]byte(testTx), &pending); err != nil {
+		t.Fatal(err)
+	}
+	pending["blockHash"] = nil
+	node.Respond("getTransactionByHash", pending)
+	node.Respond("getCode", "0x")
+	for i := 0; i < 2; i++ {
+		if _, err := client.TransactionByHash(ctx, 1, common.HexToHash(testTxHash)); err != nil {
+			t.Fatal(err)
+		}
+		client.Code(ctx, 1, common.Address{1}.Hex())
+	}
+	if calls := len(node.CallsTo("getTransactionByHash")); calls != 2 {
+		t.Errorf("pending transaction fetched %d times, want 2", calls)
+	}
+	if calls := len(node.CallsTo("getCode")); calls != 2 {
+		t.Errorf("empty code fetched %d times, want 2", calls)
+	}
+
+	// Lookups by number aren't cached.
+	node.RespondRaw("getBlockByNumber", testBlock)
+	for i := 0; i < 2; i++ {
+		if _, err := client.BlockByNumber(ctx, 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := len(node.CallsTo("getBlockByNumber")); calls != 2 {
+		t.Errorf("block by number fetched %d times, want 2", calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondRaw("getBlockByHash", testBlock)
+	client := cacheClient(t, node, 2)
+	defer client.Close()
+
+	// With room for two blocks, the least recently used one is evicted.
+	for i, n := range []byte{1, 2, 1, 3, 1, 2} {
+		if _, err := client.BlockByHash(ctx, 1, common.Hash{n}); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	var fetched []string
+	for _, call := range node.CallsTo("getBlockByHash") {
+		var hash common.Hash
+		json.Unmarshal(call.Params[1], &hash)
+		fetched = append(fetched, fmt.Sprint(hash[0]))
+	}
+	if want := []string{"1", "2", "3", "2"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched blocks %v, want %v", fetched, want)
+	}
+}
+
+// TestCacheConcurrent looks up and modifies blocks from many goroutines, with
+// hits, misses and evictions, for the race detector to check that callers
+// don't share cached data.
+func TestCacheConcurrent(t *testing.T) {
+	ctx := context.Background()
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondRaw("getBlockByHash", testBlock)
+	var want types.Block
+	if err := json.Unmarshal([]byte(testBlock), &want); err != nil {
+		t.Fatal(err)
+	}
+	client := cacheClient(t, node, 2)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				block, err := client.BlockByHash(ctx, 1, common.Hash{byte((i + j) % 3)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(block, &want) {
+					t.Errorf("got modified block %+v", block)
+					return
+				}
+				block.Hash = "modified"
+				block.Transactions[0].Input = "modified"
+				block.SealerList[0] = "modified"
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestCacheResize resizes and disables the cache while blocks are looked up,
+// for the race detector, and checks the size in effect afterwards.
+func TestCacheResize(t *testing.T) {
+	ctx := context.Background()
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondRaw("getBlockByHash", `{"hash":"0x0100000000000000000000000000000000000000000000000000000000000000","number":"0x1","transactions":[]}`)
+	client := cacheClient(t, node, 2)
+	defer client.Close()
+
+	// The cache is resized until every goroutine is done looking up.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := client.BlockByHash(ctx, 1, common.Hash{byte((i + j) % 3)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for size := 0; ; size++ {
+		select {
+		case <-done:
+		default:
+			client.SetCacheSize(size % 4)
+			continue
+		}
+		break
+	}
+
+	lookup := func(hashes ...byte) int {
+		node.Reset()
+		for _, h := range hashes {
+			if _, err := client.BlockByHash(ctx, 1, common.Hash{h}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return len(node.CallsTo("getBlockByHash"))
+	}
+	client.SetCacheSize(1)
+	if calls := lookup(1, 1, 2, 1); calls != 3 {
+		t.Errorf("cache of one block: %d calls, want 3", calls)
+	}
+	client.SetCacheSize(0)
+	if calls := lookup(1, 1); calls != 2 {
+		t.Errorf("disabled cache: %d calls, want 2", calls)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestCallContractBlockParam checks that the block number is sent as third
+// parameter of call only when one is given, and only to nodes supporting it.
+func TestCallContractBlockParam(t *testing.T) {
+	tests := []struct {
+		supported string   // supported version of the node
+		block     *big.Int // block number passed to CallContract
+		wantParam string   // third parameter, "" for none
+		wantErr   error
+	}{
+		{supported: "3.0.0", block: nil},
+		{supported: "3.0.0", block: big.NewInt(ethclient.LatestBlock)},
+		{supported: "3.0.0", block: big.NewInt(5), wantParam: "0x5"},
+		{supported: "3.0.0", block: big.NewInt(0), wantParam: "0x0"},
+		{supported: "2.7.0", block: nil},
+		{supported: "2.7.0", block: big.NewInt(5), wantErr: ethclient.ErrHistoricalCallUnsupported},
+		{supported: "", block: big.NewInt(5), wantErr: ethclient.ErrHistoricalCallUnsupported},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			node := ethclienttest.NewFakeNode(t)
+			defer node.Close()
+			node.Respond("getClientVersion", &types.ClientVersion{Version: "2.7.0", SupportedVersion: test.supported})
+			node.Respond("call", map[string]string{"currentBlockNumber": "0x10", "status": "0x0", "output": "0x01"})
+			client := node.Client()
+
+			msg := fiscobcos.CallMsg{Msg: fiscobcos.CallEthMsg{To: &common.Address{1}}}
+			output, err := client.CallContract(context.Background(), msg, test.block)
+			if err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			calls := node.CallsTo("call")
+			if test.wantErr != nil {
+				if len(calls) != 0 {
+					t.Errorf("call sent despite the error")
+				}
+				return
+			}
+			if len(output) != 1 || output[0] != 1 {
+				t.Errorf("got output %x, want 01", output)
+			}
+			if len(calls) != 1 {
+				t.Fatalf("sent %d calls, want 1", len(calls))
+			}
+			params := calls[0].Params
+			switch {
+			case test.wantParam == "" && len(params) != 2:
+				t.Errorf("sent %d params, want group and call only", len(params))
+			case test.wantParam != "":
+				var param string
+				if len(params) != 3 || json.Unmarshal(params[2], &param) != nil || param != test.wantParam {
+					t.Errorf("sent params %s, want block %s third", params, test.wantParam)
+				}
+			}
+		})
+	}
+}
+
+// TestCallContractStatus checks how the execution status of a call is reported.
+func TestCallContractStatus(t *testing.T) {
+	reason := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"6c6f770000000000000000000000000000000000000000000000000000000000"
+	tests := []struct {
+		result     string
+		output     string // of CallContract
+		status     int    // of CallContractDetailed
+		block      uint64
+		err        string
+		revert     bool
+		errWrapped error // Err of an *Error
+	}{
+		{result: `{"currentBlockNumber":"0x10","status":"0x0","output":"0x2a"}`, output: "0x2a", status: 0, block: 0x10},
+		{result: `{"currentBlockNumber":"16","status":"0","output":"0x"}`, output: "0x", block: 16},
+		{result: `"0x2a"`, output: "0x2a"}, // nodes before 2.0
+		{result: `{"currentBlockNumber":"0x10","status":"0x16","output":"` + reason + `"}`, status: 0x16, block: 0x10, err: "execution reverted: low", revert: true},
+		{result: `{"currentBlockNumber":"0x10","status":"0x16","output":"0x"}`, status: 0x16, block: 0x10, err: "execution reverted", revert: true},
+		{result: `{"currentBlockNumber":"0x10","status":"0x1e","output":"0x"}`, status: 0x1e, block: 0x10, err: "ContractFrozen", errWrapped: ethclient.ErrContractFrozen},
+		{result: `{"currentBlockNumber":"0x10","status":"0xc","output":"0x"}`, status: 0xc, block: 0x10, err: "OutOfGas"},
+	}
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	msg := fiscobcos.CallMsg{Msg: fiscobcos.CallEthMsg{To: &common.Address{1}}}
+
+	for _, test := range tests {
+		node.RespondRaw("call", test.result)
+		result, err := client.CallContractDetailed(context.Background(), msg, nil)
+		if err != nil {
+			t.Errorf("%s: CallContractDetailed error: %v", test.result, err)
+		} else if result.Status != test.status || result.CurrentBlockNumber != test.block || result.Succeeded() != (test.status == 0) {
+			t.Errorf("%s: got result %+v", test.result, result)
+		}
+
+		output, err := client.CallContract(context.Background(), msg, nil)
+		if test.err == "" {
+			if err != nil || hexutil.Encode(output) != test.output {
+				t.Errorf("%s: got output %x, error %v, want %s", test.result, output, err, test.output)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, want %q", test.result, err, test.err)
+			continue
+		}
+		if output != nil {
+			t.Errorf("%s: got output %x along with the error", test.result, output)
+		}
+		switch e := err.(type) {
+		case *ethclient.RevertError:
+			if !test.revert || !e.Is(ethclient.ErrExecutionReverted) || !bytes.Equal(e.RevertData(), result.Output) {
+				t.Errorf("%s: got revert error %+v", test.result, e)
+			}
+		case *ethclient.Error:
+			if test.revert || e.Code != test.status || e.Err != test.errWrapped {
+				t.Errorf("%s: got error %+v", test.result, e)
+			}
+		default:
+			t.Errorf("%s: got error %T", test.result, err)
+		}
+	}
+}
+
+// TestCodeAt checks that getCode is sent with just the group and the address,
+// and how the code answered is decoded.
+func TestCodeAt(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	account := common.Address{0xaa}
+
+	tests := []struct {
+		result  interface{} // answer to getCode
+		code    string      // code returned by CodeAt, empty for nil
+		hasCode bool
+		err     bool
+	}{
+		{result: "0x6080604052", code: "0x6080604052", hasCode: true},
+		{result: "0x"},
+		{result: ""},
+		{result: "6080", err: true},
+		{result: 12, err: true},
+	}
+	for _, test := range tests {
+		node.Reset()
+		node.Respond("getCode", test.result)
+
+		code, err := client.CodeAt(context.Background(), 3, account, big.NewInt(7))
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: got code %x, want error", test.result, code)
+			}
+		} else if err != nil {
+			t.Errorf("%v: got error %v", test.result, err)
+		} else if test.code == "" && code != nil {
+			t.Errorf("%v: got code %x, want nil", test.result, code)
+		} else if test.code != "" && hexutil.Encode(code) != test.code {
+			t.Errorf("%v: got code %x, want %s", test.result, code, test.code)
+		}
+		calls := node.CallsTo("getCode")
+		if len(calls) != 1 {
+			t.Fatalf("%v: getCode sent %d times", test.result, len(calls))
+		}
+		var addr common.Address
+		if len(calls[0].Params) != 2 || groupParam(t, calls[0]) != 3 || json.Unmarshal(calls[0].Params[1], &addr) != nil || addr != account {
+			t.Errorf("%v: getCode sent with params %s", test.result, calls[0].Params)
+		}
+
+		has, err := client.HasCode(context.Background(), 3, account)
+		if test.err != (err != nil) || has != test.hasCode {
+			t.Errorf("%v: HasCode returned %v, error %v, want %v", test.result, has, err, test.hasCode)
+		}
+	}
+}
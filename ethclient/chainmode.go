@@ -0,0 +1,77 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// IsGM reports whether the node is a guomi build, signing with SM2 and hashing
+// with SM3. The node's version is only requested once; later calls, and
+// ChainMode, use the cached result.
+func (ec *Client) IsGM(ctx context.Context) (bool, error) {
+	version, err := ec.nodeVersion(ctx)
+	if err != nil {
+		return false, err
+	}
+	return version.ChainMode() == types.ChainModeGM, nil
+}
+
+// ChainMode returns the cryptography of the chain as detected by IsGM, without
+// contacting the node. known is false if it hasn't been detected yet, in which
+// case ChainModeStandard is returned.
+func (ec *Client) ChainMode() (mode types.ChainMode, known bool) {
+	ec.versionMu.Lock()
+	defer ec.versionMu.Unlock()
+	if ec.version == nil {
+		return types.ChainModeStandard, false
+	}
+	return ec.version.ChainMode(), true
+}
+
+// ChainId returns the chain id of the node, which transactions must carry. Like
+// IsGM it requests the node's version only once.
+func (ec *Client) ChainId(ctx context.Context) (*big.Int, error) {
+	version, err := ec.nodeVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainId := version.ParseChainId()
+	if chainId == nil {
+		return nil, fmt.Errorf("node reports invalid chain id %q", version.ChainId)
+	}
+	return chainId, nil
+}
+
+// nodeVersion returns the version of the node, requesting it only once.
+func (ec *Client) nodeVersion(ctx context.Context) (*types.ClientVersion, error) {
+	ec.versionMu.Lock()
+	defer ec.versionMu.Unlock()
+
+	if ec.version == nil {
+		version, err := ec.ClientVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ec.version = version
+	}
+	return ec.version, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestIsGM checks that the chain mode is detected from the node's version, which
+// is only requested once it was retrieved.
+func TestIsGM(t *testing.T) {
+	tests := []struct {
+		version string
+		gm      bool
+	}{
+		{"2.7.0", false},
+		{"2.7.0 gm", true},
+	}
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		client := node.Client()
+		if mode, known := client.ChainMode(); known || mode != types.ChainModeStandard {
+			t.Errorf("%s: chain mode %v known = %v before detection", test.version, mode, known)
+		}
+
+		// A failure is reported and detection tried again.
+		node.RespondError("getClientVersion", -32000, "node starting")
+		if _, err := client.IsGM(context.Background()); err == nil {
+			t.Errorf("%s: IsGM succeeded without version", test.version)
+		}
+		if _, known := client.ChainMode(); known {
+			t.Errorf("%s: chain mode known after a failure", test.version)
+		}
+		node.Respond("getClientVersion", &types.ClientVersion{Version: test.version, ChainId: "1"})
+		for i := 0; i < 3; i++ {
+			gm, err := client.IsGM(context.Background())
+			if err != nil || gm != test.gm {
+				t.Errorf("%s: IsGM %v, %v, want %v", test.version, gm, err, test.gm)
+			}
+		}
+		want := types.ChainModeStandard
+		if test.gm {
+			want = types.ChainModeGM
+		}
+		if mode, known := client.ChainMode(); !known || mode != want {
+			t.Errorf("%s: chain mode %v known = %v, want %v", test.version, mode, known, want)
+		}
+		if n := len(node.CallsTo("getClientVersion")); n != 2 {
+			t.Errorf("%s: version requested %d times, want 2", test.version, n)
+		}
+		node.Close()
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestCloseWaitMined closes clients while 100 WaitMined loops poll them for
+// receipts that never come, checking that every loop ends with ErrClientClosed
+// and that subscriptions, on the channel transport, end with their error channel
+// closed.
+func TestCloseWaitMined(t *testing.T) {
+	for _, transport := range []string{"http", "channel"} {
+		t.Run(transport, func(t *testing.T) {
+			node := ethclienttest.NewFakeNode(t)
+			defer node.Close()
+			node.Handle("getTransactionReceipt", func([]json.RawMessage) (interface{}, error) {
+				time.Sleep(10 * time.Millisecond) // keep calls in flight
+				return nil, nil
+			})
+			client := node.Client()
+			var sub fiscobcos.Subscription
+			if transport == "channel" {
+				client = node.ChannelClient()
+				var err error
+				if sub, err = client.SubscribeNewBlocks(context.Background(), 1, make(chan *types.BlockHeader)); err != nil {
+					t.Fatalf("can't subscribe: %v", err)
+				}
+			}
+
+			const loops = 100
+			errs := make(chan error, loops)
+			for i := 0; i < loops; i++ {
+				tx := types.NewTransaction(big.NewInt(int64(i+1)), common.Address{1}, new(big.Int), 30000000, new(big.Int), nil, big.NewInt(600), big.NewInt(1), big.NewInt(1), nil)
+				go func() {
+					_, err := bind.WaitMined(context.Background(), 1, client, tx)
+					errs <- err
+				}()
+			}
+			for deadline := time.Now().Add(10 * time.Second); len(node.CallsTo("getTransactionReceipt")) < loops; {
+				if time.Now().After(deadline) {
+					t.Fatal("WaitMined loops didn't start polling")
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					client.Close()
+				}()
+			}
+			wg.Wait()
+
+			timeout := time.After(10 * time.Second)
+			for i := 0; i < loops; i++ {
+				select {
+				case err := <-errs:
+					if err != ethclient.ErrClientClosed {
+						t.Errorf("WaitMined ended with %v, want ErrClientClosed", err)
+					}
+				case <-timeout:
+					t.Fatalf("%d WaitMined loops still running after Close", loops-i)
+				}
+			}
+			if sub != nil {
+				select {
+				case err, ok := <-sub.Err():
+					if ok {
+						t.Errorf("subscription ended with %v, want its error channel closed", err)
+					}
+				case <-timeout:
+					t.Fatal("subscription still running after Close")
+				}
+			}
+			if _, err := client.BlockNumber(context.Background(), 1); err != ethclient.ErrClientClosed {
+				t.Errorf("call after Close: got error %v, want ErrClientClosed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// Errors corresponding to the error codes of JSON-RPC and FISCO BCOS nodes. Errors
+// returned by the client wrap them, so they can be matched with errors.Is (or by
+// comparing Error.Err on toolchains predating it).
+var (
+	// JSON-RPC 2.0
+	ErrParse          = errors.New("parse error")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrMethodNotFound = errors.New("method not found")
+	ErrInvalidParams  = errors.New("invalid params")
+	ErrInternal       = errors.New("internal error")
+
+	// FISCO BCOS RPC
+	ErrGroupNotExist              = errors.New("group does not exist")
+	ErrResponseParse              = errors.New("response json parse error")
+	ErrBlockHashNotExist          = errors.New("block hash does not exist")
+	ErrBlockNumberNotExist        = errors.New("block number does not exist")
+	ErrTransactionIndexOutOfRange = errors.New("transaction index is out of range")
+	ErrCallFromMissing            = errors.New("call needs a 'from' field")
+	ErrViewUnsupported            = errors.New("only pbft consensus supports the view property")
+	ErrInvalidSystemConfig        = errors.New("invalid system config")
+	ErrNodeNotInGroup             = errors.New("node doesn't belong to the group")
+	ErrRPCNotReady                = errors.New("rpc module initialization is incomplete")
+	ErrOverQPSLimit               = errors.New("over qps limit")
+	ErrGroupAccessDenied          = errors.New("sdk is not allowed to access the group")
+
+	// Transaction pool and permission rejections
+	ErrNonceCheckFail          = errors.New("nonce check failed")
+	ErrBlockLimitCheckFail     = errors.New("block limit check failed")
+	ErrPermissionDenied        = errors.New("permission denied")
+	ErrTxPoolIsFull            = errors.New("transaction pool is full")
+	ErrTransactionRefused      = errors.New("transaction refused")
+	ErrTxAlreadyKnown          = errors.New("transaction already known")
+	ErrTxAlreadyInChain        = errors.New("transaction already in chain")
+	ErrInvalidChainId          = errors.New("invalid chain id")
+	ErrInvalidGroupId          = errors.New("invalid group id")
+	ErrRequestNotBelongToGroup = errors.New("request doesn't belong to the group")
+	ErrMalformedTx             = errors.New("malformed transaction")
+	ErrOverGroupMemoryLimit    = errors.New("over group memory limit")
+	ErrNoDeployPermission      = errors.New("no permission to deploy contracts")
+	ErrNoTxPermission          = errors.New("no permission to send transactions")
+	ErrInvalidSignature        = errors.New("invalid signature")
+	ErrContractFrozen          = types.ErrContractFrozen
+	ErrAccountFrozen           = types.ErrAccountFrozen
+
+	// Execution
+	ErrExecutionReverted = errors.New("execution reverted")
+)
+
+// codeErrors maps error codes to the errors above.
+var codeErrors = map[int]error{
+	-32700: ErrParse,
+	-32600: ErrInvalidRequest,
+	-32601: ErrMethodNotFound,
+	-32602: ErrInvalidParams,
+	-32603: ErrInternal,
+
+	-40001: ErrGroupNotExist,
+	-40002: ErrResponseParse,
+	-40003: ErrBlockHashNotExist,
+	-40004: ErrBlockNumberNotExist,
+	-40005: ErrTransactionIndexOutOfRange,
+	-40006: ErrCallFromMissing,
+	-40007: ErrViewUnsupported,
+	-40008: ErrInvalidSystemConfig,
+	-40009: ErrNodeNotInGroup,
+	-40010: ErrRPCNotReady,
+	-40011: ErrOverQPSLimit,
+	-40012: ErrGroupAccessDenied,
+
+	0x05:  ErrInvalidSignature,
+	0x0f:  ErrNonceCheckFail,
+	0x10:  ErrBlockLimitCheckFail,
+	0x12:  ErrNoDeployPermission,
+	0x14:  ErrNoTxPermission,
+	0x19:  ErrPermissionDenied,
+	0x17:  ErrInvalidSignature,
+	0x1c:  ErrTxPoolIsFull,
+	0x1d:  ErrTransactionRefused,
+	0x1e:  ErrContractFrozen,
+	0x1f:  ErrAccountFrozen,
+	10000: ErrTxAlreadyKnown,
+	10001: ErrTxAlreadyInChain,
+	10002: ErrInvalidChainId,
+	10003: ErrInvalidGroupId,
+	10004: ErrRequestNotBelongToGroup,
+	10005: ErrMalformedTx,
+	10006: ErrOverGroupMemoryLimit,
+}
+
+// rejectionMessages maps fragments of the messages transactions are rejected with
+// to the errors above, for nodes reporting a generic code or none. The 2.x
+// versions word them differently ("TxPool is full", "TxPoolIsFull"), so messages
+// are compared in lower case with spaces and underscores removed.
+var rejectionMessages = []struct {
+	fragment string
+	err      error
+}{
+	{"txpoolisfull", ErrTxPoolIsFull},
+	{"transactionpoolisfull", ErrTxPoolIsFull},
+	{"noncecheckfail", ErrNonceCheckFail},
+	{"blocklimitcheckfail", ErrBlockLimitCheckFail},
+	{"alreadyknown", ErrTxAlreadyKnown},
+	{"alreadyintxpool", ErrTxAlreadyKnown},
+	{"alreadyinchain", ErrTxAlreadyInChain},
+	{"invalidsignature", ErrInvalidSignature},
+	{"invalidzerosignature", ErrInvalidSignature},
+}
+
+// rejectionError returns the error matching the message a transaction was
+// rejected with, nil if there is none.
+func rejectionError(message string) error {
+	msg := strings.NewReplacer(" ", "", "_", "").Replace(strings.ToLower(message))
+	for _, r := range rejectionMessages {
+		if strings.Contains(msg, r.fragment) {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// Error is an error reported by the node. It keeps the original code and message
+// and wraps the matching error variable, if the code is known.
+type Error struct {
+	Code    int
+	Message string
+	Err     error // error variable matching Code, nil for unknown codes
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// ErrorCode implements rpc.Error.
+func (e *Error) ErrorCode() int { return e.Code }
+
+// Unwrap returns the error variable matching the error code.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the error variable matching the error code, or
+// fiscobcos.NotFound if the node reported a missing block or transaction.
+func (e *Error) Is(target error) bool {
+	if target == fiscobcos.NotFound {
+		return notFoundErrors[e.Err]
+	}
+	return e.Err != nil && e.Err == target
+}
+
+// notFoundErrors are the node errors telling that the requested item doesn't
+// exist, which match fiscobcos.NotFound.
+var notFoundErrors = map[error]bool{
+	ErrBlockHashNotExist:          true,
+	ErrBlockNumberNotExist:        true,
+	ErrTransactionIndexOutOfRange: true,
+}
+
+// notFound replaces node errors telling that the requested item doesn't exist
+// with fiscobcos.NotFound.
+func notFound(err error) error {
+	if e, ok := err.(*Error); ok && notFoundErrors[e.Err] {
+		return fiscobcos.NotFound
+	}
+	return err
+}
+
+// RevertError is returned by CallContract if the contract reverted the call. It
+// matches ErrExecutionReverted.
+type RevertError struct {
+	Reason string // reason passed to revert or require, empty if none was given
+	Output []byte // revert data returned by the call
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return ErrExecutionReverted.Error()
+	}
+	return ErrExecutionReverted.Error() + ": " + e.Reason
+}
+
+// RevertData returns the output of the reverted call, which carries the custom
+// error of the contract if it reverted with one.
+func (e *RevertError) RevertData() []byte { return e.Output }
+
+// Unwrap returns ErrExecutionReverted.
+func (e *RevertError) Unwrap() error { return ErrExecutionReverted }
+
+// Is reports whether target is ErrExecutionReverted.
+func (e *RevertError) Is(target error) bool { return target == ErrExecutionReverted }
+
+// IsNonceDuplicate reports whether err is the node rejecting a transaction whose
+// random id (nonce) was already used, either by a transaction in the pool or by one
+// already on chain. Such transactions need a fresh nonce, see types.NewRandomNonce.
+func IsNonceDuplicate(err error) bool {
+	if e, ok := err.(*Error); ok {
+		err = e.Err
+	}
+	switch err {
+	case ErrNonceCheckFail, ErrTxAlreadyKnown, ErrTxAlreadyInChain:
+		return true
+	}
+	return false
+}
+
+// wrapError converts errors carrying a node error code into *Error. Errors with
+// an unknown or generic code are matched by their message, if it tells why a
+// transaction was rejected.
+func wrapError(err error) error {
+	rpcErr, ok := err.(rpc.Error)
+	if !ok {
+		return err
+	}
+	e := &Error{Code: rpcErr.ErrorCode(), Message: rpcErr.Error(), Err: codeErrors[rpcErr.ErrorCode()]}
+	switch e.Err {
+	case nil, ErrInternal, ErrTransactionRefused:
+		if rejected := rejectionError(e.Message); rejected != nil {
+			e.Err = rejected
+		}
+	}
+	return e
+}
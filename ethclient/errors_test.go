@@ -0,0 +1,120 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestNodeErrors checks that error responses are returned as *Error, wrapping
+// the error variable of their code.
+func TestNodeErrors(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	tests := []struct {
+		code     int
+		message  string
+		want     error
+		notFound bool
+	}{
+		{-32700, "Parse error", ethclient.ErrParse, false},
+		{-32601, "Method not found", ethclient.ErrMethodNotFound, false},
+		{-32602, "Invalid params", ethclient.ErrInvalidParams, false},
+		{-40001, "GroupID does not exist", ethclient.ErrGroupNotExist, false},
+		{-40003, "BlockHash does not exist", ethclient.ErrBlockHashNotExist, true},
+		{-40004, "BlockNumber does not exist", ethclient.ErrBlockNumberNotExist, true},
+		{-40005, "TransactionIndex is out of range", ethclient.ErrTransactionIndexOutOfRange, true},
+		{-40009, "Don't send requests to this group, the node doesn't belong to the group", ethclient.ErrNodeNotInGroup, false},
+		{-40011, "Over QPS limit", ethclient.ErrOverQPSLimit, false},
+		{-40012, "The SDK is not allowed to access this group", ethclient.ErrGroupAccessDenied, false},
+		{-40099, "some new error", nil, false},
+		{-32000, "server error", nil, false},
+	}
+	for _, test := range tests {
+		node.RespondError("getBlockNumber", test.code, test.message)
+		_, err := client.BlockNumber(context.Background(), 1)
+		e, ok := err.(*ethclient.Error)
+		if !ok {
+			t.Errorf("code %d: got error %T %v, want *Error", test.code, err, err)
+			continue
+		}
+		if e.Code != test.code || e.ErrorCode() != test.code || e.Message != test.message || e.Error() != test.message {
+			t.Errorf("code %d: got code %d, message %q", test.code, e.Code, e.Message)
+		}
+		if e.Err != test.want || e.Unwrap() != test.want {
+			t.Errorf("code %d: wraps %v, want %v", test.code, e.Err, test.want)
+		}
+		if test.want != nil && !e.Is(test.want) {
+			t.Errorf("code %d: doesn't match %v", test.code, test.want)
+		}
+		if e.Is(ethclient.ErrInternal) {
+			t.Errorf("code %d: matches ErrInternal", test.code)
+		}
+		if e.Is(fiscobcos.NotFound) != test.notFound {
+			t.Errorf("code %d: matches NotFound = %v, want %v", test.code, !test.notFound, test.notFound)
+		}
+
+		// The getters of single items report them as NotFound.
+		node.RespondError("getBlockHashByNumber", test.code, test.message)
+		_, err = client.BlockHashByNumber(context.Background(), 1, 5)
+		if (err == fiscobcos.NotFound) != test.notFound {
+			t.Errorf("code %d: BlockHashByNumber error %v, want NotFound = %v", test.code, err, test.notFound)
+		}
+	}
+}
+
+func TestIsNonceDuplicate(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	tests := []struct {
+		code    int
+		message string
+		want    bool
+	}{
+		{0x0f, "NonceCheckFail", true},
+		{10000, "AlreadyKnown", true},
+		{10001, "AlreadyInChain", true},
+		{-32000, "Transaction already in txpool", true},
+		{0x10, "BlockLimitCheckFail", false},
+		{0x1c, "TxPoolIsFull", false},
+		{-32602, "Invalid params", false},
+	}
+	for _, test := range tests {
+		node.RespondError("sendRawTransaction", test.code, test.message)
+		err := client.SendTransaction(context.Background(), newGroupTx(1))
+		if err == nil {
+			t.Fatalf("code %d: transaction accepted", test.code)
+		}
+		if ethclient.IsNonceDuplicate(err) != test.want {
+			t.Errorf("code %d %q: IsNonceDuplicate = %v, want %v", test.code, test.message, !test.want, test.want)
+		}
+	}
+	for _, err := range []error{nil, ethclient.ErrTxAlreadyKnown, ethclient.ErrTxPoolIsFull, context.Canceled} {
+		if want := err == ethclient.ErrTxAlreadyKnown; ethclient.IsNonceDuplicate(err) != want {
+			t.Errorf("%v: IsNonceDuplicate = %v, want %v", err, !want, want)
+		}
+	}
+}
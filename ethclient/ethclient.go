@@ -19,9 +19,11 @@ package ethclient
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
+	"sync"
+	"sync/atomic"
 
 	"github.com/chislab/go-fiscobcos"
 	"github.com/chislab/go-fiscobcos/common"
@@ -31,35 +33,230 @@ import (
 	"github.com/chislab/go-fiscobcos/rpc"
 )
 
+// defaultGroupId is the group targeted by a client that has not been assigned
+// another default through SetDefaultGroup.
+const defaultGroupId = 1
+
+// Client implements the node interfaces of package fiscobcos, and fills in the
+// transactions of types.TxBuilder.
+var (
+	_ fiscobcos.Client                = (*Client)(nil)
+	_ fiscobcos.PendingContractCaller = (*Client)(nil)
+	_ types.TxBackend                 = (*Client)(nil)
+)
+
 // Client defines typed wrappers for the Bcos RPC API.
+//
+// Methods taking a groupId target that group. A groupId of 0 means "unspecified",
+// in which case the group carried by the call context (see fiscobcos.ContextWithGroup)
+// is used, falling back to the default group of the client.
 type Client struct {
+	// 64-bit fields accessed atomically come first, which keeps them aligned on
+	// 32-bit platforms.
+	groupId        uint64 // default group, used if neither the call nor the context name one
+	receiptTimeout int64  // bounds the wait of SendTransactionAsync, a time.Duration
+	requestTimeout int64  // bounds requests without deadline, 0 for none, a time.Duration
+
 	c *rpc.Client
+
+	filterConcurrency int32 // number of blocks scanned in parallel by FilterLogs, accessed atomically
+	blockWindow       int32 // number of blocks fetched at once by BlockRange and FollowBlocks, accessed atomically
+
+	receiptConcurrency int32 // number of receipts fetched in parallel by BlockReceipts, accessed atomically
+	receiptRetries     int32 // times BlockReceipts repeats failed receipt fetches, accessed atomically
+
+	heightMu         sync.Mutex
+	heights          map[uint64]*chainHeight // cached chain height per group
+	blockLimitOffset uint64                  // blocks a transaction stays valid for
+
+	headsMu sync.Mutex
+	heads   *HeadTracker // see TrackHeads, nil until called
+
+	versionMu     sync.Mutex
+	version       *types.ClientVersion // version of the node, see nodeVersion
+	versionWarned bool                 // whether an unparsable version was logged
+
+	pool   *pool        // spreads calls over several nodes, see DialPool
+	cache  atomic.Value // *lru.Cache of responses of immutable data, nil if disabled, see WithCache
+	verify int32        // check the roots of returned blocks if 1, see WithVerification, accessed atomically
+
+	skipValidation int32 // send arguments unchecked if 1, see WithoutValidation, accessed atomically
+	rawResponses   bool  // keep the raw responses of decoded values, see WithRawResponses
+
+	retry RetryPolicy // repeats failed calls, nil for none
+
+	closeOnce sync.Once
+	closeCtx  context.Context    // canceled by Close, ending waits and subscriptions
+	cancel    context.CancelFunc // cancels closeCtx
 }
 
+// ErrClientClosed is returned by the calls made on a closed client, as well as
+// by those in flight when Close was called. It is the error the rpc package
+// reports for closed clients, rpc.ErrClientQuit.
+var ErrClientClosed = rpc.ErrClientQuit
+
 // Dial connects a client to the given URL.
 func Dial(rawurl string) (*Client, error) {
 	return DialContext(context.Background(), rawurl)
 }
 
-func DialContext(ctx context.Context, rawurl string) (*Client, error) {
-	c, err := rpc.DialContext(ctx, rawurl)
+// DialContext connects a client to the given URL, configured by the options. The
+// context is used for the initial connection establishment.
+//
+// Besides URLs, a scheme-less "host:port" is accepted, with IPv6 addresses in
+// brackets. It is dialed over the channel transport if WithChannelCerts is
+// given and over HTTP otherwise, see rpc.ParseEndpoint.
+func DialContext(ctx context.Context, rawurl string, opts ...ClientOption) (*Client, error) {
+	cfg := newDialConfig(opts)
+	c, err := cfg.dialRPC(ctx, rawurl)
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(c), nil
+	ec := NewClient(c)
+	cfg.configure(ec)
+	return ec, nil
 }
 
 // NewClient creates a client that uses the given RPC client.
 func NewClient(c *rpc.Client) *Client {
-	return &Client{c}
+	closeCtx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		c:                  c,
+		groupId:            defaultGroupId,
+		filterConcurrency:  defaultFilterConcurrency,
+		blockWindow:        defaultBlockWindow,
+		receiptConcurrency: defaultReceiptConcurrency,
+		receiptRetries:     defaultReceiptRetries,
+		blockLimitOffset:   defaultBlockLimitOffset,
+		receiptTimeout:     int64(defaultReceiptTimeout),
+		requestTimeout:     int64(defaultRequestTimeout),
+		closeCtx:           closeCtx,
+		cancel:             cancel,
+	}
+}
+
+// SetDefaultGroup changes the group targeted by calls which don't specify one,
+// neither explicitly nor through their context. A groupId of 0 restores the
+// initial default (group 1).
+func (ec *Client) SetDefaultGroup(groupId uint64) {
+	if groupId == 0 {
+		groupId = defaultGroupId
+	}
+	atomic.StoreUint64(&ec.groupId, groupId)
+}
+
+// DefaultGroup returns the group targeted by calls which don't specify one,
+// neither explicitly nor through their context.
+func (ec *Client) DefaultGroup() uint64 {
+	return atomic.LoadUint64(&ec.groupId)
+}
+
+// group resolves the group a request is sent to. An explicit groupId takes
+// precedence over the context, which takes precedence over the client default.
+func (ec *Client) group(ctx context.Context, groupId uint64) uint64 {
+	if groupId != 0 {
+		return groupId
+	}
+	if groupId, ok := fiscobcos.GroupFromContext(ctx); ok {
+		return groupId
+	}
+	return ec.DefaultGroup()
+}
+
+// txGroup resolves the group a transaction is sent to. A transaction signed for a
+// group is sent to that group, the node rejects it in any other. An explicit
+// groupId naming another group fails with a *ValidationError. Transactions not
+// signed for a group are sent to the group resolved as in group.
+func (ec *Client) txGroup(ctx context.Context, method string, groupId uint64, tx *types.Transaction) (uint64, error) {
+	signed := tx.GroupId()
+	if signed.Sign() <= 0 || !signed.IsUint64() {
+		return ec.group(ctx, groupId), nil
+	}
+	if groupId != 0 && groupId != signed.Uint64() {
+		return 0, &ValidationError{Method: method, Param: "groupId", Value: groupId, Reason: fmt.Sprintf("transaction is signed for group %v", signed)}
+	}
+	return signed.Uint64(), nil
+}
+
+// call performs a JSON-RPC call, wrapping node errors into *Error. Malformed
+// arguments fail with *ValidationError, see validateArgs. Responses of the
+// methods returning immutable data are taken from the cache, if enabled.
+func (ec *Client) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if err := ec.validateArgs(method, args); err != nil {
+		return err
+	}
+	if cache := ec.responseCache(); cache != nil {
+		if final := cacheable[method]; final != nil {
+			return ec.cachedCall(ctx, cache, final, result, method, args...)
+		}
+	}
+	return ec.callNode(ctx, result, method, args...)
 }
 
+// callNode performs a JSON-RPC call bypassing the cache.
+func (ec *Client) callNode(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if ec.closed() {
+		return ErrClientClosed
+	}
+	ctx, cancel := ec.withRequestTimeout(ctx)
+	defer cancel()
+
+	err := ec.callWithRetry(ctx, method, args, func() error {
+		if ec.pool != nil {
+			return wrapError(ec.pool.call(ctx, result, method, args...))
+		}
+		return wrapError(ec.c.CallContext(ctx, result, method, args...))
+	})
+	if ctx.Err() != nil {
+		// The response may have raced the deadline, don't let the caller decode
+		// it after giving up. Transports failing on the deadline, like HTTP,
+		// report it wrapped in errors of their own.
+		err = ctx.Err()
+	}
+	return ec.closedErr(err)
+}
+
+// Close closes the client. Calls in flight and made afterwards fail with
+// ErrClientClosed, waits like WaitSynced end with it and subscriptions end
+// with their error channel closed. Close may be called more than once.
 func (ec *Client) Close() {
-	ec.c.Close()
+	ec.closeOnce.Do(func() {
+		ec.cancel()
+		ec.stopHeights()
+		if ec.pool != nil {
+			ec.pool.close()
+			return
+		}
+		ec.c.Close()
+	})
+}
+
+// closed reports whether Close has been called.
+func (ec *Client) closed() bool {
+	return ec.closeCtx.Err() != nil
+}
+
+// closedErr replaces the failure of a call cut short by Close with
+// ErrClientClosed. Errors reported by the node are kept.
+func (ec *Client) closedErr(err error) error {
+	if err == nil || !ec.closed() {
+		return err
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return ErrClientClosed
 }
 
 func (ec *Client) BlockByHash(ctx context.Context, groupId uint64, hash common.Hash) (*types.Block, error) {
-	return ec.getBlock(ctx, "getBlockByHash", groupId, hash, true)
+	block, err := ec.getBlock(ctx, "getBlockByHash", ec.group(ctx, groupId), hash, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.verifyBlock(ctx, block); err != nil {
+		return nil, err
+	}
+	return block, nil
 }
 
 func (ec *Client) ClientVersion(ctx context.Context) (*types.ClientVersion, error) {
@@ -67,230 +264,271 @@ func (ec *Client) ClientVersion(ctx context.Context) (*types.ClientVersion, erro
 }
 
 func (ec *Client) BlockNumber(ctx context.Context, groupId uint64) (*big.Int, error) {
-	return ec.getBlockNumber(ctx, "getBlockNumber", groupId)
+	return ec.getBlockNumber(ctx, "getBlockNumber", ec.group(ctx, groupId))
 }
 func (ec *Client) SyncStatus(ctx context.Context, groupId uint64) (*types.SyncStatus, error) {
-	return ec.getSyncStatus(ctx, "getSyncStatus", groupId)
+	return ec.getSyncStatus(ctx, "getSyncStatus", ec.group(ctx, groupId))
 }
+
+// BlockByNumber returns a block with its transactions. number is nil or the
+// LatestBlock tag for the latest block, see rpc.BlockNumber.Big. Other negative
+// numbers fail with a *ValidationError, and blocks beyond the head with
+// fiscobcos.NotFound, however the node reports them.
 func (ec *Client) BlockByNumber(ctx context.Context, groupId uint64, number *big.Int) (*types.Block, error) {
-	return ec.getBlockByNumber(ctx, "getBlockByNumber", groupId, toBlockNumArg(number), true)
+	arg, err := blockNumberArg("getBlockByNumber", number)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ec.getBlockByNumber(ctx, "getBlockByNumber", ec.group(ctx, groupId), arg, true)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if err := ec.verifyBlock(ctx, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// HeaderByNumber returns the header of a block, with the block numbers of
+// BlockByNumber.
+func (ec *Client) HeaderByNumber(ctx context.Context, groupId uint64, number *big.Int) (*types.BlockHeader, error) {
+	arg, err := blockNumberArg("getBlockByNumber", number)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ec.getHeader(ctx, "getBlockByNumber", ec.group(ctx, groupId), arg, false)
+	return header, notFound(err)
 }
 func (ec *Client) TotalTransactionCount(ctx context.Context, groupId uint64) (*types.TotalTransactionCount, error) {
-	return ec.getTotalTransactionCount(ctx, "getTotalTransactionCount", groupId)
+	return ec.getTotalTransactionCount(ctx, "getTotalTransactionCount", ec.group(ctx, groupId))
 }
 func (ec *Client) TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error) {
-	return ec.getTransactionReceipt(ctx, "getTransactionReceipt", groupId, txHash)
+	return ec.getTransactionReceipt(ctx, "getTransactionReceipt", ec.group(ctx, groupId), txHash)
 }
-func (ec *Client) TransactionByBlockNumberAndIndex(ctx context.Context, groupId uint64, blockNumber string, transactionIndex string) (*types.TransactionByHash, error) {
-	return ec.getTransactionByBlockNumberAndIndex(ctx, "getTransactionByBlockNumberAndIndex", groupId, blockNumber, transactionIndex)
+
+// TransactionByBlockNumberAndIndex returns the transaction at index in a block.
+// number is nil or the LatestBlock tag for the latest block. It fails
+// with fiscobcos.NotFound if the block doesn't exist or has no transaction at
+// index.
+func (ec *Client) TransactionByBlockNumberAndIndex(ctx context.Context, groupId uint64, number *big.Int, index uint) (*types.TransactionByHash, error) {
+	arg, err := blockNumberArg("getTransactionByBlockNumberAndIndex", number)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := ec.getTransactionByBlockNumberAndIndex(ctx, "getTransactionByBlockNumberAndIndex", ec.group(ctx, groupId), arg, hexutil.EncodeUint64(uint64(index)))
+	return tx, notFound(err)
 }
-func (ec *Client) TransactionByBlockHashAndIndex(ctx context.Context, groupId uint64, blockHash string, transactionIndex string) (*types.TransactionByHash, error) {
-	return ec.getTransactionByBlockHashAndIndex(ctx, "getTransactionByBlockHashAndIndex", groupId, blockHash, transactionIndex)
+
+// TransactionByBlockHashAndIndex returns the transaction at index in the block
+// with hash. It fails with fiscobcos.NotFound if the block doesn't exist or has
+// no transaction at index.
+func (ec *Client) TransactionByBlockHashAndIndex(ctx context.Context, groupId uint64, hash common.Hash, index uint) (*types.TransactionByHash, error) {
+	tx, err := ec.getTransactionByBlockHashAndIndex(ctx, "getTransactionByBlockHashAndIndex", ec.group(ctx, groupId), hash, hexutil.EncodeUint64(uint64(index)))
+	return tx, notFound(err)
 }
-func (ec *Client) TransactionByHash(ctx context.Context, groupId uint64, transactionHash string) (*types.TransactionByHash, error) {
-	return ec.getTransactionByHash(ctx, "getTransactionByBlockHashAndIndex", groupId, transactionHash)
+
+// TransactionByBlockNumberAndIndexHex is TransactionByBlockNumberAndIndex taking
+// the block number and index as hex strings, which are passed to the node as is.
+//
+// Deprecated: use TransactionByBlockNumberAndIndex.
+func (ec *Client) TransactionByBlockNumberAndIndexHex(ctx context.Context, groupId uint64, blockNumber string, transactionIndex string) (*types.TransactionByHash, error) {
+	return ec.getTransactionByBlockNumberAndIndex(ctx, "getTransactionByBlockNumberAndIndex", ec.group(ctx, groupId), blockNumber, transactionIndex)
 }
-func (ec *Client) PbftView(ctx context.Context, groupId uint64) (string, error) {
-	return ec.getPbftView(ctx, "getPbftView", groupId)
+
+// TransactionByBlockHashAndIndexHex is TransactionByBlockHashAndIndex taking the
+// block hash and index as hex strings, which are passed to the node as is.
+//
+// Deprecated: use TransactionByBlockHashAndIndex.
+func (ec *Client) TransactionByBlockHashAndIndexHex(ctx context.Context, groupId uint64, blockHash string, transactionIndex string) (*types.TransactionByHash, error) {
+	return ec.getTransactionByBlockHashAndIndex(ctx, "getTransactionByBlockHashAndIndex", ec.group(ctx, groupId), blockHash, transactionIndex)
+}
+
+// TransactionByHash returns a transaction of the group, sealed or pending.
+func (ec *Client) TransactionByHash(ctx context.Context, groupId uint64, txHash common.Hash) (*types.TransactionByHash, error) {
+	return ec.getTransactionByHash(ctx, "getTransactionByHash", ec.group(ctx, groupId), txHash)
+}
+func (ec *Client) PbftView(ctx context.Context, groupId uint64) (uint64, error) {
+	return ec.getUint64(ctx, "getPbftView", ec.group(ctx, groupId))
 }
+
+// BlockHashByNumber returns the hash of a block. It fails with
+// fiscobcos.NotFound for blocks beyond the head.
 func (ec *Client) BlockHashByNumber(ctx context.Context, groupId uint64, blockNumber uint64) (*common.Hash, error) {
-	return ec.getBlockHashByNumber(ctx, "getBlockHashByNumber", groupId, string(blockNumber))
+	hash, err := ec.getBlockHashByNumber(ctx, "getBlockHashByNumber", ec.group(ctx, groupId), blockNumberArgUint64("getBlockHashByNumber", blockNumber))
+	return hash, notFound(err)
+}
+
+// BlockExists reports whether a block has been committed. It only requests the
+// block hash, which is cheaper than retrieving the block.
+func (ec *Client) BlockExists(ctx context.Context, groupId uint64, blockNumber uint64) (bool, error) {
+	_, err := ec.BlockHashByNumber(ctx, groupId, blockNumber)
+	switch err {
+	case nil:
+		return true, nil
+	case fiscobcos.NotFound:
+		return false, nil
+	}
+	return false, err
 }
-func (ec *Client) PendingTxSize(ctx context.Context, groupId uint64) (string, error) {
-	return ec.getPendingTxSize(ctx, "getPendingTxSize", groupId)
+func (ec *Client) PendingTxSize(ctx context.Context, groupId uint64) (uint64, error) {
+	return ec.getUint64(ctx, "getPendingTxSize", ec.group(ctx, groupId))
 }
 
 func (ec *Client) Code(ctx context.Context, groupId uint64, contraddress string) (string, error) {
-	return ec.getCode(ctx, "getCode", groupId, contraddress)
+	return ec.getCode(ctx, "getCode", ec.group(ctx, groupId), contraddress)
 }
 func (ec *Client) SystemConfigByKey(ctx context.Context, groupId uint64, key string) (string, error) {
-	return ec.getSystemConfigByKey(ctx, "getSystemConfigByKey", groupId, key)
+	return ec.getSystemConfigByKey(ctx, "getSystemConfigByKey", ec.group(ctx, groupId), key)
 }
 func (ec *Client) SealerList(ctx context.Context, groupId uint64) ([]string, error) {
-	return ec.getSealerList(ctx, "getSealerList", groupId)
+	return ec.getSealerList(ctx, "getSealerList", ec.group(ctx, groupId))
 }
 func (ec *Client) ObserverList(ctx context.Context, groupId uint64) ([]string, error) {
-	return ec.getObserverList(ctx, "getObserverList", groupId)
+	return ec.getObserverList(ctx, "getObserverList", ec.group(ctx, groupId))
 }
-func (ec *Client) ConsensusStatus(ctx context.Context, groupId uint64) ([]interface{}, error) {
-	return ec.getConsensusStatus(ctx, "getConsensusStatus", groupId)
+func (ec *Client) ConsensusStatus(ctx context.Context, groupId uint64) (*types.ConsensusStatus, error) {
+	return ec.getConsensusStatus(ctx, "getConsensusStatus", ec.group(ctx, groupId))
 }
+
+// Peers returns the nodes connected to the node. The connections are not scoped
+// to a group, but the node requires a group parameter on every method; groupId
+// is resolved as usual and only has to name a group of the node.
 func (ec *Client) Peers(ctx context.Context, groupId uint64) ([]types.PeerStatus, error) {
-	return ec.getPeers(ctx, "getPeers", groupId)
+	return ec.getPeers(ctx, "getPeers", ec.group(ctx, groupId))
 }
+
+// PeerCount returns the number of nodes connected to the node, using the group
+// of the context or the client default for the request.
+func (ec *Client) PeerCount(ctx context.Context) (int, error) {
+	peers, err := ec.Peers(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	return len(peers), nil
+}
+
 func (ec *Client) GroupPeers(ctx context.Context, groupId uint64) ([]string, error) {
-	return ec.getGroupPeers(ctx, "getGroupPeers", groupId)
+	return ec.getGroupPeers(ctx, "getGroupPeers", ec.group(ctx, groupId))
 }
+
+// NodeIDList returns the id of the node followed by the ids of the connected
+// nodes; Peers has the details of the connections.
 func (ec *Client) NodeIDList(ctx context.Context, groupId uint64) ([]string, error) {
-	return ec.getNodeIDList(ctx, "getNodeIDList", groupId)
+	return ec.getNodeIDList(ctx, "getNodeIDList", ec.group(ctx, groupId))
 }
+
+// GroupList returns the ids of the groups of the node, see Groups.
 func (ec *Client) GroupList(ctx context.Context) ([]int64, error) {
-	return ec.getGroupList(ctx, "getGroupList")
+	groups, err := ec.groups(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(groups))
+	for i, group := range groups {
+		ids[i] = int64(group.ID)
+	}
+	return ids, nil
 }
 
+// PendingTransactions returns all transactions of the transaction pool. Busy
+// pools can hold tens of thousands; see PendingTransactionsPaged.
 func (ec *Client) PendingTransactions(ctx context.Context, groupId uint64) ([]types.PendingTx, error) {
-	return ec.getPendingTransactions(ctx, "getPendingTransactions", groupId)
+	return ec.getPendingTransactions(ctx, 0, 0, "getPendingTransactions", ec.group(ctx, groupId))
 }
 
 func (ec *Client) getClientVersion(ctx context.Context, method string, args ...interface{}) (*types.ClientVersion, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result *types.ClientVersion
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getBlock(ctx context.Context, method string, args ...interface{}) (*types.Block, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
 	// Decode header and transactions.
 	var result *types.Block
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getBlockNumber(ctx context.Context, method string, args ...interface{}) (*big.Int, error) {
-	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
+	height, err := ec.getUint64(ctx, method, args...)
 	if err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	height, err := hexutil.DecodeUint64(raw)
-	return big.NewInt(int64(height)), err
+	return new(big.Int).SetUint64(height), nil
 }
-func (ec *Client) getSyncStatus(ctx context.Context, method string, args ...interface{}) (*types.SyncStatus, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
+
+// getUint64 retrieves a quantity the node returns as a hex string, or as a
+// decimal string or number on some versions.
+func (ec *Client) getUint64(ctx context.Context, method string, args ...interface{}) (uint64, error) {
+	var result hexutil.FlexibleUint64
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
+		return 0, err
 	}
-	// Decode header and transactions.
+	return uint64(result), nil
+}
+func (ec *Client) getSyncStatus(ctx context.Context, method string, args ...interface{}) (*types.SyncStatus, error) {
 	var result *types.SyncStatus
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getBlockByNumber(ctx context.Context, method string, args ...interface{}) (*types.Block, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
 	// Decode header and transactions.
 	var result *types.Block
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
-func (ec *Client) getTotalTransactionCount(ctx context.Context, method string, args ...interface{}) (*types.TotalTransactionCount, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+func (ec *Client) getHeader(ctx context.Context, method string, args ...interface{}) (*types.BlockHeader, error) {
+	// Decode the header, transaction hashes are dropped.
+	var result *types.BlockHeader
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	// Decode header and transactions.
+	return result, nil
+}
+func (ec *Client) getTotalTransactionCount(ctx context.Context, method string, args ...interface{}) (*types.TotalTransactionCount, error) {
 	var result *types.TotalTransactionCount
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getTransactionReceipt(ctx context.Context, method string, args ...interface{}) (*types.Receipt, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result *types.Receipt
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getTransactionByBlockNumberAndIndex(ctx context.Context, method string, args ...interface{}) (*types.TransactionByHash, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result *types.TransactionByHash
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getTransactionByBlockHashAndIndex(ctx context.Context, method string, args ...interface{}) (*types.TransactionByHash, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result *types.TransactionByHash
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getTransactionByHash(ctx context.Context, method string, args ...interface{}) (*types.TransactionByHash, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result *types.TransactionByHash
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
-}
-func (ec *Client) getPbftView(ctx context.Context, method string, args ...interface{}) (string, error) {
-	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return "", err
-	} else if len(raw) == 0 {
-		return "", fiscobcos.NotFound
-	}
-	return raw, err
+	return result, nil
 }
 func (ec *Client) getBlockHashByNumber(ctx context.Context, method string, args ...interface{}) (*common.Hash, error) {
 	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
+	err := ec.callResult(ctx, &raw, method, args...)
 	if err != nil {
 		return nil, err
 	} else if len(raw) == 0 {
@@ -299,19 +537,9 @@ func (ec *Client) getBlockHashByNumber(ctx context.Context, method string, args
 	blockHash := common.HexToHash(raw)
 	return &blockHash, nil
 }
-func (ec *Client) getPendingTxSize(ctx context.Context, method string, args ...interface{}) (string, error) {
-	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return "", err
-	} else if len(raw) == 0 {
-		return "", fiscobcos.NotFound
-	}
-	return raw, err
-}
 func (ec *Client) getCode(ctx context.Context, method string, args ...interface{}) (string, error) {
 	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
+	err := ec.callResult(ctx, &raw, method, args...)
 	if err != nil {
 		return "", err
 	} else if len(raw) == 0 {
@@ -321,7 +549,7 @@ func (ec *Client) getCode(ctx context.Context, method string, args ...interface{
 }
 func (ec *Client) getSystemConfigByKey(ctx context.Context, method string, args ...interface{}) (string, error) {
 	var raw string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
+	err := ec.callResult(ctx, &raw, method, args...)
 	if err != nil {
 		return "", err
 	} else if len(raw) == 0 {
@@ -331,137 +559,194 @@ func (ec *Client) getSystemConfigByKey(ctx context.Context, method string, args
 }
 func (ec *Client) getSealerList(ctx context.Context, method string, args ...interface{}) ([]string, error) {
 	var raw []string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	return raw, nil
 }
 func (ec *Client) getObserverList(ctx context.Context, method string, args ...interface{}) ([]string, error) {
 	var raw []string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	return raw, nil
 }
-func (ec *Client) getConsensusStatus(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
-	var raw []interface{}
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+func (ec *Client) getConsensusStatus(ctx context.Context, method string, args ...interface{}) (*types.ConsensusStatus, error) {
+	// Decode the status object and node views.
+	var result *types.ConsensusStatus
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	return result, nil
 }
 func (ec *Client) getPeers(ctx context.Context, method string, args ...interface{}) ([]types.PeerStatus, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
-		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
-	}
-	// Decode header and transactions.
 	var result []types.PeerStatus
-	if err := json.Unmarshal(raw, &result); err != nil {
+	if err := ec.callResult(ctx, &result, method, args...); err != nil {
 		return nil, err
 	}
-	return result, err
+	return result, nil
 }
 func (ec *Client) getGroupPeers(ctx context.Context, method string, args ...interface{}) ([]string, error) {
 	var raw []string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	return raw, nil
 }
 func (ec *Client) getNodeIDList(ctx context.Context, method string, args ...interface{}) ([]string, error) {
 	var raw []string
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	return raw, nil
 }
 func (ec *Client) getGroupList(ctx context.Context, method string, args ...interface{}) ([]int64, error) {
-	var raw []int64
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+	var raw []hexutil.FlexibleUint64 // old nodes list the groups as strings
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	return raw, err
+	groups := make([]int64, len(raw))
+	for i, groupId := range raw {
+		groups[i] = int64(groupId)
+	}
+	return groups, nil
 }
-func (ec *Client) getPendingTransactions(ctx context.Context, method string, args ...interface{}) ([]types.PendingTx, error) {
-	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
-	if err != nil {
+
+// CodeAt returns the contract code of the given account, nil if it has none.
+// FISCO BCOS nodes only serve the code at the latest block, so blockNumber is
+// ignored; pass nil or rpc.LatestBlockNumber.Big().
+func (ec *Client) CodeAt(ctx context.Context, groupId uint64, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	var result string
+	if err := ec.call(ctx, &result, "getCode", ec.group(ctx, groupId), account); err != nil {
 		return nil, err
-	} else if len(raw) == 0 {
-		return nil, fiscobcos.NotFound
 	}
-	// Decode header and transactions.
-	var result []types.PendingTx
-	if err := json.Unmarshal(raw, &result); err != nil {
-		return nil, err
+	// Accounts without code are answered with "0x", or an empty string by some
+	// node versions.
+	if result == "" || result == "0x" {
+		return nil, nil
 	}
-	return result, err
+	return hexutil.Decode(result)
 }
 
-func toBlockNumArg(number *big.Int) string {
-	if number == nil {
-		return "latest"
+// HasCode reports whether a contract is deployed at the given address.
+func (ec *Client) HasCode(ctx context.Context, groupId uint64, account common.Address) (bool, error) {
+	code, err := ec.CodeAt(ctx, groupId, account, nil)
+	if err != nil {
+		return false, err
 	}
-	return hexutil.EncodeBig(number)
-}
-
-// CodeAt returns the contract code of the given account.
-// The block number can be nil, in which case the code is taken from the latest known block.
-func (ec *Client) CodeAt(ctx context.Context, groupId int, account common.Address, blockNumber *big.Int) ([]byte, error) {
-	var result hexutil.Bytes
-	err := ec.c.CallContext(ctx, &result, "getCode", groupId, account, toBlockNumArg(blockNumber))
-	return result, err
+	return len(code) > 0, nil
 }
 
 // Contract Calling
 
+// historicalCallVersion is the first supported version of nodes executing calls
+// at a given block. No 2.x release does; their nodes ignore a block number
+// passed to call and execute it against the latest state.
+const historicalCallVersion = "3.0.0"
+
+// ErrHistoricalCallUnsupported is returned by CallContract if a block number is
+// given but the node can only execute calls against the latest state.
+var ErrHistoricalCallUnsupported = errors.New("node does not support calls at a past block")
+
 // CallContract executes a message call transaction, which is directly executed in the VM
 // of the node, but never mined into the blockchain.
 //
-// blockNumber selects the block height at which the call runs. It can be nil, in which
-// case the code is taken from the latest known block. Note that state from very old
-// blocks might not be available.
+// blockNumber selects the block height at which the call runs. It can be nil or the
+// rpc.LatestBlockNumber tag, in which case the code is taken from the latest known block. Note that state from very old
+// blocks might not be available. Nodes which can't execute calls at a given block
+// fail them with ErrHistoricalCallUnsupported.
+//
+// A reverted execution is reported as *RevertError, another failed one as *Error
+// carrying the execution status, e.g. matching ErrContractFrozen. See
+// CallContractDetailed for the raw result.
 func (ec *Client) CallContract(ctx context.Context, msg fiscobcos.CallMsg, blockNumber *big.Int) ([]byte, error) {
-	var hex hexutil.Bytes
-	err := ec.c.CallContext(ctx, &hex, "call", msg.GroupId, toCallArg(msg.Msg))
+	result, err := ec.CallContractDetailed(ctx, msg, blockNumber)
 	if err != nil {
 		return nil, err
 	}
-	return hex, nil
+	switch result.Status {
+	case types.StatusSuccess:
+		return result.Output, nil
+	case types.StatusRevertInstruction:
+		reason, _ := result.RevertReason()
+		return nil, &RevertError{Reason: reason, Output: result.Output}
+	default:
+		return nil, &Error{Code: result.Status, Message: types.StatusMessage(result.Status), Err: codeErrors[result.Status]}
+	}
+}
+
+// CallContractDetailed is like CallContract, but returns the result of the call
+// including its execution status rather than failing if the execution failed.
+func (ec *Client) CallContractDetailed(ctx context.Context, msg fiscobcos.CallMsg, blockNumber *big.Int) (*types.CallResult, error) {
+	args := []interface{}{ec.group(ctx, uint64(msg.GroupId)), toCallArg(msg.Msg)}
+	if !isLatestBlock(blockNumber) {
+		arg, err := blockNumberArg("call", blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		version, err := ec.nodeVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !version.AtLeast(historicalCallVersion) {
+			return nil, ErrHistoricalCallUnsupported
+		}
+		args = append(args, arg)
+	}
+	var result types.CallResult
+	if err := ec.call(ctx, &result, "call", args...); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PendingCodeAt returns the contract code of the given account. FISCO BCOS has no
+// pending state, so this is the code at the latest block of the client default group.
+func (ec *Client) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return ec.CodeAt(ctx, 0, account, nil)
+}
+
+// PendingCallContract executes a message call transaction against the latest
+// block, FISCO BCOS having no pending state.
+func (ec *Client) PendingCallContract(ctx context.Context, msg fiscobcos.CallMsg) ([]byte, error) {
+	return ec.CallContract(ctx, msg, nil)
 }
 
 // SendTransaction injects a signed transaction into the pending pool for execution.
+// The transaction is sent to the group it is signed for. Transactions without
+// group go to the group carried by ctx, or the client default.
 //
 // If the transaction was a contract creation use the TransactionReceipt method to get the
 // contract address after the transaction has been mined.
+//
+// Transactions turned away by the node fail with an *Error matching the reason,
+// however the node version words it: ErrTxPoolIsFull, ErrNonceCheckFail,
+// ErrBlockLimitCheckFail, ErrTxAlreadyKnown, ErrTxAlreadyInChain or
+// ErrInvalidSignature. A full pool leaves the transaction unknown to the node,
+// so the same payload may be sent again later, see WithRetry.
 func (ec *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := encodeTx(tx)
 	if err != nil {
 		return err
 	}
-	return ec.c.CallContext(ctx, nil, "sendRawTransaction", 1, common.ToHex(data))
+	groupId, err := ec.txGroup(ctx, "sendRawTransaction", 0, tx)
+	if err != nil {
+		return err
+	}
+	return ec.call(ctx, nil, "sendRawTransaction", groupId, data)
+}
+
+// encodeTx returns the hex encoded RLP encoding of tx, as sendRawTransaction
+// takes it. The encoding is made in a pooled buffer, only the hex string is
+// allocated.
+func encodeTx(tx *types.Transaction) (string, error) {
+	buf := rlp.NewEncoderBuffer()
+	defer buf.Release()
+	data, err := buf.Encode(tx)
+	if err != nil {
+		return "", err
+	}
+	return common.ToHex(data), nil
 }
 
 func toCallArg(msg fiscobcos.CallEthMsg) interface{} {
@@ -484,12 +769,3 @@ func toCallArg(msg fiscobcos.CallEthMsg) interface{} {
 
 	return arg
 }
-
-func (ec *Client) FilterLogs(ctx context.Context, q fiscobcos.FilterQuery) ([]types.Log, error) {
-	return nil, errors.New("FiscoBcos doesn't provide this function.")
-}
-
-// SubscribeFilterLogs subscribes to the results of a streaming filter query.
-func (ec *Client) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
-	return nil, errors.New("FiscoBcos doesn't provide this function.")
-}
\ No newline at end of file
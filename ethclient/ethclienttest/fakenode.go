@@ -0,0 +1,482 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethclienttest provides a fake node for testing code built on
+// ethclient.Client.
+package ethclienttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// Call is a JSON-RPC request received by the fake node.
+type Call struct {
+	Method  string
+	Params  []json.RawMessage
+	Channel bool // received over the channel protocol rather than HTTP
+}
+
+// Handler computes the response to a request. A non-nil error is sent as error
+// response, with the code of an *Error or -32000 for other errors.
+type Handler func(params []json.RawMessage) (result interface{}, err error)
+
+// Error is an error response with a specific code, as returned by handlers.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// FakeNode is a JSON-RPC server standing in for a FISCO BCOS node in tests. It
+// serves HTTP and the channel protocol, records the requests it receives and
+// answers them with the responses registered per method. Requests for methods
+// without response fail with a method not found error.
+type FakeNode struct {
+	t testing.TB
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	replies  map[rpc.ChannelPack][]byte
+	calls    []Call
+	frames   []rpc.ChannelMessage
+	conns    map[net.Conn]*sync.Mutex
+	clients  []*ethclient.Client
+
+	http      *httptest.Server
+	listener  net.Listener
+	cert      tls.Certificate // certificate of the channel port
+	tlsConfig *tls.Config     // trusting the certificate of the channel port
+}
+
+// NewFakeNode starts a fake node listening on the local loopback interface. It
+// must be closed with Close.
+func NewFakeNode(t testing.TB) *FakeNode {
+	n := &FakeNode{
+		t:        t,
+		handlers: make(map[string]Handler),
+		replies:  make(map[rpc.ChannelPack][]byte),
+		conns:    make(map[net.Conn]*sync.Mutex),
+	}
+	n.http = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		n.http.Close()
+		t.Fatalf("ethclienttest: generating certificate: %v", err)
+	}
+	n.listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		n.http.Close()
+		t.Fatalf("ethclienttest: listening: %v", err)
+	}
+	n.cert = cert
+	n.tlsConfig = &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	go n.acceptChannel()
+	return n
+}
+
+// URL returns the HTTP endpoint of the node.
+func (n *FakeNode) URL() string { return n.http.URL }
+
+// ChannelAddr returns the "host:port" address of the channel port.
+func (n *FakeNode) ChannelAddr() string { return n.listener.Addr().String() }
+
+// ChannelTLSConfig returns a TLS configuration for connecting to the channel port,
+// see rpc.DialChannelTLS.
+func (n *FakeNode) ChannelTLSConfig() *tls.Config { return n.tlsConfig.Clone() }
+
+// ChannelCertFiles writes the certificate files of the channel transport to dir,
+// see ethclient.WithChannelCerts: the node's certificate as CA, and an SDK
+// certificate and key, which the node accepts whatever they are.
+func (n *FakeNode) ChannelCertFiles(dir string) (caCert, sdkCert, sdkKey string) {
+	n.t.Helper()
+	sdk, _, err := selfSignedCert()
+	if err != nil {
+		n.t.Fatalf("ethclienttest: generating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(sdk.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		n.t.Fatalf("ethclienttest: encoding key: %v", err)
+	}
+	caCert, sdkCert, sdkKey = filepath.Join(dir, "ca.crt"), filepath.Join(dir, "sdk.crt"), filepath.Join(dir, "sdk.key")
+	files := []struct {
+		path string
+		pem  *pem.Block
+	}{
+		{caCert, &pem.Block{Type: "CERTIFICATE", Bytes: n.cert.Certificate[0]}},
+		{sdkCert, &pem.Block{Type: "CERTIFICATE", Bytes: sdk.Certificate[0]}},
+		{sdkKey, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f.path, pem.EncodeToMemory(f.pem), 0600); err != nil {
+			n.t.Fatalf("ethclienttest: writing %s: %v", f.path, err)
+		}
+	}
+	return caCert, sdkCert, sdkKey
+}
+
+// Client returns a client connected to the node over HTTP. It is closed along
+// with the node.
+func (n *FakeNode) Client() *ethclient.Client {
+	n.t.Helper()
+	ec, err := ethclient.Dial(n.URL())
+	if err != nil {
+		n.t.Fatalf("ethclienttest: dialing %s: %v", n.URL(), err)
+	}
+	n.addClient(ec)
+	return ec
+}
+
+// ChannelClient returns a client connected to the node over the channel
+// protocol. It is closed along with the node.
+func (n *FakeNode) ChannelClient() *ethclient.Client {
+	n.t.Helper()
+	c, err := rpc.DialChannelTLS(context.Background(), n.ChannelAddr(), n.ChannelTLSConfig())
+	if err != nil {
+		n.t.Fatalf("ethclienttest: dialing %s: %v", n.ChannelAddr(), err)
+	}
+	ec := ethclient.NewClient(c)
+	n.addClient(ec)
+	return ec
+}
+
+func (n *FakeNode) addClient(ec *ethclient.Client) {
+	n.mu.Lock()
+	n.clients = append(n.clients, ec)
+	n.mu.Unlock()
+}
+
+// Close closes the clients returned by the node and stops it.
+func (n *FakeNode) Close() {
+	n.mu.Lock()
+	clients := n.clients
+	n.clients = nil
+	n.mu.Unlock()
+
+	for _, ec := range clients {
+		ec.Close()
+	}
+	n.listener.Close()
+	n.mu.Lock()
+	for conn := range n.conns {
+		conn.Close()
+	}
+	n.mu.Unlock()
+	n.http.Close()
+}
+
+// Handle registers the handler answering the requests for method, replacing the
+// response registered before.
+func (n *FakeNode) Handle(method string, h Handler) {
+	n.mu.Lock()
+	n.handlers[method] = h
+	n.mu.Unlock()
+}
+
+// Respond registers result, encoded to JSON, as response to method. A nil result
+// is sent as null.
+func (n *FakeNode) Respond(method string, result interface{}) {
+	n.Handle(method, func([]json.RawMessage) (interface{}, error) { return result, nil })
+}
+
+// RespondRaw registers raw JSON as response to method, such as `""` or `{}` for
+// the empty results some nodes send for missing items.
+func (n *FakeNode) RespondRaw(method string, raw string) {
+	n.Respond(method, json.RawMessage(raw))
+}
+
+// RespondError registers an error response with the given code to method.
+func (n *FakeNode) RespondError(method string, code int, message string) {
+	n.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return nil, &Error{Code: code, Message: message}
+	})
+}
+
+// Calls returns the requests received so far, in order.
+func (n *FakeNode) Calls() []Call {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Call(nil), n.calls...)
+}
+
+// CallsTo returns the requests for method received so far, in order.
+func (n *FakeNode) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range n.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the requests and channel messages received so far.
+func (n *FakeNode) Reset() {
+	n.mu.Lock()
+	n.calls, n.frames = nil, nil
+	n.mu.Unlock()
+}
+
+// RespondChannel registers body as reply to the channel messages of type typ
+// other than JSON-RPC, such as TYPE_EVENT_LOG_REGISTER. Messages of types without
+// reply are recorded only.
+func (n *FakeNode) RespondChannel(typ rpc.ChannelPack, body []byte) {
+	n.mu.Lock()
+	n.replies[typ] = body
+	n.mu.Unlock()
+}
+
+// Frames returns the channel messages other than JSON-RPC and heartbeats received
+// so far, in order.
+func (n *FakeNode) Frames() []rpc.ChannelMessage {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]rpc.ChannelMessage(nil), n.frames...)
+}
+
+// Push sends a message of type typ to all clients connected over the channel
+// protocol, as the node pushes notifications.
+func (n *FakeNode) Push(typ rpc.ChannelPack, body []byte) {
+	raw := rpc.NewMsgSeq()
+	msg := &rpc.ChannelMessage{Type: typ, Payload: body}
+	hex.Encode(msg.Seq[:], raw[:])
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for conn, wmu := range n.conns {
+		n.writeFrame(conn, wmu, msg)
+	}
+}
+
+// DropChannels closes the channel connections of the node, as a node restart
+// does. The channel port keeps listening, so clients can reconnect.
+func (n *FakeNode) DropChannels() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for conn := range n.conns {
+		conn.Close()
+	}
+}
+
+// PushBlockNumber notifies the channel clients of a new block of a group, see
+// ethclient.Client.SubscribeBlockNumber.
+func (n *FakeNode) PushBlockNumber(groupId, number uint64) {
+	topic := "_block_notify_" + strconv.FormatUint(groupId, 10)
+	body := append([]byte{byte(len(topic) + 1)}, topic...)
+	body = append(body, strconv.FormatUint(groupId, 10)+","+strconv.FormatUint(number, 10)...)
+	n.Push(rpc.TYPE_TX_BLOCKNUM, body)
+}
+
+func (n *FakeNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(n.serveJSON(body, false))
+}
+
+// request is a JSON-RPC request.
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is a JSON-RPC response.
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// serveJSON answers a single JSON-RPC request or a batch of them.
+func (n *FakeNode) serveJSON(body []byte, channel bool) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return n.encode(&response{Version: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: err.Error()}})
+		}
+		resps := make([]*response, len(reqs))
+		for i := range reqs {
+			resps[i] = n.serve(&reqs[i], channel)
+		}
+		return n.encode(resps)
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return n.encode(&response{Version: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: err.Error()}})
+	}
+	return n.encode(n.serve(&req, channel))
+}
+
+func (n *FakeNode) serve(req *request, channel bool) *response {
+	n.mu.Lock()
+	n.calls = append(n.calls, Call{Method: req.Method, Params: req.Params, Channel: channel})
+	h, ok := n.handlers[req.Method]
+	n.mu.Unlock()
+
+	resp := &response{Version: "2.0", ID: req.ID}
+	if !ok {
+		n.t.Logf("ethclienttest: no response registered for %s", req.Method)
+		resp.Error = &Error{Code: -32601, Message: "the method " + req.Method + " does not exist/is not available"}
+		return resp
+	}
+	result, err := h(req.Params)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			resp.Error = e
+		} else {
+			resp.Error = &Error{Code: -32000, Message: err.Error()}
+		}
+		return resp
+	}
+	enc, err := json.Marshal(result)
+	if err != nil {
+		n.t.Errorf("ethclienttest: encoding %s response: %v", req.Method, err)
+		resp.Error = &Error{Code: -32603, Message: err.Error()}
+		return resp
+	}
+	resp.Result = enc
+	return resp
+}
+
+func (n *FakeNode) encode(v interface{}) []byte {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		n.t.Errorf("ethclienttest: encoding response: %v", err)
+	}
+	return enc
+}
+
+func (n *FakeNode) acceptChannel() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		wmu := new(sync.Mutex)
+		n.mu.Lock()
+		n.conns[conn] = wmu
+		n.mu.Unlock()
+		go n.serveChannel(conn, wmu)
+	}
+}
+
+// serveChannel answers the channel messages of a connection until it breaks.
+func (n *FakeNode) serveChannel(conn net.Conn, wmu *sync.Mutex) {
+	defer func() {
+		n.mu.Lock()
+		delete(n.conns, conn)
+		n.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		var msg rpc.ChannelMessage
+		if err := msg.DecodeFrom(conn); err != nil {
+			return
+		}
+		switch msg.Type {
+		case rpc.TYPE_HEATBEAT:
+			// Heartbeats are echoed, like the node does.
+			n.mu.Lock()
+			n.writeFrame(conn, wmu, &rpc.ChannelMessage{Type: rpc.TYPE_HEATBEAT, Seq: msg.Seq, Payload: []byte("1")})
+			n.mu.Unlock()
+		case rpc.TYPE_RPC:
+			reply := &rpc.ChannelMessage{Type: rpc.TYPE_RPC, Seq: msg.Seq, Payload: n.serveJSON(msg.Payload, true)}
+			n.mu.Lock()
+			n.writeFrame(conn, wmu, reply)
+			n.mu.Unlock()
+		default:
+			n.mu.Lock()
+			n.frames = append(n.frames, msg)
+			if body, ok := n.replies[msg.Type]; ok {
+				n.writeFrame(conn, wmu, &rpc.ChannelMessage{Type: msg.Type, Seq: msg.Seq, Payload: body})
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// writeFrame sends a channel message on conn, serialized by wmu.
+func (n *FakeNode) writeFrame(conn net.Conn, wmu *sync.Mutex, msg *rpc.ChannelMessage) {
+	enc, err := msg.Encode()
+	if err != nil {
+		n.t.Errorf("ethclienttest: encoding channel message: %v", err)
+		return
+	}
+	wmu.Lock()
+	defer wmu.Unlock()
+	conn.Write(enc)
+}
+
+// selfSignedCert creates the certificate of the channel port and a pool
+// trusting it.
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ethclienttest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package ethclient
+
+import (
+	"context"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+// SubscribeContractEvents subscribes to the events of a few contracts. The node
+// is given a filter for the addresses, so only their logs are pushed, see
+// SubscribeFilterLogs. Each log is decoded with the ABI at the same position
+// as its contract's address and delivered along with the log, which carries
+// the transaction hash and block number. Logs whose first topic matches no
+// event of the ABI, or which fail to decode, are delivered as raw events
+// rather than dropped, see bind.DecodedEvent.
+//
+// Like SubscribeFilterLogs it needs the channel transport. The subscription
+// ends when unsubscribed, when the client is closed or if the underlying log
+// subscription fails, reporting its error.
+func (ec *Client) SubscribeContractEvents(ctx context.Context, groupId uint64, addresses []common.Address, abis []abi.ABI, ch chan<- bind.DecodedEvent) (fiscobcos.Subscription, error) {
+	const method = "SubscribeContractEvents"
+	if len(addresses) == 0 {
+		return nil, &ValidationError{Method: method, Param: "addresses", Value: addresses, Reason: "no contract addresses"}
+	}
+	if len(abis) != len(addresses) {
+		return nil, &ValidationError{Method: method, Param: "abis", Value: len(abis), Reason: "need one ABI per address"}
+	}
+	contracts := make(map[common.Address]*contractEvents, len(addresses))
+	for i, address := range addresses {
+		contracts[address] = newContractEvents(abis[i])
+	}
+	logs := make(chan types.Log, 16)
+	sub, err := ec.SubscribeFilterLogs(ctx, fiscobcos.FilterQuery{GroupId: groupId, Addresses: addresses}, logs)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(unsub <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case l := <-logs:
+				var decoded bind.DecodedEvent
+				if c := contracts[l.Address]; c != nil {
+					decoded = c.decode(&l)
+				} else {
+					decoded = bind.DecodedEvent{Log: &l, Raw: true}
+				}
+				select {
+				case ch <- decoded:
+				case <-unsub:
+					return nil
+				case err := <-sub.Err():
+					return err
+				}
+			case <-unsub:
+				return nil
+			case err := <-sub.Err():
+				return err
+			}
+		}
+	}), nil
+}
+
+// contractEvents decodes the logs of a contract.
+type contractEvents struct {
+	abi    abi.ABI
+	events map[common.Hash]abi.Event // by signature, anonymous events left out
+}
+
+func newContractEvents(contractABI abi.ABI) *contractEvents {
+	c := &contractEvents{abi: contractABI, events: make(map[common.Hash]abi.Event)}
+	for _, event := range contractABI.Events {
+		if !event.Anonymous {
+			c.events[event.Id()] = event
+		}
+	}
+	return c
+}
+
+// decode decodes a log of the contract, or returns it as a raw event.
+func (c *contractEvents) decode(l *types.Log) bind.DecodedEvent {
+	if len(l.Topics) > 0 {
+		if event, ok := c.events[l.Topics[0]]; ok {
+			args := make(map[string]interface{})
+			err := bind.UnpackLogIntoMap(c.abi, args, event.Name, *l)
+			if err == nil {
+				return bind.DecodedEvent{Name: event.Name, Event: event, Log: l, Args: args}
+			}
+			log.Debug("Failed to decode contract event", "address", l.Address, "event", event.Name, "tx", l.TxHash, "err", err)
+		}
+	}
+	return bind.DecodedEvent{Log: l, Raw: true}
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+const (
+	tokenEventsABI = `[{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}]`
+	vaultEventsABI = `[{"type":"event","name":"Deposit","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]}]`
+)
+
+func TestSubscribeContractEvents(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_REGISTER, []byte(`{"result":0}`))
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_UNREGISTER, []byte(`{"result":0}`))
+	client := node.ChannelClient()
+
+	tokenABI, err := abi.JSON(strings.NewReader(tokenEventsABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultABI, err := abi.JSON(strings.NewReader(vaultEventsABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		token, vault, other = common.Address{0x70}, common.Address{0x7a}, common.Address{0x07}
+		from, to            = common.Address{0xf1}, common.Address{0x71}
+		transfer            = tokenABI.Events["Transfer"].Id()
+		deposit             = vaultABI.Events["Deposit"].Id()
+		amount              = common.LeftPadBytes(big.NewInt(42).Bytes(), 32)
+	)
+	ctx := context.Background()
+
+	// Invalid arguments
+	invalid := []struct {
+		addresses []common.Address
+		abis      []abi.ABI
+		param     string
+	}{
+		{nil, nil, "addresses"},
+		{[]common.Address{}, []abi.ABI{tokenABI}, "addresses"},
+		{[]common.Address{token, vault}, []abi.ABI{tokenABI}, "abis"},
+		{[]common.Address{token}, []abi.ABI{tokenABI, vaultABI}, "abis"},
+	}
+	for i, test := range invalid {
+		_, err := client.SubscribeContractEvents(ctx, 1, test.addresses, test.abis, make(chan bind.DecodedEvent))
+		if verr, ok := err.(*ethclient.ValidationError); !ok || verr.Param != test.param {
+			t.Errorf("invalid %d: error %v, want a ValidationError of %s", i, err, test.param)
+		}
+	}
+	if _, err := node.Client().SubscribeContractEvents(ctx, 1, []common.Address{token}, []abi.ABI{tokenABI}, make(chan bind.DecodedEvent)); err != ethclient.ErrSubscriptionUnsupported {
+		t.Errorf("subscribing over HTTP: error %v, want ErrSubscriptionUnsupported", err)
+	}
+
+	events := make(chan bind.DecodedEvent)
+	sub, err := client.SubscribeContractEvents(ctx, 2, []common.Address{token, vault}, []abi.ABI{tokenABI, vaultABI}, events)
+	if err != nil {
+		t.Fatalf("SubscribeContractEvents error: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	var filter struct {
+		FilterID  string
+		GroupID   string
+		Addresses []common.Address
+	}
+	for _, frame := range node.Frames() {
+		if frame.Type == rpc.TYPE_EVENT_LOG_REGISTER {
+			json.Unmarshal(frame.Payload, &filter)
+		}
+	}
+	if filter.GroupID != "2" || len(filter.Addresses) != 2 || filter.Addresses[0] != token || filter.Addresses[1] != vault {
+		t.Fatalf("registered filter of group %s for %x, want group 2 for the token and the vault", filter.GroupID, filter.Addresses)
+	}
+
+	tests := []struct {
+		name string
+		log  *types.Log
+		want string // name of the decoded event, empty for a raw one
+		args map[string]interface{}
+	}{
+		{
+			name: "transfer",
+			log:  &types.Log{Address: token, Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: amount},
+			want: "Transfer",
+			args: map[string]interface{}{"from": from, "to": to, "value": big.NewInt(42)},
+		},
+		{
+			name: "deposit",
+			log:  &types.Log{Address: vault, Topics: []common.Hash{deposit, from.Hash()}, Data: amount},
+			want: "Deposit",
+			args: map[string]interface{}{"owner": from, "amount": big.NewInt(42)},
+		},
+		{
+			name: "unknown topic",
+			log:  &types.Log{Address: token, Topics: []common.Hash{common.HexToHash("0x01")}, Data: amount},
+		},
+		{
+			name: "event of the other contract",
+			log:  &types.Log{Address: vault, Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: amount},
+		},
+		{
+			name: "undecodable data",
+			log:  &types.Log{Address: token, Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: amount[:8]},
+		},
+		{
+			name: "anonymous",
+			log:  &types.Log{Address: token, Topics: []common.Hash{}, Data: amount},
+		},
+		{
+			name: "other address",
+			log:  &types.Log{Address: other, Topics: []common.Hash{transfer, from.Hash(), to.Hash()}, Data: amount},
+		},
+	}
+	push := struct {
+		FilterID string       `json:"filterID"`
+		Result   int          `json:"result"`
+		Logs     []*types.Log `json:"logs"`
+	}{FilterID: filter.FilterID}
+	for i, test := range tests {
+		test.log.TxHash = common.BigToHash(big.NewInt(int64(i + 1)))
+		test.log.BlockNumber = uint64(100 + i)
+		push.Logs = append(push.Logs, test.log)
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Push(rpc.TYPE_EVENT_LOG_PUSH, body)
+
+	for i, test := range tests {
+		var ev bind.DecodedEvent
+		select {
+		case ev = <-events:
+		case err := <-sub.Err():
+			t.Fatalf("%s: subscription ended: %v", test.name, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: not delivered", test.name)
+		}
+		if ev.Log == nil || ev.Log.TxHash != test.log.TxHash || ev.Log.BlockNumber != uint64(100+i) || ev.Log.Address != test.log.Address {
+			t.Errorf("%s: delivered with log %+v", test.name, ev.Log)
+			continue
+		}
+		if test.want == "" {
+			if !ev.Raw || ev.Name != "" || ev.Args != nil {
+				t.Errorf("%s: got event %s with args %v, raw %v; want a raw event", test.name, ev.Name, ev.Args, ev.Raw)
+			}
+			continue
+		}
+		if ev.Raw || ev.Name != test.want || ev.Event.Name != test.want {
+			t.Errorf("%s: got event %q, raw %v; want %s", test.name, ev.Name, ev.Raw, test.want)
+		}
+		if len(ev.Args) != len(test.args) {
+			t.Errorf("%s: got args %v, want %v", test.name, ev.Args, test.args)
+		}
+		for name, want := range test.args {
+			have := ev.Args[name]
+			if n, ok := want.(*big.Int); ok {
+				if h, ok := have.(*big.Int); !ok || h.Cmp(n) != 0 {
+					t.Errorf("%s: arg %s = %v, want %v", test.name, name, have, want)
+				}
+			} else if have != want {
+				t.Errorf("%s: arg %s = %v, want %v", test.name, name, have, want)
+			}
+		}
+	}
+
+	// Unsubscribing ends the log subscription.
+	sub.Unsubscribe()
+	deadline := time.Now().Add(5 * time.Second)
+	for !unregistered(node) {
+		if time.Now().After(deadline) {
+			t.Fatal("log filter not unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func unregistered(node *ethclienttest.FakeNode) bool {
+	for _, frame := range node.Frames() {
+		if frame.Type == rpc.TYPE_EVENT_LOG_UNREGISTER {
+			return true
+		}
+	}
+	return false
+}
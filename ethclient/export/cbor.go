@@ -0,0 +1,269 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// The CBOR (RFC 8949) items of export streams only carry what JSON can: maps
+// with text keys, arrays, text, numbers, booleans and null. Items are encoded
+// from and decoded to the values encoding/json uses for interface{}, lengths
+// are always definite.
+
+const (
+	cborUint   = 0 << 5
+	cborNegint = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborSimple = 7 << 5
+
+	cborFalse   = cborSimple | 20
+	cborTrue    = cborSimple | 21
+	cborNull    = cborSimple | 22
+	cborFloat64 = cborSimple | 27
+
+	// cborMaxDepth limits the nesting of decoded items, deeper ones being
+	// corrupt rather than anything an export writes.
+	cborMaxDepth = 64
+)
+
+var errCBORUnsupported = errors.New("unsupported CBOR item")
+
+// cborHead writes the initial byte and argument of an item in the shortest
+// form.
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		cborHead64(buf, major, n)
+	}
+}
+
+// cborHead64 writes the argument of an item with eight bytes regardless of its
+// value, giving the item a fixed size.
+func cborHead64(buf *bytes.Buffer, major byte, n uint64) {
+	buf.WriteByte(major | 27)
+	binary.Write(buf, binary.BigEndian, n)
+}
+
+// encodeCBOR appends the CBOR encoding of v, a value as decoded by
+// encoding/json with UseNumber.
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(cborNull)
+	case bool:
+		if v {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case string:
+		cborHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case json.Number:
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			cborHead(buf, cborUint, n)
+		} else if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			cborHead(buf, cborNegint, uint64(-1-n))
+		} else if f, err := v.Float64(); err == nil {
+			buf.WriteByte(cborFloat64)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		} else {
+			return fmt.Errorf("invalid number %q", v)
+		}
+	case []interface{}:
+		cborHead(buf, cborArray, uint64(len(v)))
+		for _, elem := range v {
+			if err := encodeCBOR(buf, elem); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		cborHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			cborHead(buf, cborText, uint64(len(key)))
+			buf.WriteString(key)
+			if err := encodeCBOR(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can't encode %T as CBOR", v)
+	}
+	return nil
+}
+
+// cborReader is where items are decoded from.
+type cborReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// decodeCBOR decodes the next item of r. It returns io.EOF only if r ends
+// before the item, io.ErrUnexpectedEOF if it ends within.
+func decodeCBOR(r cborReader) (interface{}, error) {
+	v, err := decodeCBORItem(r, 0)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	return v, err
+}
+
+func decodeCBORItem(r cborReader, depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("CBOR item nested too deeply")
+	}
+	initial, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial&0xe0, initial&0x1f
+	if major == cborSimple {
+		switch initial {
+		case cborFalse:
+			return false, nil
+		case cborTrue:
+			return true, nil
+		case cborNull:
+			return nil, nil
+		case cborFloat64:
+			var bits uint64
+			if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			return math.Float64frombits(bits), nil
+		}
+		return nil, errCBORUnsupported
+	}
+	n, err := cborArgument(r, info)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegint:
+		if n > math.MaxInt64 {
+			return nil, errCBORUnsupported
+		}
+		return -1 - int64(n), nil
+	case cborText:
+		s, err := readCBORText(r, n)
+		return s, unexpectedEOF(err)
+	case cborArray:
+		var elems []interface{}
+		for i := uint64(0); i < n; i++ {
+			elem, err := decodeCBORItem(r, depth+1)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			elems = append(elems, elem)
+		}
+		if elems == nil {
+			elems = []interface{}{}
+		}
+		return elems, nil
+	case cborMap:
+		m := make(map[string]interface{})
+		for i := uint64(0); i < n; i++ {
+			key, err := decodeCBORItem(r, depth+1)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			s, ok := key.(string)
+			if !ok {
+				return nil, errors.New("CBOR map key is not text")
+			}
+			if m[s], err = decodeCBORItem(r, depth+1); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		return m, nil
+	}
+	return nil, errCBORUnsupported
+}
+
+// cborArgument reads the argument of an item following its initial byte.
+func cborArgument(r cborReader, info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := r.ReadByte()
+		return uint64(b), err
+	case info == 25:
+		var n uint16
+		err := binary.Read(r, binary.BigEndian, &n)
+		return uint64(n), err
+	case info == 26:
+		var n uint32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return uint64(n), err
+	case info == 27:
+		var n uint64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	}
+	// Indefinite lengths are never written.
+	return 0, errCBORUnsupported
+}
+
+// readCBORText reads a text string of n bytes. The buffer grows as the bytes come
+// in, so a corrupt length doesn't allocate more than r holds.
+func readCBORText(r io.Reader, n uint64) (string, error) {
+	if n > math.MaxInt64 {
+		return "", errCBORUnsupported
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// unexpectedEOF turns io.EOF within an item into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// An export stream is a sequence of items, lines of JSON or CBOR items:
+//
+//	{"header": {...}}                      the Header
+//	{"block": {...}, "receipts": [...]}    a Record for every block, in order
+//	{"index": {...}}                       the Index, once the export completes
+//	{"indexOffset": 1234}                  the offset of the index item
+//
+// The last item has a fixed size in CBOR streams and is a short last line in
+// JSON Lines streams, so the index can be found from the end of the stream.
+
+// entry is an item of an export stream, one of its fields being set.
+type entry struct {
+	Header      *Header          `json:"header,omitempty"`
+	Block       *types.Block     `json:"block,omitempty"`
+	Receipts    []*types.Receipt `json:"receipts,omitempty"`
+	Index       *Index           `json:"index,omitempty"`
+	IndexOffset *int64           `json:"indexOffset,omitempty"`
+}
+
+const (
+	// jsonTrailerMax is the most bytes the last line of a JSON Lines stream
+	// takes.
+	jsonTrailerMax = 64
+
+	// cborTrailerSize is the size of the last item of a CBOR stream, a map
+	// holding the offset with a fixed size argument.
+	cborTrailerSize = 22
+)
+
+var (
+	// ErrTruncated is the failure of reading a stream which ends before its
+	// index, typically an export which was interrupted. See Exporter.Resume.
+	ErrTruncated = errors.New("export stream truncated")
+
+	errInvalidTrailer = errors.New("invalid export stream trailer")
+)
+
+// writeEntry writes an item to w in the format.
+func writeEntry(w io.Writer, format Format, e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case JSONLines:
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case CBOR:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := encodeCBOR(&buf, v); err != nil {
+			return err
+		}
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+	return errUnknownFormat(format)
+}
+
+// writeTrailer writes the last item of a stream, the offset of the index item.
+func writeTrailer(w io.Writer, format Format, offset int64) error {
+	switch format {
+	case JSONLines:
+		return writeEntry(w, format, &entry{IndexOffset: &offset})
+	case CBOR:
+		var buf bytes.Buffer
+		cborHead(&buf, cborMap, 1)
+		cborHead(&buf, cborText, uint64(len("indexOffset")))
+		buf.WriteString("indexOffset")
+		cborHead64(&buf, cborUint, uint64(offset))
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	return errUnknownFormat(format)
+}
+
+// reader reads the items of a stream, keeping track of the offset.
+type reader struct {
+	br     *bufio.Reader
+	format Format
+	off    int64 // offset of the next item
+}
+
+func newReader(r io.Reader, format Format, off int64) *reader {
+	return &reader{br: bufio.NewReader(r), format: format, off: off}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.br.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *reader) ReadByte() (byte, error) {
+	b, err := r.br.ReadByte()
+	if err == nil {
+		r.off++
+	}
+	return b, err
+}
+
+// next reads the next item. It returns io.EOF at the end of the stream, and
+// io.ErrUnexpectedEOF if the stream ends within an item.
+func (r *reader) next() (*entry, error) {
+	var data []byte
+	switch r.format {
+	case JSONLines:
+		line, err := r.br.ReadBytes('\n')
+		r.off += int64(len(line))
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = line
+	case CBOR:
+		v, err := decodeCBOR(r)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errUnknownFormat(r.format)
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid item at offset %d: %v", r.off, err)
+	}
+	return &e, nil
+}
+
+// readTrailer returns the offset of the index item of a complete stream of
+// size bytes.
+func readTrailer(r io.ReaderAt, size int64, format Format) (int64, error) {
+	n := int64(cborTrailerSize)
+	if format == JSONLines {
+		n = jsonTrailerMax
+	}
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return 0, err
+	}
+	switch format {
+	case JSONLines:
+		if len(buf) == 0 || buf[len(buf)-1] != '\n' {
+			return 0, ErrTruncated
+		}
+		buf = buf[bytes.LastIndexByte(buf[:len(buf)-1], '\n')+1:]
+	case CBOR:
+	default:
+		return 0, errUnknownFormat(format)
+	}
+	e, err := newReader(bytes.NewReader(buf), format, 0).next()
+	if err != nil || e.IndexOffset == nil {
+		return 0, ErrTruncated
+	}
+	if offset := *e.IndexOffset; offset >= 0 && offset < size {
+		return offset, nil
+	}
+	return 0, errInvalidTrailer
+}
+
+func errUnknownFormat(format Format) error {
+	return fmt.Errorf("unknown export format %d", format)
+}
@@ -0,0 +1,296 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+// Package export writes the blocks of a group along with their receipts to a
+// stream, as JSON Lines or CBOR, for archiving. The stream ends with an index
+// of the offsets of the blocks, and is read back with an Importer, which
+// checks the integrity of the blocks.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+)
+
+// Format is the encoding of an export stream.
+type Format int
+
+const (
+	JSONLines Format = iota // a JSON object per line
+	CBOR                    // a sequence of CBOR items, RFC 8742
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSONLines:
+		return "jsonl"
+	case CBOR:
+		return "cbor"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// formatVersion is the version of the stream layout written to the header.
+const formatVersion = 1
+
+// exportWindow is the number of blocks whose receipts are fetched concurrently.
+const exportWindow = 16
+
+var errInvalidRange = errors.New("invalid block range")
+
+// Header is the first item of an export stream.
+type Header struct {
+	Version int    `json:"version"`
+	GroupId uint64 `json:"groupId"`
+	GM      bool   `json:"gm"`   // whether the chain hashes with SM3
+	From    uint64 `json:"from"` // first block of the export
+}
+
+func (h *Header) chainMode() types.ChainMode {
+	if h.GM {
+		return types.ChainModeGM
+	}
+	return types.ChainModeStandard
+}
+
+// Record is a block of an export stream along with the receipts of its
+// transactions, in order.
+type Record struct {
+	Block    *types.Block
+	Receipts []*types.Receipt
+}
+
+// IndexEntry locates a block in an export stream.
+type IndexEntry struct {
+	Number uint64 `json:"number"`
+	Offset int64  `json:"offset"` // from the start of the stream
+}
+
+// Index lists the offsets of the blocks of an export stream, in order. It is
+// written at the end of the stream, see ReadIndex.
+type Index struct {
+	Entries []IndexEntry `json:"entries"`
+}
+
+// Offset returns the offset of a block in the stream.
+func (idx *Index) Offset(number uint64) (int64, bool) {
+	i := sort.Search(len(idx.Entries), func(i int) bool { return idx.Entries[i].Number >= number })
+	if i < len(idx.Entries) && idx.Entries[i].Number == number {
+		return idx.Entries[i].Offset, true
+	}
+	return 0, false
+}
+
+// Exporter writes the blocks of a group to export streams.
+type Exporter struct {
+	client  *ethclient.Client
+	groupId uint64
+}
+
+// NewExporter creates an exporter of the blocks of a group.
+func NewExporter(client *ethclient.Client, groupId uint64) *Exporter {
+	return &Exporter{client: client, groupId: groupId}
+}
+
+// Export writes the blocks from and to, inclusive, to w along with their
+// receipts, followed by the index of the stream, which is returned too. The
+// blocks are fetched in batches as by Client.BlockRange, and the receipts of
+// several blocks concurrently.
+func (e *Exporter) Export(ctx context.Context, from, to uint64, w io.Writer, format Format) (*Index, error) {
+	if from > to {
+		return nil, errInvalidRange
+	}
+	gm, err := e.client.IsGM(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cw := &countingWriter{w: w}
+	header := &Header{Version: formatVersion, GroupId: e.groupId, GM: gm, From: from}
+	if err := writeEntry(cw, format, &entry{Header: header}); err != nil {
+		return nil, err
+	}
+	return e.export(ctx, from, to, cw, format, new(Index))
+}
+
+// File is a stream being resumed, see Resume. It is implemented by *os.File.
+type File interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+}
+
+// Resume completes an export to f which was interrupted, writing the blocks
+// after the last one found complete up to to, and the index of the whole
+// stream. The blocks already written are checked as by an Importer. An empty
+// f is exported from scratch, starting at from; otherwise from has to match
+// the stream. A stream which is already complete is left as is.
+func (e *Exporter) Resume(ctx context.Context, f File, from, to uint64, format Format) (*Index, error) {
+	if from > to {
+		return nil, errInvalidRange
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	im, err := NewImporter(f, format)
+	if err == ErrTruncated {
+		// Not even the header was written.
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return e.Export(ctx, from, to, f, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header := im.Header(); header.GroupId != e.groupId || header.From != from {
+		return nil, fmt.Errorf("stream of group %d from block %d, resuming group %d from block %d", header.GroupId, header.From, e.groupId, from)
+	}
+	var (
+		index = new(Index)
+		end   = im.r.off
+		next  = from
+	)
+	for im.Next() {
+		index.Entries = append(index.Entries, IndexEntry{Number: im.number, Offset: im.offset})
+		end, next = im.r.off, im.number+1
+	}
+	switch im.Err() {
+	case nil:
+		// The index was read, the trailer after it may still be cut short,
+		// in which case both are written again.
+		if e, err := im.r.next(); err == nil && e.IndexOffset != nil && *e.IndexOffset == end {
+			return im.Index(), nil
+		}
+	case ErrTruncated:
+	default:
+		return nil, im.Err()
+	}
+	if next > to+1 {
+		return nil, errInvalidRange
+	}
+	if err := f.Truncate(end); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return e.export(ctx, next, to, &countingWriter{w: f, n: end}, format, index)
+}
+
+// export writes the blocks from and to, if any, and the index.
+func (e *Exporter) export(ctx context.Context, from, to uint64, w *countingWriter, format Format, index *Index) (*Index, error) {
+	if from <= to {
+		it, err := e.client.BlockRange(ctx, e.groupId, new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+
+		number := from
+		window := make([]*types.Block, 0, exportWindow)
+		flush := func() error {
+			receipts, err := e.receipts(ctx, window)
+			if err != nil {
+				return err
+			}
+			for i, block := range window {
+				if n, err := hexutil.DecodeUint64(block.Number); err != nil || n != number {
+					return fmt.Errorf("block %s returned for block %d", block.Number, number)
+				}
+				index.Entries = append(index.Entries, IndexEntry{Number: number, Offset: w.n})
+				if err := writeEntry(w, format, &entry{Block: block, Receipts: receipts[i]}); err != nil {
+					return err
+				}
+				number++
+			}
+			window = window[:0]
+			return nil
+		}
+		for it.Next() {
+			if window = append(window, it.Block()); len(window) == exportWindow {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	offset := w.n
+	if err := writeEntry(w, format, &entry{Index: index}); err != nil {
+		return nil, err
+	}
+	if err := writeTrailer(w, format, offset); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// receipts retrieves the receipts of the blocks concurrently.
+func (e *Exporter) receipts(ctx context.Context, blocks []*types.Block) ([][]*types.Receipt, error) {
+	var (
+		receipts = make([][]*types.Receipt, len(blocks))
+		errs     = make([]error, len(blocks))
+		wg       sync.WaitGroup
+	)
+	for i, block := range blocks {
+		if len(block.Transactions) == 0 {
+			continue
+		}
+		number, ok := new(big.Int).SetString(block.Number, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid block number %q", block.Number)
+		}
+		wg.Add(1)
+		go func(i int, number *big.Int) {
+			defer wg.Done()
+			receipts[i], errs[i] = e.client.BlockReceipts(ctx, e.groupId, number)
+		}(i, number)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("receipts of block %s: %v", blocks[i].Number, err)
+		}
+	}
+	return receipts, nil
+}
+
+// countingWriter keeps track of the offset in the stream.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,399 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/ethclient/export"
+)
+
+// testChain is a chain of blocks whose hashes match their headers, every third
+// block carrying two transactions.
+type testChain struct {
+	blocks   []*types.Block
+	receipts [][]*types.Receipt
+}
+
+func newTestChain(t *testing.T, length int, mode types.ChainMode) *testChain {
+	chain := new(testChain)
+	parent := common.Hash{}.Hex()
+	for number := 0; number < length; number++ {
+		seed := common.BigToHash(new(big.Int).Lsh(common.Big1, uint(number%200))).Hex()
+		block := &types.Block{
+			DbHash:           seed,
+			ExtraData:        []interface{}{"0x"},
+			GasLimit:         "0x0",
+			GasUsed:          "0x0",
+			LogsBloom:        hexutil.Encode(types.Bloom{}.Bytes()),
+			Number:           hexutil.EncodeUint64(uint64(number)),
+			ParentHash:       parent,
+			ReceiptsRoot:     seed,
+			Sealer:           "0x0",
+			SealerList:       []string{strings.Repeat("ab", 64)},
+			StateRoot:        seed,
+			Timestamp:        hexutil.EncodeUint64(1571200000000 + uint64(number)*1000),
+			Transactions:     []types.BlockTx{},
+			TransactionsRoot: seed,
+		}
+		hash, err := block.ComputeHash(mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Hash = hash.Hex()
+		var receipts []*types.Receipt
+		if number > 0 && number%3 == 0 {
+			for i := 0; i < 2; i++ {
+				txHash := common.BigToHash(new(big.Int).SetUint64(uint64(number<<8 + i)))
+				block.Transactions = append(block.Transactions, types.BlockTx{
+					BlockHash:        block.Hash,
+					BlockNumber:      block.Number,
+					From:             common.Address{0xf0}.Hex(),
+					Gas:              "0x1c9c380",
+					GasPrice:         "0x1c9c380",
+					Hash:             txHash.Hex(),
+					Input:            "0x2a",
+					Nonce:            "0x1",
+					To:               common.Address{0xc0}.Hex(),
+					TransactionIndex: hexutil.EncodeUint64(uint64(i)),
+					Value:            "0x0",
+				})
+				to := common.Address{0xc0}
+				receipts = append(receipts, &types.Receipt{
+					BlockHash:   hash,
+					BlockNumber: uint64(number),
+					From:        common.Address{0xf0},
+					GasUsed:     21000,
+					Input:       []byte{0x2a},
+					Logs:        []*types.Log{},
+					Output:      []byte{},
+					Status:      "0x0",
+					To:          &to,
+					TxHash:      txHash,
+					TxIndex:     uint(i),
+				})
+			}
+		}
+		chain.blocks = append(chain.blocks, block)
+		chain.receipts = append(chain.receipts, receipts)
+		parent = block.Hash
+	}
+	return chain
+}
+
+// serve answers the block and receipt requests of the node with the chain.
+func (c *testChain) serve(node *ethclienttest.FakeNode, mode types.ChainMode) {
+	version := &types.ClientVersion{Version: "2.7.0", ChainId: "1"}
+	if mode == types.ChainModeGM {
+		version.Version = "2.7.0 gm"
+	}
+	node.Respond("getClientVersion", version)
+	number := func(param json.RawMessage) (uint64, error) {
+		var s string
+		if err := json.Unmarshal(param, &s); err != nil {
+			return 0, err
+		}
+		n, err := hexutil.DecodeFlexibleUint64(s)
+		if err != nil || n >= uint64(len(c.blocks)) {
+			return 0, fmt.Errorf("block %s not found", s)
+		}
+		return n, nil
+	}
+	node.Handle("getBlockByNumber", func(params []json.RawMessage) (interface{}, error) {
+		n, err := number(params[1])
+		if err != nil {
+			return nil, err
+		}
+		return c.blocks[n], nil
+	})
+	node.Handle("getBatchReceiptsByBlockNumberAndRange", func(params []json.RawMessage) (interface{}, error) {
+		n, err := number(params[1])
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{
+			"blockInfo": map[string]interface{}{
+				"blockHash":     c.blocks[n].Hash,
+				"blockNumber":   c.blocks[n].Number,
+				"receiptsCount": hexutil.EncodeUint64(uint64(len(c.receipts[n]))),
+			},
+			"transactionReceipts": c.receipts[n],
+		}
+		return result, nil
+	})
+}
+
+// export writes the blocks from and to of the chain to a stream.
+func (c *testChain) export(t *testing.T, mode types.ChainMode, from, to uint64, format export.Format) ([]byte, *export.Index) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	c.serve(node, mode)
+	var buf bytes.Buffer
+	index, err := export.NewExporter(node.Client(), 1).Export(context.Background(), from, to, &buf, format)
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	return buf.Bytes(), index
+}
+
+// checkRecord checks that a record encodes like block number of the chain.
+func (c *testChain) checkRecord(t *testing.T, record *export.Record, number uint64) {
+	t.Helper()
+	have, _ := json.Marshal(record)
+	want, _ := json.Marshal(&export.Record{Block: c.blocks[number], Receipts: c.receipts[number]})
+	if !bytes.Equal(have, want) {
+		t.Errorf("record %d mismatch:\nhave %s\nwant %s", number, have, want)
+	}
+}
+
+var testModes = []types.ChainMode{types.ChainModeStandard, types.ChainModeGM}
+
+func TestExportRoundTrip(t *testing.T) {
+	const from, to = 1, 40 // more than a window of receipt fetches
+	for _, mode := range testModes {
+		chain := newTestChain(t, to+5, mode)
+		for _, format := range []export.Format{export.JSONLines, export.CBOR} {
+			name := fmt.Sprintf("%v/%v", mode, format)
+			stream, index := chain.export(t, mode, from, to, format)
+
+			im, err := export.NewImporter(bytes.NewReader(stream), format)
+			if err != nil {
+				t.Fatalf("%s: NewImporter error: %v", name, err)
+			}
+			want := export.Header{Version: 1, GroupId: 1, GM: mode == types.ChainModeGM, From: from}
+			if h := im.Header(); h != want {
+				t.Errorf("%s: header %+v, want %+v", name, h, want)
+			}
+			number := uint64(from)
+			for im.Next() {
+				chain.checkRecord(t, im.Record(), number)
+				number++
+			}
+			if err := im.Err(); err != nil {
+				t.Fatalf("%s: import error: %v", name, err)
+			}
+			if number != to+1 {
+				t.Errorf("%s: imported up to block %d, want %d", name, number-1, to)
+			}
+
+			// The index is returned, written at the end and found from there.
+			if len(index.Entries) != to-from+1 {
+				t.Fatalf("%s: index has %d entries, want %d", name, len(index.Entries), to-from+1)
+			}
+			for _, idx := range []*export.Index{im.Index(), readIndex(t, stream, format)} {
+				if have, _ := json.Marshal(idx); !bytes.Equal(have, mustJSON(index)) {
+					t.Errorf("%s: index %s, want %s", name, have, mustJSON(index))
+				}
+			}
+			for _, number := range []uint64{from, 17, to} {
+				im, err := export.NewImporterAt(bytes.NewReader(stream), int64(len(stream)), format, number)
+				if err != nil {
+					t.Fatalf("%s: NewImporterAt(%d) error: %v", name, number, err)
+				}
+				if !im.Next() {
+					t.Fatalf("%s: no block at %d: %v", name, number, im.Err())
+				}
+				chain.checkRecord(t, im.Record(), number)
+			}
+			if _, err := export.NewImporterAt(bytes.NewReader(stream), int64(len(stream)), format, to+1); err == nil {
+				t.Errorf("%s: NewImporterAt found block %d after the export", name, to+1)
+			}
+		}
+	}
+}
+
+func TestExportReceiptsFetched(t *testing.T) {
+	chain := newTestChain(t, 10, types.ChainModeStandard)
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	chain.serve(node, types.ChainModeStandard)
+	if _, err := export.NewExporter(node.Client(), 1).Export(context.Background(), 1, 9, ioutil.Discard, export.JSONLines); err != nil {
+		t.Fatal(err)
+	}
+	// Only the blocks 3, 6 and 9 have transactions.
+	if n := len(node.CallsTo("getBatchReceiptsByBlockNumberAndRange")); n != 3 {
+		t.Errorf("receipts of %d blocks fetched, want 3", n)
+	}
+	if _, err := export.NewExporter(node.Client(), 1).Export(context.Background(), 5, 4, ioutil.Discard, export.JSONLines); err == nil {
+		t.Error("Export of an inverted range succeeded")
+	}
+}
+
+func TestExportResume(t *testing.T) {
+	const from, to = 2, 30
+	chain := newTestChain(t, to+1, types.ChainModeStandard)
+	for _, format := range []export.Format{export.JSONLines, export.CBOR} {
+		full, _ := chain.export(t, types.ChainModeStandard, from, to, format)
+		index := readIndex(t, full, format)
+		cuts := []int{0, 5, int(index.Entries[0].Offset), int(index.Entries[0].Offset) + 7, int(index.Entries[10].Offset), len(full) - 30, len(full) - 1, len(full)}
+		for _, cut := range cuts {
+			f, err := ioutil.TempFile("", "export")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			if _, err := f.Write(full[:cut]); err != nil {
+				t.Fatal(err)
+			}
+
+			node := ethclienttest.NewFakeNode(t)
+			chain.serve(node, types.ChainModeStandard)
+			_, err = export.NewExporter(node.Client(), 1).Resume(context.Background(), f, from, to, format)
+			node.Close()
+			if err != nil {
+				t.Errorf("%v cut at %d: Resume error: %v", format, cut, err)
+				continue
+			}
+			resumed, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(resumed, full) {
+				t.Errorf("%v cut at %d: resumed stream differs from the full export", format, cut)
+			}
+		}
+	}
+}
+
+func TestExportResumeMismatch(t *testing.T) {
+	chain := newTestChain(t, 10, types.ChainModeStandard)
+	full, _ := chain.export(t, types.ChainModeStandard, 1, 9, export.JSONLines)
+	f, err := ioutil.TempFile("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(full[:len(full)/2]); err != nil {
+		t.Fatal(err)
+	}
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	chain.serve(node, types.ChainModeStandard)
+	tests := []struct {
+		groupId, from uint64
+	}{
+		{groupId: 2, from: 1}, // other group
+		{groupId: 1, from: 2}, // other first block
+	}
+	for _, test := range tests {
+		if _, err := export.NewExporter(node.Client(), test.groupId).Resume(context.Background(), f, test.from, 9, export.JSONLines); err == nil {
+			t.Errorf("Resume of group %d from %d succeeded", test.groupId, test.from)
+		}
+	}
+}
+
+func TestImportIntegrity(t *testing.T) {
+	chain := newTestChain(t, 8, types.ChainModeStandard)
+	stream, _ := chain.export(t, types.ChainModeStandard, 1, 7, export.JSONLines)
+	lines := strings.SplitAfter(string(stream), "\n")
+
+	// edit rewrites the record of block 3, the line after the header and blocks 1
+	// and 2.
+	edit := func(f func(r *export.Record)) string {
+		var r export.Record
+		if err := json.Unmarshal([]byte(lines[3]), &struct {
+			Block    **types.Block     `json:"block"`
+			Receipts *[]*types.Receipt `json:"receipts"`
+		}{&r.Block, &r.Receipts}); err != nil {
+			t.Fatal(err)
+		}
+		f(&r)
+		line := mustJSON(map[string]interface{}{"block": r.Block, "receipts": r.Receipts})
+		edited := append([]string(nil), lines...)
+		edited[3] = string(line) + "\n"
+		return strings.Join(edited, "")
+	}
+	tests := []struct {
+		name   string
+		stream string
+		want   string
+	}{
+		{
+			name:   "tampered block",
+			stream: edit(func(r *export.Record) { r.Block.Timestamp = "0x1" }),
+			want:   "block hash mismatch",
+		},
+		{
+			name:   "missing block",
+			stream: strings.Join(append(lines[:3:3], lines[4:]...), ""),
+			want:   "follows block 2",
+		},
+		{
+			name:   "missing receipt",
+			stream: edit(func(r *export.Record) { r.Receipts = r.Receipts[:1] }),
+			want:   "1 receipts for 2 transactions",
+		},
+		{
+			name:   "swapped receipts",
+			stream: edit(func(r *export.Record) { r.Receipts[0], r.Receipts[1] = r.Receipts[1], r.Receipts[0] }),
+			want:   "receipt 0 is not of transaction",
+		},
+		{
+			name:   "truncated",
+			stream: strings.Join(lines[:5], ""),
+			want:   export.ErrTruncated.Error(),
+		},
+	}
+	for _, test := range tests {
+		im, err := export.NewImporter(strings.NewReader(test.stream), export.JSONLines)
+		if err != nil {
+			t.Fatalf("%s: NewImporter error: %v", test.name, err)
+		}
+		for im.Next() {
+		}
+		if err := im.Err(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: import error %v, want %q", test.name, err, test.want)
+		}
+	}
+	if _, err := export.NewImporter(strings.NewReader(lines[0][:10]), export.JSONLines); err != export.ErrTruncated {
+		t.Errorf("NewImporter of a cut header: error %v, want ErrTruncated", err)
+	}
+	if _, err := export.ReadIndex(strings.NewReader(strings.Join(lines[:5], "")), int64(len(strings.Join(lines[:5], ""))), export.JSONLines); err != export.ErrTruncated {
+		t.Errorf("ReadIndex of a truncated stream: error %v, want ErrTruncated", err)
+	}
+}
+
+func readIndex(t *testing.T, stream []byte, format export.Format) *export.Index {
+	t.Helper()
+	index, err := export.ReadIndex(bytes.NewReader(stream), int64(len(stream)), format)
+	if err != nil {
+		t.Fatalf("ReadIndex error: %v", err)
+	}
+	return index
+}
+
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
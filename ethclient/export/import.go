@@ -0,0 +1,187 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// Importer reads the blocks of an export stream back, checking that each
+// block hashes to its hash, follows the previous one and has the receipts of
+// its transactions. It is used in the style of sql.Rows:
+//
+//	im, err := export.NewImporter(r, export.JSONLines)
+//	if err != nil {
+//		return err
+//	}
+//	for im.Next() {
+//		record := im.Record()
+//		...
+//	}
+//	return im.Err()
+type Importer struct {
+	r      *reader
+	header Header
+
+	record *Record
+	number uint64 // of the current record
+	offset int64  // of the current record
+	prev   *types.Block
+	index  *Index
+	err    error
+}
+
+// NewImporter reads the header of the stream r and returns an importer of its
+// blocks.
+func NewImporter(r io.Reader, format Format) (*Importer, error) {
+	rd := newReader(r, format, 0)
+	e, err := rd.next()
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return nil, ErrTruncated
+	case err != nil:
+		return nil, err
+	case e.Header == nil:
+		return nil, errors.New("export stream has no header")
+	case e.Header.Version != formatVersion:
+		return nil, fmt.Errorf("unsupported export stream version %d", e.Header.Version)
+	}
+	return &Importer{r: rd, header: *e.Header}, nil
+}
+
+// NewImporterAt returns an importer of a complete stream of size bytes which
+// starts at the given block, found with the index of the stream.
+func NewImporterAt(r io.ReaderAt, size int64, format Format, number uint64) (*Importer, error) {
+	im, err := NewImporter(io.NewSectionReader(r, 0, size), format)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ReadIndex(r, size, format)
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := index.Offset(number)
+	if !ok {
+		return nil, fmt.Errorf("block %d not in export stream", number)
+	}
+	im.r = newReader(io.NewSectionReader(r, offset, size-offset), format, offset)
+	return im, nil
+}
+
+// ReadIndex reads the index at the end of a complete stream of size bytes. It
+// fails with ErrTruncated if the stream has none.
+func ReadIndex(r io.ReaderAt, size int64, format Format) (*Index, error) {
+	offset, err := readTrailer(r, size, format)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newReader(io.NewSectionReader(r, offset, size-offset), format, offset).next()
+	if err != nil {
+		return nil, err
+	}
+	if e.Index == nil {
+		return nil, errInvalidTrailer
+	}
+	return e.Index, nil
+}
+
+// Header returns the header of the stream.
+func (im *Importer) Header() Header {
+	return im.header
+}
+
+// Next advances to the next block. It returns false at the index ending the
+// stream and on failure.
+func (im *Importer) Next() bool {
+	im.record = nil
+	if im.err != nil || im.index != nil {
+		return false
+	}
+	offset := im.r.off
+	e, err := im.r.next()
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		im.err = ErrTruncated
+	case err != nil:
+		im.err = err
+	case e.Index != nil:
+		im.index = e.Index
+	case e.Block != nil:
+		number, err := im.verify(e.Block, e.Receipts)
+		if err != nil {
+			im.err = fmt.Errorf("block %s at offset %d: %v", e.Block.Number, offset, err)
+			return false
+		}
+		im.record = &Record{Block: e.Block, Receipts: e.Receipts}
+		im.number, im.offset, im.prev = number, offset, e.Block
+		return true
+	default:
+		im.err = fmt.Errorf("unexpected item at offset %d", offset)
+	}
+	return false
+}
+
+// verify checks the integrity of a block and returns its number.
+func (im *Importer) verify(block *types.Block, receipts []*types.Receipt) (uint64, error) {
+	number, err := hexutil.DecodeUint64(block.Number)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %v", err)
+	}
+	if err := block.VerifyHash(im.header.chainMode()); err != nil {
+		return 0, err
+	}
+	if im.prev != nil {
+		if number != im.number+1 {
+			return 0, fmt.Errorf("follows block %d", im.number)
+		}
+		if !strings.EqualFold(block.ParentHash, im.prev.Hash) {
+			return 0, fmt.Errorf("parent hash %s, previous block %s", block.ParentHash, im.prev.Hash)
+		}
+	}
+	if len(receipts) != len(block.Transactions) {
+		return 0, fmt.Errorf("%d receipts for %d transactions", len(receipts), len(block.Transactions))
+	}
+	for i, tx := range block.Transactions {
+		if receipts[i] == nil || receipts[i].TxHash != common.HexToHash(tx.Hash) {
+			return 0, fmt.Errorf("receipt %d is not of transaction %s", i, tx.Hash)
+		}
+	}
+	return number, nil
+}
+
+// Record returns the current block, nil before the first and after the last
+// call to Next.
+func (im *Importer) Record() *Record {
+	return im.record
+}
+
+// Index returns the index of the stream once Next reached it.
+func (im *Importer) Index() *Index {
+	return im.index
+}
+
+// Err returns the error which ended the import, nil if the stream was read up
+// to its index. It is ErrTruncated if the stream ends before.
+func (im *Importer) Err() error {
+	return im.err
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import "time"
+
+// AgeHeight moves the cached chain height of a group back in time by d, as if
+// it had been fetched and last pushed d earlier.
+func AgeHeight(ec *Client, groupId uint64, d time.Duration) {
+	h := ec.chainHeight(groupId)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.updated = h.updated.Add(-d)
+	if !h.pushed.IsZero() {
+		h.pushed = h.pushed.Add(-d)
+	}
+}
+
+// LookupNodes returns the URLs of the nodes behind rawurl, as resolved by a pool
+// with WithResolver.
+var LookupNodes = lookupNodes
@@ -0,0 +1,337 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+const (
+	// defaultFilterConcurrency is the number of blocks scanned in parallel by
+	// FilterLogs unless changed with SetFilterConcurrency.
+	defaultFilterConcurrency = 8
+
+	// filterWindow is the number of blocks FilterLogs scans before collecting
+	// their logs, bounding the memory a long range takes.
+	filterWindow = 1024
+)
+
+var errInvalidRange = errors.New("invalid block range: fromBlock > toBlock")
+
+// filterBlock is the subset of a block needed to scan it for logs. It is
+// retrieved without transaction bodies, i.e. transactions are hashes only.
+type filterBlock struct {
+	Hash         common.Hash   `json:"hash"`
+	Number       string        `json:"number"`
+	LogsBloom    types.Bloom   `json:"logsBloom"`
+	Transactions []common.Hash `json:"transactions"`
+}
+
+// SetFilterConcurrency sets the number of blocks FilterLogs scans in parallel.
+// Values below one reset it to the default.
+func (ec *Client) SetFilterConcurrency(n int) {
+	if n < 1 {
+		n = defaultFilterConcurrency
+	}
+	atomic.StoreInt32(&ec.filterConcurrency, int32(n))
+}
+
+// FilterLogs executes a filter query by walking the requested block range and
+// collecting the matching logs of the transaction receipts. Blocks whose logs
+// bloom rules out a match are skipped without fetching their receipts; as guomi
+// chains build their blooms with SM3, the blooms are only checked once the
+// node's version tells the chain's cryptography.
+//
+// The logs are those of the query's group, or if it has none, the group of ctx
+// or the client default. FromBlock defaults to the genesis block and ToBlock to
+// the latest block, a ToBlock beyond the latest block is cut back to it. Both
+// may be the LatestBlock or PendingBlock tag for the latest block. If BlockHash
+// is set only that block is scanned. Invalid queries fail with
+// *ValidationError.
+func (ec *Client) FilterLogs(ctx context.Context, q fiscobcos.FilterQuery) ([]types.Log, error) {
+	groupId := ec.group(ctx, q.GroupId)
+	if err := ec.validateFilterQuery("FilterLogs", groupId, q); err != nil {
+		return nil, err
+	}
+	mode, checkBloom := ec.bloomMode(ctx)
+	if q.BlockHash != nil {
+		var block *filterBlock
+		if err := ec.callFilterBlock(ctx, &block, "getBlockByHash", groupId, *q.BlockHash, false); err != nil {
+			return nil, err
+		}
+		return ec.scanBlock(ctx, groupId, block, q, mode, checkBloom)
+	}
+	from, to, err := ec.filterRange(ctx, groupId, q)
+	if err != nil || from > to {
+		return nil, err
+	}
+	workers := int(atomic.LoadInt32(&ec.filterConcurrency))
+	if workers < 1 {
+		workers = defaultFilterConcurrency
+	}
+	var logs []types.Log
+	for start := from; ; start += filterWindow {
+		end := to
+		if to-start >= filterWindow {
+			end = start + filterWindow - 1
+		}
+		windowLogs, err := ec.scanRange(ctx, groupId, start, end, workers, q, mode, checkBloom)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, windowLogs...)
+		if end == to {
+			return logs, nil
+		}
+	}
+}
+
+// filterRange resolves the block range of a filter query, clamped to the head of
+// the chain, which the block tags stand for. A range starting beyond the head,
+// or beyond a ToBlock below the head with FromBlock the latest block, is
+// returned as from > to, there are no logs to scan. Block numbers beyond 64
+// bits fail with *ValidationError.
+func (ec *Client) filterRange(ctx context.Context, groupId uint64, q fiscobcos.FilterQuery) (from, to uint64, err error) {
+	fromHead := q.FromBlock != nil && isLatestBlock(q.FromBlock)
+	if q.FromBlock != nil && !fromHead {
+		if err := checkBlockNumber("FilterLogs", q.FromBlock); err != nil {
+			return 0, 0, err
+		}
+		from = q.FromBlock.Uint64()
+	}
+	if !isLatestBlock(q.ToBlock) {
+		if err := checkBlockNumber("FilterLogs", q.ToBlock); err != nil {
+			return 0, 0, err
+		}
+		to = q.ToBlock.Uint64()
+		if from > to {
+			return 0, 0, errInvalidRange
+		}
+	}
+	head, err := ec.BlockNumber(ctx, groupId)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fromHead {
+		from = head.Uint64()
+	}
+	if isLatestBlock(q.ToBlock) || to > head.Uint64() {
+		to = head.Uint64()
+	}
+	return from, to, nil
+}
+
+// bloomMode returns the cryptography the logs blooms of the chain are built
+// with. known is false if the node's version can't be fetched, the blocks are
+// then scanned without checking their bloom.
+func (ec *Client) bloomMode(ctx context.Context) (mode types.ChainMode, known bool) {
+	version, err := ec.nodeVersion(ctx)
+	if err != nil {
+		return types.ChainModeStandard, false
+	}
+	return version.ChainMode(), true
+}
+
+// scanRange scans the blocks from start to end, inclusive, with the given number
+// of workers and returns the matching logs in block order.
+func (ec *Client) scanRange(ctx context.Context, groupId, start, end uint64, workers int, q fiscobcos.FilterQuery, mode types.ChainMode, checkBloom bool) ([]types.Log, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results = make([][]types.Log, end-start+1)
+		numbers = make(chan uint64)
+		errc    = make(chan error, 1)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				var block *filterBlock
+				err := ec.callFilterBlock(ctx, &block, "getBlockByNumber", groupId, blockNumberArgUint64("getBlockByNumber", number), false)
+				if err == nil {
+					results[number-start], err = ec.scanBlock(ctx, groupId, block, q, mode, checkBloom)
+				}
+				if err != nil {
+					select {
+					case errc <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for number := start; ; number++ {
+		select {
+		case numbers <- number:
+		case <-ctx.Done():
+			break feed
+		}
+		if number == end {
+			break
+		}
+	}
+	close(numbers)
+	wg.Wait()
+
+	select {
+	case err := <-errc:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var logs []types.Log
+	for _, blockLogs := range results {
+		logs = append(logs, blockLogs...)
+	}
+	return logs, nil
+}
+
+func (ec *Client) callFilterBlock(ctx context.Context, result **filterBlock, method string, args ...interface{}) error {
+	return ec.callResult(ctx, result, method, args...)
+}
+
+// scanBlock fetches the receipts of a block whose bloom may match the query and
+// returns the matching logs with their derived fields populated. The bloom,
+// built with the cryptography of mode, is only checked if checkBloom is set.
+func (ec *Client) scanBlock(ctx context.Context, groupId uint64, block *filterBlock, q fiscobcos.FilterQuery, mode types.ChainMode, checkBloom bool) ([]types.Log, error) {
+	if checkBloom && !BloomMatchesQueryFor(block.LogsBloom, q, mode) {
+		return nil, nil
+	}
+	number, err := hexutil.DecodeFlexibleUint64(block.Number)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		logs  []types.Log
+		index uint
+	)
+	for i, txHash := range block.Transactions {
+		receipt, err := ec.TransactionReceipt(ctx, groupId, txHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range receipt.Logs {
+			log.BlockNumber = number
+			log.BlockHash = block.Hash
+			log.TxHash = txHash
+			log.TxIndex = uint(i)
+			log.Index = index
+			index++
+
+			if logMatches(log, q.Addresses, q.Topics) {
+				logs = append(logs, *log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// BloomMatchesQuery reports whether a block with the given logs bloom may
+// contain logs matching the addresses and topics of q, see Block.Bloom. It
+// never rules out a block with matching logs, but may fail to rule out one
+// without. The block range of q isn't considered.
+//
+// The bloom is that of a standard chain, see BloomMatchesQueryFor for guomi
+// chains.
+func BloomMatchesQuery(bloom types.Bloom, q fiscobcos.FilterQuery) bool {
+	return BloomMatchesQueryFor(bloom, q, types.ChainModeStandard)
+}
+
+// BloomMatchesQueryFor is like BloomMatchesQuery for the bloom of a chain with
+// the given cryptography, see Client.ChainMode.
+func BloomMatchesQueryFor(bloom types.Bloom, q fiscobcos.FilterQuery, mode types.ChainMode) bool {
+	return bloomFilter(bloom, q.Addresses, q.Topics, mode)
+}
+
+// bloomFilter reports whether a block with the given bloom may contain logs
+// matching the addresses and topics.
+func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash, mode types.ChainMode) bool {
+	if len(addresses) > 0 {
+		var included bool
+		for _, addr := range addresses {
+			if types.BloomLookupFor(bloom, addr, mode) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, sub := range topics {
+		included := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if types.BloomLookupFor(bloom, topic, mode) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
+
+// logMatches reports whether the log was emitted by one of the addresses and
+// matches the topic rules of a filter query.
+func logMatches(log *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		var found bool
+		for _, addr := range addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		match := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if log.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,389 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+var (
+	logAddress = common.HexToAddress("0x6849f21d1e455e9f0712b1e99fa4fcd23758e8f1")
+	logTopic   = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+)
+
+// logChain serves a chain of blocks 0 to head from a fake node. Every block whose
+// number is a multiple of every has one transaction emitting a log of logAddress
+// with logTopic, the other blocks are empty. The blooms are built with the
+// cryptography of mode, which the node reports with its version unless
+// hideVersion is set.
+type logChain struct {
+	head        uint64
+	every       uint64
+	mode        types.ChainMode
+	hideVersion bool
+}
+
+func txHashOf(number uint64) common.Hash {
+	var h common.Hash
+	binary.BigEndian.PutUint64(h[24:], number+1)
+	return h
+}
+
+func blockHashOf(number uint64) common.Hash {
+	var h common.Hash
+	h[0] = 0xb1
+	binary.BigEndian.PutUint64(h[24:], number)
+	return h
+}
+
+func (c *logChain) hasLog(number uint64) bool { return number%c.every == 0 }
+
+func (c *logChain) serve(node *ethclienttest.FakeNode) {
+	version := &types.ClientVersion{Version: "2.7.0", SupportedVersion: "2.7.0", ChainId: "1"}
+	if c.mode == types.ChainModeGM {
+		version.Version = "2.7.0 gm"
+	}
+	if c.hideVersion {
+		node.RespondError("getClientVersion", -32601, "method not found")
+	} else {
+		node.Respond("getClientVersion", version)
+	}
+	node.Respond("getBlockNumber", hexutil.EncodeUint64(c.head))
+	node.Handle("getBlockByNumber", func(params []json.RawMessage) (interface{}, error) {
+		var arg string
+		if err := json.Unmarshal(params[1], &arg); err != nil {
+			return nil, err
+		}
+		number, err := hexutil.DecodeUint64(arg)
+		if err != nil {
+			return nil, err
+		}
+		if number > c.head {
+			return nil, nil
+		}
+		block := map[string]interface{}{
+			"hash":         blockHashOf(number),
+			"number":       hexutil.EncodeUint64(number),
+			"logsBloom":    types.Bloom{},
+			"transactions": []common.Hash{},
+		}
+		if c.hasLog(number) {
+			block["logsBloom"] = types.CreateBloomFor(types.Receipts{c.receipt(number)}, c.mode)
+			block["transactions"] = []common.Hash{txHashOf(number)}
+		}
+		return block, nil
+	})
+	node.Handle("getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+		var hash common.Hash
+		if err := json.Unmarshal(params[1], &hash); err != nil {
+			return nil, err
+		}
+		number := binary.BigEndian.Uint64(hash[24:]) - 1
+		if !c.hasLog(number) || txHashOf(number) != hash {
+			return nil, nil
+		}
+		return c.receipt(number), nil
+	})
+}
+
+func (c *logChain) receipt(number uint64) *types.Receipt {
+	return &types.Receipt{
+		BlockHash:   blockHashOf(number),
+		BlockNumber: number,
+		Status:      "0x0",
+		TxHash:      txHashOf(number),
+		Logs:        []*types.Log{{Address: logAddress, Topics: []common.Hash{logTopic}, Data: []byte{}}},
+	}
+}
+
+func TestFilterLogsRange(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	chain := &logChain{head: 2500, every: 100}
+	chain.serve(node)
+	client := node.Client()
+
+	tests := []struct {
+		name     string
+		from, to *big.Int
+		want     []uint64 // blocks of the expected logs
+	}{
+		{name: "whole chain", want: []uint64{0, 100, 200, 300, 400, 500, 600, 700, 800, 900, 1000, 1100, 1200, 1300, 1400, 1500, 1600, 1700, 1800, 1900, 2000, 2100, 2200, 2300, 2400, 2500}},
+		{name: "window boundary", from: big.NewInt(1000), to: big.NewInt(1100), want: []uint64{1000, 1100}},
+		{name: "to beyond head", from: big.NewInt(2350), to: big.NewInt(1 << 40), want: []uint64{2400, 2500}},
+		{name: "to max uint64", from: big.NewInt(2450), to: new(big.Int).SetUint64(math.MaxUint64), want: []uint64{2500}},
+		{name: "from beyond head", from: big.NewInt(2501), to: big.NewInt(3000)},
+		{name: "single block", from: big.NewInt(300), to: big.NewInt(300), want: []uint64{300}},
+		{name: "to latest", from: big.NewInt(2350), to: big.NewInt(ethclient.LatestBlock), want: []uint64{2400, 2500}},
+		{name: "to pending", from: big.NewInt(2350), to: big.NewInt(ethclient.PendingBlock), want: []uint64{2400, 2500}},
+		{name: "from latest", from: big.NewInt(ethclient.LatestBlock), want: []uint64{2500}},
+		{name: "latest to latest", from: big.NewInt(ethclient.LatestBlock), to: big.NewInt(ethclient.PendingBlock), want: []uint64{2500}},
+		{name: "from latest to earlier", from: big.NewInt(ethclient.LatestBlock), to: big.NewInt(2400)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs, err := client.FilterLogs(context.Background(), fiscobcos.FilterQuery{
+				FromBlock: test.from,
+				ToBlock:   test.to,
+				Addresses: []common.Address{logAddress},
+			})
+			if err != nil {
+				t.Fatalf("FilterLogs error: %v", err)
+			}
+			if len(logs) != len(test.want) {
+				t.Fatalf("got %d logs, want %d", len(logs), len(test.want))
+			}
+			for i, log := range logs {
+				if log.BlockNumber != test.want[i] {
+					t.Errorf("log %d: block %d, want %d", i, log.BlockNumber, test.want[i])
+				}
+				if log.TxHash != txHashOf(test.want[i]) || log.BlockHash != blockHashOf(test.want[i]) {
+					t.Errorf("log %d: derived fields not populated: %+v", i, log)
+				}
+			}
+		})
+	}
+}
+
+// TestSetFilterConcurrencyConcurrent changes the filter concurrency while
+// FilterLogs runs, for the race detector.
+func TestSetFilterConcurrencyConcurrent(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	(&logChain{head: 200, every: 10}).serve(node)
+	client := node.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				client.SetFilterConcurrency(i + j%3)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			logs, err := client.FilterLogs(context.Background(), fiscobcos.FilterQuery{Addresses: []common.Address{logAddress}})
+			if err != nil || len(logs) != 21 {
+				t.Errorf("FilterLogs: %d logs, error %v; want 21 logs", len(logs), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestFilterLogsInvalidRange checks that malformed queries fail with a
+// *ValidationError naming the field, before any request is sent, both when
+// filtering and when subscribing.
+func TestFilterLogsInvalidRange(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	(&logChain{head: 10, every: 1}).serve(node)
+	node.RespondRaw("getBlockByHash", "null")
+	client := node.Client()
+
+	var (
+		beyond64 = new(big.Int).Lsh(big.NewInt(1), 64)
+		latest   = big.NewInt(int64(rpc.LatestBlockNumber))
+		pending  = big.NewInt(int64(rpc.PendingBlockNumber))
+		hash     = blockHashOf(3)
+		topics   = [][]common.Hash{{logTopic}, nil, nil, nil}
+	)
+	tests := []struct {
+		q     fiscobcos.FilterQuery
+		param string // invalid field, empty if the query is valid
+	}{
+		{fiscobcos.FilterQuery{ToBlock: beyond64}, "toBlock"},
+		{fiscobcos.FilterQuery{FromBlock: beyond64}, "fromBlock"},
+		{fiscobcos.FilterQuery{FromBlock: big.NewInt(-5)}, "fromBlock"},
+		{fiscobcos.FilterQuery{ToBlock: big.NewInt(-3)}, "toBlock"},
+		{fiscobcos.FilterQuery{FromBlock: big.NewInt(5), ToBlock: big.NewInt(4)}, "fromBlock"},
+		{fiscobcos.FilterQuery{GroupId: 32768}, "groupId"},
+		{fiscobcos.FilterQuery{BlockHash: &hash, FromBlock: big.NewInt(1)}, "blockHash"},
+		{fiscobcos.FilterQuery{BlockHash: &hash, ToBlock: latest}, "blockHash"},
+		{fiscobcos.FilterQuery{Topics: append(topics, nil)}, "topics"},
+		{fiscobcos.FilterQuery{}, ""},
+		{fiscobcos.FilterQuery{FromBlock: big.NewInt(4), ToBlock: big.NewInt(4)}, ""},
+		{fiscobcos.FilterQuery{FromBlock: big.NewInt(5), ToBlock: latest}, ""},
+		{fiscobcos.FilterQuery{FromBlock: latest, ToBlock: big.NewInt(3)}, ""},
+		{fiscobcos.FilterQuery{FromBlock: pending, ToBlock: pending}, ""},
+		{fiscobcos.FilterQuery{GroupId: 32767, BlockHash: &hash}, ""},
+		{fiscobcos.FilterQuery{Topics: topics}, ""},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("group %d, blocks %v-%v, %d topics", test.q.GroupId, test.q.FromBlock, test.q.ToBlock, len(test.q.Topics))
+		if test.q.BlockHash != nil {
+			name += ", block hash"
+		}
+		_, err := client.FilterLogs(context.Background(), test.q)
+		if test.param == "" {
+			if _, ok := err.(*ethclient.ValidationError); ok {
+				t.Errorf("FilterLogs(%s): rejected: %v", name, err)
+			}
+		} else if verr, ok := err.(*ethclient.ValidationError); !ok || verr.Param != test.param || verr.Method != "FilterLogs" {
+			t.Errorf("FilterLogs(%s): got error %v, want *ValidationError of %s", name, err, test.param)
+		} else if calls := node.Calls(); len(calls) != 0 {
+			t.Errorf("FilterLogs(%s): sent %d requests", name, len(calls))
+		}
+		node.Reset()
+
+		// Subscriptions are checked before the transport is.
+		_, err = client.SubscribeFilterLogs(context.Background(), test.q, make(chan types.Log))
+		if test.param == "" {
+			if err != ethclient.ErrSubscriptionUnsupported {
+				t.Errorf("SubscribeFilterLogs(%s): got error %v, want ErrSubscriptionUnsupported", name, err)
+			}
+		} else if verr, ok := err.(*ethclient.ValidationError); !ok || verr.Param != test.param || verr.Method != "SubscribeFilterLogs" {
+			t.Errorf("SubscribeFilterLogs(%s): got error %v, want *ValidationError of %s", name, err, test.param)
+		}
+	}
+}
+
+// TestFilterLogsGroup checks that logs are filtered in the group of the query,
+// or if it has none, the group of the context or the client default.
+func TestFilterLogsGroup(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	(&logChain{head: 3, every: 1}).serve(node)
+	client := node.Client()
+	client.SetDefaultGroup(4)
+
+	tests := []struct {
+		ctx   context.Context
+		group uint64 // of the query
+		want  uint64
+	}{
+		{context.Background(), 0, 4},
+		{context.Background(), 2, 2},
+		{fiscobcos.ContextWithGroup(context.Background(), 3), 0, 3},
+		{fiscobcos.ContextWithGroup(context.Background(), 3), 5, 5},
+	}
+	for _, test := range tests {
+		logs, err := client.FilterLogs(test.ctx, fiscobcos.FilterQuery{GroupId: test.group})
+		if err != nil || len(logs) != 4 {
+			t.Errorf("query group %d: got %d logs, error %v; want 4 logs", test.group, len(logs), err)
+		}
+		for _, method := range []string{"getBlockNumber", "getBlockByNumber", "getTransactionReceipt"} {
+			calls := node.CallsTo(method)
+			if len(calls) == 0 {
+				t.Errorf("query group %d: no %s request", test.group, method)
+			}
+			for _, call := range calls {
+				if group := groupParam(t, call); group != test.want {
+					t.Errorf("query group %d: %s sent to group %d, want %d", test.group, method, group, test.want)
+				}
+			}
+		}
+		node.Reset()
+	}
+}
+
+// TestFilterLogsBloomSkip checks that the receipts of blocks whose bloom rules
+// out a match are not fetched.
+func TestFilterLogsBloomSkip(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	(&logChain{head: 99, every: 10}).serve(node)
+	client := node.Client()
+
+	logs, err := client.FilterLogs(context.Background(), fiscobcos.FilterQuery{Topics: [][]common.Hash{{logTopic}}})
+	if err != nil {
+		t.Fatalf("FilterLogs error: %v", err)
+	}
+	if len(logs) != 10 {
+		t.Fatalf("got %d logs, want 10", len(logs))
+	}
+	if n := len(node.CallsTo("getTransactionReceipt")); n != 10 {
+		t.Errorf("fetched %d receipts, want 10", n)
+	}
+
+	node.Reset()
+	other := common.HexToHash("0x01")
+	logs, err = client.FilterLogs(context.Background(), fiscobcos.FilterQuery{Topics: [][]common.Hash{{other}}})
+	if err != nil {
+		t.Fatalf("FilterLogs error: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("got %d logs, want none", len(logs))
+	}
+	if n := len(node.CallsTo("getTransactionReceipt")); n > 1 {
+		t.Errorf("fetched %d receipts for a topic in no bloom", n)
+	}
+}
+
+// TestFilterLogsBloomMode checks that the blooms of guomi chains are checked
+// with SM3, and that blocks are scanned without checking their bloom if the
+// chain's cryptography is unknown.
+func TestFilterLogsBloomMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		chain       *logChain
+		checksBloom bool
+	}{
+		{name: "standard", chain: &logChain{head: 99, every: 10}, checksBloom: true},
+		{name: "gm", chain: &logChain{head: 99, every: 10, mode: types.ChainModeGM}, checksBloom: true},
+		{name: "unknown", chain: &logChain{head: 99, every: 10, mode: types.ChainModeGM, hideVersion: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := ethclienttest.NewFakeNode(t)
+			defer node.Close()
+			test.chain.serve(node)
+			client := node.Client()
+
+			logs, err := client.FilterLogs(context.Background(), fiscobcos.FilterQuery{Topics: [][]common.Hash{{logTopic}}})
+			if err != nil {
+				t.Fatalf("FilterLogs error: %v", err)
+			}
+			if len(logs) != 10 {
+				t.Fatalf("got %d logs, want 10", len(logs))
+			}
+
+			node.Reset()
+			logs, err = client.FilterLogs(context.Background(), fiscobcos.FilterQuery{Topics: [][]common.Hash{{common.HexToHash("0x01")}}})
+			if err != nil {
+				t.Fatalf("FilterLogs error: %v", err)
+			}
+			if len(logs) != 0 {
+				t.Fatalf("got %d logs, want none", len(logs))
+			}
+			n := len(node.CallsTo("getTransactionReceipt"))
+			if test.checksBloom && n > 1 {
+				t.Errorf("fetched %d receipts for a topic in no bloom", n)
+			}
+			if !test.checksBloom && n != 10 {
+				t.Errorf("fetched %d receipts, want all 10", n)
+			}
+		})
+	}
+}
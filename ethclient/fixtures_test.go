@@ -0,0 +1,415 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/internal/fixtures"
+)
+
+// serveFixture answers the method of the named exchange with its recorded
+// response, checking that the client sends the recorded parameters.
+func serveFixture(t *testing.T, node *ethclienttest.FakeNode, set *fixtures.Set, name string) {
+	ex := set.Exchange(t, name)
+	node.Handle(ex.Method, func(params []json.RawMessage) (interface{}, error) {
+		if set.Lookup(ex.Method, params) != ex {
+			t.Errorf("%s: %s sent with params %s, recorded with %s", set.Name, name, params, ex.Params)
+		}
+		if ex.Error != nil {
+			return nil, &ethclienttest.Error{Code: ex.Error.Code, Message: ex.Error.Message}
+		}
+		if ex.Result == nil {
+			return nil, nil
+		}
+		return ex.Result, nil
+	})
+}
+
+// fixtureFields decodes the result of the named exchange into a map, to compare
+// decoded values against the recorded ones.
+func fixtureFields(t *testing.T, set *fixtures.Set, name string) map[string]interface{} {
+	var fields map[string]interface{}
+	set.Decode(t, name, &fields)
+	return fields
+}
+
+// fixtureParam decodes parameter i of the named exchange, a JSON number or a
+// hex or decimal string, failing the test if it isn't a number.
+func fixtureParam(t *testing.T, set *fixtures.Set, name string, i int) uint64 {
+	var n hexutil.FlexibleUint64
+	if err := json.Unmarshal(set.Exchange(t, name).Params[i], &n); err != nil {
+		t.Fatalf("%s: %s: parameter %d: %v", set.Name, name, i, err)
+	}
+	return uint64(n)
+}
+
+// TestDecodeFixtures decodes the recorded responses of every node version with
+// the getters of the client.
+func TestDecodeFixtures(t *testing.T) {
+	ctx := context.Background()
+	for _, set := range fixtures.All(t) {
+		node := ethclienttest.NewFakeNode(t)
+		client := node.Client()
+		serveFixture(t, node, set, "getClientVersion")
+
+		version, err := client.ClientVersion(ctx)
+		if err != nil {
+			t.Fatalf("%s: getClientVersion: %v", set.Name, err)
+		}
+		if !version.AtLeast(set.Version) || version.IsGM() != set.GM {
+			t.Errorf("%s: version %q (gm %v), want %s (gm %v)", set.Name, version.Version, version.IsGM(), set.Version, set.GM)
+		}
+		if version.ParseChainId() == nil {
+			t.Errorf("%s: no chain id in %+v", set.Name, version)
+		}
+
+		serveFixture(t, node, set, "getBlockNumber")
+		number, err := client.BlockNumber(ctx, 1)
+		if err != nil || number.Sign() <= 0 {
+			t.Errorf("%s: getBlockNumber: %v, %v", set.Name, number, err)
+		}
+
+		for _, name := range []string{"getBlockByNumber/genesis", "getBlockByNumber/deploy", "getBlockByNumber/transactions", "getBlockByNumber/large"} {
+			serveFixture(t, node, set, name)
+			want := fixtureFields(t, set, name)
+			n := new(big.Int).SetUint64(fixtureParam(t, set, name, 1))
+			block, err := client.BlockByNumber(ctx, 1, n)
+			if err != nil {
+				t.Errorf("%s: %s: %v", set.Name, name, err)
+				continue
+			}
+			checkFixtureBlock(t, set, name, block, want)
+		}
+
+		serveFixture(t, node, set, "getBlockByNumber/hashes")
+		blockNumber := fixtureParam(t, set, "getBlockByNumber/hashes", 1)
+		header, err := client.HeaderByNumber(ctx, 1, new(big.Int).SetUint64(blockNumber))
+		if err != nil {
+			t.Errorf("%s: header: %v", set.Name, err)
+		} else if want := fixtureFields(t, set, "getBlockByNumber/hashes"); header.Hash != want["hash"] || header.TransactionsRoot != want["transactionsRoot"] {
+			t.Errorf("%s: header %s, root %s, want %s, %s", set.Name, header.Hash, header.TransactionsRoot, want["hash"], want["transactionsRoot"])
+		}
+
+		serveFixture(t, node, set, "getBlockByNumber/missing")
+		missing := new(big.Int).SetUint64(fixtureParam(t, set, "getBlockByNumber/missing", 1))
+		if _, err := client.BlockByNumber(ctx, 1, missing); err != fiscobcos.NotFound {
+			t.Errorf("%s: missing block: got error %v, want NotFound", set.Name, err)
+		}
+
+		blockHash := common.HexToHash(fixtureFields(t, set, "getBlockByHash")["hash"].(string))
+		serveFixture(t, node, set, "getBlockByHash")
+		if block, err := client.BlockByHash(ctx, 1, blockHash); err != nil {
+			t.Errorf("%s: getBlockByHash: %v", set.Name, err)
+		} else if common.HexToHash(block.Hash) != blockHash {
+			t.Errorf("%s: getBlockByHash returned block %s, want %s", set.Name, block.Hash, blockHash.Hex())
+		}
+		serveFixture(t, node, set, "getBlockHashByNumber")
+		if hash, err := client.BlockHashByNumber(ctx, 1, fixtureParam(t, set, "getBlockHashByNumber", 1)); err != nil || *hash != blockHash {
+			t.Errorf("%s: getBlockHashByNumber: %v, %v, want %s", set.Name, hash, err, blockHash.Hex())
+		}
+
+		checkFixtureTransactions(t, node, client, set, blockHash)
+		checkFixtureReceipts(t, node, client, set, blockNumber)
+		checkFixtureNodes(t, node, client, set)
+
+		serveFixture(t, node, set, "getPendingTransactions")
+		var wantPending []map[string]interface{}
+		set.Decode(t, "getPendingTransactions", &wantPending)
+		if pending, err := client.PendingTransactions(ctx, 1); err != nil || len(pending) != len(wantPending) {
+			t.Errorf("%s: getPendingTransactions: %+v, %v, want %v", set.Name, pending, err, wantPending)
+		} else {
+			for i, tx := range pending {
+				if tx.Hash.Hex() != wantPending[i]["hash"] || tx.Nonce == nil {
+					t.Errorf("%s: pending transaction %d: %+v, want %v", set.Name, i, tx, wantPending[i])
+				}
+			}
+		}
+		var wantSize hexutil.FlexibleUint64
+		set.Decode(t, "getPendingTxSize", &wantSize)
+		serveFixture(t, node, set, "getPendingTxSize")
+		if size, err := client.PendingTxSize(ctx, 1); err != nil || size != uint64(wantSize) {
+			t.Errorf("%s: getPendingTxSize: %d, %v, want %d", set.Name, size, err, wantSize)
+		}
+		serveFixture(t, node, set, "getTotalTransactionCount")
+		if count, err := client.TotalTransactionCount(ctx, 1); err != nil || count.TxSum == "" {
+			t.Errorf("%s: getTotalTransactionCount: %+v, %v", set.Name, count, err)
+		}
+		var wantLimit hexutil.FlexibleUint64
+		set.Decode(t, "getSystemConfigByKey", &wantLimit)
+		serveFixture(t, node, set, "getSystemConfigByKey")
+		if limit, err := client.TxCountLimit(ctx, 1); err != nil || limit != uint64(wantLimit) {
+			t.Errorf("%s: tx_count_limit: %d, %v, want %d", set.Name, limit, err, wantLimit)
+		}
+		serveFixture(t, node, set, "getPbftView")
+		if view, err := client.PbftView(ctx, 1); err != nil || view == 0 {
+			t.Errorf("%s: getPbftView: %d, %v", set.Name, view, err)
+		}
+
+		var code string
+		set.Decode(t, "getCode", &code)
+		contract := common.HexToAddress(string(set.Exchange(t, "getCode").Params[1][1:43]))
+		serveFixture(t, node, set, "getCode")
+		if got, err := client.CodeAt(ctx, 1, contract, nil); err != nil || common.ToHex(got) != code {
+			t.Errorf("%s: getCode: %x, %v, want %s", set.Name, got, err, code)
+		}
+
+		var callArg struct {
+			From common.Address `json:"from"`
+			To   common.Address `json:"to"`
+			Data string         `json:"data"`
+		}
+		if err := json.Unmarshal(set.Exchange(t, "call").Params[1], &callArg); err != nil {
+			t.Fatal(err)
+		}
+		var wantCall struct {
+			Status hexutil.FlexibleUint64 `json:"status"`
+			Output hexutil.Bytes          `json:"output"`
+		}
+		set.Decode(t, "call", &wantCall)
+		serveFixture(t, node, set, "call")
+		msg := fiscobcos.CallMsg{GroupId: 1, Msg: fiscobcos.CallEthMsg{From: callArg.From, To: &callArg.To, Data: common.FromHex(callArg.Data)}}
+		if result, err := client.CallContractDetailed(ctx, msg, nil); err != nil || result.Status != int(wantCall.Status) || !bytes.Equal(result.Output, wantCall.Output) {
+			t.Errorf("%s: call: %+v, %v, want %+v", set.Name, result, err, wantCall)
+		}
+
+		serveFixture(t, node, set, "error/groupNotExist")
+		if _, err := client.BlockNumber(ctx, fixtureParam(t, set, "error/groupNotExist", 0)); err == nil || err.(*ethclient.Error).Err != ethclient.ErrGroupNotExist {
+			t.Errorf("%s: unknown group: got error %v, want ErrGroupNotExist", set.Name, err)
+		}
+		node.Close()
+	}
+}
+
+func checkFixtureBlock(t *testing.T, set *fixtures.Set, name string, block *types.Block, want map[string]interface{}) {
+	t.Helper()
+	for field, have := range map[string]string{
+		"hash":             block.Hash,
+		"parentHash":       block.ParentHash,
+		"transactionsRoot": block.TransactionsRoot,
+		"receiptsRoot":     block.ReceiptsRoot,
+		"timestamp":        block.Timestamp,
+		"sealer":           block.Sealer,
+	} {
+		if have != want[field] {
+			t.Errorf("%s: %s: %s %s, want %v", set.Name, name, field, have, want[field])
+		}
+	}
+	txs := want["transactions"].([]interface{})
+	if len(block.Transactions) != len(txs) {
+		t.Fatalf("%s: %s: %d transactions, want %d", set.Name, name, len(block.Transactions), len(txs))
+	}
+	for i, tx := range txs {
+		if have := block.Transactions[i].Hash; have != tx.(map[string]interface{})["hash"] {
+			t.Errorf("%s: %s: transaction %d hash %s, want %v", set.Name, name, i, have, tx)
+		}
+	}
+	if len(block.SealerList) != len(want["sealerList"].([]interface{})) {
+		t.Errorf("%s: %s: %d sealers, want %d", set.Name, name, len(block.SealerList), len(want["sealerList"].([]interface{})))
+	}
+}
+
+func checkFixtureTransactions(t *testing.T, node *ethclienttest.FakeNode, client *ethclient.Client, set *fixtures.Set, blockHash common.Hash) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		get  func() (*types.TransactionByHash, error)
+	}{
+		{"getTransactionByHash", func() (*types.TransactionByHash, error) {
+			var hash common.Hash
+			json.Unmarshal(set.Exchange(t, "getTransactionByHash").Params[1], &hash)
+			return client.TransactionByHash(ctx, 1, hash)
+		}},
+		{"getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			name := "getTransactionByBlockNumberAndIndex"
+			number := new(big.Int).SetUint64(fixtureParam(t, set, name, 1))
+			return client.TransactionByBlockNumberAndIndex(ctx, 1, number, uint(fixtureParam(t, set, name, 2)))
+		}},
+		{"getTransactionByBlockHashAndIndex", func() (*types.TransactionByHash, error) {
+			index := fixtureParam(t, set, "getTransactionByBlockHashAndIndex", 2)
+			return client.TransactionByBlockHashAndIndex(ctx, 1, blockHash, uint(index))
+		}},
+	}
+	for _, test := range tests {
+		serveFixture(t, node, set, test.name)
+		want := fixtureFields(t, set, test.name)
+		tx, err := test.get()
+		if err != nil {
+			t.Errorf("%s: %s: %v", set.Name, test.name, err)
+			continue
+		}
+		if tx.Hash != want["hash"] || tx.BlockHash != want["blockHash"] || tx.From != want["from"] || tx.Input != want["input"] {
+			t.Errorf("%s: %s: got %+v, want %v", set.Name, test.name, tx, want)
+		}
+	}
+}
+
+func checkFixtureReceipts(t *testing.T, node *ethclienttest.FakeNode, client *ethclient.Client, set *fixtures.Set, blockNumber uint64) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		contract bool
+		failed   bool
+	}{
+		{"getTransactionReceipt/deploy", true, false},
+		{"getTransactionReceipt/events", false, false},
+		{"getTransactionReceipt/failed", false, true},
+	}
+	for _, test := range tests {
+		var want struct {
+			TxHash common.Hash `json:"transactionHash"`
+			Logs   []struct {
+				Topics []common.Hash `json:"topics"`
+			} `json:"logs"`
+		}
+		set.Decode(t, test.name, &want)
+		serveFixture(t, node, set, test.name)
+		receipt, err := client.TransactionReceipt(ctx, 1, want.TxHash)
+		if err != nil {
+			t.Errorf("%s: %s: %v", set.Name, test.name, err)
+			continue
+		}
+		status, err := receipt.StatusCode()
+		if err != nil || (status != types.StatusSuccess) != test.failed {
+			t.Errorf("%s: %s: status %v, %v", set.Name, test.name, status, err)
+		}
+		if (receipt.ContractAddress != nil) != test.contract || (receipt.To != nil) == test.contract {
+			t.Errorf("%s: %s: contract address %v, to %v", set.Name, test.name, receipt.ContractAddress, receipt.To)
+		}
+		if len(receipt.Logs) != len(want.Logs) {
+			t.Fatalf("%s: %s: %d logs, want %d", set.Name, test.name, len(receipt.Logs), len(want.Logs))
+		}
+		for i, log := range receipt.Logs {
+			if log.TxHash != receipt.TxHash || log.BlockHash != receipt.BlockHash || len(log.Topics) != len(want.Logs[i].Topics) {
+				t.Errorf("%s: %s: log %+v doesn't match its receipt", set.Name, test.name, log)
+			}
+			if !types.BloomLookupFor(receipt.Bloom, log.Address, chainMode(set)) {
+				t.Errorf("%s: %s: log address %s not in the bloom", set.Name, test.name, log.Address.Hex())
+			}
+		}
+	}
+
+	serveFixture(t, node, set, "getTransactionReceipt/missing")
+	var missing string
+	json.Unmarshal(set.Exchange(t, "getTransactionReceipt/missing").Params[1], &missing)
+	if _, err := client.TransactionReceipt(ctx, 1, common.HexToHash(missing)); err != fiscobcos.NotFound {
+		t.Errorf("%s: missing receipt: got error %v, want NotFound", set.Name, err)
+	}
+
+	// Nodes with batch receipt retrieval answer at once, others are asked for
+	// the block and its receipts one by one.
+	serveFixture(t, node, set, "getBatchReceiptsByBlockNumberAndRange")
+	serveFixture(t, node, set, "getBlockByNumber/hashes")
+	txs := fixtureFields(t, set, "getBlockByNumber/hashes")["transactions"].([]interface{})
+	byHash := make(map[string]json.RawMessage)
+	for _, name := range []string{"getTransactionReceipt/events", "getTransactionReceipt/failed"} {
+		byHash[fixtureFields(t, set, name)["transactionHash"].(string)] = set.Result(t, name)
+	}
+	second := fixtureFields(t, set, "getTransactionReceipt/events")
+	node.Handle("getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+		var hash string
+		json.Unmarshal(params[1], &hash)
+		if receipt, ok := byHash[hash]; ok {
+			return receipt, nil
+		}
+		// The receipt of the second transaction, which has the shape of the
+		// first.
+		receipt := make(map[string]interface{})
+		for k, v := range second {
+			receipt[k] = v
+		}
+		receipt["transactionHash"], receipt["transactionIndex"] = hash, "0x1"
+		return receipt, nil
+	})
+	receipts, err := client.BlockReceipts(ctx, 1, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		t.Errorf("%s: block receipts: %v", set.Name, err)
+	} else if len(receipts) != len(txs) {
+		t.Errorf("%s: %d block receipts, want %d", set.Name, len(receipts), len(txs))
+	} else {
+		for i, receipt := range receipts {
+			if receipt.TxHash.Hex() != txs[i] {
+				t.Errorf("%s: block receipt %d of %s, want %v", set.Name, i, receipt.TxHash.Hex(), txs[i])
+			}
+		}
+	}
+	if n := len(node.CallsTo("getBatchReceiptsByBlockNumberAndRange")); n != 1 {
+		t.Errorf("%s: %d batch receipt requests, want 1", set.Name, n)
+	}
+}
+
+func checkFixtureNodes(t *testing.T, node *ethclienttest.FakeNode, client *ethclient.Client, set *fixtures.Set) {
+	ctx := context.Background()
+	lists := []struct {
+		name string
+		get  func() ([]string, error)
+	}{
+		{"getSealerList", func() ([]string, error) { return client.SealerList(ctx, 1) }},
+		{"getObserverList", func() ([]string, error) { return client.ObserverList(ctx, 1) }},
+		{"getGroupPeers", func() ([]string, error) { return client.GroupPeers(ctx, 1) }},
+		{"getNodeIDList", func() ([]string, error) { return client.NodeIDList(ctx, 1) }},
+	}
+	for _, list := range lists {
+		var want []string
+		set.Decode(t, list.name, &want)
+		serveFixture(t, node, set, list.name)
+		have, err := list.get()
+		if err != nil || len(have) != len(want) {
+			t.Errorf("%s: %s: %v, %v, want %v", set.Name, list.name, have, err, want)
+		}
+	}
+
+	serveFixture(t, node, set, "getConsensusStatus")
+	status, err := client.ConsensusStatus(ctx, 1)
+	if err != nil {
+		t.Errorf("%s: getConsensusStatus: %v", set.Name, err)
+	} else if len(status.Sealers) == 0 || status.NodeId == "" || len(status.Views) == 0 || status.NodeNum != len(status.Sealers) {
+		t.Errorf("%s: getConsensusStatus: %+v", set.Name, status)
+	}
+
+	serveFixture(t, node, set, "getSyncStatus")
+	sync, err := client.SyncStatus(ctx, 1)
+	if err != nil {
+		t.Errorf("%s: getSyncStatus: %v", set.Name, err)
+	} else if want := fixtureFields(t, set, "getSyncStatus"); sync.NodeID != want["nodeId"] || len(sync.Peers) != len(want["peers"].([]interface{})) || sync.HighestNumber() == 0 {
+		t.Errorf("%s: getSyncStatus: %+v", set.Name, sync)
+	}
+
+	serveFixture(t, node, set, "getGroupList")
+	var wantGroups []int64
+	set.Decode(t, "getGroupList", &wantGroups)
+	if groups, err := client.GroupList(ctx); err != nil || len(groups) != len(wantGroups) {
+		t.Errorf("%s: getGroupList: %v, %v, want %v", set.Name, groups, err, wantGroups)
+	}
+}
+
+func chainMode(set *fixtures.Set) types.ChainMode {
+	if set.GM {
+		return types.ChainModeGM
+	}
+	return types.ChainModeStandard
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// Errors reported by the group management operations. The operation result,
+// including the node's message, is returned alongside them.
+var (
+	ErrGroupAlreadyExists       = errors.New("group already exists")
+	ErrGenesisConfAlreadyExists = errors.New("group genesis configuration already exists")
+	ErrGroupConfAlreadyExists   = errors.New("group configuration already exists")
+	ErrInvalidGroupParams       = errors.New("invalid group parameters")
+	ErrSealersNotConnected      = errors.New("sealers of the group are not connected")
+	ErrGroupNotFound            = errors.New("group not found")
+	ErrGroupAlreadyRunning      = errors.New("group is already running")
+	ErrGroupNotRunning          = errors.New("group is not running")
+	ErrGroupIsRunning           = errors.New("group is running, stop it first")
+	ErrGroupAlreadyDeleted      = errors.New("group is already deleted")
+	ErrGroupNotDeleted          = errors.New("group is not deleted")
+	ErrGroupOperationFailed     = errors.New("group operation failed")
+)
+
+// groupErrors maps the non-zero result codes of the group management methods
+// to errors. The meaning of a code depends on the operation.
+var groupErrors = map[string]map[uint64]error{
+	"generateGroup": {
+		0x1: ErrGroupAlreadyExists,
+		0x2: ErrGenesisConfAlreadyExists,
+		0x3: ErrGroupConfAlreadyExists,
+		0x4: ErrInvalidGroupParams,
+		0x5: ErrSealersNotConnected,
+	},
+	"startGroup": {
+		0x1: ErrGroupNotFound,
+		0x2: ErrGroupAlreadyRunning,
+	},
+	"stopGroup": {
+		0x1: ErrGroupNotFound,
+		0x2: ErrGroupNotRunning,
+	},
+	"removeGroup": {
+		0x1: ErrGroupNotFound,
+		0x2: ErrGroupIsRunning,
+		0x3: ErrGroupAlreadyDeleted,
+	},
+	"recoverGroup": {
+		0x1: ErrGroupNotFound,
+		0x2: ErrGroupNotDeleted,
+	},
+	"queryGroupStatus": {
+		0x1: ErrGroupNotFound,
+	},
+}
+
+// GenerateGroup creates the configuration of a new group on the node. The group
+// has to be started with StartGroup afterwards.
+func (ec *Client) GenerateGroup(ctx context.Context, groupId uint64, params types.GroupParams) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "generateGroup", groupId, params)
+}
+
+// StartGroup starts a generated or stopped group.
+func (ec *Client) StartGroup(ctx context.Context, groupId uint64) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "startGroup", groupId)
+}
+
+// StopGroup stops a running group.
+func (ec *Client) StopGroup(ctx context.Context, groupId uint64) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "stopGroup", groupId)
+}
+
+// RemoveGroup deletes a stopped group. Its data is kept and can be restored with
+// RecoverGroup.
+func (ec *Client) RemoveGroup(ctx context.Context, groupId uint64) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "removeGroup", groupId)
+}
+
+// RecoverGroup restores a removed group.
+func (ec *Client) RecoverGroup(ctx context.Context, groupId uint64) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "recoverGroup", groupId)
+}
+
+// QueryGroupStatus returns the status of a group, one of the types.GroupStatus
+// constants.
+func (ec *Client) QueryGroupStatus(ctx context.Context, groupId uint64) (*types.GroupOpResult, error) {
+	return ec.groupOp(ctx, "queryGroupStatus", groupId)
+}
+
+// Groups returns the groups of the node along with their status and genesis
+// hash, querying the groups concurrently. The status of the groups of nodes
+// before 2.2 is types.GroupStatusUnknown. The genesis hash is only known for
+// running groups.
+func (ec *Client) Groups(ctx context.Context) ([]types.GroupInfo, error) {
+	return ec.groups(ctx, true)
+}
+
+// groups lists the groups of the node, querying their status and genesis hash
+// if detailed is set.
+func (ec *Client) groups(ctx context.Context, detailed bool) ([]types.GroupInfo, error) {
+	ids, err := ec.getGroupList(ctx, "getGroupList")
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]types.GroupInfo, len(ids))
+	for i, id := range ids {
+		groups[i].ID = uint64(id)
+	}
+	if !detailed {
+		return groups, nil
+	}
+	var (
+		errs = make([]error, len(groups))
+		wg   sync.WaitGroup
+	)
+	for i := range groups {
+		wg.Add(1)
+		go func(group *types.GroupInfo, err *error) {
+			defer wg.Done()
+			*err = ec.groupInfo(ctx, group)
+		}(&groups[i], &errs[i])
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// groupInfo fills in the status and genesis hash of a group.
+func (ec *Client) groupInfo(ctx context.Context, group *types.GroupInfo) error {
+	result, err := ec.QueryGroupStatus(ctx, group.ID)
+	switch e, _ := err.(*Error); {
+	case err == nil:
+		group.Status = result.Status
+	case e != nil && e.Err == ErrMethodNotFound:
+		group.Status = types.GroupStatusUnknown
+	case err == ErrGroupNotFound:
+		group.Status = types.GroupStatusInexistent
+	default:
+		return err
+	}
+	if group.Status != types.GroupStatusRunning && group.Status != types.GroupStatusUnknown {
+		return nil
+	}
+	hash, err := ec.BlockHashByNumber(ctx, group.ID, 0)
+	if _, ok := err.(*Error); ok || err == fiscobcos.NotFound {
+		// The group may have stopped meanwhile.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	group.GenesisHash = hash.Hex()
+	return nil
+}
+
+// groupOp calls a group management method and maps its result code to an error.
+// Group management targets a group explicitly, so groupId is not resolved from
+// the context or the client default.
+func (ec *Client) groupOp(ctx context.Context, method string, groupId uint64, args ...interface{}) (*types.GroupOpResult, error) {
+	var result *types.GroupOpResult
+	if err := ec.callResult(ctx, &result, method, append([]interface{}{groupId}, args...)...); err != nil {
+		return nil, err
+	}
+	code, err := hexutil.DecodeFlexibleUint64(result.Code)
+	if err != nil {
+		return result, fmt.Errorf("invalid %s result code %q: %v", method, result.Code, err)
+	}
+	if code == 0 {
+		return result, nil
+	}
+	if err, ok := groupErrors[method][code]; ok {
+		return result, err
+	}
+	return result, ErrGroupOperationFailed
+}
@@ -0,0 +1,390 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// groupParam returns the group the call was sent to, its first parameter.
+func groupParam(t *testing.T, call ethclienttest.Call) uint64 {
+	t.Helper()
+	if len(call.Params) == 0 {
+		t.Fatalf("%s sent without parameters", call.Method)
+	}
+	var groupId uint64
+	if err := json.Unmarshal(call.Params[0], &groupId); err != nil {
+		t.Fatalf("%s sent with group %s: %v", call.Method, call.Params[0], err)
+	}
+	return groupId
+}
+
+func newGroupTx(groupId int64) *types.Transaction {
+	var group *big.Int
+	if groupId != 0 {
+		group = big.NewInt(groupId)
+	}
+	return types.NewTransaction(big.NewInt(1), common.Address{1}, new(big.Int), 30000000, new(big.Int), nil, big.NewInt(600), big.NewInt(1), group, nil)
+}
+
+func TestGroupPrecedence(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	sent := make(chan struct{}, 1)
+	node.Handle("sendRawTransaction", func([]json.RawMessage) (interface{}, error) {
+		select {
+		case sent <- struct{}{}:
+		default:
+		}
+		return common.Hash{}.Hex(), nil
+	})
+
+	tests := []struct {
+		explicit   uint64 // groupId argument
+		context    uint64 // group carried by the context, 0 for none
+		defaultGrp uint64 // set with SetDefaultGroup, 0 to keep the initial default
+		txGroup    int64  // group the transaction is signed for, 0 for none
+		wantCall   uint64 // group of the getter
+		wantSend   uint64 // group of the transaction sent with SendTransaction
+		wantAsync  uint64 // group of the transaction sent with SendTransactionAsync
+	}{
+		{wantCall: 1, wantSend: 1, wantAsync: 1},
+		{defaultGrp: 5, wantCall: 5, wantSend: 5, wantAsync: 5},
+		{context: 2, wantCall: 2, wantSend: 2, wantAsync: 2},
+		{context: 2, defaultGrp: 5, wantCall: 2, wantSend: 2, wantAsync: 2},
+		{explicit: 3, wantCall: 3, wantSend: 1, wantAsync: 3},
+		{explicit: 3, context: 2, defaultGrp: 5, wantCall: 3, wantSend: 2, wantAsync: 3},
+		{txGroup: 4, wantCall: 1, wantSend: 4, wantAsync: 4},
+		{txGroup: 4, context: 2, defaultGrp: 5, wantCall: 2, wantSend: 4, wantAsync: 4},
+		{txGroup: 4, explicit: 4, context: 2, defaultGrp: 5, wantCall: 4, wantSend: 4, wantAsync: 4},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			client := node.Client()
+			client.SetDefaultGroup(test.defaultGrp)
+			ctx := context.Background()
+			if test.context != 0 {
+				ctx = fiscobcos.ContextWithGroup(ctx, test.context)
+			}
+			node.Reset()
+
+			if _, err := client.BlockNumber(ctx, test.explicit); err != nil {
+				t.Fatalf("BlockNumber error: %v", err)
+			}
+			if have := groupParam(t, node.CallsTo("getBlockNumber")[0]); have != test.wantCall {
+				t.Errorf("getter sent to group %d, want %d", have, test.wantCall)
+			}
+
+			if err := client.SendTransaction(ctx, newGroupTx(test.txGroup)); err != nil {
+				t.Fatalf("SendTransaction error: %v", err)
+			}
+			<-sent
+			if have := groupParam(t, node.CallsTo("sendRawTransaction")[0]); have != test.wantSend {
+				t.Errorf("SendTransaction sent to group %d, want %d", have, test.wantSend)
+			}
+
+			// The receipt is never found, the wait ends with the canceled context.
+			asyncCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			client.SendTransactionAsync(asyncCtx, test.explicit, newGroupTx(test.txGroup), func(*types.Receipt, error) { close(done) })
+			<-sent
+			cancel()
+			<-done
+			if have := groupParam(t, node.CallsTo("sendRawTransaction")[1]); have != test.wantAsync {
+				t.Errorf("SendTransactionAsync sent to group %d, want %d", have, test.wantAsync)
+			}
+		})
+	}
+}
+
+// TestTransactionGroupMismatch checks that a transaction isn't sent to another
+// group than the one it is signed for.
+func TestTransactionGroupMismatch(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	errc := make(chan error, 1)
+	client.SendTransactionAsync(context.Background(), 3, newGroupTx(4), func(_ *types.Receipt, err error) { errc <- err })
+	select {
+	case err := <-errc:
+		if verr, ok := err.(*ethclient.ValidationError); !ok || verr.Param != "groupId" {
+			t.Errorf("got error %v, want a *ValidationError of the groupId", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not called")
+	}
+	if calls := node.CallsTo("sendRawTransaction"); len(calls) != 0 {
+		t.Errorf("sent %d transactions, want none", len(calls))
+	}
+}
+
+// TestSetDefaultGroupConcurrent changes the default group while calls resolve
+// it, for the race detector.
+func TestSetDefaultGroupConcurrent(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	client := node.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				client.SetDefaultGroup(uint64(i + 1))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := client.BlockNumber(context.Background(), 0); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, call := range node.CallsTo("getBlockNumber") {
+		if groupId := groupParam(t, call); groupId < 1 || groupId > 8 {
+			t.Fatalf("call sent to group %d", groupId)
+		}
+	}
+}
+
+// TestGroupOps checks that the result codes of the group management methods are
+// mapped to the errors of each operation.
+func TestGroupOps(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	sealer := strings.Repeat("ab", 64)
+	ops := map[string]func(groupId uint64) (*types.GroupOpResult, error){
+		"generateGroup": func(groupId uint64) (*types.GroupOpResult, error) {
+			params := types.GroupParams{Timestamp: 1571200000000, Sealers: []string{sealer}, EnableFreeStorage: true}
+			return client.GenerateGroup(context.Background(), groupId, params)
+		},
+		"startGroup": func(groupId uint64) (*types.GroupOpResult, error) {
+			return client.StartGroup(context.Background(), groupId)
+		},
+		"stopGroup": func(groupId uint64) (*types.GroupOpResult, error) {
+			return client.StopGroup(context.Background(), groupId)
+		},
+		"removeGroup": func(groupId uint64) (*types.GroupOpResult, error) {
+			return client.RemoveGroup(context.Background(), groupId)
+		},
+		"recoverGroup": func(groupId uint64) (*types.GroupOpResult, error) {
+			return client.RecoverGroup(context.Background(), groupId)
+		},
+		"queryGroupStatus": func(groupId uint64) (*types.GroupOpResult, error) {
+			return client.QueryGroupStatus(context.Background(), groupId)
+		},
+	}
+	tests := []struct {
+		method string
+		code   string
+		want   error
+	}{
+		{"generateGroup", "0x0", nil},
+		{"generateGroup", "0x1", ethclient.ErrGroupAlreadyExists},
+		{"generateGroup", "0x2", ethclient.ErrGenesisConfAlreadyExists},
+		{"generateGroup", "0x3", ethclient.ErrGroupConfAlreadyExists},
+		{"generateGroup", "0x4", ethclient.ErrInvalidGroupParams},
+		{"generateGroup", "0x5", ethclient.ErrSealersNotConnected},
+		{"generateGroup", "0x6", ethclient.ErrGroupOperationFailed},
+		{"startGroup", "0x0", nil},
+		{"startGroup", "0x1", ethclient.ErrGroupNotFound},
+		{"startGroup", "0x2", ethclient.ErrGroupAlreadyRunning},
+		{"stopGroup", "0x2", ethclient.ErrGroupNotRunning},
+		{"removeGroup", "0x2", ethclient.ErrGroupIsRunning},
+		{"removeGroup", "0x3", ethclient.ErrGroupAlreadyDeleted},
+		{"recoverGroup", "0x2", ethclient.ErrGroupNotDeleted},
+		{"recoverGroup", "0x3", ethclient.ErrGroupOperationFailed},
+		{"queryGroupStatus", "0x0", nil},
+		{"queryGroupStatus", "1", ethclient.ErrGroupNotFound},
+	}
+	for _, test := range tests {
+		node.Respond(test.method, &types.GroupOpResult{Code: test.code, Message: "message " + test.code, Status: types.GroupStatusStopped})
+		result, err := ops[test.method](3)
+		if err != test.want {
+			t.Errorf("%s with code %s: got error %v, want %v", test.method, test.code, err, test.want)
+		}
+		if result == nil || result.Message != "message "+test.code {
+			t.Errorf("%s with code %s: got result %+v", test.method, test.code, result)
+		}
+	}
+
+	node.Respond("startGroup", &types.GroupOpResult{Code: "success"})
+	if _, err := client.StartGroup(context.Background(), 3); err == nil || err == ethclient.ErrGroupOperationFailed {
+		t.Errorf("invalid result code: got error %v", err)
+	}
+
+	// The group is sent as is, and the parameters of a new group as the node
+	// expects them.
+	node.Reset()
+	ops["generateGroup"](3)
+	calls := node.CallsTo("generateGroup")
+	if len(calls) != 1 || groupParam(t, calls[0]) != 3 {
+		t.Fatalf("generateGroup sent as %+v", calls)
+	}
+	want := `{"timestamp":"1571200000000","sealers":["` + sealer + `"],"enable_free_storage":true}`
+	if string(calls[0].Params[1]) != want {
+		t.Errorf("generateGroup params %s, want %s", calls[0].Params[1], want)
+	}
+	if _, err := client.GenerateGroup(context.Background(), 3, types.GroupParams{Sealers: []string{"ab"}}); err == nil {
+		t.Error("GenerateGroup accepted a malformed sealer")
+	}
+}
+
+// TestGroups checks that the groups are listed with the status and genesis hash
+// each node version reports.
+func TestGroups(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	genesis := func(groupId uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(0x6e00 + groupId)) }
+	tests := []struct {
+		name     string
+		statuses map[uint64]interface{} // status, result code or *ethclienttest.Error
+		hashless map[uint64]bool        // groups whose genesis hash is not found
+		want     []types.GroupInfo
+		wantErr  bool
+	}{
+		{
+			name:     "current node",
+			statuses: map[uint64]interface{}{1: types.GroupStatusRunning, 2: types.GroupStatusStopped, 3: "0x1", 4: types.GroupStatusRunning},
+			hashless: map[uint64]bool{4: true},
+			want: []types.GroupInfo{
+				{ID: 1, Status: types.GroupStatusRunning, GenesisHash: genesis(1).Hex()},
+				{ID: 2, Status: types.GroupStatusStopped},
+				{ID: 3, Status: types.GroupStatusInexistent},
+				{ID: 4, Status: types.GroupStatusRunning},
+			},
+		},
+		{
+			name:     "node before 2.2",
+			statuses: map[uint64]interface{}{1: &ethclienttest.Error{Code: -32601, Message: "Method not found"}, 2: &ethclienttest.Error{Code: -32601, Message: "Method not found"}},
+			want: []types.GroupInfo{
+				{ID: 1, Status: types.GroupStatusUnknown, GenesisHash: genesis(1).Hex()},
+				{ID: 2, Status: types.GroupStatusUnknown, GenesisHash: genesis(2).Hex()},
+			},
+		},
+		{
+			name:     "status failure",
+			statuses: map[uint64]interface{}{1: types.GroupStatusRunning, 2: &ethclienttest.Error{Code: -32000, Message: "busy"}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid result code",
+			statuses: map[uint64]interface{}{1: "success"},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		var ids []string // listed as strings, as by old nodes
+		for id := uint64(1); id <= uint64(len(test.statuses)); id++ {
+			ids = append(ids, fmt.Sprint(id))
+		}
+		node.Respond("getGroupList", ids)
+		node.Handle("queryGroupStatus", func(params []json.RawMessage) (interface{}, error) {
+			var groupId uint64
+			json.Unmarshal(params[0], &groupId)
+			switch status := test.statuses[groupId].(type) {
+			case *ethclienttest.Error:
+				return nil, status
+			case string:
+				if strings.ToUpper(status) == status {
+					return &types.GroupOpResult{Code: "0x0", Status: status}, nil
+				}
+				return &types.GroupOpResult{Code: status}, nil
+			}
+			return nil, fmt.Errorf("status of group %d queried", groupId)
+		})
+		node.Handle("getBlockHashByNumber", func(params []json.RawMessage) (interface{}, error) {
+			var groupId uint64
+			json.Unmarshal(params[0], &groupId)
+			if test.hashless[groupId] {
+				return nil, nil
+			}
+			return genesis(groupId), nil
+		})
+		node.Reset()
+
+		groups, err := client.Groups(context.Background())
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got groups %+v, want an error", test.name, groups)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if len(groups) != len(test.want) {
+			t.Errorf("%s: got groups %+v, want %+v", test.name, groups, test.want)
+			continue
+		}
+		for i := range groups {
+			if groups[i] != test.want[i] {
+				t.Errorf("%s: got group %+v, want %+v", test.name, groups[i], test.want[i])
+			}
+		}
+		for _, call := range node.CallsTo("getBlockHashByNumber") {
+			var number string
+			if json.Unmarshal(call.Params[1], &number); number != "0x0" {
+				t.Errorf("%s: genesis hash requested for block %s", test.name, call.Params[1])
+			}
+		}
+	}
+
+	// GroupList only lists the groups.
+	node.Respond("getGroupList", []string{"1", "5"})
+	node.Reset()
+	ids, err := client.GroupList(context.Background())
+	if err != nil || len(ids) != 2 || ids[0] != 1 || ids[1] != 5 {
+		t.Errorf("GroupList: got %v, error %v", ids, err)
+	}
+	if calls := node.Calls(); len(calls) != 1 || calls[0].Method != "getGroupList" {
+		t.Errorf("GroupList sent %+v, want a single getGroupList", calls)
+	}
+	node.RespondError("getGroupList", -32000, "busy")
+	if _, err := client.Groups(context.Background()); err == nil {
+		t.Error("Groups: listing failure not returned")
+	}
+	if _, err := client.GroupList(context.Background()); err == nil {
+		t.Error("GroupList: listing failure not returned")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package ethclient
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+const (
+	// headPollMin and headPollMax bound the interval at which the head tracker
+	// polls the block number of groups without block notifications. It shrinks
+	// while blocks come in and grows while the chain is idle or the node fails.
+	headPollMin = 500 * time.Millisecond
+	headPollMax = 5 * time.Second
+)
+
+// HeadEvent reports that the latest block number of a group advanced.
+type HeadEvent struct {
+	GroupId uint64
+	Number  uint64
+}
+
+// HeadTracker keeps the latest block number of a set of groups current for all
+// users of a client, see Client.TrackHeads.
+type HeadTracker struct {
+	ec   *Client
+	wake chan struct{} // polls all groups right away, e.g. after reconnecting
+
+	mu        sync.Mutex
+	groups    map[uint64]*trackedGroup
+	listeners map[*headListener]struct{}
+}
+
+// trackedGroup is the polling state of a group.
+type trackedGroup struct {
+	height   *chainHeight
+	interval time.Duration // current polling interval
+	next     time.Time     // when the group is polled next
+}
+
+// headListener receives the head changes of a group, or of all groups if
+// groupId is 0. fn must not block.
+type headListener struct {
+	groupId uint64
+	fn      func(HeadEvent)
+}
+
+// TrackHeads starts tracking the latest block number of the given groups and
+// returns the tracker of the client. Every client has a single tracker, calling
+// TrackHeads again adds groups to it.
+//
+// Over the channel protocol the block notifications of the node keep the
+// numbers current, otherwise the tracker polls the node, more often while
+// blocks are committed than while the chain is idle. All groups are polled
+// right away after the client reconnects, to catch up with the blocks missed
+// meanwhile. Tracked numbers are shared by the consumers within the client:
+// GetBlockLimit takes them without asking the node, and SubscribeBlockNumber
+// and FollowBlocks are served by the polling on transports without block
+// notifications. The tracker stops when the client is closed.
+func (ec *Client) TrackHeads(groupIds ...uint64) *HeadTracker {
+	ec.headsMu.Lock()
+	t := ec.heads
+	if t == nil {
+		t = &HeadTracker{
+			ec:        ec,
+			wake:      make(chan struct{}, 1),
+			groups:    make(map[uint64]*trackedGroup),
+			listeners: make(map[*headListener]struct{}),
+		}
+		ec.heads = t
+		if !ec.closed() {
+			go t.loop()
+		}
+	}
+	ec.headsMu.Unlock()
+
+	added := false
+	for _, groupId := range groupIds {
+		groupId = ec.group(context.Background(), groupId)
+		height := ec.chainHeight(groupId)
+
+		t.mu.Lock()
+		if t.groups[groupId] == nil {
+			t.groups[groupId] = &trackedGroup{height: height, interval: headPollMin}
+			added = true
+		}
+		t.mu.Unlock()
+
+		height.mu.Lock()
+		height.tracked = true
+		height.mu.Unlock()
+	}
+	if added {
+		t.poke()
+	}
+	return t
+}
+
+// headTracker returns the tracker of the client, nil if TrackHeads was never
+// called.
+func (ec *Client) headTracker() *HeadTracker {
+	ec.headsMu.Lock()
+	defer ec.headsMu.Unlock()
+	return ec.heads
+}
+
+// Current returns the latest block number of a tracked group. ok is false if
+// the group isn't tracked or no number is known yet.
+func (t *HeadTracker) Current(groupId uint64) (number uint64, ok bool) {
+	groupId = t.ec.group(context.Background(), groupId)
+
+	t.mu.Lock()
+	g := t.groups[groupId]
+	t.mu.Unlock()
+	if g == nil {
+		return 0, false
+	}
+	g.height.mu.Lock()
+	defer g.height.mu.Unlock()
+	return g.height.number, !g.height.updated.IsZero()
+}
+
+// Subscribe delivers the head changes of all tracked groups to ch. A consumer
+// falling behind only receives the latest number of each group, in the order
+// of the group IDs. The subscription ends, closing its error channel, when the
+// client is closed.
+func (t *HeadTracker) Subscribe(ch chan<- HeadEvent) fiscobcos.Subscription {
+	var (
+		mu      sync.Mutex
+		pending = make(map[uint64]uint64)
+		wake    = make(chan struct{}, 1)
+	)
+	cancel := t.listen(0, func(ev HeadEvent) {
+		mu.Lock()
+		if ev.Number > pending[ev.GroupId] {
+			pending[ev.GroupId] = ev.Number
+		}
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	return event.NewSubscription(func(unsub <-chan struct{}) error {
+		defer cancel()
+		for {
+			select {
+			case <-wake:
+			case <-unsub:
+				return nil
+			case <-t.ec.closeCtx.Done():
+				return nil
+			}
+			mu.Lock()
+			events := make([]HeadEvent, 0, len(pending))
+			for groupId, number := range pending {
+				events = append(events, HeadEvent{GroupId: groupId, Number: number})
+			}
+			pending = make(map[uint64]uint64)
+			mu.Unlock()
+
+			sort.Slice(events, func(i, j int) bool { return events[i].GroupId < events[j].GroupId })
+			for _, ev := range events {
+				select {
+				case ch <- ev:
+				case <-unsub:
+					return nil
+				case <-t.ec.closeCtx.Done():
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// tracks reports whether a group is tracked.
+func (t *HeadTracker) tracks(groupId uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.groups[groupId] != nil
+}
+
+// listen registers fn for the head changes of a group, of all groups if
+// groupId is 0. The returned function removes the registration.
+func (t *HeadTracker) listen(groupId uint64, fn func(HeadEvent)) (cancel func()) {
+	l := &headListener{groupId: groupId, fn: fn}
+	t.mu.Lock()
+	t.listeners[l] = struct{}{}
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.listeners, l)
+		t.mu.Unlock()
+	}
+}
+
+// changed notifies the listeners that the latest block number of a group
+// advanced.
+func (t *HeadTracker) changed(groupId, number uint64) {
+	t.mu.Lock()
+	if t.groups[groupId] == nil {
+		t.mu.Unlock()
+		return
+	}
+	var fns []func(HeadEvent)
+	for l := range t.listeners {
+		if l.groupId == 0 || l.groupId == groupId {
+			fns = append(fns, l.fn)
+		}
+	}
+	t.mu.Unlock()
+
+	ev := HeadEvent{GroupId: groupId, Number: number}
+	for _, fn := range fns {
+		fn(ev)
+	}
+}
+
+// poke makes the tracker poll all groups right away.
+func (t *HeadTracker) poke() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop polls the block number of the tracked groups until the client is closed.
+func (t *HeadTracker) loop() {
+	cancel := t.ec.OnReconnect(t.poke)
+	defer cancel()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		all := false
+		select {
+		case <-timer.C:
+		case <-t.wake:
+			all = true
+			timer.Stop()
+			select {
+			case <-timer.C:
+			default:
+			}
+		case <-t.ec.closeCtx.Done():
+			return
+		}
+		timer.Reset(t.poll(all))
+	}
+}
+
+// poll fetches the block number of the groups due, or of all groups if all is
+// set, and returns the wait until the next group is due. Groups kept current by
+// block notifications are only polled with all set.
+func (t *HeadTracker) poll(all bool) time.Duration {
+	t.mu.Lock()
+	due := make(map[uint64]*trackedGroup, len(t.groups))
+	for groupId, g := range t.groups {
+		due[groupId] = g
+	}
+	t.mu.Unlock()
+
+	wait := headPollMax
+	for groupId, g := range due {
+		now := time.Now()
+		g.height.mu.Lock()
+		pushed := g.height.pushing(now)
+		g.height.mu.Unlock()
+
+		if !all && (pushed || now.Before(g.next)) {
+			if !pushed {
+				wait = minDuration(wait, g.next.Sub(now))
+			}
+			continue
+		}
+		number, err := t.ec.BlockNumber(t.ec.closeCtx, groupId)
+		switch {
+		case t.ec.closed():
+			return headPollMax
+		case err != nil:
+			log.Debug("Failed to poll block number", "group", groupId, "err", err)
+			g.interval = minDuration(2*g.interval, headPollMax)
+		case t.ec.observeHeight(groupId, g.height, number.Uint64(), false):
+			g.interval = g.interval / 2
+			if g.interval < headPollMin {
+				g.interval = headPollMin
+			}
+		default:
+			g.interval = minDuration(2*g.interval, headPollMax)
+		}
+		g.next = time.Now().Add(g.interval)
+		if !pushed {
+			wait = minDuration(wait, g.interval)
+		}
+	}
+	return wait
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
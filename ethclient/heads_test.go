@@ -0,0 +1,198 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// groupHeads answers getBlockNumber with the number set for the group.
+type groupHeads struct {
+	mu      sync.Mutex
+	numbers map[uint64]uint64
+}
+
+func (h *groupHeads) serve(node *ethclienttest.FakeNode) {
+	node.Handle("getBlockNumber", func(params []json.RawMessage) (interface{}, error) {
+		var group uint64
+		if err := json.Unmarshal(params[0], &group); err != nil {
+			return nil, err
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return hexutil.EncodeUint64(h.numbers[group]), nil
+	})
+}
+
+func (h *groupHeads) set(group, number uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.numbers[group] = number
+}
+
+// waitHead waits for the tracker to report a block number of a group.
+func waitHead(t *testing.T, tracker *ethclient.HeadTracker, group, want uint64) {
+	t.Helper()
+	var (
+		number uint64
+		ok     bool
+	)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if number, ok = tracker.Current(group); ok && number == want {
+			return
+		}
+	}
+	t.Fatalf("group %d: current block %d (known %v), want %d", group, number, ok, want)
+}
+
+// receiveHead waits for the next head event.
+func receiveHead(t *testing.T, ch <-chan ethclient.HeadEvent) ethclient.HeadEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(10 * time.Second):
+		t.Fatal("no head event")
+	}
+	return ethclient.HeadEvent{}
+}
+
+// TestTrackHeadsPoll checks that the heads of groups are polled over HTTP and
+// shared with the other consumers of the client.
+func TestTrackHeadsPoll(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	heads := &groupHeads{numbers: map[uint64]uint64{1: 10, 2: 20, 3: 30}}
+	heads.serve(node)
+	client := node.Client()
+
+	tracker := client.TrackHeads(1, 2)
+	if again := client.TrackHeads(); again != tracker {
+		t.Error("TrackHeads returned another tracker")
+	}
+	events := make(chan ethclient.HeadEvent, 8)
+	sub := tracker.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	waitHead(t, tracker, 1, 10)
+	waitHead(t, tracker, 2, 20)
+	if number, ok := tracker.Current(3); ok {
+		t.Errorf("untracked group 3: current block %d", number)
+	}
+
+	// The consumers take the tracked number without asking the node.
+	node.Reset()
+	for i := 0; i < 5; i++ {
+		if limit, err := client.GetBlockLimit(context.Background(), 1); err != nil || limit.Uint64() <= 10 {
+			t.Fatalf("GetBlockLimit: %v, %v", limit, err)
+		}
+	}
+	if calls := len(node.CallsTo("getBlockNumber")); calls > 2 {
+		t.Errorf("getBlockNumber sent %d times for 5 block limits", calls)
+	}
+
+	// Adding a group polls it right away.
+	client.TrackHeads(3)
+	waitHead(t, tracker, 3, 30)
+
+	heads.set(1, 11)
+	waitHead(t, tracker, 1, 11)
+	seen := make(map[uint64]uint64)
+	for seen[1] != 11 {
+		ev := receiveHead(t, events)
+		if ev.Number < seen[ev.GroupId] {
+			t.Errorf("group %d went back from block %d to %d", ev.GroupId, seen[ev.GroupId], ev.Number)
+		}
+		seen[ev.GroupId] = ev.Number
+	}
+	if seen[2] != 20 || seen[3] != 30 {
+		t.Errorf("got heads %v, want group 2 at 20 and 3 at 30", seen)
+	}
+}
+
+// TestTrackHeadsPush checks that the heads of groups are taken from block
+// notifications over the channel protocol, and polled again after reconnecting.
+func TestTrackHeadsPush(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	heads := &groupHeads{numbers: map[uint64]uint64{1: 5}}
+	heads.serve(node)
+	client := node.ChannelClient()
+
+	tracker := client.TrackHeads(1)
+	events := make(chan ethclient.HeadEvent, 8)
+	sub := tracker.Subscribe(events)
+	defer sub.Unsubscribe()
+	waitHead(t, tracker, 1, 5)
+	if ev := receiveHead(t, events); ev != (ethclient.HeadEvent{GroupId: 1, Number: 5}) {
+		t.Errorf("got head event %+v, want block 5 of group 1", ev)
+	}
+
+	// Notifications are taken as they come, without polling.
+	node.Reset()
+	node.PushBlockNumber(1, 6)
+	waitHead(t, tracker, 1, 6)
+	if ev := receiveHead(t, events); ev.Number != 6 {
+		t.Errorf("got head event %+v, want block 6", ev)
+	}
+	if calls := len(node.CallsTo("getBlockNumber")); calls != 0 {
+		t.Errorf("getBlockNumber sent %d times for a notified block", calls)
+	}
+
+	// Blocks missed while the connection was down are caught up with.
+	heads.set(1, 9)
+	node.DropChannels()
+	client.BlockNumber(context.Background(), 1)
+	waitHead(t, tracker, 1, 9)
+}
+
+func TestTrackHeadsClose(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	heads := &groupHeads{numbers: map[uint64]uint64{1: 5}}
+	heads.serve(node)
+	client := node.Client()
+
+	tracker := client.TrackHeads(1)
+	sub := tracker.Subscribe(make(chan ethclient.HeadEvent))
+	waitHead(t, tracker, 1, 5)
+	client.Close()
+
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Errorf("subscription ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription didn't end with the client")
+	}
+	time.Sleep(100 * time.Millisecond)
+	node.Reset()
+	heads.set(1, 6)
+	time.Sleep(time.Second)
+	if calls := node.CallsTo("getBlockNumber"); len(calls) != 0 {
+		t.Errorf("closed tracker polled %d times", len(calls))
+	}
+}
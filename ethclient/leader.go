@@ -0,0 +1,179 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package ethclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+// SendResult describes where a transaction was sent, see
+// SendTransactionWithResult.
+type SendResult struct {
+	TxHash common.Hash
+	Node   string // URL of the pool node sent to, empty without DialPool
+	Leader bool   // whether Node was the consensus leader, see WithLeaderRouting
+}
+
+// sendReportKey is the context key of the *SendResult filled in by the pool.
+type sendReportKey struct{}
+
+// SendTransactionWithResult is SendTransaction, additionally reporting the node
+// of the pool the transaction was sent to. The result is returned along with a
+// failure too, naming the node which failed.
+func (ec *Client) SendTransactionWithResult(ctx context.Context, tx *types.Transaction) (*SendResult, error) {
+	report := &SendResult{TxHash: tx.Hash()}
+	err := ec.SendTransaction(context.WithValue(ctx, sendReportKey{}, report), tx)
+	return report, err
+}
+
+// poolLeader is the consensus leader of a group as last detected.
+type poolLeader struct {
+	node *poolNode // nil if unknown or not part of the pool
+	view int64
+}
+
+// leaderNode returns the node transactions of the group are routed to, or nil
+// if they should go to the pinned node. The first transaction of a group
+// starts the detection of its leader.
+func (p *pool) leaderNode(groupId uint64) *poolNode {
+	if !p.cfg.leaderRouting {
+		return nil
+	}
+	p.leaderMu.Lock()
+	leader, ok := p.leaders[groupId]
+	if !ok {
+		p.leaders[groupId] = new(poolLeader)
+	}
+	p.leaderMu.Unlock()
+	if !ok {
+		p.refreshLeaders()
+		return nil
+	}
+	if node := leader.node; node != nil && node.client() != nil && node.isHealthy() {
+		return node
+	}
+	return nil
+}
+
+// refreshLeaders makes the loop detect the leaders again.
+func (p *pool) refreshLeaders() {
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// detectLeaders finds the consensus leader of the probed group and of the
+// groups transactions were sent to. The leader is the sealer at the index of
+// the highest view reported by the healthy nodes, modulo the number of
+// sealers.
+func (p *pool) detectLeaders() {
+	if !p.cfg.leaderRouting {
+		return
+	}
+	p.leaderMu.Lock()
+	groups := []uint64{p.cfg.groupId}
+	for groupId := range p.leaders {
+		if groupId != p.cfg.groupId {
+			groups = append(groups, groupId)
+		}
+	}
+	p.leaderMu.Unlock()
+
+	var nodes []*poolNode
+	for _, node := range p.list() {
+		if node.client() != nil && node.isHealthy() {
+			nodes = append(nodes, node)
+		}
+	}
+	statuses := make([][]*types.ConsensusStatus, len(groups))
+	var wg sync.WaitGroup
+	for i, groupId := range groups {
+		statuses[i] = make([]*types.ConsensusStatus, len(nodes))
+		for j, node := range nodes {
+			wg.Add(1)
+			go func(i, j int, groupId uint64, node *poolNode) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+				defer cancel()
+
+				var status *types.ConsensusStatus
+				if err := node.client().CallContext(ctx, &status, "getConsensusStatus", groupId); err != nil {
+					log.Debug("Failed to get consensus status of pool node", "url", node.url, "group", groupId, "err", err)
+					return
+				}
+				if status != nil && status.NodeId != "" {
+					node.mu.Lock()
+					node.nodeId = status.NodeId
+					node.mu.Unlock()
+				}
+				statuses[i][j] = status
+			}(i, j, groupId, node)
+		}
+	}
+	wg.Wait()
+
+	for i, groupId := range groups {
+		leader := &poolLeader{view: -1}
+		var leaderId string
+		for _, status := range statuses[i] {
+			if status == nil || len(status.Sealers) == 0 || status.CurrentView <= leader.view {
+				continue
+			}
+			leader.view, leaderId = status.CurrentView, sealerAt(status.Sealers, status.CurrentView)
+		}
+		for _, node := range nodes {
+			node.mu.Lock()
+			isLeader := leaderId != "" && node.nodeId == leaderId
+			node.mu.Unlock()
+			if isLeader {
+				leader.node = node
+				break
+			}
+		}
+
+		p.leaderMu.Lock()
+		prev := p.leaders[groupId]
+		p.leaders[groupId] = leader
+		p.leaderMu.Unlock()
+		if prev == nil || prev.node != leader.node {
+			switch {
+			case leader.node != nil:
+				log.Info("Routing transactions to consensus leader", "group", groupId, "view", leader.view, "url", leader.node.url)
+			case leaderId != "":
+				log.Debug("Consensus leader not in pool", "group", groupId, "view", leader.view, "nodeId", leaderId)
+			default:
+				log.Debug("Consensus leader unknown", "group", groupId)
+			}
+		}
+	}
+}
+
+// sealerAt returns the ID of the sealer leading the view.
+func sealerAt(sealers []types.ConsensusNode, view int64) string {
+	idx := int(view % int64(len(sealers)))
+	for _, sealer := range sealers {
+		if sealer.Index == idx {
+			return sealer.NodeId
+		}
+	}
+	return sealers[idx].NodeId
+}
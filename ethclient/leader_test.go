@@ -0,0 +1,147 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// consensusViews answers getConsensusStatus for a node with the views set per
+// group, the sealers being a, b, c and d.
+type consensusViews struct {
+	mu    sync.Mutex
+	views map[uint64]int64
+}
+
+var sealerIds = []string{strings.Repeat("a", 128), strings.Repeat("b", 128), strings.Repeat("c", 128), strings.Repeat("d", 128)}
+
+func (v *consensusViews) serve(node *ethclienttest.FakeNode, nodeId string) {
+	node.Handle("getConsensusStatus", func(params []json.RawMessage) (interface{}, error) {
+		var group uint64
+		if err := json.Unmarshal(params[0], &group); err != nil {
+			return nil, err
+		}
+		v.mu.Lock()
+		view := v.views[group]
+		v.mu.Unlock()
+		status := fmt.Sprintf(`[{"nodeId":%q,"currentView":%d,"nodeNum":%d`, nodeId, view, len(sealerIds))
+		for i, id := range sealerIds {
+			status += fmt.Sprintf(`,"sealer.%d":%q`, i, id)
+		}
+		return json.RawMessage(status + `},[]]`), nil
+	})
+}
+
+func (v *consensusViews) set(group uint64, view int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.views[group] = view
+}
+
+func TestDialPoolLeaderRouting(t *testing.T) {
+	var (
+		nodes = make([]*ethclienttest.FakeNode, 3) // sealers a, b and c
+		views = make([]*consensusViews, 3)
+		urls  = make([]string, 3)
+	)
+	for i := range nodes {
+		nodes[i] = ethclienttest.NewFakeNode(t)
+		defer nodes[i].Close()
+		nodes[i].Respond("getBlockNumber", "0x10")
+		nodes[i].Respond("sendRawTransaction", common.Hash{}.Hex())
+		views[i] = &consensusViews{views: map[uint64]int64{1: 5, 2: 6}}
+		views[i].serve(nodes[i], sealerIds[i])
+		urls[i] = nodes[i].URL()
+	}
+	setViews := func(group uint64, view int64) {
+		for _, v := range views {
+			v.set(group, view)
+		}
+	}
+
+	// Without leader routing transactions go to the pinned node.
+	client, err := ethclient.DialPool(urls, ethclient.WithProbeInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("DialPool error: %v", err)
+	}
+	res, err := client.SendTransactionWithResult(context.Background(), newGroupTx(1))
+	if err != nil || res.Node != urls[0] || res.Leader || res.TxHash != newGroupTx(1).Hash() {
+		t.Errorf("without leader routing: got %+v, %v; want node 0", res, err)
+	}
+	client.Close()
+
+	client, err = ethclient.DialPool(urls, ethclient.WithLeaderRouting(), ethclient.WithProbeInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("DialPool error: %v", err)
+	}
+	defer client.Close()
+
+	// routed waits until transactions of the group are sent to the node.
+	routed := func(what string, group uint64, node int, leader bool) {
+		t.Helper()
+		var res *ethclient.SendResult
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			var err error
+			if res, err = client.SendTransactionWithResult(context.Background(), newGroupTx(int64(group))); err != nil {
+				continue
+			}
+			if res.Node == urls[node] && res.Leader == leader {
+				return
+			}
+		}
+		t.Fatalf("%s: group %d sent to %+v, want node %d, leader %v", what, group, res, node, leader)
+	}
+	routed("view 5", 1, 1, true)      // sealer 5 % 4 = 1, b
+	routed("view 6", 2, 2, true)      // c
+	views[0].set(1, 8)                // the highest view of the nodes counts
+	routed("view 8 on a", 1, 0, true) // a
+	setViews(1, 7)                    // d isn't in the pool
+	routed("leader outside", 1, 0, false)
+	setViews(1, 9)
+	routed("view 9", 1, 1, true)
+
+	// The pinned node takes over from an unreachable leader.
+	nodes[1].Close()
+	routed("leader down", 1, 0, false)
+	routed("group 2 unaffected", 2, 2, true)
+}
+
+func TestSendTransactionWithResult(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondError("sendRawTransaction", 0x1c, "TxPoolIsFull")
+	client := node.Client()
+
+	tx := newGroupTx(1)
+	res, err := client.SendTransactionWithResult(context.Background(), tx)
+	if err == nil {
+		t.Error("rejected transaction sent")
+	}
+	if res == nil || res.TxHash != tx.Hash() || res.Node != "" || res.Leader {
+		t.Errorf("got result %+v, want the hash only", res)
+	}
+}
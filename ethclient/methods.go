@@ -0,0 +1,75 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+// methodVersions maps the JSON-RPC methods added after the first 2.x release to
+// the first node version serving them. Methods not listed are served by all
+// 2.x nodes.
+var methodVersions = map[string][3]int{
+	"generateGroup":                         {2, 2, 0},
+	"startGroup":                            {2, 2, 0},
+	"stopGroup":                             {2, 2, 0},
+	"removeGroup":                           {2, 2, 0},
+	"recoverGroup":                          {2, 2, 0},
+	"queryGroupStatus":                      {2, 2, 0},
+	"getTransactionByHashWithProof":         {2, 2, 0},
+	"getTransactionReceiptByHashWithProof":  {2, 2, 0},
+	"getBlockHeaderByHash":                  {2, 6, 0},
+	"getBlockHeaderByNumber":                {2, 6, 0},
+	"getBatchReceiptsByBlockNumberAndRange": {2, 7, 0},
+	"getBatchReceiptsByBlockHashAndRange":   {2, 7, 0},
+}
+
+// SupportsMethod reports whether the node serves the given JSON-RPC method,
+// judged by the version the node reports, which is only requested once per
+// client. Methods the client knows no minimum version of are assumed to be
+// supported, and so are all methods on custom builds whose version can't be
+// parsed, which is logged once.
+func (ec *Client) SupportsMethod(ctx context.Context, method string) (bool, error) {
+	version, err := ec.nodeVersion(ctx)
+	if err != nil {
+		return false, err
+	}
+	want, ok := methodVersions[method]
+	if !ok {
+		return true, nil
+	}
+	major, minor, patch, err := version.SupportedSemver()
+	if err != nil {
+		ec.versionMu.Lock()
+		warned := ec.versionWarned
+		ec.versionWarned = true
+		ec.versionMu.Unlock()
+		if !warned {
+			log.Warn("Unknown node version, assuming all methods are supported", "err", err)
+		}
+		return true, nil
+	}
+	have := [3]int{major, minor, patch}
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i], nil
+		}
+	}
+	return true, nil
+}
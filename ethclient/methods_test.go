@@ -0,0 +1,76 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+func TestSupportsMethod(t *testing.T) {
+	tests := []struct {
+		version   string
+		supported string
+		method    string
+		want      bool
+	}{
+		{"2.7.2", "2.7.2", "getBatchReceiptsByBlockNumberAndRange", true},
+		{"2.7.0", "2.7.0", "getBatchReceiptsByBlockHashAndRange", true},
+		{"2.7.2", "2.6.0", "getBatchReceiptsByBlockNumberAndRange", false},
+		{"2.6.0", "", "getBlockHeaderByNumber", true},
+		{"2.5.0 gm", "", "getBlockHeaderByHash", false},
+		{"2.2.0", "2.2.0", "generateGroup", true},
+		{"2.1.0", "2.1.0", "queryGroupStatus", false},
+		{"3.0.0", "3.0.0", "getBatchReceiptsByBlockNumberAndRange", true},
+		{"2.0.0", "2.0.0", "getBlockByNumber", true},
+		{"2.0.0", "2.0.0", "getFooInfo", true},
+		// Custom builds are assumed to serve everything.
+		{"custom", "", "getBatchReceiptsByBlockNumberAndRange", true},
+		{"2.7.0", "dev", "generateGroup", true},
+	}
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		node.Respond("getClientVersion", &types.ClientVersion{Version: test.version, SupportedVersion: test.supported})
+		client := node.Client()
+		for i := 0; i < 2; i++ {
+			ok, err := client.SupportsMethod(context.Background(), test.method)
+			if err != nil || ok != test.want {
+				t.Errorf("%s/%s: %s supported: %v, %v, want %v", test.version, test.supported, test.method, ok, err, test.want)
+			}
+		}
+		if n := len(node.CallsTo("getClientVersion")); n != 1 {
+			t.Errorf("%s/%s: requested the version %d times, want once", test.version, test.supported, n)
+		}
+		node.Close()
+	}
+
+	// Failing to get the version is reported, and retried next time.
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondError("getClientVersion", -32603, "internal error")
+	client := node.Client()
+	if ok, err := client.SupportsMethod(context.Background(), "generateGroup"); err == nil || ok {
+		t.Errorf("failing node: got %v, %v", ok, err)
+	}
+	node.Respond("getClientVersion", &types.ClientVersion{Version: "2.1.0", SupportedVersion: "2.1.0"})
+	if ok, err := client.SupportsMethod(context.Background(), "generateGroup"); err != nil || ok {
+		t.Errorf("recovered node: got %v, %v, want false", ok, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestGettersNotFound checks that every getter reports a null, empty string or
+// empty object result as fiscobcos.NotFound, rather than a nil result with a
+// nil error.
+func TestGettersNotFound(t *testing.T) {
+	hash := common.HexToHash("0x01")
+	getters := []struct {
+		method string
+		call   func(*ethclient.Client) error
+	}{
+		{"getClientVersion", func(c *ethclient.Client) error { _, err := c.ClientVersion(context.Background()); return err }},
+		{"getBlockByHash", func(c *ethclient.Client) error { _, err := c.BlockByHash(context.Background(), 1, hash); return err }},
+		{"getBlockByNumber", func(c *ethclient.Client) error {
+			_, err := c.BlockByNumber(context.Background(), 1, big.NewInt(1))
+			return err
+		}},
+		{"getBlockByNumber", func(c *ethclient.Client) error {
+			_, err := c.HeaderByNumber(context.Background(), 1, big.NewInt(1))
+			return err
+		}},
+		{"getBlockNumber", func(c *ethclient.Client) error { _, err := c.BlockNumber(context.Background(), 1); return err }},
+		{"getSyncStatus", func(c *ethclient.Client) error { _, err := c.SyncStatus(context.Background(), 1); return err }},
+		{"getTotalTransactionCount", func(c *ethclient.Client) error {
+			_, err := c.TotalTransactionCount(context.Background(), 1)
+			return err
+		}},
+		{"getTransactionReceipt", func(c *ethclient.Client) error {
+			_, err := c.TransactionReceipt(context.Background(), 1, hash)
+			return err
+		}},
+		{"getTransactionByBlockNumberAndIndex", func(c *ethclient.Client) error {
+			_, err := c.TransactionByBlockNumberAndIndex(context.Background(), 1, big.NewInt(1), 0)
+			return err
+		}},
+		{"getTransactionByBlockHashAndIndex", func(c *ethclient.Client) error {
+			_, err := c.TransactionByBlockHashAndIndex(context.Background(), 1, hash, 0)
+			return err
+		}},
+		{"getTransactionByHash", func(c *ethclient.Client) error {
+			_, err := c.TransactionByHash(context.Background(), 1, hash)
+			return err
+		}},
+		{"getPbftView", func(c *ethclient.Client) error { _, err := c.PbftView(context.Background(), 1); return err }},
+		{"getBlockHashByNumber", func(c *ethclient.Client) error {
+			_, err := c.BlockHashByNumber(context.Background(), 1, 1)
+			return err
+		}},
+		{"getCode", func(c *ethclient.Client) error {
+			_, err := c.Code(context.Background(), 1, hash.Hex()[:42])
+			return err
+		}},
+		{"getSystemConfigByKey", func(c *ethclient.Client) error {
+			_, err := c.SystemConfigByKey(context.Background(), 1, "tx_count_limit")
+			return err
+		}},
+		{"getSealerList", func(c *ethclient.Client) error { _, err := c.SealerList(context.Background(), 1); return err }},
+		{"getObserverList", func(c *ethclient.Client) error { _, err := c.ObserverList(context.Background(), 1); return err }},
+		{"getConsensusStatus", func(c *ethclient.Client) error { _, err := c.ConsensusStatus(context.Background(), 1); return err }},
+		{"getPeers", func(c *ethclient.Client) error { _, err := c.Peers(context.Background(), 1); return err }},
+		{"getGroupPeers", func(c *ethclient.Client) error { _, err := c.GroupPeers(context.Background(), 1); return err }},
+		{"getNodeIDList", func(c *ethclient.Client) error { _, err := c.NodeIDList(context.Background(), 1); return err }},
+		{"getGroupList", func(c *ethclient.Client) error { _, err := c.GroupList(context.Background()); return err }},
+		{"getPendingTransactions", func(c *ethclient.Client) error {
+			_, err := c.PendingTransactions(context.Background(), 1)
+			return err
+		}},
+		{"getFooInfo", func(c *ethclient.Client) error {
+			var info struct{ Count uint64 }
+			return c.CallRaw(context.Background(), &info, "getFooInfo", 1)
+		}},
+	}
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	for _, raw := range []string{`null`, `""`, `{}`} {
+		for _, getter := range getters {
+			node.RespondRaw(getter.method, raw)
+			err := getter.call(client)
+			if err != fiscobcos.NotFound {
+				t.Errorf("%s answered with %s: got error %v, want NotFound", getter.method, raw, err)
+			}
+		}
+	}
+}
+
+// TestListGettersEmpty checks that the list getters return an empty list, not
+// NotFound, for an empty array: a group without observers is a normal state.
+func TestListGettersEmpty(t *testing.T) {
+	getters := []struct {
+		method string
+		call   func(*ethclient.Client) (int, error)
+	}{
+		{"getSealerList", func(c *ethclient.Client) (int, error) {
+			list, err := c.SealerList(context.Background(), 1)
+			return len(list), err
+		}},
+		{"getObserverList", func(c *ethclient.Client) (int, error) {
+			list, err := c.ObserverList(context.Background(), 1)
+			return len(list), err
+		}},
+		{"getPeers", func(c *ethclient.Client) (int, error) {
+			list, err := c.Peers(context.Background(), 1)
+			return len(list), err
+		}},
+		{"getGroupPeers", func(c *ethclient.Client) (int, error) {
+			list, err := c.GroupPeers(context.Background(), 1)
+			return len(list), err
+		}},
+		{"getNodeIDList", func(c *ethclient.Client) (int, error) {
+			list, err := c.NodeIDList(context.Background(), 1)
+			return len(list), err
+		}},
+		{"getGroupList", func(c *ethclient.Client) (int, error) {
+			list, err := c.GroupList(context.Background())
+			return len(list), err
+		}},
+	}
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	for _, getter := range getters {
+		node.RespondRaw(getter.method, `[]`)
+		n, err := getter.call(client)
+		if err != nil || n != 0 {
+			t.Errorf("%s answered with []: got %d items, error %v, want none", getter.method, n, err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// defaultRequestTimeout bounds the requests of clients whose context carries no
+// deadline, unless changed by WithRequestTimeout or SetRequestTimeout.
+const defaultRequestTimeout = 30 * time.Second
+
+// ClientOption configures the client created by DialWithOptions or DialContext,
+// or the clients of a pool, see WithClientOptions.
+type ClientOption func(*dialConfig)
+
+type dialConfig struct {
+	httpClient     *http.Client
+	header         http.Header
+	tlsConfig      *tls.Config
+	dialTimeout    time.Duration
+	requestTimeout time.Duration
+	retry          RetryPolicy
+	metrics        rpc.Metrics
+	logger         log.Logger
+	cacheSize      int
+	verify         bool
+	skipValidation bool
+	rawResponses   bool
+
+	channel                 bool
+	caCert, sdkCert, sdkKey string
+	channelOpts             []rpc.ChannelOption
+}
+
+// WithHTTPClient sets the HTTP client used for "http" and "https" URLs, e.g. to
+// configure a proxy or connection limits.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(cfg *dialConfig) { cfg.httpClient = client }
+}
+
+// WithHeader adds a header to the HTTP requests and the websocket handshake.
+func WithHeader(key, value string) ClientOption {
+	return func(cfg *dialConfig) {
+		if cfg.header == nil {
+			cfg.header = make(http.Header)
+		}
+		cfg.header.Add(key, value)
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of "https" and "wss" URLs. It can't be
+// combined with an HTTP client bringing its own transport.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(cfg *dialConfig) { cfg.tlsConfig = config }
+}
+
+// WithDialTimeout bounds the connection establishment of DialContext if its
+// context doesn't carry a deadline already. Without it the transport's default
+// of 10 seconds applies; plain HTTP doesn't connect while dialing.
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *dialConfig) { cfg.dialTimeout = timeout }
+}
+
+// WithRequestTimeout bounds every request of the client whose context doesn't
+// carry a deadline already. The default is 30 seconds, 0 lets such requests
+// wait indefinitely.
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *dialConfig) { cfg.requestTimeout = timeout }
+}
+
+// WithMetrics sets the receiver of the measurements of the client's requests,
+// see rpc.Metrics and the rpc/rpcmetrics package.
+func WithMetrics(m rpc.Metrics) ClientOption {
+	return func(cfg *dialConfig) { cfg.metrics = m }
+}
+
+// WithLogger sets the wire logger of the client, which logs every request and
+// channel frame at debug level. Private keys and certificates are redacted and
+// long hex values truncated, see rpc.Client.SetLogger.
+func WithLogger(l log.Logger) ClientOption {
+	return func(cfg *dialConfig) { cfg.logger = l }
+}
+
+// WithCache enables the cache of immutable chain data holding up to size
+// responses, see SetCacheSize.
+func WithCache(size int) ClientOption {
+	return func(cfg *dialConfig) { cfg.cacheSize = size }
+}
+
+// WithVerification enables the check of the transactions root of the blocks
+// returned by BlockByNumber and BlockByHash against their transactions. Blocks
+// which don't match fail with an error matching ErrRootMismatch, nodes older
+// than 2.2.0 with ErrVerificationUnsupported.
+func WithVerification(enabled bool) ClientOption {
+	return func(cfg *dialConfig) { cfg.verify = enabled }
+}
+
+// WithoutValidation disables the check of request arguments, such as the length
+// of hashes and addresses and the range of group IDs, for nodes accepting other
+// formats. Malformed arguments are then reported by the node.
+func WithoutValidation() ClientOption {
+	return func(cfg *dialConfig) { cfg.skipValidation = true }
+}
+
+// WithRawResponses makes the client keep the responses the blocks, receipts,
+// transactions and sync statuses it returns were decoded from, in their Raw
+// field, for the fields of newer nodes the types don't cover yet. It is off by
+// default, as it doubles the memory those values take.
+func WithRawResponses(enabled bool) ClientOption {
+	return func(cfg *dialConfig) { cfg.rawResponses = enabled }
+}
+
+// WithChannelCerts selects the channel transport, authenticating with the SDK
+// certificate and key issued by the chain's CA, see rpc.DialChannel. The URL is
+// then the node's channel endpoint ("host:port" or "channel://host:port").
+func WithChannelCerts(caCert, sdkCert, sdkKey string) ClientOption {
+	return func(cfg *dialConfig) {
+		cfg.channel = true
+		cfg.caCert, cfg.sdkCert, cfg.sdkKey = caCert, sdkCert, sdkKey
+	}
+}
+
+// WithChannelOptions sets options of the channel transport selected by
+// WithChannelCerts, such as the GM-TLS handshake of guomi chains set by
+// rpc.WithHandshaker.
+func WithChannelOptions(opts ...rpc.ChannelOption) ClientOption {
+	return func(cfg *dialConfig) { cfg.channelOpts = append(cfg.channelOpts, opts...) }
+}
+
+// DialWithOptions connects a client to the given URL, configured by the options.
+func DialWithOptions(rawurl string, opts ...ClientOption) (*Client, error) {
+	return DialContext(context.Background(), rawurl, opts...)
+}
+
+// newDialConfig returns the configuration set by the options.
+func newDialConfig(opts []ClientOption) *dialConfig {
+	cfg := &dialConfig{requestTimeout: defaultRequestTimeout}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// dialRPC connects an RPC client to the URL with the transport options, within
+// the dial timeout if ctx has no deadline.
+func (cfg *dialConfig) dialRPC(ctx context.Context, rawurl string) (*rpc.Client, error) {
+	if _, ok := ctx.Deadline(); !ok && cfg.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.dialTimeout)
+		defer cancel()
+	}
+	c, err := dial(ctx, rawurl, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.metrics != nil {
+		c.SetMetrics(cfg.metrics)
+	}
+	if cfg.logger != nil {
+		c.SetLogger(cfg.logger)
+	}
+	return c, nil
+}
+
+// configure applies the options of the client itself.
+func (cfg *dialConfig) configure(ec *Client) {
+	ec.SetRequestTimeout(cfg.requestTimeout)
+	ec.retry = cfg.retry
+	if cfg.cacheSize > 0 {
+		ec.SetCacheSize(cfg.cacheSize)
+	}
+	ec.SetVerification(cfg.verify)
+	ec.SetValidation(!cfg.skipValidation)
+	ec.rawResponses = cfg.rawResponses
+}
+
+// dial connects the RPC client for DialContext.
+func dial(ctx context.Context, rawurl string, cfg *dialConfig) (*rpc.Client, error) {
+	u, err := rpc.ParseEndpoint(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.channel && (u.Scheme == "" || u.Scheme == "channel"):
+		return rpc.DialChannelContext(ctx, u.Host, cfg.caCert, cfg.sdkCert, cfg.sdkKey, cfg.channelOpts...)
+	case cfg.channel:
+		return nil, fmt.Errorf("WithChannelCerts can't be combined with URL scheme %q", u.Scheme)
+	case u.Scheme == "channel":
+		return nil, fmt.Errorf("channel endpoint %q needs WithChannelCerts", rawurl)
+	case u.Scheme == "" && u.Host != "":
+		// Without certificates, host:port is the node's RPC port.
+		u.Scheme = "http"
+		rawurl = u.String()
+	}
+	switch u.Scheme {
+	case "http", "https":
+		client, err := cfg.newHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		return rpc.DialHTTPWithClient(rawurl, client)
+	case "ws", "wss":
+		return rpc.DialWebsocketWithConfig(ctx, rawurl, "", cfg.header, cfg.tlsConfig)
+	}
+	if cfg.httpClient != nil || cfg.header != nil || cfg.tlsConfig != nil {
+		return nil, fmt.Errorf("transport options don't apply to URL scheme %q", u.Scheme)
+	}
+	return rpc.DialContext(ctx, rawurl)
+}
+
+// newHTTPClient returns the HTTP client carrying the options, leaving the one
+// given by WithHTTPClient untouched.
+func (cfg *dialConfig) newHTTPClient() (*http.Client, error) {
+	client := new(http.Client)
+	if cfg.httpClient != nil {
+		*client = *cfg.httpClient
+	}
+	if cfg.tlsConfig != nil {
+		if client.Transport != nil {
+			return nil, errors.New("WithTLSConfig can't be combined with the transport of WithHTTPClient")
+		}
+		client.Transport = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     cfg.tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		}
+	}
+	if cfg.header != nil {
+		client.Transport = &headerTransport{base: client.Transport, header: cfg.header}
+	}
+	return client, nil
+}
+
+// headerTransport adds headers to the requests of an HTTP client.
+type headerTransport struct {
+	base   http.RoundTripper // http.DefaultTransport if nil
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the request.
+	req = req.WithContext(req.Context())
+	req.Header = cloneHeader(req.Header)
+	for key, values := range t.header {
+		req.Header[key] = append(req.Header[key], values...)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// SetRequestTimeout changes the bound of requests whose context doesn't carry a
+// deadline, see WithRequestTimeout. A timeout of 0 lets them wait indefinitely.
+func (ec *Client) SetRequestTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&ec.requestTimeout, int64(timeout))
+}
+
+// withRequestTimeout applies the request timeout of the client to ctx.
+func (ec *Client) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(atomic.LoadInt64(&ec.requestTimeout))
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,348 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// countingHandshaker secures channel connections with crypto/tls, counting the
+// handshakes.
+type countingHandshaker struct {
+	config *tls.Config
+	count  int32
+}
+
+func (h *countingHandshaker) ClientHandshake(ctx context.Context, conn net.Conn, certs *rpc.ChannelCerts) (net.Conn, error) {
+	atomic.AddInt32(&h.count, 1)
+	tconn := tls.Client(conn, h.config)
+	return tconn, tconn.Handshake()
+}
+
+func TestWithChannelOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "options-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	caCert, sdkCert, sdkKey := node.ChannelCertFiles(dir)
+
+	h := &countingHandshaker{config: node.ChannelTLSConfig()}
+	client, err := ethclient.DialWithOptions(node.ChannelAddr(),
+		ethclient.WithChannelCerts(caCert, sdkCert, sdkKey),
+		ethclient.WithChannelOptions(rpc.WithHandshaker(h)),
+	)
+	if err != nil {
+		t.Fatalf("DialWithOptions error: %v", err)
+	}
+	defer client.Close()
+	if n, err := client.BlockNumber(context.Background(), 1); err != nil || n.Int64() != 0x10 {
+		t.Fatalf("BlockNumber: got %v, error %v", n, err)
+	}
+	if n := atomic.LoadInt32(&h.count); n != 1 {
+		t.Errorf("handshaker ran %d times, want once", n)
+	}
+}
+
+// headerRecorder answers every JSON-RPC call with "0x10", recording the headers
+// of the last request.
+type headerRecorder struct {
+	mu     sync.Mutex
+	header http.Header
+}
+
+func (r *headerRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var msg struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.header = req.Header
+	r.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": "0x10"})
+}
+
+func (r *headerRecorder) lastHeader() http.Header {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.header
+}
+
+// countingTransport counts the requests it passes to http.DefaultTransport.
+type countingTransport struct{ count int32 }
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDialWithOptionsHTTP(t *testing.T) {
+	recorder := new(headerRecorder)
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	transport := new(countingTransport)
+	httpClient := &http.Client{Transport: transport}
+	tests := []struct {
+		name       string
+		url        string
+		opts       []ethclient.ClientOption
+		header     http.Header // of the options, X-Api-Key and X-Trace only
+		usesClient bool        // whether the requests go through httpClient
+	}{
+		{name: "url", url: server.URL},
+		{name: "host:port", url: server.Listener.Addr().String()},
+		{
+			name: "headers",
+			url:  server.URL,
+			opts: []ethclient.ClientOption{
+				ethclient.WithHeader("X-Api-Key", "k1"),
+				ethclient.WithHeader("X-Api-Key", "k2"),
+				ethclient.WithHeader("X-Trace", "t1"),
+			},
+			header: http.Header{"X-Api-Key": {"k1", "k2"}, "X-Trace": {"t1"}},
+		},
+		{
+			name:       "http client",
+			url:        server.URL,
+			opts:       []ethclient.ClientOption{ethclient.WithHTTPClient(httpClient)},
+			usesClient: true,
+		},
+		{
+			name: "http client and headers",
+			url:  server.URL,
+			opts: []ethclient.ClientOption{
+				ethclient.WithHTTPClient(httpClient),
+				ethclient.WithHeader("X-Api-Key", "k1"),
+			},
+			header:     http.Header{"X-Api-Key": {"k1"}},
+			usesClient: true,
+		},
+	}
+	for _, test := range tests {
+		before := atomic.LoadInt32(&transport.count)
+		client, err := ethclient.DialContext(context.Background(), test.url, test.opts...)
+		if err != nil {
+			t.Fatalf("%s: DialContext error: %v", test.name, err)
+		}
+		n, err := client.BlockNumber(context.Background(), 1)
+		client.Close()
+		if err != nil || n.Int64() != 0x10 {
+			t.Fatalf("%s: BlockNumber: got %v, error %v", test.name, n, err)
+		}
+
+		header := recorder.lastHeader()
+		for _, key := range []string{"X-Api-Key", "X-Trace"} {
+			if !reflect.DeepEqual(header[key], test.header[key]) {
+				t.Errorf("%s: header %s is %q, want %q", test.name, key, header[key], test.header[key])
+			}
+		}
+		if ct := header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type %q, want application/json", test.name, ct)
+		}
+		if used := atomic.LoadInt32(&transport.count) > before; used != test.usesClient {
+			t.Errorf("%s: HTTP client used: %t, want %t", test.name, used, test.usesClient)
+		}
+	}
+	if httpClient.Transport != transport {
+		t.Error("WithHTTPClient modified the client")
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	server := httptest.NewUnstartedServer(new(headerRecorder))
+	// The rejected handshake is expected.
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	if client, err := ethclient.DialWithOptions(server.URL); err == nil {
+		_, err = client.BlockNumber(context.Background(), 1)
+		client.Close()
+		if err == nil {
+			t.Error("connected to a server of an untrusted CA")
+		}
+	}
+	client, err := ethclient.DialWithOptions(server.URL, ethclient.WithTLSConfig(&tls.Config{RootCAs: pool}))
+	if err != nil {
+		t.Fatalf("DialWithOptions error: %v", err)
+	}
+	defer client.Close()
+	if n, err := client.BlockNumber(context.Background(), 1); err != nil || n.Int64() != 0x10 {
+		t.Errorf("BlockNumber: got %v, error %v", n, err)
+	}
+}
+
+func TestDialWithOptionsInvalid(t *testing.T) {
+	tlsConfig := new(tls.Config)
+	tests := []struct {
+		name string
+		url  string
+		opts []ethclient.ClientOption
+		want string // part of the error
+	}{
+		{"channel without certs", "channel://127.0.0.1:20200", nil, "needs WithChannelCerts"},
+		{"certs with http", "http://127.0.0.1:8545", []ethclient.ClientOption{ethclient.WithChannelCerts("ca.crt", "sdk.crt", "sdk.key")}, "can't be combined with URL scheme"},
+		{"header with stdio", "stdio://", []ethclient.ClientOption{ethclient.WithHeader("X-Api-Key", "k1")}, "don't apply to URL scheme"},
+		{
+			"tls config with transport",
+			"https://127.0.0.1:8545",
+			[]ethclient.ClientOption{ethclient.WithHTTPClient(&http.Client{Transport: new(countingTransport)}), ethclient.WithTLSConfig(tlsConfig)},
+			"WithTLSConfig can't be combined",
+		},
+	}
+	for _, test := range tests {
+		client, err := ethclient.DialWithOptions(test.url, test.opts...)
+		if err == nil {
+			client.Close()
+			t.Errorf("%s: no error", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// newBlackHole starts an HTTP server which accepts requests but never answers
+// them, until release is called. Release before closing the server, Close waits
+// for the requests.
+func newBlackHole() (server *httptest.Server, release func()) {
+	done := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	var once sync.Once
+	return server, func() { once.Do(func() { close(done) }) }
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server, release := newBlackHole()
+	defer server.Close()
+	defer release()
+	client, err := ethclient.DialWithOptions(server.URL, ethclient.WithRequestTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("DialWithOptions error: %v", err)
+	}
+	defer client.Close()
+
+	calls := map[string]func(ctx context.Context) error{
+		"BlockNumber": func(ctx context.Context) error {
+			_, err := client.BlockNumber(ctx, 1)
+			return err
+		},
+		"BlockByNumber": func(ctx context.Context) error {
+			_, err := client.BlockByNumber(ctx, 1, nil)
+			return err
+		},
+		"TransactionReceipt": func(ctx context.Context) error {
+			_, err := client.TransactionReceipt(ctx, 1, common.Hash{1})
+			return err
+		},
+		"PbftView": func(ctx context.Context) error {
+			_, err := client.PbftView(ctx, 1)
+			return err
+		},
+	}
+	for name, call := range calls {
+		start := time.Now()
+		if err := call(context.Background()); err != context.DeadlineExceeded {
+			t.Errorf("%s: got error %v, want context.DeadlineExceeded", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: gave up after %v", name, elapsed)
+		}
+	}
+
+	// The deadline of the caller takes precedence.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := calls["BlockNumber"](ctx); err != context.DeadlineExceeded {
+		t.Errorf("call with deadline: got error %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("call with deadline gave up after %v, before its deadline", elapsed)
+	}
+
+	// Without default, only the caller's deadline bounds the call.
+	client.SetRequestTimeout(0)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := calls["BlockNumber"](ctx); err != context.DeadlineExceeded {
+		t.Errorf("call without default timeout: got error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	server, release := newBlackHole()
+	defer server.Close()
+	defer release()
+	url := "ws://" + server.Listener.Addr().String()
+
+	start := time.Now()
+	client, err := ethclient.DialContext(context.Background(), url, ethclient.WithDialTimeout(100*time.Millisecond))
+	if err == nil {
+		client.Close()
+		t.Fatal("websocket handshake with a black hole succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial gave up after %v", elapsed)
+	}
+
+	// The deadline of the context takes precedence.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if client, err = ethclient.DialContext(ctx, url, ethclient.WithDialTimeout(time.Hour)); err == nil {
+		client.Close()
+		t.Fatal("websocket handshake with a black hole succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial with deadline gave up after %v", elapsed)
+	}
+}
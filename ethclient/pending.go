@@ -0,0 +1,105 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// PendingTransactionsPaged returns up to limit transactions of the transaction
+// pool, skipping the first offset ones. A limit of zero or less returns all
+// transactions from offset on.
+//
+// Nodes don't paginate getPendingTransactions, so the page is cut out of the
+// full pool while it is decoded, without decoding the other transactions. The
+// size of the pool is checked with PendingTxSize first and nothing is fetched
+// if it holds no transactions at offset, so polling an idle pool stays cheap.
+// As the pool changes between requests, consecutive pages may skip or repeat
+// transactions.
+func (ec *Client) PendingTransactionsPaged(ctx context.Context, groupId uint64, offset, limit int) ([]types.PendingTx, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("negative pending transaction offset %d", offset)
+	}
+	groupId = ec.group(ctx, groupId)
+
+	size, err := ec.PendingTxSize(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(offset) >= size {
+		return []types.PendingTx{}, nil
+	}
+	return ec.getPendingTransactions(ctx, offset, limit, "getPendingTransactions", groupId)
+}
+
+// getPendingTransactions retrieves the transaction pool, decoding the limit
+// transactions from offset on, all of them if limit is zero or less.
+func (ec *Client) getPendingTransactions(ctx context.Context, offset, limit int, method string, args ...interface{}) ([]types.PendingTx, error) {
+	var raw json.RawMessage
+	if err := ec.callResult(ctx, &raw, method, args...); err != nil {
+		return nil, err
+	}
+	return decodePendingTxs(raw, offset, limit)
+}
+
+// decodePendingTxs decodes the transactions of a pool listing one by one,
+// skipping the first offset ones and stopping after limit, if positive, so that
+// only the requested ones are ever held decoded.
+func decodePendingTxs(raw json.RawMessage, offset, limit int) ([]types.PendingTx, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("pending transactions are not a list")
+	}
+	var txs []types.PendingTx
+	if limit > 0 {
+		txs = make([]types.PendingTx, 0, limit)
+	}
+	for i := 0; dec.More(); i++ {
+		if limit > 0 && len(txs) == limit {
+			break
+		}
+		if i < offset {
+			var skip struct{}
+			if err := dec.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("pending transaction %d: %v", i, err)
+			}
+			continue
+		}
+		var tx types.PendingTx
+		if err := dec.Decode(&tx); err != nil {
+			return nil, fmt.Errorf("pending transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	if txs == nil {
+		txs = []types.PendingTx{}
+	}
+	return txs, nil
+}
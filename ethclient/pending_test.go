@@ -0,0 +1,113 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestPendingTransactionsPaged checks the pages cut out of the transaction
+// pool, and that the pool is only listed if the page isn't empty.
+func TestPendingTransactionsPaged(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	const pool = 10
+	txs := make([]map[string]interface{}, pool)
+	for i := range txs {
+		txs[i] = map[string]interface{}{
+			"from":  common.Address{1},
+			"hash":  common.BigToHash(big.NewInt(int64(i))),
+			"nonce": hexutil.EncodeUint64(uint64(i)),
+			"to":    common.Address{2},
+		}
+	}
+	node.Respond("getPendingTransactions", txs)
+
+	tests := []struct {
+		size          int // reported by getPendingTxSize
+		offset, limit int
+		first, count  int // of the page
+		fetched       bool
+		err           bool
+	}{
+		{size: pool, offset: 0, limit: 0, first: 0, count: pool, fetched: true},
+		{size: pool, offset: 0, limit: 3, first: 0, count: 3, fetched: true},
+		{size: pool, offset: 3, limit: 3, first: 3, count: 3, fetched: true},
+		{size: pool, offset: 8, limit: 5, first: 8, count: 2, fetched: true},
+		{size: pool, offset: 4, limit: -1, first: 4, count: 6, fetched: true},
+		{size: pool, offset: 10, limit: 5, count: 0},
+		{size: 0, offset: 0, limit: 5, count: 0},
+		// The pool grew or shrank since its size was reported.
+		{size: 12, offset: 11, limit: 5, count: 0, fetched: true},
+		{size: 8, offset: 6, limit: 0, first: 6, count: 4, fetched: true},
+		{size: pool, offset: -1, limit: 5, err: true},
+	}
+	for _, test := range tests {
+		node.Reset()
+		node.Respond("getPendingTxSize", hexutil.EncodeUint64(uint64(test.size)))
+
+		page, err := client.PendingTransactionsPaged(context.Background(), 1, test.offset, test.limit)
+		if test.err {
+			if err == nil {
+				t.Errorf("offset %d, limit %d: got %d transactions, want error", test.offset, test.limit, len(page))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("offset %d, limit %d: %v", test.offset, test.limit, err)
+			continue
+		}
+		if page == nil || len(page) != test.count {
+			t.Errorf("offset %d, limit %d: got %d transactions (%v), want %d", test.offset, test.limit, len(page), page, test.count)
+			continue
+		}
+		for i, tx := range page {
+			if tx.Hash != common.BigToHash(big.NewInt(int64(test.first+i))) || tx.Nonce.Int64() != int64(test.first+i) {
+				t.Errorf("offset %d, limit %d: transaction %d is %s", test.offset, test.limit, i, tx.Hash.Hex())
+			}
+		}
+		if fetched := len(node.CallsTo("getPendingTransactions")) > 0; fetched != test.fetched {
+			t.Errorf("offset %d, limit %d: listed the pool: %v, want %v", test.offset, test.limit, fetched, test.fetched)
+		}
+	}
+
+	// A malformed transaction outside the page is skipped undecoded.
+	node.RespondRaw("getPendingTransactions", `[{"nonce":"0xzz"},{"nonce":"0x1"}]`)
+	node.Respond("getPendingTxSize", "0x2")
+	if page, err := client.PendingTransactionsPaged(context.Background(), 1, 1, 1); err != nil || len(page) != 1 || page[0].Nonce.Int64() != 1 {
+		t.Errorf("page after malformed transaction: %v, %v", page, err)
+	}
+	if _, err := client.PendingTransactionsPaged(context.Background(), 1, 0, 1); err == nil {
+		t.Error("malformed transaction decoded")
+	}
+	node.RespondRaw("getPendingTransactions", `{"0":{}}`)
+	if _, err := client.PendingTransactions(context.Background(), 1); err == nil {
+		t.Error("pool which isn't a list decoded")
+	}
+	node.RespondRaw("getPendingTransactions", `[]`)
+	if txs, err := client.PendingTransactions(context.Background(), 1); err != nil || txs == nil || len(txs) != 0 {
+		t.Errorf("empty pool: got %v, %v", txs, err)
+	}
+}
@@ -0,0 +1,539 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+const (
+	defaultProbeInterval = 5 * time.Second
+	defaultMaxBlockLag   = 10
+	probeTimeout         = 3 * time.Second
+)
+
+// pinnedMethods are the methods which change state on the node. They are sent
+// to the pinned node and never repeated on another one.
+var pinnedMethods = map[string]bool{
+	"sendRawTransaction": true,
+	"generateGroup":      true,
+	"startGroup":         true,
+	"stopGroup":          true,
+	"removeGroup":        true,
+	"recoverGroup":       true,
+}
+
+// PoolOption configures the connection pool created by DialPool.
+type PoolOption func(*poolConfig)
+
+type poolConfig struct {
+	probeInterval time.Duration
+	maxLag        uint64
+	groupId       uint64
+	resolver      Resolver
+	leaderRouting bool
+	clientOpts    []ClientOption
+}
+
+// WithProbeInterval sets how often the pool probes the block number of its
+// nodes. The default is 5 seconds.
+func WithProbeInterval(d time.Duration) PoolOption {
+	return func(cfg *poolConfig) { cfg.probeInterval = d }
+}
+
+// WithMaxBlockLag sets how many blocks a node may lag behind the most advanced
+// node of the pool before it is quarantined. The default is 10 blocks.
+func WithMaxBlockLag(blocks uint64) PoolOption {
+	return func(cfg *poolConfig) { cfg.maxLag = blocks }
+}
+
+// WithProbeGroup sets the group whose block number is probed. The default is
+// group 1.
+func WithProbeGroup(groupId uint64) PoolOption {
+	return func(cfg *poolConfig) { cfg.groupId = groupId }
+}
+
+// WithClientOptions configures the connections to the nodes and the client
+// returned by DialPool like those of DialContext, e.g. WithChannelCerts for
+// pools of channel endpoints or WithHeader for HTTP nodes behind a gateway.
+func WithClientOptions(opts ...ClientOption) PoolOption {
+	return func(cfg *poolConfig) { cfg.clientOpts = append(cfg.clientOpts, opts...) }
+}
+
+// Resolver looks up the addresses of the nodes, see WithResolver. It is
+// implemented by *net.Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// WithLeaderRouting sends transactions to the current PBFT leader of their
+// group, sparing the hop from another node to the leader. The leader is
+// detected from the consensus status of the nodes with every probe, and again
+// when sending to it fails. Transactions go to the pinned node while the leader
+// is unknown, not part of the pool or quarantined. See
+// Client.SendTransactionWithResult for the node a transaction was sent to.
+func WithLeaderRouting() PoolOption {
+	return func(cfg *poolConfig) { cfg.leaderRouting = true }
+}
+
+// WithResolver makes the pool resolve the host names of its URLs, adding a node
+// for every address rather than sticking to the first one the system resolver
+// returns. Names are resolved again with every probe: nodes are added for new
+// addresses and quarantined while their address is no longer returned. Names
+// starting with an underscore ("_channel._tcp.example.com") are looked up as
+// SRV records, giving the host and port of each node.
+func WithResolver(r Resolver) PoolOption {
+	return func(cfg *poolConfig) { cfg.resolver = r }
+}
+
+// errAddressGone is the failure of the nodes whose address is no longer among
+// those of their host name.
+var errAddressGone = errors.New("address no longer resolved")
+
+// poolNode is a connection of the pool along with its health.
+type poolNode struct {
+	url    string
+	source string // URL the node was resolved from, see WithResolver
+
+	mu      sync.Mutex
+	c       *rpc.Client // nil until dialed
+	number  uint64      // block number seen by the last probe
+	healthy bool
+	gone    bool   // whether the address is no longer resolved
+	err     error  // failure of the last probe
+	nodeId  string // consensus node ID, known with WithLeaderRouting
+}
+
+func (n *poolNode) client() *rpc.Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.c
+}
+
+func (n *poolNode) isHealthy() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.healthy
+}
+
+// fail quarantines the node until the next successful probe.
+func (n *poolNode) fail(err error) {
+	n.mu.Lock()
+	n.healthy, n.err = false, err
+	n.mu.Unlock()
+}
+
+// pool spreads requests over the connections to several nodes.
+type pool struct {
+	cfg     poolConfig
+	dial    *dialConfig // dialing the nodes, see WithClientOptions
+	urls    []string
+	nodesMu sync.Mutex  // guards appending to nodes, which only grows
+	nodes   []*poolNode // read with list
+
+	next   uint32 // round robin position of read calls
+	pinned int32  // node state changing calls are sent to
+
+	leaderMu sync.Mutex
+	leaders  map[uint64]*poolLeader // by group, see WithLeaderRouting
+	refresh  chan struct{}          // wakes the loop to detect the leaders
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DialPool connects a client to several nodes of the same chain. Read calls are
+// spread over the healthy nodes round robin and repeated on another node if the
+// connection to one fails. Transactions and group operations are pinned to a
+// single healthy node and never repeated.
+//
+// Nodes are probed periodically with getBlockNumber; a node which fails the probe
+// or lags too far behind the others is quarantined until it catches up. DialPool
+// fails only if none of the nodes can be dialed, the others are retried by the
+// probes. Subscriptions, channel messages and the cached block height use the
+// first node which could be dialed.
+//
+// URLs may be given as "host:port" for the nodes' RPC ports, or their channel
+// ports if WithClientOptions sets WithChannelCerts, see DialContext. A host name
+// is a single node unless WithResolver is given.
+func DialPool(urls []string, opts ...PoolOption) (*Client, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no node URLs")
+	}
+	cfg := poolConfig{
+		probeInterval: defaultProbeInterval,
+		maxLag:        defaultMaxBlockLag,
+		groupId:       defaultGroupId,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	p := &pool{
+		cfg:     cfg,
+		dial:    newDialConfig(cfg.clientOpts),
+		urls:    urls,
+		leaders: make(map[uint64]*poolLeader),
+		refresh: make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+	lastErr := p.resolve()
+	if len(p.nodes) == 0 {
+		return nil, fmt.Errorf("no node could be resolved: %v", lastErr)
+	}
+	var primary *rpc.Client
+	for _, node := range p.nodes {
+		if c, err := p.dial.dialRPC(context.Background(), node.url); err != nil {
+			log.Warn("Failed to dial pool node", "url", node.url, "err", err)
+			node.err, lastErr = err, err
+		} else {
+			node.c = c
+			if primary == nil {
+				primary = c
+			}
+		}
+	}
+	if primary == nil {
+		return nil, fmt.Errorf("no node could be dialed: %v", lastErr)
+	}
+	p.probe()
+	p.wg.Add(1)
+	go p.loop()
+
+	ec := NewClient(primary)
+	p.dial.configure(ec)
+	ec.pool = p
+	return ec, nil
+}
+
+func (p *pool) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.probe()
+		case <-p.refresh:
+			p.detectLeaders()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// list returns the nodes of the pool.
+func (p *pool) list() []*poolNode {
+	p.nodesMu.Lock()
+	defer p.nodesMu.Unlock()
+	return p.nodes
+}
+
+// resolve adds a node for every URL, or for every address of their host names
+// if the pool has a resolver. Nodes whose address is no longer resolved are
+// marked gone, until it is resolved again. It returns the last lookup failure.
+func (p *pool) resolve() error {
+	if p.cfg.resolver == nil {
+		if len(p.nodes) == 0 {
+			for _, url := range p.urls {
+				p.nodes = append(p.nodes, &poolNode{url: url, source: url})
+			}
+		}
+		return nil
+	}
+	var lastErr error
+	for _, source := range p.urls {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		urls, err := lookupNodes(ctx, p.cfg.resolver, source)
+		cancel()
+		if err != nil {
+			// Keep the known nodes, the lookup may fail only for a while.
+			log.Warn("Failed to resolve pool node", "url", source, "err", err)
+			lastErr = err
+			continue
+		}
+		resolved := make(map[string]bool, len(urls))
+		for _, url := range urls {
+			resolved[url] = true
+		}
+		for _, node := range p.list() {
+			if node.source != source {
+				continue
+			}
+			node.mu.Lock()
+			if gone := !resolved[node.url]; gone != node.gone {
+				node.gone = gone
+				if gone {
+					log.Info("Pool node address no longer resolved", "url", node.url, "source", source)
+					node.healthy, node.err = false, errAddressGone
+				}
+			}
+			node.mu.Unlock()
+			delete(resolved, node.url)
+		}
+		for _, url := range urls {
+			if resolved[url] {
+				log.Debug("Adding resolved pool node", "url", url, "source", source)
+				p.nodesMu.Lock()
+				p.nodes = append(p.nodes, &poolNode{url: url, source: source})
+				p.nodesMu.Unlock()
+			}
+		}
+	}
+	return lastErr
+}
+
+// lookupNodes returns the URLs of the nodes behind rawurl, one for every
+// address of its host name. Names starting with an underscore are looked up as
+// SRV records first, the port of each record replacing the one of the URL.
+func lookupNodes(ctx context.Context, r Resolver, rawurl string) ([]string, error) {
+	u, err := rpc.ParseEndpoint(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host, port := u.Hostname(), u.Port()
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{rawurl}, nil
+	}
+	type target struct{ host, port string }
+	targets := []target{{host, port}}
+	if strings.HasPrefix(host, "_") {
+		_, srvs, err := r.LookupSRV(ctx, "", "", host)
+		if err != nil {
+			return nil, err
+		}
+		targets = targets[:0]
+		for _, srv := range srvs {
+			targets = append(targets, target{strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))})
+		}
+	}
+	var urls []string
+	for _, t := range targets {
+		addrs, err := r.LookupHost(ctx, t.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			hostport := addr
+			if t.port != "" {
+				hostport = net.JoinHostPort(addr, t.port)
+			} else if strings.Contains(addr, ":") {
+				hostport = "[" + addr + "]"
+			}
+			if u.Scheme == "" {
+				urls = append(urls, hostport)
+				continue
+			}
+			resolved := *u
+			resolved.Host = hostport
+			urls = append(urls, resolved.String())
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no addresses for %q", host)
+	}
+	return urls, nil
+}
+
+// probe refreshes the health of all nodes, redialing those without connection.
+func (p *pool) probe() {
+	if p.cfg.resolver != nil {
+		p.resolve()
+	}
+	nodes := p.list()
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *poolNode) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+
+			node.mu.Lock()
+			gone := node.gone
+			node.mu.Unlock()
+			if gone {
+				return
+			}
+			c := node.client()
+			if c == nil {
+				var err error
+				if c, err = p.dial.dialRPC(ctx, node.url); err != nil {
+					node.fail(err)
+					return
+				}
+				node.mu.Lock()
+				node.c = c
+				node.mu.Unlock()
+			}
+			var number hexutil.Uint64
+			if err := c.CallContext(ctx, &number, "getBlockNumber", p.cfg.groupId); err != nil {
+				node.fail(err)
+				return
+			}
+			node.mu.Lock()
+			node.number, node.err = uint64(number), nil
+			node.mu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
+	// Quarantine the nodes lagging behind the most advanced one.
+	var highest uint64
+	for _, node := range nodes {
+		node.mu.Lock()
+		if node.err == nil && node.number > highest {
+			highest = node.number
+		}
+		node.mu.Unlock()
+	}
+	for _, node := range nodes {
+		node.mu.Lock()
+		healthy := node.err == nil && node.number+p.cfg.maxLag >= highest
+		if node.healthy && !healthy {
+			log.Warn("Quarantining pool node", "url", node.url, "number", node.number, "highest", highest, "err", node.err)
+		}
+		node.healthy = healthy
+		node.mu.Unlock()
+	}
+	p.detectLeaders()
+}
+
+// candidates returns the nodes to try a read call on, healthy ones first
+// starting at the round robin position. If no node is healthy all connected
+// nodes are tried, the probes may be behind.
+func (p *pool) candidates() []*poolNode {
+	start := int(atomic.AddUint32(&p.next, 1))
+	nodes := p.list()
+	var healthy, other []*poolNode
+	for i := range nodes {
+		node := nodes[(start+i)%len(nodes)]
+		switch {
+		case node.client() == nil:
+		case node.isHealthy():
+			healthy = append(healthy, node)
+		default:
+			other = append(other, node)
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return other
+}
+
+// pinnedNode returns the node state changing calls are sent to, moving the pin
+// to another healthy node if the pinned one has been quarantined.
+func (p *pool) pinnedNode() *poolNode {
+	pinned := int(atomic.LoadInt32(&p.pinned))
+	nodes := p.list()
+	for i := range nodes {
+		idx := (pinned + i) % len(nodes)
+		if node := nodes[idx]; node.client() != nil && node.isHealthy() {
+			if idx != pinned {
+				atomic.StoreInt32(&p.pinned, int32(idx))
+				log.Info("Pinning transactions to pool node", "url", node.url)
+			}
+			return node
+		}
+	}
+	// Nothing is healthy, stick to the pin if it's connected at all.
+	if node := nodes[pinned]; node.client() != nil {
+		return node
+	}
+	if cs := p.candidates(); len(cs) > 0 {
+		return cs[0]
+	}
+	return nil
+}
+
+func (p *pool) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if pinnedMethods[method] {
+		var node *poolNode
+		if method == "sendRawTransaction" && len(args) > 0 {
+			if groupId, ok := args[0].(uint64); ok {
+				node = p.leaderNode(groupId)
+			}
+		}
+		leader := node != nil
+		if !leader {
+			node = p.pinnedNode()
+		}
+		if node == nil {
+			return rpc.ErrConnectionLost
+		}
+		if report, ok := ctx.Value(sendReportKey{}).(*SendResult); ok {
+			report.Node, report.Leader = node.url, leader
+		}
+		err := node.client().CallContext(ctx, result, method, args...)
+		if errclass.IsRetryable(err) {
+			node.fail(err)
+			if leader {
+				p.refreshLeaders()
+			}
+		}
+		return err
+	}
+	return p.each(ctx, func(c *rpc.Client) error {
+		return c.CallContext(ctx, result, method, args...)
+	})
+}
+
+func (p *pool) batch(ctx context.Context, elems []rpc.BatchElem) error {
+	return p.each(ctx, func(c *rpc.Client) error {
+		return c.BatchCallContext(ctx, elems)
+	})
+}
+
+// each runs a read operation on the candidate nodes in turn until one doesn't
+// fail with a retryable error, see errclass: the node can't be reached or is
+// overloaded.
+func (p *pool) each(ctx context.Context, fn func(*rpc.Client) error) error {
+	err := error(rpc.ErrConnectionLost)
+	for _, node := range p.candidates() {
+		if err = fn(node.client()); !errclass.IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		log.Debug("Pool node failed, trying next", "url", node.url, "err", err)
+		node.fail(err)
+	}
+	return err
+}
+
+func (p *pool) close() {
+	close(p.quit)
+	p.wg.Wait()
+	for _, node := range p.list() {
+		if c := node.client(); c != nil {
+			c.Close()
+		}
+	}
+}
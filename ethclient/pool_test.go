@@ -0,0 +1,105 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+func TestDialPoolChannel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The nodes of a chain share the CA, the fake nodes each have their own,
+	// so the pool is dialed with a single node twice.
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	caCert, sdkCert, sdkKey := node.ChannelCertFiles(dir)
+
+	client, err := ethclient.DialPool([]string{node.ChannelAddr(), "channel://" + node.ChannelAddr()},
+		ethclient.WithProbeInterval(time.Hour),
+		ethclient.WithClientOptions(ethclient.WithChannelCerts(caCert, sdkCert, sdkKey)),
+	)
+	if err != nil {
+		t.Fatalf("DialPool error: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.BlockNumber(context.Background(), 1); err != nil {
+		t.Fatalf("BlockNumber error: %v", err)
+	}
+	calls := node.CallsTo("getBlockNumber")
+	if len(calls) < 3 {
+		t.Fatalf("node received %d calls, want the two probes and the call", len(calls))
+	}
+	for _, call := range calls {
+		if !call.Channel {
+			t.Errorf("%s received over HTTP, want the channel protocol", call.Method)
+		}
+	}
+}
+
+// TestDialPoolFailover checks that read calls move on from a node which can't be
+// reached, but not from one answering with an error.
+func TestDialPoolFailover(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getBlockNumber", "0x10")
+	node.RespondError("getBlockByNumber", -32602, "invalid params")
+
+	down := ethclienttest.NewFakeNode(t)
+	down.Respond("getBlockNumber", "0x10")
+
+	client, err := ethclient.DialPool([]string{down.URL(), node.URL()}, ethclient.WithProbeInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("DialPool error: %v", err)
+	}
+	defer client.Close()
+	down.Close()
+	node.Reset()
+
+	for i := 0; i < 4; i++ {
+		number, err := client.BlockNumber(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("BlockNumber error: %v", err)
+		}
+		if number.Uint64() != 0x10 {
+			t.Fatalf("got block number %v, want %d", number, 0x10)
+		}
+	}
+	if n := len(node.CallsTo("getBlockNumber")); n != 4 {
+		t.Errorf("remaining node served %d calls, want 4", n)
+	}
+	if _, err := client.BlockByNumber(context.Background(), 1, big.NewInt(5)); err == nil {
+		t.Fatal("BlockByNumber succeeded, want the node's error")
+	}
+	if n := len(node.CallsTo("getBlockByNumber")); n != 1 {
+		t.Errorf("node error repeated %d times, want once", n)
+	}
+}
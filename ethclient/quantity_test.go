@@ -0,0 +1,73 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestUint64Getters checks the decoding of the quantities PbftView and
+// PendingTxSize return.
+func TestUint64Getters(t *testing.T) {
+	tests := []struct {
+		result  interface{}
+		want    uint64
+		wantErr bool
+	}{
+		{result: "0x0", want: 0},
+		{result: "0x1f4", want: 500},
+		{result: "0x00ff", want: 255},
+		{result: "500", want: 500},
+		{result: 500, want: 500},
+		{result: "0xffffffffffffffff", want: 1<<64 - 1},
+		{result: "18446744073709551615", want: 1<<64 - 1},
+		{result: "0x10000000000000000", wantErr: true},
+		{result: "0x", wantErr: true},
+		{result: "-1", wantErr: true},
+	}
+	getters := []struct {
+		method string
+		call   func(*ethclient.Client) (uint64, error)
+	}{
+		{"getPbftView", func(c *ethclient.Client) (uint64, error) { return c.PbftView(context.Background(), 1) }},
+		{"getPendingTxSize", func(c *ethclient.Client) (uint64, error) { return c.PendingTxSize(context.Background(), 1) }},
+	}
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	for _, getter := range getters {
+		for _, test := range tests {
+			node.Respond(getter.method, test.result)
+			n, err := getter.call(client)
+			if (err != nil) != test.wantErr || n != test.want {
+				t.Errorf("%s %v: got %d, %v, want %d, error %t", getter.method, test.result, n, err, test.want, test.wantErr)
+			}
+			if err == fiscobcos.NotFound {
+				t.Errorf("%s %v: invalid quantity reported as NotFound", getter.method, test.result)
+			}
+		}
+		node.Respond(getter.method, "")
+		if _, err := getter.call(client); err != fiscobcos.NotFound {
+			t.Errorf("%s empty string: got %v, want NotFound", getter.method, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// CallRaw invokes a JSON-RPC method of the node, typically one the client has
+// no wrapper for yet, and decodes its result into result, which may be nil to
+// discard it. The arguments are sent as they are, so methods scoped to a group
+// take the group id as their first argument.
+//
+// The call is subject to the timeout, retry policy and node pool of the client,
+// and errors reported by the node are returned as *Error. A missing, null,
+// empty object or empty string result is reported as fiscobcos.NotFound, as by
+// the wrapped methods. For example, a future method returning a struct:
+//
+//	var info struct {
+//		Count hexutil.Uint64 `json:"count"`
+//	}
+//	err := client.CallRaw(ctx, &info, "getFooInfo", groupId, "0x10")
+//	if err == fiscobcos.NotFound {
+//		// the node knows no such foo
+//	}
+func (ec *Client) CallRaw(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return ec.callResult(ctx, result, method, args...)
+}
+
+// RawClient returns the RPC connection of the client, for the features of the
+// node the client doesn't cover, like channel messages. For clients created by
+// DialPool, it's the connection to the first node that could be dialed.
+// Closing the client closes it.
+func (ec *Client) RawClient() *rpc.Client {
+	return ec.c
+}
+
+// callResult performs a JSON-RPC call and decodes its result into result,
+// reporting a missing result as fiscobcos.NotFound, see isEmptyResult. A nil
+// result discards the response, whatever it is.
+func (ec *Client) callResult(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	var raw json.RawMessage
+	if err := ec.call(ctx, &raw, method, args...); err != nil {
+		if err == rpc.ErrNoResult {
+			return fiscobcos.NotFound
+		}
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if isEmptyResult(raw) {
+		return fiscobcos.NotFound
+	}
+	if dst, ok := result.(*json.RawMessage); ok {
+		*dst = raw
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return err
+	}
+	if ec.rawResponses {
+		retainRaw(result, raw)
+	}
+	return nil
+}
+
+// retainRaw stores the response a value was decoded from in its Raw field, if
+// it has one, see WithRawResponses. result is the pointer the value was decoded
+// into.
+func retainRaw(result interface{}, raw json.RawMessage) {
+	switch v := result.(type) {
+	case **types.Block:
+		if *v != nil {
+			(*v).Raw = raw
+		}
+	case **types.Receipt:
+		if *v != nil {
+			(*v).Raw = raw
+		}
+	case **types.TransactionByHash:
+		if *v != nil {
+			(*v).Raw = raw
+		}
+	case **types.SyncStatus:
+		if *v != nil {
+			(*v).Raw = raw
+		}
+	case *types.Block:
+		v.Raw = raw
+	case *types.Receipt:
+		v.Raw = raw
+	case *types.TransactionByHash:
+		v.Raw = raw
+	case *types.SyncStatus:
+		v.Raw = raw
+	}
+}
+
+// isEmptyResult reports whether a result tells that the requested item doesn't
+// exist. Depending on method and version, nodes answer with null, an empty
+// object or an empty string, or leave the result out.
+func isEmptyResult(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) >= 2 && raw[0] == '{' && raw[len(raw)-1] == '}' {
+		return len(bytes.TrimSpace(raw[1:len(raw)-1])) == 0
+	}
+	switch string(raw) {
+	case "", "null", `""`:
+		return true
+	}
+	return false
+}
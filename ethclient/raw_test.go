@@ -0,0 +1,238 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// takeRaw clears the Raw fields of v, a pointer to a decoded value or a slice
+// of them, returning their contents.
+func takeRaw(v interface{}) []json.RawMessage {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Slice {
+		var raws []json.RawMessage
+		for i := 0; i < val.Len(); i++ {
+			raws = append(raws, takeRaw(val.Index(i).Interface())...)
+		}
+		return raws
+	}
+	field := val.Elem().FieldByName("Raw")
+	raw := field.Interface().(json.RawMessage)
+	field.Set(reflect.Zero(field.Type()))
+	return []json.RawMessage{raw}
+}
+
+type rawGetter struct {
+	name string
+	get  func(*ethclient.Client) (interface{}, error)
+}
+
+// Responses of a node for block 2 and its first transaction, in the format of
+// the 2.x JSON-RPC documentation.
+const (
+	testBlockHash = "0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955"
+	testTxHash    = "0x3fe0bce2716957ce4322dbca8537717187249980c0938f2cb3f01acac4a7ab5a"
+
+	testTx = `{"blockHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955","blockNumber":"0x2",` +
+		`"from":"0x90853ef5d0f5610c0cbe20d5eac048895d489a12","gas":"0x11e1a300","gasPrice":"0x11e1a300",` +
+		`"hash":"0x3fe0bce2716957ce4322dbca8537717187249980c0938f2cb3f01acac4a7ab5a","input":"0x4ed3885e",` +
+		`"nonce":"0x8739c12f124127c1dca6985af1f4d4c1","to":"0x8b97a373938cd6ff6aec1a8a0131f3648105dedf",` +
+		`"transactionIndex":"0x0","value":"0x0"}`
+	testTx2 = `{"blockHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955","blockNumber":"0x2",` +
+		`"from":"0x90853ef5d0f5610c0cbe20d5eac048895d489a12","gas":"0x11e1a300","gasPrice":"0x11e1a300",` +
+		`"hash":"0x8e3d2d6ba3d2f30eb1bd2a4a1f5ae4e4a5ef4b4e02c1c7c1b1e0b8e3a7a4c2d1","input":"0x",` +
+		`"nonce":"0x1b4d2b0e3c8f4a9d7e6f5a4b3c2d1e0f","to":"0x8b97a373938cd6ff6aec1a8a0131f3648105dedf",` +
+		`"transactionIndex":"0x1","value":"0x0"}`
+	testBlock = `{"dbHash":"0x3ff05006e4e3cdc5d645197bf1056267b0076a04ee7e457e2171c2aef815bc11","extraData":[],` +
+		`"gasLimit":"0x0","gasUsed":"0xf698","hash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955",` +
+		`"logsBloom":"0x00","number":"0x2","parentHash":"0x13de55b8370e9f5423c0fc7043bb120a777bb0f0d04ac4eb880ee0f8649f1c05",` +
+		`"receiptsRoot":"0xf2827b701b861269037b899456267673b8e58dff4b1778a60ad2a11c5ed027f3","sealer":"0x1",` +
+		`"sealerList":["d28d23b2aadacc43e4cfbfc91142bb4edc67d53194afd96d0ca42f20ddebacdc25dd9cf329544e441518eb7fc92eab7ed49e08e63615fb478e6f056f6f9bf5a4",` +
+		`"74d4806d3eeec8e15bf5c223e15fe9bad57098f0676c2d430c4216c81fe1884e028a73682e266a18db3e0fbc2b9a95eb35450b15609b933001cdbd002df5f452"],` +
+		`"stateRoot":"0x0000000000000000000000000000000000000000000000000000000000000000","timestamp":"0x16d1a8b4d6c",` +
+		`"transactions":[` + testTx + `,` + testTx2 + `],` +
+		`"transactionsRoot":"0x9a4c2b7e2f0c1d6a8b3e5f4d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b"}`
+	testReceipt = `{"blockHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955","blockNumber":"0x2",` +
+		`"contractAddress":"0x0000000000000000000000000000000000000000","from":"0x90853ef5d0f5610c0cbe20d5eac048895d489a12",` +
+		`"gasUsed":"0x7b4c","input":"0x4ed3885e","logs":[{"address":"0x8b97a373938cd6ff6aec1a8a0131f3648105dedf","data":"0x",` +
+		`"topics":["0xec44447a5010cb60c0406b3e634b3a47f9ab727737f7baa718bb4d6d672b9011"]}],"output":"0x",` +
+		`"root":"0xfe5465b0e942ae9f72ed05d34de2933752a5f72d7fd3ef339238bd3c9c3cd7c4","status":"0x0",` +
+		`"to":"0x8b97a373938cd6ff6aec1a8a0131f3648105dedf","transactionHash":"0x3fe0bce2716957ce4322dbca8537717187249980c0938f2cb3f01acac4a7ab5a",` +
+		`"transactionIndex":"0x0"}`
+	testBatchReceipts = `{"blockInfo":{"blockHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955","blockNumber":"0x2",` +
+		`"receiptRoot":"0xf2827b701b861269037b899456267673b8e58dff4b1778a60ad2a11c5ed027f3","receiptsCount":"0x1"},` +
+		`"transactionReceipts":[` + testReceipt + `]}`
+	testSyncStatus = `{"blockNumber":2,"genesisHash":"0x651102f26e84982a9e18da3cf3ee3c5e57f791b63fcd44611a2f3b3afabef401",` +
+		`"isSyncing":false,"knownHighestNumber":2,"knownLatestHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955",` +
+		`"latestHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955",` +
+		`"nodeId":"d28d23b2aadacc43e4cfbfc91142bb4edc67d53194afd96d0ca42f20ddebacdc25dd9cf329544e441518eb7fc92eab7ed49e08e63615fb478e6f056f6f9bf5a4",` +
+		`"peers":[{"blockNumber":2,"genesisHash":"0x651102f26e84982a9e18da3cf3ee3c5e57f791b63fcd44611a2f3b3afabef401",` +
+		`"latestHash":"0x6b26199d41307198833df99971eb294c08892b2ef3fe14d07045c86a8ba82955",` +
+		`"nodeId":"74d4806d3eeec8e15bf5c223e15fe9bad57098f0676c2d430c4216c81fe1884e028a73682e266a18db3e0fbc2b9a95eb35450b15609b933001cdbd002df5f452"}],` +
+		`"protocolId":65544,"txPoolSize":"0"}`
+)
+
+// TestRawResponses checks that retaining the raw responses leaves the decoded
+// values unchanged, and that each value decodes from its raw response.
+func TestRawResponses(t *testing.T) {
+	ctx := context.Background()
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondRaw("getBlockByNumber", testBlock)
+	node.RespondRaw("getTransactionByHash", testTx)
+	node.RespondRaw("getTransactionReceipt", testReceipt)
+	node.RespondRaw("getSyncStatus", testSyncStatus)
+	node.RespondRaw("getBatchReceiptsByBlockNumberAndRange", testBatchReceipts)
+
+	getters := []rawGetter{
+		{"BlockByNumber", func(c *ethclient.Client) (interface{}, error) { return c.BlockByNumber(ctx, 1, big.NewInt(2)) }},
+		{"BatchBlockByNumber", func(c *ethclient.Client) (interface{}, error) {
+			return c.BatchBlockByNumber(ctx, 1, []*big.Int{big.NewInt(2), big.NewInt(2)})
+		}},
+		{"TransactionByHash", func(c *ethclient.Client) (interface{}, error) {
+			return c.TransactionByHash(ctx, 1, common.HexToHash(testTxHash))
+		}},
+		{"TransactionReceipt", func(c *ethclient.Client) (interface{}, error) {
+			return c.TransactionReceipt(ctx, 1, common.HexToHash(testTxHash))
+		}},
+		{"SyncStatus", func(c *ethclient.Client) (interface{}, error) { return c.SyncStatus(ctx, 1) }},
+		{"BlockReceipts", func(c *ethclient.Client) (interface{}, error) { return c.BlockReceipts(ctx, 1, big.NewInt(2)) }},
+	}
+	plain := node.Client()
+	retaining, err := ethclient.DialWithOptions(node.URL(), ethclient.WithRawResponses(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer retaining.Close()
+	for _, getter := range getters {
+		want, err := getter.get(plain)
+		if err != nil {
+			t.Errorf("%s: %v", getter.name, err)
+			continue
+		}
+		for _, raw := range takeRaw(want) {
+			if raw != nil {
+				t.Errorf("%s: raw response kept by default", getter.name)
+			}
+		}
+		got, err := getter.get(retaining)
+		if err != nil {
+			t.Errorf("%s with raw responses: %v", getter.name, err)
+			continue
+		}
+		raws := takeRaw(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %+v with raw responses, want %+v", getter.name, got, want)
+		}
+		// Each raw response decodes into the value it was kept with.
+		values := reflect.ValueOf(got)
+		if values.Kind() != reflect.Slice {
+			values = reflect.ValueOf([]interface{}{got})
+		}
+		for i, raw := range raws {
+			value := values.Index(i)
+			if value.Kind() == reflect.Interface {
+				value = value.Elem()
+			}
+			dec := reflect.New(value.Type().Elem())
+			if err := json.Unmarshal(raw, dec.Interface()); err != nil {
+				t.Errorf("%s: raw response %d: %v", getter.name, i, err)
+			} else if !reflect.DeepEqual(dec.Interface(), value.Interface()) {
+				t.Errorf("%s: raw response %d decodes to %+v, want %+v", getter.name, i, dec.Elem(), value.Elem())
+			}
+		}
+	}
+}
+
+// fooInfo is the result of getFooInfo, a method the client has no wrapper for.
+type fooInfo struct {
+	Count hexutil.Uint64 `json:"count"`
+}
+
+// TestCallRaw calls a method the client doesn't wrap, checking the arguments
+// sent and the decoding of its results.
+func TestCallRaw(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	tests := []struct {
+		raw  string // result of getFooInfo, empty for an error
+		err  error  // error returned by the node
+		want *fooInfo
+		fail func(error) bool
+	}{
+		{raw: `{"count":"0x2a"}`, want: &fooInfo{Count: 42}},
+		{raw: `null`, fail: func(err error) bool { return err == fiscobcos.NotFound }},
+		{raw: `{}`, fail: func(err error) bool { return err == fiscobcos.NotFound }},
+		{raw: `""`, fail: func(err error) bool { return err == fiscobcos.NotFound }},
+		{raw: `{"count":42}`, fail: func(err error) bool { _, ok := err.(*json.UnmarshalTypeError); return ok }},
+		{
+			err: &ethclienttest.Error{Code: -32601, Message: "Method not found"},
+			fail: func(err error) bool {
+				e, ok := err.(*ethclient.Error)
+				return ok && e.Is(ethclient.ErrMethodNotFound)
+			},
+		},
+	}
+	for _, test := range tests {
+		node.Reset()
+		node.Handle("getFooInfo", func([]json.RawMessage) (interface{}, error) {
+			if test.err != nil {
+				return nil, test.err
+			}
+			return json.RawMessage(test.raw), nil
+		})
+		var info fooInfo
+		err := client.CallRaw(context.Background(), &info, "getFooInfo", uint64(2), "0x10")
+		if test.fail != nil {
+			if err == nil || !test.fail(err) {
+				t.Errorf("%s: got error %#v", test.raw, err)
+			}
+		} else if err != nil || info != *test.want {
+			t.Errorf("%s: got %+v, error %v, want %+v", test.raw, info, err, test.want)
+		}
+		if calls := node.CallsTo("getFooInfo"); len(calls) != 1 || groupParam(t, calls[0]) != 2 || len(calls[0].Params) != 2 || string(calls[0].Params[1]) != `"0x10"` {
+			t.Errorf("%s: getFooInfo sent as %+v", test.raw, calls)
+		}
+		// A nil result discards whatever is answered.
+		if test.err == nil {
+			if err := client.CallRaw(context.Background(), nil, "getFooInfo", uint64(2), "0x10"); err != nil {
+				t.Errorf("%s: discarding the result: %v", test.raw, err)
+			}
+		}
+	}
+
+	// The raw connection reaches the same node, without the mapping of
+	// empty results.
+	node.RespondRaw("getFooInfo", `null`)
+	var info *fooInfo
+	if err := client.RawClient().CallContext(context.Background(), &info, "getFooInfo", 2, "0x10"); err != nil || info != nil {
+		t.Errorf("raw client: got %+v, error %v", info, err)
+	}
+}
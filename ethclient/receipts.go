@@ -0,0 +1,252 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+const (
+	// defaultReceiptConcurrency is the number of receipts BlockReceipts fetches
+	// in parallel unless changed with SetReceiptConcurrency.
+	defaultReceiptConcurrency = 8
+
+	// defaultReceiptRetries is the number of times BlockReceipts repeats the
+	// fetches which failed unless changed with SetReceiptRetries.
+	defaultReceiptRetries = 3
+
+	// receiptRetryDelay is the wait before the first repetition of failed
+	// receipt fetches, doubled for every further one up to receiptMaxRetryDelay.
+	receiptRetryDelay    = 100 * time.Millisecond
+	receiptMaxRetryDelay = 2 * time.Second
+)
+
+// ReceiptError is returned by BlockReceipts if the receipt of a transaction of
+// the block couldn't be fetched.
+type ReceiptError struct {
+	Index  int         // position of the transaction in the block
+	TxHash common.Hash // hash of the transaction
+	Err    error       // failure of the last attempt
+}
+
+func (e *ReceiptError) Error() string {
+	return fmt.Sprintf("receipt of transaction %d (%s): %v", e.Index, e.TxHash.Hex(), e.Err)
+}
+
+// Unwrap returns the failure of the last attempt.
+func (e *ReceiptError) Unwrap() error { return e.Err }
+
+// blockReceipts is the result of getBatchReceiptsByBlockNumberAndRange.
+type blockReceipts struct {
+	BlockInfo struct {
+		BlockHash     common.Hash `json:"blockHash"`
+		BlockNumber   string      `json:"blockNumber"`
+		ReceiptsCount string      `json:"receiptsCount"`
+	} `json:"blockInfo"`
+	TransactionReceipts []*types.Receipt `json:"transactionReceipts"`
+}
+
+// SetReceiptConcurrency sets the number of receipts BlockReceipts fetches in
+// parallel from nodes without batch receipt retrieval. Values below one reset it
+// to the default.
+func (ec *Client) SetReceiptConcurrency(n int) {
+	if n < 1 {
+		n = defaultReceiptConcurrency
+	}
+	atomic.StoreInt32(&ec.receiptConcurrency, int32(n))
+}
+
+// SetReceiptRetries sets the number of times BlockReceipts repeats the receipt
+// fetches which failed before giving up. Negative values reset it to the
+// default.
+func (ec *Client) SetReceiptRetries(n int) {
+	if n < 0 {
+		n = defaultReceiptRetries
+	}
+	atomic.StoreInt32(&ec.receiptRetries, int32(n))
+}
+
+// BlockReceipts returns the receipts of all transactions of a block, in the order
+// of the transactions. blockNumber nil means the latest block.
+//
+// Nodes supporting getBatchReceiptsByBlockNumberAndRange (since 2.7.0) return
+// them at once. From older nodes they are fetched one by one by a pool of
+// workers, see SetReceiptConcurrency, repeating failed fetches as set by
+// SetReceiptRetries. If a receipt can't be fetched, the error is a
+// *ReceiptError telling the transaction.
+func (ec *Client) BlockReceipts(ctx context.Context, groupId uint64, blockNumber *big.Int) ([]*types.Receipt, error) {
+	groupId = ec.group(ctx, groupId)
+
+	if isLatestBlock(blockNumber) {
+		head, err := ec.BlockNumber(ctx, groupId)
+		if err != nil {
+			return nil, err
+		}
+		blockNumber = head
+	}
+	if err := checkBlockNumber("BlockReceipts", blockNumber); err != nil {
+		return nil, err
+	}
+	receipts, err := ec.batchReceipts(ctx, groupId, blockNumber.Uint64())
+	if e, ok := err.(*Error); !ok || e.Err != ErrMethodNotFound {
+		return receipts, err
+	}
+	var block *filterBlock
+	if err := ec.callFilterBlock(ctx, &block, "getBlockByNumber", groupId, blockNumberArgUint64("getBlockByNumber", blockNumber.Uint64()), false); err != nil {
+		return nil, err
+	}
+	return ec.fetchReceipts(ctx, groupId, block.Transactions)
+}
+
+// batchReceipts retrieves the receipts of a block with the batch method of the
+// node.
+func (ec *Client) batchReceipts(ctx context.Context, groupId, number uint64) ([]*types.Receipt, error) {
+	var raw json.RawMessage
+	// All receipts (from 0, count -1), uncompressed.
+	if err := ec.callResult(ctx, &raw, "getBatchReceiptsByBlockNumberAndRange", groupId, blockNumberArgUint64("getBatchReceiptsByBlockNumberAndRange", number), "0", "-1", false); err != nil {
+		return nil, err
+	}
+	var result blockReceipts
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if ec.rawResponses {
+		var raws struct {
+			TransactionReceipts []json.RawMessage `json:"transactionReceipts"`
+		}
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, err
+		}
+		for i, receipt := range result.TransactionReceipts {
+			if receipt != nil && i < len(raws.TransactionReceipts) {
+				receipt.Raw = raws.TransactionReceipts[i]
+			}
+		}
+	}
+	// The receipts may leave out the block they belong to. The genesis block
+	// has no transactions, so a zero block number means a missing one.
+	for i, receipt := range result.TransactionReceipts {
+		if receipt == nil {
+			return nil, fmt.Errorf("missing receipt %d of block %d", i, number)
+		}
+		if receipt.BlockNumber == 0 {
+			receipt.BlockHash = result.BlockInfo.BlockHash
+			receipt.BlockNumber = number
+			for _, log := range receipt.Logs {
+				log.BlockNumber = number
+				log.BlockHash = receipt.BlockHash
+			}
+		}
+	}
+	return result.TransactionReceipts, nil
+}
+
+// fetchReceipts retrieves the receipts of the given transactions in parallel,
+// repeating the failed fetches up to the configured number of times.
+func (ec *Client) fetchReceipts(ctx context.Context, groupId uint64, txHashes []common.Hash) ([]*types.Receipt, error) {
+	var (
+		receipts = make([]*types.Receipt, len(txHashes))
+		errs     = make([]error, len(txHashes))
+		pending  = make([]int, len(txHashes))
+	)
+	for i := range pending {
+		pending[i] = i
+	}
+	retries := int(atomic.LoadInt32(&ec.receiptRetries))
+	for attempt := 0; ; attempt++ {
+		ec.fetchReceiptsOnce(ctx, groupId, txHashes, pending, receipts, errs)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if ec.closed() {
+			return nil, ErrClientClosed
+		}
+		failed := pending[:0]
+		for _, i := range pending {
+			if errs[i] != nil {
+				failed = append(failed, i)
+			}
+		}
+		if len(failed) == 0 {
+			return receipts, nil
+		}
+		first := failed[0]
+		if attempt >= retries {
+			return nil, &ReceiptError{Index: first, TxHash: txHashes[first], Err: errs[first]}
+		}
+		pending = failed
+
+		delay, _ := errclass.Backoff(ctx, attempt, receiptRetryDelay, receiptMaxRetryDelay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetchReceiptsOnce fetches the receipts of the transactions at the indexes in
+// pending, storing the receipt or the failure of each in receipts or errs.
+func (ec *Client) fetchReceiptsOnce(ctx context.Context, groupId uint64, txHashes []common.Hash, pending []int, receipts []*types.Receipt, errs []error) {
+	workers := int(atomic.LoadInt32(&ec.receiptConcurrency))
+	if workers < 1 {
+		workers = defaultReceiptConcurrency
+	}
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+	var (
+		indexes = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				receipt, err := ec.TransactionReceipt(ctx, groupId, txHashes[i])
+				if err == nil && receipt == nil {
+					err = fiscobcos.NotFound
+				}
+				receipts[i], errs[i] = receipt, err
+			}
+		}()
+	}
+feed:
+	for _, i := range pending {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+}
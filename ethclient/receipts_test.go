@@ -0,0 +1,191 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestBlockReceiptsFanOut fetches the receipts of a block from a node without
+// batch receipt retrieval, checking their order, the number of receipts fetched
+// at once, and the retries of the failed fetches.
+func TestBlockReceiptsFanOut(t *testing.T) {
+	tests := []struct {
+		txs         int
+		concurrency int         // 0 for the default
+		retries     int         // -1 for the default
+		fails       map[int]int // transaction index to failed fetches
+		errIndex    int         // index reported by the *ReceiptError, -1 for success
+	}{
+		{txs: 0, retries: -1, errIndex: -1},
+		{txs: 1, retries: -1, errIndex: -1},
+		{txs: 50, retries: -1, errIndex: -1},
+		{txs: 50, concurrency: 3, retries: -1, errIndex: -1},
+		{txs: 20, concurrency: 1, retries: -1, errIndex: -1},
+		{txs: 20, concurrency: 4, retries: 2, fails: map[int]int{3: 2, 17: 1}, errIndex: -1},
+		{txs: 20, concurrency: 4, retries: 1, fails: map[int]int{3: 1, 17: 2}, errIndex: 17},
+		{txs: 20, concurrency: 4, retries: 0, fails: map[int]int{12: 1, 5: 1}, errIndex: 5},
+		{txs: 20, retries: -1, fails: map[int]int{9: 4}, errIndex: 9},
+	}
+	for i, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		node.RespondError("getBatchReceiptsByBlockNumberAndRange", -32601, "Method not found")
+
+		hashes := make([]common.Hash, test.txs)
+		index := make(map[common.Hash]int)
+		for j := range hashes {
+			hashes[j] = common.BigToHash(big.NewInt(int64(1000 + j)))
+			index[hashes[j]] = j
+		}
+		node.Respond("getBlockByNumber", map[string]interface{}{"number": "0x7", "transactions": hashes})
+
+		var (
+			mu              sync.Mutex
+			fails           = make(map[int]int)
+			inFlight, limit int32
+		)
+		for j, n := range test.fails {
+			fails[j] = n
+		}
+		node.Handle("getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&limit)
+				if n <= max || atomic.CompareAndSwapInt32(&limit, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			var hash common.Hash
+			if err := json.Unmarshal(params[1], &hash); err != nil {
+				return nil, err
+			}
+			j := index[hash]
+			mu.Lock()
+			defer mu.Unlock()
+			if fails[j] > 0 {
+				fails[j]--
+				return nil, &ethclienttest.Error{Code: -40011, Message: "over QPS limit"}
+			}
+			return map[string]interface{}{"transactionHash": hash, "transactionIndex": hexutil.EncodeUint64(uint64(j)), "blockNumber": "0x7", "status": "0x0"}, nil
+		})
+
+		client := node.Client()
+		client.SetReceiptConcurrency(test.concurrency)
+		client.SetReceiptRetries(test.retries)
+		receipts, err := client.BlockReceipts(context.Background(), 1, big.NewInt(7))
+		if test.errIndex >= 0 {
+			e, ok := err.(*ethclient.ReceiptError)
+			if !ok || e.Index != test.errIndex || e.TxHash != hashes[test.errIndex] || e.Err == nil {
+				t.Errorf("test %d: got error %v, want a *ReceiptError of transaction %d", i, err, test.errIndex)
+			}
+			if receipts != nil {
+				t.Errorf("test %d: got receipts along with the error", i)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: BlockReceipts error: %v", i, err)
+		} else if len(receipts) != test.txs {
+			t.Errorf("test %d: got %d receipts, want %d", i, len(receipts), test.txs)
+		} else {
+			for j, receipt := range receipts {
+				if receipt.TxHash != hashes[j] || receipt.TxIndex != uint(j) {
+					t.Errorf("test %d: receipt %d of transaction %d (%s)", i, j, receipt.TxIndex, receipt.TxHash.Hex())
+				}
+			}
+		}
+
+		want := int32(test.concurrency)
+		if want == 0 {
+			want = 8
+		}
+		if test.txs > 0 && test.txs < int(want) {
+			want = int32(test.txs)
+		}
+		if limit > want {
+			t.Errorf("test %d: fetched %d receipts at once, want at most %d", i, limit, want)
+		}
+		if test.txs >= 20 && limit < 2 && want > 1 {
+			t.Errorf("test %d: receipts weren't fetched concurrently", i)
+		}
+		node.Close()
+	}
+}
+
+// TestBlockReceiptsBatch checks that the receipts returned by the batch method
+// are completed with the block they belong to.
+func TestBlockReceiptsBatch(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	blockHash := common.HexToHash("0xb10c")
+	node.Respond("getBlockNumber", "0x9")
+	node.Respond("getBatchReceiptsByBlockNumberAndRange", map[string]interface{}{
+		"blockInfo": map[string]interface{}{"blockHash": blockHash, "blockNumber": "0x9", "receiptsCount": "0x2"},
+		"transactionReceipts": []interface{}{
+			map[string]interface{}{"transactionHash": common.HexToHash("0x01"), "status": "0x0", "logs": []interface{}{map[string]interface{}{"address": common.Address{1}, "data": "0x", "topics": []interface{}{}}}},
+			map[string]interface{}{"transactionHash": common.HexToHash("0x02"), "transactionIndex": "0x1", "status": "0x16"},
+		},
+	})
+	receipts, err := client.BlockReceipts(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatalf("BlockReceipts error: %v", err)
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("got %d receipts, want 2", len(receipts))
+	}
+	for i, receipt := range receipts {
+		if receipt.BlockNumber != 9 || receipt.BlockHash != blockHash || receipt.TxHash != common.BigToHash(big.NewInt(int64(i+1))) {
+			t.Errorf("receipt %d: got block %d (%s) and transaction %s", i, receipt.BlockNumber, receipt.BlockHash.Hex(), receipt.TxHash.Hex())
+		}
+	}
+	if log := receipts[0].Logs[0]; log.BlockNumber != 9 || log.BlockHash != blockHash {
+		t.Errorf("log of block %d (%s), want block 9", log.BlockNumber, log.BlockHash.Hex())
+	}
+	calls := node.CallsTo("getBatchReceiptsByBlockNumberAndRange")
+	if len(calls) != 1 || len(node.CallsTo("getTransactionReceipt")) != 0 {
+		t.Fatalf("sent %d batch receipt requests and %d receipt requests", len(calls), len(node.CallsTo("getTransactionReceipt")))
+	}
+	if params, _ := json.Marshal(calls[0].Params); string(params) != `[1,"9","0","-1",false]` {
+		t.Errorf("batch receipts requested with %s", params)
+	}
+
+	// A receipt left out fails the whole block.
+	node.Respond("getBatchReceiptsByBlockNumberAndRange", map[string]interface{}{
+		"blockInfo":           map[string]interface{}{"blockHash": blockHash, "blockNumber": "0x9", "receiptsCount": "0x2"},
+		"transactionReceipts": []interface{}{nil, nil},
+	})
+	if receipts, err := client.BlockReceipts(context.Background(), 1, big.NewInt(9)); err == nil {
+		t.Errorf("got receipts %v with missing ones", receipts)
+	}
+	if _, err := client.BlockReceipts(context.Background(), 1, big.NewInt(-9)); err == nil {
+		t.Error("BlockReceipts accepted a negative block number")
+	}
+}
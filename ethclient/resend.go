@@ -0,0 +1,367 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+const (
+	// defaultResendAttempts is the number of times a Resender sends a
+	// transaction, the original included, unless changed with SetMaxAttempts.
+	defaultResendAttempts = 5
+
+	// resendCheckInterval is how often a Resender checks its transactions if
+	// no new block comes in, e.g. to repeat failed receipt requests.
+	resendCheckInterval = 5 * time.Second
+)
+
+var (
+	// ErrResendLimit ends a tracked transaction whose attempts all expired
+	// without being committed.
+	ErrResendLimit = errors.New("transaction expired, resend limit reached")
+
+	// ErrResenderStopped ends the transactions tracked by a Resender that was
+	// stopped before they were settled.
+	ErrResenderStopped = errors.New("resender stopped")
+)
+
+// SignerFn signs the transactions a Resender rebuilds, typically with the key
+// the original transaction was signed with.
+type SignerFn func(tx *types.Transaction) (*types.Transaction, error)
+
+// Resender sends transactions again whose block limit passed before they were
+// committed, e.g. while the node is congested. See Track.
+type Resender struct {
+	ec      *Client
+	groupId uint64
+	sign    SignerFn
+
+	mu          sync.Mutex
+	maxAttempts int
+	tracked     map[*TrackedTx]struct{}
+
+	wake     chan struct{}
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewResender starts a resender for the transactions of a group, re-signing
+// them with sign. It follows the chain with the client's head tracker, see
+// TrackHeads, and runs until Stop is called or the client is closed.
+func (ec *Client) NewResender(groupId uint64, sign SignerFn) *Resender {
+	r := &Resender{
+		ec:          ec,
+		groupId:     ec.group(context.Background(), groupId),
+		sign:        sign,
+		maxAttempts: defaultResendAttempts,
+		tracked:     make(map[*TrackedTx]struct{}),
+		wake:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.loop()
+	return r
+}
+
+// SetMaxAttempts sets the number of times a transaction is sent, the original
+// included, before it fails with ErrResendLimit. Values below one reset it to
+// the default of 5.
+func (r *Resender) SetMaxAttempts(n int) {
+	if n < 1 {
+		n = defaultResendAttempts
+	}
+	r.mu.Lock()
+	r.maxAttempts = n
+	r.mu.Unlock()
+}
+
+// Track watches a transaction which has been sent to the group. Once the chain
+// passes its block limit without committing it, the transaction is rebuilt
+// with a new nonce and block limit, signed and sent again, up to the maximum
+// number of attempts.
+//
+// An attempt which was only delayed may still be committed after the next one
+// was sent, so the handle collects the receipts of all attempts and is settled
+// only once every attempt was either committed or expired.
+func (r *Resender) Track(tx *types.Transaction) *TrackedTx {
+	t := &TrackedTx{
+		attempts: []*resendAttempt{{tx: tx}},
+		done:     make(chan struct{}),
+	}
+	r.mu.Lock()
+	stopped := r.tracked == nil
+	if !stopped {
+		r.tracked[t] = struct{}{}
+	}
+	r.mu.Unlock()
+	if stopped {
+		t.finish(ErrResenderStopped)
+		return t
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return t
+}
+
+// Stop stops the resender. The transactions it still tracks end with
+// ErrResenderStopped, though their attempts may still be committed.
+func (r *Resender) Stop() {
+	r.stopOnce.Do(func() { close(r.quit) })
+	r.wg.Wait()
+}
+
+// TrackedTx is a transaction tracked by a Resender, along with the attempts
+// made to commit it.
+type TrackedTx struct {
+	mu       sync.Mutex
+	attempts []*resendAttempt
+	receipts []*types.Receipt // of the committed attempts, in the order found
+	err      error
+
+	done chan struct{}
+}
+
+// resendAttempt is a transaction sent by a Resender.
+type resendAttempt struct {
+	tx      *types.Transaction
+	settled bool // whether the attempt was committed, expired or rejected
+}
+
+// Attempts returns the transactions sent so far, the original first.
+func (t *TrackedTx) Attempts() []*types.Transaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	txs := make([]*types.Transaction, len(t.attempts))
+	for i, a := range t.attempts {
+		txs[i] = a.tx
+	}
+	return txs
+}
+
+// Receipts returns the receipts of the attempts committed so far. Usually
+// there is one, but an attempt thought expired may be committed along with the
+// next one.
+func (t *TrackedTx) Receipts() []*types.Receipt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*types.Receipt(nil), t.receipts...)
+}
+
+// Done returns a channel closed once the transaction is settled: every attempt
+// was committed or expired, or tracking failed.
+func (t *TrackedTx) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait waits until the transaction is settled and returns the receipt of the
+// first attempt found committed. Other committed attempts are reported by
+// Receipts. Without any, the error which ended tracking is returned.
+func (t *TrackedTx) Wait(ctx context.Context) (*types.Receipt, error) {
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.receipts) > 0 {
+		return t.receipts[0], nil
+	}
+	return nil, t.err
+}
+
+// finish settles the transaction with err, if it had no receipt.
+func (t *TrackedTx) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	t.err = err
+	close(t.done)
+}
+
+// pending returns the attempts which are not settled yet.
+func (t *TrackedTx) pending() []*resendAttempt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pending []*resendAttempt
+	for _, a := range t.attempts {
+		if !a.settled {
+			pending = append(pending, a)
+		}
+	}
+	return pending
+}
+
+func (r *Resender) loop() {
+	defer r.wg.Done()
+
+	heads := make(chan HeadEvent, 1)
+	sub := r.ec.TrackHeads(r.groupId).Subscribe(heads)
+	defer sub.Unsubscribe()
+	ticker := time.NewTicker(resendCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-heads:
+			if ev.GroupId != r.groupId {
+				continue
+			}
+		case <-ticker.C:
+		case <-r.wake:
+		case <-r.quit:
+			r.finishAll(ErrResenderStopped)
+			return
+		case <-r.ec.closeCtx.Done():
+			r.finishAll(ErrClientClosed)
+			return
+		}
+		r.mu.Lock()
+		tracked := make([]*TrackedTx, 0, len(r.tracked))
+		for t := range r.tracked {
+			tracked = append(tracked, t)
+		}
+		r.mu.Unlock()
+
+		for _, t := range tracked {
+			if r.check(t) {
+				r.mu.Lock()
+				delete(r.tracked, t)
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+// finishAll ends the tracked transactions with err, and those tracked later
+// with ErrResenderStopped.
+func (r *Resender) finishAll(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for t := range r.tracked {
+		t.finish(err)
+	}
+	r.tracked = nil
+}
+
+// check looks for the receipts of the pending attempts of a transaction, and
+// sends a new attempt if all of them expired without one. It reports whether
+// the transaction is settled.
+func (r *Resender) check(t *TrackedTx) bool {
+	ctx := fiscobcos.ContextWithGroup(r.ec.closeCtx, r.groupId)
+
+	// The head is read before the receipts: once it passed the block limit of
+	// an attempt, the attempt's receipt is known if it was committed.
+	head, known := r.ec.TrackHeads().Current(r.groupId)
+	for _, a := range t.pending() {
+		receipt, err := r.ec.TransactionReceipt(ctx, r.groupId, a.tx.Hash())
+		switch {
+		case err == nil && receipt != nil:
+			t.mu.Lock()
+			a.settled = true
+			t.receipts = append(t.receipts, receipt)
+			t.mu.Unlock()
+		case err != nil && err != fiscobcos.NotFound:
+			log.Debug("Failed to fetch receipt of tracked transaction", "hash", a.tx.Hash(), "err", err)
+		case known && a.tx.BlockLimit().Cmp(new(big.Int).SetUint64(head)) < 0:
+			t.mu.Lock()
+			a.settled = true
+			t.mu.Unlock()
+		}
+	}
+	if len(t.pending()) > 0 {
+		return false
+	}
+	t.mu.Lock()
+	committed, attempts := len(t.receipts) > 0, len(t.attempts)
+	last := t.attempts[len(t.attempts)-1].tx
+	t.mu.Unlock()
+
+	r.mu.Lock()
+	maxAttempts := r.maxAttempts
+	r.mu.Unlock()
+	switch {
+	case committed:
+		t.finish(nil)
+		return true
+	case attempts >= maxAttempts:
+		t.finish(ErrResendLimit)
+		return true
+	}
+	if err := r.resend(ctx, t, last); err != nil {
+		t.finish(err)
+		return true
+	}
+	return false
+}
+
+// resend sends a new attempt of a transaction whose attempts all expired. It
+// returns an error only if the transaction can't be sent at all.
+func (r *Resender) resend(ctx context.Context, t *TrackedTx, last *types.Transaction) error {
+	limit, err := r.ec.GetBlockLimit(ctx, r.groupId)
+	if err != nil {
+		log.Debug("Failed to get block limit for resending", "hash", last.Hash(), "err", err)
+		return nil
+	}
+	tx, err := r.sign(last.Renew(nil, limit))
+	if err != nil {
+		return err
+	}
+	a := &resendAttempt{tx: tx}
+	t.mu.Lock()
+	t.attempts = append(t.attempts, a)
+	t.mu.Unlock()
+
+	log.Info("Resending expired transaction", "hash", last.Hash(), "new", tx.Hash(), "blockLimit", limit)
+	err = r.ec.SendTransaction(ctx, tx)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); !ok {
+		// The node may have taken the transaction, it expires if it didn't.
+		log.Debug("Failed to resend transaction", "hash", tx.Hash(), "err", err)
+		return nil
+	}
+	// Rejected by the node, the attempt won't be committed.
+	t.mu.Lock()
+	a.settled = true
+	t.mu.Unlock()
+	if !errclass.IsRetryable(err) {
+		return err
+	}
+	log.Debug("Resent transaction rejected, retrying", "hash", tx.Hash(), "err", err)
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// committedTxs answers getTransactionReceipt for the transactions committed.
+type committedTxs struct {
+	mu   sync.Mutex
+	txs  map[common.Hash]uint64 // block numbers
+	fail bool                   // whether receipt requests fail
+}
+
+func (c *committedTxs) serve(node *ethclienttest.FakeNode) {
+	node.Handle("getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+		var hash common.Hash
+		if err := json.Unmarshal(params[1], &hash); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.fail {
+			return nil, &ethclienttest.Error{Code: -32603, Message: "internal error"}
+		}
+		number, ok := c.txs[hash]
+		if !ok {
+			return nil, nil
+		}
+		return &types.Receipt{TxHash: hash, BlockNumber: number, Status: "0x0", Logs: []*types.Log{}}, nil
+	})
+}
+
+func (c *committedTxs) setFail(fail bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail = fail
+}
+
+func (c *committedTxs) commit(hash common.Hash, number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.txs[hash] = number
+}
+
+func TestResender(t *testing.T) {
+	errSign := errors.New("no key")
+	tests := []struct {
+		name        string
+		maxAttempts int
+		commit      int   // attempt committed, 0 for none
+		rejectCode  int   // error code resent transactions are rejected with
+		signErr     error // of the signer
+		attempts    int   // made in the end
+		err         error // ending tracking, nil if committed
+		errCode     int   // of the *ethclient.Error ending tracking
+	}{
+		{name: "committed", commit: 1, attempts: 1},
+		{name: "resent once", commit: 2, attempts: 2},
+		{name: "resent twice", commit: 3, attempts: 3},
+		{name: "limit", maxAttempts: 3, attempts: 3, err: ethclient.ErrResendLimit},
+		{name: "default limit", attempts: 5, err: ethclient.ErrResendLimit},
+		{name: "rejected", rejectCode: 0x0f, attempts: 2, errCode: 0x0f},
+		{name: "pool full", maxAttempts: 3, rejectCode: 0x1c, attempts: 3, err: ethclient.ErrResendLimit},
+		{name: "signer fails", signErr: errSign, attempts: 1, err: errSign},
+	}
+	key, _ := crypto.GenerateKey()
+	signer := types.NewChainSigner(types.ChainModeStandard)
+
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		heads := &groupHeads{numbers: map[uint64]uint64{1: 590}}
+		heads.serve(node)
+		committed := &committedTxs{txs: make(map[common.Hash]uint64)}
+		committed.serve(node)
+		if test.rejectCode != 0 {
+			node.RespondError("sendRawTransaction", test.rejectCode, "rejected")
+		} else {
+			node.Respond("sendRawTransaction", common.Hash{}.Hex())
+		}
+		client := node.ChannelClient()
+		client.SetBlockLimitOffset(10)
+
+		r := client.NewResender(1, func(tx *types.Transaction) (*types.Transaction, error) {
+			if test.signErr != nil {
+				return nil, test.signErr
+			}
+			return types.SignTx(tx, signer, key)
+		})
+		r.SetMaxAttempts(test.maxAttempts)
+		tracked := r.Track(newGroupTx(1)) // block limit 600
+
+		// Let every attempt expire, but the one to be committed.
+		head := uint64(590)
+		for step := 0; step < 10; step++ {
+			attempts := tracked.Attempts()
+			last := attempts[len(attempts)-1]
+			if len(attempts) == test.commit {
+				committed.commit(last.Hash(), head+1)
+				head++
+			} else {
+				head = last.BlockLimit().Uint64() + 1
+			}
+			heads.set(1, head)
+			node.PushBlockNumber(1, head)
+
+			select {
+			case <-tracked.Done():
+			case <-time.After(500 * time.Millisecond):
+				continue
+			}
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		receipt, err := tracked.Wait(ctx)
+		cancel()
+		attempts := tracked.Attempts()
+		switch {
+		case test.errCode != 0:
+			if e, ok := err.(*ethclient.Error); !ok || e.Code != test.errCode {
+				t.Errorf("%s: got error %v, want code %d", test.name, err, test.errCode)
+			}
+		case err != test.err:
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		case err == nil && (receipt.TxHash != attempts[test.commit-1].Hash() || len(tracked.Receipts()) != 1):
+			t.Errorf("%s: got receipt of %x, %d receipts; want attempt %d", test.name, receipt.TxHash, len(tracked.Receipts()), test.commit)
+		}
+		if len(attempts) != test.attempts {
+			t.Errorf("%s: made %d attempts, want %d", test.name, len(attempts), test.attempts)
+		}
+		if sent := len(node.CallsTo("sendRawTransaction")); sent != len(attempts)-1 {
+			t.Errorf("%s: sent %d transactions for %d attempts", test.name, sent, len(attempts))
+		}
+		for i := 1; i < len(attempts); i++ {
+			prev, tx := attempts[i-1], attempts[i]
+			if tx.Hash() == prev.Hash() || tx.RandomId().Cmp(prev.RandomId()) == 0 {
+				t.Errorf("%s: attempt %d reuses the nonce of the one before", test.name, i+1)
+			}
+			if want := prev.BlockLimit().Uint64() + 1 + 10; tx.BlockLimit().Uint64() != want {
+				t.Errorf("%s: attempt %d has block limit %v, want %d", test.name, i+1, tx.BlockLimit(), want)
+			}
+			if from, err := types.Sender(signer, tx); err != nil || from != crypto.PubkeyToAddress(key.PublicKey) {
+				t.Errorf("%s: attempt %d signed by %x, %v", test.name, i+1, from, err)
+			}
+		}
+		r.Stop()
+		node.Close()
+	}
+}
+
+// TestResenderReceiptFailure checks that an attempt isn't given up while its
+// receipt can't be fetched, even past its block limit.
+func TestResenderReceiptFailure(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	heads := &groupHeads{numbers: map[uint64]uint64{1: 590}}
+	heads.serve(node)
+	committed := &committedTxs{txs: make(map[common.Hash]uint64), fail: true}
+	committed.serve(node)
+	node.Respond("sendRawTransaction", common.Hash{}.Hex())
+	client := node.ChannelClient()
+
+	r := client.NewResender(1, func(tx *types.Transaction) (*types.Transaction, error) { return tx, nil })
+	defer r.Stop()
+	tx := newGroupTx(1)
+	tracked := r.Track(tx)
+	for _, head := range []uint64{601, 602, 603} {
+		heads.set(1, head)
+		node.PushBlockNumber(1, head)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if attempts := tracked.Attempts(); len(attempts) != 1 {
+		t.Fatalf("made %d attempts while receipts fail, want 1", len(attempts))
+	}
+
+	// The delayed transaction turns out committed.
+	committed.commit(tx.Hash(), 601)
+	committed.setFail(false)
+	node.PushBlockNumber(1, 604)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if receipt, err := tracked.Wait(ctx); err != nil || receipt.TxHash != tx.Hash() {
+		t.Errorf("got receipt %v, error %v; want the one of the original", receipt, err)
+	}
+	if sent := len(node.CallsTo("sendRawTransaction")); sent != 0 {
+		t.Errorf("resent %d times", sent)
+	}
+}
+
+// TestResenderStop checks that the transactions still tracked end when the
+// resender is stopped or the client closed.
+func TestResenderStop(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	heads := &groupHeads{numbers: map[uint64]uint64{1: 590}}
+	heads.serve(node)
+	(&committedTxs{txs: make(map[common.Hash]uint64)}).serve(node)
+	client := node.ChannelClient()
+	sign := func(tx *types.Transaction) (*types.Transaction, error) { return tx, nil }
+
+	r := client.NewResender(1, sign)
+	tracked := r.Track(newGroupTx(1))
+	r.Stop()
+	if _, err := tracked.Wait(context.Background()); err != ethclient.ErrResenderStopped {
+		t.Errorf("tracked before stopping: got error %v, want ErrResenderStopped", err)
+	}
+	if _, err := r.Track(newGroupTx(1)).Wait(context.Background()); err != ethclient.ErrResenderStopped {
+		t.Errorf("tracked after stopping: got error %v, want ErrResenderStopped", err)
+	}
+	r.Stop()
+
+	r = client.NewResender(1, sign)
+	defer r.Stop()
+	tracked = r.Track(newGroupTx(1))
+	client.Close()
+	if _, err := tracked.Wait(context.Background()); err != ethclient.ErrClientClosed {
+		t.Errorf("client closed: got error %v, want ErrClientClosed", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// fakeResolver answers lookups from its maps, failing for unknown names.
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	srvs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name}
+	}
+	return name, srvs, nil
+}
+
+func (r *fakeResolver) setSRV(name string, srvs ...*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.srvs[name] = srvs
+}
+
+func TestLookupNodes(t *testing.T) {
+	r := &fakeResolver{
+		hosts: map[string][]string{
+			"nodes.test": {"10.0.0.1", "10.0.0.2"},
+			"v6.test":    {"2001:db8::1"},
+			"a.test":     {"10.0.1.1"},
+			"b.test":     {"10.0.2.1", "10.0.2.2"},
+			"none.test":  {},
+		},
+		srvs: map[string][]*net.SRV{
+			"_rpc._tcp.nodes.test": {{Target: "a.test.", Port: 8545}, {Target: "b.test.", Port: 8546}},
+			"_rpc._tcp.down.test":  {{Target: "missing.test.", Port: 8545}},
+		},
+	}
+	tests := []struct {
+		url  string
+		want []string // nil if the lookup fails
+	}{
+		{"http://127.0.0.1:8545", []string{"http://127.0.0.1:8545"}},
+		{"[2001:db8::2]:20200", []string{"[2001:db8::2]:20200"}},
+		{"http://nodes.test:8545", []string{"http://10.0.0.1:8545", "http://10.0.0.2:8545"}},
+		{"https://nodes.test/rpc", []string{"https://10.0.0.1/rpc", "https://10.0.0.2/rpc"}},
+		{"nodes.test:20200", []string{"10.0.0.1:20200", "10.0.0.2:20200"}},
+		{"channel://nodes.test:20200", []string{"channel://10.0.0.1:20200", "channel://10.0.0.2:20200"}},
+		{"v6.test:20200", []string{"[2001:db8::1]:20200"}},
+		{"http://v6.test", []string{"http://[2001:db8::1]"}},
+		{"http://_rpc._tcp.nodes.test", []string{"http://10.0.1.1:8545", "http://10.0.2.1:8546", "http://10.0.2.2:8546"}},
+		{"_rpc._tcp.nodes.test:1", []string{"10.0.1.1:8545", "10.0.2.1:8546", "10.0.2.2:8546"}},
+		{"http://unknown.test:8545", nil},
+		{"http://none.test:8545", nil},
+		{"http://_rpc._tcp.unknown.test", nil},
+		{"http://_rpc._tcp.down.test", nil},
+		{"2001:db8::1:8545", nil},
+	}
+	for _, test := range tests {
+		urls, err := ethclient.LookupNodes(context.Background(), r, test.url)
+		switch {
+		case test.want == nil && err == nil:
+			t.Errorf("%s: resolved to %v, want an error", test.url, urls)
+		case test.want != nil && err != nil:
+			t.Errorf("%s: %v", test.url, err)
+		case test.want != nil && !reflect.DeepEqual(urls, test.want):
+			t.Errorf("%s: resolved to %v, want %v", test.url, urls, test.want)
+		}
+	}
+}
+
+// TestDialPoolResolver checks that a pool adds a node for every address its
+// host names resolve to, and stops using those no longer resolved.
+func TestDialPoolResolver(t *testing.T) {
+	var (
+		nodes = []*ethclienttest.FakeNode{ethclienttest.NewFakeNode(t), ethclienttest.NewFakeNode(t)}
+		srvs  []*net.SRV
+	)
+	for _, node := range nodes {
+		defer node.Close()
+		node.Respond("getBlockNumber", "0x10")
+		u, _ := url.Parse(node.URL())
+		port, _ := strconv.Atoi(u.Port())
+		srvs = append(srvs, &net.SRV{Target: "localhost.test.", Port: uint16(port)})
+	}
+	r := &fakeResolver{
+		hosts: map[string][]string{"localhost.test": {"127.0.0.1"}},
+		srvs:  map[string][]*net.SRV{"_rpc._tcp.nodes.test": srvs},
+	}
+	client, err := ethclient.DialPool([]string{"http://_rpc._tcp.nodes.test"}, ethclient.WithResolver(r), ethclient.WithProbeInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("DialPool error: %v", err)
+	}
+	defer client.Close()
+
+	// served reports which nodes serve read calls, after the probes caught up
+	// with the resolver.
+	served := func(want ...bool) {
+		t.Helper()
+		var have []bool
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			time.Sleep(30 * time.Millisecond)
+			for _, node := range nodes {
+				node.Reset()
+			}
+			for i := 0; i < 4; i++ {
+				if _, err := client.TotalTransactionCount(context.Background(), 1); err != nil {
+					t.Fatalf("TotalTransactionCount error: %v", err)
+				}
+			}
+			have = have[:0]
+			for _, node := range nodes {
+				have = append(have, len(node.CallsTo("getTotalTransactionCount")) > 0)
+			}
+			if reflect.DeepEqual(have, want) {
+				return
+			}
+		}
+		t.Fatalf("nodes serving calls: %v, want %v", have, want)
+	}
+	for _, node := range nodes {
+		node.Respond("getTotalTransactionCount", map[string]string{"txSum": "0x1", "blockNumber": "0x10"})
+	}
+	served(true, true)
+
+	r.setSRV("_rpc._tcp.nodes.test", srvs[0])
+	served(true, false)
+
+	r.setSRV("_rpc._tcp.nodes.test", srvs...)
+	served(true, true)
+
+	// A failing lookup keeps the known nodes.
+	r.setSRV("_rpc._tcp.nodes.test")
+	served(true, true)
+}
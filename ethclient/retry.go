@@ -0,0 +1,170 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+// RetryPolicy decides whether a failed call is repeated. Only calls which are
+// safe to repeat are passed to it: reads, and transactions which certainly
+// never left the client.
+type RetryPolicy interface {
+	// Retry returns how long to wait before repeating method after its
+	// attempt'th (zero based) failure with err, or false to give up.
+	Retry(method string, attempt int, err error) (time.Duration, bool)
+}
+
+// BackoffPolicy is a RetryPolicy retrying with exponential backoff and jitter.
+type BackoffPolicy struct {
+	MaxRetries int           // retries after the first attempt
+	BaseDelay  time.Duration // delay before the first retry
+	MaxDelay   time.Duration // cap of the delay
+
+	// Retriable reports whether a call failing with err may succeed later. If
+	// nil, errclass.IsRetryable decides, covering transport failures and node
+	// errors like a full transaction pool.
+	Retriable func(err error) bool
+}
+
+// DefaultRetryPolicy retries three times, waiting up to 100ms, 200ms and 400ms.
+var DefaultRetryPolicy RetryPolicy = &BackoffPolicy{
+	MaxRetries: 3,
+	BaseDelay:  100 * time.Millisecond,
+	MaxDelay:   2 * time.Second,
+}
+
+// Retry implements RetryPolicy.
+func (p *BackoffPolicy) Retry(method string, attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxRetries {
+		return 0, false
+	}
+	retriable := p.Retriable
+	if retriable == nil {
+		retriable = errclass.IsRetryable
+	}
+	if !retriable(err) {
+		return 0, false
+	}
+	delay, _ := errclass.Backoff(context.Background(), attempt, p.BaseDelay, p.MaxDelay)
+	if delay <= 0 {
+		return 0, true
+	}
+	// Full jitter spreads out the retries of clients failing at the same time.
+	return time.Duration(rand.Int63n(int64(delay)) + 1), true
+}
+
+// WithRetry makes the client repeat failed calls as the policy decides. Reads
+// (the get* methods and call) are repeated on any error the policy accepts,
+// sendRawTransaction only if the connection to the node couldn't be set up or
+// the node turned the transaction away unseen, like with a full transaction
+// pool, as the transaction may have been broadcast otherwise. Other methods, like the
+// group operations, are never repeated. Retries stop when the call's context
+// is done or the client is closed.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(cfg *dialConfig) { cfg.retry = policy }
+}
+
+// retryDelay returns how long to wait before repeating a failed call, or false
+// if it must not be repeated.
+func (ec *Client) retryDelay(ctx context.Context, method string, attempt int, err error) (time.Duration, bool) {
+	if ec.retry == nil || ctx.Err() != nil || ec.closed() {
+		return 0, false
+	}
+	switch {
+	case idempotent(method):
+	case method == "sendRawTransaction" && (isDialError(err) || isTurnedAway(err)):
+	default:
+		return 0, false
+	}
+	delay, ok := ec.retry.Retry(method, attempt, err)
+	if !ok {
+		return 0, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+// idempotent reports whether a method only reads from the node.
+func idempotent(method string) bool {
+	return strings.HasPrefix(method, "get") || method == "call"
+}
+
+// isTurnedAway reports whether err means the node refused a transaction before
+// importing it, so that sending the same payload again is safe. Rejections like
+// ErrNonceCheckFail or ErrTxAlreadyKnown are not: the transaction, or one with
+// its nonce, is known to the node already.
+func isTurnedAway(err error) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	switch e.Err {
+	case ErrTxPoolIsFull, ErrOverQPSLimit, ErrOverGroupMemoryLimit:
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether err means the connection to the node couldn't be
+// established, so that the request was never sent.
+func isDialError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	operr, ok := err.(*net.OpError)
+	return ok && operr.Op == "dial"
+}
+
+// callWithRetry performs a call, repeating it as the retry policy allows.
+// Retries are reported to the metrics of the client.
+func (ec *Client) callWithRetry(ctx context.Context, method string, args []interface{}, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil {
+			return nil
+		}
+		delay, ok := ec.retryDelay(ctx, method, attempt, err)
+		if !ok {
+			return err
+		}
+		ec.c.Metrics().ObserveRetry(method, rpc.RequestGroup(args), err)
+		log.Debug("Retrying failed call", "method", method, "attempt", attempt+1, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-ec.closeCtx.Done():
+			timer.Stop()
+			return ErrClientClosed
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/event"
+	"github.com/chislab/go-fiscobcos/log"
+	"github.com/chislab/go-fiscobcos/rpc"
+	"github.com/chislab/go-fiscobcos/rpc/errclass"
+)
+
+// ErrSubscriptionUnsupported is returned by the subscription methods if the client
+// is not connected through a transport the node can push notifications on, e.g.
+// plain HTTP.
+var ErrSubscriptionUnsupported = errors.New("subscriptions require the channel transport")
+
+// ErrSubscriptionOverflow ends a log subscription whose consumer fell behind the
+// node's pushes, see SubscribeFilterLogs.
+var ErrSubscriptionOverflow = errors.New("subscription consumer too slow, pushed logs overflowed")
+
+const (
+	// unregisterTimeout bounds the time spent cancelling a node-side registration
+	// when a subscription is torn down, or renewing it after a reconnect.
+	unregisterTimeout = 5 * time.Second
+
+	// headerRetryDelay is the initial wait of SubscribeNewBlocks before it
+	// fetches a header again, doubling up to headerMaxRetryDelay.
+	headerRetryDelay    = 200 * time.Millisecond
+	headerMaxRetryDelay = 5 * time.Second
+
+	// eventLogPushBuffer is the number of event log pushes SubscribeFilterLogs
+	// buffers for a slow consumer.
+	eventLogPushBuffer = 64
+)
+
+// Result codes of event log registrations and pushes.
+const (
+	eventLogSuccess       = 0
+	eventLogPushCompleted = 1
+)
+
+// eventLogParams is the filter registered with the node through the channel protocol.
+type eventLogParams struct {
+	FromBlock string           `json:"fromBlock"`
+	ToBlock   string           `json:"toBlock"`
+	Addresses []common.Address `json:"addresses"`
+	Topics    [][]common.Hash  `json:"topics"`
+	GroupID   string           `json:"groupID"`
+	FilterID  string           `json:"filterID"`
+}
+
+// eventLogPush is a registration response or a batch of logs pushed by the node.
+type eventLogPush struct {
+	FilterID string       `json:"filterID"`
+	Result   int          `json:"result"`
+	Logs     []*types.Log `json:"logs"`
+}
+
+// SubscribeFilterLogs subscribes to the results of a streaming filter query. The
+// filter is registered with the node, which pushes matching logs as blocks are
+// committed. Unsubscribing cancels the registration. If ToBlock is set the
+// subscription ends once the node has pushed all logs up to that block. Closing
+// the client ends the subscription too, closing its error channel.
+//
+// Pushes are buffered while the logs of earlier ones are delivered. If the
+// consumer falls so far behind that the buffer fills up, the registration is
+// cancelled and the subscription ends with ErrSubscriptionOverflow rather than
+// stalling the notifications of the other subscriptions of the client.
+//
+// The group is resolved as by FilterLogs, and invalid queries fail with
+// *ValidationError. Subscriptions need the channel transport,
+// ErrSubscriptionUnsupported is returned on other transports. Consumers in the
+// same process that want the same logs can share a single subscription through
+// event.FanOut.
+func (ec *Client) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
+	groupId := ec.group(ctx, q.GroupId)
+	if err := ec.validateFilterQuery("SubscribeFilterLogs", groupId, q); err != nil {
+		return nil, err
+	}
+	seq := rpc.NewMsgSeq()
+	params := eventLogParams{
+		FromBlock: "latest",
+		ToBlock:   "latest",
+		Addresses: q.Addresses,
+		Topics:    q.Topics,
+		GroupID:   strconv.FormatUint(groupId, 10),
+		FilterID:  hex.EncodeToString(seq[:]),
+	}
+	if !isLatestBlock(q.FromBlock) {
+		params.FromBlock = q.FromBlock.String()
+	}
+	if !isLatestBlock(q.ToBlock) {
+		params.ToBlock = q.ToBlock.String()
+	}
+	if params.Addresses == nil {
+		params.Addresses = []common.Address{}
+	}
+	if params.Topics == nil {
+		params.Topics = [][]common.Hash{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	// Start listening before registering, the first push may follow the
+	// registration response immediately.
+	// The listener runs on the goroutine delivering all pushes of the
+	// connection, it must not block.
+	var (
+		pushes       = make(chan *eventLogPush, eventLogPushBuffer)
+		overflow     = make(chan struct{})
+		overflowOnce sync.Once
+	)
+	cancel, err := ec.c.ChannelListen(rpc.TYPE_EVENT_LOG_PUSH, func(body []byte) {
+		push := new(eventLogPush)
+		if err := json.Unmarshal(body, push); err != nil || push.FilterID != params.FilterID {
+			return
+		}
+		select {
+		case pushes <- push:
+		default:
+			overflowOnce.Do(func() { close(overflow) })
+		}
+	})
+	if err == rpc.ErrNotificationsUnsupported {
+		return nil, ErrSubscriptionUnsupported
+	} else if err != nil {
+		return nil, err
+	}
+	if err := ec.registerEventLog(ctx, rpc.TYPE_EVENT_LOG_REGISTER, body); err != nil {
+		cancel()
+		return nil, err
+	}
+	// A new connection knows nothing about the filter, register it again.
+	// Logs emitted while the connection was down are not replayed.
+	stopReregister := ec.c.OnReconnect(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+		defer cancel()
+		if err := ec.registerEventLog(ctx, rpc.TYPE_EVENT_LOG_REGISTER, body); err != nil {
+			log.Warn("Failed to register event log filter after reconnect", "filter", params.FilterID, "err", err)
+		}
+	})
+	return event.NewSubscription(func(unsub <-chan struct{}) error {
+		defer func() {
+			stopReregister()
+			cancel()
+		}()
+		for {
+			select {
+			case push := <-pushes:
+				for _, log := range push.Logs {
+					select {
+					case ch <- *log:
+					case <-unsub:
+						return ec.unregisterEventLog(body)
+					case <-overflow:
+						ec.unregisterEventLog(body)
+						return ErrSubscriptionOverflow
+					case <-ec.closeCtx.Done():
+						return nil
+					}
+				}
+				switch push.Result {
+				case eventLogSuccess:
+				case eventLogPushCompleted:
+					return nil
+				default:
+					return fmt.Errorf("event log push failed with result %d", push.Result)
+				}
+			case <-unsub:
+				return ec.unregisterEventLog(body)
+			case <-overflow:
+				ec.unregisterEventLog(body)
+				return ErrSubscriptionOverflow
+			case <-ec.closeCtx.Done():
+				return nil
+			}
+		}
+	}), nil
+}
+
+// OnReconnect registers fn to be called after the client re-established its
+// channel connection, see rpc.Client.OnReconnect. Subscriptions are restored
+// before, event log filters with the query they were made with. The returned
+// function removes the registration.
+func (ec *Client) OnReconnect(fn func()) (cancel func()) {
+	return ec.c.OnReconnect(fn)
+}
+
+// registerEventLog sends an event log (un)registration and checks the result
+// reported by the node.
+func (ec *Client) registerEventLog(ctx context.Context, typ rpc.ChannelPack, body []byte) error {
+	reply, err := ec.c.ChannelRequest(ctx, typ, body)
+	if err != nil {
+		return err
+	}
+	var resp eventLogPush
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return err
+	}
+	if resp.Result != eventLogSuccess {
+		return fmt.Errorf("event log registration failed with result %d", resp.Result)
+	}
+	return nil
+}
+
+// newBlockHeader fetches the header of a block announced to SubscribeNewBlocks.
+// Transient failures are retried with backoff, as is the block not being found,
+// a node may announce a block before serving it. The header is nil, without
+// error, if unsub, ctx or closing the client ends the wait.
+func (ec *Client) newBlockHeader(ctx context.Context, unsub <-chan struct{}, groupId, number uint64) (*types.BlockHeader, error) {
+	for attempt := 0; ; attempt++ {
+		header, err := ec.HeaderByNumber(ctx, groupId, new(big.Int).SetUint64(number))
+		if err == nil {
+			return header, nil
+		}
+		if ctx.Err() != nil || ec.closed() {
+			return nil, nil
+		}
+		if err != fiscobcos.NotFound && !errclass.IsRetryable(err) {
+			return nil, err
+		}
+		delay, _ := errclass.Backoff(ctx, attempt, headerRetryDelay, headerMaxRetryDelay)
+		log.Warn("Fetching new block header failed, retrying", "group", groupId, "number", number, "attempt", attempt+1, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-unsub:
+			timer.Stop()
+			return nil, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		case <-ec.closeCtx.Done():
+			timer.Stop()
+			return nil, nil
+		}
+	}
+}
+
+// unregisterEventLog cancels a filter registration on a best effort basis. Nodes
+// before 2.7 don't know about unregistration and simply stop pushing when the
+// connection goes away, so errors are not reported.
+func (ec *Client) unregisterEventLog(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	ec.registerEventLog(ctx, rpc.TYPE_EVENT_LOG_UNREGISTER, body)
+	return nil
+}
+
+// SubscribeNewBlocks subscribes to notifications about the blocks committed in a
+// group. The node only pushes block numbers, the headers are fetched before they
+// are delivered. Fetches failing with a transient error, see errclass.IsRetryable,
+// are retried, other errors end the subscription. The subscription is
+// re-registered if the client reconnects and ends, closing its error channel,
+// when ctx is cancelled or the client is closed.
+//
+// Notifications arriving while a header is fetched or waits for the consumer
+// are coalesced, only the newest block is delivered next. A slow consumer thus
+// skips blocks but always gets the head of the chain.
+//
+// Subscriptions need the channel transport, ErrSubscriptionUnsupported is returned
+// on other transports. Consumers in the same process that want the same blocks
+// can share a single subscription through event.FanOut.
+func (ec *Client) SubscribeNewBlocks(ctx context.Context, groupId uint64, ch chan<- *types.BlockHeader) (fiscobcos.Subscription, error) {
+	groupId = ec.group(ctx, groupId)
+
+	// The listener runs on the goroutine delivering all pushes of the
+	// connection, it must not block. Numbers not taken yet are replaced by
+	// newer ones.
+	numbers := make(chan uint64, 1)
+	cancel, err := ec.c.ListenBlockNumber(groupId, func(number uint64) {
+		for {
+			select {
+			case numbers <- number:
+				return
+			default:
+			}
+			select {
+			case pending := <-numbers:
+				if pending > number {
+					number = pending
+				}
+			default:
+			}
+		}
+	})
+	if err == rpc.ErrNotificationsUnsupported {
+		return nil, ErrSubscriptionUnsupported
+	} else if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(unsub <-chan struct{}) (err error) {
+		defer func() {
+			cancel()
+			if ec.closed() {
+				// Fetching the header failed because of Close, not an error.
+				err = nil
+			}
+		}()
+		var last uint64
+		for {
+			select {
+			case number := <-numbers:
+				// Notifications may be repeated after a reconnect, skip the
+				// blocks which have been delivered already.
+				if number <= last && last != 0 {
+					continue
+				}
+				header, err := ec.newBlockHeader(ctx, unsub, groupId, number)
+				if err != nil || header == nil {
+					return err
+				}
+				last = number
+				select {
+				case ch <- header:
+				case <-unsub:
+					return nil
+				case <-ctx.Done():
+					return nil
+				case <-ec.closeCtx.Done():
+					return nil
+				}
+			case <-unsub:
+				return nil
+			case <-ctx.Done():
+				return nil
+			case <-ec.closeCtx.Done():
+				return nil
+			}
+		}
+	}), nil
+}
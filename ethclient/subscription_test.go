@@ -0,0 +1,335 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// failingHeaders answers getBlockByNumber with the given errors, one per request,
+// and with a header once they are used up.
+func failingHeaders(node *ethclienttest.FakeNode, failures ...error) {
+	var mu sync.Mutex
+	node.Handle("getBlockByNumber", func(params []json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(failures) > 0 {
+			err := failures[0]
+			failures = failures[1:]
+			return nil, err
+		}
+		var number string
+		json.Unmarshal(params[1], &number)
+		return &types.BlockHeader{Number: number, Hash: "0x01"}, nil
+	})
+}
+
+func TestSubscribeNewBlocksRetries(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	failingHeaders(node,
+		&ethclienttest.Error{Code: -32603, Message: "internal error"},
+		&ethclienttest.Error{Code: -40011, Message: "over QPS limit"},
+		nil, // a null result, the node not serving the block yet
+	)
+	client := node.ChannelClient()
+
+	headers := make(chan *types.BlockHeader)
+	sub, err := client.SubscribeNewBlocks(context.Background(), 1, headers)
+	if err != nil {
+		t.Fatalf("SubscribeNewBlocks error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	node.PushBlockNumber(1, 7)
+
+	select {
+	case header := <-headers:
+		if header.Number != hexutil.EncodeUint64(7) {
+			t.Fatalf("got header of block %s, want 7", header.Number)
+		}
+	case err := <-sub.Err():
+		t.Fatalf("subscription ended: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no header delivered")
+	}
+	if n := len(node.CallsTo("getBlockByNumber")); n != 4 {
+		t.Errorf("fetched the header %d times, want 4", n)
+	}
+}
+
+func TestSubscribeNewBlocksFatalError(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	failingHeaders(node, &ethclienttest.Error{Code: -40009, Message: "don't send requests to this group"})
+	client := node.ChannelClient()
+
+	headers := make(chan *types.BlockHeader)
+	sub, err := client.SubscribeNewBlocks(context.Background(), 1, headers)
+	if err != nil {
+		t.Fatalf("SubscribeNewBlocks error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	node.PushBlockNumber(1, 7)
+
+	select {
+	case header := <-headers:
+		t.Fatalf("got header %v, want the subscription to end", header)
+	case err := <-sub.Err():
+		if rpcErr, ok := err.(*ethclient.Error); !ok || rpcErr.Code != -40009 {
+			t.Fatalf("subscription ended with %v, want the node's error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("subscription didn't end")
+	}
+}
+
+// TestSubscribeFilterLogsBlockTags checks that the block tags are registered
+// with the node as "latest".
+func TestSubscribeFilterLogsBlockTags(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_REGISTER, []byte(`{"result":0}`))
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_UNREGISTER, []byte(`{"result":0}`))
+	client := node.ChannelClient()
+
+	tests := []struct {
+		from, to         *big.Int
+		wantFrom, wantTo string
+	}{
+		{wantFrom: "latest", wantTo: "latest"},
+		{from: big.NewInt(ethclient.LatestBlock), to: big.NewInt(ethclient.PendingBlock), wantFrom: "latest", wantTo: "latest"},
+		{from: big.NewInt(5), to: big.NewInt(ethclient.LatestBlock), wantFrom: "5", wantTo: "latest"},
+		{from: big.NewInt(ethclient.PendingBlock), to: big.NewInt(9), wantFrom: "latest", wantTo: "9"},
+	}
+	for i, test := range tests {
+		sub, err := client.SubscribeFilterLogs(context.Background(), fiscobcos.FilterQuery{FromBlock: test.from, ToBlock: test.to}, make(chan types.Log))
+		if err != nil {
+			t.Fatalf("%d: SubscribeFilterLogs error: %v", i, err)
+		}
+		sub.Unsubscribe()
+
+		var params struct{ FromBlock, ToBlock string }
+		frames := node.Frames()
+		for j := len(frames) - 1; j >= 0; j-- {
+			if frames[j].Type == rpc.TYPE_EVENT_LOG_REGISTER {
+				json.Unmarshal(frames[j].Payload, &params)
+				break
+			}
+		}
+		if params.FromBlock != test.wantFrom || params.ToBlock != test.wantTo {
+			t.Errorf("%d: registered blocks %q to %q, want %q to %q", i, params.FromBlock, params.ToBlock, test.wantFrom, test.wantTo)
+		}
+	}
+}
+
+// registeredFilters returns the IDs of the event log filters registered with
+// the node, in order.
+func registeredFilters(node *ethclienttest.FakeNode) []string {
+	var ids []string
+	for _, frame := range node.Frames() {
+		if frame.Type == rpc.TYPE_EVENT_LOG_REGISTER {
+			var params struct{ FilterID string }
+			json.Unmarshal(frame.Payload, &params)
+			ids = append(ids, params.FilterID)
+		}
+	}
+	return ids
+}
+
+// pushLogs pushes logs numbered from..to-1 to an event log filter.
+func pushLogs(t *testing.T, node *ethclienttest.FakeNode, filterID string, result int, from, to uint64) {
+	t.Helper()
+	push := struct {
+		FilterID string       `json:"filterID"`
+		Result   int          `json:"result"`
+		Logs     []*types.Log `json:"logs"`
+	}{FilterID: filterID, Result: result, Logs: []*types.Log{}}
+	for n := from; n < to; n++ {
+		push.Logs = append(push.Logs, &types.Log{BlockNumber: n, Topics: []common.Hash{}, Data: []byte{}})
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Push(rpc.TYPE_EVENT_LOG_PUSH, body)
+}
+
+func TestSubscribeFilterLogs(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_REGISTER, []byte(`{"result":0}`))
+	client := node.ChannelClient()
+
+	if _, err := node.Client().SubscribeFilterLogs(context.Background(), fiscobcos.FilterQuery{}, make(chan types.Log)); err != ethclient.ErrSubscriptionUnsupported {
+		t.Fatalf("subscribing over HTTP: error %v, want %v", err, ethclient.ErrSubscriptionUnsupported)
+	}
+
+	logs := make(chan types.Log)
+	sub, err := client.SubscribeFilterLogs(context.Background(), fiscobcos.FilterQuery{ToBlock: big.NewInt(9)}, logs)
+	if err != nil {
+		t.Fatalf("SubscribeFilterLogs error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	filterID := registeredFilters(node)[0]
+	pushLogs(t, node, "other", 0, 100, 101)
+	pushLogs(t, node, filterID, 0, 0, 3)
+	pushLogs(t, node, filterID, 1, 3, 5)
+
+	for n := uint64(0); n < 5; n++ {
+		select {
+		case log := <-logs:
+			if log.BlockNumber != n {
+				t.Fatalf("got log %d, want %d", log.BlockNumber, n)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription ended before log %d: %v", n, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("log %d not delivered", n)
+		}
+	}
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Errorf("completed subscription ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("subscription didn't end after the last push")
+	}
+}
+
+// TestSubscribeFilterLogsSlowConsumer checks that a consumer not keeping up
+// ends its subscription without holding up the pushes to other subscriptions.
+func TestSubscribeFilterLogsSlowConsumer(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_REGISTER, []byte(`{"result":0}`))
+	node.RespondChannel(rpc.TYPE_EVENT_LOG_UNREGISTER, []byte(`{"result":0}`))
+	client := node.ChannelClient()
+
+	slow, fast := make(chan types.Log), make(chan types.Log, 1)
+	slowSub, err := client.SubscribeFilterLogs(context.Background(), fiscobcos.FilterQuery{}, slow)
+	if err != nil {
+		t.Fatalf("SubscribeFilterLogs error: %v", err)
+	}
+	defer slowSub.Unsubscribe()
+	fastSub, err := client.SubscribeFilterLogs(context.Background(), fiscobcos.FilterQuery{}, fast)
+	if err != nil {
+		t.Fatalf("SubscribeFilterLogs error: %v", err)
+	}
+	defer fastSub.Unsubscribe()
+	ids := registeredFilters(node)
+
+	// Nobody reads slow, the pushes to it pile up.
+	for n := uint64(0); n < 200; n++ {
+		pushLogs(t, node, ids[0], 0, n, n+1)
+	}
+	pushLogs(t, node, ids[1], 0, 7, 8)
+	select {
+	case log := <-fast:
+		if log.BlockNumber != 7 {
+			t.Errorf("got log %d, want 7", log.BlockNumber)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushes to the other subscription are stalled")
+	}
+	select {
+	case err := <-slowSub.Err():
+		if err != ethclient.ErrSubscriptionOverflow {
+			t.Errorf("slow subscription ended with %v, want %v", err, ethclient.ErrSubscriptionOverflow)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow subscription didn't end")
+	}
+	var unregistered bool
+	for _, frame := range node.Frames() {
+		unregistered = unregistered || frame.Type == rpc.TYPE_EVENT_LOG_UNREGISTER
+	}
+	if !unregistered {
+		t.Error("filter of the slow subscription not unregistered")
+	}
+}
+
+// TestSubscribeNewBlocksCoalesces checks that blocks notified while the
+// consumer is busy are coalesced into the newest one, without holding up the
+// notifications of other subscriptions.
+func TestSubscribeNewBlocksCoalesces(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	failingHeaders(node)
+	client := node.ChannelClient()
+
+	slow, other := make(chan *types.BlockHeader), make(chan *types.BlockHeader, 1)
+	sub, err := client.SubscribeNewBlocks(context.Background(), 1, slow)
+	if err != nil {
+		t.Fatalf("SubscribeNewBlocks error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	otherSub, err := client.SubscribeNewBlocks(context.Background(), 2, other)
+	if err != nil {
+		t.Fatalf("SubscribeNewBlocks error: %v", err)
+	}
+	defer otherSub.Unsubscribe()
+
+	node.PushBlockNumber(1, 1)
+	for deadline := time.Now().Add(5 * time.Second); len(node.CallsTo("getBlockByNumber")) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("header of block 1 not fetched")
+		}
+	}
+	// The header of block 1 waits for the consumer now.
+	for n := uint64(2); n <= 100; n++ {
+		node.PushBlockNumber(1, n)
+	}
+	node.PushBlockNumber(2, 5)
+	select {
+	case header := <-other:
+		if header.Number != hexutil.EncodeUint64(5) {
+			t.Errorf("got header of block %s in group 2, want 5", header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifications of group 2 are stalled")
+	}
+
+	for _, want := range []uint64{1, 100} {
+		select {
+		case header := <-slow:
+			if header.Number != hexutil.EncodeUint64(want) {
+				t.Fatalf("got header of block %s, want %d", header.Number, want)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription ended: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("header of block %d not delivered", want)
+		}
+	}
+	if n := len(node.CallsTo("getBlockByNumber")); n != 3 {
+		t.Errorf("fetched %d headers, want 3", n)
+	}
+}
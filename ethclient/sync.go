@@ -0,0 +1,52 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"time"
+)
+
+// syncPollInterval is how often WaitSynced polls the sync status of the node.
+const syncPollInterval = time.Second
+
+// WaitSynced polls the sync status of the node until its latest block is at most
+// maxLag blocks behind the highest block known to it or any of its peers, or
+// until ctx is done, in which case its error is returned. Failed polls are
+// repeated, so the node may still be starting up. It fails with ErrClientClosed
+// if the client is closed meanwhile.
+func (ec *Client) WaitSynced(ctx context.Context, groupId uint64, maxLag uint64) error {
+	groupId = ec.group(ctx, groupId)
+
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if status, err := ec.SyncStatus(ctx, groupId); err == nil && status != nil {
+			if lag := status.HighestNumber() - status.BlockNumber; lag <= 0 || uint64(lag) <= maxLag {
+				return nil
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ec.closeCtx.Done():
+			return ErrClientClosed
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestWaitSynced serves a sequence of sync statuses, the last one repeated,
+// checking when WaitSynced returns.
+func TestWaitSynced(t *testing.T) {
+	type status struct {
+		number, highest, peer int64
+		fail                  bool
+	}
+	tests := []struct {
+		name     string
+		statuses []status
+		maxLag   uint64
+		polls    int // until WaitSynced returns, 0 if it doesn't
+	}{
+		{name: "synced", statuses: []status{{number: 10, highest: 10}}, polls: 1},
+		{name: "within lag", statuses: []status{{number: 10, highest: 15}}, maxLag: 5, polls: 1},
+		{name: "ahead of peers", statuses: []status{{number: 10, highest: 8}}, polls: 1},
+		{name: "catching up", statuses: []status{{number: 1, highest: 10}, {number: 8, highest: 10}}, maxLag: 2, polls: 2},
+		{name: "peer ahead", statuses: []status{{number: 10, highest: 10, peer: 20}, {number: 20, highest: 20, peer: 20}}, polls: 2},
+		{name: "starting up", statuses: []status{{fail: true}, {number: 3, highest: 3}}, polls: 2},
+		{name: "behind", statuses: []status{{number: 1, highest: 10}}, maxLag: 8},
+	}
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		var (
+			mu    sync.Mutex
+			polls int
+		)
+		node.Handle("getSyncStatus", func(params []json.RawMessage) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			s := test.statuses[len(test.statuses)-1]
+			if polls < len(test.statuses) {
+				s = test.statuses[polls]
+			}
+			polls++
+			if s.fail {
+				return nil, &ethclienttest.Error{Code: -32603, Message: "internal error"}
+			}
+			return map[string]interface{}{
+				"blockNumber":        s.number,
+				"knownHighestNumber": s.highest,
+				"peers":              []interface{}{map[string]interface{}{"blockNumber": s.peer}},
+			}, nil
+		})
+		client := node.Client()
+
+		timeout := time.Duration(len(test.statuses)+1) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := client.WaitSynced(ctx, 1, test.maxLag)
+		cancel()
+
+		mu.Lock()
+		n := polls
+		mu.Unlock()
+		if test.polls == 0 {
+			if err != context.DeadlineExceeded {
+				t.Errorf("%s: got %v, want a timeout", test.name, err)
+			}
+		} else if err != nil || n != test.polls {
+			t.Errorf("%s: returned %v after %d polls, want %d", test.name, err, n, test.polls)
+		}
+		node.Close()
+	}
+}
+
+// TestWaitSyncedClose checks that closing the client ends the wait.
+func TestWaitSyncedClose(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.Respond("getSyncStatus", map[string]interface{}{"blockNumber": 1, "knownHighestNumber": 100})
+	client := node.Client()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.WaitSynced(context.Background(), 1, 0) }()
+	time.Sleep(100 * time.Millisecond)
+	client.Close()
+	select {
+	case err := <-errc:
+		if err != ethclient.ErrClientClosed {
+			t.Errorf("got %v, want ErrClientClosed", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WaitSynced didn't return")
+	}
+}
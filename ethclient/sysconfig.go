@@ -0,0 +1,126 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled/config"
+)
+
+// SetSystemConfig sets a system config of the group, like tx_count_limit, with a
+// transaction signed by signer, an account allowed to change the configuration.
+// It returns once the transaction is executed. See the precompiled/config
+// package for the keys and values.
+func (ec *Client) SetSystemConfig(ctx context.Context, groupId uint64, signer *ecdsa.PrivateKey, key, value string) error {
+	opts := bind.NewKeyedTransactor(signer)
+	opts.GroupId = int(ec.group(ctx, groupId))
+	return config.NewService(ec).SetValueByKey(ctx, opts, key, value)
+}
+
+// TxCountLimit returns the number of transactions the group seals per block,
+// tx_count_limit.
+func (ec *Client) TxCountLimit(ctx context.Context, groupId uint64) (uint64, error) {
+	return ec.systemConfigUint64(ctx, groupId, config.TxCountLimit, config.DefaultTxCountLimit)
+}
+
+// TxGasLimit returns the gas a transaction of the group may use, tx_gas_limit.
+func (ec *Client) TxGasLimit(ctx context.Context, groupId uint64) (uint64, error) {
+	return ec.systemConfigUint64(ctx, groupId, config.TxGasLimit, config.DefaultTxGasLimit)
+}
+
+// ConsensusTimeout returns the time a consensus round of the group may take,
+// consensus_timeout.
+func (ec *Client) ConsensusTimeout(ctx context.Context, groupId uint64) (time.Duration, error) {
+	seconds, err := ec.systemConfigUint64(ctx, groupId, config.ConsensusTimeout, config.DefaultConsensusTimeout)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// RPCAuditLog reports whether the nodes of the group log RPC requests,
+// rpc_audit_log.
+func (ec *Client) RPCAuditLog(ctx context.Context, groupId uint64) (bool, error) {
+	value, err := ec.SystemConfigByKey(ctx, groupId, config.RPCAuditLog)
+	if err == fiscobcos.NotFound {
+		return config.DefaultRPCAuditLog, nil
+	} else if err != nil {
+		return false, err
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid system config %s: %q", config.RPCAuditLog, value)
+	}
+	return enabled, nil
+}
+
+// SystemConfigs retrieves the known system configs of the group, see
+// config.Keys, concurrently. Keys the node has no value for are left out.
+func (ec *Client) SystemConfigs(ctx context.Context, groupId uint64) (map[string]string, error) {
+	groupId = ec.group(ctx, groupId)
+
+	var (
+		keys   = config.Keys()
+		values = make([]string, len(keys))
+		errs   = make([]error, len(keys))
+		wg     sync.WaitGroup
+	)
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			values[i], errs[i] = ec.SystemConfigByKey(ctx, groupId, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	configs := make(map[string]string, len(keys))
+	for i, key := range keys {
+		switch errs[i] {
+		case nil:
+			configs[key] = values[i]
+		case fiscobcos.NotFound:
+		default:
+			return nil, errs[i]
+		}
+	}
+	return configs, nil
+}
+
+// systemConfigUint64 retrieves a numeric system config, or def if the key was
+// never set.
+func (ec *Client) systemConfigUint64(ctx context.Context, groupId uint64, key string, def uint64) (uint64, error) {
+	value, err := ec.SystemConfigByKey(ctx, groupId, key)
+	if err == fiscobcos.NotFound {
+		return def, nil
+	} else if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid system config %s: %q", key, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/precompiled/config"
+)
+
+// serveSystemConfigs answers getSystemConfigByKey from configs, an empty value
+// for keys missing, and with an error for the key fail.
+func serveSystemConfigs(node *ethclienttest.FakeNode, configs map[string]string, fail string) {
+	node.Handle("getSystemConfigByKey", func(params []json.RawMessage) (interface{}, error) {
+		var key string
+		if err := json.Unmarshal(params[1], &key); err != nil {
+			return nil, err
+		}
+		if key == fail {
+			return nil, &ethclienttest.Error{Code: -32603, Message: "internal error"}
+		}
+		return configs[key], nil
+	})
+}
+
+func TestSystemConfigGetters(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	ctx := context.Background()
+
+	tests := []struct {
+		key   string
+		value string // "" for a key never set
+		get   func() (interface{}, error)
+		want  interface{}
+		err   bool
+	}{
+		{config.TxCountLimit, "500", func() (interface{}, error) { return client.TxCountLimit(ctx, 2) }, uint64(500), false},
+		{config.TxCountLimit, "", func() (interface{}, error) { return client.TxCountLimit(ctx, 2) }, uint64(1000), false},
+		{config.TxCountLimit, "many", func() (interface{}, error) { return client.TxCountLimit(ctx, 2) }, nil, true},
+		{config.TxCountLimit, "-1", func() (interface{}, error) { return client.TxCountLimit(ctx, 2) }, nil, true},
+		{config.TxGasLimit, "400000000", func() (interface{}, error) { return client.TxGasLimit(ctx, 2) }, uint64(400000000), false},
+		{config.TxGasLimit, "", func() (interface{}, error) { return client.TxGasLimit(ctx, 2) }, uint64(300000000), false},
+		{config.TxGasLimit, "0x100", func() (interface{}, error) { return client.TxGasLimit(ctx, 2) }, nil, true},
+		{config.ConsensusTimeout, "10", func() (interface{}, error) { return client.ConsensusTimeout(ctx, 2) }, 10 * time.Second, false},
+		{config.ConsensusTimeout, "", func() (interface{}, error) { return client.ConsensusTimeout(ctx, 2) }, 3 * time.Second, false},
+		{config.ConsensusTimeout, "3s", func() (interface{}, error) { return client.ConsensusTimeout(ctx, 2) }, nil, true},
+		{config.RPCAuditLog, "true", func() (interface{}, error) { return client.RPCAuditLog(ctx, 2) }, true, false},
+		{config.RPCAuditLog, "false", func() (interface{}, error) { return client.RPCAuditLog(ctx, 2) }, false, false},
+		{config.RPCAuditLog, "1", func() (interface{}, error) { return client.RPCAuditLog(ctx, 2) }, true, false},
+		{config.RPCAuditLog, "", func() (interface{}, error) { return client.RPCAuditLog(ctx, 2) }, false, false},
+		{config.RPCAuditLog, "on", func() (interface{}, error) { return client.RPCAuditLog(ctx, 2) }, nil, true},
+	}
+	for _, test := range tests {
+		serveSystemConfigs(node, map[string]string{test.key: test.value}, "")
+		value, err := test.get()
+		switch {
+		case test.err && err == nil:
+			t.Errorf("%s %q: got %v, want an error", test.key, test.value, value)
+		case !test.err && err != nil:
+			t.Errorf("%s %q: %v", test.key, test.value, err)
+		case !test.err && value != test.want:
+			t.Errorf("%s %q: got %v, want %v", test.key, test.value, value, test.want)
+		}
+		calls := node.CallsTo("getSystemConfigByKey")
+		if len(calls) != 1 {
+			t.Fatalf("%s %q: sent %d requests", test.key, test.value, len(calls))
+		}
+		if group := groupParam(t, calls[0]); group != 2 || string(calls[0].Params[1]) != `"`+test.key+`"` {
+			t.Errorf("%s %q: asked group %d for %s", test.key, test.value, group, calls[0].Params[1])
+		}
+		node.Reset()
+
+		// Node errors aren't replaced by the default.
+		serveSystemConfigs(node, nil, test.key)
+		if value, err := test.get(); err == nil {
+			t.Errorf("%s: got %v from a failing node", test.key, value)
+		}
+		node.Reset()
+	}
+}
+
+func TestSystemConfigs(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	configs := map[string]string{
+		config.TxCountLimit:        "1000",
+		config.TxGasLimit:          "300000000",
+		config.RPBFTEpochSealerNum: "4",
+		config.ConsensusTimeout:    "3",
+		"unknown_key":              "1",
+	}
+	serveSystemConfigs(node, configs, "")
+	have, err := client.SystemConfigs(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("SystemConfigs error: %v", err)
+	}
+	want := map[string]string{
+		config.TxCountLimit:        "1000",
+		config.TxGasLimit:          "300000000",
+		config.RPBFTEpochSealerNum: "4",
+		config.ConsensusTimeout:    "3",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("got configs %v, want %v", have, want)
+	}
+	var asked []string
+	for _, call := range node.CallsTo("getSystemConfigByKey") {
+		var key string
+		json.Unmarshal(call.Params[1], &key)
+		asked = append(asked, key)
+		if group := groupParam(t, call); group != 3 {
+			t.Errorf("%s asked in group %d", key, group)
+		}
+	}
+	keys := config.Keys()
+	sort.Strings(asked)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(asked, keys) {
+		t.Errorf("asked for %v, want %v", asked, keys)
+	}
+
+	serveSystemConfigs(node, configs, config.RPCAuditLog)
+	if have, err := client.SystemConfigs(context.Background(), 3); err == nil {
+		t.Errorf("got configs %v from a failing node", have)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// GroupTopology returns a snapshot of the nodes of a group: which are sealers
+// and observers, which are connected but not in the group, their block heights
+// and the current leader. The underlying calls are issued concurrently; the
+// failure of one leaves the data it provides unknown and is recorded in the
+// snapshot. An error is returned only if all of them fail.
+func (ec *Client) GroupTopology(ctx context.Context, groupId uint64) (*types.GroupTopology, error) {
+	groupId = ec.group(ctx, groupId)
+	var (
+		sealers, observers, groupPeers, nodeIds []string
+		consensus                               *types.ConsensusStatus
+		syncStatus                              *types.SyncStatus
+		errs                                    = make([]error, 6)
+		wg                                      sync.WaitGroup
+	)
+	calls := []func() error{
+		func() (err error) { sealers, err = ec.SealerList(ctx, groupId); return },
+		func() (err error) { observers, err = ec.ObserverList(ctx, groupId); return },
+		func() (err error) { groupPeers, err = ec.GroupPeers(ctx, groupId); return },
+		func() (err error) { nodeIds, err = ec.NodeIDList(ctx, groupId); return },
+		func() (err error) { consensus, err = ec.ConsensusStatus(ctx, groupId); return },
+		func() (err error) { syncStatus, err = ec.SyncStatus(ctx, groupId); return },
+	}
+	methods := []string{"getSealerList", "getObserverList", "getGroupPeers", "getNodeIDList", "getConsensusStatus", "getSyncStatus"}
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call func() error) {
+			defer wg.Done()
+			errs[i] = call()
+		}(i, call)
+	}
+	wg.Wait()
+
+	topo := &types.GroupTopology{GroupId: groupId}
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			if topo.Errors == nil {
+				topo.Errors = make(map[string]string)
+			}
+			topo.Errors[methods[i]] = err.Error()
+			failed++
+		}
+	}
+	if failed == len(errs) {
+		return nil, errs[0]
+	}
+
+	// Collect the nodes in order of appearance, sealers first.
+	index := make(map[string]int)
+	add := func(ids ...string) {
+		for _, id := range ids {
+			if id == "" {
+				continue
+			}
+			if _, ok := index[nodeKey(id)]; !ok {
+				index[nodeKey(id)] = len(topo.Nodes)
+				topo.Nodes = append(topo.Nodes, types.TopologyNode{NodeId: id})
+			}
+		}
+	}
+	add(sealers...)
+	add(observers...)
+	add(groupPeers...)
+	add(nodeIds...)
+	if syncStatus != nil {
+		add(syncStatus.NodeID)
+		for _, peer := range syncStatus.Peers {
+			add(peer.NodeID)
+		}
+	}
+
+	// Roles, from the sealer and observer lists. Group members missing from one
+	// of them have the other role. The sealers are also listed in the consensus
+	// status.
+	sealerSet, observerSet, groupSet, connectedSet := nodeSet(sealers), nodeSet(observers), nodeSet(groupPeers), nodeSet(nodeIds)
+	sealersKnown, observersKnown, groupKnown := errs[0] == nil, errs[1] == nil, errs[2] == nil
+	if !sealersKnown && consensus != nil && len(consensus.Sealers) > 0 {
+		for _, sealer := range consensus.Sealers {
+			sealerSet[nodeKey(sealer.NodeId)] = true
+		}
+		sealersKnown = true
+	}
+	for i := range topo.Nodes {
+		node := &topo.Nodes[i]
+		key := nodeKey(node.NodeId)
+		switch {
+		case sealerSet[key]:
+			node.Role = types.NodeRoleSealer
+		case observerSet[key]:
+			node.Role = types.NodeRoleObserver
+		case groupKnown && !groupSet[key], sealersKnown && observersKnown:
+			node.Role = types.NodeRoleNone
+		case groupKnown && sealersKnown:
+			node.Role = types.NodeRoleObserver
+		case groupKnown && observersKnown:
+			node.Role = types.NodeRoleSealer
+		default:
+			node.Role = types.NodeRoleUnknown
+		}
+		if errs[3] == nil {
+			connected := connectedSet[key]
+			node.Connected = &connected
+		}
+	}
+
+	// The node id list starts with the answering node.
+	if len(nodeIds) > 0 {
+		topo.NodeId = nodeIds[0]
+	} else if syncStatus != nil {
+		topo.NodeId = syncStatus.NodeID
+	} else if consensus != nil {
+		topo.NodeId = consensus.NodeId
+	}
+	if syncStatus != nil {
+		setBlockNumber(topo, syncStatus.NodeID, syncStatus.BlockNumber)
+		for _, peer := range syncStatus.Peers {
+			setBlockNumber(topo, peer.NodeID, peer.BlockNumber)
+		}
+	}
+	if consensus != nil {
+		if leader, ok := consensus.LeaderIndex(); ok {
+			for _, sealer := range consensus.Sealers {
+				if sealer.Index == leader {
+					topo.Leader = sealer.NodeId
+				}
+			}
+		}
+	}
+	return topo, nil
+}
+
+func nodeKey(nodeId string) string {
+	return strings.ToLower(strings.TrimPrefix(nodeId, "0x"))
+}
+
+func nodeSet(nodeIds []string) map[string]bool {
+	set := make(map[string]bool, len(nodeIds))
+	for _, id := range nodeIds {
+		set[nodeKey(id)] = true
+	}
+	return set
+}
+
+func setBlockNumber(topo *types.GroupTopology, nodeId string, number int64) {
+	for i := range topo.Nodes {
+		if nodeKey(topo.Nodes[i].NodeId) == nodeKey(nodeId) {
+			topo.Nodes[i].BlockNumber = &number
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestGroupTopology checks the roles inferred from the node lists, including an
+// empty observer list and failed calls.
+func TestGroupTopology(t *testing.T) {
+	a, b, c, d := strings.Repeat("a", 128), strings.Repeat("b", 128), strings.Repeat("c", 128), strings.Repeat("d", 128)
+	list := func(ids ...string) string {
+		if len(ids) == 0 {
+			return `[]`
+		}
+		return `["` + strings.Join(ids, `","`) + `"]`
+	}
+	consensus := fmt.Sprintf(`[{"nodeId":%q,"sealer.0":%q,"sealer.1":%q,"currentView":3,"highestblockNumber":10,"nodeNum":2},[]]`, a, a, b)
+	syncStatus := fmt.Sprintf(`{"nodeId":%q,"blockNumber":10,"peers":[{"nodeId":%q,"blockNumber":9}]}`, a, b)
+	base := map[string]string{
+		"getSealerList":      list(a, b),
+		"getObserverList":    list(c),
+		"getGroupPeers":      list(a, b, c),
+		"getNodeIDList":      list(a, b, c, d),
+		"getConsensusStatus": consensus,
+		"getSyncStatus":      syncStatus,
+	}
+	tests := []struct {
+		name      string
+		responses map[string]string // replacing base, "" for an error
+		roles     []types.NodeRole  // of a, b, c and d
+		errors    []string
+	}{
+		{
+			name:  "complete",
+			roles: []types.NodeRole{types.NodeRoleSealer, types.NodeRoleSealer, types.NodeRoleObserver, types.NodeRoleNone},
+		},
+		{
+			name:      "no observers",
+			responses: map[string]string{"getObserverList": list(), "getGroupPeers": list(a, b)},
+			roles:     []types.NodeRole{types.NodeRoleSealer, types.NodeRoleSealer, types.NodeRoleNone, types.NodeRoleNone},
+		},
+		{
+			name:      "observers failed",
+			responses: map[string]string{"getObserverList": ""},
+			roles:     []types.NodeRole{types.NodeRoleSealer, types.NodeRoleSealer, types.NodeRoleObserver, types.NodeRoleNone},
+			errors:    []string{"getObserverList"},
+		},
+		{
+			name:      "sealers failed",
+			responses: map[string]string{"getSealerList": ""},
+			roles:     []types.NodeRole{types.NodeRoleSealer, types.NodeRoleSealer, types.NodeRoleObserver, types.NodeRoleNone},
+			errors:    []string{"getSealerList"},
+		},
+		{
+			name:      "group peers and observers failed",
+			responses: map[string]string{"getGroupPeers": "", "getObserverList": ""},
+			roles:     []types.NodeRole{types.NodeRoleSealer, types.NodeRoleSealer, types.NodeRoleUnknown, types.NodeRoleUnknown},
+			errors:    []string{"getGroupPeers", "getObserverList"},
+		},
+	}
+	for _, test := range tests {
+		node := ethclienttest.NewFakeNode(t)
+		for method, raw := range base {
+			if r, ok := test.responses[method]; ok {
+				raw = r
+			}
+			if raw == "" {
+				node.RespondError(method, -32000, "unavailable")
+			} else {
+				node.RespondRaw(method, raw)
+			}
+		}
+		topo, err := node.Client().GroupTopology(context.Background(), 1)
+		node.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(topo.Errors) != len(test.errors) {
+			t.Errorf("%s: got errors %v, want failures of %v", test.name, topo.Errors, test.errors)
+		}
+		for _, method := range test.errors {
+			if _, ok := topo.Errors[method]; !ok {
+				t.Errorf("%s: failure of %s not recorded", test.name, method)
+			}
+		}
+		if topo.NodeId != a || topo.Leader != b {
+			t.Errorf("%s: got node %.8s, leader %.8s, want %.8s and %.8s", test.name, topo.NodeId, topo.Leader, a, b)
+		}
+		for i, id := range []string{a, b, c, d} {
+			n := topo.Node(id)
+			switch {
+			case n == nil:
+				t.Errorf("%s: node %.8s missing", test.name, id)
+			case n.Role != test.roles[i]:
+				t.Errorf("%s: node %.8s has role %s, want %s", test.name, id, n.Role, test.roles[i])
+			case n.Connected == nil || !*n.Connected:
+				t.Errorf("%s: node %.8s not connected", test.name, id)
+			}
+		}
+		if n := topo.Node(b); n != nil && (n.BlockNumber == nil || *n.BlockNumber != 9) {
+			t.Errorf("%s: block number of %.8s not taken from the sync status", test.name, b)
+		}
+	}
+}
+
+// TestPeers decodes getPeers responses with topics as strings, as topic objects
+// and without any.
+func TestPeers(t *testing.T) {
+	b, c, d := strings.Repeat("b", 128), strings.Repeat("c", 128), strings.Repeat("d", 128)
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	node.RespondRaw("getPeers", fmt.Sprintf(`[`+
+		`{"Agency":"agency","IPAndPort":"127.0.0.1:30301","Node":"node1","NodeID":%q,"Topic":["_block_notify_1","orders"]},`+
+		`{"Agency":"agencyB","IPAndPort":"127.0.0.1:30302","Node":"node2","NodeID":%q,"Topic":[{"topic":"_block_notify_1"}]},`+
+		`{"Agency":"agencyB","IPAndPort":"10.0.0.3:30303","Node":"node3","NodeID":%q,"Topic":[]}]`, b, c, d))
+	want := []types.PeerStatus{
+		{Agency: "agency", Node: "node1", NodeID: b, IPAndPort: "127.0.0.1:30301", Topics: []string{"_block_notify_1", "orders"}},
+		{Agency: "agencyB", Node: "node2", NodeID: c, IPAndPort: "127.0.0.1:30302", Topics: []string{"_block_notify_1"}},
+		{Agency: "agencyB", Node: "node3", NodeID: d, IPAndPort: "10.0.0.3:30303"},
+	}
+	peers, err := client.Peers(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(peers, want) {
+		t.Errorf("got peers %+v, want %+v", peers, want)
+	}
+
+	// PeerCount sends the group of the context.
+	ctx := fiscobcos.ContextWithGroup(context.Background(), 2)
+	if count, err := client.PeerCount(ctx); err != nil || count != len(want) {
+		t.Errorf("PeerCount: %d, %v, want %d", count, err, len(want))
+	}
+	calls := node.CallsTo("getPeers")
+	if len(calls) != 2 || groupParam(t, calls[0]) != 3 || groupParam(t, calls[1]) != 2 {
+		t.Errorf("getPeers sent as %+v", calls)
+	}
+
+	// Topics neither strings nor topic objects fail.
+	node.RespondRaw("getPeers", fmt.Sprintf(`[{"NodeID":%q,"Topic":[1]}]`, b))
+	if peers, err := client.Peers(context.Background(), 1); err == nil {
+		t.Errorf("numeric topic decoded to %+v", peers)
+	}
+}
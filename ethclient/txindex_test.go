@@ -0,0 +1,121 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// TestTransactionByBlockAndIndex checks the encoding of the typed arguments of
+// the transaction-by-index methods, and how their answers are reported.
+func TestTransactionByBlockAndIndex(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+	ctx := context.Background()
+	hash := common.HexToHash("0xb10c")
+
+	calls := []struct {
+		name       string
+		method     string
+		call       func() (*types.TransactionByHash, error)
+		params     []string // after the group
+		deprecated bool
+	}{
+		{"number", "getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockNumberAndIndex(ctx, 1, big.NewInt(26), 3)
+		}, []string{`"0x1a"`, `"0x3"`}, false},
+		{"number 0", "getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockNumberAndIndex(ctx, 1, big.NewInt(0), 0)
+		}, []string{`"0x0"`, `"0x0"`}, false},
+		{"latest", "getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockNumberAndIndex(ctx, 1, nil, 255)
+		}, []string{`"latest"`, `"0xff"`}, false},
+		{"latest tag", "getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockNumberAndIndex(ctx, 1, big.NewInt(int64(rpc.LatestBlockNumber)), 1)
+		}, []string{`"latest"`, `"0x1"`}, false},
+		{"hash", "getTransactionByBlockHashAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockHashAndIndex(ctx, 1, hash, 16)
+		}, []string{`"` + hash.Hex() + `"`, `"0x10"`}, false},
+		{"number hex", "getTransactionByBlockNumberAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockNumberAndIndexHex(ctx, 1, "0x1a", "0x3")
+		}, []string{`"0x1a"`, `"0x3"`}, true},
+		{"hash hex", "getTransactionByBlockHashAndIndex", func() (*types.TransactionByHash, error) {
+			return client.TransactionByBlockHashAndIndexHex(ctx, 1, hash.Hex(), "0x10")
+		}, []string{`"` + hash.Hex() + `"`, `"0x10"`}, true},
+	}
+	answers := []struct {
+		name     string
+		respond  func(method string)
+		notFound bool
+	}{
+		{"found", func(m string) {
+			node.Respond(m, &types.TransactionByHash{Hash: hash.Hex(), TransactionIndex: "0x3"})
+		}, false},
+		{"null", func(m string) { node.RespondRaw(m, `null`) }, true},
+		{"index out of range", func(m string) { node.RespondError(m, -40005, "TransactionIndex is out of range") }, true},
+		{"no block", func(m string) { node.RespondError(m, -40004, "BlockNumber does not exist") }, true},
+		{"no block hash", func(m string) { node.RespondError(m, -40003, "BlockHash does not exist") }, true},
+	}
+	for _, call := range calls {
+		for _, answer := range answers {
+			if call.deprecated && answer.name != "found" && answer.name != "null" {
+				// The string versions pass node errors on as they were.
+				continue
+			}
+			answer.respond(call.method)
+			tx, err := call.call()
+			switch {
+			case answer.notFound && err != fiscobcos.NotFound:
+				t.Errorf("%s, %s: got error %v, want NotFound", call.name, answer.name, err)
+			case !answer.notFound && (err != nil || tx.Hash != hash.Hex()):
+				t.Errorf("%s, %s: got %v, %v", call.name, answer.name, tx, err)
+			}
+			sent := node.CallsTo(call.method)
+			if len(sent) != 1 {
+				t.Fatalf("%s, %s: sent %d requests", call.name, answer.name, len(sent))
+			}
+			params := sent[0].Params
+			if len(params) != 3 || string(params[1]) != call.params[0] || string(params[2]) != call.params[1] {
+				t.Errorf("%s, %s: sent params %s", call.name, answer.name, params)
+			}
+			node.Reset()
+		}
+	}
+
+	// Other errors are returned as is.
+	node.RespondError("getTransactionByBlockHashAndIndex", -32602, "Invalid params")
+	if _, err := client.TransactionByBlockHashAndIndex(ctx, 1, hash, 0); err == fiscobcos.NotFound {
+		t.Error("invalid params reported as NotFound")
+	} else if e, ok := err.(*ethclient.Error); !ok || e.Err != ethclient.ErrInvalidParams {
+		t.Errorf("invalid params: got error %T %v", err, err)
+	}
+	if _, err := client.TransactionByBlockNumberAndIndex(ctx, 1, big.NewInt(-5), 0); err == nil {
+		t.Error("negative block number accepted")
+	} else if _, ok := err.(*ethclient.ValidationError); !ok {
+		t.Errorf("negative block number: got error %T %v, want *ValidationError", err, err)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// TxPoolStatus returns the number of transactions pending in the pool of the
+// group along with the system configs limiting transactions, tx_count_limit and
+// tx_gas_limit.
+func (ec *Client) TxPoolStatus(ctx context.Context, groupId uint64) (*types.TxPoolStatus, error) {
+	groupId = ec.group(ctx, groupId)
+
+	pending, err := ec.PendingTxSize(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	status := &types.TxPoolStatus{Pending: pending}
+	if status.TxCountLimit, err = ec.TxCountLimit(ctx, groupId); err != nil {
+		return nil, err
+	}
+	if status.TxGasLimit, err = ec.TxGasLimit(ctx, groupId); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+func TestTxPoolStatus(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	client := node.Client()
+
+	tests := []struct {
+		name    string
+		pending interface{}
+		configs map[string]string
+		fail    string // method answering with an error
+		want    types.TxPoolStatus
+		drain   uint64
+	}{
+		{
+			name:    "configured",
+			pending: "0x2a",
+			configs: map[string]string{"tx_count_limit": "10", "tx_gas_limit": "400000000"},
+			want:    types.TxPoolStatus{Pending: 42, TxCountLimit: 10, TxGasLimit: 400000000},
+			drain:   5,
+		},
+		{
+			name:    "defaults",
+			pending: "0x0",
+			configs: map[string]string{"tx_count_limit": "", "tx_gas_limit": ""},
+			want:    types.TxPoolStatus{TxCountLimit: 1000, TxGasLimit: 300000000},
+		},
+		{
+			name:    "decimal pending",
+			pending: "1000",
+			configs: map[string]string{"tx_count_limit": "1000", "tx_gas_limit": "300000000"},
+			want:    types.TxPoolStatus{Pending: 1000, TxCountLimit: 1000, TxGasLimit: 300000000},
+			drain:   1,
+		},
+		{name: "pending fails", fail: "getPendingTxSize"},
+		{name: "configs fail", pending: "0x1", fail: "getSystemConfigByKey"},
+	}
+	for _, test := range tests {
+		node.Respond("getPendingTxSize", test.pending)
+		node.Handle("getSystemConfigByKey", func(params []json.RawMessage) (interface{}, error) {
+			var key string
+			if err := json.Unmarshal(params[1], &key); err != nil {
+				return nil, err
+			}
+			return test.configs[key], nil
+		})
+		if test.fail != "" {
+			node.RespondError(test.fail, -32603, "internal error")
+		}
+		status, err := client.TxPoolStatus(context.Background(), 3)
+		if test.fail != "" {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *status != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, *status, test.want)
+		}
+		if drain := status.BlocksToDrain(); drain != test.drain {
+			t.Errorf("%s: BlocksToDrain = %d, want %d", test.name, drain, test.drain)
+		}
+		for _, call := range node.Calls() {
+			if group := groupParam(t, call); group != 3 {
+				t.Errorf("%s: %s sent to group %d", test.name, call.Method, group)
+			}
+		}
+		node.Reset()
+	}
+}
+
+// retryCounter is a RetryPolicy retrying at once, up to twice.
+type retryCounter struct{ retries int }
+
+func (p *retryCounter) Retry(method string, attempt int, err error) (time.Duration, bool) {
+	if attempt >= 2 {
+		return 0, false
+	}
+	p.retries++
+	return 0, true
+}
+
+// TestTransactionRejections checks that transactions turned away by nodes of
+// different versions fail with the error of the reason, and that only those
+// never imported are sent again.
+func TestTransactionRejections(t *testing.T) {
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	policy := new(retryCounter)
+	client, err := ethclient.DialContext(context.Background(), node.URL(), ethclient.WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		code    int
+		message string
+		want    error
+		retried bool
+	}{
+		// Status codes
+		{0x05, "InvalidSignature", ethclient.ErrInvalidSignature, false},
+		{0x0f, "NonceCheckFail", ethclient.ErrNonceCheckFail, false},
+		{0x10, "BlockLimitCheckFail", ethclient.ErrBlockLimitCheckFail, false},
+		{0x17, "InvalidZeroSignature", ethclient.ErrInvalidSignature, false},
+		{0x1c, "TxPoolIsFull", ethclient.ErrTxPoolIsFull, true},
+		{10000, "AlreadyKnown", ethclient.ErrTxAlreadyKnown, false},
+		{10001, "AlreadyInChain", ethclient.ErrTxAlreadyInChain, false},
+		{10006, "OverGroupMemoryLimit", ethclient.ErrOverGroupMemoryLimit, true},
+		{-40011, "Over QPS limit", ethclient.ErrOverQPSLimit, true},
+
+		// Generic codes, the reason told by the message only
+		{-32000, "TxPoolIsFull", ethclient.ErrTxPoolIsFull, true},
+		{-32000, "Transaction pool is full", ethclient.ErrTxPoolIsFull, true},
+		{-32603, "txpool is full", ethclient.ErrTxPoolIsFull, true},
+		{0x1d, "Transaction refused: TxPool_Is_Full", ethclient.ErrTxPoolIsFull, true},
+		{-32000, "Nonce check fail", ethclient.ErrNonceCheckFail, false},
+		{-32000, "Block limit check fail", ethclient.ErrBlockLimitCheckFail, false},
+		{-32000, "Transaction already known", ethclient.ErrTxAlreadyKnown, false},
+		{-32000, "Transaction already in txpool", ethclient.ErrTxAlreadyKnown, false},
+		{-32000, "Transaction already in chain", ethclient.ErrTxAlreadyInChain, false},
+		{-32603, "invalid signature", ethclient.ErrInvalidSignature, false},
+		{0x1d, "Transaction refused", ethclient.ErrTransactionRefused, false},
+		{-32000, "something else", nil, false},
+	}
+	for _, test := range tests {
+		node.RespondError("sendRawTransaction", test.code, test.message)
+		policy.retries = 0
+		err := client.SendTransaction(context.Background(), newGroupTx(1))
+		e, ok := err.(*ethclient.Error)
+		if !ok {
+			t.Errorf("%d %q: got error %T %v, want *Error", test.code, test.message, err, err)
+			continue
+		}
+		if e.Err != test.want {
+			t.Errorf("%d %q: wraps %v, want %v", test.code, test.message, e.Err, test.want)
+		}
+		if e.Code != test.code || e.Message != test.message {
+			t.Errorf("%d %q: got code %d, message %q", test.code, test.message, e.Code, e.Message)
+		}
+		if retried := policy.retries > 0; retried != test.retried {
+			t.Errorf("%d %q: retried = %v, want %v", test.code, test.message, retried, test.retried)
+		}
+		if sends, want := len(node.CallsTo("sendRawTransaction")), 1+policy.retries; sends != want {
+			t.Errorf("%d %q: sent %d times, want %d", test.code, test.message, sends, want)
+		}
+		node.Reset()
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// maxGroupId is the highest group ID nodes accept.
+const maxGroupId = 32767
+
+// nodeIDLength is the length of node IDs, the hex encoded public key of a node.
+const nodeIDLength = 128
+
+// ErrInvalidArgument is matched by the *ValidationError returned for arguments
+// the client rejects without sending the request.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// ValidationError is returned if an argument of a request is malformed, instead
+// of the invalid params error the node would report. It matches
+// ErrInvalidArgument. Validation can be disabled with WithoutValidation.
+type ValidationError struct {
+	Method string      // method of the request
+	Param  string      // name of the invalid parameter
+	Value  interface{} // the invalid argument
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %v of %s: %s", e.Param, e.Value, e.Method, e.Reason)
+}
+
+// Unwrap returns ErrInvalidArgument.
+func (e *ValidationError) Unwrap() error { return ErrInvalidArgument }
+
+// Is reports whether target is ErrInvalidArgument.
+func (e *ValidationError) Is(target error) bool { return target == ErrInvalidArgument }
+
+// param is a parameter checked by validateArgs. check returns the invalid value,
+// the argument or a part of it, and why it's invalid, or an empty reason.
+// Arguments of a type it doesn't know are accepted.
+type param struct {
+	name  string
+	check func(arg interface{}) (interface{}, string)
+}
+
+var (
+	groupParam   = param{"groupId", checkGroupId}
+	hashParam    = param{"hash", checkHash}
+	addressParam = param{"address", checkAddress}
+	sealersParam = param{"sealers", checkGroupParams}
+)
+
+// methodParams lists the leading parameters of the methods which are checked
+// before sending a request. Methods not listed aren't checked.
+var methodParams = map[string][]param{
+	"getBlockNumber":                        {groupParam},
+	"getPbftView":                           {groupParam},
+	"getSealerList":                         {groupParam},
+	"getObserverList":                       {groupParam},
+	"getConsensusStatus":                    {groupParam},
+	"getSyncStatus":                         {groupParam},
+	"getPeers":                              {groupParam},
+	"getGroupPeers":                         {groupParam},
+	"getNodeIDList":                         {groupParam},
+	"getBlockByNumber":                      {groupParam},
+	"getBlockHeaderByNumber":                {groupParam},
+	"getBlockHashByNumber":                  {groupParam},
+	"getTransactionByBlockNumberAndIndex":   {groupParam},
+	"getBatchReceiptsByBlockNumberAndRange": {groupParam},
+	"getPendingTransactions":                {groupParam},
+	"getPendingTxSize":                      {groupParam},
+	"getTotalTransactionCount":              {groupParam},
+	"getSystemConfigByKey":                  {groupParam},
+	"call":                                  {groupParam},
+	"sendRawTransaction":                    {groupParam},
+	"getBlockByHash":                        {groupParam, hashParam},
+	"getBlockHeaderByHash":                  {groupParam, hashParam},
+	"getTransactionByBlockHashAndIndex":     {groupParam, hashParam},
+	"getBatchReceiptsByBlockHashAndRange":   {groupParam, hashParam},
+	"getTransactionByHash":                  {groupParam, hashParam},
+	"getTransactionReceipt":                 {groupParam, hashParam},
+	"getTransactionByHashWithProof":         {groupParam, hashParam},
+	"getTransactionReceiptByHashWithProof":  {groupParam, hashParam},
+	"getCode":                               {groupParam, addressParam},
+	"generateGroup":                         {groupParam, sealersParam},
+	"startGroup":                            {groupParam},
+	"stopGroup":                             {groupParam},
+	"removeGroup":                           {groupParam},
+	"recoverGroup":                          {groupParam},
+	"queryGroupStatus":                      {groupParam},
+}
+
+// SetValidation enables or disables the check of request arguments, see
+// WithoutValidation.
+func (ec *Client) SetValidation(enabled bool) {
+	var skip int32
+	if !enabled {
+		skip = 1
+	}
+	atomic.StoreInt32(&ec.skipValidation, skip)
+}
+
+// validateArgs checks the arguments of a request, unless validation is disabled.
+func (ec *Client) validateArgs(method string, args []interface{}) error {
+	if atomic.LoadInt32(&ec.skipValidation) == 1 {
+		return nil
+	}
+	params := methodParams[method]
+	for i, arg := range args {
+		if i == len(params) {
+			break
+		}
+		if value, reason := params[i].check(arg); reason != "" {
+			return &ValidationError{Method: method, Param: params[i].name, Value: value, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// validateBatch checks the arguments of the requests of a batch, setting the
+// Error of the invalid ones. It returns the indexes of the valid requests.
+func (ec *Client) validateBatch(elems []rpc.BatchElem) []int {
+	valid := make([]int, 0, len(elems))
+	for i := range elems {
+		if err := ec.validateArgs(elems[i].Method, elems[i].Args); err != nil {
+			elems[i].Error = err
+			continue
+		}
+		valid = append(valid, i)
+	}
+	return valid
+}
+
+func checkGroupId(arg interface{}) (interface{}, string) {
+	var groupId uint64
+	switch arg := arg.(type) {
+	case uint64:
+		groupId = arg
+	case uint:
+		groupId = uint64(arg)
+	case int:
+		if arg < 0 {
+			return arg, "negative group"
+		}
+		groupId = uint64(arg)
+	case int64:
+		if arg < 0 {
+			return arg, "negative group"
+		}
+		groupId = uint64(arg)
+	default:
+		return nil, ""
+	}
+	if groupId == 0 || groupId > maxGroupId {
+		return arg, fmt.Sprintf("groups range from 1 to %d", maxGroupId)
+	}
+	return nil, ""
+}
+
+func checkHash(arg interface{}) (interface{}, string) {
+	hash, ok := arg.(string)
+	if !ok {
+		return nil, ""
+	}
+	if !strings.HasPrefix(hash, "0x") {
+		return hash, "missing 0x prefix"
+	}
+	if len(hash) != 2+2*common.HashLength {
+		return hash, fmt.Sprintf("want %d hex digits, have %d", 2*common.HashLength, len(hash)-2)
+	}
+	if _, err := hex.DecodeString(hash[2:]); err != nil {
+		return hash, "not hex encoded"
+	}
+	return nil, ""
+}
+
+func checkAddress(arg interface{}) (interface{}, string) {
+	if address, ok := arg.(string); ok && !common.IsHexAddress(address) {
+		return address, fmt.Sprintf("want %d hex digits", 2*common.AddressLength)
+	}
+	return nil, ""
+}
+
+// checkGroupParams checks the node IDs of the sealers of a new group, 128 hex
+// digits without prefix.
+func checkGroupParams(arg interface{}) (interface{}, string) {
+	params, ok := arg.(types.GroupParams)
+	if !ok {
+		return nil, ""
+	}
+	for _, nodeID := range params.Sealers {
+		if len(nodeID) != nodeIDLength {
+			return nodeID, fmt.Sprintf("want node ID of %d hex digits, have %d", nodeIDLength, len(nodeID))
+		}
+		if _, err := hex.DecodeString(nodeID); err != nil {
+			return nodeID, "node ID not hex encoded"
+		}
+	}
+	return nil, ""
+}
+
+// maxFilterTopics is the number of topic positions of a filter query, logs
+// have at most four topics.
+const maxFilterTopics = 4
+
+// validateFilterQuery checks a filter query of method, whose group is resolved
+// already, unless validation is disabled.
+func (ec *Client) validateFilterQuery(method string, groupId uint64, q fiscobcos.FilterQuery) error {
+	if atomic.LoadInt32(&ec.skipValidation) == 1 {
+		return nil
+	}
+	invalid := func(param string, value interface{}, reason string) error {
+		return &ValidationError{Method: method, Param: param, Value: value, Reason: reason}
+	}
+	if value, reason := checkGroupId(groupId); reason != "" {
+		return invalid("groupId", value, reason)
+	}
+	if q.BlockHash != nil && (q.FromBlock != nil || q.ToBlock != nil) {
+		return invalid("blockHash", q.BlockHash.Hex(), "excludes fromBlock and toBlock")
+	}
+	// The LatestBlock and PendingBlock tags stand for the head of the chain.
+	fromHead, toHead := q.FromBlock != nil && isLatestBlock(q.FromBlock), q.ToBlock != nil && isLatestBlock(q.ToBlock)
+	if q.FromBlock != nil && !fromHead && q.FromBlock.Sign() < 0 {
+		return invalid("fromBlock", q.FromBlock, "negative and not a tag")
+	}
+	if q.ToBlock != nil && !toHead && q.ToBlock.Sign() < 0 {
+		return invalid("toBlock", q.ToBlock, "negative and not a tag")
+	}
+	if q.FromBlock != nil && !fromHead && !q.FromBlock.IsUint64() {
+		return invalid("fromBlock", q.FromBlock, "exceeds 64 bits")
+	}
+	if q.ToBlock != nil && !toHead && !q.ToBlock.IsUint64() {
+		return invalid("toBlock", q.ToBlock, "exceeds 64 bits")
+	}
+	if q.FromBlock != nil && q.ToBlock != nil && !fromHead && !toHead && q.FromBlock.Cmp(q.ToBlock) > 0 {
+		return invalid("fromBlock", q.FromBlock, "after toBlock "+q.ToBlock.String())
+	}
+	if len(q.Topics) > maxFilterTopics {
+		return invalid("topics", len(q.Topics), fmt.Sprintf("at most %d topic positions", maxFilterTopics))
+	}
+	return nil
+}
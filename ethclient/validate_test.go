@@ -0,0 +1,148 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/ethclient"
+	"github.com/chislab/go-fiscobcos/ethclient/ethclienttest"
+)
+
+// TestValidateArgs checks that malformed arguments fail with a *ValidationError
+// naming the parameter without reaching the node, unless validation is disabled.
+func TestValidateArgs(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		hash    = common.HexToHash("0xb10c").Hex()
+		address = common.HexToAddress("0xc0").Hex()
+		nodeID  = strings.Repeat("ab", 64)
+	)
+	tests := []struct {
+		name   string
+		method string
+		call   func(c *ethclient.Client) error
+		param  string // invalid parameter, empty if the arguments are valid
+	}{
+		{"valid hash", "getTransactionByHash", func(c *ethclient.Client) error {
+			_, err := c.TransactionByHash(ctx, 1, common.HexToHash(hash))
+			return err
+		}, ""},
+		{"hash without prefix", "getTransactionByBlockHashAndIndex", func(c *ethclient.Client) error {
+			_, err := c.TransactionByBlockHashAndIndexHex(ctx, 1, hash[2:], "0x0")
+			return err
+		}, "hash"},
+		{"short hash", "getTransactionByBlockHashAndIndex", func(c *ethclient.Client) error {
+			_, err := c.TransactionByBlockHashAndIndexHex(ctx, 1, hash[:65], "0x0")
+			return err
+		}, "hash"},
+		{"hash not hex", "getTransactionByBlockHashAndIndex", func(c *ethclient.Client) error {
+			_, err := c.TransactionByBlockHashAndIndexHex(ctx, 1, "0x"+strings.Repeat("zz", 32), "0x0")
+			return err
+		}, "hash"},
+		{"valid address", "getCode", func(c *ethclient.Client) error {
+			_, err := c.Code(ctx, 1, address)
+			return err
+		}, ""},
+		{"address of 39 digits", "getCode", func(c *ethclient.Client) error {
+			_, err := c.Code(ctx, 1, address[:41])
+			return err
+		}, "address"},
+		{"address not hex", "getCode", func(c *ethclient.Client) error {
+			_, err := c.Code(ctx, 1, "0x"+strings.Repeat("g", 40))
+			return err
+		}, "address"},
+		{"highest group", "getBlockNumber", func(c *ethclient.Client) error {
+			_, err := c.BlockNumber(ctx, 32767)
+			return err
+		}, ""},
+		{"group out of range", "getBlockNumber", func(c *ethclient.Client) error {
+			_, err := c.BlockNumber(ctx, 32768)
+			return err
+		}, "groupId"},
+		{"valid sealers", "generateGroup", func(c *ethclient.Client) error {
+			_, err := c.GenerateGroup(ctx, 2, types.GroupParams{Timestamp: 1, Sealers: []string{nodeID}})
+			return err
+		}, ""},
+		{"short node ID", "generateGroup", func(c *ethclient.Client) error {
+			_, err := c.GenerateGroup(ctx, 2, types.GroupParams{Timestamp: 1, Sealers: []string{nodeID, nodeID[:126]}})
+			return err
+		}, "sealers"},
+		{"prefixed node ID", "generateGroup", func(c *ethclient.Client) error {
+			_, err := c.GenerateGroup(ctx, 2, types.GroupParams{Timestamp: 1, Sealers: []string{"0x" + nodeID[2:]}})
+			return err
+		}, "sealers"},
+	}
+
+	node := ethclienttest.NewFakeNode(t)
+	defer node.Close()
+	node.RespondError("getTransactionByHash", -32602, "Invalid params")
+	node.RespondError("getTransactionByBlockHashAndIndex", -32602, "Invalid params")
+	node.RespondError("getCode", -32602, "Invalid params")
+	node.RespondError("getBlockNumber", -32602, "Invalid params")
+	node.RespondError("generateGroup", -32602, "Invalid params")
+
+	checked := node.Client()
+	unchecked, err := ethclient.DialContext(ctx, node.URL(), ethclient.WithoutValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unchecked.Close()
+	toggled := node.Client()
+	toggled.SetValidation(false)
+
+	for _, test := range tests {
+		// The node answers every request with invalid params, so an error
+		// other than a *ValidationError means the request was sent.
+		err := test.call(checked)
+		verr, invalid := err.(*ethclient.ValidationError)
+		switch {
+		case test.param == "" && invalid:
+			t.Errorf("%s: rejected: %v", test.name, err)
+		case test.param != "" && !invalid:
+			t.Errorf("%s: got error %T %v, want *ValidationError", test.name, err, err)
+		case invalid && (verr.Param != test.param || verr.Method != test.method || !verr.Is(ethclient.ErrInvalidArgument)):
+			t.Errorf("%s: got %+v, want parameter %s of %s", test.name, verr, test.param, test.method)
+		}
+		if sent := len(node.CallsTo(test.method)); (sent == 0) != invalid {
+			t.Errorf("%s: sent %d requests", test.name, sent)
+		}
+		node.Reset()
+
+		for _, client := range []*ethclient.Client{unchecked, toggled} {
+			if _, invalid := test.call(client).(*ethclient.ValidationError); invalid {
+				t.Errorf("%s: rejected with validation disabled", test.name)
+			}
+			if sent := len(node.CallsTo(test.method)); sent != 1 {
+				t.Errorf("%s: sent %d requests with validation disabled", test.name, sent)
+			}
+			node.Reset()
+		}
+	}
+
+	// Validation can be enabled again.
+	toggled.SetValidation(true)
+	if _, err := toggled.BlockNumber(ctx, 32768); err == nil {
+		t.Error("group out of range accepted after enabling validation")
+	} else if _, ok := err.(*ethclient.ValidationError); !ok {
+		t.Errorf("group out of range: got error %T %v after enabling validation", err, err)
+	}
+}
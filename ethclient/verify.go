@@ -0,0 +1,66 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// rootVersion is the first version of nodes computing the transactions root of
+// blocks the way types.Block.VerifyTxRoot checks it.
+const rootVersion = "2.2.0"
+
+var (
+	// ErrRootMismatch is matched by the error of BlockByNumber and BlockByHash if
+	// verification is enabled and the transactions root of the block doesn't match
+	// its transactions, see types.RootMismatchError.
+	ErrRootMismatch = types.ErrRootMismatch
+
+	// ErrVerificationUnsupported is returned by BlockByNumber and BlockByHash if
+	// verification is enabled but the node predates the checked root scheme.
+	ErrVerificationUnsupported = errors.New("node does not support block root verification")
+)
+
+// SetVerification enables or disables the check of the transactions root of the
+// blocks returned by BlockByNumber and BlockByHash, see WithVerification.
+func (ec *Client) SetVerification(enabled bool) {
+	var verify int32
+	if enabled {
+		verify = 1
+	}
+	atomic.StoreInt32(&ec.verify, verify)
+}
+
+// verifyBlock checks the transactions root of block if verification is enabled,
+// hashing as the chain does.
+func (ec *Client) verifyBlock(ctx context.Context, block *types.Block) error {
+	if atomic.LoadInt32(&ec.verify) == 0 {
+		return nil
+	}
+	version, err := ec.nodeVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if !version.AtLeast(rootVersion) {
+		return ErrVerificationUnsupported
+	}
+	return block.VerifyTxRoot(version.ChainMode())
+}
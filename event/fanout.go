@@ -0,0 +1,284 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrSlowConsumer is sent on the error channel of a FanOut subscription which was
+// disconnected because it could not keep up with the upstream events.
+var ErrSlowConsumer = errors.New("event: consumer too slow")
+
+// SlowConsumerPolicy selects what a FanOut does with events for a consumer whose
+// buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropEvents discards the events a consumer has no buffer space for.
+	DropEvents SlowConsumerPolicy = iota
+	// Disconnect unsubscribes the consumer, reporting ErrSlowConsumer.
+	Disconnect
+)
+
+// UpstreamFunc establishes the upstream subscription of a FanOut, delivering
+// events on the given channel.
+type UpstreamFunc func(channel interface{}) (Subscription, error)
+
+// FanOut shares a single upstream subscription between multiple consumers. The
+// upstream subscription is established when the first consumer subscribes and is
+// torn down when the last one leaves. Every consumer has its own buffer and slow
+// consumer policy, so one lagging consumer does not hold back the others.
+//
+// If the upstream subscription fails, its error is delivered to all consumers and
+// they are unsubscribed.
+//
+// Like Feed, FanOut passes events by reflection rather than being generic over
+// the event type, as the Go releases this module supports predate generics.
+//
+// A typical use is sharing one node-side block or log subscription:
+//
+//	fan := event.NewFanOut(make(chan *types.BlockHeader), func(ch interface{}) (event.Subscription, error) {
+//		return client.SubscribeNewBlocks(ctx, groupId, ch.(chan *types.BlockHeader))
+//	})
+//	sub, err := fan.Subscribe(myHeaders, 64, event.DropEvents)
+type FanOut struct {
+	chantyp  reflect.Type // type of the upstream delivery channels
+	chancap  int
+	etype    reflect.Type
+	upstream UpstreamFunc
+
+	mu        sync.Mutex
+	sub       Subscription  // active upstream subscription, nil if none
+	channel   reflect.Value // delivery channel of sub
+	quit      chan struct{} // stops the forwarding loop of sub
+	consumers map[*fanOutSub]struct{}
+}
+
+// NewFanOut creates a fan-out which receives upstream events on channels like
+// channel. The channel must be bidirectional, its element type determines the
+// element type consumer channels need to have. Every upstream subscription gets
+// a new channel of the same type and capacity, so events of an upstream being
+// torn down never mix with those of the next.
+func NewFanOut(channel interface{}, upstream UpstreamFunc) *FanOut {
+	chanval := reflect.ValueOf(channel)
+	chantyp := chanval.Type()
+	if chantyp.Kind() != reflect.Chan || chantyp.ChanDir() != reflect.BothDir {
+		panic(errBadChannel)
+	}
+	return &FanOut{
+		chantyp:   chantyp,
+		chancap:   chanval.Cap(),
+		etype:     chantyp.Elem(),
+		upstream:  upstream,
+		consumers: make(map[*fanOutSub]struct{}),
+	}
+}
+
+// Subscribe adds a consumer channel, establishing the upstream subscription if
+// this is the first consumer. Up to buffer events are queued for the consumer
+// before the slow consumer policy kicks in.
+func (f *FanOut) Subscribe(channel interface{}, buffer int, policy SlowConsumerPolicy) (Subscription, error) {
+	chanval := reflect.ValueOf(channel)
+	chantyp := chanval.Type()
+	if chantyp.Kind() != reflect.Chan || chantyp.ChanDir()&reflect.SendDir == 0 {
+		panic(errBadChannel)
+	}
+	if chantyp.Elem() != f.etype {
+		panic(feedTypeError{op: "Subscribe", got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sub == nil {
+		channel := reflect.MakeChan(f.chantyp, f.chancap)
+		sub, err := f.upstream(channel.Interface())
+		if err != nil {
+			return nil, err
+		}
+		f.sub, f.channel, f.quit = sub, channel, make(chan struct{})
+		go f.loop(sub, channel, f.quit)
+	}
+	s := &fanOutSub{
+		fanout:  f,
+		channel: chanval,
+		policy:  policy,
+		queue:   make(chan reflect.Value, buffer),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		err:     make(chan error, 1),
+	}
+	f.consumers[s] = struct{}{}
+	go s.deliver()
+	return s, nil
+}
+
+// loop forwards the events sub delivers on channel to the consumers until quit
+// is closed or the upstream subscription ends.
+func (f *FanOut) loop(sub Subscription, channel reflect.Value, quit chan struct{}) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(quit)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.Err())},
+		{Dir: reflect.SelectRecv, Chan: channel},
+	}
+	for {
+		chosen, recv, ok := reflect.Select(cases)
+		switch chosen {
+		case 0:
+			return
+		case 1:
+			var err error
+			if ok {
+				err, _ = recv.Interface().(error)
+			}
+			f.fail(sub, err)
+			return
+		default:
+			if !ok {
+				f.fail(sub, nil)
+				return
+			}
+			f.dispatch(sub, recv)
+		}
+	}
+}
+
+// dispatch queues an event of sub for every consumer. Events received just
+// before sub was torn down are dropped.
+func (f *FanOut) dispatch(sub Subscription, value reflect.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sub != sub {
+		return
+	}
+	for s := range f.consumers {
+		select {
+		case s.queue <- value:
+		default:
+			if s.policy == Disconnect {
+				f.remove(s, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// fail ends all consumers after the upstream subscription ended.
+func (f *FanOut) fail(sub Subscription, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sub != sub {
+		return
+	}
+	for s := range f.consumers {
+		f.remove(s, err)
+	}
+}
+
+// remove deletes a consumer, tearing down the upstream subscription if it was
+// the last one. The caller must hold f.mu.
+func (f *FanOut) remove(s *fanOutSub, err error) {
+	if _, ok := f.consumers[s]; !ok {
+		return
+	}
+	delete(f.consumers, s)
+	s.stop(err)
+
+	if len(f.consumers) == 0 && f.sub != nil {
+		close(f.quit)
+		go teardown(f.sub, f.channel)
+		f.sub, f.channel, f.quit = nil, reflect.Value{}, nil
+	}
+}
+
+// teardown unsubscribes from upstream, draining the events the producer might be
+// blocked on meanwhile from the channel of sub.
+func teardown(sub Subscription, channel reflect.Value) {
+	done := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(done)
+	}()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		{Dir: reflect.SelectRecv, Chan: channel},
+	}
+	for {
+		if chosen, _, ok := reflect.Select(cases); chosen == 0 || !ok {
+			return
+		}
+	}
+}
+
+type fanOutSub struct {
+	fanout  *FanOut
+	channel reflect.Value
+	policy  SlowConsumerPolicy
+	queue   chan reflect.Value
+	quit    chan struct{} // closed when the consumer is removed
+	done    chan struct{} // closed when deliver has returned
+	once    sync.Once
+	err     chan error
+}
+
+// deliver moves queued events to the consumer channel.
+func (s *fanOutSub) deliver() {
+	defer close(s.done)
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.quit)},
+		{Dir: reflect.SelectSend, Chan: s.channel},
+	}
+	for {
+		select {
+		case value := <-s.queue:
+			cases[1].Send = value
+			if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+				return
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *fanOutSub) stop(err error) {
+	s.once.Do(func() {
+		if err != nil {
+			s.err <- err
+		}
+		close(s.quit)
+		close(s.err)
+	})
+}
+
+func (s *fanOutSub) Unsubscribe() {
+	s.fanout.mu.Lock()
+	s.fanout.remove(s, nil)
+	s.fanout.mu.Unlock()
+	<-s.done
+}
+
+func (s *fanOutSub) Err() <-chan error {
+	return s.err
+}
@@ -0,0 +1,249 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testUpstream produces events for a FanOut. Upstream subscription number gen
+// sends gen*1000+i for i below count, then waits to be unsubscribed.
+type testUpstream struct {
+	count      int
+	unsubDelay time.Duration // delays unsubscribing, events keep coming meanwhile
+	fail       error         // error ending each upstream after its events
+
+	subscribed int32
+}
+
+func (u *testUpstream) subscribe(channel interface{}) (Subscription, error) {
+	ch := channel.(chan int)
+	gen := int(atomic.AddInt32(&u.subscribed, 1)) - 1
+	sub := NewSubscription(func(quit <-chan struct{}) error {
+		for i := 0; i < u.count; i++ {
+			select {
+			case ch <- gen*1000 + i:
+			case <-quit:
+				return nil
+			}
+		}
+		if u.fail != nil {
+			return u.fail
+		}
+		<-quit
+		return nil
+	})
+	return &slowUnsubscribe{Subscription: sub, delay: u.unsubDelay}, nil
+}
+
+type slowUnsubscribe struct {
+	Subscription
+	delay time.Duration
+}
+
+func (s *slowUnsubscribe) Unsubscribe() {
+	time.Sleep(s.delay)
+	s.Subscription.Unsubscribe()
+}
+
+// receive reads n events from ch.
+func receive(t *testing.T, ch <-chan int, n int) []int {
+	t.Helper()
+	var got []int
+	for len(got) < n {
+		select {
+		case v := <-ch:
+			got = append(got, v)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d events, want %d", len(got), n)
+		}
+	}
+	return got
+}
+
+func checkSequence(t *testing.T, got []int, first int) {
+	t.Helper()
+	for i, v := range got {
+		if v != first+i {
+			t.Fatalf("event %d is %d, want %d", i, v, first+i)
+		}
+	}
+}
+
+func TestFanOutConsumers(t *testing.T) {
+	upstream := &testUpstream{count: 100}
+	fan := NewFanOut(make(chan int), upstream.subscribe)
+
+	var (
+		wg    sync.WaitGroup
+		chans []chan int
+		subs  []Subscription
+	)
+	for i := 0; i < 5; i++ {
+		ch := make(chan int)
+		sub, err := fan.Subscribe(ch, 100, Disconnect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chans, subs = append(chans, ch), append(subs, sub)
+	}
+	for _, ch := range chans {
+		wg.Add(1)
+		go func(ch chan int) {
+			defer wg.Done()
+			checkSequence(t, receive(t, ch, 100), 0)
+		}(ch)
+	}
+	wg.Wait()
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+	if n := atomic.LoadInt32(&upstream.subscribed); n != 1 {
+		t.Errorf("subscribed upstream %d times, want 1", n)
+	}
+}
+
+func TestFanOutDropEvents(t *testing.T) {
+	upstream := &testUpstream{count: 100}
+	fan := NewFanOut(make(chan int), upstream.subscribe)
+
+	slow, fast := make(chan int), make(chan int)
+	slowSub, err := fan.Subscribe(slow, 1, DropEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slowSub.Unsubscribe()
+	fastSub, err := fan.Subscribe(fast, 100, DropEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fastSub.Unsubscribe()
+
+	// Nobody reads slow until all events went to fast.
+	checkSequence(t, receive(t, fast, 100), 0)
+	got := receive(t, slow, 1)
+	select {
+	case v := <-slow:
+		got = append(got, v)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(got) == 0 || len(got) > 2 {
+		t.Errorf("slow consumer got %v, want the events fitting its buffer", got)
+	}
+	select {
+	case err := <-slowSub.Err():
+		t.Errorf("slow consumer unsubscribed: %v", err)
+	default:
+	}
+}
+
+func TestFanOutDisconnect(t *testing.T) {
+	upstream := &testUpstream{count: 100}
+	fan := NewFanOut(make(chan int), upstream.subscribe)
+
+	slow, fast := make(chan int), make(chan int)
+	slowSub, err := fan.Subscribe(slow, 1, Disconnect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slowSub.Unsubscribe()
+	fastSub, err := fan.Subscribe(fast, 100, Disconnect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fastSub.Unsubscribe()
+
+	checkSequence(t, receive(t, fast, 100), 0)
+	select {
+	case err := <-slowSub.Err():
+		if err != ErrSlowConsumer {
+			t.Errorf("slow consumer ended with %v, want %v", err, ErrSlowConsumer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow consumer not disconnected")
+	}
+	select {
+	case err := <-fastSub.Err():
+		t.Errorf("fast consumer ended: %v", err)
+	default:
+	}
+}
+
+func TestFanOutUpstreamError(t *testing.T) {
+	failure := errors.New("upstream failed")
+	upstream := &testUpstream{count: 3, fail: failure}
+	fan := NewFanOut(make(chan int), upstream.subscribe)
+
+	var subs []Subscription
+	for i := 0; i < 3; i++ {
+		sub, err := fan.Subscribe(make(chan int), 10, DropEvents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	for i, sub := range subs {
+		select {
+		case err := <-sub.Err():
+			if err != failure {
+				t.Errorf("consumer %d ended with %v, want %v", i, err, failure)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("consumer %d didn't end", i)
+		}
+	}
+	// The next consumer gets a new upstream subscription.
+	upstream.fail = nil
+	ch := make(chan int)
+	sub, err := fan.Subscribe(ch, 10, DropEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	checkSequence(t, receive(t, ch, 3), 1000)
+}
+
+// TestFanOutResubscribe checks that an upstream being torn down doesn't take
+// the events of the one replacing it.
+func TestFanOutResubscribe(t *testing.T) {
+	upstream := &testUpstream{count: 100, unsubDelay: 200 * time.Millisecond}
+	fan := NewFanOut(make(chan int), upstream.subscribe)
+
+	first := make(chan int)
+	sub, err := fan.Subscribe(first, 100, DropEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSequence(t, receive(t, first, 5), 0)
+	// The first upstream keeps sending while it is unsubscribed.
+	sub.Unsubscribe()
+
+	second := make(chan int)
+	sub, err = fan.Subscribe(second, 100, DropEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	checkSequence(t, receive(t, second, 100), 1000)
+	if n := atomic.LoadInt32(&upstream.subscribed); n != 2 {
+		t.Errorf("subscribed upstream %d times, want 2", n)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package fiscobcos
+
+import "context"
+
+type groupContextKey struct{}
+
+// ContextWithGroup returns a copy of ctx that carries the given group id. Clients
+// use it as the target group of calls that don't name a group explicitly (i.e.
+// pass a groupId of 0), which lets middleware redirect requests without changing
+// every function signature.
+//
+// The group of a request is resolved in the following order:
+//
+//  1. an explicit, non-zero groupId argument
+//  2. for transactions being sent, the group they are signed for
+//  3. the group carried by the context
+//  4. the default group of the client
+func ContextWithGroup(ctx context.Context, groupId uint64) context.Context {
+	return context.WithValue(ctx, groupContextKey{}, groupId)
+}
+
+// GroupFromContext retrieves the group id set by ContextWithGroup. The boolean
+// result reports whether the context carries a (non-zero) group at all.
+func GroupFromContext(ctx context.Context) (uint64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	groupId, ok := ctx.Value(groupContextKey{}).(uint64)
+	return groupId, ok && groupId != 0
+}
@@ -44,39 +44,26 @@ type Subscription interface {
 	Err() <-chan error
 }
 
-// ChainReader provides access to the blockchain. The methods in this interface access raw
-// data from either the canonical chain (when requesting by block number) or any
-// blockchain fork that was previously downloaded and processed by the node. The block
-// number argument can be nil to select the latest canonical block. Reading block headers
-// should be preferred over full blocks whenever possible.
+// ChainReader provides access to the blocks of a group. The block number argument
+// can be nil to select the latest block. Reading block headers should be preferred
+// over full blocks whenever possible.
 //
 // The returned error is NotFound if the requested item does not exist.
 type ChainReader interface {
-	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
-	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
-	TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error)
-	TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error)
+	BlockNumber(ctx context.Context, groupId uint64) (*big.Int, error)
+	BlockByHash(ctx context.Context, groupId uint64, hash common.Hash) (*types.Block, error)
+	BlockByNumber(ctx context.Context, groupId uint64, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, groupId uint64, number *big.Int) (*types.BlockHeader, error)
 }
 
 // TransactionReader provides access to past transactions and their receipts.
-// Implementations may impose arbitrary restrictions on the transactions and receipts that
-// can be retrieved. Historic transactions may not be available.
-//
-// Avoid relying on this interface if possible. Contract logs (through the LogFilterer
-// interface) are more reliable and usually safer in the presence of chain
-// reorganisations.
 //
 // The returned error is NotFound if the requested item does not exist.
 type TransactionReader interface {
-	// TransactionByHash checks the pool of pending transactions in addition to the
-	// blockchain. The isPending return value indicates whether the transaction has been
-	// mined yet. Note that the transaction may not be part of the canonical chain even if
-	// it's not pending.
-	TransactionByHash(ctx context.Context, txHash common.Hash) (tx *types.Transaction, isPending bool, err error)
-	// TransactionReceipt returns the receipt of a mined transaction. Note that the
-	// transaction may not be included in the current canonical chain even if a receipt
-	// exists.
-	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	// TransactionByHash returns a transaction of the group, sealed or pending.
+	TransactionByHash(ctx context.Context, groupId uint64, txHash common.Hash) (*types.TransactionByHash, error)
+	// TransactionReceipt returns the receipt of a sealed transaction.
+	TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error)
 }
 
 // ChainStateReader wraps access to the state trie of the canonical blockchain. Note that
@@ -85,7 +72,7 @@ type TransactionReader interface {
 type ChainStateReader interface {
 	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
 	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
-	CodeAt(ctx context.Context, groupId int, account common.Address, blockNumber *big.Int) ([]byte, error)
+	CodeAt(ctx context.Context, groupId uint64, account common.Address, blockNumber *big.Int) ([]byte, error)
 	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
 }
 
@@ -131,7 +118,8 @@ type ContractCaller interface {
 
 // FilterQuery contains options for contract log filtering.
 type FilterQuery struct {
-	BlockHash *common.Hash     // used by eth_getLogs, return logs only from block with this hash
+	GroupId   uint64           // group of the logs, 0 for the group of the context or the client default
+	BlockHash *common.Hash     // return logs only from the block with this hash, excludes a block range
 	FromBlock *big.Int         // beginning of the queried range, nil means genesis block
 	ToBlock   *big.Int         // end of the range, nil means latest block
 	Addresses []common.Address // restricts matches to events created by specific contracts
@@ -162,6 +150,45 @@ type TransactionSender interface {
 	SendTransaction(ctx context.Context, tx *types.Transaction) error
 }
 
+// LogFilterer provides access to contract log events using one-off queries or
+// continuous event subscriptions. The group is the one of the query.
+type LogFilterer interface {
+	// FilterLogs executes a log filter operation, blocking during execution and
+	// returning all the results in one batch.
+	FilterLogs(ctx context.Context, q FilterQuery) ([]types.Log, error)
+	// SubscribeFilterLogs creates a background log filtering operation, returning
+	// a subscription immediately, which can be used to stream the found events.
+	SubscribeFilterLogs(ctx context.Context, q FilterQuery, ch chan<- types.Log) (Subscription, error)
+}
+
+// GroupReader provides access to the groups a node takes part in and to the nodes
+// of each group. Node IDs are the hex encoded public keys of the nodes.
+type GroupReader interface {
+	// GroupList returns the IDs of the groups the node belongs to.
+	GroupList(ctx context.Context) ([]int64, error)
+	// GroupPeers returns the consensus and observer nodes of the group.
+	GroupPeers(ctx context.Context, groupId uint64) ([]string, error)
+	// NodeIDList returns the node and the peers it's connected to.
+	NodeIDList(ctx context.Context, groupId uint64) ([]string, error)
+	// SealerList returns the nodes of the group taking part in the consensus.
+	SealerList(ctx context.Context, groupId uint64) ([]string, error)
+	// ObserverList returns the nodes of the group only syncing blocks. Groups
+	// often have none, in which case the list is empty and the error nil.
+	ObserverList(ctx context.Context, groupId uint64) ([]string, error)
+}
+
+// Client is the set of node operations applications usually depend on. It's
+// implemented by *ethclient.Client; code taking a Client instead can be handed a
+// fake in tests.
+type Client interface {
+	ChainReader
+	TransactionReader
+	TransactionSender
+	ContractCaller
+	LogFilterer
+	GroupReader
+}
+
 // GasPricer wraps the gas price oracle, which monitors the blockchain to determine the
 // optimal gas price given current fee market conditions.
 type GasPricer interface {
@@ -0,0 +1,183 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fixtures provides node responses for the tests of the client, so that
+// decoding is checked against the data shapes of real node versions rather than
+// JSON written for each test.
+//
+// Responses are grouped in sets, one per node version, each kept in
+// testdata/<name>.json. A set maps names like "getBlockByNumber/transactions"
+// to a JSON-RPC request and the node's response to it. Sets are recorded from a
+// live node with the record tool in the record directory, which can also check
+// a set against a node without rewriting it. Only recorded responses belong in
+// testdata; the tests of All are skipped while there are none.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Set is the recorded responses of one node.
+type Set struct {
+	Name      string               `json:"-"`       // name of the set, its file name without extension
+	Version   string               `json:"version"` // node version, as in its "Supported Version"
+	GM        bool                 `json:"gm"`      // whether the node is a guomi build
+	Source    string               `json:"source"`  // where the responses come from
+	Exchanges map[string]*Exchange `json:"exchanges"`
+}
+
+// Exchange is a JSON-RPC request and the response of the node to it.
+type Exchange struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Result json.RawMessage   `json:"result,omitempty"` // null results are left out
+	Error  *Error            `json:"error,omitempty"`
+}
+
+// Error is an error response of the node.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Dir returns the directory the sets are kept in.
+func Dir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+// Names returns the names of all sets, sorted.
+func Names() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(Dir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load reads the set with the given name.
+func Load(name string) (*Set, error) {
+	data, err := ioutil.ReadFile(filepath.Join(Dir(), name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{Name: name}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("fixture set %s: %v", name, err)
+	}
+	return set, nil
+}
+
+// All loads every set, failing the test if one can't be read and skipping it if
+// none have been recorded.
+func All(t testing.TB) []*Set {
+	t.Helper()
+	names, err := Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Skipf("no fixture sets recorded in %s", Dir())
+	}
+	sets := make([]*Set, len(names))
+	for i, name := range names {
+		if sets[i], err = Load(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sets
+}
+
+// Exchange returns the exchange with the given name, failing the test if the set
+// has none.
+func (s *Set) Exchange(t testing.TB, name string) *Exchange {
+	t.Helper()
+	ex, ok := s.Exchanges[name]
+	if !ok {
+		t.Fatalf("fixture set %s has no exchange %s", s.Name, name)
+	}
+	return ex
+}
+
+// Result returns the result of the named exchange, failing the test if the set
+// has none or the node answered with an error.
+func (s *Set) Result(t testing.TB, name string) json.RawMessage {
+	t.Helper()
+	ex := s.Exchange(t, name)
+	if ex.Error != nil {
+		t.Fatalf("fixture set %s: %s answered with error %d: %s", s.Name, name, ex.Error.Code, ex.Error.Message)
+	}
+	if ex.Result == nil {
+		return json.RawMessage("null")
+	}
+	return ex.Result
+}
+
+// Decode decodes the result of the named exchange into v, failing the test if it
+// can't be decoded.
+func (s *Set) Decode(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(s.Result(t, name), v); err != nil {
+		t.Fatalf("fixture set %s: can't decode %s: %v", s.Name, name, err)
+	}
+}
+
+// Supports reports whether the node of the set served the named exchange,
+// rather than answering that the method doesn't exist.
+func (s *Set) Supports(name string) bool {
+	ex, ok := s.Exchanges[name]
+	return ok && (ex.Error == nil || ex.Error.Code != -32601)
+}
+
+// Lookup returns the exchange answering a request for method with the given
+// parameters, nil if the set has none. Parameters are compared as JSON values.
+func (s *Set) Lookup(method string, params []json.RawMessage) *Exchange {
+	for _, ex := range s.Exchanges {
+		if ex.Method == method && sameParams(ex.Params, params) {
+			return ex
+		}
+	}
+	return nil
+}
+
+func sameParams(a, b []json.RawMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		var ca, cb bytes.Buffer
+		if json.Compact(&ca, a[i]) != nil || json.Compact(&cb, b[i]) != nil || !bytes.Equal(ca.Bytes(), cb.Bytes()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,413 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// The record tool records the fixture set of a live node: the responses of the
+// node to every method the client wraps, for blocks and transactions it finds
+// on the chain. With -check it compares the shapes of the responses with the
+// recorded set instead, reporting added, removed and retyped fields.
+//
+//	go run ./internal/fixtures/record -url http://127.0.0.1:8545 -group 1
+//
+// The chain needs a contract deployment, a transaction emitting events, a
+// failed transaction and a block of more than 16 transactions among its last
+// blocks, see -scan.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/internal/fixtures"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+var (
+	urlFlag   = flag.String("url", "http://127.0.0.1:8545", "JSON-RPC endpoint of the node")
+	groupFlag = flag.Uint64("group", 1, "group to record")
+	nameFlag  = flag.String("name", "", "name of the set (default v<version>, with a -gm suffix for guomi nodes)")
+	scanFlag  = flag.Uint64("scan", 1000, "number of blocks searched for the transactions to record")
+	checkFlag = flag.Bool("check", false, "compare the response shapes with the recorded set instead of writing it")
+)
+
+func main() {
+	flag.Parse()
+	client, err := rpc.Dial(*urlFlag)
+	if err != nil {
+		fatalf("Can't connect to %s: %v", *urlFlag, err)
+	}
+	defer client.Close()
+
+	r := &recorder{client: client, group: *groupFlag, set: &fixtures.Set{Exchanges: make(map[string]*fixtures.Exchange)}}
+	r.recordAll()
+	if *nameFlag != "" {
+		r.set.Name = *nameFlag
+	}
+	if *checkFlag {
+		os.Exit(check(r.set))
+	}
+	data, err := json.MarshalIndent(r.set, "", "\t")
+	if err != nil {
+		fatalf("Can't encode the set: %v", err)
+	}
+	if err := os.MkdirAll(fixtures.Dir(), 0755); err != nil {
+		fatalf("Can't create the set directory: %v", err)
+	}
+	path := filepath.Join(fixtures.Dir(), r.set.Name+".json")
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		fatalf("Can't write the set: %v", err)
+	}
+	fmt.Printf("Recorded %d exchanges to %s\n", len(r.set.Exchanges), path)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+type recorder struct {
+	client *rpc.Client
+	group  uint64
+	set    *fixtures.Set
+}
+
+// call sends a request without recording it.
+func (r *recorder) call(result interface{}, method string, params ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := r.client.CallContext(ctx, result, method, params...); err != nil {
+		fatalf("%s: %v", method, err)
+	}
+}
+
+// record sends a request and records it, together with the response, under
+// name. It returns the result, nil for null results and errors.
+func (r *recorder) record(name, method string, params ...interface{}) json.RawMessage {
+	ex := &fixtures.Exchange{Method: method, Params: make([]json.RawMessage, len(params))}
+	for i, param := range params {
+		enc, err := json.Marshal(param)
+		if err != nil {
+			fatalf("%s: can't encode parameter %d: %v", name, i, err)
+		}
+		ex.Params[i] = enc
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var result json.RawMessage
+	err := r.client.CallContext(ctx, &result, method, params...)
+	if rpcErr, ok := err.(rpc.Error); ok {
+		ex.Error = &fixtures.Error{Code: rpcErr.ErrorCode(), Message: rpcErr.Error()}
+	} else if err != nil {
+		fatalf("%s: %v", name, err)
+	} else if string(result) != "null" {
+		ex.Result = result
+	}
+	r.set.Exchanges[name] = ex
+	return ex.Result
+}
+
+// chain holds the blocks and transactions found for the recording.
+type chain struct {
+	latest      uint64
+	deployBlock uint64
+	deployTx    common.Hash
+	contract    common.Address
+	deployer    common.Address
+	eventsBlock uint64
+	eventsHash  common.Hash
+	eventsTxs   int
+	eventsTx    common.Hash
+	eventsInput hexutil.Bytes
+	failedTx    common.Hash
+	largeBlock  uint64
+	largeTx     common.Hash // transaction 16 of largeBlock, proven on two levels
+}
+
+type scanBlock struct {
+	Hash         common.Hash `json:"hash"`
+	Transactions []struct {
+		Hash  common.Hash    `json:"hash"`
+		From  common.Address `json:"from"`
+		Input hexutil.Bytes  `json:"input"`
+	} `json:"transactions"`
+}
+
+type scanReceipt struct {
+	ContractAddress common.Address    `json:"contractAddress"`
+	Status          string            `json:"status"`
+	To              common.Address    `json:"to"`
+	Logs            []json.RawMessage `json:"logs"`
+}
+
+// find searches the last blocks for the transactions to record.
+func (r *recorder) find(latest uint64) *chain {
+	c := &chain{latest: latest}
+	var deploy, events, failed bool
+	for n := latest; n > 0 && latest-n < *scanFlag; n-- {
+		if deploy && events && failed && c.largeBlock != 0 {
+			break
+		}
+		var block scanBlock
+		r.call(&block, "getBlockByNumber", r.group, hexutil.EncodeUint64(n), true)
+		if len(block.Transactions) > 16 && c.largeBlock == 0 {
+			c.largeBlock, c.largeTx = n, block.Transactions[16].Hash
+		}
+		if deploy && events && failed {
+			continue
+		}
+		for i, tx := range block.Transactions {
+			var receipt scanReceipt
+			r.call(&receipt, "getTransactionReceipt", r.group, tx.Hash)
+			switch {
+			case !deploy && receipt.Status == "0x0" && receipt.ContractAddress != (common.Address{}):
+				deploy = true
+				c.deployBlock, c.deployTx, c.contract, c.deployer = n, tx.Hash, receipt.ContractAddress, tx.From
+			case !events && receipt.Status == "0x0" && len(receipt.Logs) > 0:
+				events = true
+				c.eventsBlock, c.eventsHash, c.eventsTxs = n, block.Hash, len(block.Transactions)
+				c.eventsTx, c.eventsInput = tx.Hash, tx.Input
+			case !failed && receipt.Status != "0x0" && receipt.To != (common.Address{}):
+				failed = true
+				c.failedTx = tx.Hash
+			}
+			if i > 16 {
+				// Don't fetch every receipt of large blocks.
+				break
+			}
+		}
+	}
+	missing := map[string]bool{
+		"a contract deployment":                !deploy,
+		"a transaction emitting events":        !events,
+		"a failed contract call":               !failed,
+		"a block of more than 16 transactions": c.largeBlock == 0,
+	}
+	for what, miss := range missing {
+		if miss {
+			fatalf("No %s in the last %d blocks, send one or raise -scan", what, *scanFlag)
+		}
+	}
+	return c
+}
+
+func (r *recorder) recordAll() {
+	g := r.group
+	var version map[string]string
+	if err := json.Unmarshal(r.record("getClientVersion", "getClientVersion"), &version); err != nil {
+		fatalf("Invalid client version: %v", err)
+	}
+	r.set.Version = version["Supported Version"]
+	if r.set.Version == "" {
+		r.set.Version = strings.Fields(version["FISCO-BCOS Version"])[0]
+	}
+	r.set.GM = strings.HasSuffix(strings.ToLower(strings.TrimSpace(version["FISCO-BCOS Version"])), "gm")
+	r.set.Name = "v" + r.set.Version
+	if r.set.GM {
+		r.set.Name += "-gm"
+	}
+	r.set.Source = fmt.Sprintf("recorded from FISCO BCOS %s (%s) on %s", version["FISCO-BCOS Version"], version["Git Commit Hash"], time.Now().Format("2006-01-02"))
+
+	var latest hexutil.FlexibleUint64
+	if err := json.Unmarshal(r.record("getBlockNumber", "getBlockNumber", g), &latest); err != nil {
+		fatalf("Invalid block number: %v", err)
+	}
+	for _, method := range []string{"getPbftView", "getSealerList", "getObserverList", "getConsensusStatus", "getSyncStatus", "getPeers", "getGroupPeers", "getNodeIDList", "getPendingTransactions", "getPendingTxSize", "getTotalTransactionCount"} {
+		r.record(method, method, g)
+	}
+	var groups []uint64
+	if err := json.Unmarshal(r.record("getGroupList", "getGroupList"), &groups); err != nil {
+		fatalf("Invalid group list: %v", err)
+	}
+	unknown := uint64(1)
+	for _, group := range groups {
+		if group >= unknown {
+			unknown = group + 1
+		}
+	}
+	r.record("error/groupNotExist", "getBlockNumber", unknown)
+	r.record("getSystemConfigByKey", "getSystemConfigByKey", g, "tx_count_limit")
+
+	c := r.find(uint64(latest))
+	hex := hexutil.EncodeUint64
+	r.record("getBlockByNumber/genesis", "getBlockByNumber", g, hex(0), true)
+	r.record("getBlockByNumber/deploy", "getBlockByNumber", g, hex(c.deployBlock), true)
+	r.record("getBlockByNumber/hashes", "getBlockByNumber", g, hex(c.eventsBlock), false)
+	r.record("getBlockByNumber/transactions", "getBlockByNumber", g, hex(c.eventsBlock), true)
+	r.record("getBlockByNumber/large", "getBlockByNumber", g, hex(c.largeBlock), true)
+	r.record("getBlockByNumber/missing", "getBlockByNumber", g, hex(c.latest+1000), true)
+	r.record("getBlockByHash", "getBlockByHash", g, c.eventsHash, true)
+	r.record("getBlockHashByNumber", "getBlockHashByNumber", g, hex(c.eventsBlock))
+	r.record("getBlockHeaderByNumber", "getBlockHeaderByNumber", g, hex(c.eventsBlock), true)
+
+	r.record("getTransactionByHash", "getTransactionByHash", g, c.eventsTx)
+	r.record("getTransactionByBlockNumberAndIndex", "getTransactionByBlockNumberAndIndex", g, hex(c.eventsBlock), hex(uint64(c.eventsTxs-1)))
+	r.record("getTransactionByBlockHashAndIndex", "getTransactionByBlockHashAndIndex", g, c.eventsHash, hex(0))
+	r.record("getTransactionByHashWithProof", "getTransactionByHashWithProof", g, c.largeTx)
+	r.record("getTransactionReceiptByHashWithProof", "getTransactionReceiptByHashWithProof", g, c.largeTx)
+
+	r.record("getTransactionReceipt/deploy", "getTransactionReceipt", g, c.deployTx)
+	r.record("getTransactionReceipt/events", "getTransactionReceipt", g, c.eventsTx)
+	r.record("getTransactionReceipt/failed", "getTransactionReceipt", g, c.failedTx)
+	r.record("getTransactionReceipt/missing", "getTransactionReceipt", g, crypto.Keccak256Hash([]byte("missing receipt")))
+	r.record("getBatchReceiptsByBlockNumberAndRange", "getBatchReceiptsByBlockNumberAndRange", g, strconv.FormatUint(c.eventsBlock, 10), "0", "-1", false)
+
+	r.record("getCode", "getCode", g, c.contract)
+	call := map[string]interface{}{"from": c.deployer, "to": c.contract}
+	if len(c.eventsInput) >= 4 {
+		call["data"] = c.eventsInput[:4]
+	}
+	r.record("call", "call", g, call)
+}
+
+// check compares the shapes of the recorded responses with those of the set
+// of the same name and returns the exit status.
+func check(set *fixtures.Set) int {
+	old, err := fixtures.Load(set.Name)
+	if err != nil {
+		fatalf("Can't load the set to check: %v", err)
+	}
+	var names []string
+	for name := range set.Exchanges {
+		names = append(names, name)
+	}
+	for name := range old.Exchanges {
+		if set.Exchanges[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	status := 0
+	for _, name := range names {
+		have, want := set.Exchanges[name], old.Exchanges[name]
+		var diffs []string
+		switch {
+		case have == nil:
+			diffs = []string{"not recorded"}
+		case want == nil:
+			diffs = []string{"not in the set"}
+		default:
+			diffs = compareShapes("", shape(have), shape(want))
+		}
+		for _, diff := range diffs {
+			fmt.Printf("%s: %s\n", name, diff)
+			status = 1
+		}
+	}
+	if status == 0 {
+		fmt.Printf("All %d exchanges match set %s\n", len(names), set.Name)
+	}
+	return status
+}
+
+// shape returns the structure of the response of an exchange: objects map
+// their keys to the shapes of the values, arrays are represented by their
+// first element and other values by their JSON type.
+func shape(ex *fixtures.Exchange) interface{} {
+	if ex.Error != nil {
+		return "error " + strconv.Itoa(ex.Error.Code)
+	}
+	if ex.Result == nil {
+		return "null"
+	}
+	var v interface{}
+	if err := json.Unmarshal(ex.Result, &v); err != nil {
+		return "invalid"
+	}
+	return shapeOf(v)
+}
+
+func shapeOf(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		fields := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			fields[key] = shapeOf(value)
+		}
+		return fields
+	case []interface{}:
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{shapeOf(v[0])}
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return "null"
+}
+
+func compareShapes(path string, have, want interface{}) []string {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		fields, ok := have.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: object became %v", path, describe(have))}
+		}
+		var diffs []string
+		for key, value := range want {
+			if _, ok := fields[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s removed", path, key))
+				continue
+			}
+			diffs = append(diffs, compareShapes(path+"."+key, fields[key], value)...)
+		}
+		for key := range fields {
+			if _, ok := want[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s added", path, key))
+			}
+		}
+		sort.Strings(diffs)
+		return diffs
+	case []interface{}:
+		elems, ok := have.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: array became %v", path, describe(have))}
+		}
+		// Empty arrays tell nothing about their elements.
+		if len(want) == 0 || len(elems) == 0 {
+			return nil
+		}
+		return compareShapes(path+"[0]", elems[0], want[0])
+	}
+	if have != want {
+		return []string{fmt.Sprintf("%s: %v became %v", path, describe(want), describe(have))}
+	}
+	return nil
+}
+
+func describe(shape interface{}) string {
+	switch shape.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprint(shape)
+}
@@ -0,0 +1,359 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package chaingovernance manages the governance committee, the operators and
+// the frozen accounts of a chain through the chain governance precompiled
+// contract, available since FISCO BCOS 2.5.
+//
+// Changes of the committee and its threshold are voted on by the committee
+// members. Such an operation takes effect once the weights of the members
+// voting for it exceed the threshold, a percentage of the total weight. Until
+// then every vote is merely recorded, see VoteResult.
+package chaingovernance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const chainGovernanceABI = `[
+	{"constant":false,"inputs":[{"name":"user","type":"address"}],"name":"grantCommitteeMember","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"user","type":"address"}],"name":"revokeCommitteeMember","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"listCommitteeMembers","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"user","type":"address"}],"name":"queryCommitteeMemberWeight","outputs":[{"name":"","type":"bool"},{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"user","type":"address"},{"name":"weight","type":"int256"}],"name":"updateCommitteeMemberWeight","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"member","type":"address"}],"name":"queryVotesOfMember","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"queryVotesOfThreshold","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"threshold","type":"int256"}],"name":"updateThreshold","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"queryThreshold","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"user","type":"address"}],"name":"grantOperator","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"user","type":"address"}],"name":"revokeOperator","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"listOperators","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"account","type":"address"}],"name":"freezeAccount","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"account","type":"address"}],"name":"unfreezeAccount","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"account","type":"address"}],"name":"getAccountStatus","outputs":[{"name":"","type":"string"}],"type":"function"}
+]`
+
+// MaxThreshold bounds the threshold, the percentage of the total weight of the
+// committee the votes on an operation must exceed.
+const MaxThreshold = 99
+
+// Member is a committee member or an operator.
+type Member struct {
+	Address   common.Address
+	EnableNum uint64 // block number from which on the role applies
+}
+
+// UnmarshalJSON decodes a record returned by the chain governance contract.
+func (m *Member) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Address   string `json:"address"`
+		EnableNum string `json:"enable_num"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(dec.Address) {
+		return fmt.Errorf("invalid member address %q", dec.Address)
+	}
+	enableNum, err := strconv.ParseUint(dec.EnableNum, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid enable_num %q of member %s", dec.EnableNum, dec.Address)
+	}
+	*m = Member{Address: common.HexToAddress(dec.Address), EnableNum: enableNum}
+	return nil
+}
+
+// Vote is a recorded vote of a committee member on an operation which hasn't
+// taken effect yet.
+type Vote struct {
+	Origin     common.Address // the voting member
+	BlockLimit uint64         // block number until which the vote counts
+}
+
+// UnmarshalJSON decodes a vote returned by the chain governance contract.
+func (v *Vote) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Origin     string `json:"origin"`
+		BlockLimit string `json:"block_limit"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(dec.Origin) {
+		return fmt.Errorf("invalid vote origin %q", dec.Origin)
+	}
+	blockLimit, err := strconv.ParseUint(dec.BlockLimit, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid block_limit %q of vote by %s", dec.BlockLimit, dec.Origin)
+	}
+	*v = Vote{Origin: common.HexToAddress(dec.Origin), BlockLimit: blockLimit}
+	return nil
+}
+
+// Votes are the recorded votes on the operations concerning a member or the
+// threshold, keyed by the operation as named by the contract, like "grant",
+// "revoke" or "update_weight".
+type Votes map[string][]Vote
+
+// VoteResult is the outcome of a voted operation.
+type VoteResult struct {
+	Code      int  // non-negative result code of the contract
+	Effective bool // whether the operation took effect with this vote
+}
+
+// AccountStatus is the status of an account.
+type AccountStatus int
+
+const (
+	AccountAvailable AccountStatus = iota // the account may send transactions
+	AccountFrozen                         // transactions of the account are rejected
+)
+
+func (s AccountStatus) String() string {
+	switch s {
+	case AccountAvailable:
+		return "available"
+	case AccountFrozen:
+		return "frozen"
+	}
+	return fmt.Sprintf("AccountStatus(%d)", int(s))
+}
+
+// Service manages the chain governance.
+type Service struct {
+	governance *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{governance: precompiled.NewContract(precompiled.ChainGovernanceAddress, chainGovernanceABI, backend)}
+}
+
+// GrantCommitteeMember votes for making account a committee member. The first
+// member is granted without votes. It fails with
+// precompiled.ErrCommitteeMemberExists if the account is one already.
+func (s *Service) GrantCommitteeMember(ctx context.Context, opts *bind.TransactOpts, account common.Address) (*VoteResult, error) {
+	code, _, err := s.governance.Transact(ctx, opts, "grantCommitteeMember", account)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.ListCommitteeMembers(ctx, callOpts(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &VoteResult{Code: code, Effective: contains(members, account)}, nil
+}
+
+// RevokeCommitteeMember votes for removing account from the committee. It fails
+// with precompiled.ErrCommitteeMemberNotExist if the account isn't a member.
+func (s *Service) RevokeCommitteeMember(ctx context.Context, opts *bind.TransactOpts, account common.Address) (*VoteResult, error) {
+	code, _, err := s.governance.Transact(ctx, opts, "revokeCommitteeMember", account)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.ListCommitteeMembers(ctx, callOpts(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &VoteResult{Code: code, Effective: !contains(members, account)}, nil
+}
+
+// UpdateCommitteeMemberWeight votes for changing the weight of a committee
+// member. The weight must be positive.
+func (s *Service) UpdateCommitteeMemberWeight(ctx context.Context, opts *bind.TransactOpts, account common.Address, weight int) (*VoteResult, error) {
+	if weight <= 0 {
+		return nil, errors.New("committee member weight must be positive")
+	}
+	code, _, err := s.governance.Transact(ctx, opts, "updateCommitteeMemberWeight", account, big.NewInt(int64(weight)))
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.QueryCommitteeMemberWeight(ctx, callOpts(opts), account)
+	if err != nil {
+		return nil, err
+	}
+	return &VoteResult{Code: code, Effective: current == weight}, nil
+}
+
+// UpdateThreshold votes for changing the threshold of the committee, a
+// percentage between 0 and MaxThreshold. It fails with
+// precompiled.ErrInvalidThreshold for values out of range.
+func (s *Service) UpdateThreshold(ctx context.Context, opts *bind.TransactOpts, threshold int) (*VoteResult, error) {
+	if threshold < 0 || threshold > MaxThreshold {
+		return nil, precompiled.ErrInvalidThreshold
+	}
+	code, _, err := s.governance.Transact(ctx, opts, "updateThreshold", big.NewInt(int64(threshold)))
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.QueryThreshold(ctx, callOpts(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &VoteResult{Code: code, Effective: current == threshold}, nil
+}
+
+// ListCommitteeMembers returns the members of the committee.
+func (s *Service) ListCommitteeMembers(ctx context.Context, opts *bind.CallOpts) ([]Member, error) {
+	return s.listMembers(ctx, opts, "listCommitteeMembers")
+}
+
+// QueryCommitteeMemberWeight returns the weight of the votes of a committee
+// member. It fails with precompiled.ErrCommitteeMemberNotExist if the account
+// isn't a member.
+func (s *Service) QueryCommitteeMemberWeight(ctx context.Context, opts *bind.CallOpts, account common.Address) (int, error) {
+	var (
+		member = new(bool)
+		weight = new(*big.Int)
+	)
+	if err := s.governance.Call(ctx, opts, &[]interface{}{member, weight}, "queryCommitteeMemberWeight", account); err != nil {
+		return 0, err
+	}
+	if !*member {
+		return 0, precompiled.ErrCommitteeMemberNotExist
+	}
+	return int((*weight).Int64()), nil
+}
+
+// QueryThreshold returns the threshold of the committee.
+func (s *Service) QueryThreshold(ctx context.Context, opts *bind.CallOpts) (int, error) {
+	var threshold *big.Int
+	if err := s.governance.Call(ctx, opts, &threshold, "queryThreshold"); err != nil {
+		return 0, err
+	}
+	if err := precompiled.CodeError(int(threshold.Int64())); err != nil {
+		return 0, err
+	}
+	return int(threshold.Int64()), nil
+}
+
+// QueryVotesOfMember returns the recorded votes on the operations concerning a
+// member.
+func (s *Service) QueryVotesOfMember(ctx context.Context, opts *bind.CallOpts, account common.Address) (Votes, error) {
+	return s.queryVotes(ctx, opts, "queryVotesOfMember", account)
+}
+
+// QueryVotesOfThreshold returns the recorded votes on updating the threshold.
+func (s *Service) QueryVotesOfThreshold(ctx context.Context, opts *bind.CallOpts) (Votes, error) {
+	return s.queryVotes(ctx, opts, "queryVotesOfThreshold")
+}
+
+// GrantOperator makes account an operator, allowed to deploy contracts and
+// create tables. Only committee members may grant it. It fails with
+// precompiled.ErrOperatorExists if the account is one already.
+func (s *Service) GrantOperator(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	_, _, err := s.governance.Transact(ctx, opts, "grantOperator", account)
+	return err
+}
+
+// RevokeOperator revokes the operator role of account. It fails with
+// precompiled.ErrOperatorNotExist if the account isn't an operator.
+func (s *Service) RevokeOperator(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	_, _, err := s.governance.Transact(ctx, opts, "revokeOperator", account)
+	return err
+}
+
+// ListOperators returns the operators.
+func (s *Service) ListOperators(ctx context.Context, opts *bind.CallOpts) ([]Member, error) {
+	return s.listMembers(ctx, opts, "listOperators")
+}
+
+// FreezeAccount freezes an account, whose transactions are rejected from then
+// on. It fails with precompiled.ErrAccountFrozen if it's frozen already.
+func (s *Service) FreezeAccount(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	_, _, err := s.governance.Transact(ctx, opts, "freezeAccount", account)
+	return err
+}
+
+// UnfreezeAccount unfreezes an account. It fails with
+// precompiled.ErrAccountAvailable if it isn't frozen.
+func (s *Service) UnfreezeAccount(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	_, _, err := s.governance.Transact(ctx, opts, "unfreezeAccount", account)
+	return err
+}
+
+// GetAccountStatus returns the status of an account. It fails with
+// precompiled.ErrAccountNotExist if the account never sent a transaction.
+func (s *Service) GetAccountStatus(ctx context.Context, opts *bind.CallOpts, account common.Address) (AccountStatus, error) {
+	var result string
+	if err := s.governance.Call(ctx, opts, &result, "getAccountStatus", account); err != nil {
+		return 0, err
+	}
+	// The status is reported by its description, like "The account is
+	// available.", or by a result code.
+	if code, err := strconv.Atoi(result); err == nil {
+		if err := precompiled.CodeError(code); err != nil {
+			return 0, err
+		}
+	}
+	switch msg := strings.ToLower(result); {
+	case strings.Contains(msg, "frozen"):
+		return AccountFrozen, nil
+	case strings.Contains(msg, "available"):
+		return AccountAvailable, nil
+	}
+	return 0, fmt.Errorf("unknown account status %q", result)
+}
+
+func (s *Service) listMembers(ctx context.Context, opts *bind.CallOpts, method string) ([]Member, error) {
+	var result string
+	if err := s.governance.Call(ctx, opts, &result, method); err != nil {
+		return nil, err
+	}
+	var members []Member
+	if err := json.Unmarshal([]byte(result), &members); err != nil {
+		return nil, fmt.Errorf("invalid member records %q: %v", result, err)
+	}
+	return members, nil
+}
+
+func (s *Service) queryVotes(ctx context.Context, opts *bind.CallOpts, method string, params ...interface{}) (Votes, error) {
+	var result string
+	if err := s.governance.Call(ctx, opts, &result, method, params...); err != nil {
+		return nil, err
+	}
+	var votes Votes
+	if err := json.Unmarshal([]byte(result), &votes); err != nil {
+		return nil, fmt.Errorf("invalid vote records %q: %v", result, err)
+	}
+	return votes, nil
+}
+
+// callOpts returns the options to check the outcome of a transaction sent with
+// opts.
+func callOpts(opts *bind.TransactOpts) *bind.CallOpts {
+	return &bind.CallOpts{From: opts.From, GroupId: opts.GroupId}
+}
+
+func contains(members []Member, account common.Address) bool {
+	for _, m := range members {
+		if m.Address == account {
+			return true
+		}
+	}
+	return false
+}
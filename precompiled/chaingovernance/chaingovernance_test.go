@@ -0,0 +1,222 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package chaingovernance
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+var (
+	alice = common.HexToAddress("0xa11ce")
+	bob   = common.HexToAddress("0xb0b")
+)
+
+// committee is a fake chain governance contract where grants take effect
+// with the second vote.
+type committee struct {
+	mu        sync.Mutex
+	members   map[common.Address]int64 // weights
+	votes     map[common.Address]int
+	threshold int64
+}
+
+func (c *committee) list() string {
+	var records []string
+	for member := range c.members {
+		records = append(records, fmt.Sprintf(`{"address":"%s","enable_num":"7"}`, strings.ToLower(member.Hex())))
+	}
+	return "[" + strings.Join(records, ",") + "]"
+}
+
+func newCommittee() (*committee, *precompiledtest.Backend) {
+	c := &committee{members: map[common.Address]int64{alice: 1}, votes: make(map[common.Address]int), threshold: 50}
+	b := precompiledtest.NewBackend()
+	handle := func(method string, fn func(args []interface{}) ([]interface{}, error)) {
+		b.Handle(precompiled.ChainGovernanceAddress, chainGovernanceABI, method, func(args []interface{}) ([]interface{}, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return fn(args)
+		})
+	}
+	handle("grantCommitteeMember", func(args []interface{}) ([]interface{}, error) {
+		account := args[0].(common.Address)
+		if _, ok := c.members[account]; ok {
+			return []interface{}{big.NewInt(-52000)}, nil
+		}
+		if c.votes[account]++; c.votes[account] == 2 {
+			c.members[account] = 1
+		}
+		return []interface{}{big.NewInt(1)}, nil
+	})
+	handle("listCommitteeMembers", func([]interface{}) ([]interface{}, error) {
+		return []interface{}{c.list()}, nil
+	})
+	handle("updateCommitteeMemberWeight", func(args []interface{}) ([]interface{}, error) {
+		c.members[args[0].(common.Address)] = args[1].(*big.Int).Int64()
+		return []interface{}{big.NewInt(1)}, nil
+	})
+	handle("queryCommitteeMemberWeight", func(args []interface{}) ([]interface{}, error) {
+		weight, ok := c.members[args[0].(common.Address)]
+		return []interface{}{ok, big.NewInt(weight)}, nil
+	})
+	handle("updateThreshold", func(args []interface{}) ([]interface{}, error) {
+		c.threshold = args[0].(*big.Int).Int64()
+		return []interface{}{big.NewInt(1)}, nil
+	})
+	handle("queryThreshold", func([]interface{}) ([]interface{}, error) {
+		return []interface{}{big.NewInt(c.threshold)}, nil
+	})
+	return c, b
+}
+
+func TestVotes(t *testing.T) {
+	_, backend := newCommittee()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	result, err := service.GrantCommitteeMember(ctx, precompiledtest.NewTransactor(t), bob)
+	if err != nil || result.Effective || result.Code != 1 {
+		t.Fatalf("first vote: %+v, %v", result, err)
+	}
+	result, err = service.GrantCommitteeMember(ctx, precompiledtest.NewTransactor(t), bob)
+	if err != nil || !result.Effective {
+		t.Fatalf("second vote: %+v, %v", result, err)
+	}
+	if _, err := service.GrantCommitteeMember(ctx, precompiledtest.NewTransactor(t), bob); precompiledtest.CodeErr(err) != precompiled.ErrCommitteeMemberExists {
+		t.Errorf("granting a member: error %v, want %v", err, precompiled.ErrCommitteeMemberExists)
+	}
+
+	result, err = service.UpdateCommitteeMemberWeight(ctx, precompiledtest.NewTransactor(t), bob, 3)
+	if err != nil || !result.Effective {
+		t.Fatalf("UpdateCommitteeMemberWeight: %+v, %v", result, err)
+	}
+	if weight, err := service.QueryCommitteeMemberWeight(ctx, nil, bob); weight != 3 || err != nil {
+		t.Errorf("QueryCommitteeMemberWeight: %d, %v", weight, err)
+	}
+	if _, err := service.QueryCommitteeMemberWeight(ctx, nil, common.Address{1}); err != precompiled.ErrCommitteeMemberNotExist {
+		t.Errorf("weight of a non-member: error %v, want %v", err, precompiled.ErrCommitteeMemberNotExist)
+	}
+	if _, err := service.UpdateCommitteeMemberWeight(ctx, precompiledtest.NewTransactor(t), bob, 0); err == nil {
+		t.Error("updated the weight to 0")
+	}
+
+	result, err = service.UpdateThreshold(ctx, precompiledtest.NewTransactor(t), 66)
+	if err != nil || !result.Effective {
+		t.Fatalf("UpdateThreshold: %+v, %v", result, err)
+	}
+	for _, threshold := range []int{-1, MaxThreshold + 1} {
+		if _, err := service.UpdateThreshold(ctx, precompiledtest.NewTransactor(t), threshold); err != precompiled.ErrInvalidThreshold {
+			t.Errorf("threshold %d: error %v, want %v", threshold, err, precompiled.ErrInvalidThreshold)
+		}
+	}
+	txs := backend.Transactions()
+	if last := txs[len(txs)-1]; last.Method != "updateThreshold" || last.Args[0].(*big.Int).Int64() != 66 {
+		t.Errorf("last transaction %s%v, want updateThreshold(66)", last.Method, last.Args)
+	}
+}
+
+func TestDecoding(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	ctx := context.Background()
+	respond := func(method, result string) {
+		backend.Handle(precompiled.ChainGovernanceAddress, chainGovernanceABI, method, func([]interface{}) ([]interface{}, error) {
+			return []interface{}{result}, nil
+		})
+	}
+
+	respond("listOperators", `[{"address":"0x0000000000000000000000000000000000000b0b","enable_num":"12"}]`)
+	operators, err := service.ListOperators(ctx, nil)
+	if want := []Member{{Address: bob, EnableNum: 12}}; err != nil || !reflect.DeepEqual(operators, want) {
+		t.Errorf("ListOperators: %+v, %v; want %+v", operators, err, want)
+	}
+	respond("listOperators", `[{"address":"0xb0b","enable_num":"x"}]`)
+	if _, err := service.ListOperators(ctx, nil); err == nil {
+		t.Error("ListOperators accepted an invalid record")
+	}
+
+	respond("queryVotesOfMember", `{"grant":[{"block_limit":"100","origin":"0x00000000000000000000000000000000000a11ce"}]}`)
+	votes, err := service.QueryVotesOfMember(ctx, nil, bob)
+	if want := (Votes{"grant": {{Origin: alice, BlockLimit: 100}}}); err != nil || !reflect.DeepEqual(votes, want) {
+		t.Errorf("QueryVotesOfMember: %+v, %v; want %+v", votes, err, want)
+	}
+	respond("queryVotesOfThreshold", `{}`)
+	if votes, err := service.QueryVotesOfThreshold(ctx, nil); err != nil || len(votes) != 0 {
+		t.Errorf("QueryVotesOfThreshold: %+v, %v", votes, err)
+	}
+
+	statuses := []struct {
+		result string
+		want   AccountStatus
+		err    error
+	}{
+		{"The account is available.", AccountAvailable, nil},
+		{"The account has been frozen.", AccountFrozen, nil},
+		{"-52008", 0, precompiled.ErrAccountNotExist},
+	}
+	for _, test := range statuses {
+		respond("getAccountStatus", test.result)
+		status, err := service.GetAccountStatus(ctx, nil, bob)
+		if status != test.want || precompiledtest.CodeErr(err) != test.err {
+			t.Errorf("%q: status %v, error %v; want %v, error %v", test.result, status, err, test.want, test.err)
+		}
+	}
+	respond("getAccountStatus", "unexpected")
+	if _, err := service.GetAccountStatus(ctx, nil, bob); err == nil {
+		t.Error("GetAccountStatus accepted an unknown status")
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	ctx := context.Background()
+	tests := []struct {
+		method string
+		code   int
+		call   func() error
+		want   error
+	}{
+		{"grantOperator", -52004, func() error { return service.GrantOperator(ctx, precompiledtest.NewTransactor(t), alice) }, precompiled.ErrOperatorIsMember},
+		{"grantOperator", -52006, func() error { return service.GrantOperator(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrOperatorExists},
+		{"revokeOperator", -52007, func() error { return service.RevokeOperator(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrOperatorNotExist},
+		{"freezeAccount", -52011, func() error { return service.FreezeAccount(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrAccountFrozen},
+		{"freezeAccount", -52002, func() error { return service.FreezeAccount(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrPermissionDenied},
+		{"unfreezeAccount", -52010, func() error { return service.UnfreezeAccount(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrAccountAvailable},
+		{"unfreezeAccount", -52009, func() error { return service.UnfreezeAccount(ctx, precompiledtest.NewTransactor(t), bob) }, precompiled.ErrInvalidAccountAddress},
+		{"revokeCommitteeMember", -52001, func() error {
+			_, err := service.RevokeCommitteeMember(ctx, precompiledtest.NewTransactor(t), bob)
+			return err
+		}, precompiled.ErrCommitteeMemberNotExist},
+	}
+	for _, test := range tests {
+		backend.Handle(precompiled.ChainGovernanceAddress, chainGovernanceABI, test.method, precompiledtest.Code(test.code))
+		if err := test.call(); precompiledtest.CodeErr(err) != test.want {
+			t.Errorf("%s with code %d: error %v, want %v", test.method, test.code, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package cns registers and looks up contracts by name and version through the
+// Contract Name Service precompiled contract.
+package cns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const cnsABI = `[
+	{"constant":false,"inputs":[{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"addr","type":"string"},{"name":"abi","type":"string"}],"name":"insert","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"name","type":"string"}],"name":"selectByName","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"name","type":"string"},{"name":"version","type":"string"}],"name":"selectByNameAndVersion","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"name","type":"string"},{"name":"version","type":"string"}],"name":"getContractAddress","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+// MaxVersionLength is the longest version the CNS contract accepts.
+const MaxVersionLength = 40
+
+// ErrNotFound is returned if no contract is registered under a name and version.
+// It's bind.ErrNotRegistered, which contracts bound by CNS name report.
+var ErrNotFound = bind.ErrNotRegistered
+
+// Info is a contract registered with CNS.
+type Info struct {
+	Name    string
+	Version string
+	Address common.Address
+	ABI     string
+}
+
+// UnmarshalJSON decodes a record returned by the CNS contract, which keeps the
+// address as it was registered.
+func (info *Info) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Address string `json:"address"`
+		ABI     string `json:"abi"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(dec.Address) {
+		return fmt.Errorf("invalid address %q of contract %s:%s", dec.Address, dec.Name, dec.Version)
+	}
+	*info = Info{Name: dec.Name, Version: dec.Version, Address: common.HexToAddress(dec.Address), ABI: dec.ABI}
+	return nil
+}
+
+// Service registers and looks up contracts.
+type Service struct {
+	cns *precompiled.Contract
+}
+
+// Service resolves the names of contracts bound with bind.NewBoundContractFromCNS.
+var _ bind.NameResolver = (*Service)(nil)
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{cns: precompiled.NewContract(precompiled.CNSAddress, cnsABI, backend)}
+}
+
+// Register registers the contract at address under name and version. It fails
+// with precompiled.ErrContractNameAndVersionExist if the version of the contract
+// is registered already.
+func (s *Service) Register(ctx context.Context, opts *bind.TransactOpts, name, version string, address common.Address, abiJSON string) error {
+	if name == "" || version == "" {
+		return errors.New("contract name and version must not be empty")
+	}
+	if len(version) > MaxVersionLength {
+		return precompiled.ErrVersionTooLong
+	}
+	// The name and version are separated by a colon when resolved.
+	if strings.Contains(name, ":") || strings.Contains(version, ":") {
+		return errors.New("contract name and version must not contain ':'")
+	}
+	_, _, err := s.cns.Transact(ctx, opts, "insert", name, version, address.Hex(), abiJSON)
+	return err
+}
+
+// SelectByName returns all registered versions of a contract, oldest first.
+func (s *Service) SelectByName(ctx context.Context, opts *bind.CallOpts, name string) ([]Info, error) {
+	return s.selectInfos(ctx, opts, "selectByName", name)
+}
+
+// SelectByNameAndVersion returns a version of a contract. It fails with
+// ErrNotFound if it isn't registered.
+func (s *Service) SelectByNameAndVersion(ctx context.Context, opts *bind.CallOpts, name, version string) (*Info, error) {
+	infos, err := s.selectInfos(ctx, opts, "selectByNameAndVersion", name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, ErrNotFound
+	}
+	return &infos[0], nil
+}
+
+func (s *Service) selectInfos(ctx context.Context, opts *bind.CallOpts, method string, params ...interface{}) ([]Info, error) {
+	var result string
+	if err := s.cns.Call(ctx, opts, &result, method, params...); err != nil {
+		return nil, err
+	}
+	var infos []Info
+	if err := json.Unmarshal([]byte(result), &infos); err != nil {
+		return nil, fmt.Errorf("invalid CNS record %q: %v", result, err)
+	}
+	return infos, nil
+}
+
+// GetContractAddress returns the address of a version of a contract. It fails
+// with ErrNotFound if it isn't registered. Nodes older than FISCO BCOS 2.3 lack
+// the method, Resolve works with those too.
+func (s *Service) GetContractAddress(ctx context.Context, opts *bind.CallOpts, name, version string) (common.Address, error) {
+	var address common.Address
+	if err := s.cns.Call(ctx, opts, &address, "getContractAddress", name, version); err != nil {
+		return common.Address{}, err
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, ErrNotFound
+	}
+	return address, nil
+}
+
+// Resolve returns the address of the contract named by ref, which is either
+// "name:version" or just "name" for the latest registered version.
+func (s *Service) Resolve(ctx context.Context, opts *bind.CallOpts, ref string) (common.Address, error) {
+	name, version := ref, ""
+	if i := strings.LastIndex(ref, ":"); i >= 0 {
+		name, version = ref[:i], ref[i+1:]
+	}
+	if version != "" {
+		info, err := s.SelectByNameAndVersion(ctx, opts, name, version)
+		if err != nil {
+			return common.Address{}, err
+		}
+		return info.Address, nil
+	}
+	infos, err := s.SelectByName(ctx, opts, name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(infos) == 0 {
+		return common.Address{}, ErrNotFound
+	}
+	return infos[len(infos)-1].Address, nil
+}
+
+// NewBoundContract binds the contract named by ref, see Resolve, to backend.
+// The address is resolved once, a version registered later isn't picked up; see
+// bind.NewBoundContractFromCNS for bindings following new versions.
+func NewBoundContract(ctx context.Context, backend bind.ContractBackend, ref string, contractABI abi.ABI) (*bind.BoundContract, error) {
+	address, err := NewService(backend).Resolve(ctx, nil, ref)
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, contractABI, backend, backend, backend), nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package cns
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+const records = `[
+	{"name":"HelloWorld","version":"1.0","address":"0x0000000000000000000000000000000000000a01","abi":"[]"},
+	{"name":"HelloWorld","version":"2.0","address":"0x0000000000000000000000000000000000000A02","abi":"[]"}
+]`
+
+// newBackend returns a backend serving the records above.
+func newBackend() *precompiledtest.Backend {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.CNSAddress, cnsABI, "selectByName", func(args []interface{}) ([]interface{}, error) {
+		if args[0] == "HelloWorld" {
+			return []interface{}{records}, nil
+		}
+		return []interface{}{"[]"}, nil
+	})
+	backend.Handle(precompiled.CNSAddress, cnsABI, "selectByNameAndVersion", func(args []interface{}) ([]interface{}, error) {
+		if args[0] == "HelloWorld" && args[1] == "1.0" {
+			return []interface{}{`[{"name":"HelloWorld","version":"1.0","address":"0x0000000000000000000000000000000000000a01","abi":"[]"}]`}, nil
+		}
+		return []interface{}{"[]"}, nil
+	})
+	backend.Handle(precompiled.CNSAddress, cnsABI, "getContractAddress", func(args []interface{}) ([]interface{}, error) {
+		if args[0] == "HelloWorld" && args[1] == "2.0" {
+			return []interface{}{common.HexToAddress("0xa02")}, nil
+		}
+		return []interface{}{common.Address{}}, nil
+	})
+	return backend
+}
+
+func TestRegister(t *testing.T) {
+	backend := newBackend()
+	backend.Handle(precompiled.CNSAddress, cnsABI, "insert", precompiledtest.Code(1))
+	service := NewService(backend)
+	ctx := context.Background()
+
+	address := common.HexToAddress("0xa03")
+	if err := service.Register(ctx, precompiledtest.NewTransactor(t), "HelloWorld", "3.0", address, "[]"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	want := []interface{}{"HelloWorld", "3.0", address.Hex(), "[]"}
+	if args := backend.Transactions()[0].Args; !reflect.DeepEqual(args, want) {
+		t.Errorf("insert arguments %q, want %q", args, want)
+	}
+
+	backend.Handle(precompiled.CNSAddress, cnsABI, "insert", precompiledtest.Code(-51200))
+	err := service.Register(ctx, precompiledtest.NewTransactor(t), "HelloWorld", "1.0", address, "[]")
+	if precompiledtest.CodeErr(err) != precompiled.ErrContractNameAndVersionExist {
+		t.Errorf("registering twice: error %v, want %v", err, precompiled.ErrContractNameAndVersionExist)
+	}
+
+	invalid := []struct{ name, version string }{
+		{"", "1.0"},
+		{"HelloWorld", ""},
+		{"Hello:World", "1.0"},
+		{"HelloWorld", "1:0"},
+		{"HelloWorld", strings.Repeat("1", MaxVersionLength+1)},
+	}
+	for _, test := range invalid {
+		if err := service.Register(ctx, precompiledtest.NewTransactor(t), test.name, test.version, address, "[]"); err == nil {
+			t.Errorf("registered %q version %q", test.name, test.version)
+		}
+	}
+	if n := len(backend.Transactions()); n != 2 {
+		t.Errorf("sent %d transactions, want 2", n)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	service := NewService(newBackend())
+	ctx := context.Background()
+
+	infos, err := service.SelectByName(ctx, nil, "HelloWorld")
+	if err != nil {
+		t.Fatalf("SelectByName error: %v", err)
+	}
+	want := []Info{
+		{Name: "HelloWorld", Version: "1.0", Address: common.HexToAddress("0xa01"), ABI: "[]"},
+		{Name: "HelloWorld", Version: "2.0", Address: common.HexToAddress("0xa02"), ABI: "[]"},
+	}
+	if !reflect.DeepEqual(infos, want) {
+		t.Errorf("SelectByName returned %+v, want %+v", infos, want)
+	}
+	if infos, err := service.SelectByName(ctx, nil, "Missing"); err != nil || len(infos) != 0 {
+		t.Errorf("SelectByName of a missing contract: %v, %v", infos, err)
+	}
+	info, err := service.SelectByNameAndVersion(ctx, nil, "HelloWorld", "1.0")
+	if err != nil || !reflect.DeepEqual(*info, want[0]) {
+		t.Errorf("SelectByNameAndVersion: %+v, %v", info, err)
+	}
+	if _, err := service.SelectByNameAndVersion(ctx, nil, "HelloWorld", "9.0"); err != ErrNotFound {
+		t.Errorf("SelectByNameAndVersion of a missing version: error %v, want %v", err, ErrNotFound)
+	}
+	address, err := service.GetContractAddress(ctx, nil, "HelloWorld", "2.0")
+	if err != nil || address != want[1].Address {
+		t.Errorf("GetContractAddress: %s, %v", address.Hex(), err)
+	}
+	if _, err := service.GetContractAddress(ctx, nil, "HelloWorld", "9.0"); err != ErrNotFound {
+		t.Errorf("GetContractAddress of a missing version: error %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	service := NewService(newBackend())
+	tests := []struct {
+		ref  string
+		want common.Address
+		err  error
+	}{
+		{ref: "HelloWorld", want: common.HexToAddress("0xa02")},
+		{ref: "HelloWorld:1.0", want: common.HexToAddress("0xa01")},
+		{ref: "HelloWorld:9.0", err: ErrNotFound},
+		{ref: "Missing", err: ErrNotFound},
+	}
+	for _, test := range tests {
+		address, err := service.Resolve(context.Background(), nil, test.ref)
+		if address != test.want || err != test.err {
+			t.Errorf("%s: resolved to %s, error %v; want %s, error %v", test.ref, address.Hex(), err, test.want.Hex(), test.err)
+		}
+	}
+}
+
+func TestInvalidRecord(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.CNSAddress, cnsABI, "selectByName", func([]interface{}) ([]interface{}, error) {
+		return []interface{}{`[{"name":"HelloWorld","version":"1.0","address":"not an address","abi":"[]"}]`}, nil
+	})
+	if _, err := NewService(backend).SelectByName(context.Background(), nil, "HelloWorld"); err == nil {
+		t.Error("SelectByName accepted an invalid address")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package config sets the system configuration of a group through the
+// SystemConfig precompiled contract. The values are read with
+// ethclient.Client.SystemConfigByKey.
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const systemConfigABI = `[
+	{"constant":false,"inputs":[{"name":"key","type":"string"},{"name":"value","type":"string"}],"name":"setValueByKey","outputs":[{"name":"","type":"int256"}],"type":"function"}
+]`
+
+// Keys of the system configuration.
+const (
+	TxCountLimit        = "tx_count_limit"         // transactions per block
+	TxGasLimit          = "tx_gas_limit"           // gas per transaction
+	RPBFTEpochSealerNum = "rpbft_epoch_sealer_num" // sealers per rPBFT epoch
+	RPBFTEpochBlockNum  = "rpbft_epoch_block_num"  // blocks per rPBFT epoch
+	ConsensusTimeout    = "consensus_timeout"      // seconds a consensus round may take
+	RPCAuditLog         = "rpc_audit_log"          // whether the node logs RPC requests
+)
+
+// Values the node uses for keys which were never set.
+const (
+	DefaultTxCountLimit     = 1000
+	DefaultTxGasLimit       = 300000000
+	DefaultConsensusTimeout = 3
+	DefaultRPCAuditLog      = false
+)
+
+// keys lists the known keys, in the order of the constants above.
+var keys = []string{TxCountLimit, TxGasLimit, RPBFTEpochSealerNum, RPBFTEpochBlockNum, ConsensusTimeout, RPCAuditLog}
+
+// Keys returns the known keys of the system configuration.
+func Keys() []string {
+	return append([]string(nil), keys...)
+}
+
+// minValues are the smallest values the node accepts for the known keys.
+var minValues = map[string]uint64{
+	TxCountLimit:        1,
+	TxGasLimit:          100000,
+	RPBFTEpochSealerNum: 1,
+	RPBFTEpochBlockNum:  1,
+	ConsensusTimeout:    3,
+}
+
+// Service sets the system configuration.
+type Service struct {
+	config *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{config: precompiled.NewContract(precompiled.SystemConfigAddress, systemConfigABI, backend)}
+}
+
+// SetValueByKey sets a system config of the group of opts. The key and value
+// are validated before sending, see ValidateValue.
+func (s *Service) SetValueByKey(ctx context.Context, opts *bind.TransactOpts, key, value string) error {
+	if err := ValidateValue(key, value); err != nil {
+		return err
+	}
+	_, _, err := s.config.Transact(ctx, opts, "setValueByKey", key, value)
+	return err
+}
+
+// ValidateValue checks that key is one of the known keys and value a number in
+// its range. It fails with precompiled.ErrInvalidConfigValue for values out of
+// range.
+func ValidateValue(key, value string) error {
+	min, ok := minValues[key]
+	if !ok {
+		return fmt.Errorf("unsupported system config key %q", key)
+	}
+	n, err := strconv.ParseUint(value, 10, 63)
+	if err != nil || n < min {
+		return precompiled.ErrInvalidConfigValue
+	}
+	return nil
+}
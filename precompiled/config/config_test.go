@@ -0,0 +1,85 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{TxCountLimit, "1", true},
+		{TxCountLimit, "0", false},
+		{TxCountLimit, "-1", false},
+		{TxCountLimit, "ten", false},
+		{TxGasLimit, "100000", true},
+		{TxGasLimit, "99999", false},
+		{ConsensusTimeout, "3", true},
+		{ConsensusTimeout, "2", false},
+		{RPBFTEpochSealerNum, "4", true},
+		{RPBFTEpochBlockNum, "9223372036854775807", true},
+		{RPBFTEpochBlockNum, "9223372036854775808", false},
+		{"unknown_key", "1", false},
+	}
+	for _, test := range tests {
+		err := ValidateValue(test.key, test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("%s=%s: error %v, want valid %t", test.key, test.value, err, test.ok)
+		}
+	}
+	if err := ValidateValue(TxCountLimit, "0"); err != precompiled.ErrInvalidConfigValue {
+		t.Errorf("value out of range: error %v, want %v", err, precompiled.ErrInvalidConfigValue)
+	}
+}
+
+func TestSetValueByKey(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.SystemConfigAddress, systemConfigABI, "setValueByKey", precompiledtest.Code(1))
+	service := NewService(backend)
+	ctx := context.Background()
+
+	if err := service.SetValueByKey(ctx, precompiledtest.NewTransactor(t), TxCountLimit, "2000"); err != nil {
+		t.Fatalf("SetValueByKey error: %v", err)
+	}
+	want := []interface{}{TxCountLimit, "2000"}
+	if args := backend.Transactions()[0].Args; !reflect.DeepEqual(args, want) {
+		t.Errorf("setValueByKey arguments %q, want %q", args, want)
+	}
+	if err := service.SetValueByKey(ctx, precompiledtest.NewTransactor(t), TxGasLimit, "1"); err != precompiled.ErrInvalidConfigValue {
+		t.Errorf("invalid value: error %v", err)
+	}
+	if n := len(backend.Transactions()); n != 1 {
+		t.Errorf("sent %d transactions, want 1", n)
+	}
+
+	backend.Handle(precompiled.SystemConfigAddress, systemConfigABI, "setValueByKey", precompiledtest.Code(-51300))
+	if err := service.SetValueByKey(ctx, precompiledtest.NewTransactor(t), TxCountLimit, "5"); precompiledtest.CodeErr(err) != precompiled.ErrInvalidConfigValue {
+		t.Errorf("value rejected by the node: error %v, want %v", err, precompiled.ErrInvalidConfigValue)
+	}
+	backend.Handle(precompiled.SystemConfigAddress, systemConfigABI, "setValueByKey", precompiledtest.Code(-50000))
+	if err := service.SetValueByKey(ctx, precompiledtest.NewTransactor(t), TxCountLimit, "5"); !precompiled.IsPermissionDenied(err) {
+		t.Errorf("without permission: error %v, want a permission denial", err)
+	}
+}
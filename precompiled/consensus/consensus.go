@@ -0,0 +1,143 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package consensus manages the sealers and observers of a group through the
+// consensus precompiled contract.
+package consensus
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const consensusABI = `[
+	{"constant":false,"inputs":[{"name":"nodeID","type":"string"}],"name":"addSealer","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"nodeID","type":"string"}],"name":"addObserver","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"nodeID","type":"string"}],"name":"remove","outputs":[{"name":"","type":"int256"}],"type":"function"}
+]`
+
+// nodeIDLength is the length of node IDs, the hex encoded public key of a node.
+const nodeIDLength = 128
+
+// Backend is the client the service sends transactions through and reads the
+// node lists from. *ethclient.Client implements it.
+type Backend interface {
+	bind.ContractBackend
+	fiscobcos.GroupReader
+}
+
+// Service manages the consensus nodes of a group. The group is the one of the
+// options passed to its methods.
+type Service struct {
+	backend   Backend
+	consensus *precompiled.Contract
+}
+
+// NewService creates a service using the given backend.
+func NewService(backend Backend) *Service {
+	return &Service{
+		backend:   backend,
+		consensus: precompiled.NewContract(precompiled.ConsensusAddress, consensusABI, backend),
+	}
+}
+
+// AddSealer turns a node of the group into a sealer, which takes part in the
+// consensus. It fails with precompiled.ErrAlreadySealer if it's one already.
+func (s *Service) AddSealer(ctx context.Context, opts *bind.TransactOpts, nodeID string) error {
+	if err := ValidateNodeID(nodeID); err != nil {
+		return err
+	}
+	nodeID = strings.ToLower(nodeID) // as listed by the node
+	sealers, err := s.backend.SealerList(ctx, uint64(opts.GroupId))
+	if err != nil {
+		return err
+	}
+	if contains(sealers, nodeID) {
+		return precompiled.ErrAlreadySealer
+	}
+	_, _, err = s.consensus.Transact(ctx, opts, "addSealer", nodeID)
+	return err
+}
+
+// AddObserver turns a node of the group into an observer, which syncs the
+// blocks without taking part in the consensus. It fails with
+// precompiled.ErrAlreadyObserver if it's one already.
+func (s *Service) AddObserver(ctx context.Context, opts *bind.TransactOpts, nodeID string) error {
+	if err := ValidateNodeID(nodeID); err != nil {
+		return err
+	}
+	nodeID = strings.ToLower(nodeID) // as listed by the node
+	observers, err := s.backend.ObserverList(ctx, uint64(opts.GroupId))
+	if err != nil {
+		return err
+	}
+	if contains(observers, nodeID) {
+		return precompiled.ErrAlreadyObserver
+	}
+	_, _, err = s.consensus.Transact(ctx, opts, "addObserver", nodeID)
+	return err
+}
+
+// RemoveNode removes a sealer or observer from the group. It fails with
+// precompiled.ErrNodeNotExist if the node is neither and with
+// precompiled.ErrLastSealer if it's the only sealer left.
+func (s *Service) RemoveNode(ctx context.Context, opts *bind.TransactOpts, nodeID string) error {
+	if err := ValidateNodeID(nodeID); err != nil {
+		return err
+	}
+	nodeID = strings.ToLower(nodeID) // as listed by the node
+	sealers, err := s.backend.SealerList(ctx, uint64(opts.GroupId))
+	if err != nil {
+		return err
+	}
+	if !contains(sealers, nodeID) {
+		observers, err := s.backend.ObserverList(ctx, uint64(opts.GroupId))
+		if err != nil {
+			return err
+		}
+		if !contains(observers, nodeID) {
+			return precompiled.ErrNodeNotExist
+		}
+	}
+	_, _, err = s.consensus.Transact(ctx, opts, "remove", nodeID)
+	return err
+}
+
+// ValidateNodeID checks that nodeID is a node ID, 128 hex digits without prefix,
+// failing with precompiled.ErrInvalidNodeID otherwise.
+func ValidateNodeID(nodeID string) error {
+	if len(nodeID) != nodeIDLength {
+		return precompiled.ErrInvalidNodeID
+	}
+	if _, err := hex.DecodeString(nodeID); err != nil {
+		return precompiled.ErrInvalidNodeID
+	}
+	return nil
+}
+
+func contains(nodeIDs []string, nodeID string) bool {
+	for _, id := range nodeIDs {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
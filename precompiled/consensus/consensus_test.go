@@ -0,0 +1,124 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+var (
+	sealer   = strings.Repeat("a1", 64)
+	observer = strings.Repeat("b2", 64)
+	other    = strings.Repeat("c3", 64)
+)
+
+// testBackend serves fixed node lists.
+type testBackend struct {
+	*precompiledtest.Backend
+	sealers, observers []string
+}
+
+func (b *testBackend) GroupList(ctx context.Context) ([]int64, error) { return []int64{1}, nil }
+func (b *testBackend) GroupPeers(ctx context.Context, groupId uint64) ([]string, error) {
+	return append(b.sealers, b.observers...), nil
+}
+func (b *testBackend) NodeIDList(ctx context.Context, groupId uint64) ([]string, error) {
+	return b.GroupPeers(ctx, groupId)
+}
+func (b *testBackend) SealerList(ctx context.Context, groupId uint64) ([]string, error) {
+	return b.sealers, nil
+}
+func (b *testBackend) ObserverList(ctx context.Context, groupId uint64) ([]string, error) {
+	return b.observers, nil
+}
+
+func newTestBackend() *testBackend {
+	backend := &testBackend{Backend: precompiledtest.NewBackend(), sealers: []string{sealer}, observers: []string{observer}}
+	for _, method := range []string{"addSealer", "addObserver", "remove"} {
+		backend.Handle(precompiled.ConsensusAddress, consensusABI, method, precompiledtest.Code(1))
+	}
+	return backend
+}
+
+func TestValidateNodeID(t *testing.T) {
+	valid := []string{sealer, strings.ToUpper(other)}
+	for _, id := range valid {
+		if err := ValidateNodeID(id); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+	invalid := []string{"", sealer[2:], "0x" + sealer[2:], sealer + "00", strings.Repeat("zz", 64)}
+	for _, id := range invalid {
+		if err := ValidateNodeID(id); err != precompiled.ErrInvalidNodeID {
+			t.Errorf("%q: error %v, want %v", id, err, precompiled.ErrInvalidNodeID)
+		}
+	}
+}
+
+func TestNodeChanges(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		change func(*Service, *bind.TransactOpts) error
+		method string // sent transaction, "" for none
+		err    error
+	}{
+		{"add sealer", func(s *Service, o *bind.TransactOpts) error { return s.AddSealer(ctx, o, strings.ToUpper(other)) }, "addSealer", nil},
+		{"add sealer twice", func(s *Service, o *bind.TransactOpts) error { return s.AddSealer(ctx, o, sealer) }, "", precompiled.ErrAlreadySealer},
+		{"add observer", func(s *Service, o *bind.TransactOpts) error { return s.AddObserver(ctx, o, sealer) }, "addObserver", nil},
+		{"add observer twice", func(s *Service, o *bind.TransactOpts) error { return s.AddObserver(ctx, o, observer) }, "", precompiled.ErrAlreadyObserver},
+		{"remove sealer", func(s *Service, o *bind.TransactOpts) error { return s.RemoveNode(ctx, o, sealer) }, "remove", nil},
+		{"remove observer", func(s *Service, o *bind.TransactOpts) error { return s.RemoveNode(ctx, o, observer) }, "remove", nil},
+		{"remove other", func(s *Service, o *bind.TransactOpts) error { return s.RemoveNode(ctx, o, other) }, "", precompiled.ErrNodeNotExist},
+		{"invalid ID", func(s *Service, o *bind.TransactOpts) error { return s.AddSealer(ctx, o, "1234") }, "", precompiled.ErrInvalidNodeID},
+	}
+	for _, test := range tests {
+		backend := newTestBackend()
+		err := test.change(NewService(backend), precompiledtest.NewTransactor(t))
+		if err != test.err {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+		txs := backend.Transactions()
+		switch {
+		case test.method == "" && len(txs) != 0:
+			t.Errorf("%s: sent %s", test.name, txs[0].Method)
+		case test.method != "" && (len(txs) != 1 || txs[0].Method != test.method):
+			t.Errorf("%s: sent %v, want %s", test.name, txs, test.method)
+		case test.method != "" && txs[0].Args[0] != strings.ToLower(txs[0].Args[0].(string)):
+			t.Errorf("%s: node ID %s not lower case", test.name, txs[0].Args[0])
+		}
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := newTestBackend()
+	service := NewService(backend)
+	backend.Handle(precompiled.ConsensusAddress, consensusABI, "remove", precompiledtest.Code(-51101))
+	if err := service.RemoveNode(context.Background(), precompiledtest.NewTransactor(t), sealer); precompiledtest.CodeErr(err) != precompiled.ErrLastSealer {
+		t.Errorf("removing the last sealer: error %v, want %v", err, precompiled.ErrLastSealer)
+	}
+	backend.Handle(precompiled.ConsensusAddress, consensusABI, "addSealer", precompiledtest.Code(-51102))
+	if err := service.AddSealer(context.Background(), precompiledtest.NewTransactor(t), other); precompiledtest.CodeErr(err) != precompiled.ErrNodeNotReachable {
+		t.Errorf("adding an unreachable sealer: error %v, want %v", err, precompiled.ErrNodeNotReachable)
+	}
+}
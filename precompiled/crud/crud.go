@@ -0,0 +1,210 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package crud manages user tables through the TableFactory and CRUD precompiled
+// contracts.
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const tableFactoryABI = `[
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"valueField","type":"string"}],"name":"createTable","outputs":[{"name":"","type":"int256"}],"type":"function"}
+]`
+
+const crudABI = `[
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"entry","type":"string"},{"name":"optional","type":"string"}],"name":"insert","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"entry","type":"string"},{"name":"condition","type":"string"},{"name":"optional","type":"string"}],"name":"update","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"condition","type":"string"},{"name":"optional","type":"string"}],"name":"remove","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"condition","type":"string"},{"name":"optional","type":"string"}],"name":"select","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"tableName","type":"string"}],"name":"desc","outputs":[{"name":"","type":"string"},{"name":"","type":"string"}],"type":"function"}
+]`
+
+// Entry is a record of a table, mapping field names to values.
+type Entry map[string]string
+
+// Condition selects the entries of a table an operation applies to, beyond
+// their key. The zero value and nil select all entries with the key.
+type Condition struct {
+	fields map[string]map[string]string // field name to operator to operand
+	limit  string
+}
+
+// NewCondition returns an empty condition.
+func NewCondition() *Condition {
+	return new(Condition)
+}
+
+func (c *Condition) add(field, op, value string) *Condition {
+	if c.fields == nil {
+		c.fields = make(map[string]map[string]string)
+	}
+	if c.fields[field] == nil {
+		c.fields[field] = make(map[string]string)
+	}
+	c.fields[field][op] = value
+	return c
+}
+
+// Eq requires the field to equal value.
+func (c *Condition) Eq(field, value string) *Condition { return c.add(field, "eq", value) }
+
+// Ne requires the field to differ from value.
+func (c *Condition) Ne(field, value string) *Condition { return c.add(field, "ne", value) }
+
+// Gt requires the field, compared as a number, to be greater than value.
+func (c *Condition) Gt(field, value string) *Condition { return c.add(field, "gt", value) }
+
+// Ge requires the field, compared as a number, to be at least value.
+func (c *Condition) Ge(field, value string) *Condition { return c.add(field, "ge", value) }
+
+// Lt requires the field, compared as a number, to be less than value.
+func (c *Condition) Lt(field, value string) *Condition { return c.add(field, "lt", value) }
+
+// Le requires the field, compared as a number, to be at most value.
+func (c *Condition) Le(field, value string) *Condition { return c.add(field, "le", value) }
+
+// Limit restricts the operation to count entries, skipping the first offset.
+func (c *Condition) Limit(offset, count uint) *Condition {
+	c.limit = fmt.Sprintf("%d,%d", offset, count)
+	return c
+}
+
+// MarshalJSON encodes the condition as the CRUD contract expects it, e.g.
+// {"age":{"gt":"18"},"limit":{"limit":"0,10"}}.
+func (c *Condition) MarshalJSON() ([]byte, error) {
+	enc := make(map[string]map[string]string)
+	if c != nil {
+		for field, ops := range c.fields {
+			enc[field] = ops
+		}
+		if c.limit != "" {
+			enc["limit"] = map[string]string{"limit": c.limit}
+		}
+	}
+	return json.Marshal(enc)
+}
+
+// encode marshals the condition, json.Marshal would turn nil into null.
+func (c *Condition) encode() (string, error) {
+	enc, err := c.MarshalJSON()
+	return string(enc), err
+}
+
+// Service manages user tables. Modifications are sent as transactions and wait
+// for them to be executed.
+type Service struct {
+	factory *precompiled.Contract
+	crud    *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{
+		factory: precompiled.NewContract(precompiled.TableFactoryAddress, tableFactoryABI, backend),
+		crud:    precompiled.NewContract(precompiled.CRUDAddress, crudABI, backend),
+	}
+}
+
+// CreateTable creates a table with the given key field and value fields. It
+// fails with precompiled.ErrTableExists if the table exists already.
+func (s *Service) CreateTable(ctx context.Context, opts *bind.TransactOpts, tableName, key string, fields []string) error {
+	if tableName == "" || key == "" {
+		return errors.New("table name and key field must not be empty")
+	}
+	_, _, err := s.factory.Transact(ctx, opts, "createTable", tableName, key, strings.Join(fields, ","))
+	return err
+}
+
+// Insert adds an entry with the given key to a table, returning the number of
+// inserted entries.
+func (s *Service) Insert(ctx context.Context, opts *bind.TransactOpts, tableName, key string, entry Entry) (int, error) {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	count, _, err := s.crud.Transact(ctx, opts, "insert", tableName, key, string(entryJSON), "")
+	return count, err
+}
+
+// Update sets the fields of entry on the entries with the given key matching
+// cond, returning the number of updated entries.
+func (s *Service) Update(ctx context.Context, opts *bind.TransactOpts, tableName, key string, entry Entry, cond *Condition) (int, error) {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	condJSON, err := cond.encode()
+	if err != nil {
+		return 0, err
+	}
+	count, _, err := s.crud.Transact(ctx, opts, "update", tableName, key, string(entryJSON), condJSON, "")
+	return count, err
+}
+
+// Remove deletes the entries with the given key matching cond, returning the
+// number of removed entries.
+func (s *Service) Remove(ctx context.Context, opts *bind.TransactOpts, tableName, key string, cond *Condition) (int, error) {
+	condJSON, err := cond.encode()
+	if err != nil {
+		return 0, err
+	}
+	count, _, err := s.crud.Transact(ctx, opts, "remove", tableName, key, condJSON, "")
+	return count, err
+}
+
+// Select returns the entries with the given key matching cond. opts may be nil.
+func (s *Service) Select(ctx context.Context, opts *bind.CallOpts, tableName, key string, cond *Condition) ([]Entry, error) {
+	condJSON, err := cond.encode()
+	if err != nil {
+		return nil, err
+	}
+	var result string
+	if err := s.crud.Call(ctx, opts, &result, "select", tableName, key, condJSON, ""); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal([]byte(result), &entries); err != nil {
+		return nil, fmt.Errorf("invalid select result %q: %v", result, err)
+	}
+	return entries, nil
+}
+
+// Desc returns the key field and the value fields of a table. It fails with
+// precompiled.ErrTableNotExist if there is no such table.
+func (s *Service) Desc(ctx context.Context, opts *bind.CallOpts, tableName string) (key string, fields []string, err error) {
+	var valueFields string
+	out := &[]interface{}{&key, &valueFields}
+	if err := s.crud.Call(ctx, opts, out, "desc", tableName); err != nil {
+		return "", nil, err
+	}
+	if key == "" {
+		return "", nil, precompiled.ErrTableNotExist
+	}
+	if valueFields != "" {
+		fields = strings.Split(valueFields, ",")
+	}
+	return key, fields, nil
+}
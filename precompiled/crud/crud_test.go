@@ -0,0 +1,158 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+func TestConditionJSON(t *testing.T) {
+	tests := []struct {
+		cond *Condition
+		want string
+	}{
+		{nil, `{}`},
+		{NewCondition(), `{}`},
+		{NewCondition().Eq("name", "alice").Gt("age", "18"), `{"age":{"gt":"18"},"name":{"eq":"alice"}}`},
+		{NewCondition().Ge("age", "1").Le("age", "9").Limit(5, 10), `{"age":{"ge":"1","le":"9"},"limit":{"limit":"5,10"}}`},
+	}
+	for _, test := range tests {
+		got, err := test.cond.encode()
+		if err != nil || got != test.want {
+			t.Errorf("got %s, error %v; want %s", got, err, test.want)
+		}
+	}
+}
+
+func TestModifications(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.TableFactoryAddress, tableFactoryABI, "createTable", precompiledtest.Code(0))
+	backend.Handle(precompiled.CRUDAddress, crudABI, "insert", precompiledtest.Code(1))
+	backend.Handle(precompiled.CRUDAddress, crudABI, "update", precompiledtest.Code(2))
+	backend.Handle(precompiled.CRUDAddress, crudABI, "remove", precompiledtest.Code(3))
+	service := NewService(backend)
+	ctx := context.Background()
+	opts := precompiledtest.NewTransactor(t)
+
+	if err := service.CreateTable(ctx, opts, "t_test", "name", []string{"item_id", "item_name"}); err != nil {
+		t.Fatalf("CreateTable error: %v", err)
+	}
+	entry := Entry{"item_id": "1", "item_name": "apple"}
+	if n, err := service.Insert(ctx, opts, "t_test", "fruit", entry); n != 1 || err != nil {
+		t.Fatalf("Insert: %d, %v", n, err)
+	}
+	cond := NewCondition().Eq("item_id", "1")
+	if n, err := service.Update(ctx, opts, "t_test", "fruit", Entry{"item_name": "pear"}, cond); n != 2 || err != nil {
+		t.Fatalf("Update: %d, %v", n, err)
+	}
+	if n, err := service.Remove(ctx, opts, "t_test", "fruit", nil); n != 3 || err != nil {
+		t.Fatalf("Remove: %d, %v", n, err)
+	}
+
+	want := [][]interface{}{
+		{"t_test", "name", "item_id,item_name"},
+		{"t_test", "fruit", `{"item_id":"1","item_name":"apple"}`, ""},
+		{"t_test", "fruit", `{"item_name":"pear"}`, `{"item_id":{"eq":"1"}}`, ""},
+		{"t_test", "fruit", `{}`, ""},
+	}
+	txs := backend.Transactions()
+	if len(txs) != len(want) {
+		t.Fatalf("sent %d transactions, want %d", len(txs), len(want))
+	}
+	for i, tx := range txs {
+		if !reflect.DeepEqual(tx.Args, want[i]) {
+			t.Errorf("%s arguments %q, want %q", tx.Method, tx.Args, want[i])
+		}
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	backend.Handle(precompiled.TableFactoryAddress, tableFactoryABI, "createTable", precompiledtest.Code(-50001))
+	if err := service.CreateTable(ctx, precompiledtest.NewTransactor(t), "t_test", "name", nil); precompiledtest.CodeErr(err) != precompiled.ErrTableExists {
+		t.Errorf("CreateTable error %v, want %v", err, precompiled.ErrTableExists)
+	}
+	backend.Handle(precompiled.CRUDAddress, crudABI, "insert", precompiledtest.Code(-50000))
+	if _, err := service.Insert(ctx, precompiledtest.NewTransactor(t), "t_test", "k", Entry{}); !precompiled.IsPermissionDenied(err) {
+		t.Errorf("Insert error %v, want a permission denial", err)
+	}
+	backend.Handle(precompiled.CRUDAddress, crudABI, "update", precompiledtest.Code(-50007))
+	if _, err := service.Update(ctx, precompiledtest.NewTransactor(t), "t_test", "k", Entry{}, nil); precompiledtest.CodeErr(err) != precompiled.ErrDuplicateField {
+		t.Errorf("Update error %v, want %v", err, precompiled.ErrDuplicateField)
+	}
+	if err := service.CreateTable(ctx, precompiledtest.NewTransactor(t), "", "name", nil); err == nil {
+		t.Error("CreateTable accepted an empty table name")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	entries := []Entry{{"name": "fruit", "item_id": "1"}, {"name": "fruit", "item_id": "2"}}
+	backend.Handle(precompiled.CRUDAddress, crudABI, "select", func(args []interface{}) ([]interface{}, error) {
+		if args[2] != `{"item_id":{"lt":"3"}}` {
+			t.Errorf("select condition %q", args[2])
+		}
+		enc, _ := json.Marshal(entries)
+		return []interface{}{string(enc)}, nil
+	})
+	got, err := service.Select(context.Background(), nil, "t_test", "fruit", NewCondition().Lt("item_id", "3"))
+	if err != nil {
+		t.Fatalf("Select error: %v", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("Select returned %v, want %v", got, entries)
+	}
+
+	backend.Handle(precompiled.CRUDAddress, crudABI, "select", func([]interface{}) ([]interface{}, error) {
+		return []interface{}{"not json"}, nil
+	})
+	if _, err := service.Select(context.Background(), nil, "t_test", "fruit", nil); err == nil {
+		t.Error("Select accepted an invalid result")
+	}
+}
+
+func TestDesc(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	backend.Handle(precompiled.CRUDAddress, crudABI, "desc", func(args []interface{}) ([]interface{}, error) {
+		if args[0] == "t_test" {
+			return []interface{}{"name", "item_id,item_name"}, nil
+		}
+		return []interface{}{"", ""}, nil
+	})
+	key, fields, err := service.Desc(context.Background(), &bind.CallOpts{GroupId: 2}, "t_test")
+	if err != nil || key != "name" || !reflect.DeepEqual(fields, []string{"item_id", "item_name"}) {
+		t.Errorf("Desc: %q, %q, %v", key, fields, err)
+	}
+	if group := backend.Invocations()[0].Group; group != 2 {
+		t.Errorf("Desc called in group %d, want 2", group)
+	}
+	if _, _, err := service.Desc(context.Background(), nil, "t_missing"); err != precompiled.ErrTableNotExist {
+		t.Errorf("Desc of a missing table: error %v, want %v", err, precompiled.ErrTableNotExist)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package kvtable stores entries by key in key-value tables, the tables solidity
+// contracts use through the KVTableFactory precompiled contract.
+//
+// Every key of a key-value table holds at most one entry. The tables are created
+// through KVTableFactory and accessed through the CRUD precompiled contract, as
+// the KVTable interface itself is only usable from contracts.
+package kvtable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/crud"
+)
+
+const kvTableFactoryABI = `[
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"valueFields","type":"string"}],"name":"createTable","outputs":[{"name":"","type":"int256"}],"type":"function"}
+]`
+
+// Limits of the user tables in bytes. Some node versions silently truncate
+// longer values instead of rejecting them, so they are checked before sending.
+const (
+	MaxTableNameLength = 48
+	MaxFieldNameLength = 64
+	MaxKeyLength       = 255
+	MaxValueLength     = 16*1024*1024 - 1
+)
+
+// Service stores entries in key-value tables.
+type Service struct {
+	factory *precompiled.Contract
+	crud    *crud.Service
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{
+		factory: precompiled.NewContract(precompiled.KVTableFactoryAddress, kvTableFactoryABI, backend),
+		crud:    crud.NewService(backend),
+	}
+}
+
+// CreateTable creates a key-value table with the given key field and value
+// fields. It fails with precompiled.ErrTableExists if the table exists already.
+func (s *Service) CreateTable(ctx context.Context, opts *bind.TransactOpts, tableName, key string, fields []string) error {
+	if tableName == "" || key == "" {
+		return errors.New("table name and key field must not be empty")
+	}
+	if len(tableName) > MaxTableNameLength {
+		return precompiled.ErrTableNameTooLong
+	}
+	for _, field := range append([]string{key}, fields...) {
+		if err := validateFieldName(field); err != nil {
+			return err
+		}
+	}
+	_, _, err := s.factory.Transact(ctx, opts, "createTable", tableName, key, strings.Join(fields, ","))
+	return err
+}
+
+// Set stores entry under key. An entry stored before is updated, keeping the
+// values of the fields entry lacks. The key field of the table is set to key.
+func (s *Service) Set(ctx context.Context, opts *bind.TransactOpts, tableName, key string, entry crud.Entry) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	for field, value := range entry {
+		if err := validateFieldName(field); err != nil {
+			return err
+		}
+		if err := validateValue(field, value); err != nil {
+			return err
+		}
+	}
+	keyField, _, err := s.crud.Desc(ctx, callOpts(opts), tableName)
+	if err != nil {
+		return err
+	}
+	if value, ok := entry[keyField]; ok && value != key {
+		return fmt.Errorf("key field %s is %q, not the key %q", keyField, value, key)
+	}
+	stored := make(crud.Entry, len(entry)+1)
+	for field, value := range entry {
+		stored[field] = value
+	}
+	stored[keyField] = key
+
+	existing, err := s.crud.Select(ctx, callOpts(opts), tableName, key, nil)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		_, err = s.crud.Insert(ctx, opts, tableName, key, stored)
+	} else {
+		_, err = s.crud.Update(ctx, opts, tableName, key, stored, nil)
+	}
+	return err
+}
+
+// Get returns the entry stored under key, reporting whether there is one. opts
+// may be nil.
+func (s *Service) Get(ctx context.Context, opts *bind.CallOpts, tableName, key string) (bool, crud.Entry, error) {
+	if err := validateKey(key); err != nil {
+		return false, nil, err
+	}
+	entries, err := s.crud.Select(ctx, opts, tableName, key, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(entries) == 0 {
+		return false, nil, nil
+	}
+	return true, entries[0], nil
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("key %q is not valid UTF-8", key)
+	}
+	if len(key) > MaxKeyLength {
+		return precompiled.ErrKeyValueTooLong
+	}
+	return nil
+}
+
+func validateFieldName(field string) error {
+	if field == "" || !utf8.ValidString(field) {
+		return fmt.Errorf("invalid field name %q", field)
+	}
+	if len(field) > MaxFieldNameLength {
+		return precompiled.ErrFieldNameTooLong
+	}
+	return nil
+}
+
+// validateValue rejects values which can't be stored unchanged. Invalid UTF-8
+// would be replaced when the entry is encoded to JSON.
+func validateValue(field, value string) error {
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("value of field %s is not valid UTF-8", field)
+	}
+	if len(value) > MaxValueLength {
+		return precompiled.ErrFieldValueTooLong
+	}
+	return nil
+}
+
+// callOpts returns the options to read the table a transaction sent with opts
+// modifies.
+func callOpts(opts *bind.TransactOpts) *bind.CallOpts {
+	return &bind.CallOpts{From: opts.From, GroupId: opts.GroupId}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package kvtable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/crud"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+// crudABI is the part of the CRUD contract ABI the service uses.
+const crudABI = `[
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"entry","type":"string"},{"name":"optional","type":"string"}],"name":"insert","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"entry","type":"string"},{"name":"condition","type":"string"},{"name":"optional","type":"string"}],"name":"update","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"tableName","type":"string"},{"name":"key","type":"string"},{"name":"condition","type":"string"},{"name":"optional","type":"string"}],"name":"select","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"tableName","type":"string"}],"name":"desc","outputs":[{"name":"","type":"string"},{"name":"","type":"string"}],"type":"function"}
+]`
+
+// table is a fake key-value table named "t_kv" with the key field "id".
+type table struct {
+	mu      sync.Mutex
+	entries map[string]crud.Entry
+}
+
+func newTable() (*table, *precompiledtest.Backend) {
+	tb := &table{entries: make(map[string]crud.Entry)}
+	b := precompiledtest.NewBackend()
+	b.Handle(precompiled.KVTableFactoryAddress, kvTableFactoryABI, "createTable", precompiledtest.Code(0))
+	b.Handle(precompiled.CRUDAddress, crudABI, "desc", func(args []interface{}) ([]interface{}, error) {
+		if args[0] != "t_kv" {
+			return []interface{}{"", ""}, nil
+		}
+		return []interface{}{"id", "name,json"}, nil
+	})
+	b.Handle(precompiled.CRUDAddress, crudABI, "select", func(args []interface{}) ([]interface{}, error) {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+		entries := []crud.Entry{}
+		if entry, ok := tb.entries[args[1].(string)]; ok {
+			entries = append(entries, entry)
+		}
+		enc, err := json.Marshal(entries)
+		return []interface{}{string(enc)}, err
+	})
+	store := func(args []interface{}) ([]interface{}, error) {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+		var entry crud.Entry
+		if err := json.Unmarshal([]byte(args[2].(string)), &entry); err != nil {
+			return nil, err
+		}
+		key := args[1].(string)
+		if tb.entries[key] == nil {
+			tb.entries[key] = make(crud.Entry)
+		}
+		for field, value := range entry {
+			tb.entries[key][field] = value
+		}
+		return []interface{}{big.NewInt(1)}, nil
+	}
+	b.Handle(precompiled.CRUDAddress, crudABI, "insert", store)
+	b.Handle(precompiled.CRUDAddress, crudABI, "update", store)
+	return tb, b
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, backend := newTable()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	var doc strings.Builder
+	doc.WriteString(`{"items":[`)
+	for i := 0; i < 500; i++ {
+		if i > 0 {
+			doc.WriteString(",")
+		}
+		fmt.Fprintf(&doc, `{"n":%d,"s":"条目 %d \"quoted\" \\ <tag>"}`, i, i)
+	}
+	doc.WriteString(`]}`)
+	tests := []struct {
+		key   string
+		entry crud.Entry
+	}{
+		{"plain", crud.Entry{"name": "apple"}},
+		{"键值", crud.Entry{"name": "苹果 🍎", "json": `{"emoji":"😀"}`}},
+		{"Ünïcödé key with spaces", crud.Entry{"name": "é́ combining"}},
+		{"large", crud.Entry{"json": doc.String()}},
+		{strings.Repeat("键", MaxKeyLength/3), crud.Entry{"name": "longest key"}},
+	}
+	for _, test := range tests {
+		if err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_kv", test.key, test.entry); err != nil {
+			t.Fatalf("Set %q: %v", test.key, err)
+		}
+		found, entry, err := service.Get(ctx, nil, "t_kv", test.key)
+		if err != nil || !found {
+			t.Fatalf("Get %q: found %t, error %v", test.key, found, err)
+		}
+		want := crud.Entry{"id": test.key}
+		for field, value := range test.entry {
+			want[field] = value
+		}
+		if !reflect.DeepEqual(entry, want) {
+			t.Errorf("Get %q returned %q, want %q", test.key, entry, want)
+		}
+	}
+	if len(doc.String()) < 16*1024 {
+		t.Fatalf("large value has only %d bytes", len(doc.String()))
+	}
+
+	if found, _, err := service.Get(ctx, nil, "t_kv", "missing"); found || err != nil {
+		t.Errorf("Get of a missing key: found %t, error %v", found, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tb, backend := newTable()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	if err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_kv", "k", crud.Entry{"name": "a", "json": "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_kv", "k", crud.Entry{"name": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	var methods []string
+	for _, tx := range backend.Transactions() {
+		methods = append(methods, tx.Method)
+	}
+	if want := []string{"insert", "update"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("sent %v, want %v", methods, want)
+	}
+	if want := (crud.Entry{"id": "k", "name": "b", "json": "{}"}); !reflect.DeepEqual(tb.entries["k"], want) {
+		t.Errorf("stored %q, want %q", tb.entries["k"], want)
+	}
+	if err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_kv", "k", crud.Entry{"id": "other"}); err == nil {
+		t.Error("Set accepted a key field differing from the key")
+	}
+	if err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_missing", "k", crud.Entry{"name": "a"}); err != precompiled.ErrTableNotExist {
+		t.Errorf("Set in a missing table: error %v, want %v", err, precompiled.ErrTableNotExist)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	_, backend := newTable()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	tests := []struct {
+		key   string
+		entry crud.Entry
+		want  error // nil for errors without variable
+	}{
+		{strings.Repeat("k", MaxKeyLength+1), nil, precompiled.ErrKeyValueTooLong},
+		{strings.Repeat("键", MaxKeyLength/3+1), nil, precompiled.ErrKeyValueTooLong},
+		{"k", crud.Entry{strings.Repeat("f", MaxFieldNameLength+1): "v"}, precompiled.ErrFieldNameTooLong},
+		{"k", crud.Entry{"json": strings.Repeat("v", MaxValueLength+1)}, precompiled.ErrFieldValueTooLong},
+		{"", nil, nil},
+		{"\xff", nil, nil},
+		{"k", crud.Entry{"name": "\xff"}, nil},
+		{"k", crud.Entry{"": "v"}, nil},
+	}
+	for i, test := range tests {
+		err := service.Set(ctx, precompiledtest.NewTransactor(t), "t_kv", test.key, test.entry)
+		if err == nil || (test.want != nil && err != test.want) {
+			t.Errorf("%d: error %v, want %v", i, err, test.want)
+		}
+	}
+	if n := len(backend.Invocations()); n != 0 {
+		t.Errorf("%d invocations for invalid entries", n)
+	}
+
+	if err := service.CreateTable(ctx, precompiledtest.NewTransactor(t), strings.Repeat("t", MaxTableNameLength+1), "id", nil); err != precompiled.ErrTableNameTooLong {
+		t.Errorf("CreateTable with a long name: error %v, want %v", err, precompiled.ErrTableNameTooLong)
+	}
+	if err := service.CreateTable(ctx, precompiledtest.NewTransactor(t), "t_kv", "id", []string{"name", "json"}); err != nil {
+		t.Fatalf("CreateTable error: %v", err)
+	}
+	if args := backend.Transactions()[0].Args; !reflect.DeepEqual(args, []interface{}{"t_kv", "id", "name,json"}) {
+		t.Errorf("createTable arguments %q", args)
+	}
+	backend.Handle(precompiled.KVTableFactoryAddress, kvTableFactoryABI, "createTable", precompiledtest.Code(-50001))
+	if err := service.CreateTable(ctx, precompiledtest.NewTransactor(t), "t_kv", "id", nil); precompiledtest.CodeErr(err) != precompiled.ErrTableExists {
+		t.Errorf("creating a table twice: error %v, want %v", err, precompiled.ErrTableExists)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package lifecycle freezes and unfreezes contracts through the contract
+// lifecycle precompiled contract, available since FISCO BCOS 2.3.
+//
+// Transactions and calls to a frozen contract fail with an execution status
+// matching precompiled.ErrContractFrozen. Only the managers of a contract,
+// initially the account which deployed it, may freeze or unfreeze it.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const lifecycleABI = `[
+	{"constant":false,"inputs":[{"name":"addr","type":"address"}],"name":"freeze","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"addr","type":"address"}],"name":"unfreeze","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"contractAddr","type":"address"},{"name":"userAddr","type":"address"}],"name":"grantManager","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"addr","type":"address"}],"name":"getStatus","outputs":[{"name":"","type":"int256"},{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"addr","type":"address"}],"name":"listManager","outputs":[{"name":"","type":"int256"},{"name":"","type":"address[]"}],"type":"function"}
+]`
+
+// Status is the lifecycle status of a contract.
+type Status int
+
+const (
+	Available Status = iota // the contract may be called
+	Frozen                  // calls to the contract are rejected
+)
+
+func (s Status) String() string {
+	switch s {
+	case Available:
+		return "available"
+	case Frozen:
+		return "frozen"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Service manages the lifecycle of contracts.
+type Service struct {
+	lifecycle *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{lifecycle: precompiled.NewContract(precompiled.ContractLifeCycleAddress, lifecycleABI, backend)}
+}
+
+// Freeze freezes the contract at address. It fails with
+// precompiled.ErrContractFrozen if it's frozen already.
+func (s *Service) Freeze(ctx context.Context, opts *bind.TransactOpts, contract common.Address) error {
+	_, _, err := s.lifecycle.Transact(ctx, opts, "freeze", contract)
+	return err
+}
+
+// Unfreeze unfreezes the contract at address. It fails with
+// precompiled.ErrContractAvailable if it isn't frozen.
+func (s *Service) Unfreeze(ctx context.Context, opts *bind.TransactOpts, contract common.Address) error {
+	_, _, err := s.lifecycle.Transact(ctx, opts, "unfreeze", contract)
+	return err
+}
+
+// GrantManager makes account a manager of the contract, allowed to freeze and
+// unfreeze it. It fails with precompiled.ErrContractManagerExists if it's one
+// already.
+func (s *Service) GrantManager(ctx context.Context, opts *bind.TransactOpts, contract, account common.Address) error {
+	_, _, err := s.lifecycle.Transact(ctx, opts, "grantManager", contract, account)
+	return err
+}
+
+// GetStatus returns the status of the contract at address. It fails with
+// precompiled.ErrContractNotExist if there is no contract.
+func (s *Service) GetStatus(ctx context.Context, opts *bind.CallOpts, contract common.Address) (Status, error) {
+	var (
+		code    = new(*big.Int)
+		message = new(string)
+	)
+	if err := s.lifecycle.Call(ctx, opts, &[]interface{}{code, message}, "getStatus", contract); err != nil {
+		return 0, err
+	}
+	if err := precompiled.CodeError(int((*code).Int64())); err != nil {
+		return 0, err
+	}
+	// The status is only reported by its description, like "The contract is
+	// available."
+	switch msg := strings.ToLower(*message); {
+	case strings.Contains(msg, "frozen"):
+		return Frozen, nil
+	case strings.Contains(msg, "available"):
+		return Available, nil
+	}
+	return 0, fmt.Errorf("unknown contract status %q", *message)
+}
+
+// ListManager returns the managers of the contract at address.
+func (s *Service) ListManager(ctx context.Context, opts *bind.CallOpts, contract common.Address) ([]common.Address, error) {
+	var (
+		code     = new(*big.Int)
+		managers = new([]common.Address)
+	)
+	if err := s.lifecycle.Call(ctx, opts, &[]interface{}{code, managers}, "listManager", contract); err != nil {
+		return nil, err
+	}
+	if err := precompiled.CodeError(int((*code).Int64())); err != nil {
+		return nil, err
+	}
+	return *managers, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+var (
+	contract = common.HexToAddress("0xc0ffee")
+	manager  = common.HexToAddress("0xbeef")
+)
+
+func TestTransactions(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	for _, method := range []string{"freeze", "unfreeze", "grantManager"} {
+		backend.Handle(precompiled.ContractLifeCycleAddress, lifecycleABI, method, precompiledtest.Code(0))
+	}
+	service := NewService(backend)
+	ctx := context.Background()
+
+	if err := service.Freeze(ctx, precompiledtest.NewTransactor(t), contract); err != nil {
+		t.Fatalf("Freeze error: %v", err)
+	}
+	if err := service.Unfreeze(ctx, precompiledtest.NewTransactor(t), contract); err != nil {
+		t.Fatalf("Unfreeze error: %v", err)
+	}
+	if err := service.GrantManager(ctx, precompiledtest.NewTransactor(t), contract, manager); err != nil {
+		t.Fatalf("GrantManager error: %v", err)
+	}
+	want := [][]interface{}{{contract}, {contract}, {contract, manager}}
+	for i, tx := range backend.Transactions() {
+		if !reflect.DeepEqual(tx.Args, want[i]) {
+			t.Errorf("%s arguments %v, want %v", tx.Method, tx.Args, want[i])
+		}
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	tests := []struct {
+		method string
+		code   int
+		call   func() error
+		want   error
+	}{
+		{"freeze", -51900, func() error { return service.Freeze(ctx, precompiledtest.NewTransactor(t), contract) }, precompiled.ErrContractFrozen},
+		{"freeze", -51905, func() error { return service.Freeze(ctx, precompiledtest.NewTransactor(t), contract) }, precompiled.ErrNoContractPermission},
+		{"unfreeze", -51901, func() error { return service.Unfreeze(ctx, precompiledtest.NewTransactor(t), contract) }, precompiled.ErrContractAvailable},
+		{"unfreeze", -51904, func() error { return service.Unfreeze(ctx, precompiledtest.NewTransactor(t), contract) }, precompiled.ErrContractNotExist},
+		{"grantManager", -51902, func() error { return service.GrantManager(ctx, precompiledtest.NewTransactor(t), contract, manager) }, precompiled.ErrContractManagerExists},
+		{"grantManager", -51903, func() error { return service.GrantManager(ctx, precompiledtest.NewTransactor(t), contract, manager) }, precompiled.ErrInvalidContractAddress},
+	}
+	for _, test := range tests {
+		backend.Handle(precompiled.ContractLifeCycleAddress, lifecycleABI, test.method, precompiledtest.Code(test.code))
+		if err := test.call(); precompiledtest.CodeErr(err) != test.want {
+			t.Errorf("%s with code %d: error %v, want %v", test.method, test.code, err, test.want)
+		}
+	}
+	if precompiled.ErrContractFrozen != types.ErrContractFrozen {
+		t.Error("ErrContractFrozen differs from the status error of frozen contracts")
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	tests := []struct {
+		code    int64
+		message string
+		want    Status
+		err     error
+	}{
+		{0, "The contract is available.", Available, nil},
+		{0, "The contract has been frozen. You can invoke this contract after unfrozen.", Frozen, nil},
+		{-51904, "The contract does not exist.", 0, precompiled.ErrContractNotExist},
+		{0, "Something else.", 0, errors.New("unknown")},
+	}
+	for _, test := range tests {
+		backend.Handle(precompiled.ContractLifeCycleAddress, lifecycleABI, "getStatus", func([]interface{}) ([]interface{}, error) {
+			return []interface{}{big.NewInt(test.code), test.message}, nil
+		})
+		status, err := service.GetStatus(context.Background(), nil, contract)
+		switch {
+		case test.err == nil && (err != nil || status != test.want):
+			t.Errorf("%q: status %v, error %v; want %v", test.message, status, err, test.want)
+		case test.err != nil && err == nil:
+			t.Errorf("%q: status %v, want an error", test.message, status)
+		case test.err != nil && test.code != 0 && precompiledtest.CodeErr(err) != test.err:
+			t.Errorf("%q: error %v, want %v", test.message, err, test.err)
+		}
+	}
+}
+
+func TestListManager(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	managers := []common.Address{manager, common.HexToAddress("0xfeed")}
+	backend.Handle(precompiled.ContractLifeCycleAddress, lifecycleABI, "listManager", func(args []interface{}) ([]interface{}, error) {
+		if args[0] != contract {
+			return []interface{}{big.NewInt(-51904), []common.Address{}}, nil
+		}
+		return []interface{}{big.NewInt(0), managers}, nil
+	})
+	got, err := service.ListManager(context.Background(), nil, contract)
+	if err != nil || !reflect.DeepEqual(got, managers) {
+		t.Errorf("ListManager: %v, %v; want %v", got, err, managers)
+	}
+	if _, err := service.ListManager(context.Background(), nil, manager); precompiledtest.CodeErr(err) != precompiled.ErrContractNotExist {
+		t.Errorf("ListManager of a missing contract: error %v, want %v", err, precompiled.ErrContractNotExist)
+	}
+}
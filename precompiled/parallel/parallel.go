@@ -0,0 +1,125 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package parallel registers contract functions for parallel execution through
+// the ParallelConfig precompiled contract.
+//
+// The transactions of a block calling registered functions are executed in
+// parallel unless they conflict. Two calls conflict if they share a value of
+// one of the leading critical parameters of the function, e.g. the accounts of
+// transfer(string from, string to, uint256 amount) with a critical size of 2.
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const parallelConfigABI = `[
+	{"constant":false,"inputs":[{"name":"addr","type":"address"},{"name":"functionName","type":"string"},{"name":"criticalSize","type":"uint256"}],"name":"registerParallelFunctionInternal","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"addr","type":"address"},{"name":"functionName","type":"string"}],"name":"unregisterParallelFunctionInternal","outputs":[{"name":"","type":"int256"}],"type":"function"}
+]`
+
+// signatureRegex splits a function signature into its name and parameter list.
+var signatureRegex = regexp.MustCompile(`^([A-Za-z_$][A-Za-z0-9_$]*)\(([^()]*)\)$`)
+
+// Service registers functions for parallel execution.
+type Service struct {
+	config *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{config: precompiled.NewContract(precompiled.ParallelConfigAddress, parallelConfigABI, backend)}
+}
+
+// RegisterParallelFunction registers a function of the contract at address for
+// parallel execution. functionSignature is the canonical signature of the
+// function, like "transfer(string,string,uint256)", and criticalSize the number
+// of leading parameters deciding about conflicts. See ValidateSignature.
+func (s *Service) RegisterParallelFunction(ctx context.Context, opts *bind.TransactOpts, contract common.Address, functionSignature string, criticalSize uint64) error {
+	if err := ValidateSignature(functionSignature, criticalSize); err != nil {
+		return err
+	}
+	_, _, err := s.config.Transact(ctx, opts, "registerParallelFunctionInternal", contract, functionSignature, new(big.Int).SetUint64(criticalSize))
+	return err
+}
+
+// UnregisterParallelFunction stops the parallel execution of a function of the
+// contract at address.
+func (s *Service) UnregisterParallelFunction(ctx context.Context, opts *bind.TransactOpts, contract common.Address, functionSignature string) error {
+	if err := ValidateSignature(functionSignature, 0); err != nil {
+		return err
+	}
+	_, _, err := s.config.Transact(ctx, opts, "unregisterParallelFunctionInternal", contract, functionSignature)
+	return err
+}
+
+// RegisterMethods registers methods of the contract at address for parallel
+// execution, mapping the names of the methods in contractABI to their critical
+// sizes. It stops at the first failure.
+func (s *Service) RegisterMethods(ctx context.Context, opts *bind.TransactOpts, contract common.Address, contractABI abi.ABI, criticalSizes map[string]uint64) error {
+	for name, criticalSize := range criticalSizes {
+		method, ok := contractABI.Methods[name]
+		if !ok {
+			return fmt.Errorf("method %s not found in the ABI", name)
+		}
+		if err := s.RegisterParallelFunction(ctx, opts, contract, method.Sig(), criticalSize); err != nil {
+			return fmt.Errorf("registering %s: %v", method.Sig(), err)
+		}
+	}
+	return nil
+}
+
+// ValidateSignature checks that functionSignature is a canonical function
+// signature, the form the node computes the selector from, with at least
+// criticalSize parameters. The critical parameters must not be arrays or tuples.
+func ValidateSignature(functionSignature string, criticalSize uint64) error {
+	match := signatureRegex.FindStringSubmatch(functionSignature)
+	if match == nil || strings.ContainsAny(functionSignature, " \t\n") {
+		return fmt.Errorf("invalid function signature %q", functionSignature)
+	}
+	var params []string
+	if match[2] != "" {
+		params = strings.Split(match[2], ",")
+	}
+	for i, param := range params {
+		typ, err := abi.NewType(param, nil)
+		if err != nil {
+			return fmt.Errorf("invalid parameter type %q in %q: %v", param, functionSignature, err)
+		}
+		// Aliases like uint hash to another selector than uint256.
+		if typ.String() != param {
+			return fmt.Errorf("non-canonical parameter type %q in %q, want %q", param, functionSignature, typ.String())
+		}
+		if uint64(i) < criticalSize && (typ.T == abi.SliceTy || typ.T == abi.ArrayTy || typ.T == abi.TupleTy) {
+			return fmt.Errorf("critical parameter %d of %q has unsupported type %s", i, functionSignature, param)
+		}
+	}
+	if criticalSize > uint64(len(params)) {
+		return fmt.Errorf("critical size %d exceeds the %d parameters of %q", criticalSize, len(params), functionSignature)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package parallel
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+const transferABI = `[
+	{"constant":false,"inputs":[{"name":"from","type":"string"},{"name":"to","type":"string"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[],"type":"function"},
+	{"constant":false,"inputs":[{"name":"account","type":"string"},{"name":"amount","type":"uint256"}],"name":"set","outputs":[],"type":"function"}
+]`
+
+func TestValidateSignature(t *testing.T) {
+	tests := []struct {
+		sig          string
+		criticalSize uint64
+		ok           bool
+	}{
+		{"transfer(string,string,uint256)", 2, true},
+		{"transfer(string,string,uint256)", 3, true},
+		{"transfer(string,string,uint256)", 4, false},
+		{"noop()", 0, true},
+		{"noop()", 1, false},
+		{"transfer(string,string,uint)", 2, false},
+		{"transfer(string, string,uint256)", 2, false},
+		{"transfer(string,string,uint256", 2, false},
+		{"1transfer(string)", 1, false},
+		{"batch(address[],uint256)", 1, false},
+		{"batch(uint256,address[])", 1, true},
+		{"set(bytes32,uint8)", 2, true},
+		{"set(unknown)", 0, false},
+	}
+	for _, test := range tests {
+		err := ValidateSignature(test.sig, test.criticalSize)
+		if (err == nil) != test.ok {
+			t.Errorf("%s with %d critical parameters: error %v, want valid %t", test.sig, test.criticalSize, err, test.ok)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.ParallelConfigAddress, parallelConfigABI, "registerParallelFunctionInternal", precompiledtest.Code(0))
+	backend.Handle(precompiled.ParallelConfigAddress, parallelConfigABI, "unregisterParallelFunctionInternal", precompiledtest.Code(0))
+	service := NewService(backend)
+	ctx := context.Background()
+	contract := common.HexToAddress("0x5a1e")
+
+	if err := service.RegisterParallelFunction(ctx, precompiledtest.NewTransactor(t), contract, "transfer(string,string,uint256)", 2); err != nil {
+		t.Fatalf("RegisterParallelFunction error: %v", err)
+	}
+	if err := service.UnregisterParallelFunction(ctx, precompiledtest.NewTransactor(t), contract, "transfer(string,string,uint256)"); err != nil {
+		t.Fatalf("UnregisterParallelFunction error: %v", err)
+	}
+	txs := backend.Transactions()
+	if args := txs[0].Args; args[0] != contract || args[1] != "transfer(string,string,uint256)" || args[2].(*big.Int).Uint64() != 2 {
+		t.Errorf("register arguments %v", args)
+	}
+	if args := txs[1].Args; len(args) != 2 || args[0] != contract || args[1] != "transfer(string,string,uint256)" {
+		t.Errorf("unregister arguments %v", args)
+	}
+	if err := service.RegisterParallelFunction(ctx, precompiledtest.NewTransactor(t), contract, "transfer(string,string,uint)", 2); err == nil {
+		t.Error("registered a non-canonical signature")
+	}
+	if n := len(backend.Transactions()); n != 2 {
+		t.Errorf("sent %d transactions, want 2", n)
+	}
+}
+
+func TestRegisterMethods(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.ParallelConfigAddress, parallelConfigABI, "registerParallelFunctionInternal", precompiledtest.Code(0))
+	service := NewService(backend)
+	parsed, err := abi.JSON(strings.NewReader(transferABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]uint64{"transfer": 2, "set": 1}
+	if err := service.RegisterMethods(context.Background(), precompiledtest.NewTransactor(t), common.Address{1}, parsed, sizes); err != nil {
+		t.Fatalf("RegisterMethods error: %v", err)
+	}
+	var sigs []string
+	for _, tx := range backend.Transactions() {
+		sigs = append(sigs, tx.Args[1].(string))
+	}
+	sort.Strings(sigs)
+	if want := "set(string,uint256) transfer(string,string,uint256)"; strings.Join(sigs, " ") != want {
+		t.Errorf("registered %v, want %s", sigs, want)
+	}
+	if err := service.RegisterMethods(context.Background(), precompiledtest.NewTransactor(t), common.Address{1}, parsed, map[string]uint64{"missing": 1}); err == nil {
+		t.Error("registered a method missing from the ABI")
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.ParallelConfigAddress, parallelConfigABI, "registerParallelFunctionInternal", precompiledtest.Code(-50000))
+	err := NewService(backend).RegisterParallelFunction(context.Background(), precompiledtest.NewTransactor(t), common.Address{1}, "set(string,uint256)", 1)
+	if !precompiled.IsPermissionDenied(err) {
+		t.Errorf("without permission: error %v, want a permission denial", err)
+	}
+	backend.Handle(precompiled.ParallelConfigAddress, parallelConfigABI, "registerParallelFunctionInternal", precompiledtest.Code(-50100))
+	err = NewService(backend).RegisterParallelFunction(context.Background(), precompiledtest.NewTransactor(t), common.Address{1}, "set(string,uint256)", 1)
+	if precompiledtest.CodeErr(err) != precompiled.ErrUnknownFunctionCall {
+		t.Errorf("unknown function: error %v, want %v", err, precompiled.ErrUnknownFunctionCall)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package permission grants and revokes the write permission of accounts on the
+// system and user tables through the permission precompiled contract.
+//
+// A table without managers may be written by every account. Once an account is
+// granted the permission on a table, only the granted accounts may write it.
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+const permissionABI = `[
+	{"constant":false,"inputs":[{"name":"table_name","type":"string"},{"name":"addr","type":"string"}],"name":"insert","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"table_name","type":"string"},{"name":"addr","type":"string"}],"name":"remove","outputs":[{"name":"","type":"int256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"table_name","type":"string"}],"name":"queryByName","outputs":[{"name":"","type":"string"}],"type":"function"}
+]`
+
+// System tables guarding the operations of the chain.
+const (
+	DeployAndCreateTable = "_sys_tables_"       // deploying contracts and creating tables
+	NodeTable            = "_sys_consensus_"    // managing consensus nodes
+	CNSTable             = "_sys_cns_"          // registering contracts with CNS
+	SysConfigTable       = "_sys_config_"       // setting the system config
+	PermissionTable      = "_sys_table_access_" // granting and revoking permissions
+)
+
+// userTablePrefix prefixes the names of user tables in the storage.
+const userTablePrefix = "_user_"
+
+// UserTable returns the name under which the permission on a user table created
+// through the CRUD service is granted.
+func UserTable(tableName string) string {
+	return userTablePrefix + tableName
+}
+
+// Info is an account granted the permission on a table.
+type Info struct {
+	TableName string
+	Address   common.Address
+	EnableNum uint64 // block number from which on the permission applies
+}
+
+// UnmarshalJSON decodes a record returned by the permission contract.
+func (info *Info) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		TableName string `json:"table_name"`
+		Address   string `json:"address"`
+		EnableNum string `json:"enable_num"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if !common.IsHexAddress(dec.Address) {
+		return fmt.Errorf("invalid address %q of permission on %s", dec.Address, dec.TableName)
+	}
+	enableNum, err := strconv.ParseUint(dec.EnableNum, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid enable_num %q of permission on %s", dec.EnableNum, dec.TableName)
+	}
+	*info = Info{TableName: dec.TableName, Address: common.HexToAddress(dec.Address), EnableNum: enableNum}
+	return nil
+}
+
+// Service manages permissions.
+type Service struct {
+	permission *precompiled.Contract
+}
+
+// NewService creates a service using the given backend, typically an
+// *ethclient.Client.
+func NewService(backend bind.ContractBackend) *Service {
+	return &Service{permission: precompiled.NewContract(precompiled.PermissionAddress, permissionABI, backend)}
+}
+
+// Grant grants account the permission to write table. It fails with
+// precompiled.ErrPermissionExists if the account has it already.
+func (s *Service) Grant(ctx context.Context, opts *bind.TransactOpts, table string, account common.Address) error {
+	if table == "" {
+		return errors.New("empty table name")
+	}
+	_, _, err := s.permission.Transact(ctx, opts, "insert", table, account.Hex())
+	return err
+}
+
+// Revoke revokes the permission of account to write table. It fails with
+// precompiled.ErrPermissionNotExist if the account doesn't have it.
+func (s *Service) Revoke(ctx context.Context, opts *bind.TransactOpts, table string, account common.Address) error {
+	if table == "" {
+		return errors.New("empty table name")
+	}
+	_, _, err := s.permission.Transact(ctx, opts, "remove", table, account.Hex())
+	return err
+}
+
+// ListManagers returns the accounts granted the permission to write table.
+func (s *Service) ListManagers(ctx context.Context, opts *bind.CallOpts, table string) ([]Info, error) {
+	var result string
+	if err := s.permission.Call(ctx, opts, &result, "queryByName", table); err != nil {
+		return nil, err
+	}
+	var infos []Info
+	if err := json.Unmarshal([]byte(result), &infos); err != nil {
+		return nil, fmt.Errorf("invalid permission records %q: %v", result, err)
+	}
+	return infos, nil
+}
+
+// GrantUserTableManager grants account the permission to write a user table.
+func (s *Service) GrantUserTableManager(ctx context.Context, opts *bind.TransactOpts, tableName string, account common.Address) error {
+	return s.Grant(ctx, opts, UserTable(tableName), account)
+}
+
+// RevokeUserTableManager revokes the permission of account to write a user table.
+func (s *Service) RevokeUserTableManager(ctx context.Context, opts *bind.TransactOpts, tableName string, account common.Address) error {
+	return s.Revoke(ctx, opts, UserTable(tableName), account)
+}
+
+// ListUserTableManagers returns the accounts granted the permission to write a
+// user table.
+func (s *Service) ListUserTableManagers(ctx context.Context, opts *bind.CallOpts, tableName string) ([]Info, error) {
+	return s.ListManagers(ctx, opts, UserTable(tableName))
+}
+
+// GrantDeployAndCreateManager grants account the permission to deploy contracts
+// and create tables.
+func (s *Service) GrantDeployAndCreateManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Grant(ctx, opts, DeployAndCreateTable, account)
+}
+
+// RevokeDeployAndCreateManager revokes the permission of account to deploy
+// contracts and create tables.
+func (s *Service) RevokeDeployAndCreateManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Revoke(ctx, opts, DeployAndCreateTable, account)
+}
+
+// GrantNodeManager grants account the permission to manage consensus nodes.
+func (s *Service) GrantNodeManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Grant(ctx, opts, NodeTable, account)
+}
+
+// RevokeNodeManager revokes the permission of account to manage consensus nodes.
+func (s *Service) RevokeNodeManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Revoke(ctx, opts, NodeTable, account)
+}
+
+// GrantCNSManager grants account the permission to register contracts with CNS.
+func (s *Service) GrantCNSManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Grant(ctx, opts, CNSTable, account)
+}
+
+// RevokeCNSManager revokes the permission of account to register contracts with
+// CNS.
+func (s *Service) RevokeCNSManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Revoke(ctx, opts, CNSTable, account)
+}
+
+// GrantSysConfigManager grants account the permission to set the system config.
+func (s *Service) GrantSysConfigManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Grant(ctx, opts, SysConfigTable, account)
+}
+
+// RevokeSysConfigManager revokes the permission of account to set the system
+// config.
+func (s *Service) RevokeSysConfigManager(ctx context.Context, opts *bind.TransactOpts, account common.Address) error {
+	return s.Revoke(ctx, opts, SysConfigTable, account)
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package permission
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+func TestGrantRevoke(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "insert", precompiledtest.Code(1))
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "remove", precompiledtest.Code(1))
+	service := NewService(backend)
+	ctx := context.Background()
+	account := common.HexToAddress("0x7f32a6e4e1a0c3d0e7c9e5a7b1b4ac00e0f1d2c3")
+
+	changes := []struct {
+		change func(*bind.TransactOpts) error
+		method string
+		table  string
+	}{
+		{func(o *bind.TransactOpts) error { return service.Grant(ctx, o, "t_test", account) }, "insert", "t_test"},
+		{func(o *bind.TransactOpts) error { return service.Revoke(ctx, o, "t_test", account) }, "remove", "t_test"},
+		{func(o *bind.TransactOpts) error { return service.GrantUserTableManager(ctx, o, "t_test", account) }, "insert", "_user_t_test"},
+		{func(o *bind.TransactOpts) error { return service.RevokeUserTableManager(ctx, o, "t_test", account) }, "remove", "_user_t_test"},
+		{func(o *bind.TransactOpts) error { return service.GrantDeployAndCreateManager(ctx, o, account) }, "insert", DeployAndCreateTable},
+		{func(o *bind.TransactOpts) error { return service.RevokeDeployAndCreateManager(ctx, o, account) }, "remove", DeployAndCreateTable},
+		{func(o *bind.TransactOpts) error { return service.GrantNodeManager(ctx, o, account) }, "insert", NodeTable},
+		{func(o *bind.TransactOpts) error { return service.RevokeNodeManager(ctx, o, account) }, "remove", NodeTable},
+		{func(o *bind.TransactOpts) error { return service.GrantCNSManager(ctx, o, account) }, "insert", CNSTable},
+		{func(o *bind.TransactOpts) error { return service.RevokeCNSManager(ctx, o, account) }, "remove", CNSTable},
+		{func(o *bind.TransactOpts) error { return service.GrantSysConfigManager(ctx, o, account) }, "insert", SysConfigTable},
+		{func(o *bind.TransactOpts) error { return service.RevokeSysConfigManager(ctx, o, account) }, "remove", SysConfigTable},
+	}
+	for i, change := range changes {
+		if err := change.change(precompiledtest.NewTransactor(t)); err != nil {
+			t.Fatalf("change %d: %v", i, err)
+		}
+		tx := backend.Transactions()[i]
+		want := []interface{}{change.table, account.Hex()}
+		if tx.Method != change.method || !reflect.DeepEqual(tx.Args, want) {
+			t.Errorf("change %d: sent %s%q, want %s%q", i, tx.Method, tx.Args, change.method, want)
+		}
+	}
+	if err := service.Grant(ctx, precompiledtest.NewTransactor(t), "", account); err == nil {
+		t.Error("granted the permission on an empty table name")
+	}
+}
+
+func TestResultCodes(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	service := NewService(backend)
+	ctx := context.Background()
+
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "insert", precompiledtest.Code(-51000))
+	if err := service.Grant(ctx, precompiledtest.NewTransactor(t), "t_test", common.Address{1}); precompiledtest.CodeErr(err) != precompiled.ErrPermissionExists {
+		t.Errorf("granting twice: error %v, want %v", err, precompiled.ErrPermissionExists)
+	}
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "remove", precompiledtest.Code(-51001))
+	if err := service.Revoke(ctx, precompiledtest.NewTransactor(t), "t_test", common.Address{1}); precompiledtest.CodeErr(err) != precompiled.ErrPermissionNotExist {
+		t.Errorf("revoking a missing permission: error %v, want %v", err, precompiled.ErrPermissionNotExist)
+	}
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "insert", precompiledtest.Code(-50000))
+	if err := service.GrantCNSManager(ctx, precompiledtest.NewTransactor(t), common.Address{1}); !precompiled.IsPermissionDenied(err) {
+		t.Errorf("without permission: error %v, want a permission denial", err)
+	}
+}
+
+func TestListManagers(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.PermissionAddress, permissionABI, "queryByName", func(args []interface{}) ([]interface{}, error) {
+		switch args[0] {
+		case "_user_t_test":
+			return []interface{}{`[{"address":"0x7f32a6e4e1a0c3d0e7c9e5a7b1b4ac00e0f1d2c3","enable_num":"12","table_name":"_user_t_test"}]`}, nil
+		case "bad":
+			return []interface{}{`[{"address":"0x7f32","enable_num":"12","table_name":"bad"}]`}, nil
+		}
+		return []interface{}{"[]"}, nil
+	})
+	service := NewService(backend)
+	ctx := context.Background()
+
+	infos, err := service.ListUserTableManagers(ctx, nil, "t_test")
+	want := []Info{{TableName: "_user_t_test", Address: common.HexToAddress("0x7f32a6e4e1a0c3d0e7c9e5a7b1b4ac00e0f1d2c3"), EnableNum: 12}}
+	if err != nil || !reflect.DeepEqual(infos, want) {
+		t.Errorf("ListUserTableManagers: %+v, %v; want %+v", infos, err, want)
+	}
+	if infos, err := service.ListManagers(ctx, nil, CNSTable); err != nil || len(infos) != 0 {
+		t.Errorf("ListManagers of a table without managers: %+v, %v", infos, err)
+	}
+	if _, err := service.ListManagers(ctx, nil, "bad"); err == nil {
+		t.Error("ListManagers accepted an invalid address")
+	}
+}
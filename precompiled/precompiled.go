@@ -0,0 +1,306 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package precompiled provides the common ground of the services wrapping the
+// precompiled contracts of FISCO BCOS: their addresses, the errors behind their
+// result codes and a binding sending transactions to them and waiting for the
+// result.
+package precompiled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// Addresses of the precompiled contracts.
+var (
+	SystemConfigAddress      = common.HexToAddress("0x1000")
+	TableFactoryAddress      = common.HexToAddress("0x1001")
+	CRUDAddress              = common.HexToAddress("0x1002")
+	ConsensusAddress         = common.HexToAddress("0x1003")
+	CNSAddress               = common.HexToAddress("0x1004")
+	PermissionAddress        = common.HexToAddress("0x1005")
+	ParallelConfigAddress    = common.HexToAddress("0x1006")
+	ContractLifeCycleAddress = common.HexToAddress("0x1007")
+	ChainGovernanceAddress   = common.HexToAddress("0x1008")
+	KVTableFactoryAddress    = common.HexToAddress("0x1010")
+)
+
+// Errors corresponding to the result codes of the precompiled contracts. Errors
+// returned by the services wrap them, see Error.
+var (
+	// Common and tables
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrTableExists         = errors.New("table already exists")
+	ErrTableNameTooLong    = errors.New("table name too long")
+	ErrFieldNameTooLong    = errors.New("field name too long")
+	ErrFieldsTooLong       = errors.New("total length of the field names too long")
+	ErrKeyValueTooLong     = errors.New("key value too long")
+	ErrFieldValueTooLong   = errors.New("field value too long")
+	ErrDuplicateField      = errors.New("duplicate field")
+	ErrInvalidField        = errors.New("invalid field")
+	ErrUnknownFunctionCall = errors.New("unknown function call")
+	ErrTableNotExist       = errors.New("table does not exist")
+
+	// Permission
+	ErrPermissionExists   = errors.New("table name and address already granted")
+	ErrPermissionNotExist = errors.New("table name and address not granted")
+
+	// Consensus
+	ErrInvalidNodeID    = errors.New("invalid node ID")
+	ErrLastSealer       = errors.New("the last sealer cannot be removed")
+	ErrNodeNotReachable = errors.New("node is not reachable")
+	ErrNodeNotExist     = errors.New("node is not a sealer or observer of the group")
+	ErrAlreadySealer    = errors.New("node is already a sealer")
+	ErrAlreadyObserver  = errors.New("node is already an observer")
+
+	// CNS
+	ErrContractNameAndVersionExist = errors.New("contract name and version already exist")
+	ErrVersionTooLong              = errors.New("contract version too long")
+
+	// System config
+	ErrInvalidConfigValue = errors.New("invalid system config value")
+
+	// Contract lifecycle
+	ErrContractFrozen         = types.ErrContractFrozen
+	ErrContractAvailable      = errors.New("contract is available")
+	ErrContractManagerExists  = errors.New("account is already a manager of the contract")
+	ErrInvalidContractAddress = errors.New("invalid contract address")
+	ErrContractNotExist       = errors.New("contract does not exist")
+	ErrNoContractPermission   = errors.New("account is not a manager of the contract")
+
+	// Chain governance
+	ErrCommitteeMemberExists   = errors.New("account is already a committee member")
+	ErrCommitteeMemberNotExist = errors.New("account is not a committee member")
+	ErrInvalidThreshold        = errors.New("invalid threshold")
+	ErrOperatorIsMember        = errors.New("operator cannot be a committee member")
+	ErrMemberIsOperator        = errors.New("committee member cannot be an operator")
+	ErrOperatorExists          = errors.New("account is already an operator")
+	ErrOperatorNotExist        = errors.New("account is not an operator")
+	ErrAccountNotExist         = errors.New("account does not exist")
+	ErrInvalidAccountAddress   = errors.New("invalid account address")
+	ErrAccountAvailable        = errors.New("account is available")
+	ErrAccountFrozen           = types.ErrAccountFrozen
+	ErrValueAlreadyExpected    = errors.New("value is already the expected one")
+)
+
+// codeErrors maps result codes to the errors above.
+var codeErrors = map[int]error{
+	-50000: ErrPermissionDenied,
+	-50001: ErrTableExists,
+	-50002: ErrTableNameTooLong,
+	-50003: ErrFieldNameTooLong,
+	-50004: ErrFieldsTooLong,
+	-50005: ErrKeyValueTooLong,
+	-50006: ErrFieldValueTooLong,
+	-50007: ErrDuplicateField,
+	-50008: ErrInvalidField,
+	-50100: ErrUnknownFunctionCall,
+	-50101: ErrTableNotExist,
+
+	-51000: ErrPermissionExists,
+	-51001: ErrPermissionNotExist,
+
+	-51100: ErrInvalidNodeID,
+	-51101: ErrLastSealer,
+	-51102: ErrNodeNotReachable,
+	-51103: ErrNodeNotExist,
+	-51104: ErrAlreadySealer,
+	-51105: ErrAlreadyObserver,
+
+	-51200: ErrContractNameAndVersionExist,
+	-51201: ErrVersionTooLong,
+
+	-51300: ErrInvalidConfigValue,
+
+	-51900: ErrContractFrozen,
+	-51901: ErrContractAvailable,
+	-51902: ErrContractManagerExists,
+	-51903: ErrInvalidContractAddress,
+	-51904: ErrContractNotExist,
+	-51905: ErrNoContractPermission,
+
+	-52000: ErrCommitteeMemberExists,
+	-52001: ErrCommitteeMemberNotExist,
+	-52002: ErrPermissionDenied,
+	-52003: ErrInvalidThreshold,
+	-52004: ErrOperatorIsMember,
+	-52005: ErrMemberIsOperator,
+	-52006: ErrOperatorExists,
+	-52007: ErrOperatorNotExist,
+	-52008: ErrAccountNotExist,
+	-52009: ErrInvalidAccountAddress,
+	-52010: ErrAccountAvailable,
+	-52011: ErrAccountFrozen,
+	-52012: ErrValueAlreadyExpected,
+}
+
+// Error is a failure reported through the result code of a precompiled contract.
+// It keeps the code and wraps the matching error variable, if the code is known.
+type Error struct {
+	Code int
+	Err  error // error variable matching Code, nil for unknown codes
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("precompiled contract failed with code %d", e.Code)
+	}
+	return fmt.Sprintf("%v (code %d)", e.Err, e.Code)
+}
+
+// Unwrap returns the error variable matching the result code.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the error variable matching the result code.
+func (e *Error) Is(target error) bool { return e.Err != nil && e.Err == target }
+
+// CodeError returns the error of a result code, nil for codes which don't
+// signal a failure. Non-negative codes are successes, usually counting the
+// affected entries.
+func CodeError(code int) error {
+	if code >= 0 {
+		return nil
+	}
+	return &Error{Code: code, Err: codeErrors[code]}
+}
+
+// TransactionError is returned if the transaction calling a precompiled contract
+// was executed but failed, e.g. because the sender lacks the permission.
+type TransactionError struct {
+	Receipt *types.Receipt
+}
+
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("transaction failed: %s", e.Receipt.StatusMessage())
+}
+
+// Is reports whether the status of the transaction denied the permission to
+// call the contract, matching ErrPermissionDenied, or rejected the frozen
+// contract, matching ErrContractFrozen.
+func (e *TransactionError) Is(target error) bool {
+	code, _ := e.Receipt.StatusCode()
+	if target == ErrPermissionDenied {
+		switch code {
+		case types.StatusPermissionDenied, types.StatusNoCallPermission, types.StatusNoTxPermission:
+			return true
+		}
+		return false
+	}
+	return (&types.StatusError{Status: code}).Is(target)
+}
+
+// IsPermissionDenied reports whether err means the sender isn't allowed to use
+// the precompiled contract, either by its result code or by the status of the
+// transaction.
+func IsPermissionDenied(err error) bool {
+	if is, ok := err.(interface{ Is(error) bool }); ok {
+		return is.Is(ErrPermissionDenied)
+	}
+	return err == ErrPermissionDenied
+}
+
+// Contract is a precompiled contract bound to a backend. Unlike BoundContract,
+// transacting waits for the transaction to be executed and reports the result
+// code of the called method.
+type Contract struct {
+	address common.Address
+	abi     abi.ABI
+	bound   *bind.BoundContract
+	backend bind.ContractBackend
+}
+
+// NewContract binds the precompiled contract at address, described by abiJSON.
+// The ABI is a constant of the calling service, it panics if it's invalid.
+func NewContract(address common.Address, abiJSON string, backend bind.ContractBackend) *Contract {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(fmt.Sprintf("invalid ABI of precompiled contract %s: %v", address.Hex(), err))
+	}
+	return &Contract{
+		address: address,
+		abi:     parsed,
+		bound:   bind.NewBoundContract(address, parsed, backend, backend, backend),
+		backend: backend,
+	}
+}
+
+// Address returns the address of the contract.
+func (c *Contract) Address() common.Address {
+	return c.address
+}
+
+// Call invokes a constant method of the contract, see BoundContract.Call. ctx
+// replaces the context of opts, which may be nil.
+func (c *Contract) Call(ctx context.Context, opts *bind.CallOpts, result interface{}, method string, params ...interface{}) error {
+	var callOpts bind.CallOpts
+	if opts != nil {
+		callOpts = *opts
+	}
+	callOpts.Context = ctx
+	return c.bound.Call(&callOpts, result, method, params...)
+}
+
+// Transact sends a transaction invoking a method of the contract and waits for
+// its receipt, until ctx is done. ctx replaces the context of opts. The method is
+// expected to return an int256 result code, which is returned if it's not
+// negative and reported as *Error otherwise. A failed transaction is reported as
+// *TransactionError.
+func (c *Contract) Transact(ctx context.Context, opts *bind.TransactOpts, method string, params ...interface{}) (int, *types.Receipt, error) {
+	txOpts := *opts
+	txOpts.Context = ctx
+	tx, err := c.bound.Transact(&txOpts, method, params...)
+	if err != nil {
+		return 0, nil, err
+	}
+	receipt, err := bind.WaitMined(ctx, tx.GroupId().Uint64(), c.backend, tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !receipt.Succeeded() {
+		return 0, receipt, &TransactionError{Receipt: receipt}
+	}
+	code, err := ResultCode(receipt)
+	if err != nil {
+		return 0, receipt, err
+	}
+	if err := CodeError(code); err != nil {
+		return 0, receipt, err
+	}
+	return code, receipt, nil
+}
+
+// ResultCode decodes the int256 result code from the output of a receipt.
+func ResultCode(receipt *types.Receipt) (int, error) {
+	output := receipt.Output
+	if len(output) != 32 {
+		return 0, fmt.Errorf("invalid result code length %d, want 32 bytes", len(output))
+	}
+	code := math.S256(new(big.Int).SetBytes(output))
+	if !code.IsInt64() || code.Int64() != int64(int(code.Int64())) {
+		return 0, fmt.Errorf("result code %v out of range", code)
+	}
+	return int(code.Int64()), nil
+}
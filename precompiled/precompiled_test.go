@@ -0,0 +1,153 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package precompiled_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common/math"
+	"github.com/chislab/go-fiscobcos/core/types"
+	"github.com/chislab/go-fiscobcos/precompiled"
+	"github.com/chislab/go-fiscobcos/precompiled/precompiledtest"
+)
+
+const setABI = `[{"constant":false,"inputs":[{"name":"v","type":"string"}],"name":"set","outputs":[{"name":"","type":"int256"}],"type":"function"}]`
+
+func TestCodeError(t *testing.T) {
+	tests := []struct {
+		code int
+		want error
+	}{
+		{-50000, precompiled.ErrPermissionDenied},
+		{-50001, precompiled.ErrTableExists},
+		{-50101, precompiled.ErrTableNotExist},
+		{-51000, precompiled.ErrPermissionExists},
+		{-51101, precompiled.ErrLastSealer},
+		{-51200, precompiled.ErrContractNameAndVersionExist},
+		{-51300, precompiled.ErrInvalidConfigValue},
+		{-51900, types.ErrContractFrozen},
+		{-52002, precompiled.ErrPermissionDenied},
+		{-52011, types.ErrAccountFrozen},
+		{-52012, precompiled.ErrValueAlreadyExpected},
+	}
+	for _, test := range tests {
+		err := precompiled.CodeError(test.code)
+		perr, ok := err.(*precompiled.Error)
+		if !ok || perr.Err != test.want {
+			t.Errorf("code %d: error %v, want %v", test.code, err, test.want)
+		}
+		if !ok || perr.Code != test.code {
+			t.Errorf("code %d: error %#v doesn't keep the code", test.code, err)
+		}
+	}
+	if err := precompiled.CodeError(-12345); err == nil || err.(*precompiled.Error).Err != nil {
+		t.Errorf("unknown code: error %v, want one wrapping nothing", err)
+	}
+	for _, code := range []int{0, 1, 42} {
+		if err := precompiled.CodeError(code); err != nil {
+			t.Errorf("code %d: error %v, want nil", code, err)
+		}
+	}
+	if !precompiled.IsPermissionDenied(precompiled.CodeError(-52002)) {
+		t.Error("code -52002 isn't a permission denial")
+	}
+}
+
+// word encodes x as int256.
+func word(x *big.Int) []byte {
+	return math.PaddedBigBytes(math.U256(x), 32)
+}
+
+func TestResultCode(t *testing.T) {
+	tests := []struct {
+		output  []byte
+		want    int
+		wantErr bool
+	}{
+		{output: word(big.NewInt(3)), want: 3},
+		{output: word(big.NewInt(-50001)), want: -50001},
+		{output: nil, wantErr: true},
+		{output: []byte{0x01}, wantErr: true},
+		{output: word(new(big.Int).Lsh(big.NewInt(1), 100)), wantErr: true},
+	}
+	for _, test := range tests {
+		code, err := precompiled.ResultCode(&types.Receipt{Output: test.output})
+		if (err != nil) != test.wantErr || code != test.want {
+			t.Errorf("output %x: code %d, error %v; want %d, error %t", test.output, code, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestTransactGroup(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	backend.Handle(precompiled.SystemConfigAddress, setABI, "set", precompiledtest.Code(1))
+	backend.SetDefaultGroup(3)
+	contract := precompiled.NewContract(precompiled.SystemConfigAddress, setABI, backend)
+
+	for _, test := range []struct{ explicit, want int }{{0, 3}, {2, 2}} {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		opts := precompiledtest.NewTransactor(t)
+		opts.GroupId = test.explicit
+		code, receipt, err := contract.Transact(ctx, opts, "set", "v")
+		cancel()
+		if err != nil {
+			t.Fatalf("group %d: Transact error: %v", test.explicit, err)
+		}
+		if code != 1 || receipt == nil {
+			t.Errorf("group %d: code %d, receipt %v", test.explicit, code, receipt)
+		}
+		txs := backend.Transactions()
+		if got := txs[len(txs)-1].Group; got != uint64(test.want) {
+			t.Errorf("group %d: transaction sent to group %d, want %d", test.explicit, got, test.want)
+		}
+	}
+}
+
+func TestTransactFailures(t *testing.T) {
+	backend := precompiledtest.NewBackend()
+	contract := precompiled.NewContract(precompiled.SystemConfigAddress, setABI, backend)
+	ctx := context.Background()
+
+	backend.Handle(precompiled.SystemConfigAddress, setABI, "set", precompiledtest.Code(-50001))
+	_, receipt, err := contract.Transact(ctx, precompiledtest.NewTransactor(t), "set", "v")
+	if perr, ok := err.(*precompiled.Error); !ok || perr.Err != precompiled.ErrTableExists || receipt == nil {
+		t.Errorf("negative code: error %v, receipt %v", err, receipt)
+	}
+
+	backend.Handle(precompiled.SystemConfigAddress, setABI, "set", func([]interface{}) ([]interface{}, error) {
+		return nil, precompiledtest.Status(types.StatusNoTxPermission)
+	})
+	_, receipt, err = contract.Transact(ctx, precompiledtest.NewTransactor(t), "set", "v")
+	if txErr, ok := err.(*precompiled.TransactionError); !ok || txErr.Receipt != receipt {
+		t.Fatalf("failed transaction: error %v, want *TransactionError", err)
+	}
+	if !precompiled.IsPermissionDenied(err) {
+		t.Errorf("status %s isn't a permission denial", receipt.Status)
+	}
+
+	rejected := errors.New("rejected")
+	backend.Handle(precompiled.SystemConfigAddress, setABI, "set", func([]interface{}) ([]interface{}, error) {
+		return nil, rejected
+	})
+	if _, _, err := contract.Transact(ctx, precompiledtest.NewTransactor(t), "set", "v"); err != rejected {
+		t.Errorf("rejected transaction: error %v, want %v", err, rejected)
+	}
+}
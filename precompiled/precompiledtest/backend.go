@@ -0,0 +1,249 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package precompiledtest provides a backend standing in for a node, and other
+// helpers for the tests of the precompiled contract services.
+package precompiledtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/chislab/go-fiscobcos"
+	"github.com/chislab/go-fiscobcos/accounts/abi"
+	"github.com/chislab/go-fiscobcos/common"
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+	"github.com/chislab/go-fiscobcos/core/types"
+)
+
+// Handler answers calls and transactions invoking a method of a contract. It
+// gets the unpacked arguments and returns the outputs to pack. A Status error
+// makes the transaction fail with that status, other errors are returned by
+// the backend as if the node rejected the request.
+type Handler func(args []interface{}) (outputs []interface{}, err error)
+
+// Code returns a handler answering with the int256 result code.
+func Code(code int) Handler {
+	return func([]interface{}) ([]interface{}, error) {
+		return []interface{}{big.NewInt(int64(code))}, nil
+	}
+}
+
+// Status is the execution status of a failed transaction, returned by handlers.
+type Status int
+
+func (s Status) Error() string { return fmt.Sprintf("transaction status %#x", int(s)) }
+
+// Invocation is a method invoked through the backend.
+type Invocation struct {
+	Contract common.Address
+	Method   string
+	Args     []interface{}
+	Group    uint64             // group of the transaction or call, 0 if a call names none
+	Tx       *types.Transaction // nil for calls
+}
+
+type receiptKey struct {
+	group uint64
+	hash  common.Hash
+}
+
+type handlerKey struct {
+	contract common.Address
+	method   string
+}
+
+// Backend is a bind.ContractBackend executing calls and transactions with the
+// handlers registered per contract method. Transactions are executed when sent
+// and their receipts are available right away, in the group of the
+// transaction only. Methods without handler fail.
+type Backend struct {
+	mu           sync.Mutex
+	abis         map[common.Address]abi.ABI
+	handlers     map[handlerKey]Handler
+	invocations  []Invocation
+	receipts     map[receiptKey]*types.Receipt
+	defaultGroup uint64
+}
+
+// NewBackend creates a backend without handlers.
+func NewBackend() *Backend {
+	return &Backend{
+		abis:     make(map[common.Address]abi.ABI),
+		handlers: make(map[handlerKey]Handler),
+		receipts: make(map[receiptKey]*types.Receipt),
+	}
+}
+
+// Handle registers the handler of a method of the contract at address,
+// described by abiJSON. It panics if the ABI is invalid.
+func (b *Backend) Handle(address common.Address, abiJSON, method string, handler Handler) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(fmt.Sprintf("precompiledtest: invalid ABI: %v", err))
+	}
+	if _, ok := parsed.Methods[method]; !ok {
+		panic(fmt.Sprintf("precompiledtest: no method %s in ABI", method))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.abis[address] = parsed
+	b.handlers[handlerKey{address, method}] = handler
+}
+
+// SetDefaultGroup sets the group of transactions not naming one, see
+// bind.GroupDefaulter.
+func (b *Backend) SetDefaultGroup(groupId uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.defaultGroup = groupId
+}
+
+// DefaultGroup implements bind.GroupDefaulter.
+func (b *Backend) DefaultGroup() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.defaultGroup
+}
+
+// Invocations returns the methods invoked so far, in order.
+func (b *Backend) Invocations() []Invocation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Invocation(nil), b.invocations...)
+}
+
+// Transactions returns the methods invoked by transactions so far, in order.
+func (b *Backend) Transactions() []Invocation {
+	var txs []Invocation
+	for _, inv := range b.Invocations() {
+		if inv.Tx != nil {
+			txs = append(txs, inv)
+		}
+	}
+	return txs
+}
+
+// invoke decodes input, records the invocation and runs its handler, packing
+// the outputs.
+func (b *Backend) invoke(contract common.Address, input []byte, group uint64, tx *types.Transaction) ([]byte, error) {
+	b.mu.Lock()
+	parsed, ok := b.abis[contract]
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("precompiledtest: no handlers for contract %s", contract.Hex())
+	}
+	if len(input) < 4 {
+		return nil, errors.New("precompiledtest: input without method id")
+	}
+	method, err := parsed.MethodById(input[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.UnpackValues(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("precompiledtest: unpacking arguments of %s: %v", method.Name, err)
+	}
+	b.mu.Lock()
+	b.invocations = append(b.invocations, Invocation{Contract: contract, Method: method.Name, Args: args, Group: group, Tx: tx})
+	handler := b.handlers[handlerKey{contract, method.Name}]
+	b.mu.Unlock()
+	if handler == nil {
+		return nil, fmt.Errorf("precompiledtest: no handler for %s", method.Name)
+	}
+	outputs, err := handler(args)
+	if err != nil {
+		return nil, err
+	}
+	return method.Outputs.Pack(outputs...)
+}
+
+// CodeAt returns a placeholder code for contracts with handlers.
+func (b *Backend) CodeAt(ctx context.Context, groupId uint64, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.abis[contract]; ok {
+		return []byte{0x00}, nil
+	}
+	return nil, nil
+}
+
+// CallContract runs the handler of the called method.
+func (b *Backend) CallContract(ctx context.Context, call fiscobcos.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if call.Msg.To == nil {
+		return nil, errors.New("precompiledtest: call without contract")
+	}
+	group := uint64(call.GroupId)
+	if group == 0 {
+		group, _ = fiscobcos.GroupFromContext(ctx)
+	}
+	return b.invoke(*call.Msg.To, call.Msg.Data, group, nil)
+}
+
+// GetBlockLimit implements bind.BlockLimiter.
+func (b *Backend) GetBlockLimit(ctx context.Context, groupId uint64) (*big.Int, error) {
+	return big.NewInt(500), nil
+}
+
+// SendTransaction executes the transaction, storing its receipt.
+func (b *Backend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if tx.To() == nil {
+		return errors.New("precompiledtest: deployments are not supported")
+	}
+	group := tx.GroupId().Uint64()
+	receipt := &types.Receipt{
+		Status: "0x0",
+		To:     tx.To(),
+		TxHash: tx.Hash(),
+		Input:  tx.Data(),
+	}
+	output, err := b.invoke(*tx.To(), tx.Data(), group, tx)
+	if status, ok := err.(Status); ok {
+		receipt.Status = hexutil.EncodeUint64(uint64(status))
+	} else if err != nil {
+		return err
+	}
+	receipt.Output = output
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receipts[receiptKey{group, tx.Hash()}] = receipt
+	return nil
+}
+
+// TransactionReceipt returns the receipt of a transaction sent to the group.
+func (b *Backend) TransactionReceipt(ctx context.Context, groupId uint64, txHash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if receipt, ok := b.receipts[receiptKey{groupId, txHash}]; ok {
+		return receipt, nil
+	}
+	return nil, fiscobcos.NotFound
+}
+
+// FilterLogs is not supported.
+func (b *Backend) FilterLogs(ctx context.Context, q fiscobcos.FilterQuery) ([]types.Log, error) {
+	return nil, errors.New("precompiledtest: logs are not supported")
+}
+
+// SubscribeFilterLogs is not supported.
+func (b *Backend) SubscribeFilterLogs(ctx context.Context, q fiscobcos.FilterQuery, ch chan<- types.Log) (fiscobcos.Subscription, error) {
+	return nil, errors.New("precompiledtest: logs are not supported")
+}
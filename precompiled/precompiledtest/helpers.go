@@ -0,0 +1,45 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package precompiledtest
+
+import (
+	"testing"
+
+	"github.com/chislab/go-fiscobcos/accounts/abi/bind"
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/precompiled"
+)
+
+// NewTransactor returns transaction options signing with a new key.
+func NewTransactor(t testing.TB) *bind.TransactOpts {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bind.NewKeyedTransactor(key)
+}
+
+// CodeErr returns the error of the result code err carries if it's a
+// *precompiled.Error, so that it can be compared with the errors of package
+// precompiled, and err otherwise.
+func CodeErr(err error) error {
+	if perr, ok := err.(*precompiled.Error); ok {
+		return perr.Err
+	}
+	return err
+}
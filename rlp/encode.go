@@ -106,6 +106,41 @@ func EncodeToBytes(val interface{}) ([]byte, error) {
 	return eb.toBytes(), nil
 }
 
+// EncoderBuffer encodes values into memory reused across encodings, sparing the
+// allocations of EncodeToBytes in hot paths. Buffers are pooled: take one with
+// NewEncoderBuffer and hand it back with Release.
+type EncoderBuffer struct {
+	buf *encbuf
+	out []byte
+}
+
+var encoderBufferPool = sync.Pool{
+	New: func() interface{} { return &EncoderBuffer{buf: &encbuf{sizebuf: make([]byte, 9)}} },
+}
+
+// NewEncoderBuffer returns a buffer from the pool.
+func NewEncoderBuffer() *EncoderBuffer {
+	return encoderBufferPool.Get().(*EncoderBuffer)
+}
+
+// Encode returns the RLP encoding of val, the same as EncodeToBytes does. The
+// result is only valid until the next call of Encode or Release, copy it to keep
+// it.
+func (b *EncoderBuffer) Encode(val interface{}) ([]byte, error) {
+	b.buf.reset()
+	if err := b.buf.encode(val); err != nil {
+		return nil, err
+	}
+	b.out = b.buf.appendBytes(b.out[:0])
+	return b.out, nil
+}
+
+// Release returns the buffer to the pool. Neither the buffer nor the encodings
+// it returned may be used afterwards.
+func (b *EncoderBuffer) Release() {
+	encoderBufferPool.Put(b)
+}
+
 // EncodeToReader returns a reader from which the RLP encoding of val
 // can be read. The returned size is the total size of the encoded
 // data.
@@ -121,10 +156,10 @@ func EncodeToReader(val interface{}) (size int, r io.Reader, err error) {
 }
 
 type encbuf struct {
-	str     []byte      // string data, contains everything except list headers
-	lheads  []*listhead // all list headers
-	lhsize  int         // sum of sizes of all encoded list headers
-	sizebuf []byte      // 9-byte auxiliary buffer for uint encoding
+	str     []byte     // string data, contains everything except list headers
+	lheads  []listhead // all list headers
+	lhsize  int        // sum of sizes of all encoded list headers
+	sizebuf []byte     // 9-byte auxiliary buffer for uint encoding
 }
 
 type listhead struct {
@@ -210,13 +245,16 @@ func (w *encbuf) encodeString(b []byte) {
 	}
 }
 
-func (w *encbuf) list() *listhead {
-	lh := &listhead{offset: len(w.str), size: w.lhsize}
-	w.lheads = append(w.lheads, lh)
-	return lh
+// list starts a list, returning the index of its header to pass to listEnd.
+// Headers are kept by value, so encoding a list doesn't allocate once the
+// buffer has grown.
+func (w *encbuf) list() int {
+	w.lheads = append(w.lheads, listhead{offset: len(w.str), size: w.lhsize})
+	return len(w.lheads) - 1
 }
 
-func (w *encbuf) listEnd(lh *listhead) {
+func (w *encbuf) listEnd(index int) {
+	lh := &w.lheads[index]
 	lh.size = w.size() - lh.offset - lh.size
 	if lh.size < 56 {
 		w.lhsize++ // length encoded into kind tag
@@ -231,6 +269,26 @@ func (w *encbuf) size() int {
 
 func (w *encbuf) toBytes() []byte {
 	out := make([]byte, w.size())
+	w.copyTo(out)
+	return out
+}
+
+// appendBytes appends the encoding to dst, growing it only if it lacks the
+// capacity.
+func (w *encbuf) appendBytes(dst []byte) []byte {
+	start, size := len(dst), w.size()
+	if cap(dst)-start < size {
+		grown := make([]byte, start, start+size)
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = dst[:start+size]
+	w.copyTo(dst[start:])
+	return dst
+}
+
+// copyTo writes the encoding to out, which must be w.size() bytes long.
+func (w *encbuf) copyTo(out []byte) {
 	strpos := 0
 	pos := 0
 	for _, head := range w.lheads {
@@ -244,7 +302,6 @@ func (w *encbuf) toBytes() []byte {
 	}
 	// copy string data after the last list header
 	copy(out[pos:], w.str[strpos:])
-	return out
 }
 
 func (w *encbuf) toWriter(out io.Writer) (err error) {
@@ -390,7 +447,11 @@ func writeRawValue(val reflect.Value, w *encbuf) error {
 }
 
 func writeUint(val reflect.Value, w *encbuf) error {
-	i := val.Uint()
+	w.encodeUint(val.Uint())
+	return nil
+}
+
+func (w *encbuf) encodeUint(i uint64) {
 	if i == 0 {
 		w.str = append(w.str, 0x80)
 	} else if i < 128 {
@@ -402,7 +463,6 @@ func writeUint(val reflect.Value, w *encbuf) error {
 		w.sizebuf[0] = 0x80 + byte(s)
 		w.str = append(w.str, w.sizebuf[:s+1]...)
 	}
-	return nil
 }
 
 func writeBool(val reflect.Value, w *encbuf) error {
@@ -433,12 +493,29 @@ func writeBigInt(i *big.Int, w *encbuf) error {
 		return fmt.Errorf("rlp: cannot encode negative *big.Int")
 	} else if cmp == 0 {
 		w.str = append(w.str, 0x80)
+	} else if bitlen := i.BitLen(); bitlen <= 64 {
+		w.encodeUint(i.Uint64())
 	} else {
-		w.encodeString(i.Bytes())
+		// Write the big-endian bytes into the buffer directly rather than
+		// allocating them with i.Bytes.
+		length := (bitlen + 7) / 8
+		w.encodeStringHeader(length)
+		w.str = append(w.str, make([]byte, length)...)
+		index := len(w.str)
+		for _, d := range i.Bits() {
+			for j := 0; j < wordBytes && index > len(w.str)-length; j++ {
+				index--
+				w.str[index] = byte(d)
+				d >>= 8
+			}
+		}
 	}
 	return nil
 }
 
+// wordBytes is the number of bytes in a big.Word.
+const wordBytes = (32 << (uint64(^big.Word(0)) >> 63)) / 8
+
 func writeBytes(val reflect.Value, w *encbuf) error {
 	w.encodeString(val.Bytes())
 	return nil
@@ -452,9 +529,7 @@ func writeByteArray(val reflect.Value, w *encbuf) error {
 		copy.Set(val)
 		val = copy
 	}
-	size := val.Len()
-	slice := val.Slice(0, size).Bytes()
-	w.encodeString(slice)
+	w.encodeString(byteArrayBytes(val))
 	return nil
 }
 
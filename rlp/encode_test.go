@@ -0,0 +1,184 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// refEncode is a plain RLP encoder following the yellow paper, allocating
+// freely. It is the reference the buffered encoders are checked against.
+func refEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case uint64:
+		if v == 0 {
+			return []byte{0x80}
+		}
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		return refEncode(bytes.TrimLeft(b[:], "\x00"))
+	case *big.Int:
+		return refEncode(v.Bytes())
+	case []byte:
+		if len(v) == 1 && v[0] < 0x80 {
+			return []byte{v[0]}
+		}
+		return append(refHeader(0x80, len(v)), v...)
+	case []interface{}:
+		var content []byte
+		for _, elem := range v {
+			content = append(content, refEncode(elem)...)
+		}
+		return append(refHeader(0xC0, len(content)), content...)
+	}
+	panic("refEncode: unsupported type")
+}
+
+func refHeader(offset byte, size int) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(size))
+	sizeBytes := bytes.TrimLeft(b[:], "\x00")
+	return append([]byte{offset + 55 + byte(len(sizeBytes))}, sizeBytes...)
+}
+
+// randValue returns a random value of the types refEncode supports, lists
+// nested up to depth levels.
+func randValue(rnd *rand.Rand, depth int) interface{} {
+	kind := rnd.Intn(4)
+	if depth == 0 {
+		kind = rnd.Intn(3)
+	}
+	switch kind {
+	case 0:
+		return rnd.Uint64() >> uint(rnd.Intn(64))
+	case 1:
+		b := make([]byte, rnd.Intn(40))
+		rnd.Read(b)
+		return new(big.Int).SetBytes(b)
+	case 2:
+		sizes := []int{0, 1, 2, 55, 56, 60, 1024}
+		b := make([]byte, sizes[rnd.Intn(len(sizes))])
+		rnd.Read(b)
+		return b
+	default:
+		list := make([]interface{}, rnd.Intn(8))
+		for i := range list {
+			list[i] = randValue(rnd, depth-1)
+		}
+		return list
+	}
+}
+
+func TestEncoderBufferDifferential(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	buf := NewEncoderBuffer()
+	defer buf.Release()
+	for i := 0; i < 20000; i++ {
+		val := randValue(rnd, 4)
+		want := refEncode(val)
+
+		enc, err := EncodeToBytes(val)
+		if err != nil {
+			t.Fatalf("value %d: EncodeToBytes error: %v", i, err)
+		}
+		if !bytes.Equal(enc, want) {
+			t.Fatalf("value %d: EncodeToBytes mismatch\ngot  %x\nwant %x", i, enc, want)
+		}
+		w := new(bytes.Buffer)
+		if err := Encode(w, val); err != nil {
+			t.Fatalf("value %d: Encode error: %v", i, err)
+		}
+		if !bytes.Equal(w.Bytes(), want) {
+			t.Fatalf("value %d: Encode mismatch\ngot  %x\nwant %x", i, w.Bytes(), want)
+		}
+		enc, err = buf.Encode(val)
+		if err != nil {
+			t.Fatalf("value %d: EncoderBuffer error: %v", i, err)
+		}
+		if !bytes.Equal(enc, want) {
+			t.Fatalf("value %d: EncoderBuffer mismatch\ngot  %x\nwant %x", i, enc, want)
+		}
+	}
+}
+
+type benchTx struct {
+	RandomId   *big.Int
+	Price      *big.Int
+	GasLimit   uint64
+	BlockLimit *big.Int
+	Recipient  *[20]byte `rlp:"nil"`
+	Amount     *big.Int
+	Payload    []byte
+	ChainId    *big.Int
+	GroupId    *big.Int
+	ExtraData  []byte
+	V          *big.Int
+	R          *big.Int
+	S          *big.Int
+}
+
+func newBenchTx() *benchTx {
+	rid, _ := new(big.Int).SetString("95ac1e7c71d1e9a6213c8c92d62b5e7d5f6eb4a3b9a0f4a6fd0b8dd4a1e0c4", 16)
+	r, _ := new(big.Int).SetString("e2a5b5dcf1d2e8e7a0c4ad9d5f1c2b9a7e1c3d6f4b8a9c0d1e2f3a4b5c6d7e8f", 16)
+	s, _ := new(big.Int).SetString("4b6f1c0d2e3a5b8c7d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c", 16)
+	return &benchTx{
+		RandomId:   rid,
+		Price:      big.NewInt(30000000),
+		GasLimit:   30000000,
+		BlockLimit: big.NewInt(1600),
+		Recipient:  &[20]byte{0xde, 0xad, 0xbe, 0xef},
+		Amount:     new(big.Int),
+		Payload:    make([]byte, 68),
+		ChainId:    big.NewInt(1),
+		GroupId:    big.NewInt(1),
+		ExtraData:  []byte{},
+		V:          big.NewInt(28),
+		R:          r,
+		S:          s,
+	}
+}
+
+func BenchmarkEncodeToBytes(b *testing.B) {
+	tx := newBenchTx()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeToBytes(tx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoderBuffer(b *testing.B) {
+	tx := newBenchTx()
+	buf := NewEncoderBuffer()
+	defer buf.Release()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buf.Encode(tx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+const (
+	// maxTopicLength is the longest AMOP topic, its length and the length byte
+	// must fit the single byte prefix of topic messages.
+	maxTopicLength = 254
+
+	// amopNoSubscriber is the result code of AMOP replies telling that no client
+	// subscribed to the topic is connected. Clients answer requests on topics
+	// they don't serve (anymore) with it too.
+	amopNoSubscriber = 99
+
+	// amopHandlerFailed is the result code of AMOP replies sent when the handler
+	// of the subscriber failed. The error message is the payload of the reply.
+	amopHandlerFailed = -1
+)
+
+var (
+	// ErrNoTopicSubscriber is returned by Publish if no client connected to the
+	// chain subscribed to the topic.
+	ErrNoTopicSubscriber = errors.New("no node subscribed to topic")
+
+	errTopicSubscribed = errors.New("topic already subscribed")
+)
+
+// AmopMessage is a message published on an AMOP topic.
+type AmopMessage struct {
+	Topic string
+	Data  []byte
+}
+
+// AmopHandler handles the messages published on a subscribed topic. The returned
+// bytes are sent back to the publisher; an error is reported to it instead.
+type AmopHandler func(msg AmopMessage) ([]byte, error)
+
+// SubscribeTopic subscribes the client to an AMOP topic, reporting the topic to
+// the node and calling handler with every message published on it. Handlers run
+// concurrently on goroutines of their own. The subscription outlives reconnects
+// until the returned function is called.
+//
+// It fails with ErrNotificationsUnsupported if the client is not connected
+// through the channel protocol.
+func (c *Client) SubscribeTopic(topic string, handler AmopHandler) (cancel func(), err error) {
+	if err := checkTopic(topic); err != nil {
+		return nil, err
+	}
+	if !c.isChannel {
+		return nil, ErrNotificationsUnsupported
+	}
+	c.chanMu.Lock()
+	if c.amopHandlers == nil {
+		c.amopHandlers = make(map[string]AmopHandler)
+	}
+	if _, ok := c.amopHandlers[topic]; ok {
+		c.chanMu.Unlock()
+		return nil, errTopicSubscribed
+	}
+	c.amopHandlers[topic] = handler
+	c.chanMu.Unlock()
+
+	unsubscribe := func() {
+		c.chanMu.Lock()
+		delete(c.amopHandlers, topic)
+		c.chanMu.Unlock()
+	}
+	if err := c.addTopic(topic); err != nil {
+		unsubscribe()
+		return nil, err
+	}
+	return func() {
+		unsubscribe()
+		c.removeTopic(topic)
+	}, nil
+}
+
+// SetTopicsHandler sets the handler of the topics set with UpdateTopics. Topics
+// subscribed with SubscribeTopic keep their own handlers.
+func (c *Client) SetTopicsHandler(handler AmopHandler) {
+	c.chanMu.Lock()
+	c.topicsHandler = handler
+	c.chanMu.Unlock()
+}
+
+// UpdateTopics replaces the set of topics served by the handler of
+// SetTopicsHandler, for gateways changing their topics at runtime without
+// reconnecting. The complete topic set of the connection, including the topics
+// subscribed otherwise, is reported to the node in a single frame. The node
+// doesn't acknowledge topic reports, so a heartbeat is sent after the report;
+// its reply confirms that the node read the report. If ctx has no deadline,
+// the confirmation is awaited for at most 10 seconds.
+//
+// The new set applies to all AMOP messages dispatched after the call began.
+// Requests on a removed topic are answered with result code 99, which
+// publishers take as no subscriber. If the report fails, the previous set is
+// restored and the error returned.
+func (c *Client) UpdateTopics(ctx context.Context, topics []string) error {
+	if !c.isChannel {
+		return ErrNotificationsUnsupported
+	}
+	set := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		if err := checkTopic(topic); err != nil {
+			return err
+		}
+		set[topic] = true
+	}
+	c.topicMu.Lock()
+	defer c.topicMu.Unlock()
+
+	c.chanMu.Lock()
+	prev := c.amopTopics
+	c.amopTopics = set
+	c.chanMu.Unlock()
+
+	err := c.reportTopics(ctx)
+	if err == nil {
+		err = c.confirmTopics(ctx)
+	}
+	if err != nil {
+		c.chanMu.Lock()
+		c.amopTopics = prev
+		c.chanMu.Unlock()
+	}
+	return err
+}
+
+// confirmTopics waits for the reply to a heartbeat, which the node sends after
+// handling the frames sent before, like a topic report.
+func (c *Client) confirmTopics(ctx context.Context) error {
+	cc := c.channel()
+	if cc == nil {
+		return ErrNotificationsUnsupported
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultWriteTimeout)
+		defer cancel()
+	}
+	_, err := cc.request(ctx, TYPE_HEATBEAT, []byte("0"))
+	return err
+}
+
+// Publish sends a message to one of the clients subscribed to the topic and
+// returns its reply. It fails with ErrNoTopicSubscriber if there is none.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	if err := checkTopic(topic); err != nil {
+		return nil, err
+	}
+	reply, err := c.ChannelRequest(ctx, TYPE_AMOP_REQ, topicMessage(topic, payload))
+	if err != nil {
+		if cerr, ok := err.(*ChannelError); ok {
+			switch cerr.Result {
+			case amopNoSubscriber:
+				return nil, ErrNoTopicSubscriber
+			case amopHandlerFailed:
+				if _, msg, perr := parseTopicMessage(reply); perr == nil {
+					return nil, fmt.Errorf("topic %q subscriber failed: %s", topic, msg)
+				}
+			}
+		}
+		return nil, err
+	}
+	if _, data, err := parseTopicMessage(reply); err == nil {
+		return data, nil
+	}
+	return reply, nil
+}
+
+// Broadcast sends a message to all clients subscribed to the topic, without
+// waiting for replies. The replies of their handlers are dropped.
+func (c *Client) Broadcast(ctx context.Context, topic string, payload []byte) error {
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+	cc := c.channel()
+	if cc == nil {
+		return ErrNotificationsUnsupported
+	}
+	return c.quitErr(cc.notify(ctx, TYPE_TOPIC_MULTICAST, topicMessage(topic, payload)))
+}
+
+// handleAmop passes an AMOP message to the handler of its topic. Requests are
+// answered with the reply of the handler, using the request's seq; broadcasts
+// aren't answered.
+func (c *Client) handleAmop(typ ChannelPack, seq [channelSeqLength]byte, body []byte) {
+	topic, data, err := parseTopicMessage(body)
+	if err != nil {
+		log.Debug("Dropping invalid AMOP request", "err", err)
+		return
+	}
+	c.chanMu.Lock()
+	handler := c.amopHandlers[topic]
+	if handler == nil && c.amopTopics[topic] {
+		handler = c.topicsHandler
+	}
+	c.chanMu.Unlock()
+
+	var (
+		result int32
+		resp   []byte
+	)
+	if handler == nil {
+		// Not subscribed, or no longer since UpdateTopics removed the topic.
+		result = amopNoSubscriber
+	} else if resp, err = handler(AmopMessage{Topic: topic, Data: data}); err != nil {
+		result, resp = amopHandlerFailed, []byte(err.Error())
+	}
+	cc := c.channel()
+	if cc == nil || typ != TYPE_AMOP_REQ {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultWriteTimeout)
+	defer cancel()
+	if err := cc.reply(ctx, TYPE_AMOP_RESP, seq, result, topicMessage(topic, resp)); err != nil {
+		log.Debug("Failed to reply to AMOP request", "topic", topic, "err", err)
+	}
+}
+
+func checkTopic(topic string) error {
+	if len(topic) == 0 || len(topic) > maxTopicLength {
+		return fmt.Errorf("invalid topic length %d, want 1-%d bytes", len(topic), maxTopicLength)
+	}
+	return nil
+}
+
+// topicMessage prefixes data with the topic, see parseTopicMessage.
+func topicMessage(topic string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(topic)+len(data))
+	body = append(body, byte(1+len(topic)))
+	body = append(body, topic...)
+	return append(body, data...)
+}
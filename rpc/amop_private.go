@@ -0,0 +1,269 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/gm"
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+// Private topics only deliver messages to subscribers which proved to hold one
+// of the keys accepted by the publisher. The node drives the verification: when
+// a subscriber reports a private topic it asks a publisher of the topic for a
+// check (TYPE_REQUEST_TOPICCERT), the publisher sends a random value to the
+// subscriber's verification topic, the subscriber returns its signature of the
+// value and the publisher reports the outcome (TYPE_UPDATE_TOPICSTATUS).
+const (
+	privateTopicPrefix = "#!$TopicNeedVerify_" // prefix of the topics messages are published on
+	verifyTopicPrefix  = "#!$VerifyChannel_"   // prefix of the subscribers' verification topics
+
+	// topicVerifyTimeout bounds the exchange with a subscriber being verified.
+	topicVerifyTimeout = 5 * time.Second
+)
+
+var (
+	errNoTopicKeys     = errors.New("no public keys for private topic")
+	errInvalidTopicSig = errors.New("invalid topic verification signature")
+)
+
+// topicVerifyRequest is sent by the node to ask for the verification of the
+// subscriber listening on Topic, a verification topic.
+type topicVerifyRequest struct {
+	Topic  string `json:"topic"`
+	NodeID string `json:"nodeId"`
+}
+
+// topicVerifyChallenge is sent by the publisher to the subscriber.
+type topicVerifyChallenge struct {
+	Topic     string `json:"topic"`
+	RandValue string `json:"randValue"`
+}
+
+// topicVerifyResponse is the subscriber's answer to a challenge.
+type topicVerifyResponse struct {
+	Signature string `json:"signature"`
+}
+
+// topicVerifyResult reports the outcome of a verification to the node.
+type topicVerifyResult struct {
+	CheckResult int    `json:"checkResult"` // 0 if the subscriber is accepted
+	NodeID      string `json:"nodeId"`
+	Topic       string `json:"topic"`
+}
+
+// SubscribePrivateTopic subscribes the client to a private AMOP topic, proving
+// possession of key to the publishers when the node asks for it. key may be a
+// secp256k1 or an SM2 key (see crypto/gm). Messages are delivered to handler
+// like with SubscribeTopic.
+func (c *Client) SubscribePrivateTopic(topic string, key *ecdsa.PrivateKey, handler AmopHandler) (cancel func(), err error) {
+	var suffix [16]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	verifyTopic := verifyTopicPrefix + privateTopicPrefix + topic + "_" + hex.EncodeToString(suffix[:])
+	if err := checkTopic(verifyTopic); err != nil {
+		return nil, err
+	}
+	stopVerify, err := c.SubscribeTopic(verifyTopic, func(msg AmopMessage) ([]byte, error) {
+		var challenge topicVerifyChallenge
+		if err := json.Unmarshal(msg.Data, &challenge); err != nil {
+			return nil, err
+		}
+		sig, err := signTopicValue(key, challenge.RandValue)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(&topicVerifyResponse{Signature: hex.EncodeToString(sig)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	stop, err := c.SubscribeTopic(privateTopicPrefix+topic, handler)
+	if err != nil {
+		stopVerify()
+		return nil, err
+	}
+	return func() {
+		stop()
+		stopVerify()
+	}, nil
+}
+
+// RegisterPrivateTopic makes the client a publisher of a private topic, which
+// accepts the subscribers holding the private key of one of pubKeys. Calling it
+// again replaces the keys. Publishers should register before subscribers
+// connect, the node only asks connected publishers to verify subscribers.
+func (c *Client) RegisterPrivateTopic(topic string, pubKeys []*ecdsa.PublicKey) error {
+	if len(pubKeys) == 0 {
+		return errNoTopicKeys
+	}
+	if err := checkTopic(privateTopicPrefix + topic); err != nil {
+		return err
+	}
+	if !c.isChannel {
+		return ErrNotificationsUnsupported
+	}
+	c.chanMu.Lock()
+	if c.privateTopics == nil {
+		c.privateTopics = make(map[string][]*ecdsa.PublicKey)
+	}
+	_, registered := c.privateTopics[topic]
+	c.privateTopics[topic] = pubKeys
+	c.chanMu.Unlock()
+
+	if registered {
+		return nil
+	}
+	if err := c.addTopic(privateTopicPrefix + topic); err != nil {
+		c.chanMu.Lock()
+		delete(c.privateTopics, topic)
+		c.chanMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// PublishPrivate sends a message to one of the verified subscribers of a private
+// topic and returns its reply, registering the client as a publisher accepting
+// pubKeys first. It fails with ErrNoTopicSubscriber until a subscriber has been
+// verified.
+func (c *Client) PublishPrivate(ctx context.Context, topic string, pubKeys []*ecdsa.PublicKey, payload []byte) ([]byte, error) {
+	if err := c.RegisterPrivateTopic(topic, pubKeys); err != nil {
+		return nil, err
+	}
+	return c.Publish(ctx, privateTopicPrefix+topic, payload)
+}
+
+// verifyTopicSubscriber handles a verification request of the node, challenging
+// the subscriber and reporting whether it holds an accepted key.
+func (c *Client) verifyTopicSubscriber(body []byte) {
+	// The request may come with a topic prefix, the JSON document follows it.
+	if _, data, err := parseTopicMessage(body); err == nil && len(data) > 0 && data[0] == '{' {
+		body = data
+	}
+	var req topicVerifyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		log.Debug("Dropping invalid topic verification request", "err", err)
+		return
+	}
+	topic, ok := privateTopicOf(req.Topic)
+	if !ok {
+		return
+	}
+	c.chanMu.Lock()
+	keys := c.privateTopics[topic]
+	c.chanMu.Unlock()
+	if keys == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), topicVerifyTimeout)
+	defer cancel()
+
+	result := topicVerifyResult{CheckResult: 1, NodeID: req.NodeID, Topic: req.Topic}
+	if err := c.challengeSubscriber(ctx, req.Topic, keys); err != nil {
+		log.Warn("Private topic subscriber rejected", "topic", topic, "err", err)
+	} else {
+		result.CheckResult = 0
+	}
+	resp, _ := json.Marshal(&result)
+	cc := c.channel()
+	if cc == nil {
+		return
+	}
+	if err := cc.notify(ctx, TYPE_UPDATE_TOPICSTATUS, resp); err != nil {
+		log.Debug("Failed to report topic verification", "topic", topic, "err", err)
+	}
+}
+
+// challengeSubscriber sends a random value to the verification topic of a
+// subscriber and checks that it is signed by one of keys.
+func (c *Client) challengeSubscriber(ctx context.Context, verifyTopic string, keys []*ecdsa.PublicKey) error {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return err
+	}
+	value := hex.EncodeToString(random[:])
+	challenge, _ := json.Marshal(&topicVerifyChallenge{Topic: verifyTopic, RandValue: value})
+	reply, err := c.Publish(ctx, verifyTopic, challenge)
+	if err != nil {
+		return err
+	}
+	var resp topicVerifyResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(resp.Signature, "0x"))
+	if err != nil {
+		return err
+	}
+	signer, err := topicValueSigner(value, sig)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Curve == signer.Curve && key.X.Cmp(signer.X) == 0 && key.Y.Cmp(signer.Y) == 0 {
+			return nil
+		}
+	}
+	return errors.New("subscriber key not accepted")
+}
+
+// privateTopicOf extracts the private topic from a subscriber's verification
+// topic, which is suffixed with "_" and a random string.
+func privateTopicOf(verifyTopic string) (string, bool) {
+	prefix := verifyTopicPrefix + privateTopicPrefix
+	if !strings.HasPrefix(verifyTopic, prefix) {
+		return "", false
+	}
+	topic := verifyTopic[len(prefix):]
+	i := strings.LastIndex(topic, "_")
+	if i < 0 {
+		return "", false
+	}
+	return topic[:i], true
+}
+
+// signTopicValue signs a verification challenge: the Keccak256 hash of the value
+// with secp256k1 keys, the SM3 hash with SM2 keys.
+func signTopicValue(key *ecdsa.PrivateKey, value string) ([]byte, error) {
+	if gm.IsSM2(&key.PublicKey) {
+		return gm.SignHash(gm.SM3([]byte(value)), key)
+	}
+	return crypto.Sign(crypto.Keccak256([]byte(value)), key)
+}
+
+// topicValueSigner returns the key which signed a challenge, see signTopicValue.
+func topicValueSigner(value string, sig []byte) (*ecdsa.PublicKey, error) {
+	switch len(sig) {
+	case gm.SignatureLength:
+		return gm.VerifyHash(gm.SM3([]byte(value)), sig)
+	case 65: // [R || S || V]
+		return crypto.SigToPub(crypto.Keccak256([]byte(value)), sig)
+	}
+	return nil, fmt.Errorf("%v: length %d", errInvalidTopicSig, len(sig))
+}
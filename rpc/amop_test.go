@@ -0,0 +1,371 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// amopRouter is the AMOP routing of a node. It keeps the topics reported by
+// every connection, forwards requests to a subscriber of their topic and relays
+// the replies to the publisher.
+type amopRouter struct {
+	mu      sync.Mutex
+	topics  map[net.Conn][]string
+	pending map[[channelSeqLength]byte]amopRoute
+	seq     int
+}
+
+// amopRoute is where the reply to a forwarded request goes.
+type amopRoute struct {
+	conn net.Conn
+	seq  [channelSeqLength]byte
+}
+
+func newAmopRouter() *amopRouter {
+	return &amopRouter{
+		topics:  make(map[net.Conn][]string),
+		pending: make(map[[channelSeqLength]byte]amopRoute),
+	}
+}
+
+// serve handles the frames of a connection until it breaks.
+func (r *amopRouter) serve(conn *tls.Conn) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.topics, conn)
+		r.mu.Unlock()
+	}()
+	for {
+		f := new(ChannelMessage)
+		if err := f.DecodeFrom(conn); err != nil {
+			return
+		}
+		r.mu.Lock()
+		switch f.Type {
+		case TYPE_HEATBEAT:
+			r.write(conn, &ChannelMessage{Type: TYPE_HEATBEAT, Seq: f.Seq, Payload: []byte("1")})
+		case TYPE_TOPIC_REPORT:
+			var topics []string
+			json.Unmarshal(f.Payload, &topics)
+			r.topics[conn] = topics
+		case TYPE_AMOP_REQ:
+			topic, _, _ := parseTopicMessage(f.Payload)
+			sub := r.subscriber(topic)
+			if sub == nil {
+				r.write(conn, &ChannelMessage{Type: TYPE_AMOP_RESP, Seq: f.Seq, Result: amopNoSubscriber, Payload: topicMessage(topic, nil)})
+				break
+			}
+			r.seq++
+			var seq [channelSeqLength]byte
+			copy(seq[:], fmt.Sprintf("%0*x", channelSeqLength, r.seq))
+			r.pending[seq] = amopRoute{conn: conn, seq: f.Seq}
+			r.write(sub, &ChannelMessage{Type: TYPE_AMOP_REQ, Seq: seq, Payload: f.Payload})
+		case TYPE_AMOP_RESP:
+			if route, ok := r.pending[f.Seq]; ok {
+				delete(r.pending, f.Seq)
+				r.write(route.conn, &ChannelMessage{Type: TYPE_AMOP_RESP, Seq: route.seq, Result: f.Result, Payload: f.Payload})
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// subscriber returns a connection subscribed to topic, or nil. The caller must
+// hold mu.
+func (r *amopRouter) subscriber(topic string) net.Conn {
+	for conn, topics := range r.topics {
+		for _, t := range topics {
+			if t == topic {
+				return conn
+			}
+		}
+	}
+	return nil
+}
+
+// write sends f on conn. The caller must hold mu.
+func (r *amopRouter) write(conn net.Conn, f *ChannelMessage) {
+	if buf, err := f.Encode(); err == nil {
+		conn.Write(buf)
+	}
+}
+
+// waitTopic waits until a connection reported topic, or none does anymore.
+func (r *amopRouter) waitTopic(t *testing.T, topic string, subscribed bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		r.mu.Lock()
+		sub := r.subscriber(topic)
+		r.mu.Unlock()
+		if (sub != nil) == subscribed {
+			return
+		}
+	}
+	t.Fatalf("topic %q not reported as subscribed=%t", topic, subscribed)
+}
+
+// TestAmopLoopback publishes messages from one channel client to another through
+// a node routing the topics.
+func TestAmopLoopback(t *testing.T) {
+	ca := newTestCA(t)
+	router := newAmopRouter()
+	node := newFakeChannelNode(t, ca, router.serve)
+	defer node.close()
+	sub := dialFakeNode(t, ca, node)
+	defer sub.Close()
+	pub := dialFakeNode(t, ca, node)
+	defer pub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := pub.Publish(ctx, "echo", []byte("hi")); err != ErrNoTopicSubscriber {
+		t.Fatalf("publishing without subscriber: got error %v, want ErrNoTopicSubscriber", err)
+	}
+
+	received := make(chan AmopMessage, 1)
+	unsubscribe, err := sub.SubscribeTopic("echo", func(msg AmopMessage) ([]byte, error) {
+		select {
+		case received <- msg:
+		default:
+		}
+		return append([]byte("echo: "), msg.Data...), nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeTopic error: %v", err)
+	}
+	if _, err := sub.SubscribeTopic("echo", nil); err != errTopicSubscribed {
+		t.Errorf("subscribing twice: got error %v, want errTopicSubscribed", err)
+	}
+	router.waitTopic(t, "echo", true)
+
+	reply, err := pub.Publish(ctx, "echo", []byte("hi"))
+	if err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if string(reply) != "echo: hi" {
+		t.Errorf("got reply %q, want %q", reply, "echo: hi")
+	}
+	if msg := <-received; msg.Topic != "echo" || string(msg.Data) != "hi" {
+		t.Errorf("handler got %+v, want topic echo and data hi", msg)
+	}
+
+	// Concurrent requests each get their own reply.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := fmt.Sprintf("message %d", i)
+			reply, err := pub.Publish(ctx, "echo", []byte(data))
+			if err != nil {
+				t.Errorf("Publish %d error: %v", i, err)
+			} else if string(reply) != "echo: "+data {
+				t.Errorf("Publish %d: got reply %q", i, reply)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	unsubscribe()
+	router.waitTopic(t, "echo", false)
+	if _, err := pub.Publish(ctx, "echo", []byte("hi")); err != ErrNoTopicSubscriber {
+		t.Errorf("publishing after unsubscribing: got error %v, want ErrNoTopicSubscriber", err)
+	}
+}
+
+// TestAmopHandlerError checks that the error of a subscriber's handler reaches
+// the publisher.
+func TestAmopHandlerError(t *testing.T) {
+	ca := newTestCA(t)
+	router := newAmopRouter()
+	node := newFakeChannelNode(t, ca, router.serve)
+	defer node.close()
+	sub := dialFakeNode(t, ca, node)
+	defer sub.Close()
+	pub := dialFakeNode(t, ca, node)
+	defer pub.Close()
+
+	_, err := sub.SubscribeTopic("fail", func(AmopMessage) ([]byte, error) {
+		return nil, errors.New("out of stock")
+	})
+	if err != nil {
+		t.Fatalf("SubscribeTopic error: %v", err)
+	}
+	router.waitTopic(t, "fail", true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = pub.Publish(ctx, "fail", []byte("order"))
+	if err == nil || !strings.Contains(err.Error(), "out of stock") {
+		t.Errorf("got error %v, want the handler's error", err)
+	}
+}
+
+// TestUpdateTopicsRace changes the topics of a client while the node sends it
+// AMOP requests, checking that every request is answered by a handler or with
+// result code 99, and never by the handler of a topic that wasn't set.
+func TestUpdateTopicsRace(t *testing.T) {
+	ca := newTestCA(t)
+	var (
+		wmu     sync.Mutex // serializes the frames written by the node
+		mu      sync.Mutex
+		reports [][]string
+		replies = make(map[[channelSeqLength]byte]*ChannelMessage)
+	)
+	write := func(conn net.Conn, f *ChannelMessage) {
+		buf, _ := f.Encode()
+		wmu.Lock()
+		conn.Write(buf)
+		wmu.Unlock()
+	}
+	conns := make(chan net.Conn, 1)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		conns <- conn
+		for {
+			f := new(ChannelMessage)
+			if err := f.DecodeFrom(conn); err != nil {
+				return
+			}
+			switch f.Type {
+			case TYPE_HEATBEAT:
+				write(conn, &ChannelMessage{Type: TYPE_HEATBEAT, Seq: f.Seq, Payload: []byte("1")})
+			case TYPE_TOPIC_REPORT:
+				var topics []string
+				json.Unmarshal(f.Payload, &topics)
+				sort.Strings(topics)
+				mu.Lock()
+				reports = append(reports, topics)
+				mu.Unlock()
+			case TYPE_AMOP_RESP:
+				mu.Lock()
+				replies[f.Seq] = f
+				mu.Unlock()
+			}
+		}
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+	conn := <-conns
+
+	client.SetTopicsHandler(func(msg AmopMessage) ([]byte, error) { return []byte("set"), nil })
+	if _, err := client.SubscribeTopic("own", func(msg AmopMessage) ([]byte, error) { return []byte("own"), nil }); err != nil {
+		t.Fatalf("SubscribeTopic error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.UpdateTopics(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("UpdateTopics error: %v", err)
+	}
+
+	// Send requests on topics always set (b), set some of the time (a, c),
+	// subscribed otherwise (own) and never set (d).
+	var (
+		sent   = make(map[[channelSeqLength]byte]string)
+		nextID int
+	)
+	request := func(topic string) {
+		nextID++
+		var seq [channelSeqLength]byte
+		copy(seq[:], fmt.Sprintf("%0*x", channelSeqLength, nextID))
+		sent[seq] = topic
+		write(conn, &ChannelMessage{Type: TYPE_AMOP_REQ, Seq: seq, Payload: topicMessage(topic, []byte("request"))})
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, topic := range []string{"a", "b", "c", "d", "own"} {
+				request(topic)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		topics := []string{"a", "b"}
+		if i%2 == 1 {
+			topics = []string{"b", "c"}
+		}
+		if err := client.UpdateTopics(ctx, topics); err != nil {
+			t.Fatalf("UpdateTopics %d error: %v", i, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	// The last update set b and c: a is no longer served.
+	request("a")
+	request("c")
+	lastA, lastC := nextID-1, nextID
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		mu.Lock()
+		n := len(replies)
+		mu.Unlock()
+		if n == len(sent) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d replies to %d requests", n, len(sent))
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for seq, topic := range sent {
+		reply := replies[seq]
+		_, data, err := parseTopicMessage(reply.Payload)
+		if err != nil {
+			t.Fatalf("invalid reply on %s: %v", topic, err)
+		}
+		var id int
+		fmt.Sscanf(string(seq[:]), "%x", &id)
+		served := reply.Result == 0
+		switch {
+		case reply.Result != 0 && reply.Result != amopNoSubscriber:
+			t.Errorf("request %d on %s: got result %d", id, topic, reply.Result)
+		case topic == "own" && (!served || string(data) != "own"):
+			t.Errorf("request %d on own: got result %d and reply %q", id, reply.Result, data)
+		case topic != "own" && served && string(data) != "set":
+			t.Errorf("request %d on %s: got reply %q", id, topic, data)
+		case topic == "b" && !served, topic == "d" && served:
+			t.Errorf("request %d on %s: got result %d", id, topic, reply.Result)
+		case id == lastA && served, id == lastC && !served:
+			t.Errorf("request on %s after the last update: got result %d", topic, reply.Result)
+		}
+	}
+	if last := reports[len(reports)-1]; !reflect.DeepEqual(last, []string{"b", "c", "own"}) {
+		t.Errorf("last topic report %v, want [b c own]", last)
+	}
+}
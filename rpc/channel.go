@@ -1,38 +1,482 @@
 package rpc
 
 import (
-	"github.com/chislab/go-fiscobcos/common/hexutil"
-	"github.com/pborman/uuid"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/log"
 )
 
 type ChannelPack int
 
 const (
-	TYPE_RPC ChannelPack = 0x12
-	TYPE_HEATBEAT ChannelPack = 0x13
-	TYPE_AMOP_REQ ChannelPack = 0x30
-	TYPE_AMOP_RESP ChannelPack = 0x31
-	TYPE_TOPIC_REPORT ChannelPack = 0x32
-	TYPE_TOPIC_MULTICAST ChannelPack = 0x35
-	TYPE_TX_COMMITTED ChannelPack = 0x1000
-	TYPE_TX_BLOCKNUM ChannelPack = 0x1001
+	TYPE_RPC                  ChannelPack = 0x12
+	TYPE_HEATBEAT             ChannelPack = 0x13
+	TYPE_EVENT_LOG_REGISTER   ChannelPack = 0x15
+	TYPE_EVENT_LOG_UNREGISTER ChannelPack = 0x16
+	TYPE_AMOP_REQ             ChannelPack = 0x30
+	TYPE_AMOP_RESP            ChannelPack = 0x31
+	TYPE_TOPIC_REPORT         ChannelPack = 0x32
+	TYPE_TOPIC_MULTICAST      ChannelPack = 0x35
+	TYPE_REQUEST_TOPICCERT    ChannelPack = 0x37
+	TYPE_UPDATE_TOPICSTATUS   ChannelPack = 0x38
+	TYPE_TX_COMMITTED         ChannelPack = 0x1000
+	TYPE_TX_BLOCKNUM          ChannelPack = 0x1001
+	TYPE_EVENT_LOG_PUSH       ChannelPack = 0x1002
 )
 
-func GenMsgSeq() ([]byte, error) {
-	uid := uuid.New()
-	splited := strings.Split(uid, "-")
-	uid = "0X"
-	for _, v := range splited {
-		uid += v
+// knownChannelPack reports whether typ is one of the message types above.
+func knownChannelPack(typ ChannelPack) bool {
+	switch typ {
+	case TYPE_RPC, TYPE_HEATBEAT, TYPE_EVENT_LOG_REGISTER, TYPE_EVENT_LOG_UNREGISTER,
+		TYPE_AMOP_REQ, TYPE_AMOP_RESP, TYPE_TOPIC_REPORT, TYPE_TOPIC_MULTICAST,
+		TYPE_REQUEST_TOPICCERT, TYPE_UPDATE_TOPICSTATUS,
+		TYPE_TX_COMMITTED, TYPE_TX_BLOCKNUM, TYPE_EVENT_LOG_PUSH:
+		return true
 	}
-	return hexutil.Decode(strings.ToUpper(uid))
+	return false
 }
 
-func GenZeroSeq() ([]byte, error) {
-	return hexutil.Decode("0x00000000000000000000000000000000")
+// channelCodec is implemented by connections speaking the FISCO BCOS channel
+// protocol. Besides JSON-RPC they carry typed messages, some of which are pushed
+// by the node without a preceding request.
+type channelCodec interface {
+	ServerCodec
+	// request sends a message of the given type and waits for the node's reply,
+	// which is matched to the request by its sequence number.
+	request(ctx context.Context, typ ChannelPack, body []byte) ([]byte, error)
+	// notify sends a message of the given type without waiting for a reply.
+	notify(ctx context.Context, typ ChannelPack, body []byte) error
+	// reply answers a pushed message, sending a message with its seq.
+	reply(ctx context.Context, typ ChannelPack, seq [channelSeqLength]byte, result int32, body []byte) error
+	// setPushHandler sets the function called with every message pushed by the
+	// node, in the order they arrive.
+	setPushHandler(fn func(typ ChannelPack, seq [channelSeqLength]byte, body []byte))
+	// setMetrics sets the function returning the receiver of the connection's
+	// measurements.
+	setMetrics(fn func() Metrics)
+	// setLogger sets the function returning the wire logger of the connection.
+	setLogger(fn func() log.Logger)
+	// setLimits sets the function returning the limits of the connection.
+	setLimits(fn func() channelLimits)
+	// closeWrite tells the node that no more messages follow, leaving the
+	// connection open for reading. It reports whether that is supported.
+	closeWrite() bool
+}
+
+// channelListener is a registration for pushed messages.
+type channelListener struct {
+	fn func(body []byte)
+}
+
+// reconnectHook is a registration for reconnect notifications.
+type reconnectHook struct {
+	fn func()
+}
+
+// setChannel makes cc the connection channel messages are sent on. Pushed
+// messages of all connections go to the listeners of the client.
+func (c *Client) setChannel(cc channelCodec) {
+	cc.setPushHandler(c.dispatchPush)
+	cc.setMetrics(c.Metrics)
+	cc.setLogger(c.logger)
+	cc.setLimits(c.channelLimits)
+	c.chanMu.Lock()
+	c.chanConn = cc
+	c.chanMu.Unlock()
+}
+
+// SetMaxFrameSize sets the size limit of the channel messages read from and
+// written to the node, DefaultMaxFrameSize by default. Reading a larger message
+// ends the connection, as the rest of the stream can't be trusted; writing one
+// fails. A size smaller than a message header restores the default.
+func (c *Client) SetMaxFrameSize(size int) {
+	// chanMu serializes the setters, the limits are read without it.
+	c.chanMu.Lock()
+	defer c.chanMu.Unlock()
+	limits := c.channelLimits()
+	if limits.maxFrameSize = size; size < channelHeaderLength {
+		limits.maxFrameSize = DefaultMaxFrameSize
+	}
+	c.chanLimits.Store(limits)
+}
+
+// SetResponseTimeout sets how long the reply to a channel message is awaited
+// if the context of the request has no deadline, DefaultResponseTimeout by
+// default. The sequence numbers of requests without timely reply are released
+// once the timeout expires. A timeout of zero or less restores the default.
+func (c *Client) SetResponseTimeout(timeout time.Duration) {
+	c.chanMu.Lock()
+	defer c.chanMu.Unlock()
+	limits := c.channelLimits()
+	if limits.responseTimeout = timeout; timeout <= 0 {
+		limits.responseTimeout = DefaultResponseTimeout
+	}
+	c.chanLimits.Store(limits)
+}
+
+// channelLimits returns the limits of the client's channel connections.
+func (c *Client) channelLimits() channelLimits {
+	if limits, ok := c.chanLimits.Load().(channelLimits); ok {
+		return limits
+	}
+	return defaultChannelLimits
+}
+
+// channel returns the current channel connection, which may be broken, or nil
+// if the client doesn't use the channel protocol.
+func (c *Client) channel() channelCodec {
+	c.chanMu.Lock()
+	defer c.chanMu.Unlock()
+	return c.chanConn
+}
+
+// ChannelRequest sends a typed channel protocol message to the node and returns
+// its reply. It fails with ErrNotificationsUnsupported if the client is not
+// connected through the channel protocol, with ErrConnectionLost while the
+// connection is down and with ErrClientQuit once the client is closed.
+func (c *Client) ChannelRequest(ctx context.Context, typ ChannelPack, body []byte) ([]byte, error) {
+	cc := c.channel()
+	if cc == nil {
+		return nil, ErrNotificationsUnsupported
+	}
+	if c.closed() {
+		return nil, ErrClientQuit
+	}
+	m, method := c.Metrics(), ChannelMethod(typ)
+	m.IncInflight(method, 0)
+	start := time.Now()
+
+	reply, err := cc.request(ctx, typ, body)
+	err = c.quitErr(err)
+	m.DecInflight(method, 0)
+	m.ObserveRequest(method, 0, time.Since(start), err)
+	return reply, err
+}
+
+// quitErr replaces the failure of a channel request cut short by Close with
+// ErrClientQuit. Failures reported by the node are kept.
+func (c *Client) quitErr(err error) error {
+	if err == nil || !c.closed() {
+		return err
+	}
+	if _, ok := err.(*ChannelError); ok {
+		return err
+	}
+	return ErrClientQuit
+}
+
+// ChannelListen registers fn to be called with every message of the given type
+// pushed by the node. The registration outlives reconnects. It fails with
+// ErrNotificationsUnsupported if the client is not connected through the channel
+// protocol.
+func (c *Client) ChannelListen(typ ChannelPack, fn func(body []byte)) (cancel func(), err error) {
+	if !c.isChannel {
+		return nil, ErrNotificationsUnsupported
+	}
+	l := &channelListener{fn: fn}
+	c.chanMu.Lock()
+	if c.listeners == nil {
+		c.listeners = make(map[ChannelPack][]*channelListener)
+	}
+	c.listeners[typ] = append(c.listeners[typ], l)
+	c.chanMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.chanMu.Lock()
+			defer c.chanMu.Unlock()
+			ls := c.listeners[typ]
+			for i := range ls {
+				if ls[i] == l {
+					c.listeners[typ] = append(ls[:i:i], ls[i+1:]...)
+					break
+				}
+			}
+		})
+	}, nil
+}
+
+// pushWaiter is carried by the context of a call awaiting a message pushed in
+// response to it. The channel connection registers the seq of the request and
+// sets wait.
+type pushWaiter struct {
+	wait func(ctx context.Context) ([]byte, error)
+}
+
+type pushWaiterKey struct{}
+
+// CallAwaitPush performs a JSON-RPC call like CallContext and prepares to receive
+// the message the node pushes later in response to the same request, like the
+// TYPE_TX_COMMITTED receipt of sendRawTransaction. If the call succeeds, wait
+// must be called: it returns the body of the pushed message, fails with
+// ErrConnectionLost if the connection breaks first, or ErrClientQuit if the
+// client is closed, and stops waiting when its context is done.
+//
+// It fails with ErrNotificationsUnsupported if the client is not connected
+// through the channel protocol.
+func (c *Client) CallAwaitPush(ctx context.Context, result interface{}, method string, args ...interface{}) (wait func(ctx context.Context) ([]byte, error), err error) {
+	if !c.isChannel {
+		return nil, ErrNotificationsUnsupported
+	}
+	w := new(pushWaiter)
+	err = c.CallContext(context.WithValue(ctx, pushWaiterKey{}, w), result, method, args...)
+	if w.wait == nil {
+		if err == nil {
+			err = ErrConnectionLost
+		}
+		return nil, err
+	}
+	if err != nil {
+		// Release the registration, no push will follow a failed call.
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		w.wait(cancelled)
+		return nil, err
+	}
+	return func(ctx context.Context) ([]byte, error) {
+		body, err := w.wait(ctx)
+		return body, c.quitErr(err)
+	}, nil
+}
+
+// dispatchPush calls the listeners of a pushed message.
+func (c *Client) dispatchPush(typ ChannelPack, seq [channelSeqLength]byte, body []byte) {
+	start := time.Now()
+	defer func() { c.Metrics().ObservePush(typ, time.Since(start)) }()
+
+	switch typ {
+	case TYPE_AMOP_REQ, TYPE_TOPIC_MULTICAST:
+		go c.handleAmop(typ, seq, body)
+		return
+	case TYPE_REQUEST_TOPICCERT:
+		go c.verifyTopicSubscriber(body)
+		return
+	}
+	c.chanMu.Lock()
+	listeners := c.listeners[typ]
+	c.chanMu.Unlock()
+
+	for _, l := range listeners {
+		l.fn(body)
+	}
 }
 
-func SockReq() {
-	//tls.LoadX509KeyPair()
-}
\ No newline at end of file
+// OnReconnect registers fn to be called after the client re-established a
+// broken channel connection. Topic registrations, and with them block number
+// notifications, are restored before fn is called; registrations made with
+// typed requests, like event log filters, are up to fn. The returned function
+// removes the registration.
+func (c *Client) OnReconnect(fn func()) (cancel func()) {
+	h := &reconnectHook{fn: fn}
+	c.chanMu.Lock()
+	c.onReconnect = append(c.onReconnect, h)
+	c.chanMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.chanMu.Lock()
+			defer c.chanMu.Unlock()
+			for i := range c.onReconnect {
+				if c.onReconnect[i] == h {
+					c.onReconnect = append(c.onReconnect[:i:i], c.onReconnect[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+func (c *Client) runReconnectHooks() {
+	c.chanMu.Lock()
+	hooks := c.onReconnect
+	c.chanMu.Unlock()
+
+	for _, h := range hooks {
+		h.fn()
+	}
+}
+
+// redial re-establishes a broken channel connection in the background, so that
+// pushes resume without waiting for the next call. Failed attempts are repeated
+// with exponential backoff until a connection is up or the client is closed.
+func (c *Client) redial(dead ServerCodec) {
+	delay := minRedialInterval
+	for {
+		// Take the write lock, the connection may only be replaced under it.
+		select {
+		case c.reqInit <- new(requestOp):
+		case <-c.closing:
+			return
+		}
+		var err error
+		if c.writeConn == dead || c.writeConn == nil {
+			c.writeConn = nil
+			err = c.reconnect(context.Background())
+		}
+		c.reqSent <- err
+		if err == nil || err == ErrClientQuit {
+			return
+		}
+		log.Debug("Channel redial failed", "err", err, "retry", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-c.closing:
+			return
+		}
+		if delay *= 2; delay > maxRedialInterval {
+			delay = maxRedialInterval
+		}
+	}
+}
+
+// blockNotifyTopicPrefix prefixes the topic the node publishes the block numbers
+// of a group on, e.g. "_block_notify_1".
+const blockNotifyTopicPrefix = "_block_notify_"
+
+var errInvalidTopicMessage = errors.New("invalid topic message")
+
+// ListenBlockNumber registers fn to be called with the number of every block the
+// node commits in the given group. The registration is re-established when the
+// client reconnects. It fails with ErrNotificationsUnsupported if the client is
+// not connected through the channel protocol.
+func (c *Client) ListenBlockNumber(groupId uint64, fn func(number uint64)) (cancel func(), err error) {
+	topic := blockNotifyTopicPrefix + strconv.FormatUint(groupId, 10)
+	stop, err := c.ChannelListen(TYPE_TX_BLOCKNUM, func(body []byte) {
+		t, data, err := parseTopicMessage(body)
+		if err != nil || t != topic {
+			return
+		}
+		// The payload is "<groupId>,<blockNumber>"
+		parts := strings.Split(string(data), ",")
+		if len(parts) != 2 {
+			return
+		}
+		if number, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64); err == nil {
+			fn(number)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.addTopic(topic); err != nil {
+		stop()
+		return nil, err
+	}
+	return func() {
+		stop()
+		c.removeTopic(topic)
+	}, nil
+}
+
+// addTopic subscribes the connection to a topic, reporting the new topic set
+// to the node if it wasn't subscribed yet.
+func (c *Client) addTopic(topic string) error {
+	c.topicMu.Lock()
+	defer c.topicMu.Unlock()
+
+	if c.topics == nil {
+		c.topics = make(map[string]int)
+	}
+	c.topics[topic]++
+	if c.topics[topic] > 1 {
+		return nil
+	}
+	if err := c.reportTopics(context.Background()); err != nil {
+		c.topics[topic]--
+		delete(c.topics, topic)
+		return err
+	}
+	return nil
+}
+
+// removeTopic drops a reference to a topic, reporting the new topic set to the
+// node once it isn't needed anymore.
+func (c *Client) removeTopic(topic string) {
+	c.topicMu.Lock()
+	defer c.topicMu.Unlock()
+
+	if c.topics[topic]--; c.topics[topic] > 0 {
+		return
+	}
+	delete(c.topics, topic)
+	c.reportTopics(context.Background())
+}
+
+// hasTopics reports whether the connection is subscribed to any topic. The
+// caller must hold topicMu.
+func (c *Client) hasTopics() bool {
+	c.chanMu.Lock()
+	defer c.chanMu.Unlock()
+	return len(c.topics) > 0 || len(c.amopTopics) > 0
+}
+
+// reportTopics sends the set of subscribed topics, including those set with
+// UpdateTopics, to the node. The caller must hold topicMu.
+func (c *Client) reportTopics(ctx context.Context) error {
+	cc := c.channel()
+	if cc == nil {
+		return ErrNotificationsUnsupported
+	}
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	c.chanMu.Lock()
+	for topic := range c.amopTopics {
+		if c.topics[topic] == 0 {
+			topics = append(topics, topic)
+		}
+	}
+	c.chanMu.Unlock()
+	body, err := json.Marshal(topics)
+	if err != nil {
+		return err
+	}
+	return cc.notify(ctx, TYPE_TOPIC_REPORT, body)
+}
+
+// parseTopicMessage splits the body of a topic message, which is prefixed with
+// a single byte holding the length of the topic including that byte.
+func parseTopicMessage(body []byte) (topic string, data []byte, err error) {
+	if len(body) == 0 || int(body[0]) < 1 || int(body[0]) > len(body) {
+		return "", nil, errInvalidTopicMessage
+	}
+	return string(body[1:body[0]]), body[body[0]:], nil
+}
+
+// MsgSeqLength is the length of a message sequence number, which is sent hex
+// encoded in the frame header.
+const MsgSeqLength = channelSeqLength / 2
+
+// NewMsgSeq returns a new random message sequence number. It panics if the
+// system's secure random source fails, which no caller could recover from.
+func NewMsgSeq() [MsgSeqLength]byte {
+	var seq [MsgSeqLength]byte
+	if _, err := rand.Read(seq[:]); err != nil {
+		panic("rpc: reading random sequence number failed: " + err.Error())
+	}
+	return seq
+}
+
+// GenMsgSeq returns a new random message sequence number.
+//
+// Deprecated: use NewMsgSeq, the error is always nil.
+func GenMsgSeq() ([]byte, error) {
+	seq := NewMsgSeq()
+	return seq[:], nil
+}
+
+// GenZeroSeq returns the all zero message sequence number.
+func GenZeroSeq() ([]byte, error) {
+	return make([]byte, MsgSeqLength), nil
+}
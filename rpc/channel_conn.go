@@ -0,0 +1,623 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+const (
+	// channelHeartbeatInterval is how often idle connections are probed.
+	channelHeartbeatInterval = 10 * time.Second
+
+	// maxChannelPushQueue bounds the pushed messages waiting for listeners.
+	maxChannelPushQueue = 10000
+)
+
+// DefaultResponseTimeout bounds the wait for the reply to a channel message
+// whose context has no deadline, unless set otherwise with
+// Client.SetResponseTimeout.
+const DefaultResponseTimeout = time.Minute
+
+// channelLimits are the limits of the channel connections of a client.
+type channelLimits struct {
+	maxFrameSize    int
+	responseTimeout time.Duration
+}
+
+var defaultChannelLimits = channelLimits{
+	maxFrameSize:    DefaultMaxFrameSize,
+	responseTimeout: DefaultResponseTimeout,
+}
+
+// rpcSeq is a JSON-RPC frame awaiting its reply.
+type rpcSeq struct {
+	ids     []json.RawMessage // ids of the requests sent in the frame
+	expires time.Time         // when the seq is released without reply
+}
+
+// ChannelError is returned for replies whose result code reports a failure.
+type ChannelError struct {
+	Type   ChannelPack // type of the failed message
+	Result int32       // result code set by the node
+}
+
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("channel message 0x%x failed with result %d", int(e.Type), e.Result)
+}
+
+// connLostError reports the failure that broke a channel connection. It matches
+// ErrConnectionLost.
+type connLostError struct{ err error }
+
+func (e *connLostError) Error() string        { return "connection lost: " + e.err.Error() }
+func (e *connLostError) Unwrap() error        { return e.err }
+func (e *connLostError) Is(target error) bool { return target == ErrConnectionLost }
+
+// channelConn implements ServerCodec and channelCodec over a connection speaking
+// the channel protocol. JSON-RPC travels in TYPE_RPC frames, other frames either
+// answer a typed request or are pushed to the registered listeners.
+type channelConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	closer sync.Once
+	closed chan interface{}
+
+	writeMu     sync.Mutex // serializes frame writes
+	writeClosed bool       // whether the write side was shut down, see closeWrite
+
+	mu      sync.Mutex
+	pending map[[channelSeqLength]byte]chan *ChannelMessage // typed requests by seq
+	rpcSeqs map[[channelSeqLength]byte]rpcSeq               // JSON-RPC frames by seq
+	onPush  func(typ ChannelPack, seq [channelSeqLength]byte, body []byte)
+	metrics func() Metrics       // receiver of the heartbeat measurements
+	logger  func() log.Logger    // wire logger, returning nil if there is none
+	limits  func() channelLimits // limits of the connection, nil for the defaults
+
+	pushMu    sync.Mutex
+	pushQueue []*ChannelMessage
+	pushWake  chan struct{}
+}
+
+func newChannelConn(conn net.Conn) *channelConn {
+	c := &channelConn{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		closed:   make(chan interface{}),
+		pending:  make(map[[channelSeqLength]byte]chan *ChannelMessage),
+		rpcSeqs:  make(map[[channelSeqLength]byte]rpcSeq),
+		pushWake: make(chan struct{}, 1),
+	}
+	go c.deliverPushes()
+	go c.heartbeat()
+	return c
+}
+
+// ChannelTLSConfig loads the TLS configuration of a channel connection from the
+// node's CA certificate and the SDK certificate and key, all PEM encoded files.
+// The node's certificate is verified against the CA, but not its host name, as
+// node certificates don't name their hosts.
+func ChannelTLSConfig(caCert, sdkCert, sdkKey string) (*tls.Config, error) {
+	caPEM, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in %s", caCert)
+	}
+	cert, err := tls.LoadX509KeyPair(sdkCert, sdkKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		InsecureSkipVerify:    true, // verified below, without the host name
+		VerifyPeerCertificate: verifyChainOnly(roots),
+	}, nil
+}
+
+// verifyChainOnly returns a verification function checking that the peer
+// certificate chains up to one of the roots.
+func verifyChainOnly(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("node sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// DialChannel connects to the channel port of a node ("host:port" or
+// "channel://host:port", see ParseEndpoint), authenticating with the SDK
+// certificate and key issued by the chain's CA. See ChannelTLSConfig for the
+// certificate files.
+//
+// The handshake is negotiated by crypto/tls, which supports certificates on the
+// NIST curves and RSA, or by Secp256k1Handshaker if the SDK certificate is on
+// secp256k1, the default curve of the node and SDK certificates generated by
+// FISCO BCOS's build_chain.sh. If the SDK certificate is an SM2 certificate of a
+// guomi chain, a GM-TLS implementation has to be set by WithHandshaker, along
+// with the encryption certificate set by WithEnCert. A handshake set by
+// WithHandshaker is used whatever the curve of the certificate.
+func DialChannel(endpoint string, caCert, sdkCert, sdkKey string, opts ...ChannelOption) (*Client, error) {
+	return DialChannelContext(context.Background(), endpoint, caCert, sdkCert, sdkKey, opts...)
+}
+
+// DialChannelContext is like DialChannel. The context is used for the initial
+// connection establishment. It does not affect subsequent interactions with the
+// client.
+func DialChannelContext(ctx context.Context, endpoint string, caCert, sdkCert, sdkKey string, opts ...ChannelOption) (*Client, error) {
+	var o channelOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	certs, err := LoadChannelCerts(caCert, sdkCert, sdkKey, o.enCert, o.enKey)
+	if err != nil {
+		return nil, err
+	}
+	curve := certificateCurve(certs.Cert)
+	switch {
+	case curve.Equal(oidSM2) && o.handshaker == nil:
+		return nil, errGMTLSUnavailable
+	case curve.Equal(oidSM2) && (certs.EnCert == nil || certs.EnKey == nil):
+		return nil, errGMTLSNoEnCert
+	case o.handshaker != nil:
+		return DialChannelHandshake(ctx, endpoint, certs, o.handshaker)
+	case curve.Equal(oidSecp256k1):
+		return DialChannelHandshake(ctx, endpoint, certs, Secp256k1Handshaker{})
+	}
+	config, err := ChannelTLSConfig(caCert, sdkCert, sdkKey)
+	if err != nil {
+		return nil, err
+	}
+	return DialChannelTLS(ctx, endpoint, config)
+}
+
+// DialChannelTLS connects to the channel port of a node with the given TLS
+// configuration. The context is used for the initial connection establishment.
+// It does not affect subsequent interactions with the client.
+//
+// If the connection breaks, requests in flight fail with ErrConnectionLost and
+// the client redials in the background, see Client.OnReconnect.
+func DialChannelTLS(ctx context.Context, endpoint string, config *tls.Config) (*Client, error) {
+	addr, err := channelAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		conn, err := tls.DialWithDialer(contextDialer(ctx), "tcp", addr, config)
+		if err != nil {
+			return nil, err
+		}
+		return newChannelConn(conn), nil
+	})
+}
+
+func (c *channelConn) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// Read returns the next JSON-RPC message sent by the node. Replies to typed
+// requests and pushed messages are dispatched on the way, frames of unknown
+// types are skipped. A frame beyond the size limit or with an invalid seq ends
+// the connection, the stream can't be resynchronized.
+func (c *channelConn) Read() ([]*jsonrpcMessage, bool, error) {
+	for {
+		f := new(ChannelMessage)
+		if err := f.decodeFrom(c.reader, c.getLimits().maxFrameSize); err != nil {
+			c.Close()
+			return nil, false, &connLostError{err}
+		}
+		// The stream has no frame delimiters to resynchronize on. A seq other
+		// than hex digits means it is out of sync, or the peer is broken.
+		if !validChannelSeq(f.Seq) {
+			c.logFrame("Channel frame invalid", f, errChannelSeqInvalid)
+			c.Close()
+			return nil, false, &connLostError{fmt.Errorf("%v: type %#x, seq %q", errChannelSeqInvalid, int(f.Type), f.Seq[:])}
+		}
+		c.logFrame("Channel frame received", f, nil)
+		if f.Type == TYPE_RPC {
+			if msgs, batch, ok := c.rpcReply(f); ok {
+				return msgs, batch, nil
+			}
+			continue
+		}
+		c.mu.Lock()
+		reply, ok := c.pending[f.Seq]
+		delete(c.pending, f.Seq)
+		c.mu.Unlock()
+
+		switch {
+		case ok:
+			reply <- f
+		case f.Type == TYPE_HEATBEAT:
+		case !knownChannelPack(f.Type):
+			// Framing is intact, only the type is unknown; skip the frame.
+			log.Debug("Dropping channel frame of unknown type", "conn", c.RemoteAddr(), "type", fmt.Sprintf("%#x", int(f.Type)), "size", len(f.Payload))
+		default:
+			c.push(f)
+		}
+	}
+}
+
+// rpcReply turns a TYPE_RPC frame into JSON-RPC messages. Frames whose result
+// reports a failure carry no response, one is made up for each request sent in
+// the frame so their callers don't wait forever.
+func (c *channelConn) rpcReply(f *ChannelMessage) ([]*jsonrpcMessage, bool, bool) {
+	c.mu.Lock()
+	ids := c.rpcSeqs[f.Seq].ids
+	delete(c.rpcSeqs, f.Seq)
+	c.mu.Unlock()
+
+	if f.Result != 0 {
+		err := &ChannelError{Type: f.Type, Result: f.Result}
+		msgs := make([]*jsonrpcMessage, len(ids))
+		for i, id := range ids {
+			msgs[i] = &jsonrpcMessage{Version: vsn, ID: id, Error: &jsonError{Code: defaultErrorCode, Message: err.Error()}}
+		}
+		return msgs, len(msgs) > 1, len(msgs) > 0
+	}
+	if !json.Valid(f.Payload) {
+		log.Debug("Dropping invalid channel RPC reply", "conn", c.RemoteAddr(), "len", len(f.Payload))
+		return nil, false, false
+	}
+	msgs, batch := parseMessage(f.Payload)
+	return msgs, batch, true
+}
+
+// Write sends JSON-RPC messages to the node in a single frame.
+func (c *channelConn) Write(ctx context.Context, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	seq := newChannelSeq()
+	var ids []json.RawMessage
+	switch msg := v.(type) {
+	case *jsonrpcMessage:
+		if msg.ID != nil {
+			ids = append(ids, msg.ID)
+		}
+	case []*jsonrpcMessage:
+		for _, m := range msg {
+			if m.ID != nil {
+				ids = append(ids, m.ID)
+			}
+		}
+	}
+	if len(ids) > 0 {
+		expires, ok := ctx.Deadline()
+		if !ok {
+			expires = time.Now().Add(c.getLimits().responseTimeout)
+		}
+		c.mu.Lock()
+		c.rpcSeqs[seq] = rpcSeq{ids: ids, expires: expires}
+		c.mu.Unlock()
+	}
+	if w, ok := ctx.Value(pushWaiterKey{}).(*pushWaiter); ok {
+		w.wait = c.awaitPush(seq)
+	}
+	if header := headerFromContext(ctx); len(header) > 0 {
+		log.Debug("Dropping request headers, channel frames can't carry them", "conn", c.RemoteAddr(), "headers", len(header))
+	}
+	if err := c.writeFrame(ctx, &ChannelMessage{Type: TYPE_RPC, Seq: seq, Payload: data}); err != nil {
+		c.mu.Lock()
+		delete(c.rpcSeqs, seq)
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// awaitPush registers for the message pushed with the given seq and returns the
+// function waiting for it. The registration is dropped when the wait ends.
+func (c *channelConn) awaitPush(seq [channelSeqLength]byte) func(ctx context.Context) ([]byte, error) {
+	reply := make(chan *ChannelMessage, 1)
+	c.mu.Lock()
+	c.pending[seq] = reply
+	c.mu.Unlock()
+
+	return func(ctx context.Context) ([]byte, error) {
+		defer func() {
+			c.mu.Lock()
+			delete(c.pending, seq)
+			c.mu.Unlock()
+		}()
+		select {
+		case f := <-reply:
+			if f.Result != 0 {
+				return f.Payload, &ChannelError{Type: f.Type, Result: f.Result}
+			}
+			return f.Payload, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.closed:
+			return nil, ErrConnectionLost
+		}
+	}
+}
+
+func (c *channelConn) writeFrame(ctx context.Context, f *ChannelMessage) error {
+	buf, err := f.encode(c.getLimits().maxFrameSize)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return ErrConnectionLost
+	default:
+	}
+	if c.writeClosed {
+		return ErrConnectionLost
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	c.conn.SetWriteDeadline(deadline)
+	if _, err := c.conn.Write(buf); err != nil {
+		// A partial frame can't be taken back, the connection is unusable.
+		c.Close()
+		c.logFrame("Channel frame write failed", f, err)
+		return &connLostError{err}
+	}
+	c.logFrame("Channel frame sent", f, nil)
+	return nil
+}
+
+func (c *channelConn) request(ctx context.Context, typ ChannelPack, body []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.getLimits().responseTimeout)
+		defer cancel()
+	}
+	seq := newChannelSeq()
+	reply := make(chan *ChannelMessage, 1)
+	c.mu.Lock()
+	c.pending[seq] = reply
+	c.mu.Unlock()
+
+	abort := func() {
+		c.mu.Lock()
+		delete(c.pending, seq)
+		c.mu.Unlock()
+	}
+	if err := c.writeFrame(ctx, &ChannelMessage{Type: typ, Seq: seq, Payload: body}); err != nil {
+		abort()
+		return nil, err
+	}
+	select {
+	case f := <-reply:
+		if f.Result != 0 {
+			return f.Payload, &ChannelError{Type: f.Type, Result: f.Result}
+		}
+		return f.Payload, nil
+	case <-ctx.Done():
+		abort()
+		return nil, ctx.Err()
+	case <-c.closed:
+		abort()
+		return nil, errDead
+	}
+}
+
+func (c *channelConn) notify(ctx context.Context, typ ChannelPack, body []byte) error {
+	return c.writeFrame(ctx, &ChannelMessage{Type: typ, Seq: newChannelSeq(), Payload: body})
+}
+
+func (c *channelConn) reply(ctx context.Context, typ ChannelPack, seq [channelSeqLength]byte, result int32, body []byte) error {
+	return c.writeFrame(ctx, &ChannelMessage{Type: typ, Seq: seq, Result: result, Payload: body})
+}
+
+// setPushHandler sets the function pushed messages are passed to. It is called
+// in order on a goroutine of its own, not on the read loop, so it may block
+// briefly and issue requests on the connection.
+func (c *channelConn) setMetrics(fn func() Metrics) {
+	c.mu.Lock()
+	c.metrics = fn
+	c.mu.Unlock()
+}
+
+func (c *channelConn) setLogger(fn func() log.Logger) {
+	c.mu.Lock()
+	c.logger = fn
+	c.mu.Unlock()
+}
+
+func (c *channelConn) setLimits(fn func() channelLimits) {
+	c.mu.Lock()
+	c.limits = fn
+	c.mu.Unlock()
+}
+
+// getLimits returns the limits of the connection.
+func (c *channelConn) getLimits() channelLimits {
+	c.mu.Lock()
+	limits := c.limits
+	c.mu.Unlock()
+	if limits == nil {
+		return defaultChannelLimits
+	}
+	return limits()
+}
+
+// expireRPCSeqs releases the seqs of the JSON-RPC frames whose reply is overdue.
+// Their callers have given up already, the rpc client times out on its own.
+func (c *channelConn) expireRPCSeqs(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seq, s := range c.rpcSeqs {
+		if now.After(s.expires) {
+			delete(c.rpcSeqs, seq)
+		}
+	}
+}
+
+// logFrame writes a frame to the wire log, if there is one.
+func (c *channelConn) logFrame(msg string, f *ChannelMessage, err error) {
+	c.mu.Lock()
+	logger := c.logger
+	c.mu.Unlock()
+	if logger == nil {
+		return
+	}
+	if l := logger(); l != nil {
+		l.Debug(msg, "conn", c.RemoteAddr(), "type", fmt.Sprintf("%#x", int(f.Type)), "seq", string(f.Seq[:]), "result", f.Result, "size", len(f.Payload), "err", err)
+	}
+}
+
+func (c *channelConn) setPushHandler(fn func(typ ChannelPack, seq [channelSeqLength]byte, body []byte)) {
+	c.mu.Lock()
+	c.onPush = fn
+	c.mu.Unlock()
+}
+
+// push queues a pushed message for the listeners.
+func (c *channelConn) push(f *ChannelMessage) {
+	c.pushMu.Lock()
+	if len(c.pushQueue) >= maxChannelPushQueue {
+		c.pushMu.Unlock()
+		log.Warn("Dropping channel push, listeners are too slow", "type", f.Type)
+		return
+	}
+	c.pushQueue = append(c.pushQueue, f)
+	c.pushMu.Unlock()
+
+	select {
+	case c.pushWake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *channelConn) deliverPushes() {
+	for {
+		select {
+		case <-c.pushWake:
+		case <-c.closed:
+			return
+		}
+		for {
+			c.pushMu.Lock()
+			if len(c.pushQueue) == 0 {
+				c.pushMu.Unlock()
+				break
+			}
+			f := c.pushQueue[0]
+			c.pushQueue[0] = nil
+			c.pushQueue = c.pushQueue[1:]
+			c.pushMu.Unlock()
+
+			c.mu.Lock()
+			onPush := c.onPush
+			c.mu.Unlock()
+			if onPush != nil {
+				onPush(f.Type, f.Seq, f.Payload)
+			}
+		}
+	}
+}
+
+// heartbeat keeps the connection alive, the node drops idle clients. It also
+// releases the seqs of overdue JSON-RPC replies.
+func (c *channelConn) heartbeat() {
+	ticker := time.NewTicker(channelHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.expireRPCSeqs(time.Now())
+			start := time.Now()
+			err := c.notify(context.Background(), TYPE_HEATBEAT, []byte("0"))
+			c.mu.Lock()
+			metrics := c.metrics
+			c.mu.Unlock()
+			if metrics != nil {
+				metrics().ObserveRequest(ChannelMethod(TYPE_HEATBEAT), 0, time.Since(start), err)
+			}
+			if err != nil {
+				log.Debug("Channel heartbeat failed", "conn", c.RemoteAddr(), "err", err)
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// closeWrite shuts down the write side of the connection, sending the TLS
+// close_notify alert and FIN, while replies can still be read. Writes fail
+// afterwards. It reports false if the connection can't be half-closed.
+func (c *channelConn) closeWrite() bool {
+	cw, ok := c.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return false
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	c.writeClosed = true
+	return cw.CloseWrite() == nil
+}
+
+func (c *channelConn) Close() {
+	c.closer.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+func (c *channelConn) Closed() <-chan interface{} {
+	return c.closed
+}
@@ -0,0 +1,697 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// testCA issues the certificates of a test chain.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "chain"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+// issue returns a certificate of the CA for name, without host names like the
+// certificates of nodes, and its PEM encoded files.
+func (ca *testCA) issue(t *testing.T, name string) (cert tls.Certificate, certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPEM, keyPEM
+}
+
+// sdkFiles writes the CA certificate and an SDK certificate and key of ca to
+// dir, returning their paths.
+func (ca *testCA) sdkFiles(t *testing.T, dir string) (caFile, certFile, keyFile string) {
+	t.Helper()
+	_, certPEM, keyPEM := ca.issue(t, "sdk")
+	caFile = filepath.Join(dir, "ca.crt")
+	certFile = filepath.Join(dir, "sdk.crt")
+	keyFile = filepath.Join(dir, "sdk.key")
+	for file, data := range map[string][]byte{
+		caFile:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}),
+		certFile: certPEM,
+		keyFile:  keyPEM,
+	} {
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return caFile, certFile, keyFile
+}
+
+// fakeChannelNode is the channel port of a node, requiring client certificates
+// of its CA. Every connection is served by handle.
+type fakeChannelNode struct {
+	listener net.Listener
+	handle   func(conn *tls.Conn)
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newFakeChannelNode(t *testing.T, ca *testCA, handle func(conn *tls.Conn)) *fakeChannelNode {
+	t.Helper()
+	cert, _, _ := ca.issue(t, "node")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeChannelNode{listener: listener, handle: handle}
+	n.wg.Add(1)
+	go n.serve()
+	return n
+}
+
+func (n *fakeChannelNode) addr() string { return n.listener.Addr().String() }
+
+func (n *fakeChannelNode) serve() {
+	defer n.wg.Done()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		n.conns = append(n.conns, conn)
+		n.mu.Unlock()
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			defer conn.Close()
+			if err := conn.(*tls.Conn).Handshake(); err != nil {
+				return
+			}
+			n.handle(conn.(*tls.Conn))
+		}()
+	}
+}
+
+func (n *fakeChannelNode) close() {
+	n.listener.Close()
+	n.mu.Lock()
+	for _, conn := range n.conns {
+		conn.Close()
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// readRPC reads frames until a JSON-RPC request, skipping heartbeats.
+func readRPC(conn net.Conn) (*ChannelMessage, *jsonrpcMessage, error) {
+	for {
+		f := new(ChannelMessage)
+		if err := f.DecodeFrom(conn); err != nil {
+			return nil, nil, err
+		}
+		if f.Type != TYPE_RPC {
+			continue
+		}
+		msg := new(jsonrpcMessage)
+		if err := json.Unmarshal(f.Payload, msg); err != nil {
+			return nil, nil, err
+		}
+		return f, msg, nil
+	}
+}
+
+// writeRPC replies to the request sent with seq.
+func writeRPC(conn net.Conn, seq [channelSeqLength]byte, id json.RawMessage, result interface{}) error {
+	res, _ := json.Marshal(result)
+	payload, _ := json.Marshal(&jsonrpcMessage{Version: vsn, ID: id, Result: res})
+	buf, err := (&ChannelMessage{Type: TYPE_RPC, Seq: seq, Payload: payload}).Encode()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(buf)
+	return err
+}
+
+// answer replies to every JSON-RPC request with result.
+func answer(result interface{}) func(conn *tls.Conn) {
+	return func(conn *tls.Conn) {
+		for {
+			f, msg, err := readRPC(conn)
+			if err != nil {
+				return
+			}
+			if writeRPC(conn, f.Seq, msg.ID, result) != nil {
+				return
+			}
+		}
+	}
+}
+
+func dialFakeNode(t *testing.T, ca *testCA, node *fakeChannelNode) *Client {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "channel-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile, certFile, keyFile := ca.sdkFiles(t, dir)
+	client, err := DialChannel(node.addr(), caFile, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("DialChannel error: %v", err)
+	}
+	return client
+}
+
+func TestDialChannel(t *testing.T) {
+	ca := newTestCA(t)
+	frames := make(chan *ChannelMessage, 1)
+	peers := make(chan string, 1)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		peers <- conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		f, msg, err := readRPC(conn)
+		if err != nil {
+			return
+		}
+		frames <- f
+		writeRPC(conn, f.Seq, msg.ID, "0x10")
+		answer(nil)(conn)
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if result != "0x10" {
+		t.Errorf("got result %q, want 0x10", result)
+	}
+	if peer := <-peers; peer != "sdk" {
+		t.Errorf("node saw client certificate of %q, want the SDK's", peer)
+	}
+	f := <-frames
+	if int(f.Length) != channelHeaderLength+len(f.Payload) || f.Result != 0 || !validChannelSeq(f.Seq) {
+		t.Errorf("malformed request frame: length %d, result %d, seq %q", f.Length, f.Result, f.Seq[:])
+	}
+	if !strings.Contains(string(f.Payload), `"method":"getBlockNumber"`) {
+		t.Errorf("request frame carries %s", f.Payload)
+	}
+}
+
+func TestDialChannelUntrustedNode(t *testing.T) {
+	node := newFakeChannelNode(t, newTestCA(t), answer("0x10"))
+	defer node.close()
+
+	// The SDK trusts another chain's CA.
+	if client, err := func() (*Client, error) {
+		dir, err := ioutil.TempDir("", "channel-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		caFile, certFile, keyFile := newTestCA(t).sdkFiles(t, dir)
+		return DialChannel(node.addr(), caFile, certFile, keyFile)
+	}(); err == nil {
+		client.Close()
+		t.Fatal("connected to a node of an untrusted CA")
+	}
+}
+
+// TestChannelCallCanceled cancels a request mid-flight: its late reply must be
+// dropped and the connection keep serving other requests.
+func TestChannelCallCanceled(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		first, firstMsg, err := readRPC(conn)
+		if err != nil {
+			return
+		}
+		second, secondMsg, err := readRPC(conn)
+		if err != nil {
+			return
+		}
+		writeRPC(conn, first.Seq, firstMsg.ID, "late")
+		writeRPC(conn, second.Seq, secondMsg.ID, "0x10")
+		answer(nil)(conn)
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var result string
+	if err := client.CallContext(ctx, &result, "getBlockNumber", 1); err != context.DeadlineExceeded {
+		t.Fatalf("canceled call: got error %v, want context.DeadlineExceeded", err)
+	}
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("call after cancellation: %v", err)
+	}
+	if result != "0x10" {
+		t.Errorf("got result %q, want 0x10", result)
+	}
+}
+
+// TestChannelOversizedFrameRead checks that a frame beyond the size limit ends
+// the connection, failing the requests in flight, before it is read.
+func TestChannelOversizedFrameRead(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		f, msg, err := readRPC(conn)
+		if err != nil {
+			return
+		}
+		writeRPC(conn, f.Seq, msg.ID, "0x10")
+		if f, _, err = readRPC(conn); err != nil {
+			return
+		}
+		// Announce a reply of 8KB but only send its header.
+		header := make([]byte, channelHeaderLength)
+		binary.BigEndian.PutUint32(header[0:4], 8192)
+		binary.BigEndian.PutUint16(header[4:6], uint16(TYPE_RPC))
+		copy(header[6:], f.Seq[:])
+		conn.Write(header)
+		readRPC(conn)
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+	client.SetMaxFrameSize(4096)
+
+	// The limit applies from the frame read after the one awaited when it was
+	// set, the reply to the first call.
+	var result string
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := client.CallContext(ctx, &result, "getBlockNumber", 1)
+	if _, ok := err.(*connLostError); !ok {
+		t.Fatalf("got error %v, want ErrConnectionLost", err)
+	}
+	if !strings.Contains(err.Error(), errChannelFrameTooLarge.Error()) {
+		t.Errorf("error %q doesn't name the oversized frame", err)
+	}
+}
+
+// TestChannelOversizedFrameWrite checks that a request beyond the size limit
+// fails without harming the connection.
+func TestChannelOversizedFrameWrite(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, answer("0x10"))
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+	client.SetMaxFrameSize(1024)
+
+	var result string
+	err := client.Call(&result, "sendRawTransaction", 1, strings.Repeat("ab", 1024))
+	if err == nil || !strings.Contains(err.Error(), errChannelFrameTooLarge.Error()) {
+		t.Fatalf("got error %v, want the frame to be too large", err)
+	}
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("call after the oversized request: %v", err)
+	}
+	if result != "0x10" {
+		t.Errorf("got result %q, want 0x10", result)
+	}
+}
+
+// TestChannelResponseTimeout checks that typed requests without deadline give
+// up after the response timeout, and their replies are matched by seq.
+func TestChannelResponseTimeout(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		for {
+			f := new(ChannelMessage)
+			if err := f.DecodeFrom(conn); err != nil {
+				return
+			}
+			// Only the second request is answered.
+			if string(f.Payload) != "answer me" {
+				continue
+			}
+			buf, _ := (&ChannelMessage{Type: TYPE_AMOP_RESP, Seq: f.Seq, Payload: []byte("answer")}).Encode()
+			conn.Write(buf)
+		}
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+	client.SetResponseTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := client.ChannelRequest(context.Background(), TYPE_AMOP_REQ, []byte("ignore me")); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request gave up after %v", elapsed)
+	}
+	reply, err := client.ChannelRequest(context.Background(), TYPE_AMOP_REQ, []byte("answer me"))
+	if err != nil {
+		t.Fatalf("ChannelRequest error: %v", err)
+	}
+	if string(reply) != "answer" {
+		t.Errorf("got reply %q, want %q", reply, "answer")
+	}
+}
+
+// TestChannelReconnect breaks the connection in the middle of a reply and
+// refuses the next connection, checking that the request in flight fails with
+// ErrConnectionLost and that polling like bind.WaitMined reaches the node again.
+func TestChannelReconnect(t *testing.T) {
+	ca := newTestCA(t)
+	var (
+		mu    sync.Mutex
+		conns int
+	)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		mu.Lock()
+		conns++
+		n := conns
+		mu.Unlock()
+		switch n {
+		case 1:
+			f, _, err := readRPC(conn)
+			if err != nil {
+				return
+			}
+			// Send half of the reply header, then go away.
+			header := make([]byte, channelHeaderLength)
+			binary.BigEndian.PutUint32(header[0:4], channelHeaderLength+4)
+			binary.BigEndian.PutUint16(header[4:6], uint16(TYPE_RPC))
+			copy(header[6:], f.Seq[:])
+			conn.Write(header[:channelHeaderLength/2])
+		case 2:
+			// The node is still restarting.
+		default:
+			answer("0x10")(conn)
+		}
+	})
+	defer node.close()
+	client := dialFakeNode(t, ca, node)
+	defer client.Close()
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func() {
+		select {
+		case reconnected <- struct{}{}:
+		default:
+		}
+	})
+
+	var result string
+	err := client.Call(&result, "getBlockNumber", 1)
+	if _, ok := err.(*connLostError); !ok {
+		t.Fatalf("got error %v, want ErrConnectionLost", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err = client.Call(&result, "getBlockNumber", 1); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no reply after reconnecting, last error: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if result != "0x10" {
+		t.Errorf("got result %q, want 0x10", result)
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Error("OnReconnect hook didn't run")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns < 3 {
+		t.Errorf("node saw %d connections, want at least 3", conns)
+	}
+}
+
+// checkChannelRead feeds stream to the read loop of a connection with a frame
+// limit of 4096 bytes. Whatever the stream, the loop must end with
+// ErrConnectionLost, at the latest when the stream does, and not panic.
+func checkChannelRead(stream []byte) error {
+	client, server := net.Pipe()
+	go func() {
+		go io.Copy(ioutil.Discard, server)
+		server.Write(stream)
+		server.Close()
+	}()
+	c := newChannelConn(client)
+	defer c.Close()
+	c.setLimits(func() channelLimits { return channelLimits{maxFrameSize: 4096, responseTimeout: time.Second} })
+	c.setPushHandler(func(ChannelPack, [channelSeqLength]byte, []byte) {})
+	// Every message read takes a frame of at least the header.
+	for i := 0; i <= len(stream)/channelHeaderLength; i++ {
+		if _, _, err := c.Read(); err != nil {
+			if _, ok := err.(*connLostError); !ok {
+				return fmt.Errorf("got error %v, want ErrConnectionLost", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("read loop returned more messages than the %d byte stream holds", len(stream))
+}
+
+func TestChannelReadRandom(t *testing.T) {
+	config := &quick.Config{MaxCount: 500}
+	if err := quick.Check(func(data []byte) bool {
+		return checkChannelRead(data) == nil
+	}, config); err != nil {
+		t.Error(err)
+	}
+	// Streams of well-formed frames, of known and unknown types, with invalid
+	// seqs, replies and pushes, cut off anywhere.
+	if err := quick.Check(func(types []uint8, payload []byte, badSeq uint8, cut uint16) bool {
+		var stream []byte
+		for i, typ := range types {
+			msg := &ChannelMessage{Type: ChannelPack(typ), Seq: testSeq(fmt.Sprintf("%x", i)), Payload: payload}
+			switch {
+			case typ%5 == 0:
+				msg.Type = TYPE_RPC
+				msg.Payload = []byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)
+			case typ%5 == 1:
+				msg.Type = TYPE_TX_BLOCKNUM
+			}
+			if len(msg.Payload) > 1024 {
+				msg.Payload = msg.Payload[:1024]
+			}
+			enc, err := msg.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == int(badSeq) {
+				enc[6] = 'x'
+			}
+			stream = append(stream, enc...)
+		}
+		if len(stream) > 0 {
+			stream = stream[:int(cut)%(len(stream)+1)]
+		}
+		if err := checkChannelRead(stream); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestChannelSoak sends 10k concurrent requests over one connection, some of
+// which the node never answers. Afterwards no seq may be left pending and the
+// goroutines of the client must be gone once it is closed.
+func TestChannelSoak(t *testing.T) {
+	const (
+		requests   = 10000
+		unanswered = 10 // every tenth request is ignored by the node
+	)
+	goroutines := runtime.NumGoroutine()
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		for {
+			f := new(ChannelMessage)
+			if err := f.DecodeFrom(conn); err != nil {
+				return
+			}
+			reply := &ChannelMessage{Type: f.Type, Seq: f.Seq, Payload: f.Payload}
+			switch f.Type {
+			case TYPE_RPC:
+				msg := new(jsonrpcMessage)
+				if json.Unmarshal(f.Payload, msg) != nil {
+					return
+				}
+				var params []int
+				json.Unmarshal(msg.Params, &params)
+				if params[0]%unanswered == 0 {
+					continue
+				}
+				reply.Payload, _ = json.Marshal(&jsonrpcMessage{Version: vsn, ID: msg.ID, Result: msg.Params})
+			case TYPE_AMOP_REQ:
+				if n, _ := strconv.Atoi(string(f.Payload)); n%unanswered == 0 {
+					continue
+				}
+				reply.Type = TYPE_AMOP_RESP
+			default:
+				continue
+			}
+			buf, _ := reply.Encode()
+			if _, err := conn.Write(buf); err != nil {
+				return
+			}
+		}
+	})
+	client := dialFakeNode(t, ca, node)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		timeouts int
+	)
+	for i := 1; i <= requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			timeout := 30 * time.Second
+			if i%unanswered == 0 {
+				timeout = 200 * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			var err error
+			if i%4 < 2 {
+				var result []int
+				if err = client.CallContext(ctx, &result, "echo", i); err == nil && (len(result) != 1 || result[0] != i) {
+					t.Errorf("request %d: got result %v", i, result)
+				}
+			} else {
+				var reply []byte
+				if reply, err = client.ChannelRequest(ctx, TYPE_AMOP_REQ, []byte(strconv.Itoa(i))); err == nil && string(reply) != strconv.Itoa(i) {
+					t.Errorf("request %d: got reply %q", i, reply)
+				}
+			}
+			switch {
+			case i%unanswered == 0 && err == context.DeadlineExceeded:
+				mu.Lock()
+				timeouts++
+				mu.Unlock()
+			case err != nil:
+				t.Errorf("request %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if timeouts != requests/unanswered {
+		t.Errorf("%d unanswered requests timed out, want %d", timeouts, requests/unanswered)
+	}
+
+	// The seqs of unanswered JSON-RPC frames are released by the heartbeat once
+	// overdue, typed requests drop theirs when they give up.
+	cc := client.channel().(*channelConn)
+	cc.expireRPCSeqs(time.Now())
+	cc.mu.Lock()
+	if len(cc.pending) != 0 || len(cc.rpcSeqs) != 0 {
+		t.Errorf("%d typed and %d JSON-RPC seqs left pending", len(cc.pending), len(cc.rpcSeqs))
+	}
+	cc.mu.Unlock()
+
+	client.Close()
+	node.close()
+	for deadline := time.Now().Add(10 * time.Second); runtime.NumGoroutine() > goroutines; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, %d before the test", runtime.NumGoroutine(), goroutines)
+		}
+	}
+}
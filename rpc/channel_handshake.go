@@ -0,0 +1,175 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+)
+
+var (
+	// oidSM2 names the SM2 curve in the public key of guomi certificates.
+	oidSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+	// oidSecp256k1 names secp256k1, the curve of the node and SDK certificates
+	// of non-guomi chains.
+	oidSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+
+	errGMTLSUnavailable = errors.New("SM2 sdk certificate needs a GM-TLS implementation, see WithHandshaker")
+	errGMTLSNoEnCert    = errors.New("GM-TLS needs the sdk encryption certificate and key, see WithEnCert")
+)
+
+// ChannelCerts holds the PEM encoded certificates and keys authenticating a
+// channel connection. Guomi chains issue the SDK a pair of certificates: one for
+// signing, set as Cert and Key, and one for key exchange, set as EnCert and
+// EnKey. Other chains only issue the first.
+type ChannelCerts struct {
+	CACert []byte // certificates of the chain's CA (ca.crt, gmca.crt)
+	Cert   []byte // sdk certificate (sdk.crt), the signing certificate on guomi chains (gmsdk.crt)
+	Key    []byte // sdk key (sdk.key, gmsdk.key)
+	EnCert []byte // sdk encryption certificate (gmensdk.crt), guomi chains only
+	EnKey  []byte // sdk encryption key (gmensdk.key), guomi chains only
+}
+
+// ChannelHandshaker secures the connections to the channel port of a node with
+// a TLS implementation other than crypto/tls, which negotiates neither
+// certificates on secp256k1 nor GM-TLS (SM2 certificates, SM4 cipher suites).
+// Secp256k1Handshaker implements it for the former. For guomi chains, wrap a
+// GM-TLS stack of the user's choice, like the gmtls package of
+// github.com/tjfoc/gmsm.
+type ChannelHandshaker interface {
+	// ClientHandshake runs the client side of the handshake on conn, verifying
+	// the node's certificate against the CA of certs. It returns the secured
+	// connection, the handshake is aborted when ctx is done.
+	ClientHandshake(ctx context.Context, conn net.Conn, certs *ChannelCerts) (net.Conn, error)
+}
+
+// ChannelOption configures DialChannel.
+type ChannelOption func(*channelOptions)
+
+type channelOptions struct {
+	handshaker    ChannelHandshaker
+	enCert, enKey string
+}
+
+// WithHandshaker sets the handshake DialChannel secures its connections with,
+// whatever the curve of the sdk certificate. Without it, DialChannel uses
+// crypto/tls, or Secp256k1Handshaker for certificates on secp256k1, and SM2
+// certificates can't be used.
+func WithHandshaker(h ChannelHandshaker) ChannelOption {
+	return func(o *channelOptions) { o.handshaker = h }
+}
+
+// WithEnCert sets the PEM files of the sdk encryption certificate and key, which
+// GM-TLS needs in addition to the signing certificate.
+func WithEnCert(enCert, enKey string) ChannelOption {
+	return func(o *channelOptions) { o.enCert, o.enKey = enCert, enKey }
+}
+
+// LoadChannelCerts reads the PEM files of a channel connection. The encryption
+// certificate and key are optional, they are only issued on guomi chains.
+func LoadChannelCerts(caCert, sdkCert, sdkKey, enCert, enKey string) (*ChannelCerts, error) {
+	certs := new(ChannelCerts)
+	for _, file := range []struct {
+		path     string
+		data     *[]byte
+		optional bool
+	}{
+		{caCert, &certs.CACert, false},
+		{sdkCert, &certs.Cert, false},
+		{sdkKey, &certs.Key, false},
+		{enCert, &certs.EnCert, true},
+		{enKey, &certs.EnKey, true},
+	} {
+		if file.path == "" && file.optional {
+			continue
+		}
+		data, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return nil, err
+		}
+		*file.data = data
+	}
+	return certs, nil
+}
+
+// DialChannelHandshake connects to the channel port of a node, securing the
+// connection with the given handshake. The context is used for the initial
+// connection establishment. It does not affect subsequent interactions with the
+// client.
+func DialChannelHandshake(ctx context.Context, endpoint string, certs *ChannelCerts, h ChannelHandshaker) (*Client, error) {
+	addr, err := channelAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		raw, err := contextDialer(ctx).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := h.ClientHandshake(ctx, raw, certs)
+		if err != nil {
+			raw.Close()
+			return nil, fmt.Errorf("channel handshake: %v", err)
+		}
+		return newChannelConn(conn), nil
+	})
+}
+
+// certificateCurve returns the curve of the public key of the first certificate
+// of a PEM file, nil if it has none or isn't an elliptic curve key.
+func certificateCurve(certPEM []byte) asn1.ObjectIdentifier {
+	for rest := certPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		// crypto/x509 rejects SM2 and secp256k1 keys, pick out the public key
+		// algorithm.
+		var cert struct {
+			TBS struct {
+				Version   int `asn1:"optional,explicit,default:0,tag:0"`
+				Serial    *big.Int
+				SigAlg    pkix.AlgorithmIdentifier
+				Issuer    asn1.RawValue
+				Validity  asn1.RawValue
+				Subject   asn1.RawValue
+				PublicKey struct {
+					Algorithm pkix.AlgorithmIdentifier
+					Key       asn1.BitString
+				}
+			}
+		}
+		if _, err := asn1.Unmarshal(block.Bytes, &cert); err != nil {
+			return nil
+		}
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(cert.TBS.PublicKey.Algorithm.Parameters.FullBytes, &curve); err != nil {
+			return nil
+		}
+		return curve
+	}
+}
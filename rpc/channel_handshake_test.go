@@ -0,0 +1,227 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gmTestdata returns the path of a certificate file of testdata/channel/gm,
+// generated like build_chain.sh -g does, see gen.sh there.
+func gmTestdata(name string) string {
+	return filepath.Join("testdata", "channel", "gm", name)
+}
+
+// standInHandshaker stands in for a GM-TLS implementation. It records the
+// certificates it is given and secures the connection with crypto/tls.
+type standInHandshaker struct {
+	config *tls.Config
+	err    error // returned instead of handshaking if set
+
+	mu    sync.Mutex
+	certs []*ChannelCerts
+}
+
+func (h *standInHandshaker) ClientHandshake(ctx context.Context, conn net.Conn, certs *ChannelCerts) (net.Conn, error) {
+	h.mu.Lock()
+	h.certs = append(h.certs, certs)
+	h.mu.Unlock()
+	if h.err != nil {
+		return nil, h.err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	tconn := tls.Client(conn, h.config)
+	if err := tconn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tconn, nil
+}
+
+func (h *standInHandshaker) handshakes() []*ChannelCerts {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*ChannelCerts(nil), h.certs...)
+}
+
+// newStandInHandshaker returns a handshaker connecting to the nodes of ca.
+func newStandInHandshaker(t *testing.T, ca *testCA) *standInHandshaker {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "channel-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config, err := ChannelTLSConfig(ca.sdkFiles(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &standInHandshaker{config: config}
+}
+
+// TestDialChannelSM2 dials with the certificates of a guomi chain, checking that
+// the handshake set with WithHandshaker gets both certificate pairs and secures
+// the connection.
+func TestDialChannelSM2(t *testing.T) {
+	ca := newTestCA(t)
+	peers := make(chan string, 1)
+	node := newFakeChannelNode(t, ca, func(conn *tls.Conn) {
+		peers <- conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		answer("0x10")(conn)
+	})
+	defer node.close()
+	h := newStandInHandshaker(t, ca)
+
+	caFile, certFile, keyFile := gmTestdata("gmca.crt"), gmTestdata("gmsdk.crt"), gmTestdata("gmsdk.key")
+	if _, err := DialChannel(node.addr(), caFile, certFile, keyFile); err != errGMTLSUnavailable {
+		t.Errorf("dialing without handshaker: got error %v, want %v", err, errGMTLSUnavailable)
+	}
+	if _, err := DialChannel(node.addr(), caFile, certFile, keyFile, WithHandshaker(h)); err != errGMTLSNoEnCert {
+		t.Errorf("dialing without encryption certificate: got error %v, want %v", err, errGMTLSNoEnCert)
+	}
+	if len(h.handshakes()) != 0 {
+		t.Fatal("handshake ran with incomplete options")
+	}
+
+	client, err := DialChannel(node.addr(), caFile, certFile, keyFile,
+		WithHandshaker(h), WithEnCert(gmTestdata("gmensdk.crt"), gmTestdata("gmensdk.key")))
+	if err != nil {
+		t.Fatalf("DialChannel error: %v", err)
+	}
+	defer client.Close()
+	var result string
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if result != "0x10" {
+		t.Errorf("got result %q, want 0x10", result)
+	}
+	if name := <-peers; name != "sdk" {
+		t.Errorf("node saw client certificate %q, want sdk", name)
+	}
+
+	handshakes := h.handshakes()
+	if len(handshakes) != 1 {
+		t.Fatalf("got %d handshakes, want 1", len(handshakes))
+	}
+	certs := handshakes[0]
+	for _, file := range []struct {
+		name string
+		got  []byte
+	}{
+		{"gmca.crt", certs.CACert},
+		{"gmsdk.crt", certs.Cert},
+		{"gmsdk.key", certs.Key},
+		{"gmensdk.crt", certs.EnCert},
+		{"gmensdk.key", certs.EnKey},
+	} {
+		want, err := ioutil.ReadFile(gmTestdata(file.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(file.got, want) {
+			t.Errorf("handshake didn't get the contents of %s", file.name)
+		}
+	}
+}
+
+func TestDialChannelHandshakeFailed(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, answer("0x10"))
+	defer node.close()
+	h := &standInHandshaker{err: errors.New("no shared cipher suite")}
+
+	_, err := DialChannel(node.addr(), gmTestdata("gmca.crt"), gmTestdata("gmsdk.crt"), gmTestdata("gmsdk.key"),
+		WithHandshaker(h), WithEnCert(gmTestdata("gmensdk.crt"), gmTestdata("gmensdk.key")))
+	if err == nil || !strings.Contains(err.Error(), "no shared cipher suite") {
+		t.Errorf("got error %v, want the handshake failure", err)
+	}
+}
+
+// TestDialChannelHandshakerOverride checks that a handshake set with
+// WithHandshaker is used for certificates crypto/tls supports too.
+func TestDialChannelHandshakerOverride(t *testing.T) {
+	ca := newTestCA(t)
+	node := newFakeChannelNode(t, ca, answer("0x10"))
+	defer node.close()
+	h := newStandInHandshaker(t, ca)
+
+	dir, err := ioutil.TempDir("", "channel-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile, certFile, keyFile := ca.sdkFiles(t, dir)
+	client, err := DialChannel(node.addr(), caFile, certFile, keyFile, WithHandshaker(h))
+	if err != nil {
+		t.Fatalf("DialChannel error: %v", err)
+	}
+	defer client.Close()
+	var result string
+	if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	handshakes := h.handshakes()
+	if len(handshakes) != 1 {
+		t.Fatalf("got %d handshakes, want 1", len(handshakes))
+	}
+	if handshakes[0].EnCert != nil || handshakes[0].EnKey != nil {
+		t.Error("handshake got an encryption certificate that wasn't set")
+	}
+}
+
+func TestCertificateCurve(t *testing.T) {
+	read := func(file string) []byte {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	_, p256, _ := newTestCA(t).issue(t, "sdk")
+	tests := []struct {
+		name string
+		pem  []byte
+		want asn1.ObjectIdentifier
+	}{
+		{"sm2", read(gmTestdata("gmsdk.crt")), oidSM2},
+		{"secp256k1", read(channelTestdata("sdk.crt")), oidSecp256k1},
+		{"p256", p256, asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}},
+		{"rsa", read(channelTestdata("ca.crt")), nil},
+		{"key only", read(gmTestdata("gmsdk.key")), nil},
+		{"garbage", []byte("not a certificate"), nil},
+	}
+	for _, test := range tests {
+		if got := certificateCurve(test.pem); !got.Equal(test.want) {
+			t.Errorf("%s: got curve %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// channelHeaderLength is the size of the message header: length (4 bytes),
+	// type (2 bytes), seq (32 bytes) and result (4 bytes), all big endian.
+	channelHeaderLength = 4 + 2 + channelSeqLength + 4
+	channelSeqLength    = 32
+)
+
+// DefaultMaxFrameSize bounds the channel messages read from and written to a
+// node, unless set otherwise with Client.SetMaxFrameSize. A larger length can't
+// be skipped, it ends the connection.
+const DefaultMaxFrameSize = 32 * 1024 * 1024
+
+var (
+	errChannelFrameTooLarge = errors.New("channel frame too large")
+	errChannelFrameInvalid  = errors.New("invalid channel frame")
+	errChannelSeqInvalid    = errors.New("invalid channel seq")
+)
+
+// ChannelMessage is a message of the FISCO BCOS channel protocol, which carries
+// JSON-RPC as well as AMOP, heartbeats and notifications pushed by the node.
+type ChannelMessage struct {
+	Length  uint32 // length of the encoded message, including the header
+	Type    ChannelPack
+	Seq     [channelSeqLength]byte // hex digits matching a reply to its request
+	Result  int32                  // status of a reply, 0 on success
+	Payload []byte
+}
+
+// Encode returns the wire form of the message and sets its Length. It fails if
+// the message exceeds DefaultMaxFrameSize or the seq isn't made of hex digits.
+func (m *ChannelMessage) Encode() ([]byte, error) {
+	return m.encode(DefaultMaxFrameSize)
+}
+
+func (m *ChannelMessage) encode(maxSize int) ([]byte, error) {
+	length := channelHeaderLength + len(m.Payload)
+	if length > maxSize {
+		return nil, fmt.Errorf("%v: %d bytes, limit %d", errChannelFrameTooLarge, length, maxSize)
+	}
+	if !validChannelSeq(m.Seq) {
+		return nil, fmt.Errorf("%v: seq %q", errChannelSeqInvalid, m.Seq[:])
+	}
+	m.Length = uint32(length)
+
+	buf := make([]byte, length)
+	binary.BigEndian.PutUint32(buf[0:4], m.Length)
+	binary.BigEndian.PutUint16(buf[4:6], uint16(m.Type))
+	copy(buf[6:], m.Seq[:])
+	binary.BigEndian.PutUint32(buf[6+channelSeqLength:], uint32(m.Result))
+	copy(buf[channelHeaderLength:], m.Payload)
+	return buf, nil
+}
+
+// DecodeFrom reads a single message from r. A length beyond DefaultMaxFrameSize
+// is rejected before anything is allocated for the payload; a stream ending
+// within a message fails with io.ErrUnexpectedEOF, one ending before it with
+// io.EOF.
+func (m *ChannelMessage) DecodeFrom(r io.Reader) error {
+	return m.decodeFrom(r, DefaultMaxFrameSize)
+}
+
+func (m *ChannelMessage) decodeFrom(r io.Reader, maxSize int) error {
+	var header [channelHeaderLength]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if n > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < channelHeaderLength {
+		return errChannelFrameInvalid
+	}
+	if uint64(length) > uint64(maxSize) {
+		return fmt.Errorf("%v: %d bytes, limit %d", errChannelFrameTooLarge, length, maxSize)
+	}
+	payload := make([]byte, length-channelHeaderLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	m.Length = length
+	m.Type = ChannelPack(binary.BigEndian.Uint16(header[4:6]))
+	copy(m.Seq[:], header[6:6+channelSeqLength])
+	m.Result = int32(binary.BigEndian.Uint32(header[6+channelSeqLength:]))
+	m.Payload = payload
+	return nil
+}
+
+// newChannelSeq returns a new sequence number, the hex form of NewMsgSeq.
+func newChannelSeq() (seq [channelSeqLength]byte) {
+	raw := NewMsgSeq()
+	hex.Encode(seq[:], raw[:])
+	return seq
+}
+
+// validChannelSeq reports whether seq is a complete sequence number, made of
+// hex digits only. Zero bytes would mean a seq which is too short.
+func validChannelSeq(seq [channelSeqLength]byte) bool {
+	return isHex(string(seq[:]))
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func testSeq(s string) (seq [channelSeqLength]byte) {
+	copy(seq[:], s+strings.Repeat("0", channelSeqLength))
+	return seq
+}
+
+func TestChannelMessageRoundTrip(t *testing.T) {
+	tests := []*ChannelMessage{
+		{Type: TYPE_RPC, Seq: testSeq("a1"), Payload: []byte(`{"jsonrpc":"2.0","id":1,"method":"getBlockNumber","params":[1]}`)},
+		{Type: TYPE_HEATBEAT, Seq: testSeq("ff"), Payload: []byte{}},
+		{Type: TYPE_TX_BLOCKNUM, Seq: testSeq("0"), Result: -1, Payload: []byte("1,100")},
+		{Type: TYPE_AMOP_REQ, Seq: testSeq("abcdef"), Result: 100, Payload: bytes.Repeat([]byte{0xff}, 70000)},
+	}
+	for _, msg := range tests {
+		enc, err := msg.Encode()
+		if err != nil {
+			t.Fatalf("type %#x: Encode error: %v", int(msg.Type), err)
+		}
+		if len(enc) != channelHeaderLength+len(msg.Payload) || binary.BigEndian.Uint32(enc) != uint32(len(enc)) {
+			t.Fatalf("type %#x: encoded %d bytes with length %d", int(msg.Type), len(enc), binary.BigEndian.Uint32(enc))
+		}
+		dec := new(ChannelMessage)
+		if err := dec.DecodeFrom(bytes.NewReader(enc)); err != nil {
+			t.Fatalf("type %#x: DecodeFrom error: %v", int(msg.Type), err)
+		}
+		if dec.Length != msg.Length || dec.Type != msg.Type || dec.Seq != msg.Seq || dec.Result != msg.Result || !bytes.Equal(dec.Payload, msg.Payload) {
+			t.Errorf("type %#x: round trip changed the message", int(msg.Type))
+		}
+	}
+}
+
+func TestChannelMessageEncodeErrors(t *testing.T) {
+	if _, err := (&ChannelMessage{Type: TYPE_RPC, Seq: testSeq("z")}).Encode(); err == nil || !strings.Contains(err.Error(), errChannelSeqInvalid.Error()) {
+		t.Errorf("non-hex seq: got error %v", err)
+	}
+	if _, err := (&ChannelMessage{Type: TYPE_RPC, Seq: testSeq("1"), Payload: make([]byte, 100)}).encode(64); err == nil || !strings.Contains(err.Error(), errChannelFrameTooLarge.Error()) {
+		t.Errorf("oversized message: got error %v", err)
+	}
+}
+
+func TestChannelMessageDecodeErrors(t *testing.T) {
+	valid, _ := (&ChannelMessage{Type: TYPE_RPC, Seq: testSeq("1"), Payload: []byte("payload")}).Encode()
+	header := func(length uint32) []byte {
+		h := make([]byte, channelHeaderLength)
+		binary.BigEndian.PutUint32(h, length)
+		return h
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty stream", nil, io.EOF.Error()},
+		{"partial header", valid[:10], io.ErrUnexpectedEOF.Error()},
+		{"partial payload", valid[:len(valid)-1], io.ErrUnexpectedEOF.Error()},
+		{"length below header", header(channelHeaderLength - 1), errChannelFrameInvalid.Error()},
+		{"length beyond limit", header(DefaultMaxFrameSize + 1), errChannelFrameTooLarge.Error()},
+		{"length beyond 32 bits", header(0xffffffff), errChannelFrameTooLarge.Error()},
+	}
+	for _, test := range tests {
+		err := new(ChannelMessage).DecodeFrom(bytes.NewReader(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+// checkChannelDecode decodes data with a frame limit of maxSize. Whatever the
+// input, the decoder must not panic or read beyond the frame, and a message it
+// accepts must encode back to the bytes it consumed.
+func checkChannelDecode(data []byte, maxSize int) error {
+	r := bytes.NewReader(data)
+	msg := new(ChannelMessage)
+	if err := msg.decodeFrom(r, maxSize); err != nil {
+		return nil
+	}
+	if int(msg.Length) > maxSize || len(msg.Payload) != int(msg.Length)-channelHeaderLength {
+		return fmt.Errorf("decoded length %d with %d payload bytes, limit %d", msg.Length, len(msg.Payload), maxSize)
+	}
+	consumed := data[:len(data)-r.Len()]
+	if len(consumed) != int(msg.Length) {
+		return fmt.Errorf("consumed %d bytes of a %d byte message", len(consumed), msg.Length)
+	}
+	if !validChannelSeq(msg.Seq) {
+		return nil // the connection rejects it, encoding as well
+	}
+	enc, err := msg.encode(maxSize)
+	if err != nil {
+		return fmt.Errorf("can't encode decoded message: %v", err)
+	}
+	if !bytes.Equal(enc, consumed) {
+		return fmt.Errorf("re-encoding mismatch\ngot  %x\nwant %x", enc, consumed)
+	}
+	return nil
+}
+
+func testChannelFrames(t *testing.T) [][]byte {
+	var frames [][]byte
+	for _, msg := range []*ChannelMessage{
+		{Type: TYPE_RPC, Seq: testSeq("a1"), Payload: []byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)},
+		{Type: TYPE_TX_BLOCKNUM, Seq: testSeq("0"), Payload: []byte("\x0f_block_notify_11,5")},
+		{Type: TYPE_HEATBEAT, Seq: testSeq("ff"), Result: 1},
+	} {
+		enc, err := msg.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, enc)
+	}
+	return frames
+}
+
+func TestChannelMessageDecodeTruncated(t *testing.T) {
+	for _, frame := range testChannelFrames(t) {
+		for n := 0; n < len(frame); n++ {
+			err := new(ChannelMessage).DecodeFrom(bytes.NewReader(frame[:n]))
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				t.Errorf("%d of %d bytes: got error %v, want EOF", n, len(frame), err)
+			}
+		}
+	}
+}
+
+func TestChannelMessageDecodeCorrupt(t *testing.T) {
+	const maxSize = 4096
+	for _, frame := range testChannelFrames(t) {
+		for i := range frame {
+			for _, mask := range []byte{0x01, 0x80, 0xff} {
+				corrupt := append([]byte{}, frame...)
+				corrupt[i] ^= mask
+				// Trailing bytes let corrupted lengths above the original be read.
+				corrupt = append(corrupt, make([]byte, 64)...)
+				if err := checkChannelDecode(corrupt, maxSize); err != nil {
+					t.Fatalf("byte %d xor %#x: %v", i, mask, err)
+				}
+			}
+		}
+	}
+}
+
+func TestChannelMessageDecodeRandom(t *testing.T) {
+	const maxSize = 4096
+	config := &quick.Config{MaxCount: 5000}
+	// Arbitrary streams mostly fail at the length check.
+	if err := quick.Check(func(data []byte) bool {
+		return checkChannelDecode(data, maxSize) == nil
+	}, config); err != nil {
+		t.Error(err)
+	}
+	// Plausible lengths get past it into the header and payload.
+	if err := quick.Check(func(length uint16, rest []byte) bool {
+		data := make([]byte, 4, 4+len(rest))
+		binary.BigEndian.PutUint32(data, uint32(channelHeaderLength)+uint32(length)%128)
+		return checkChannelDecode(append(data, rest...), maxSize) == nil
+	}, config); err != nil {
+		t.Error(err)
+	}
+}
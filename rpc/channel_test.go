@@ -0,0 +1,72 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestNewMsgSeqUnique generates a million seqs on several goroutines, as
+// concurrent requests do, and checks that none repeats.
+func TestNewMsgSeqUnique(t *testing.T) {
+	const workers = 8
+	total := 1000000
+	if testing.Short() {
+		total = 10000
+	}
+	results := make([][][MsgSeqLength]byte, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			seqs := make([][MsgSeqLength]byte, total/workers)
+			for i := range seqs {
+				seqs[i] = NewMsgSeq()
+			}
+			results[w] = seqs
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[[MsgSeqLength]byte]struct{}, total)
+	for _, seqs := range results {
+		for _, seq := range seqs {
+			if _, dup := seen[seq]; dup {
+				t.Fatalf("seq %x generated twice", seq)
+			}
+			seen[seq] = struct{}{}
+		}
+	}
+	if len(seen) != total {
+		t.Fatalf("got %d seqs, want %d", len(seen), total)
+	}
+}
+
+func TestNewChannelSeqValid(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if seq := newChannelSeq(); !validChannelSeq(seq) {
+			t.Fatalf("invalid channel seq %q", seq[:])
+		}
+	}
+	var short [channelSeqLength]byte
+	copy(short[:], "0123456789abcdef")
+	if validChannelSeq(short) {
+		t.Errorf("seq %q with zero bytes accepted", short[:])
+	}
+}
@@ -0,0 +1,1144 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes of the cipher suites and signatures
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	ethcrypto "github.com/chislab/go-fiscobcos/crypto"
+	"github.com/chislab/go-fiscobcos/crypto/keyio"
+	"golang.org/x/crypto/curve25519"
+)
+
+// TLS 1.2 record and handshake message types, see RFC 5246.
+const (
+	recordChangeCipherSpec = 20
+	recordAlert            = 21
+	recordHandshake        = 22
+	recordApplicationData  = 23
+
+	typeClientHello        = 1
+	typeServerHello        = 2
+	typeCertificate        = 11
+	typeServerKeyExchange  = 12
+	typeCertificateRequest = 13
+	typeServerHelloDone    = 14
+	typeCertificateVerify  = 15
+	typeClientKeyExchange  = 16
+	typeFinished           = 20
+
+	alertCloseNotify = 0
+
+	tls12Version      = 0x0303
+	maxTLSPlaintext   = 1 << 14
+	maxTLSRecord      = maxTLSPlaintext + 2048
+	maxTLSChainLength = 8
+)
+
+var (
+	errTLSRecord           = errors.New("tls: invalid record")
+	errTLSMessage          = errors.New("tls: invalid handshake message")
+	errTLSSignature        = errors.New("tls: invalid signature")
+	errTLSUnknownAuthority = errors.New("tls: node certificate not issued by the chain's CA")
+)
+
+// tls12Suite is an ECDHE cipher suite with AES-GCM. The authentication, ECDSA
+// or RSA, follows from the node's certificate.
+type tls12Suite struct {
+	id     uint16
+	keyLen int
+	hash   crypto.Hash // of the PRF
+}
+
+var tls12Suites = []tls12Suite{
+	{0xc02b, 16, crypto.SHA256}, // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	{0xc02c, 32, crypto.SHA384}, // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	{0xc02f, 16, crypto.SHA256}, // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	{0xc030, 32, crypto.SHA384}, // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+}
+
+// tls12Group is a group of the ECDHE key exchange, X25519 if curve is nil.
+type tls12Group struct {
+	id    uint16
+	curve elliptic.Curve
+}
+
+var tls12Groups = []tls12Group{
+	{29, nil},              // x25519
+	{23, elliptic.P256()},  // secp256r1
+	{24, elliptic.P384()},  // secp384r1
+	{22, ethcrypto.S256()}, // secp256k1
+}
+
+// tls12Hashes are the hashes of the TLS 1.2 signature algorithms, by their
+// identifier in the upper byte of the algorithm. The lower byte identifies the
+// signature: 1 for RSA PKCS #1 v1.5, 3 for ECDSA.
+var tls12Hashes = map[byte]crypto.Hash{4: crypto.SHA256, 5: crypto.SHA384, 6: crypto.SHA512}
+
+// Secp256k1Handshaker negotiates TLS 1.2 on channel connections whose
+// certificates are on secp256k1, the default curve of the node and SDK
+// certificates generated by build_chain.sh, which crypto/tls rejects. It offers
+// the ECDHE cipher suites with AES-GCM, authenticates with the SDK certificate
+// and verifies the node's certificate chain against the CA, but not its host
+// name, as node certificates don't name their hosts. Certificates on the NIST
+// curves and RSA certificates are accepted along the chain as well.
+//
+// DialChannel uses it for SDK certificates on secp256k1.
+type Secp256k1Handshaker struct{}
+
+// ClientHandshake implements ChannelHandshaker.
+func (Secp256k1Handshaker) ClientHandshake(ctx context.Context, conn net.Conn, certs *ChannelCerts) (net.Conn, error) {
+	config, err := newTLS12Config(certs)
+	if err != nil {
+		return nil, err
+	}
+	// Abort the handshake, blocked in a read or write, when ctx is done.
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	c, err := tls12ClientHandshake(conn, config)
+	close(stop)
+	<-stopped
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// tls12Config is the parsed configuration of a TLS 1.2 handshake.
+type tls12Config struct {
+	roots []*channelCert // trusted CA certificates
+	chain [][]byte       // own certificate chain, DER encoded
+	key   crypto.Signer  // own key
+}
+
+func newTLS12Config(certs *ChannelCerts) (*tls12Config, error) {
+	config := new(tls12Config)
+	for _, der := range pemCertificates(certs.CACert) {
+		root, err := parseChannelCert(der)
+		if err != nil {
+			return nil, fmt.Errorf("CA certificate: %v", err)
+		}
+		config.roots = append(config.roots, root)
+	}
+	if len(config.roots) == 0 {
+		return nil, errors.New("no CA certificates")
+	}
+	if config.chain = pemCertificates(certs.Cert); len(config.chain) == 0 {
+		return nil, errors.New("no sdk certificate")
+	}
+	key, err := parseChannelKey(certs.Key)
+	if err != nil {
+		return nil, fmt.Errorf("sdk key: %v", err)
+	}
+	config.key = key
+	return config, nil
+}
+
+// pemCertificates returns the DER encoded certificates of a PEM file.
+func pemCertificates(data []byte) [][]byte {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return certs
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+}
+
+// parseChannelKey parses a PEM encoded private key on secp256k1, on one of the
+// NIST curves, or an RSA key.
+func parseChannelKey(data []byte) (crypto.Signer, error) {
+	key, err := keyio.ParseECDSAPem(data)
+	switch {
+	case err == nil:
+		return key, nil
+	case err != keyio.ErrUnsupportedCurve && err != keyio.ErrInvalidPEM:
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return nil, keyio.ErrInvalidPEM
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported key type %T", key)
+			}
+			return signer, nil
+		case "EC PRIVATE KEY":
+			key, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return key, nil
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return key, nil
+		}
+	}
+}
+
+// channelCert is a certificate of a channel connection. It's parsed without
+// crypto/x509, which rejects keys on secp256k1.
+type channelCert struct {
+	raw       []byte
+	tbs       []byte // signed part
+	issuer    []byte // DER encoded name
+	subject   []byte // DER encoded name
+	sigAlg    channelSigAlg
+	sig       []byte
+	pub       crypto.PublicKey
+	notBefore time.Time
+	notAfter  time.Time
+
+	constrained bool                    // whether it has basic constraints
+	isCA        bool                    // whether it may issue certificates
+	maxPathLen  int                     // CA certificates allowed below it, -1 for any
+	keyUsage    x509.KeyUsage           // 0 if unrestricted
+	extKeyUsage []asn1.ObjectIdentifier // nil if unrestricted
+}
+
+// channelSigAlg is a certificate signature algorithm.
+type channelSigAlg struct {
+	oid   asn1.ObjectIdentifier
+	hash  crypto.Hash
+	ecdsa bool // ECDSA, or RSA PKCS #1 v1.5
+}
+
+var channelSigAlgs = []channelSigAlg{
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256, true},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384, true},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, crypto.SHA512, true},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256, false},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384, false},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512, false},
+}
+
+var (
+	oidPublicKeyECDSA    = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidBasicConstraints  = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidSubjectAltName    = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtKeyUsageAny    = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+	oidExtKeyUsageServer = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	channelCertCurveOIDs = []struct {
+		oid   asn1.ObjectIdentifier
+		curve elliptic.Curve
+	}{
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, elliptic.P256()},
+		{asn1.ObjectIdentifier{1, 3, 132, 0, 34}, elliptic.P384()},
+		{asn1.ObjectIdentifier{1, 3, 132, 0, 35}, elliptic.P521()},
+		{oidSecp256k1, ethcrypto.S256()},
+	}
+)
+
+func parseChannelCert(der []byte) (*channelCert, error) {
+	var cert struct {
+		TBS    asn1.RawValue
+		SigAlg pkix.AlgorithmIdentifier
+		Sig    asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(der, &cert); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after certificate")
+	}
+	var tbs struct {
+		Version    int `asn1:"optional,explicit,default:0,tag:0"`
+		Serial     *big.Int
+		SigAlg     pkix.AlgorithmIdentifier
+		Issuer     asn1.RawValue
+		Validity   struct{ NotBefore, NotAfter time.Time }
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		IssuerID   asn1.BitString   `asn1:"optional,tag:1"`
+		SubjectID  asn1.BitString   `asn1:"optional,tag:2"`
+		Extensions []pkix.Extension `asn1:"optional,explicit,tag:3"`
+	}
+	if _, err := asn1.Unmarshal(cert.TBS.FullBytes, &tbs); err != nil {
+		return nil, err
+	}
+	c := &channelCert{
+		raw:       der,
+		tbs:       cert.TBS.FullBytes,
+		issuer:    tbs.Issuer.FullBytes,
+		subject:   tbs.Subject.FullBytes,
+		sig:       cert.Sig.RightAlign(),
+		notBefore: tbs.Validity.NotBefore,
+		notAfter:  tbs.Validity.NotAfter,
+
+		maxPathLen: -1,
+	}
+	for _, alg := range channelSigAlgs {
+		if alg.oid.Equal(cert.SigAlg.Algorithm) {
+			c.sigAlg = alg
+		}
+	}
+	if c.sigAlg.oid == nil {
+		return nil, fmt.Errorf("unsupported signature algorithm %v", cert.SigAlg.Algorithm)
+	}
+	pub, err := parseChannelPublicKey(tbs.PublicKey.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	c.pub = pub
+	for _, ext := range tbs.Extensions {
+		switch {
+		case ext.Id.Equal(oidBasicConstraints):
+			var constraints struct {
+				IsCA       bool `asn1:"optional"`
+				MaxPathLen int  `asn1:"optional,default:-1"`
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
+				return nil, err
+			}
+			c.constrained, c.isCA = true, constraints.IsCA
+			if c.isCA {
+				c.maxPathLen = constraints.MaxPathLen
+			}
+		case ext.Id.Equal(oidKeyUsage):
+			var usage asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &usage); err != nil {
+				return nil, err
+			}
+			for i := 0; i < 9; i++ {
+				if usage.At(i) != 0 {
+					c.keyUsage |= 1 << uint(i)
+				}
+			}
+		case ext.Id.Equal(oidExtKeyUsage):
+			if _, err := asn1.Unmarshal(ext.Value, &c.extKeyUsage); err != nil {
+				return nil, err
+			}
+			if c.extKeyUsage == nil {
+				c.extKeyUsage = []asn1.ObjectIdentifier{}
+			}
+		case ext.Id.Equal(oidSubjectAltName):
+			// Nodes are authenticated by the chain's CA, not by name.
+		case ext.Critical:
+			return nil, fmt.Errorf("unhandled critical extension %v", ext.Id)
+		}
+	}
+	return c, nil
+}
+
+// parseChannelPublicKey parses a DER encoded public key, an elliptic curve key
+// on secp256k1 or one of the NIST curves, or an RSA key.
+func parseChannelPublicKey(der []byte) (crypto.PublicKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Key       asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return x509.ParsePKIXPublicKey(der)
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &oid); err != nil {
+		return nil, err
+	}
+	for _, c := range channelCertCurveOIDs {
+		if c.oid.Equal(oid) {
+			x, y := elliptic.Unmarshal(c.curve, info.Key.RightAlign())
+			if x == nil || !c.curve.IsOnCurve(x, y) {
+				return nil, errors.New("invalid elliptic curve public key")
+			}
+			return &ecdsa.PublicKey{Curve: c.curve, X: x, Y: y}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported elliptic curve %v", oid)
+}
+
+// checkSignature verifies that c issued child.
+func (c *channelCert) checkSignature(child *channelCert) error {
+	if _, ok := c.pub.(*ecdsa.PublicKey); ok != child.sigAlg.ecdsa {
+		return errTLSSignature
+	}
+	return verifySignature(c.pub, child.sigAlg.hash, child.tbs, child.sig)
+}
+
+func (c *channelCert) validAt(now time.Time) bool {
+	return !now.Before(c.notBefore) && !now.After(c.notAfter)
+}
+
+// serverAuth reports whether the extended key usage of c, if any, allows
+// authenticating servers.
+func (c *channelCert) serverAuth() bool {
+	if c.extKeyUsage == nil {
+		return true
+	}
+	for _, usage := range c.extKeyUsage {
+		if usage.Equal(oidExtKeyUsageServer) || usage.Equal(oidExtKeyUsageAny) {
+			return true
+		}
+	}
+	return false
+}
+
+// canIssue checks that c may issue a certificate with depth CA certificates
+// between it and the node certificate. Like crypto/x509, roots without basic
+// constraints, as version 1 certificates are, are taken as CAs.
+func (c *channelCert) canIssue(depth int, root bool) error {
+	switch {
+	case !c.isCA && (c.constrained || !root):
+		return errors.New("tls: node certificate issued by a certificate which is not a CA")
+	case c.keyUsage != 0 && c.keyUsage&x509.KeyUsageCertSign == 0:
+		return errors.New("tls: node certificate issued by a certificate not valid for signing certificates")
+	case c.maxPathLen >= 0 && depth > c.maxPathLen:
+		return errors.New("tls: node certificate chain exceeds the path length of a CA")
+	case !c.serverAuth():
+		return errors.New("tls: node certificate issued by a CA not valid for server authentication")
+	}
+	return nil
+}
+
+// verifyChannelChain checks that the first certificate of chain is issued by
+// one of roots, directly or through the other certificates of chain, and that
+// the certificates are valid at now. The issuers have to be CAs within their
+// path length and key usage, and the node certificate valid for signing; an
+// extended key usage anywhere along the chain has to allow server
+// authentication.
+func verifyChannelChain(chain, roots []*channelCert, now time.Time) error {
+	if len(chain) == 0 {
+		return errors.New("node sent no certificate")
+	}
+	cert := chain[0]
+	if cert.keyUsage != 0 && cert.keyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return errors.New("tls: node certificate not valid for signing")
+	}
+	if !cert.serverAuth() {
+		return errors.New("tls: node certificate not valid for server authentication")
+	}
+	// depth is the number of CA certificates between the issuer of cert and
+	// the node certificate.
+	for depth := 0; depth < maxTLSChainLength; depth++ {
+		if !cert.validAt(now) {
+			return fmt.Errorf("tls: certificate expired or not yet valid (valid from %v to %v)", cert.notBefore, cert.notAfter)
+		}
+		// An issuer which signed cert but may not issue it is reported if no
+		// other one is found.
+		unauthorized := errTLSUnknownAuthority
+		for _, root := range roots {
+			if bytes.Equal(root.raw, cert.raw) {
+				return nil
+			}
+			if bytes.Equal(root.subject, cert.issuer) && root.validAt(now) && root.checkSignature(cert) == nil {
+				if err := root.canIssue(depth, true); err != nil {
+					unauthorized = err
+					continue
+				}
+				return nil
+			}
+		}
+		var issuer *channelCert
+		for _, c := range chain[1:] {
+			if bytes.Equal(c.subject, cert.issuer) && c.checkSignature(cert) == nil {
+				if err := c.canIssue(depth, false); err != nil {
+					unauthorized = err
+					continue
+				}
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			return unauthorized
+		}
+		cert = issuer
+	}
+	return errTLSUnknownAuthority
+}
+
+// verifySignature checks a signature by pub over the hash of signed. ECDSA
+// signatures are DER encoded, RSA signatures use PKCS #1 v1.5.
+func verifySignature(pub crypto.PublicKey, hash crypto.Hash, signed, sig []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		var esig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) > 0 {
+			return errTLSSignature
+		}
+		if esig.R.Sign() <= 0 || esig.S.Sign() <= 0 || !ecdsa.Verify(pub, digest, esig.R, esig.S) {
+			return errTLSSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, hash, digest, sig) != nil {
+			return errTLSSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("tls: unsupported public key %T", pub)
+}
+
+// tls12SignatureAlgorithm picks the TLS signature algorithm of key among the
+// accepted ones, the strongest hash first.
+func tls12SignatureAlgorithm(key crypto.PublicKey, accepted []uint16) (uint16, crypto.Hash, error) {
+	var sig uint16
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		sig = 3
+	case *rsa.PublicKey:
+		sig = 1
+	default:
+		return 0, 0, fmt.Errorf("tls: unsupported key %T", key)
+	}
+	for _, hash := range []byte{6, 5, 4} {
+		alg := uint16(hash)<<8 | sig
+		for _, a := range accepted {
+			if a == alg {
+				return alg, tls12Hashes[hash], nil
+			}
+		}
+	}
+	return 0, 0, errors.New("tls: no common signature algorithm")
+}
+
+// generate creates an ephemeral key pair of the group, returning the private
+// key and the encoded public key.
+func (g tls12Group) generate() ([]byte, []byte, error) {
+	if g.curve == nil {
+		var priv, pub [32]byte
+		if _, err := io.ReadFull(rand.Reader, priv[:]); err != nil {
+			return nil, nil, err
+		}
+		curve25519.ScalarBaseMult(&pub, &priv)
+		return priv[:], pub[:], nil
+	}
+	priv, x, y, err := elliptic.GenerateKey(g.curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, elliptic.Marshal(g.curve, x, y), nil
+}
+
+// sharedSecret computes the premaster secret from the private key and the
+// peer's public key.
+func (g tls12Group) sharedSecret(priv, peer []byte) ([]byte, error) {
+	if g.curve == nil {
+		if len(peer) != 32 {
+			return nil, errTLSMessage
+		}
+		var scalar, point, secret [32]byte
+		copy(scalar[:], priv)
+		copy(point[:], peer)
+		curve25519.ScalarMult(&secret, &scalar, &point)
+		if secret == [32]byte{} {
+			return nil, errTLSMessage
+		}
+		return secret[:], nil
+	}
+	x, y := elliptic.Unmarshal(g.curve, peer)
+	if x == nil || !g.curve.IsOnCurve(x, y) {
+		return nil, errTLSMessage
+	}
+	sx, _ := g.curve.ScalarMult(x, y, priv)
+	if sx == nil {
+		return nil, errTLSMessage
+	}
+	secret := make([]byte, (g.curve.Params().BitSize+7)/8)
+	b := sx.Bytes()
+	copy(secret[len(secret)-len(b):], b)
+	return secret, nil
+}
+
+// tls12PRF is the pseudorandom function of TLS 1.2, P_hash of RFC 5246 section 5.
+func tls12PRF(hash crypto.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(hash.New, secret)
+	out := make([]byte, 0, n+hash.Size())
+	for a := labelSeed; len(out) < n; {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
+
+// tls12HalfConn is one direction of a connection, encrypted once the cipher
+// change is received or sent.
+type tls12HalfConn struct {
+	aead cipher.AEAD
+	iv   []byte // implicit part of the nonce
+	seq  uint64
+}
+
+func newTLS12HalfConn(key, iv []byte) (tls12HalfConn, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return tls12HalfConn{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return tls12HalfConn{}, err
+	}
+	return tls12HalfConn{aead: aead, iv: iv}, nil
+}
+
+func (hc *tls12HalfConn) additionalData(typ byte, n int) []byte {
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, hc.seq)
+	ad[8] = typ
+	binary.BigEndian.PutUint16(ad[9:], tls12Version)
+	binary.BigEndian.PutUint16(ad[11:], uint16(n))
+	return ad
+}
+
+func (hc *tls12HalfConn) seal(typ byte, plaintext []byte) []byte {
+	if hc.aead == nil {
+		return plaintext
+	}
+	explicit := make([]byte, 8)
+	binary.BigEndian.PutUint64(explicit, hc.seq)
+	nonce := append(hc.iv[:len(hc.iv):len(hc.iv)], explicit...)
+	out := hc.aead.Seal(explicit, nonce, plaintext, hc.additionalData(typ, len(plaintext)))
+	hc.seq++
+	return out
+}
+
+func (hc *tls12HalfConn) open(typ byte, record []byte) ([]byte, error) {
+	if hc.aead == nil {
+		return record, nil
+	}
+	if len(record) < 8+hc.aead.Overhead() {
+		return nil, errTLSRecord
+	}
+	nonce := append(hc.iv[:len(hc.iv):len(hc.iv)], record[:8]...)
+	ad := hc.additionalData(typ, len(record)-8-hc.aead.Overhead())
+	plaintext, err := hc.aead.Open(nil, nonce, record[8:], ad)
+	if err != nil {
+		return nil, errors.New("tls: bad record MAC")
+	}
+	hc.seq++
+	return plaintext, nil
+}
+
+// tls12Conn is a TLS 1.2 connection, see Secp256k1Handshaker. Reads and writes
+// may run concurrently.
+type tls12Conn struct {
+	net.Conn
+
+	readMu  sync.Mutex
+	in      tls12HalfConn
+	input   []byte // application data received, not read yet
+	readErr error
+
+	writeMu sync.Mutex
+	out     tls12HalfConn
+}
+
+// readRecord reads and decrypts the next record.
+func (c *tls12Conn) readRecord() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[3:]))
+	if hdr[1] != 3 || n > maxTLSRecord {
+		return 0, nil, errTLSRecord
+	}
+	record := make([]byte, n)
+	if _, err := io.ReadFull(c.Conn, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	data, err := c.in.open(hdr[0], record)
+	return hdr[0], data, err
+}
+
+// writeRecord encrypts and sends data in records of type typ. The caller holds
+// writeMu, unless the handshake is running.
+func (c *tls12Conn) writeRecord(typ byte, data []byte) (int, error) {
+	n := 0
+	for {
+		chunk := data
+		if len(chunk) > maxTLSPlaintext {
+			chunk = chunk[:maxTLSPlaintext]
+		}
+		payload := c.out.seal(typ, chunk)
+		record := make([]byte, 5, 5+len(payload))
+		record[0] = typ
+		binary.BigEndian.PutUint16(record[1:], tls12Version)
+		binary.BigEndian.PutUint16(record[3:], uint16(len(payload)))
+		if _, err := c.Conn.Write(append(record, payload...)); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		if data = data[len(chunk):]; len(data) == 0 {
+			return n, nil
+		}
+	}
+}
+
+// Read reads application data, skipping renegotiation requests, which aren't
+// supported.
+func (c *tls12Conn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.input) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		typ, data, err := c.readRecord()
+		switch {
+		case err != nil:
+			c.readErr = err
+		case typ == recordApplicationData:
+			c.input = data
+		case typ == recordAlert:
+			c.readErr = alertError(data)
+		case typ != recordHandshake:
+			c.readErr = errTLSRecord
+		}
+	}
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+	return n, nil
+}
+
+func (c *tls12Conn) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeRecord(recordApplicationData, b)
+}
+
+// CloseWrite sends the close_notify alert and shuts down the write side of the
+// connection, if the underlying connection supports it.
+func (c *tls12Conn) CloseWrite() error {
+	c.writeMu.Lock()
+	_, err := c.writeRecord(recordAlert, []byte{1, alertCloseNotify})
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close sends the close_notify alert, giving up on it after a second, and
+// closes the connection.
+func (c *tls12Conn) Close() error {
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeMu.Lock()
+	c.writeRecord(recordAlert, []byte{1, alertCloseNotify})
+	c.writeMu.Unlock()
+	return c.Conn.Close()
+}
+
+// alertError returns the error an alert record reports, io.EOF for close_notify.
+func alertError(data []byte) error {
+	switch {
+	case len(data) != 2:
+		return errTLSRecord
+	case data[1] == alertCloseNotify:
+		return io.EOF
+	}
+	return fmt.Errorf("tls: remote error: alert %d", data[1])
+}
+
+// tls12Handshake reads and writes the messages of a handshake.
+type tls12Handshake struct {
+	conn       *tls12Conn
+	buf        []byte // handshake data received, not parsed yet
+	transcript []byte // messages sent and received
+}
+
+// readMessage returns the type and body of the next handshake message.
+func (hs *tls12Handshake) readMessage() (byte, []byte, error) {
+	for len(hs.buf) < 4 || len(hs.buf) < 4+int(uint24(hs.buf[1:])) {
+		typ, data, err := hs.conn.readRecord()
+		switch {
+		case err != nil:
+			return 0, nil, err
+		case typ == recordAlert:
+			return 0, nil, alertError(data)
+		case typ != recordHandshake:
+			return 0, nil, fmt.Errorf("tls: unexpected record type %d", typ)
+		}
+		hs.buf = append(hs.buf, data...)
+	}
+	msg := hs.buf[:4+uint24(hs.buf[1:])]
+	hs.buf = hs.buf[len(msg):]
+	hs.transcript = append(hs.transcript, msg...)
+	return msg[0], msg[4:], nil
+}
+
+// expectMessage reads the next handshake message, which must be of type typ.
+func (hs *tls12Handshake) expectMessage(typ byte) ([]byte, error) {
+	t, body, err := hs.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	if t != typ {
+		return nil, fmt.Errorf("tls: unexpected handshake message %d, want %d", t, typ)
+	}
+	return body, nil
+}
+
+func (hs *tls12Handshake) writeMessage(typ byte, body []byte) error {
+	msg := append([]byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	hs.transcript = append(hs.transcript, msg...)
+	_, err := hs.conn.writeRecord(recordHandshake, msg)
+	return err
+}
+
+// transcriptHash hashes the messages so far.
+func (hs *tls12Handshake) transcriptHash(hash crypto.Hash) []byte {
+	h := hash.New()
+	h.Write(hs.transcript)
+	return h.Sum(nil)
+}
+
+// tls12ClientHandshake runs the client side of a full TLS 1.2 handshake.
+func tls12ClientHandshake(conn net.Conn, config *tls12Config) (*tls12Conn, error) {
+	hs := &tls12Handshake{conn: &tls12Conn{Conn: conn}}
+
+	clientRandom := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, clientRandom); err != nil {
+		return nil, err
+	}
+	if err := hs.writeMessage(typeClientHello, clientHello(clientRandom)); err != nil {
+		return nil, err
+	}
+
+	// Server hello and certificate.
+	body, err := hs.expectMessage(typeServerHello)
+	if err != nil {
+		return nil, err
+	}
+	r := &tlsReader{b: body}
+	version, serverRandom, _, suiteID, compression := r.u16(), r.bytes(32), r.vec8(), r.u16(), r.u8()
+	if r.short {
+		return nil, errTLSMessage
+	}
+	if version != tls12Version {
+		return nil, fmt.Errorf("tls: node negotiated version %#04x, want TLS 1.2", version)
+	}
+	var suite *tls12Suite
+	for i := range tls12Suites {
+		if tls12Suites[i].id == uint16(suiteID) {
+			suite = &tls12Suites[i]
+		}
+	}
+	if suite == nil || compression != 0 {
+		return nil, fmt.Errorf("tls: node selected unoffered cipher suite %#04x", suiteID)
+	}
+	if body, err = hs.expectMessage(typeCertificate); err != nil {
+		return nil, err
+	}
+	chain, err := parseCertificateMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChannelChain(chain, config.roots, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Ephemeral key of the node, signed by its certificate.
+	if body, err = hs.expectMessage(typeServerKeyExchange); err != nil {
+		return nil, err
+	}
+	r = &tlsReader{b: body}
+	curveType, groupID, serverPublic := r.u8(), r.u16(), r.vec8()
+	params := body[:len(body)-len(r.b)]
+	sigAlg, sig := r.u16(), r.vec16()
+	if r.short || len(r.b) > 0 || curveType != 3 {
+		return nil, errTLSMessage
+	}
+	hash, ok := tls12Hashes[byte(sigAlg>>8)]
+	if !ok {
+		return nil, fmt.Errorf("tls: unsupported signature algorithm %#04x", sigAlg)
+	}
+	if _, isECDSA := chain[0].pub.(*ecdsa.PublicKey); isECDSA != (sigAlg&0xff == 3) {
+		return nil, fmt.Errorf("tls: signature algorithm %#04x doesn't match the node certificate", sigAlg)
+	}
+	signed := append(append(append([]byte{}, clientRandom...), serverRandom...), params...)
+	if err := verifySignature(chain[0].pub, hash, signed, sig); err != nil {
+		return nil, err
+	}
+	var group *tls12Group
+	for i := range tls12Groups {
+		if tls12Groups[i].id == uint16(groupID) {
+			group = &tls12Groups[i]
+		}
+	}
+	if group == nil {
+		return nil, fmt.Errorf("tls: node selected unoffered group %d", groupID)
+	}
+	priv, clientPublic, err := group.generate()
+	if err != nil {
+		return nil, err
+	}
+	preMaster, err := group.sharedSecret(priv, serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificate request, if the node authenticates the client as it should.
+	typ, body, err := hs.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	var requested []uint16 // signature algorithms, if requested
+	certRequested := typ == typeCertificateRequest
+	if certRequested {
+		r = &tlsReader{b: body}
+		r.vec8() // certificate types
+		algs := &tlsReader{b: r.vec16()}
+		r.vec16() // CA names
+		for len(algs.b) >= 2 {
+			requested = append(requested, uint16(algs.u16()))
+		}
+		if r.short {
+			return nil, errTLSMessage
+		}
+		if typ, body, err = hs.readMessage(); err != nil {
+			return nil, err
+		}
+	}
+	if typ != typeServerHelloDone || len(body) != 0 {
+		return nil, fmt.Errorf("tls: unexpected handshake message %d, want %d", typ, typeServerHelloDone)
+	}
+
+	// Client certificate, key exchange and certificate verification.
+	if certRequested {
+		var certs []byte
+		for _, der := range config.chain {
+			certs = appendVec24(certs, der)
+		}
+		if err := hs.writeMessage(typeCertificate, appendVec24(nil, certs)); err != nil {
+			return nil, err
+		}
+	}
+	if err := hs.writeMessage(typeClientKeyExchange, append([]byte{byte(len(clientPublic))}, clientPublic...)); err != nil {
+		return nil, err
+	}
+	if certRequested {
+		alg, hash, err := tls12SignatureAlgorithm(config.key.Public(), requested)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := config.key.Sign(rand.Reader, hs.transcriptHash(hash), hash)
+		if err != nil {
+			return nil, err
+		}
+		verify := appendVec16([]byte{byte(alg >> 8), byte(alg)}, sig)
+		if err := hs.writeMessage(typeCertificateVerify, verify); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keys and finished messages.
+	master := tls12PRF(suite.hash, preMaster, "master secret", append(append([]byte{}, clientRandom...), serverRandom...), 48)
+	keys := tls12PRF(suite.hash, master, "key expansion", append(append([]byte{}, serverRandom...), clientRandom...), 2*suite.keyLen+8)
+	clientKey, serverKey := keys[:suite.keyLen], keys[suite.keyLen:2*suite.keyLen]
+	clientIV, serverIV := keys[2*suite.keyLen:2*suite.keyLen+4], keys[2*suite.keyLen+4:]
+
+	if _, err := hs.conn.writeRecord(recordChangeCipherSpec, []byte{1}); err != nil {
+		return nil, err
+	}
+	if hs.conn.out, err = newTLS12HalfConn(clientKey, clientIV); err != nil {
+		return nil, err
+	}
+	finished := tls12PRF(suite.hash, master, "client finished", hs.transcriptHash(suite.hash), 12)
+	if err := hs.writeMessage(typeFinished, finished); err != nil {
+		return nil, err
+	}
+	typ, data, err := hs.conn.readRecord()
+	switch {
+	case err != nil:
+		return nil, err
+	case typ == recordAlert:
+		return nil, alertError(data)
+	case typ != recordChangeCipherSpec || !bytes.Equal(data, []byte{1}) || len(hs.buf) > 0:
+		return nil, errTLSMessage
+	}
+	if hs.conn.in, err = newTLS12HalfConn(serverKey, serverIV); err != nil {
+		return nil, err
+	}
+	want := tls12PRF(suite.hash, master, "server finished", hs.transcriptHash(suite.hash), 12)
+	if body, err = hs.expectMessage(typeFinished); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(body, want) {
+		return nil, errors.New("tls: node's finished message is invalid")
+	}
+	return hs.conn, nil
+}
+
+// clientHello returns the body of the client hello message.
+func clientHello(random []byte) []byte {
+	var suites, groups, extensions []byte
+	for _, suite := range tls12Suites {
+		suites = appendU16(suites, suite.id)
+	}
+	for _, group := range tls12Groups {
+		groups = appendU16(groups, group.id)
+	}
+	var algs []byte
+	for _, hash := range []byte{4, 5, 6} {
+		algs = append(algs, hash, 3, hash, 1)
+	}
+	extensions = appendU16(extensions, 10) // supported groups
+	extensions = appendVec16(extensions, appendVec16(nil, groups))
+	extensions = appendU16(extensions, 11) // EC point formats: uncompressed
+	extensions = appendVec16(extensions, []byte{1, 0})
+	extensions = appendU16(extensions, 13) // signature algorithms
+	extensions = appendVec16(extensions, appendVec16(nil, algs))
+	extensions = appendU16(extensions, 0xff01) // renegotiation info, none
+	extensions = appendVec16(extensions, []byte{0})
+
+	hello := appendU16(nil, tls12Version)
+	hello = append(hello, random...)
+	hello = append(hello, 0) // no session id
+	hello = appendVec16(hello, suites)
+	hello = append(hello, 1, 0) // no compression
+	return appendVec16(hello, extensions)
+}
+
+// parseCertificateMessage parses the certificate chain of a certificate message.
+func parseCertificateMessage(body []byte) ([]*channelCert, error) {
+	r := &tlsReader{b: body}
+	list := &tlsReader{b: r.vec24()}
+	if r.short || len(r.b) > 0 {
+		return nil, errTLSMessage
+	}
+	var chain []*channelCert
+	for len(list.b) > 0 {
+		der := list.vec24()
+		if list.short {
+			return nil, errTLSMessage
+		}
+		cert, err := parseChannelCert(der)
+		if err != nil {
+			return nil, fmt.Errorf("tls: node certificate: %v", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+}
+
+func appendU16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendVec16(b, data []byte) []byte {
+	return append(appendU16(b, uint16(len(data))), data...)
+}
+
+func appendVec24(b, data []byte) []byte {
+	return append(append(b, byte(len(data)>>16), byte(len(data)>>8), byte(len(data))), data...)
+}
+
+// tlsReader reads the fields of a handshake message. Reading past the end sets
+// short and yields zero values.
+type tlsReader struct {
+	b     []byte
+	short bool
+}
+
+func (r *tlsReader) bytes(n int) []byte {
+	if n > len(r.b) {
+		r.short = true
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *tlsReader) readUint(n int) int {
+	v := 0
+	for _, b := range r.bytes(n) {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+func (r *tlsReader) u8() int       { return r.readUint(1) }
+func (r *tlsReader) u16() int      { return r.readUint(2) }
+func (r *tlsReader) vec8() []byte  { return r.bytes(r.readUint(1)) }
+func (r *tlsReader) vec16() []byte { return r.bytes(r.readUint(2)) }
+func (r *tlsReader) vec24() []byte { return r.bytes(r.readUint(3)) }
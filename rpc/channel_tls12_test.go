@@ -0,0 +1,558 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// channelTestdata returns the path of a certificate file of testdata/channel,
+// generated like build_chain.sh does, see gen.sh there.
+func channelTestdata(name string) string {
+	return filepath.Join("testdata", "channel", name)
+}
+
+func loadTestChannelCerts(t *testing.T, cert, key string) *ChannelCerts {
+	t.Helper()
+	certs, err := LoadChannelCerts(channelTestdata("ca.crt"), channelTestdata(cert), channelTestdata(key), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs
+}
+
+// tls12ServerHandshake runs the server side of a TLS 1.2 handshake like a node
+// of a non-guomi chain does: ECDHE_ECDSA with AES-128-GCM, key exchange in the
+// given group, and a client certificate issued by the CA of certs required. It
+// returns the client certificate chain.
+func tls12ServerHandshake(conn net.Conn, certs *ChannelCerts, groupID uint16) (*tls12Conn, []*channelCert, error) {
+	config, err := newTLS12Config(certs)
+	if err != nil {
+		return nil, nil, err
+	}
+	hs := &tls12Handshake{conn: &tls12Conn{Conn: conn}}
+	suite := tls12Suites[0]
+	var group tls12Group
+	for _, g := range tls12Groups {
+		if g.id == groupID {
+			group = g
+		}
+	}
+
+	// Client hello.
+	body, err := hs.expectMessage(typeClientHello)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &tlsReader{b: body}
+	r.u16()
+	clientRandom := r.bytes(32)
+	r.vec8()
+	suites := &tlsReader{b: r.vec16()}
+	offered := false
+	for len(suites.b) >= 2 {
+		if uint16(suites.u16()) == suite.id {
+			offered = true
+		}
+	}
+	if r.short || !offered {
+		return nil, nil, errors.New("no common cipher suite")
+	}
+
+	// Server flight.
+	serverRandom := make([]byte, 32)
+	rand.Read(serverRandom)
+	hello := appendU16(nil, tls12Version)
+	hello = append(hello, serverRandom...)
+	hello = append(hello, 0)
+	hello = append(appendU16(hello, suite.id), 0)
+	if err := hs.writeMessage(typeServerHello, hello); err != nil {
+		return nil, nil, err
+	}
+	var list []byte
+	for _, der := range config.chain {
+		list = appendVec24(list, der)
+	}
+	if err := hs.writeMessage(typeCertificate, appendVec24(nil, list)); err != nil {
+		return nil, nil, err
+	}
+	priv, public, err := group.generate()
+	if err != nil {
+		return nil, nil, err
+	}
+	params := append(appendU16([]byte{3}, group.id), byte(len(public)))
+	params = append(params, public...)
+	signed := append(append(append([]byte{}, clientRandom...), serverRandom...), params...)
+	h := crypto.SHA256.New()
+	h.Write(signed)
+	sig, err := config.key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := hs.writeMessage(typeServerKeyExchange, appendVec16(appendU16(params, 0x0403), sig)); err != nil {
+		return nil, nil, err
+	}
+	request := appendVec16([]byte{2, 64, 1}, []byte{4, 3, 4, 1})
+	if err := hs.writeMessage(typeCertificateRequest, appendVec16(request, nil)); err != nil {
+		return nil, nil, err
+	}
+	if err := hs.writeMessage(typeServerHelloDone, nil); err != nil {
+		return nil, nil, err
+	}
+
+	// Client certificate, key exchange and certificate verification.
+	if body, err = hs.expectMessage(typeCertificate); err != nil {
+		return nil, nil, err
+	}
+	chain, err := parseCertificateMessage(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verifyChannelChain(chain, config.roots, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	if body, err = hs.expectMessage(typeClientKeyExchange); err != nil {
+		return nil, nil, err
+	}
+	r = &tlsReader{b: body}
+	preMaster, err := group.sharedSecret(priv, r.vec8())
+	if err != nil {
+		return nil, nil, err
+	}
+	transcript := append([]byte{}, hs.transcript...)
+	if body, err = hs.expectMessage(typeCertificateVerify); err != nil {
+		return nil, nil, err
+	}
+	r = &tlsReader{b: body}
+	alg, sig := r.u16(), r.vec16()
+	if err := verifySignature(chain[0].pub, tls12Hashes[byte(alg>>8)], transcript, sig); err != nil {
+		return nil, nil, err
+	}
+
+	// Keys and finished messages.
+	master := tls12PRF(suite.hash, preMaster, "master secret", append(append([]byte{}, clientRandom...), serverRandom...), 48)
+	keys := tls12PRF(suite.hash, master, "key expansion", append(append([]byte{}, serverRandom...), clientRandom...), 2*suite.keyLen+8)
+	if typ, data, err := hs.conn.readRecord(); err != nil || typ != recordChangeCipherSpec || len(data) != 1 {
+		return nil, nil, fmt.Errorf("no change cipher spec: %v", err)
+	}
+	if hs.conn.in, err = newTLS12HalfConn(keys[:16], keys[32:36]); err != nil {
+		return nil, nil, err
+	}
+	want := tls12PRF(suite.hash, master, "client finished", hs.transcriptHash(suite.hash), 12)
+	if body, err = hs.expectMessage(typeFinished); err != nil {
+		return nil, nil, err
+	}
+	if string(body) != string(want) {
+		return nil, nil, errors.New("invalid client finished message")
+	}
+	if _, err := hs.conn.writeRecord(recordChangeCipherSpec, []byte{1}); err != nil {
+		return nil, nil, err
+	}
+	if hs.conn.out, err = newTLS12HalfConn(keys[16:32], keys[36:40]); err != nil {
+		return nil, nil, err
+	}
+	finished := tls12PRF(suite.hash, master, "server finished", hs.transcriptHash(suite.hash), 12)
+	if err := hs.writeMessage(typeFinished, finished); err != nil {
+		return nil, nil, err
+	}
+	return hs.conn, chain, nil
+}
+
+// secp256k1Node is a channel node serving JSON-RPC over tls12ServerHandshake.
+type secp256k1Node struct {
+	listener net.Listener
+	certs    *ChannelCerts
+	group    uint16
+	result   interface{}
+
+	clients chan []*channelCert // client certificate chains
+	errs    chan error          // handshake failures
+}
+
+func newSecp256k1Node(t *testing.T, certs *ChannelCerts, group uint16, result interface{}) *secp256k1Node {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &secp256k1Node{listener, certs, group, result, make(chan []*channelCert, 10), make(chan error, 10)}
+	go n.serve()
+	return n
+}
+
+func (n *secp256k1Node) serve() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			tconn, chain, err := tls12ServerHandshake(conn, n.certs, n.group)
+			if err != nil {
+				n.errs <- err
+				return
+			}
+			n.clients <- chain
+			for {
+				f, msg, err := readRPC(tconn)
+				if err != nil {
+					return
+				}
+				if writeRPC(tconn, f.Seq, msg.ID, n.result) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func commonName(cert *channelCert) string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(cert.subject, &rdns); err != nil {
+		return ""
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name.CommonName
+}
+
+// TestSecp256k1Handshake connects to a node with secp256k1 certificates, as
+// generated by build_chain.sh, for each group of the key exchange.
+func TestSecp256k1Handshake(t *testing.T) {
+	for _, group := range tls12Groups {
+		node := newSecp256k1Node(t, loadTestChannelCerts(t, "node.crt", "node.key"), group.id, "0x10")
+		client, err := DialChannel(node.listener.Addr().String(), channelTestdata("ca.crt"), channelTestdata("sdk.crt"), channelTestdata("sdk.key"))
+		if err != nil {
+			t.Fatalf("group %d: DialChannel error: %v", group.id, err)
+		}
+		var result string
+		if err := client.Call(&result, "getBlockNumber", 1); err != nil {
+			t.Errorf("group %d: Call error: %v", group.id, err)
+		} else if result != "0x10" {
+			t.Errorf("group %d: got result %q, want 0x10", group.id, result)
+		}
+		if chain := <-node.clients; len(chain) != 2 || commonName(chain[0]) != "sdk" {
+			t.Errorf("group %d: node didn't see the SDK certificate chain", group.id)
+		}
+		client.Close()
+		node.listener.Close()
+	}
+}
+
+func TestSecp256k1HandshakeUntrusted(t *testing.T) {
+	// A node of another chain.
+	node := newSecp256k1Node(t, loadTestChannelCerts(t, "other.crt", "other.key"), 23, "0x10")
+	defer node.listener.Close()
+	_, err := DialChannel(node.listener.Addr().String(), channelTestdata("ca.crt"), channelTestdata("sdk.crt"), channelTestdata("sdk.key"))
+	if err == nil || !strings.Contains(err.Error(), errTLSUnknownAuthority.Error()) {
+		t.Errorf("dialing a node of another chain: got error %v, want %v", err, errTLSUnknownAuthority)
+	}
+
+	// An SDK of another chain.
+	node = newSecp256k1Node(t, loadTestChannelCerts(t, "node.crt", "node.key"), 23, "0x10")
+	defer node.listener.Close()
+	if client, err := DialChannel(node.listener.Addr().String(), channelTestdata("ca.crt"), channelTestdata("other.crt"), channelTestdata("other.key")); err == nil {
+		client.Close()
+		t.Error("node accepted the certificate of another chain")
+	}
+	if err := <-node.errs; err != errTLSUnknownAuthority {
+		t.Errorf("node got error %v, want %v", err, errTLSUnknownAuthority)
+	}
+}
+
+func TestSecp256k1HandshakeCanceled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept, but never answer.
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	certs := loadTestChannelCerts(t, "sdk.crt", "sdk.key")
+	if _, err := (Secp256k1Handshaker{}).ClientHandshake(ctx, conn, certs); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestSecp256k1HandshakeOpenSSL checks the handshake against OpenSSL, which the
+// nodes use, if it's installed. Like the nodes, the server restricts the key
+// exchange to secp256k1; OpenSSL requires the curve of client certificates to be
+// among its groups.
+func TestSecp256k1HandshakeOpenSSL(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		// CI sets CHANNEL_TEST_OPENSSL so that this test can't pass unnoticed.
+		if os.Getenv("CHANNEL_TEST_OPENSSL") != "" {
+			t.Fatal("openssl not installed")
+		}
+		t.Skip("openssl not installed")
+	}
+	for _, cipher := range []string{"ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-ECDSA-AES256-GCM-SHA384"} {
+		if err := opensslHandshake(t, "-cipher", cipher, "-curves", "secp256k1"); err != nil {
+			t.Errorf("%s: %v", cipher, err)
+		}
+	}
+}
+
+// opensslHandshake connects to an openssl s_server, started with the node
+// certificate and the given options, and exchanges a line with it.
+func opensslHandshake(t *testing.T, opts ...string) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// s_server echoes the lines it receives reversed.
+	args := append([]string{"s_server", "-accept", addr, "-tls1_2", "-rev",
+		"-cert", channelTestdata("node.crt"), "-cert_chain", channelTestdata("node.crt"), "-key", channelTestdata("node.key"),
+		"-CAfile", channelTestdata("ca.crt"), "-Verify", "2"}, opts...)
+	cmd := exec.Command("openssl", args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	lines := bufio.NewScanner(out)
+	for lines.Scan() && lines.Text() != "ACCEPT" {
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tconn, err := (Secp256k1Handshaker{}).ClientHandshake(ctx, conn, loadTestChannelCerts(t, "sdk.crt", "sdk.key"))
+	if err != nil {
+		return fmt.Errorf("handshake error: %v", err)
+	}
+	tconn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := tconn.Write([]byte("channel\n")); err != nil {
+		return fmt.Errorf("write error: %v", err)
+	}
+	reply, err := bufio.NewReader(tconn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read error: %v", err)
+	}
+	if reply != "lennahc\n" {
+		return fmt.Errorf("got reply %q, want %q", reply, "lennahc\n")
+	}
+	return nil
+}
+
+// testIssuer issues certificates on P-256 for the chain verification tests.
+type testIssuer struct {
+	t      *testing.T
+	serial int64
+}
+
+// issue creates a certificate from template, issued by parent, or self-signed
+// if parent is nil.
+func (is *testIssuer) issue(template *x509.Certificate, parent *testCert) *testCert {
+	is.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		is.t.Fatal(err)
+	}
+	is.serial++
+	template.SerialNumber = big.NewInt(is.serial)
+	template.Subject = pkix.Name{CommonName: fmt.Sprintf("cert %d", is.serial)}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.template, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		is.t.Fatal(err)
+	}
+	return &testCert{template: template, key: key, der: der}
+}
+
+type testCert struct {
+	template *x509.Certificate
+	key      *ecdsa.PrivateKey
+	der      []byte
+}
+
+func caTemplate(maxPathLen int) *x509.Certificate {
+	return &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+}
+
+func leafTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+}
+
+// TestVerifyChannelChain checks the constraints on the issuers and the node
+// certificate of a chain.
+func TestVerifyChannelChain(t *testing.T) {
+	is := &testIssuer{t: t}
+	root := is.issue(caTemplate(-1), nil)
+	rootPathZero := is.issue(caTemplate(0), nil)
+	rootPathOne := is.issue(caTemplate(1), nil)
+	agency := is.issue(caTemplate(-1), root)
+	agencyPathZero := is.issue(caTemplate(0), root)
+	with := func(template *x509.Certificate, change func(*x509.Certificate)) *x509.Certificate {
+		change(template)
+		return template
+	}
+	nonCA := is.issue(leafTemplate(), root)
+	unconstrained := is.issue(with(leafTemplate(), func(c *x509.Certificate) { c.BasicConstraintsValid = false }), root)
+	signingOnlyCA := is.issue(with(caTemplate(-1), func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageDigitalSignature }), root)
+	clientCA := is.issue(with(caTemplate(-1), func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} }), root)
+	serverCA := is.issue(with(caTemplate(-1), func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth} }), root)
+
+	tests := []struct {
+		name  string
+		roots []*testCert
+		chain []*testCert // node certificate first, issued by the next one
+		err   string      // empty if the chain is valid
+	}{
+		{"issued by the root", []*testCert{root}, []*testCert{is.issue(leafTemplate(), root)}, ""},
+		{"through an agency", []*testCert{root}, []*testCert{is.issue(leafTemplate(), agency), agency}, ""},
+		{"agency sent first", []*testCert{root}, []*testCert{is.issue(leafTemplate(), agency), root, agency}, ""},
+		{"issued by a non-CA", []*testCert{root}, []*testCert{is.issue(leafTemplate(), nonCA), nonCA}, "not a CA"},
+		{"issued by a certificate without constraints", []*testCert{root}, []*testCert{is.issue(leafTemplate(), unconstrained), unconstrained}, "not a CA"},
+		{"issued by a non-CA root", []*testCert{nonCA}, []*testCert{is.issue(leafTemplate(), nonCA)}, "not a CA"},
+		{"root without path for an agency", []*testCert{rootPathZero}, []*testCert{is.issue(leafTemplate(), rootPathZero)}, ""},
+		{"root path length used up", []*testCert{rootPathZero}, func() []*testCert {
+			agency := is.issue(caTemplate(-1), rootPathZero)
+			return []*testCert{is.issue(leafTemplate(), agency), agency}
+		}(), "path length"},
+		{"root path length of one", []*testCert{rootPathOne}, func() []*testCert {
+			agency := is.issue(caTemplate(-1), rootPathOne)
+			return []*testCert{is.issue(leafTemplate(), agency), agency}
+		}(), ""},
+		{"root path length of one used up", []*testCert{rootPathOne}, func() []*testCert {
+			agency := is.issue(caTemplate(-1), rootPathOne)
+			sub := is.issue(caTemplate(-1), agency)
+			return []*testCert{is.issue(leafTemplate(), sub), sub, agency}
+		}(), "path length"},
+		{"agency path length used up", []*testCert{root}, func() []*testCert {
+			sub := is.issue(caTemplate(-1), agencyPathZero)
+			return []*testCert{is.issue(leafTemplate(), sub), sub, agencyPathZero}
+		}(), "path length"},
+		{"agency without certificate signing", []*testCert{root}, []*testCert{is.issue(leafTemplate(), signingOnlyCA), signingOnlyCA}, "signing certificates"},
+		{"agency for client authentication", []*testCert{root}, []*testCert{is.issue(leafTemplate(), clientCA), clientCA}, "server authentication"},
+		{"agency for server authentication", []*testCert{root}, []*testCert{is.issue(leafTemplate(), serverCA), serverCA}, ""},
+		{"node certificate not for signing", []*testCert{root}, []*testCert{
+			is.issue(with(leafTemplate(), func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageKeyEncipherment }), root),
+		}, "not valid for signing"},
+		{"node certificate for client authentication", []*testCert{root}, []*testCert{
+			is.issue(with(leafTemplate(), func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} }), root),
+		}, "server authentication"},
+		{"node certificate for any usage", []*testCert{root}, []*testCert{
+			is.issue(with(leafTemplate(), func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageAny} }), root),
+		}, ""},
+		{"unknown issuer", []*testCert{rootPathOne}, []*testCert{is.issue(leafTemplate(), root)}, errTLSUnknownAuthority.Error()},
+	}
+	parse := func(certs []*testCert) []*channelCert {
+		parsed := make([]*channelCert, len(certs))
+		for i, cert := range certs {
+			var err error
+			if parsed[i], err = parseChannelCert(cert.der); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return parsed
+	}
+	for _, test := range tests {
+		err := verifyChannelChain(parse(test.chain), parse(test.roots), time.Now())
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: error %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+// TestParseChannelCertExtensions checks that certificates with critical
+// extensions which aren't checked are rejected.
+func TestParseChannelCertExtensions(t *testing.T) {
+	is := &testIssuer{t: t}
+	root := is.issue(caTemplate(-1), nil)
+	unknown := asn1.ObjectIdentifier{1, 2, 3, 4}
+	tests := []struct {
+		name       string
+		extensions []pkix.Extension
+		ok         bool
+	}{
+		{"unknown extension", []pkix.Extension{{Id: unknown, Value: []byte{0x05, 0x00}}}, true},
+		{"unknown critical extension", []pkix.Extension{{Id: unknown, Critical: true, Value: []byte{0x05, 0x00}}}, false},
+		// Name constraints are not enforced.
+		{"critical name constraints", []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 30}, Critical: true, Value: []byte{0x30, 0x00}}}, false},
+	}
+	for _, test := range tests {
+		template := leafTemplate()
+		template.ExtraExtensions = test.extensions
+		cert := is.issue(template, root)
+		if _, err := parseChannelCert(cert.der); (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
@@ -19,12 +19,13 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -35,8 +36,13 @@ var (
 	ErrClientQuit                = errors.New("client is closed")
 	ErrNoResult                  = errors.New("no result in JSON-RPC response")
 	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
-	errClientReconnected         = errors.New("client reconnected")
-	errDead                      = errors.New("connection lost")
+
+	// ErrConnectionLost is returned for requests on a broken connection. The
+	// request may or may not have reached the node, it is safe to repeat reads.
+	ErrConnectionLost = errors.New("connection lost")
+
+	errClientReconnected = errors.New("client reconnected")
+	errDead              = ErrConnectionLost
 )
 
 const (
@@ -44,6 +50,14 @@ const (
 	tcpKeepAliveInterval = 30 * time.Second
 	defaultDialTimeout   = 10 * time.Second // used if context has no deadline
 	subscribeTimeout     = 5 * time.Second  // overall timeout eth_subscribe, rpc_modules calls
+
+	// Background redialing of channel connections
+	minRedialInterval = 100 * time.Millisecond
+	maxRedialInterval = 30 * time.Second
+
+	// channelCloseTimeout bounds the wait for the node to close its side of a
+	// channel connection when the client is closed
+	channelCloseTimeout = 2 * time.Second
 )
 
 const (
@@ -81,6 +95,9 @@ type Client struct {
 
 	idCounter uint32
 
+	metrics atomic.Value // metricsBox receiving measurements, see SetMetrics
+	wireLog atomic.Value // loggerBox receiving the wire log, see SetLogger
+
 	// This function, if non-nil, is called when the connection is lost.
 	reconnectFunc reconnectFunc
 
@@ -99,6 +116,22 @@ type Client struct {
 	reqInit     chan *requestOp  // register response IDs, takes write lock
 	reqSent     chan error       // signals write completion, releases write lock
 	reqTimeout  chan *requestOp  // removes response IDs when call timeout expires
+
+	// topics the channel connection is subscribed to, reported again on reconnect
+	topicMu sync.Mutex
+	topics  map[string]int
+
+	// channel protocol state, kept across reconnects
+	isChannel     bool
+	chanMu        sync.Mutex
+	chanConn      channelCodec                       // current connection, possibly broken
+	listeners     map[ChannelPack][]*channelListener // handlers of pushed messages
+	amopHandlers  map[string]AmopHandler             // handlers of subscribed AMOP topics
+	amopTopics    map[string]bool                    // topics set with UpdateTopics, replaced as a whole
+	topicsHandler AmopHandler                        // handler of amopTopics
+	chanLimits    atomic.Value                       // channelLimits of the connections
+	privateTopics map[string][]*ecdsa.PublicKey      // keys accepted by the private topics published
+	onReconnect   []*reconnectHook
 }
 
 type reconnectFunc func(ctx context.Context) (ServerCodec, error)
@@ -156,10 +189,11 @@ func (op *requestOp) wait(ctx context.Context, c *Client) (*jsonrpcMessage, erro
 
 // Dial creates a new client for the given URL.
 //
-// The currently supported URL schemes are "http", "https", "ws" and "wss". If rawurl is a
-// file name with no URL scheme, a local socket connection is established using UNIX
-// domain sockets on supported platforms and named pipes on Windows. If you want to
-// configure transport options, use DialHTTP, DialWebsocket or DialIPC instead.
+// The currently supported URL schemes are "http", "https", "ws" and "wss". A
+// scheme-less "host:port" is dialed over HTTP, see ParseEndpoint for the forms
+// accepted. Channel endpoints need the SDK certificates, use DialChannel for
+// them. If you want to configure transport options, use DialHTTP or
+// DialWebsocket instead.
 //
 // For websocket connections, the origin is set to the local host name.
 //
@@ -173,17 +207,24 @@ func Dial(rawurl string) (*Client, error) {
 // The context is used to cancel or time out the initial connection establishment. It does
 // not affect subsequent interactions with the client.
 func DialContext(ctx context.Context, rawurl string) (*Client, error) {
-	u, err := url.Parse(rawurl)
+	u, err := ParseEndpoint(rawurl)
 	if err != nil {
 		return nil, err
 	}
 	switch u.Scheme {
+	case "":
+		if u.Host == "" {
+			return nil, fmt.Errorf("no URL scheme or port in endpoint %q", rawurl)
+		}
+		return DialHTTP("http://" + u.Host)
 	case "http", "https":
 		return DialHTTP(rawurl)
 	case "ws", "wss":
 		return DialWebsocket(ctx, rawurl, "")
 	case "stdio":
 		return DialStdIO(ctx)
+	case "channel":
+		return nil, fmt.Errorf("channel endpoint %q needs the SDK certificates, see DialChannel", rawurl)
 	default:
 		return nil, fmt.Errorf("no known transport for URL scheme %q", u.Scheme)
 	}
@@ -223,6 +264,10 @@ func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *C
 		reqSent:     make(chan error, 1),
 		reqTimeout:  make(chan *requestOp),
 	}
+	if cc, ok := conn.(channelCodec); ok {
+		c.isChannel = true
+		c.setChannel(cc)
+	}
 	if !isHTTP {
 		go c.dispatch(conn)
 	}
@@ -252,9 +297,14 @@ func (c *Client) SupportedModules() (map[string]string, error) {
 	return result, err
 }
 
-// Close closes the client, aborting any in-flight requests.
+// Close closes the client. Requests still in flight, and those made afterwards,
+// fail with ErrClientQuit and subscriptions end with their error channel closed.
+// A channel connection is shut down gracefully: the node is told that no more
+// messages follow and replies already on their way are still delivered, for up
+// to two seconds. It is safe to call Close more than once.
 func (c *Client) Close() {
 	if c.isHTTP {
+		c.writeConn.(*httpConn).Close()
 		return
 	}
 	select {
@@ -264,6 +314,24 @@ func (c *Client) Close() {
 	}
 }
 
+// closed reports whether Close has been called.
+func (c *Client) closed() bool {
+	if c.isHTTP {
+		select {
+		case <-c.writeConn.(*httpConn).closed:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
 // Call performs a JSON-RPC call with the given arguments and unmarshals into
 // result if no error occurred.
 //
@@ -280,9 +348,25 @@ func (c *Client) Call(result interface{}, method string, args ...interface{}) er
 // The result must be a pointer so that package json can unmarshal into it. You
 // can also pass nil, in which case the result is ignored.
 func (c *Client) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	m, group := c.Metrics(), RequestGroup(args)
+	m.IncInflight(method, group)
+	start := time.Now()
+
+	size, err := c.callContext(ctx, result, method, args...)
+	dur := time.Since(start)
+	m.DecInflight(method, group)
+	m.ObserveRequest(method, group, dur, err)
+	if l := c.logger(); l != nil {
+		l.Debug("RPC call", "method", method, "params", logParams(args), "size", size, "duration", dur, "err", err)
+	}
+	return err
+}
+
+// callContext performs a call, returning the size of the response's result.
+func (c *Client) callContext(ctx context.Context, result interface{}, method string, args ...interface{}) (int, error) {
 	msg, err := c.newMessage(method, args...)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	op := &requestOp{ids: []json.RawMessage{msg.ID}, resp: make(chan *jsonrpcMessage, 1)}
 
@@ -294,20 +378,19 @@ func (c *Client) CallContext(ctx context.Context, result interface{}, method str
 		err = c.send(ctx, op, msg)
 	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// dispatch has accepted the request and will close the channel when it quits.
 	switch resp, err := op.wait(ctx, c); {
 	case err != nil:
-		return err
+		return 0, err
 	case resp.Error != nil:
-		return resp.Error
+		return 0, resp.Error
 	case len(resp.Result) == 0:
-		return ErrNoResult
+		return 0, ErrNoResult
 	default:
-
-		return json.Unmarshal(resp.Result, &result)
+		return len(resp.Result), json.Unmarshal(resp.Result, &result)
 	}
 }
 
@@ -333,6 +416,30 @@ func (c *Client) BatchCall(b []BatchElem) error {
 //
 // Note that batch calls may not be executed atomically on the server side.
 func (c *Client) BatchCallContext(ctx context.Context, b []BatchElem) error {
+	m := c.Metrics()
+	for _, elem := range b {
+		m.IncInflight(elem.Method, RequestGroup(elem.Args))
+	}
+	start := time.Now()
+
+	err := c.batchCallContext(ctx, b)
+	dur := time.Since(start)
+	l := c.logger()
+	for _, elem := range b {
+		group, elemErr := RequestGroup(elem.Args), err
+		if elemErr == nil {
+			elemErr = elem.Error
+		}
+		m.DecInflight(elem.Method, group)
+		m.ObserveRequest(elem.Method, group, dur, elemErr)
+		if l != nil {
+			l.Debug("RPC batch call", "method", elem.Method, "params", logParams(elem.Args), "duration", dur, "err", elemErr)
+		}
+	}
+	return err
+}
+
+func (c *Client) batchCallContext(ctx context.Context, b []BatchElem) error {
 	msgs := make([]*jsonrpcMessage, len(b))
 	op := &requestOp{
 		ids:  make([]json.RawMessage, len(b)),
@@ -509,6 +616,7 @@ func (c *Client) reconnect(ctx context.Context) error {
 		defer cancel()
 	}
 	newconn, err := c.reconnectFunc(ctx)
+	c.Metrics().ObserveReconnect(err)
 	if err != nil {
 		log.Trace("RPC client reconnect failed", "err", err)
 		return err
@@ -516,6 +624,15 @@ func (c *Client) reconnect(ctx context.Context) error {
 	select {
 	case c.reconnected <- newconn:
 		c.writeConn = newconn
+		if cc, ok := newconn.(channelCodec); ok {
+			c.setChannel(cc)
+			c.topicMu.Lock()
+			if c.hasTopics() {
+				c.reportTopics(ctx)
+			}
+			c.topicMu.Unlock()
+			go c.runReconnectHooks()
+		}
 		return nil
 	case <-c.didClose:
 		newconn.Close()
@@ -536,8 +653,14 @@ func (c *Client) dispatch(codec ServerCodec) {
 	defer func() {
 		close(c.closing)
 		if reading {
+			drained := false
+			if cc, ok := conn.codec.(channelCodec); ok {
+				drained = c.shutdownChannel(conn, cc)
+			}
 			conn.close(ErrClientQuit, nil)
-			c.drainRead()
+			if !drained {
+				c.drainRead()
+			}
 		}
 		close(c.didClose)
 	}()
@@ -562,6 +685,9 @@ func (c *Client) dispatch(codec ServerCodec) {
 			conn.handler.log.Debug("RPC connection read error", "err", err)
 			conn.close(err, lastOp)
 			reading = false
+			if c.isChannel {
+				go c.redial(conn.codec)
+			}
 
 		// Reconnect:
 		case newcodec := <-c.reconnected:
@@ -605,6 +731,32 @@ func (c *Client) dispatch(codec ServerCodec) {
 	}
 }
 
+// shutdownChannel ends a channel connection when the client is closed. It
+// half-closes the connection, so the node sees the end of the stream, and keeps
+// handling the messages read until the node closes its side or
+// channelCloseTimeout passes. It reports whether the read loop has exited.
+func (c *Client) shutdownChannel(conn *clientConn, cc channelCodec) bool {
+	if !cc.closeWrite() {
+		return false
+	}
+	timer := time.NewTimer(channelCloseTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case op := <-c.readOp:
+			if op.batch {
+				conn.handler.handleBatch(op.msgs)
+			} else {
+				conn.handler.handleMsg(op.msgs[0])
+			}
+		case <-c.readErr:
+			return true
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
 // drainRead drops read messages until an error occurs.
 func (c *Client) drainRead() {
 	for {
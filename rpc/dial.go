@@ -0,0 +1,94 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseEndpoint parses the address of a node. Besides URLs, it accepts the
+// scheme-less "host:port" operators give for channel ports, the host being a
+// name, an IPv4 address or an IPv6 address in brackets ("[2001:db8::1]:8545").
+// The URL returned for those has no scheme, only a host. The "channel" scheme
+// names a channel endpoint explicitly ("channel://host:port").
+//
+// IPv6 addresses without brackets are rejected, as is a host without port:
+// whether the last group of "2001:db8::1:8545" is a port can't be told.
+func ParseEndpoint(rawurl string) (*url.URL, error) {
+	if !strings.Contains(rawurl, "://") {
+		if host, port, err := net.SplitHostPort(rawurl); err == nil && port != "" {
+			if err := checkEndpointHost(rawurl, host, port); err != nil {
+				return nil, err
+			}
+			return &url.URL{Host: rawurl}, nil
+		}
+		if net.ParseIP(strings.Trim(rawurl, "[]")) != nil {
+			if strings.Count(rawurl, ":") > 1 && !strings.HasPrefix(rawurl, "[") {
+				return nil, fmt.Errorf("ambiguous endpoint %q: IPv6 addresses need brackets, as in \"[addr]:port\"", rawurl)
+			}
+			return nil, fmt.Errorf("missing port in endpoint %q", rawurl)
+		}
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return nil, fmt.Errorf("ambiguous endpoint %q: IPv6 addresses need brackets, as in \"[addr]:port\"", rawurl)
+	}
+	if u.Scheme == "channel" {
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid channel endpoint %q, want \"channel://host:port\"", rawurl)
+		}
+		if err := checkEndpointHost(rawurl, host, port); err != nil {
+			return nil, err
+		}
+		return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+	}
+	return u, nil
+}
+
+// checkEndpointHost checks the host and port of a host:port endpoint.
+func checkEndpointHost(rawurl, host, port string) error {
+	if host == "" {
+		return fmt.Errorf("missing host in endpoint %q", rawurl)
+	}
+	if strings.ContainsAny(host, "/?#@") {
+		return fmt.Errorf("invalid host in endpoint %q", rawurl)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("invalid port %q in endpoint %q", port, rawurl)
+	}
+	return nil
+}
+
+// channelAddress returns the "host:port" of a channel endpoint, given either as
+// such or as a "channel" URL.
+func channelAddress(endpoint string) (string, error) {
+	u, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" && u.Scheme != "channel" {
+		return "", fmt.Errorf("URL scheme %q isn't a channel endpoint, want \"host:port\"", u.Scheme)
+	}
+	return u.Host, nil
+}
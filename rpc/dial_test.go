@@ -0,0 +1,111 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		input  string
+		scheme string
+		host   string
+		err    bool
+	}{
+		{"192.168.1.10:20200", "", "192.168.1.10:20200", false},
+		{"node1.example.com:20200", "", "node1.example.com:20200", false},
+		{"[2001:db8::1]:8545", "", "[2001:db8::1]:8545", false},
+		{"channel://192.168.1.10:20200", "channel", "192.168.1.10:20200", false},
+		{"channel://[2001:db8::1]:20200/", "channel", "[2001:db8::1]:20200", false},
+		{"http://127.0.0.1:8545", "http", "127.0.0.1:8545", false},
+		{"http://[2001:db8::1]:8545/rpc", "http", "[2001:db8::1]:8545", false},
+		{"https://node1.example.com", "https", "node1.example.com", false},
+		{"ws://127.0.0.1:8546", "ws", "127.0.0.1:8546", false},
+
+		// Ambiguous or incomplete host:port endpoints
+		{"2001:db8::1:8545", "", "", true},
+		{"2001:db8::1", "", "", true},
+		{"[2001:db8::1]", "", "", true},
+		{"192.168.1.10", "", "", true},
+		{":20200", "", "", true},
+		{"192.168.1.10:0", "", "", true},
+		{"192.168.1.10:65536", "", "", true},
+		{"192.168.1.10:port", "", "", true},
+		{"http://2001:db8::1:8545", "", "", true},
+
+		// Malformed channel URLs
+		{"channel://192.168.1.10", "", "", true},
+		{"channel://:20200", "", "", true},
+		{"channel://user@192.168.1.10:20200", "", "", true},
+		{"channel://192.168.1.10:20200/path", "", "", true},
+		{"channel://192.168.1.10:20200?tls=1", "", "", true},
+		{"channel://192.168.1.10:20200#frag", "", "", true},
+		{"channel://2001:db8::1:20200", "", "", true},
+	}
+	for _, test := range tests {
+		u, err := ParseEndpoint(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: parsed to %v, want an error", test.input, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if u.Scheme != test.scheme || u.Host != test.host {
+			t.Errorf("%q: got scheme %q, host %q; want %q, %q", test.input, u.Scheme, u.Host, test.scheme, test.host)
+		}
+	}
+}
+
+func TestDialEndpoint(t *testing.T) {
+	tests := []struct {
+		input string
+		err   bool // whether DialChannel rejects it before connecting
+	}{
+		{"127.0.0.1:1", false},
+		{"channel://127.0.0.1:1", false},
+		{"http://127.0.0.1:1", true},
+		{"2001:db8::1:20200", true},
+	}
+	for _, test := range tests {
+		addr, err := channelAddress(test.input)
+		if test.err != (err != nil) {
+			t.Errorf("channelAddress(%q): got %q, error %v", test.input, addr, err)
+		} else if err == nil && addr != "127.0.0.1:1" {
+			t.Errorf("channelAddress(%q) = %q, want 127.0.0.1:1", test.input, addr)
+		}
+	}
+
+	// Dial takes host:port for HTTP and turns channel endpoints away.
+	if c, err := Dial("127.0.0.1:1"); err != nil {
+		t.Errorf("Dial(host:port) error: %v", err)
+	} else {
+		if !c.isHTTP {
+			t.Error("Dial(host:port) didn't use HTTP")
+		}
+		c.Close()
+	}
+	for _, endpoint := range []string{"channel://127.0.0.1:20200", "2001:db8::1:8545"} {
+		if _, err := Dial(endpoint); err == nil {
+			t.Errorf("Dial(%q) succeeded", endpoint)
+		}
+	}
+}
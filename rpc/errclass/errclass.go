@@ -0,0 +1,224 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package errclass classifies errors returned by FISCO BCOS nodes and the RPC
+// transports, so that retry and failover logic can decide whether an operation
+// is worth repeating.
+package errclass
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Category is the class an error belongs to.
+type Category int
+
+const (
+	Unknown      Category = iota // no rule matched the error
+	Retryable                    // transient failure, the same request may succeed later
+	Fatal                        // the request is malformed or rejected and must not be repeated
+	NotFound                     // the requested item does not exist (yet)
+	Unauthorized                 // the caller is not allowed to access the group or resource
+	Unsupported                  // the node doesn't implement the requested feature
+)
+
+func (c Category) String() string {
+	switch c {
+	case Retryable:
+		return "retryable"
+	case Fatal:
+		return "fatal"
+	case NotFound:
+		return "not found"
+	case Unauthorized:
+		return "unauthorized"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return "unknown"
+	}
+}
+
+// AnyCode can be passed to Register to match errors regardless of their code.
+const AnyCode = 0
+
+// Rule maps an error code and/or message fragment to a category. A rule with
+// Code set to AnyCode matches all codes, an empty Pattern matches all messages.
+// Patterns are matched case-insensitively as substrings of the error message.
+type Rule struct {
+	Code     int
+	Pattern  string
+	Category Category
+}
+
+func (r Rule) matches(code int, msg string) bool {
+	if r.Code != AnyCode && r.Code != code {
+		return false
+	}
+	return r.Pattern == "" || strings.Contains(msg, strings.ToLower(r.Pattern))
+}
+
+// Table is the curated list of known JSON-RPC and FISCO BCOS node errors.
+var Table = []Rule{
+	// JSON-RPC 2.0 standard errors
+	{Code: -32700, Category: Fatal},       // parse error
+	{Code: -32600, Category: Fatal},       // invalid request
+	{Code: -32601, Category: Unsupported}, // method not found
+	{Code: -32602, Category: Fatal},       // invalid params
+	{Code: -32603, Category: Retryable},   // internal error
+
+	// FISCO BCOS 2.x RPC errors
+	{Code: -40001, Category: NotFound},     // GroupID does not exist
+	{Code: -40002, Category: Fatal},        // response json parse error
+	{Code: -40003, Category: NotFound},     // BlockHash does not exist
+	{Code: -40004, Category: NotFound},     // BlockNumber does not exist
+	{Code: -40005, Category: NotFound},     // TransactionIndex is out of range
+	{Code: -40006, Category: Fatal},        // call needs a 'from' field
+	{Code: -40007, Category: Unsupported},  // only pbft consensus supports the view property
+	{Code: -40008, Category: Fatal},        // invalid system config
+	{Code: -40009, Category: Unauthorized}, // don't send requests to this group, the node doesn't belong to the group
+	{Code: -40010, Category: Retryable},    // RPC module initialization is incomplete
+	{Code: -40011, Category: Retryable},    // over QPS limit
+	{Code: -40012, Category: Unauthorized}, // the SDK is not allowed to access this group
+
+	// Transaction pool rejections reported with their status code
+	{Code: 0x05, Category: Fatal},      // invalid signature
+	{Code: 0x0f, Category: Fatal},      // nonce check fail
+	{Code: 0x10, Category: Fatal},      // block limit check fail
+	{Code: 0x1c, Category: Retryable},  // transaction pool is full
+	{Code: 10000, Category: Fatal},     // transaction already known
+	{Code: 10001, Category: Fatal},     // transaction already in chain
+	{Code: 10006, Category: Retryable}, // over group memory limit
+
+	// Transaction pool rejections reported through the message only, worded
+	// with and without spaces depending on the node version
+	{Pattern: "transaction pool is full", Category: Retryable},
+	{Pattern: "txpool is full", Category: Retryable},
+	{Pattern: "TxPoolIsFull", Category: Retryable},
+	{Pattern: "block limit", Category: Fatal},
+	{Pattern: "BlockLimitCheckFail", Category: Fatal},
+	{Pattern: "nonce check fail", Category: Fatal},
+	{Pattern: "NonceCheckFail", Category: Fatal},
+	{Pattern: "already known", Category: Fatal},
+	{Pattern: "AlreadyKnown", Category: Fatal},
+	{Pattern: "AlreadyInChain", Category: Fatal},
+	{Pattern: "invalid signature", Category: Fatal},
+	{Pattern: "InvalidSignature", Category: Fatal},
+
+	// Transport level failures
+	{Pattern: "connection lost", Category: Retryable},
+	{Pattern: "connection refused", Category: Retryable},
+	{Pattern: "connection reset", Category: Retryable},
+	{Pattern: "broken pipe", Category: Retryable},
+	{Pattern: "client is closed", Category: Fatal},
+	{Pattern: "notifications not supported", Category: Unsupported},
+	{Pattern: "doesn't provide this function", Category: Unsupported},
+	{Pattern: "not found", Category: NotFound},
+}
+
+var (
+	lock  sync.RWMutex
+	extra []Rule // user supplied rules, consulted before Table
+)
+
+// Register adds a user supplied rule. Registered rules take precedence over the
+// built-in Table, with the most recently registered rule winning.
+func Register(code int, pattern string, category Category) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	extra = append([]Rule{{Code: code, Pattern: pattern, Category: category}}, extra...)
+}
+
+// codedError is implemented by rpc.Error.
+type codedError interface {
+	ErrorCode() int
+}
+
+// Classify returns the category of err, or Unknown if no rule matched.
+func Classify(err error) Category {
+	if err == nil {
+		return Unknown
+	}
+	switch err {
+	case context.DeadlineExceeded, io.EOF, io.ErrUnexpectedEOF:
+		return Retryable
+	case context.Canceled:
+		return Fatal
+	}
+	code := AnyCode
+	if ce, ok := err.(codedError); ok {
+		code = ce.ErrorCode()
+	}
+	msg := strings.ToLower(err.Error())
+
+	lock.RLock()
+	for _, r := range extra {
+		if r.matches(code, msg) {
+			lock.RUnlock()
+			return r.Category
+		}
+	}
+	lock.RUnlock()
+
+	// Rules keyed by code are more specific than those matching the message only,
+	// so try the former first.
+	for _, r := range Table {
+		if r.Code != AnyCode && r.matches(code, msg) {
+			return r.Category
+		}
+	}
+	for _, r := range Table {
+		if r.Code == AnyCode && r.matches(code, msg) {
+			return r.Category
+		}
+	}
+	// Other network failures, such as the *url.Error of a failed HTTP request,
+	// mean the node couldn't be reached.
+	if _, ok := err.(net.Error); ok {
+		return Retryable
+	}
+	return Unknown
+}
+
+// IsRetryable reports whether the operation that failed with err may succeed if
+// it is repeated.
+func IsRetryable(err error) bool {
+	return Classify(err) == Retryable
+}
+
+// Backoff returns the exponential delay to wait before the given (zero based)
+// retry attempt, starting at base and capped at max. The boolean result is false
+// if the deadline of ctx expires before the delay does, in which case retrying is
+// pointless.
+func Backoff(ctx context.Context, attempt int, base, max time.Duration) (time.Duration, bool) {
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return delay, false
+	}
+	return delay, true
+}
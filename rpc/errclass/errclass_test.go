@@ -0,0 +1,82 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package errclass
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type codeError struct {
+	code int
+	msg  string
+}
+
+func (e *codeError) Error() string  { return e.msg }
+func (e *codeError) ErrorCode() int { return e.code }
+
+func TestClassify(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	tests := []struct {
+		err  error
+		want Category
+	}{
+		{nil, Unknown},
+		{errors.New("something else"), Unknown},
+		{io.EOF, Retryable},
+		{context.DeadlineExceeded, Retryable},
+		{context.Canceled, Fatal},
+		{refused, Retryable},
+		{&url.Error{Op: "Post", URL: "http://127.0.0.1:8545", Err: io.EOF}, Retryable},
+		{&url.Error{Op: "Post", URL: "http://127.0.0.1:8545", Err: refused}, Retryable},
+		{errors.New("connection lost: read tcp: use of closed network connection"), Retryable},
+		{errors.New("client is closed"), Fatal},
+		{&codeError{-32603, "internal error"}, Retryable},
+		{&codeError{-40011, "over QPS limit"}, Retryable},
+		{&codeError{-40009, "don't send requests to this group"}, Unauthorized},
+		{&codeError{-32602, "invalid params"}, Fatal},
+		{&codeError{-40004, "BlockNumber does not exist"}, NotFound},
+		{&codeError{-32000, "Transaction pool is full"}, Retryable},
+		{&codeError{-32000, "BlockLimitCheckFail"}, Fatal},
+		{&codeError{0x05, "InvalidSignature"}, Fatal},
+		{&codeError{0x0f, "NonceCheckFail"}, Fatal},
+		{&codeError{0x10, "BlockLimitCheckFail"}, Fatal},
+		{&codeError{0x1c, "TxPoolIsFull"}, Retryable},
+		{&codeError{10000, "AlreadyKnown"}, Fatal},
+		{&codeError{10001, "AlreadyInChain"}, Fatal},
+		{&codeError{10006, "OverGroupMemoryLimit"}, Retryable},
+		{&codeError{-32000, "TxPoolIsFull"}, Retryable},
+		{&codeError{-32000, "txpool is full"}, Retryable},
+		{&codeError{-32000, "Nonce check fail"}, Fatal},
+		{&codeError{-32000, "NonceCheckFail"}, Fatal},
+		{&codeError{-32000, "Transaction already known"}, Fatal},
+		{&codeError{-32000, "AlreadyInChain"}, Fatal},
+		{&codeError{-32000, "invalid signature"}, Fatal},
+		{&codeError{-32000, "InvalidSignature"}, Fatal},
+	}
+	for _, test := range tests {
+		if have := Classify(test.err); have != test.want {
+			t.Errorf("Classify(%v) = %v, want %v", test.err, have, test.want)
+		}
+	}
+}
@@ -43,6 +43,29 @@ const (
 // https://www.jsonrpc.org/historical/json-rpc-over-http.html#id13
 var acceptedContentTypes = []string{contentType, "application/json-rpc", "application/jsonrequest"}
 
+type headerKey struct{}
+
+// WithHeader returns a context carrying the header key with value, which the
+// HTTP transport adds to the requests made with it, e.g. a request id for a
+// proxy to trace calls by. Values set on the parent context are kept, except
+// for key, which is replaced. The channel transport has no place for headers
+// and drops them.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	parent, _ := ctx.Value(headerKey{}).(http.Header)
+	header := make(http.Header, len(parent)+1)
+	for k, v := range parent {
+		header[k] = v
+	}
+	header.Set(key, value)
+	return context.WithValue(ctx, headerKey{}, header)
+}
+
+// headerFromContext returns the headers set on ctx with WithHeader.
+func headerFromContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(headerKey{}).(http.Header)
+	return header
+}
+
 type httpConn struct {
 	client    *http.Client
 	req       *http.Request
@@ -127,6 +150,9 @@ func DialHTTP(endpoint string) (*Client, error) {
 
 func (c *Client) sendHTTP(ctx context.Context, op *requestOp, msg interface{}) error {
 	hc := c.writeConn.(*httpConn)
+	ctx, cancel := hc.withClose(ctx)
+	defer cancel()
+
 	respBody, err := hc.doRequest(ctx, msg)
 	//fmt.Println("[NEED TO REMOVE]:::", msg)
 	if respBody != nil {
@@ -139,39 +165,30 @@ func (c *Client) sendHTTP(ctx context.Context, op *requestOp, msg interface{}) e
 				return fmt.Errorf("%v %v", err, buf.String())
 			}
 		}
-		return err
+		return hc.closedErr(err)
 	}
 
 	var respmsg jsonrpcMessage
-	m := msg.(*jsonrpcMessage)
-	if m.Method == "call" {
-		var fmsg jsonrpcFiscoMsg
-		if err := json.NewDecoder(respBody).Decode(&fmsg); err != nil {
-			return err
-		}
-		respmsg.Version = fmsg.Jsonrpc
-		respmsg.ID = fmsg.ID
-		respmsg.Result = fmsg.Result.Output
-		op.resp <- &respmsg
-	} else {
-		if err := json.NewDecoder(respBody).Decode(&respmsg); err != nil {
-			return err
-		}
-		op.resp <- &respmsg
+	if err := json.NewDecoder(respBody).Decode(&respmsg); err != nil {
+		return hc.closedErr(err)
 	}
+	op.resp <- &respmsg
 	return nil
 }
 
 func (c *Client) sendBatchHTTP(ctx context.Context, op *requestOp, msgs []*jsonrpcMessage) error {
 	hc := c.writeConn.(*httpConn)
+	ctx, cancel := hc.withClose(ctx)
+	defer cancel()
+
 	respBody, err := hc.doRequest(ctx, msgs)
 	if err != nil {
-		return err
+		return hc.closedErr(err)
 	}
 	defer respBody.Close()
 	var respmsgs []jsonrpcMessage
 	if err := json.NewDecoder(respBody).Decode(&respmsgs); err != nil {
-		return err
+		return hc.closedErr(err)
 	}
 	for i := 0; i < len(respmsgs); i++ {
 		op.resp <- &respmsgs[i]
@@ -179,7 +196,37 @@ func (c *Client) sendBatchHTTP(ctx context.Context, op *requestOp, msgs []*jsonr
 	return nil
 }
 
+// withClose derives a context which is also canceled when the connection is
+// closed, so that Client.Close aborts the requests in flight.
+func (hc *httpConn) withClose(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-hc.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// closedErr replaces the failure of a request with ErrClientQuit if the
+// connection has been closed.
+func (hc *httpConn) closedErr(err error) error {
+	select {
+	case <-hc.closed:
+		return ErrClientQuit
+	default:
+		return err
+	}
+}
+
 func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadCloser, error) {
+	select {
+	case <-hc.closed:
+		return nil, ErrClientQuit
+	default:
+	}
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return nil, err
@@ -187,6 +234,16 @@ func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadClos
 	result := make(map[string]interface{})
 	json.Unmarshal(body, &result)
 	req := hc.req.WithContext(ctx)
+	if extra := headerFromContext(ctx); len(extra) > 0 {
+		// The copy shares the header with the template request.
+		req.Header = make(http.Header, len(hc.req.Header)+len(extra))
+		for k, v := range hc.req.Header {
+			req.Header[k] = v
+		}
+		for k, v := range extra {
+			req.Header[k] = v
+		}
+	}
 	req.Body = ioutil.NopCloser(bytes.NewReader(body))
 	req.ContentLength = int64(len(body))
 	resp, err := hc.client.Do(req)
@@ -0,0 +1,166 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// headerServer is an HTTP JSON-RPC server answering every call with its method
+// name and recording the headers of the requests it gets.
+type headerServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	headers map[string]http.Header // by method of the call
+}
+
+func newHeaderServer(t *testing.T) *headerServer {
+	s := &headerServer{headers: make(map[string]http.Header)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		batch := len(body) > 0 && body[0] == '['
+		var msgs []*jsonrpcMessage
+		if !batch {
+			body = append(append([]byte{'['}, body...), ']')
+		}
+		if err := json.Unmarshal(body, &msgs); err != nil {
+			t.Errorf("invalid request %s: %v", body, err)
+			return
+		}
+		for _, msg := range msgs {
+			s.mu.Lock()
+			s.headers[msg.Method] = r.Header
+			s.mu.Unlock()
+			msg.Result, _ = json.Marshal(msg.Method)
+			msg.Method, msg.Params = "", nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if batch {
+			json.NewEncoder(w).Encode(msgs)
+		} else {
+			json.NewEncoder(w).Encode(msgs[0])
+		}
+	}))
+	return s
+}
+
+// header returns the headers of the request that carried the call of method.
+func (s *headerServer) header(method string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[method]
+}
+
+func TestWithHeader(t *testing.T) {
+	server := newHeaderServer(t)
+	defer server.Close()
+	client, err := DialHTTP(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	parent := WithHeader(context.Background(), "X-Request-ID", "parent")
+	child := WithHeader(WithHeader(parent, "X-Request-ID", "child"), "X-Trace", "t1")
+	calls := []struct {
+		method string
+		ctx    context.Context
+		want   map[string]string // "" for a header that must be missing
+	}{
+		{"withParent", parent, map[string]string{"X-Request-ID": "parent", "X-Trace": ""}},
+		{"withChild", child, map[string]string{"X-Request-ID": "child", "X-Trace": "t1"}},
+		{"unrelated", context.Background(), map[string]string{"X-Request-ID": "", "X-Trace": ""}},
+		{"parentAgain", parent, map[string]string{"X-Request-ID": "parent", "X-Trace": ""}},
+	}
+	for _, call := range calls {
+		var result string
+		if err := client.CallContext(call.ctx, &result, call.method); err != nil {
+			t.Fatalf("%s: call error: %v", call.method, err)
+		}
+		header := server.header(call.method)
+		for key, want := range call.want {
+			if have := header.Get(key); have != want {
+				t.Errorf("%s: header %s is %q, want %q", call.method, key, have, want)
+			}
+		}
+		if ct := header.Get("Content-Type"); ct != contentType {
+			t.Errorf("%s: Content-Type %q, want %q", call.method, ct, contentType)
+		}
+	}
+
+	batch := []BatchElem{{Method: "batchA", Result: new(string)}, {Method: "batchB", Result: new(string)}}
+	if err := client.BatchCallContext(child, batch); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+	if have := server.header("batchA").Get("X-Request-ID"); have != "child" {
+		t.Errorf("batch sent with X-Request-ID %q, want child", have)
+	}
+	if err := client.BatchCallContext(context.Background(), []BatchElem{{Method: "batchC", Result: new(string)}}); err != nil {
+		t.Fatalf("batch error: %v", err)
+	}
+	if have := server.header("batchC").Get("X-Request-ID"); have != "" {
+		t.Errorf("batch with an unrelated context sent with X-Request-ID %q", have)
+	}
+}
+
+// TestWithHeaderConcurrent makes calls with different request ids at once,
+// checking that each request carries its own.
+func TestWithHeaderConcurrent(t *testing.T) {
+	server := newHeaderServer(t)
+	defer server.Close()
+	client, err := DialHTTP(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			method, id := fmt.Sprintf("call%d", i), fmt.Sprintf("id-%d", i)
+			ctx := context.Background()
+			if i%2 == 0 {
+				ctx = WithHeader(ctx, "X-Request-ID", id)
+			} else {
+				id = ""
+			}
+			var result string
+			if err := client.CallContext(ctx, &result, method); err != nil {
+				t.Errorf("%s: call error: %v", method, err)
+				return
+			}
+			if have := server.header(method).Get("X-Request-ID"); have != id {
+				t.Errorf("%s: sent with X-Request-ID %q, want %q", method, have, id)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -65,41 +65,6 @@ type jsonrpcMessageArray struct {
 	Result  []string        `json:"result"`
 }
 
-type jsonrpcFiscoMsg struct {
-	ID      json.RawMessage `json:"id,omitempty"`
-	Jsonrpc string          `json:"jsonrpc"`
-	Result  struct {
-		CurrentBlockNumber string          `json:"currentBlockNumber,omitempty"`
-		Output             json.RawMessage `json:"output,omitempty"`
-		Status             string          `json:"status,omitempty"`
-		ExtraData          []interface{}   `json:"extraData"`
-		GasLimit           string          `json:"gasLimit"`
-		GasUsed            string          `json:"gasUsed"`
-		Hash               string          `json:"hash"`
-		LogsBloom          string          `json:"logsBloom"`
-		Number             string          `json:"number"`
-		ParentHash         string          `json:"parentHash"`
-		Sealer             string          `json:"sealer"`
-		SealerList         []string        `json:"sealerList"`
-		StateRoot          string          `json:"stateRoot"`
-		Timestamp          string          `json:"timestamp"`
-		Transactions       []struct {
-			BlockHash        string      `json:"blockHash"`
-			BlockNumber      string      `json:"blockNumber"`
-			From             string      `json:"from"`
-			Gas              string      `json:"gas"`
-			GasPrice         string      `json:"gasPrice"`
-			Hash             string      `json:"hash"`
-			Input            string      `json:"input"`
-			Nonce            string      `json:"nonce"`
-			To               interface{} `json:"to"`
-			TransactionIndex string      `json:"transactionIndex"`
-			Value            string      `json:"value"`
-		} `json:"transactions"`
-		TransactionsRoot string `json:"transactionsRoot"`
-	} `json:"result"`
-}
-
 func (msg *jsonrpcMessage) isNotification() bool {
 	return msg.ID == nil && msg.Method != ""
 }
@@ -0,0 +1,112 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/common/hexutil"
+)
+
+// Metrics receives measurements of the traffic of a client. Implementations
+// must be safe for concurrent use and shouldn't block, they are called on the
+// paths of the requests they measure. Embed NopMetrics to implement a subset.
+//
+// Requests are named by their JSON-RPC method. Typed channel messages, like AMOP
+// requests and heartbeats, are named by ChannelMethod. The group is taken from
+// the first parameter of the request, it's 0 for requests which don't target a
+// group.
+type Metrics interface {
+	// ObserveRequest is called when a request completes, err is its failure.
+	ObserveRequest(method string, groupId uint64, dur time.Duration, err error)
+	// IncInflight and DecInflight are called when a request starts and ends.
+	IncInflight(method string, groupId uint64)
+	DecInflight(method string, groupId uint64)
+	// ObserveReconnect is called after every attempt to re-establish a broken
+	// connection, err is its failure.
+	ObserveReconnect(err error)
+	// ObservePush is called after a message pushed by the node was handled.
+	ObservePush(typ ChannelPack, dur time.Duration)
+	// ObserveRetry is called before a failed request is repeated.
+	ObserveRetry(method string, groupId uint64, err error)
+}
+
+// NopMetrics is a Metrics discarding all measurements, the default of clients.
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveRequest(string, uint64, time.Duration, error) {}
+func (NopMetrics) IncInflight(string, uint64)                          {}
+func (NopMetrics) DecInflight(string, uint64)                          {}
+func (NopMetrics) ObserveReconnect(error)                              {}
+func (NopMetrics) ObservePush(ChannelPack, time.Duration)              {}
+func (NopMetrics) ObserveRetry(string, uint64, error)                  {}
+
+// metricsBox wraps the Metrics of a client, atomic.Value needs a consistent
+// concrete type.
+type metricsBox struct {
+	m Metrics
+}
+
+// SetMetrics sets the receiver of the client's measurements. nil restores the
+// default, NopMetrics.
+func (c *Client) SetMetrics(m Metrics) {
+	if m == nil {
+		m = NopMetrics{}
+	}
+	c.metrics.Store(metricsBox{m})
+}
+
+// Metrics returns the receiver of the client's measurements.
+func (c *Client) Metrics() Metrics {
+	if box, ok := c.metrics.Load().(metricsBox); ok {
+		return box.m
+	}
+	return NopMetrics{}
+}
+
+// ChannelMethod names typed channel messages of the given type in Metrics,
+// e.g. "channel_0x30" for AMOP requests.
+func ChannelMethod(typ ChannelPack) string {
+	return fmt.Sprintf("channel_%#x", int(typ))
+}
+
+// RequestGroup returns the group targeted by a request, the first parameter of
+// FISCO BCOS methods, or 0 if the request doesn't name one.
+func RequestGroup(args []interface{}) uint64 {
+	if len(args) == 0 {
+		return 0
+	}
+	switch group := args[0].(type) {
+	case uint64:
+		return group
+	case int:
+		if group > 0 {
+			return uint64(group)
+		}
+	case uint:
+		return uint64(group)
+	case hexutil.Uint64:
+		return uint64(group)
+	case *big.Int:
+		if group != nil && group.IsUint64() {
+			return group.Uint64()
+		}
+	}
+	return 0
+}
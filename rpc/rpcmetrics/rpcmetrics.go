@@ -0,0 +1,98 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package rpcmetrics records the measurements of RPC clients into a go-metrics
+// registry, which the metrics/prometheus package serves in the Prometheus text
+// format. Neither the rpc package nor this one depend on the Prometheus client
+// library.
+//
+// Like all metrics of the library, the measurements are only recorded if
+// metrics.Enabled is set before the recorder is used.
+//
+//	client.SetMetrics(rpcmetrics.New(metrics.DefaultRegistry))
+//	http.Handle("/metrics", prometheus.Handler(metrics.DefaultRegistry))
+package rpcmetrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/metrics"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// Recorder implements rpc.Metrics on top of a go-metrics registry. The metrics
+// are named after the method and group of the requests:
+//
+//	rpc/client/requests/<method>/group<id>  timer of the completed requests
+//	rpc/client/failures/<method>/group<id>  counter of the failed requests
+//	rpc/client/inflight/<method>/group<id>  counter of the requests in flight
+//	rpc/client/retries/<method>/group<id>   counter of the repeated requests
+//	rpc/client/pushes/<type>                timer of the handled pushed messages
+//	rpc/client/reconnects                   counter of the reconnect attempts
+//	rpc/client/reconnects/failed            counter of the failed attempts
+type Recorder struct {
+	reg metrics.Registry
+}
+
+// New returns a recorder registering its metrics in reg, or in the default
+// registry if reg is nil.
+func New(reg metrics.Registry) *Recorder {
+	if reg == nil {
+		reg = metrics.DefaultRegistry
+	}
+	return &Recorder{reg: reg}
+}
+
+func requestName(kind, method string, groupId uint64) string {
+	return fmt.Sprintf("rpc/client/%s/%s/group%d", kind, method, groupId)
+}
+
+// ObserveRequest implements rpc.Metrics.
+func (r *Recorder) ObserveRequest(method string, groupId uint64, dur time.Duration, err error) {
+	metrics.GetOrRegisterTimer(requestName("requests", method, groupId), r.reg).Update(dur)
+	if err != nil {
+		metrics.GetOrRegisterCounter(requestName("failures", method, groupId), r.reg).Inc(1)
+	}
+}
+
+// IncInflight implements rpc.Metrics.
+func (r *Recorder) IncInflight(method string, groupId uint64) {
+	metrics.GetOrRegisterCounter(requestName("inflight", method, groupId), r.reg).Inc(1)
+}
+
+// DecInflight implements rpc.Metrics.
+func (r *Recorder) DecInflight(method string, groupId uint64) {
+	metrics.GetOrRegisterCounter(requestName("inflight", method, groupId), r.reg).Dec(1)
+}
+
+// ObserveReconnect implements rpc.Metrics.
+func (r *Recorder) ObserveReconnect(err error) {
+	metrics.GetOrRegisterCounter("rpc/client/reconnects", r.reg).Inc(1)
+	if err != nil {
+		metrics.GetOrRegisterCounter("rpc/client/reconnects/failed", r.reg).Inc(1)
+	}
+}
+
+// ObservePush implements rpc.Metrics.
+func (r *Recorder) ObservePush(typ rpc.ChannelPack, dur time.Duration) {
+	metrics.GetOrRegisterTimer(fmt.Sprintf("rpc/client/pushes/%#x", int(typ)), r.reg).Update(dur)
+}
+
+// ObserveRetry implements rpc.Metrics.
+func (r *Recorder) ObserveRetry(method string, groupId uint64, err error) {
+	metrics.GetOrRegisterCounter(requestName("retries", method, groupId), r.reg).Inc(1)
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpcmetrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chislab/go-fiscobcos/metrics"
+	"github.com/chislab/go-fiscobcos/metrics/prometheus"
+	"github.com/chislab/go-fiscobcos/rpc"
+)
+
+// enableMetrics turns metrics on for a test, returning the function restoring
+// the previous setting.
+func enableMetrics() func() {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	return func() { metrics.Enabled = enabled }
+}
+
+var errTest = errors.New("node unreachable")
+
+func TestRecorder(t *testing.T) {
+	defer enableMetrics()()
+
+	reg := metrics.NewRegistry()
+	r := New(reg)
+	r.IncInflight("getBlockNumber", 1)
+	r.IncInflight("getBlockNumber", 1)
+	r.DecInflight("getBlockNumber", 1)
+	r.ObserveRequest("getBlockNumber", 1, 10*time.Millisecond, nil)
+	r.ObserveRequest("getBlockNumber", 1, 30*time.Millisecond, errTest)
+	r.ObserveRequest("getBlockNumber", 2, time.Millisecond, nil)
+	r.ObserveRetry("getBlockNumber", 1, errTest)
+	r.ObserveReconnect(nil)
+	r.ObserveReconnect(errTest)
+	r.ObservePush(rpc.TYPE_TX_BLOCKNUM, time.Millisecond)
+
+	counters := []struct {
+		name string
+		want int64
+	}{
+		{"rpc/client/inflight/getBlockNumber/group1", 1},
+		{"rpc/client/failures/getBlockNumber/group1", 1},
+		{"rpc/client/retries/getBlockNumber/group1", 1},
+		{"rpc/client/reconnects", 2},
+		{"rpc/client/reconnects/failed", 1},
+	}
+	for _, c := range counters {
+		counter, ok := reg.Get(c.name).(metrics.Counter)
+		if !ok {
+			t.Errorf("counter %s not registered", c.name)
+			continue
+		}
+		if n := counter.Count(); n != c.want {
+			t.Errorf("counter %s = %d, want %d", c.name, n, c.want)
+		}
+	}
+	timers := []struct {
+		name     string
+		count    int64
+		min, max time.Duration
+	}{
+		{"rpc/client/requests/getBlockNumber/group1", 2, 10 * time.Millisecond, 30 * time.Millisecond},
+		{"rpc/client/requests/getBlockNumber/group2", 1, time.Millisecond, time.Millisecond},
+		{"rpc/client/pushes/0x1001", 1, time.Millisecond, time.Millisecond},
+	}
+	for _, tm := range timers {
+		timer, ok := reg.Get(tm.name).(metrics.Timer)
+		if !ok {
+			t.Errorf("timer %s not registered", tm.name)
+			continue
+		}
+		if n := timer.Count(); n != tm.count {
+			t.Errorf("timer %s count = %d, want %d", tm.name, n, tm.count)
+		}
+		if min, max := time.Duration(timer.Min()), time.Duration(timer.Max()); min != tm.min || max != tm.max {
+			t.Errorf("timer %s range = [%v, %v], want [%v, %v]", tm.name, min, max, tm.min, tm.max)
+		}
+	}
+	if reg.Get("rpc/client/failures/getBlockNumber/group2") != nil {
+		t.Error("failure counter registered for a group without failures")
+	}
+}
+
+func TestRecorderDisabled(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = false
+	defer func() { metrics.Enabled = enabled }()
+
+	reg := metrics.NewRegistry()
+	New(reg).ObserveRequest("getBlockNumber", 1, time.Millisecond, errTest)
+	if n := metrics.GetOrRegisterCounter("rpc/client/failures/getBlockNumber/group1", reg).Count(); n != 0 {
+		t.Errorf("disabled metrics recorded %d failures", n)
+	}
+}
+
+type testService struct{}
+
+func (testService) Echo(group uint64, s string) string { return s }
+
+func (testService) Fail(group uint64) error { return errTest }
+
+// TestRecorderClient records the requests of a client and serves them in the
+// Prometheus format.
+func TestRecorderClient(t *testing.T) {
+	defer enableMetrics()()
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("test", testService{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+	reg := metrics.NewRegistry()
+	client.SetMetrics(New(reg))
+
+	var s string
+	for i := 0; i < 3; i++ {
+		if err := client.Call(&s, "test_echo", uint64(1), "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Call(nil, "test_fail", uint64(2)); err == nil {
+		t.Fatal("test_fail succeeded")
+	}
+	batch := []rpc.BatchElem{
+		{Method: "test_echo", Args: []interface{}{uint64(2), "y"}, Result: &s},
+		{Method: "test_fail", Args: []interface{}{uint64(2)}},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(prometheus.Handler(reg))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"rpc_client_requests_test_echo_group1_count 3\n",
+		"rpc_client_requests_test_echo_group2_count 1\n",
+		"rpc_client_requests_test_fail_group2_count 2\n",
+		"rpc_client_failures_test_fail_group2 2\n",
+		"rpc_client_inflight_test_echo_group1 0\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "failures_test_echo") {
+		t.Errorf("failures recorded for test_echo:\n%s", body)
+	}
+}
@@ -230,10 +230,11 @@ func newClientSubscription(c *Client, namespace string, channel reflect.Value) *
 // resubscription when the client connection is closed unexpectedly.
 //
 // The error channel receives a value when the subscription has ended due
-// to an error. The received error is nil if Close has been called
-// on the underlying client and no other error has occurred.
+// to an error.
 //
-// The error channel is closed when Unsubscribe is called on the subscription.
+// The error channel is closed when Unsubscribe is called on the subscription,
+// or when Close is called on the underlying client and no other error has
+// occurred.
 func (sub *ClientSubscription) Err() <-chan error {
 	return sub.err
 }
@@ -254,10 +255,10 @@ func (sub *ClientSubscription) quitWithError(err error, unsubscribeServer bool)
 		if unsubscribeServer {
 			sub.requestUnsubscribe()
 		}
-		if err != nil {
-			if err == ErrClientQuit {
-				err = nil // Adhere to subscription semantics.
-			}
+		if err == ErrClientQuit {
+			// Adhere to subscription semantics, end like Unsubscribe.
+			sub.errOnce.Do(func() { close(sub.err) })
+		} else if err != nil {
 			sub.err <- err
 		}
 	})
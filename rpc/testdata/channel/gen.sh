@@ -0,0 +1,46 @@
+#!/bin/bash
+# Generates the channel certificates of the tests like FISCO BCOS's
+# build_chain.sh does on non-guomi chains: an RSA chain CA and agency, issuing
+# node and sdk certificates on secp256k1. other.crt and other.key are a node
+# certificate issued by another chain.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+cat > "$tmp/cert.cnf" <<CNF
+[ v3_req ]
+basicConstraints = CA:FALSE
+keyUsage = nonRepudiation, digitalSignature, keyEncipherment
+[ v4_req ]
+basicConstraints = CA:TRUE
+CNF
+
+# chain <name> <dir>: CA and agency of a chain.
+chain() {
+    openssl genrsa -out "$2/ca.key" 2048
+    openssl req -new -x509 -days 36500 -subj "/CN=$1/O=fisco-bcos/OU=chain" -key "$2/ca.key" -out "$2/ca.crt"
+    openssl genrsa -out "$2/agency.key" 2048
+    openssl req -new -sha256 -subj "/CN=agency/O=fisco-bcos/OU=agency" -key "$2/agency.key" -out "$2/agency.csr"
+    openssl x509 -req -days 36500 -sha256 -CA "$2/ca.crt" -CAkey "$2/ca.key" -CAcreateserial \
+        -in "$2/agency.csr" -out "$2/agency.crt" -extensions v4_req -extfile "$tmp/cert.cnf"
+}
+
+# leaf <name> <dir> <out>: secp256k1 certificate issued by the agency of dir,
+# followed by the agency certificate.
+leaf() {
+    openssl ecparam -out "$tmp/secp256k1.param" -name secp256k1
+    openssl genpkey -paramfile "$tmp/secp256k1.param" -out "$3.key"
+    openssl req -new -sha256 -subj "/CN=$1/O=fisco-bcos/OU=$1" -key "$3.key" -out "$tmp/$1.csr"
+    openssl x509 -req -days 36500 -sha256 -CA "$2/agency.crt" -CAkey "$2/agency.key" -CAcreateserial \
+        -in "$tmp/$1.csr" -out "$3.crt" -extensions v3_req -extfile "$tmp/cert.cnf"
+    cat "$2/agency.crt" >> "$3.crt"
+}
+
+mkdir "$tmp/chain" "$tmp/other"
+chain chain "$tmp/chain"
+chain other "$tmp/other"
+cp "$tmp/chain/ca.crt" ca.crt
+leaf node "$tmp/chain" node
+leaf sdk "$tmp/chain" sdk
+leaf node "$tmp/other" other
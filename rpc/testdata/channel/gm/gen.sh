@@ -0,0 +1,40 @@
+#!/bin/bash
+# Generates the channel certificates of guomi chains like FISCO BCOS's
+# build_chain.sh -g does: an SM2 chain CA and agency, issuing the sdk a signing
+# certificate (gmsdk.crt) and an encryption certificate (gmensdk.crt). Needs
+# OpenSSL 1.1.1 or later for SM2 and SM3.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+cat > "$tmp/cert.cnf" <<CNF
+[ v3_req ]
+basicConstraints = CA:FALSE
+keyUsage = nonRepudiation, digitalSignature
+[ v3enc_req ]
+basicConstraints = CA:FALSE
+keyUsage = keyAgreement, keyEncipherment, dataEncipherment
+[ v4_req ]
+basicConstraints = CA:TRUE
+CNF
+
+openssl ecparam -name SM2 -genkey -noout -out "$tmp/gmca.key"
+openssl req -new -x509 -sm3 -days 36500 -subj "/CN=chain/O=fisco-bcos/OU=chain" -key "$tmp/gmca.key" -out gmca.crt
+openssl ecparam -name SM2 -genkey -noout -out "$tmp/gmagency.key"
+openssl req -new -sm3 -subj "/CN=agency/O=fisco-bcos/OU=agency" -key "$tmp/gmagency.key" -out "$tmp/gmagency.csr"
+openssl x509 -req -sm3 -days 36500 -CA gmca.crt -CAkey "$tmp/gmca.key" -CAcreateserial -CAserial "$tmp/gmca.srl" \
+    -in "$tmp/gmagency.csr" -out "$tmp/gmagency.crt" -extensions v4_req -extfile "$tmp/cert.cnf"
+
+# leaf <out> <extensions>: SM2 certificate of the sdk issued by the agency,
+# followed by the agency certificate.
+leaf() {
+    openssl ecparam -name SM2 -genkey -noout -out "$1.key"
+    openssl req -new -sm3 -subj "/CN=sdk/O=fisco-bcos/OU=sdk" -key "$1.key" -out "$tmp/$1.csr"
+    openssl x509 -req -sm3 -days 36500 -CA "$tmp/gmagency.crt" -CAkey "$tmp/gmagency.key" -CAcreateserial \
+        -CAserial "$tmp/gmagency.srl" -in "$tmp/$1.csr" -out "$1.crt" -extensions "$2" -extfile "$tmp/cert.cnf"
+    cat "$tmp/gmagency.crt" >> "$1.crt"
+}
+
+leaf gmsdk v3_req
+leaf gmensdk v3enc_req
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/big"
 	"strings"
 
 	"github.com/chislab/go-fiscobcos/common/hexutil"
@@ -105,3 +106,32 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 func (bn BlockNumber) Int64() int64 {
 	return (int64)(bn)
 }
+
+// Big returns the block number as a *big.Int, for the client methods taking
+// one. The tags are negative, like the constants.
+func (bn BlockNumber) Big() *big.Int {
+	return big.NewInt(int64(bn))
+}
+
+// String returns "latest" or "pending" for the tags and the hex quantity of
+// other block numbers.
+func (bn BlockNumber) String() string {
+	switch bn {
+	case LatestBlockNumber:
+		return "latest"
+	case PendingBlockNumber:
+		return "pending"
+	}
+	if bn < 0 {
+		return fmt.Sprintf("<invalid %d>", int64(bn))
+	}
+	return hexutil.EncodeUint64(uint64(bn))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (bn BlockNumber) MarshalText() ([]byte, error) {
+	if bn < PendingBlockNumber {
+		return nil, fmt.Errorf("invalid block number %d", int64(bn))
+	}
+	return []byte(bn.String()), nil
+}
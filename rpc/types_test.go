@@ -0,0 +1,71 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBlockNumberJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  BlockNumber
+		err   bool
+	}{
+		{`"latest"`, LatestBlockNumber, false},
+		{`"pending"`, PendingBlockNumber, false},
+		{`"earliest"`, EarliestBlockNumber, false},
+		{`"0x0"`, 0, false},
+		{`"0x64"`, 100, false},
+		{`"0x7fffffffffffffff"`, 1<<63 - 1, false},
+		{`"0x8000000000000000"`, 0, true},
+		{`"100"`, 0, true},
+		{`"0x"`, 0, true},
+		{`"0x064"`, 0, true},
+		{`"first"`, 0, true},
+	}
+	for _, test := range tests {
+		var bn BlockNumber
+		err := json.Unmarshal([]byte(test.input), &bn)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: decoded %d, want error", test.input, bn)
+			}
+			continue
+		}
+		if err != nil || bn != test.want {
+			t.Errorf("%s: decoded %d, %v, want %d", test.input, bn, err, test.want)
+		}
+		// Tags and numbers encode back to the same JSON, except the
+		// earliest block, which is block 0.
+		enc, err := json.Marshal(bn)
+		want := test.input
+		if test.input == `"earliest"` {
+			want = `"0x0"`
+		}
+		if err != nil || string(enc) != want {
+			t.Errorf("%s: encoded as %s, %v, want %s", test.input, enc, err, want)
+		}
+		if bn.Big().Int64() != int64(bn) {
+			t.Errorf("%s: Big %v, want %d", test.input, bn.Big(), int64(bn))
+		}
+	}
+	if _, err := json.Marshal(BlockNumber(-3)); err == nil {
+		t.Error("encoded an invalid block number")
+	}
+}
@@ -174,10 +174,24 @@ func wsGetConfig(endpoint, origin string) (*websocket.Config, error) {
 // The context is used for the initial connection establishment. It does not
 // affect subsequent interactions with the client.
 func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
+	return DialWebsocketWithConfig(ctx, endpoint, origin, nil, nil)
+}
+
+// DialWebsocketWithConfig is like DialWebsocket, adding the given headers to the
+// handshake request and using tlsConfig, if not nil, for "wss" endpoints.
+func DialWebsocketWithConfig(ctx context.Context, endpoint, origin string, header http.Header, tlsConfig *tls.Config) (*Client, error) {
 	config, err := wsGetConfig(endpoint, origin)
 	if err != nil {
 		return nil, err
 	}
+	for key, values := range header {
+		for _, value := range values {
+			config.Header.Add(key, value)
+		}
+	}
+	if tlsConfig != nil {
+		config.TlsConfig = tlsConfig
+	}
 
 	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
 		conn, err := wsDialContext(ctx, config)
@@ -193,7 +207,7 @@ func wsDialContext(ctx context.Context, config *websocket.Config) (*websocket.Co
 	var err error
 	switch config.Location.Scheme {
 	case "ws":
-		conn, err = dialContext(ctx, "tcp", wsDialAddress(config.Location))
+		conn, err = contextDialer(ctx).DialContext(ctx, "tcp", wsDialAddress(config.Location))
 	case "wss":
 		dialer := contextDialer(ctx)
 		conn, err = tls.DialWithDialer(dialer, "tcp", wsDialAddress(config.Location), config.TlsConfig)
@@ -203,11 +217,14 @@ func wsDialContext(ctx context.Context, config *websocket.Config) (*websocket.Co
 	if err != nil {
 		return nil, err
 	}
+	// The handshake doesn't watch ctx, bound it by the dial deadline instead.
+	conn.SetDeadline(dialDeadline(ctx))
 	ws, err := websocket.NewClient(config, conn)
 	if err != nil {
 		conn.Close()
 		return nil, err
 	}
+	conn.SetDeadline(time.Time{})
 	return ws, err
 }
 
@@ -222,17 +239,15 @@ func wsDialAddress(location *url.URL) string {
 	return location.Host
 }
 
-func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
-	d := &net.Dialer{KeepAlive: tcpKeepAliveInterval}
-	return d.DialContext(ctx, network, addr)
+func contextDialer(ctx context.Context) *net.Dialer {
+	return &net.Dialer{Cancel: ctx.Done(), KeepAlive: tcpKeepAliveInterval, Deadline: dialDeadline(ctx)}
 }
 
-func contextDialer(ctx context.Context) *net.Dialer {
-	dialer := &net.Dialer{Cancel: ctx.Done(), KeepAlive: tcpKeepAliveInterval}
+// dialDeadline returns the deadline of ctx, or the default dial timeout from now
+// if it has none.
+func dialDeadline(ctx context.Context) time.Time {
 	if deadline, ok := ctx.Deadline(); ok {
-		dialer.Deadline = deadline
-	} else {
-		dialer.Deadline = time.Now().Add(defaultDialTimeout)
+		return deadline
 	}
-	return dialer
+	return time.Now().Add(defaultDialTimeout)
 }
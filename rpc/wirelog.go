@@ -0,0 +1,145 @@
+// Copyright 2019 The go-fiscobcos Authors
+// This file is part of the go-fiscobcos library.
+//
+// The go-fiscobcos library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-fiscobcos library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-fiscobcos library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chislab/go-fiscobcos/log"
+)
+
+const (
+	// maxLoggedHex is the length beyond which hex strings are truncated in the
+	// wire log, long enough to recognize a transaction by.
+	maxLoggedHex = 130
+
+	// redacted replaces secrets in the wire log.
+	redacted = "<redacted>"
+)
+
+// secretFields are the names of object fields whose values are never logged.
+var secretFields = []string{"private", "secret", "password", "passphrase", "mnemonic", "seed"}
+
+// loggerBox wraps the wire logger of a client, atomic.Value needs a consistent
+// concrete type.
+type loggerBox struct {
+	l log.Logger
+}
+
+// SetLogger sets the logger receiving the wire log of the client: every request
+// with its method, parameters, response size, duration and error and, on the
+// channel transport, the type, seq and size of every frame. Records are logged
+// at debug level, the logger's handler decides whether they are emitted; the
+// parameters are only formatted if they are.
+//
+// Long hex strings like transaction data are truncated. Values which look like
+// private keys or certificates, i.e. unprefixed 32 byte hex strings, PEM blocks
+// and fields named like secrets, are redacted. nil disables the wire log, the
+// default, which then costs nothing.
+func (c *Client) SetLogger(l log.Logger) {
+	c.wireLog.Store(loggerBox{l})
+}
+
+// logger returns the wire logger of the client, or nil if there is none.
+func (c *Client) logger() log.Logger {
+	box, _ := c.wireLog.Load().(loggerBox)
+	return box.l
+}
+
+// logParams formats request parameters for the wire log.
+func logParams(args []interface{}) log.Lazy {
+	return log.Lazy{Fn: func() string {
+		if len(args) == 0 {
+			return "[]"
+		}
+		raw, err := json.Marshal(args)
+		if err != nil {
+			return fmt.Sprintf("<unencodable: %v>", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var params interface{}
+		if err := dec.Decode(&params); err != nil {
+			return fmt.Sprintf("<undecodable: %v>", err)
+		}
+		// Keep the placeholders readable, the encoder escapes angle brackets.
+		out := new(bytes.Buffer)
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.Encode(sanitizeParam(params))
+		return strings.TrimSuffix(out.String(), "\n")
+	}}
+}
+
+// sanitizeParam truncates long hex strings and redacts secrets in a decoded
+// JSON value.
+func sanitizeParam(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return sanitizeString(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitizeParam(v[i])
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			if secretField(key) {
+				v[key] = redacted
+			} else {
+				v[key] = sanitizeParam(value)
+			}
+		}
+	}
+	return v
+}
+
+func sanitizeString(s string) string {
+	switch {
+	case strings.Contains(s, "-----BEGIN"):
+		return redacted
+	case len(s) == 64 && isHex(s):
+		// Hashes are 0x-prefixed, bare 32 byte hex is likely a key.
+		return redacted
+	case len(s) > maxLoggedHex && strings.HasPrefix(s, "0x") && isHex(s[2:]):
+		return fmt.Sprintf("%s…(%d bytes)", s[:maxLoggedHex], (len(s)-2)/2)
+	}
+	return s
+}
+
+func secretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		switch {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
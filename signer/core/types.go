@@ -94,7 +94,7 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 		input = *args.Input
 	}
 	if args.To == nil {
-		return types.NewContractCreation(uint64(args.RandomId), 0, (*big.Int)(&args.Value), uint64(args.Gas), (*big.Int)(&args.GasPrice), input, big.NewInt(1), big.NewInt(1), nil)
+		return types.NewContractCreation(new(big.Int).SetUint64(uint64(args.RandomId)), (*big.Int)(&args.Value), uint64(args.Gas), (*big.Int)(&args.GasPrice), input, new(big.Int), big.NewInt(1), big.NewInt(1), nil)
 	}
-	return types.NewTransaction(uint64(args.RandomId), 0, args.To.Address(), (*big.Int)(&args.Value), (uint64)(args.Gas), (*big.Int)(&args.GasPrice), input, big.NewInt(1), big.NewInt(1), nil)
+	return types.NewTransaction(new(big.Int).SetUint64(uint64(args.RandomId)), args.To.Address(), (*big.Int)(&args.Value), (uint64)(args.Gas), (*big.Int)(&args.GasPrice), input, new(big.Int), big.NewInt(1), big.NewInt(1), nil)
 }